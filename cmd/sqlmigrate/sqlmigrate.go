@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/sqlutil"
+	"github.com/skycoin/teller/src/webhook"
+)
+
+// migrate copies the exchange, scanner, used addresses and webhook data of a bolt db into a SQL db
+func migrate(lg logrus.FieldLogger, db *bolt.DB, sqlDB *sqlutil.DB) error {
+	exchangeStore, err := exchange.NewSQLStore(lg, sqlDB)
+	if err != nil {
+		return err
+	}
+
+	scanStore, err := scanner.NewSQLStore(lg, sqlDB)
+	if err != nil {
+		return err
+	}
+
+	webhookStore, err := webhook.NewSQLStore(sqlDB)
+	if err != nil {
+		return err
+	}
+
+	// The exchange import refuses a SQL db that already has data, so it goes first
+	if err := exchangeStore.ImportBolt(db); err != nil {
+		return err
+	}
+	log.Println("exchange data migrated")
+
+	if err := scanStore.ImportBolt(db); err != nil {
+		return err
+	}
+	log.Println("scanner data migrated")
+
+	if err := addrs.ImportBolt(sqlDB, db); err != nil {
+		return err
+	}
+	log.Println("used addresses migrated")
+
+	if err := webhookStore.ImportBolt(db); err != nil {
+		return err
+	}
+	log.Println("webhook data migrated")
+
+	return nil
+}
+
+// verify compares the number of rows of the SQL db with the number of records of the bolt db.
+// It does not open the stores, which would initialize a SQL db whose bolt db had no ledger or statistics.
+func verify(db *bolt.DB, sqlDB *sqlutil.DB) error {
+	boltCounts := make(sqlutil.RowCounts)
+	sqlCounts := make(sqlutil.RowCounts)
+
+	for _, f := range []func(*bolt.DB) (sqlutil.RowCounts, error){
+		exchange.BoltRowCounts,
+		scanner.BoltRowCounts,
+		addrs.BoltRowCounts,
+		webhook.BoltRowCounts,
+	} {
+		counts, err := f(db)
+		if err != nil {
+			return err
+		}
+		boltCounts.Add(counts)
+	}
+
+	for _, f := range []func(*sqlutil.DB) (sqlutil.RowCounts, error){
+		exchange.RowCounts,
+		scanner.RowCounts,
+		addrs.RowCounts,
+		webhook.RowCounts,
+	} {
+		counts, err := f(sqlDB)
+		if err != nil {
+			return err
+		}
+		sqlCounts.Add(counts)
+	}
+
+	tables := make([]string, 0, len(sqlCounts))
+	for table := range sqlCounts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		log.Printf("%s: %d rows\n", table, sqlCounts[table])
+	}
+
+	if diffs := boltCounts.Diff(sqlCounts); len(diffs) != 0 {
+		return errors.New("row counts differ (bolt != sql): " + strings.Join(diffs, ", "))
+	}
+
+	return nil
+}
+
+func main() {
+	dbname := flag.String("db", "", "bolt db to migrate")
+	driver := flag.String("driver", sqlutil.DriverSQLite3, "SQL driver, sqlite3 or postgres")
+	dsn := flag.String("dsn", "", "SQL data source name, a file path for sqlite3 or a connection string for postgres")
+	verifyOnly := flag.Bool("verify", false, "only compare the row counts of a migrated db, default false")
+	flag.Parse()
+	if *dbname == "" {
+		flag.PrintDefaults()
+		log.Fatal(errors.New("require db"))
+	}
+	if *dsn == "" {
+		flag.PrintDefaults()
+		log.Fatal(errors.New("require dsn"))
+	}
+
+	// Check the bolt db exists, bolt.Open would create it
+	if _, err := os.Stat(*dbname); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := bolt.Open(*dbname, 0600, &bolt.Options{
+		ReadOnly: true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Println("Failed to close db:", err)
+		}
+	}()
+
+	sqlDB, err := sqlutil.Open(*driver, *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer func() {
+		if err := sqlDB.Close(); err != nil {
+			log.Println("Failed to close SQL db:", err)
+		}
+	}()
+
+	lg := logrus.New()
+	lg.Level = logrus.WarnLevel
+
+	if !*verifyOnly {
+		if err := migrate(lg, db, sqlDB); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := verify(db, sqlDB); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("%s and the %s db have the same row counts\n", *dbname, *driver)
+}
@@ -0,0 +1,228 @@
+// Skycoin teller signer, which holds the hot wallet and signs the transactions teller creates
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/spf13/pflag"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/signer"
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/walletcrypt"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	configOpt := pflag.StringP("config", "c", "signer.toml", "path to the configuration file")
+	walletPasswordFdOpt := pflag.Int("wallet-password-fd", -1, "file descriptor to read the wallet password from")
+	insecureWalletOpt := pflag.Bool("insecure-unencrypted-wallet", false, "allow unencrypted wallet files")
+	pflag.Parse()
+
+	cfg, err := signer.LoadConfig(*configOpt)
+	if err != nil {
+		return fmt.Errorf("Config error:\n%v", err)
+	}
+
+	rusloggger, err := logger.NewLogger(cfg.LogFilename, cfg.Debug)
+	if err != nil {
+		return fmt.Errorf("Failed to create Logrus logger: %v", err)
+	}
+
+	log := rusloggger.WithField("prefix", "teller-signer")
+
+	wallets, err := openWallets(cfg.Wallets, *walletPasswordFdOpt, *insecureWalletOpt)
+	if err != nil {
+		log.WithError(err).Error("Open wallets failed")
+		return err
+	}
+
+	if *insecureWalletOpt {
+		log.WithField("notice", logger.WatchNotice).Warning("Unencrypted wallets are allowed by --insecure-unencrypted-wallet")
+	}
+
+	policy, err := newPolicy(cfg)
+	if err != nil {
+		log.WithError(err).Error("Invalid policy")
+		return err
+	}
+
+	token, err := signer.ReadToken(cfg.TokenFile)
+	if err != nil {
+		log.WithError(err).Error("signer.ReadToken failed")
+		return err
+	}
+
+	db, err := bolt.Open(cfg.DBFilename, 0600, &bolt.Options{
+		Timeout: 1 * time.Second,
+	})
+	if err != nil {
+		log.WithError(err).Error("Open db failed")
+		return err
+	}
+	defer db.Close()
+
+	s, err := signer.New(log, db, policy, wallets, token)
+	if err != nil {
+		log.WithError(err).Error("signer.New failed")
+		return err
+	}
+
+	ln, err := listenUnix(cfg.Socket)
+	if err != nil {
+		log.WithError(err).Error("Listen on socket failed")
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:      s.Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	errC := make(chan error, 1)
+	go func() {
+		log.WithField("socket", cfg.Socket).Info("Serving signer API")
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			errC <- err
+		}
+	}()
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt)
+
+	select {
+	case <-sigchan:
+		log.Info("Shutting down")
+	case err = <-errC:
+		log.WithError(err).Error("Serve failed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if shutdownErr := srv.Shutdown(ctx); shutdownErr != nil {
+		log.WithError(shutdownErr).Error("Shutdown failed")
+	}
+
+	return err
+}
+
+// openWallets opens the wallet files, reading the password if any of them is encrypted
+func openWallets(files []string, passwordFd int, allowUnencrypted bool) ([]*walletcrypt.Keys, error) {
+	encrypted, err := walletcrypt.AnyEncrypted(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var password []byte
+	if encrypted {
+		password, err = walletcrypt.ReadPassword(passwordFd)
+		if err != nil {
+			return nil, err
+		}
+		defer walletcrypt.ZeroPassword(password)
+	}
+
+	var wallets []*walletcrypt.Keys
+	for _, f := range files {
+		w, err := walletcrypt.OpenKeys(f, password, allowUnencrypted)
+		if err != nil {
+			return nil, err
+		}
+
+		wallets = append(wallets, w)
+	}
+
+	return wallets, nil
+}
+
+// newPolicy creates the signing policy from the config
+func newPolicy(cfg signer.Config) (*signer.Policy, error) {
+	maxSend, err := droplet.FromString(cfg.MaxSend)
+	if err != nil {
+		return nil, err
+	}
+
+	dailyLimit, err := droplet.FromString(cfg.DailyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &signer.Policy{
+		MaxSend:          maxSend,
+		DailyLimit:       dailyLimit,
+		AllowedAddresses: cfg.AllowedAddresses,
+	}
+
+	if cfg.TellerDB != "" {
+		policy.BoundAddresses = func() ([]string, error) {
+			return readBoundSkyAddresses(cfg.TellerDB)
+		}
+	}
+
+	return policy, nil
+}
+
+// readBoundSkyAddresses reads the bound SKY addresses from a teller database export.
+// The export is reopened each time, so that a newer export is picked up without a restart.
+func readBoundSkyAddresses(path string) ([]string, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		ReadOnly: true,
+		Timeout:  1 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Open teller db export failed: %v", err)
+	}
+	defer db.Close()
+
+	addrs, err := exchange.GetBoundSkyAddresses(db)
+	if err != nil {
+		return nil, fmt.Errorf("Read teller db export failed: %v", err)
+	}
+
+	return addrs, nil
+}
+
+// listenUnix listens on a Unix socket only accessible to the current user and group,
+// so that teller can connect by sharing the signer's group.
+// A stale socket left by a previous run is removed.
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
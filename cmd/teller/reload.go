@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/teller"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// Address files of each coin type, read from a config
+var addressFiles = map[string]func(cfg config.Config) string{
+	config.CoinTypeBTC: func(cfg config.Config) string { return cfg.BtcAddresses },
+	config.CoinTypeETH: func(cfg config.Config) string { return cfg.EthAddresses },
+	config.CoinTypeSKY: func(cfg config.Config) string { return cfg.SkyAddresses },
+}
+
+// Loaders of the address files of each coin type
+var addressLoaders = map[string]func(addrsFile string) ([]string, error){
+	config.CoinTypeBTC: addrs.LoadBTCAddresses,
+	config.CoinTypeETH: addrs.LoadETHAddresses,
+	config.CoinTypeSKY: addrs.LoadSKYAddresses,
+}
+
+// configReloader re-reads the config file and applies the settings that can be changed while running
+type configReloader struct {
+	sync.Mutex
+	log        logrus.FieldLogger
+	configName string
+	appDir     string
+	startup    config.Config // The config loaded at startup
+	cfg        config.Config // The config running, with the reloaded changes applied
+	exchange   *exchange.Exchange
+	teller     *teller.Teller
+	addrs      map[string]*addrs.Addrs // Address pools of the enabled coin types
+}
+
+// ReloadConfig re-reads the config file and applies the changes to the settings that can be changed while running.
+// Changes to the other settings are ignored until teller is restarted.
+// Nothing is applied if the config or an address file is invalid, or if the address pools can't be checked.
+// actor is the operator who requested the reload, or "SIGHUP".
+func (r *configReloader) ReloadConfig(actor string) (*config.ReloadDiff, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	log := r.log.WithField("actor", actor)
+
+	loaded, err := config.Load(r.configName, r.appDir)
+	if err != nil {
+		log.WithError(err).Error("Config reload failed, the config is invalid")
+		return nil, fmt.Errorf("Config error:\n%v", err)
+	}
+
+	loaded.GitCommit = r.cfg.GitCommit
+	loaded.StartTime = r.cfg.StartTime
+
+	cfg, diff := r.cfg.Reload(loaded)
+
+	if cfg.SkyExchanger.SendEnabled && !r.startup.SkyExchanger.SendEnabled {
+		cfg.SkyExchanger.SendEnabled = false
+		diff.Ignore("sky_exchanger.send_enabled", exchange.ErrSendEnableRequiresRestart.Error())
+	}
+
+	// Load the address files and remove the used addresses before applying anything,
+	// so that an invalid file or a failed lookup rejects the reload
+	addresses := make(map[string][]string, len(r.addrs))
+	for ct := range r.addrs {
+		file := addressFiles[ct](cfg)
+		a, err := addressLoaders[ct](file)
+		if err != nil {
+			log.WithError(err).WithField("file", file).Error("Config reload failed, the addresses file is invalid")
+			return nil, fmt.Errorf("%s addresses file %s invalid: %v", ct, file, err)
+		}
+
+		a, err = r.addrs[ct].UnusedAddresses(a)
+		if err != nil {
+			log.WithError(err).WithField("coinType", ct).Error("Config reload failed, Addrs.UnusedAddresses failed")
+			return nil, err
+		}
+
+		addresses[ct] = a
+	}
+
+	// exchange.ApplyConfig changes nothing if it fails, and the rest can't fail
+	if err := r.exchange.ApplyConfig(cfg.SkyExchanger); err != nil {
+		log.WithError(err).Error("Config reload failed, exchange.ApplyConfig failed")
+		return nil, err
+	}
+
+	r.teller.ApplyConfig(cfg)
+
+	for ct, a := range addresses {
+		r.addrs[ct].ReplaceAddresses(a)
+	}
+
+	r.cfg = cfg
+
+	log = log.WithField("notice", logger.WatchNotice)
+	log.WithField("applied", diff.Applied).Info("Config reloaded")
+	if len(diff.Ignored) != 0 {
+		log.WithField("ignored", diff.Ignored).Warn("Config changes that require a restart were ignored")
+	}
+
+	return &diff, nil
+}
+
+// catchReload reloads the config on SIGHUP until quit is closed
+func catchReload(quit <-chan struct{}, r *configReloader) {
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, syscall.SIGHUP)
+	defer signal.Stop(sigchan)
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-sigchan:
+			// Errors are logged by ReloadConfig
+			r.ReloadConfig("SIGHUP") // nolint: errcheck
+		}
+	}
+}
@@ -21,13 +21,19 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/alert"
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/exchange"
 	"github.com/skycoin/teller/src/monitor"
 	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/screening"
 	"github.com/skycoin/teller/src/sender"
+	"github.com/skycoin/teller/src/signer"
 	"github.com/skycoin/teller/src/teller"
 	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/sqlutil"
+	"github.com/skycoin/teller/src/util/walletcrypt"
+	"github.com/skycoin/teller/src/webhook"
 )
 
 var (
@@ -40,7 +46,13 @@ func main() {
 	}
 }
 
-func createBtcScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scanner.Store) (*scanner.BTCScanner, error) {
+// scanStorer is a scanner store that is set up for each coin type scanned
+type scanStorer interface {
+	scanner.Storer
+	AddSupportedCoin(string) error
+}
+
+func createBtcScanner(log logrus.FieldLogger, cfg config.Config, scanStore scanStorer) (*scanner.BTCScanner, error) {
 	certs, err := ioutil.ReadFile(cfg.BtcRPC.Cert)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to read cfg.BtcRPC.Cert %s: %v", cfg.BtcRPC.Cert, err)
@@ -80,7 +92,7 @@ func createBtcScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scan
 	return btcScanner, nil
 }
 
-func createEthScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scanner.Store) (*scanner.ETHScanner, error) {
+func createEthScanner(log logrus.FieldLogger, cfg config.Config, scanStore scanStorer) (*scanner.ETHScanner, error) {
 	ethrpc, err := scanner.NewEthClient(cfg.EthRPC.Server, cfg.EthRPC.Port)
 	if err != nil {
 		log.WithError(err).Error("Connect geth failed")
@@ -106,7 +118,7 @@ func createEthScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scan
 }
 
 // createSkyScanner returns a new sky scanner instance
-func createSkyScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scanner.Store) (*scanner.SKYScanner, error) {
+func createSkyScanner(log logrus.FieldLogger, cfg config.Config, scanStore scanStorer) (*scanner.SKYScanner, error) {
 	skyrpc := scanner.NewSkyClient(cfg.SkyRPC.Address)
 	err := scanStore.AddSupportedCoin(config.CoinTypeSKY)
 	if err != nil {
@@ -127,6 +139,57 @@ func createSkyScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scan
 	return skyScanner, nil
 }
 
+// openSQLDB opens the SQL database of the storage backend.
+// A relative SQLite database path is inside the data directory.
+func openSQLDB(appDir string, cfg config.Storage) (*sqlutil.DB, error) {
+	dsn := cfg.DSN
+	if cfg.Backend == config.StorageSQLite3 && !filepath.IsAbs(dsn) {
+		dsn = filepath.Join(appDir, dsn)
+	}
+
+	return sqlutil.Open(cfg.Backend, dsn)
+}
+
+// createAddrs creates the deposit address manager of a coin type,
+// recording the used addresses in sqlDB if set, otherwise in db
+func createAddrs(log logrus.FieldLogger, coinType, addrsFile string, db *bolt.DB, sqlDB *sqlutil.DB) (*addrs.Addrs, error) {
+	if sqlDB == nil {
+		switch coinType {
+		case config.CoinTypeBTC:
+			return addrs.NewBTCAddrs(log, db, addrsFile)
+		case config.CoinTypeETH:
+			return addrs.NewETHAddrs(log, db, addrsFile)
+		case config.CoinTypeSKY:
+			return addrs.NewSKYAddrs(log, db, addrsFile)
+		default:
+			return nil, config.ErrUnsupportedCoinType
+		}
+	}
+
+	var addresses []string
+	var err error
+	switch coinType {
+	case config.CoinTypeBTC:
+		addresses, err = addrs.LoadBTCAddresses(addrsFile)
+	case config.CoinTypeETH:
+		addresses, err = addrs.LoadETHAddresses(addrsFile)
+	case config.CoinTypeSKY:
+		addresses, err = addrs.LoadSKYAddresses(addrsFile)
+	default:
+		err = config.ErrUnsupportedCoinType
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := addrs.NewSQLStore(sqlDB, coinType)
+	if err != nil {
+		return nil, err
+	}
+
+	return addrs.NewAddrsWithStore(log, used, addresses)
+}
+
 func createPidFile(log logrus.FieldLogger, cfg config.Config) error {
 	// The pidfile will already be set if the user used -pidfile on the command line,
 	// do not overwrite it in that case.
@@ -147,6 +210,46 @@ func createPidFile(log logrus.FieldLogger, cfg config.Config) error {
 	return nil
 }
 
+// createSkyClient creates the client sending from the hot wallets,
+// which are either loaded from wallet files or held by an external signer.
+// The payouts are recorded in db, for the hot wallets' daily limits.
+func createSkyClient(log logrus.FieldLogger, cfg config.Config, db *bolt.DB, walletPassword []byte, allowUnencrypted bool) (*sender.RPC, error) {
+	store, err := sender.NewStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.SkyExchanger.Signer.Socket == "" {
+		return sender.NewRPC(cfg.Coin, cfg.SkyExchanger.HotWallets(), store, cfg.SkyRPC.Address, walletPassword, allowUnencrypted)
+	}
+
+	signerCfg := cfg.SkyExchanger.Signer
+	signerClient, err := signer.NewClient(signerCfg.Socket, signerCfg.TokenFile, signerCfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	signerWallets, err := signerClient.Wallets()
+	if err != nil {
+		return nil, fmt.Errorf("Get wallets from signer failed: %v", err)
+	}
+
+	wallets := make([]sender.SignerWallet, len(signerWallets))
+	for i, w := range signerWallets {
+		log.WithFields(logrus.Fields{
+			"wallet":    w.Name,
+			"addresses": len(w.Addresses),
+		}).Info("Using wallet held by external signer")
+
+		wallets[i] = sender.SignerWallet{
+			Name:      w.Name,
+			Addresses: w.Addresses,
+		}
+	}
+
+	return sender.NewSignerRPC(cfg.Coin, wallets, signerClient, store, cfg.SkyRPC.Address)
+}
+
 func run() error {
 	cur, err := user.Current()
 	if err != nil {
@@ -157,6 +260,8 @@ func run() error {
 
 	appDirOpt := pflag.StringP("dir", "d", defaultAppDir, "application data directory")
 	configNameOpt := pflag.StringP("config", "c", "config", "name of configuration file")
+	walletPasswordFdOpt := pflag.Int("wallet-password-fd", -1, "file descriptor to read the hot wallet password from")
+	insecureWalletOpt := pflag.Bool("insecure-unencrypted-wallet", false, "allow unencrypted hot wallet files")
 	pflag.Parse()
 
 	if err := createFolderIfNotExist(*appDirOpt); err != nil {
@@ -183,6 +288,36 @@ func run() error {
 
 	log.WithField("config", cfg.Redacted()).Info("Loaded teller config")
 
+	// Read the hot wallet password before starting any services, in case it is prompted for
+	var walletPassword []byte
+	defer func() {
+		walletcrypt.ZeroPassword(walletPassword)
+	}()
+	if !cfg.Dummy.Sender && cfg.SkyExchanger.Signer.Socket == "" {
+		var files []string
+		for _, w := range cfg.SkyExchanger.HotWallets() {
+			files = append(files, w.File)
+		}
+
+		encrypted, err := walletcrypt.AnyEncrypted(files)
+		if err != nil {
+			log.WithError(err).Error("walletcrypt.AnyEncrypted failed")
+			return err
+		}
+
+		if encrypted {
+			walletPassword, err = walletcrypt.ReadPassword(*walletPasswordFdOpt)
+			if err != nil {
+				log.WithError(err).Error("walletcrypt.ReadPassword failed")
+				return err
+			}
+		}
+
+		if *insecureWalletOpt {
+			log.WithField("notice", logger.WatchNotice).Warning("Unencrypted hot wallets are allowed by --insecure-unencrypted-wallet")
+		}
+	}
+
 	quit := make(chan struct{})
 	go catchInterrupt(quit)
 
@@ -203,6 +338,19 @@ func run() error {
 		return err
 	}
 
+	// Open the SQL database, if the exchange, scanner, used addresses and webhook data are kept in one
+	var sqlDB *sqlutil.DB
+	if cfg.Storage.IsSQL() {
+		sqlDB, err = openSQLDB(*appDirOpt, cfg.Storage)
+		if err != nil {
+			log.WithError(err).Error("Open SQL db failed")
+			return err
+		}
+		defer sqlDB.Close()
+
+		log.WithField("backend", cfg.Storage.Backend).Info("Using SQL storage")
+	}
+
 	errC := make(chan error, 20)
 	var wg sync.WaitGroup
 
@@ -229,6 +377,7 @@ func run() error {
 	var scanSkyService scanner.Scanner
 	var sendService *sender.SendService
 	var sendRPC sender.Sender
+	var sweeper *sender.Sweeper
 	var btcAddrMgr *addrs.Addrs
 	var ethAddrMgr *addrs.Addrs
 	var skyAddrMgr *addrs.Addrs
@@ -239,9 +388,14 @@ func run() error {
 	dummyMux := http.NewServeMux()
 
 	// create scan storer
-	scanStore, err := scanner.NewStore(log, db)
+	var scanStore scanStorer
+	if sqlDB != nil {
+		scanStore, err = scanner.NewSQLStore(log, sqlDB)
+	} else {
+		scanStore, err = scanner.NewStore(log, db)
+	}
 	if err != nil {
-		log.WithError(err).Error("scanner.NewStore failed")
+		log.WithError(err).Error("Create scanner store failed")
 		return err
 	}
 
@@ -310,15 +464,26 @@ func run() error {
 
 	if cfg.Dummy.Sender {
 		log.Info("skyd disabled, running dummy sender")
-		sendRPC = sender.NewDummySender(log)
+		sendRPC = sender.NewDummySender(log, cfg.Coin)
 		sendRPC.(*sender.DummySender).BindHandlers(dummyMux)
 	} else {
-		skyClient, err := sender.NewRPC(cfg.SkyExchanger.Wallet, cfg.SkyRPC.Address)
+		skyClient, err := createSkyClient(log, cfg, db, walletPassword, *insecureWalletOpt)
+		walletcrypt.ZeroPassword(walletPassword)
 		if err != nil {
-			log.WithError(err).Error("sender.NewRPC failed")
+			log.WithError(err).Error("createSkyClient failed")
 			return err
 		}
 
+		if cfg.SkyExchanger.Sweep.ColdAddress != "" {
+			sweeper, err = sender.NewSweeper(log, cfg.SkyExchanger.Sweep, skyClient)
+			if err != nil {
+				log.WithError(err).Error("sender.NewSweeper failed")
+				return err
+			}
+
+			background("sweeper.Run", errC, sweeper.Run)
+		}
+
 		sendService = sender.NewService(log, skyClient)
 
 		background("sendService.Run", errC, sendService.Run)
@@ -336,12 +501,20 @@ func run() error {
 	}
 
 	// create exchange service
-	exchangeStore, err := exchange.NewStore(log, db)
+	var exchangeStore exchange.Storer
+	if sqlDB != nil {
+		exchangeStore, err = exchange.NewSQLStore(log, sqlDB)
+	} else {
+		exchangeStore, err = exchange.NewStore(log, db)
+	}
 	if err != nil {
-		log.WithError(err).Error("exchange.NewStore failed")
+		log.WithError(err).Error("Create exchange store failed")
 		return err
 	}
 
+	// The webhook events are only recorded while there are endpoints to deliver them to
+	exchange.SetWebhookEvents(exchangeStore, len(cfg.Webhooks.Endpoints) != 0)
+
 	var exchangeClient *exchange.Exchange
 
 	switch cfg.SkyExchanger.BuyMethod {
@@ -359,11 +532,49 @@ func run() error {
 			log.WithError(err).Error("exchange.NewPassthroughExchange failed")
 			return err
 		}
+	case config.BuyMethodHybrid:
+		var err error
+		exchangeClient, err = exchange.NewHybridExchange(log, cfg.SkyExchanger, exchangeStore, multiplexer, sendRPC)
+		if err != nil {
+			log.WithError(err).Error("exchange.NewHybridExchange failed")
+			return err
+		}
 	default:
 		log.WithError(config.ErrInvalidBuyMethod).Error()
 		return config.ErrInvalidBuyMethod
 	}
 
+	// create the address deny lists
+	denyLists, err := screening.New(log, db, cfg.Screening)
+	if err != nil {
+		log.WithError(err).Error("screening.New failed")
+		return err
+	}
+
+	background("denyLists.Run", errC, denyLists.Run)
+
+	// create the webhook dispatcher, which delivers the events the exchange adds to its outbox
+	var webhookStore webhook.Storer
+	if sqlDB != nil {
+		webhookStore, err = webhook.NewSQLStore(sqlDB)
+	} else {
+		webhookStore, err = webhook.NewStore(db)
+	}
+	if err != nil {
+		log.WithError(err).Error("Create webhook store failed")
+		return err
+	}
+
+	webhooks, err := webhook.NewWithStore(log, webhookStore, cfg.Webhooks)
+	if err != nil {
+		log.WithError(err).Error("webhook.NewWithStore failed")
+		return err
+	}
+
+	background("webhooks.Run", errC, webhooks.Run)
+
+	exchangeClient.SetAddressScreener(denyLists)
+
 	background("exchangeClient.Run", errC, exchangeClient.Run)
 
 	// create AddrManager
@@ -371,7 +582,7 @@ func run() error {
 
 	if cfg.BtcScanner.Enabled {
 		// create bitcoin address manager
-		btcAddrMgr, err = addrs.NewBTCAddrs(log, db, cfg.BtcAddresses)
+		btcAddrMgr, err = createAddrs(log, config.CoinTypeBTC, cfg.BtcAddresses, db, sqlDB)
 		if err != nil {
 			log.WithError(err).Error("Create BTC deposit address manager failed")
 			return err
@@ -384,7 +595,7 @@ func run() error {
 
 	if cfg.EthScanner.Enabled {
 		// create ethereum address manager
-		ethAddrMgr, err = addrs.NewETHAddrs(log, db, cfg.EthAddresses)
+		ethAddrMgr, err = createAddrs(log, config.CoinTypeETH, cfg.EthAddresses, db, sqlDB)
 		if err != nil {
 			log.WithError(err).Error("Create ETH deposit address manager failed")
 			return err
@@ -397,7 +608,7 @@ func run() error {
 
 	if cfg.SkyScanner.Enabled {
 		// create sky address manager
-		skyAddrMgr, err = addrs.NewSKYAddrs(log, db, cfg.SkyAddresses)
+		skyAddrMgr, err = createAddrs(log, config.CoinTypeSKY, cfg.SkyAddresses, db, sqlDB)
 		if err != nil {
 			log.WithError(err).Error("Create SKY deposit address manager failed")
 			return err
@@ -407,12 +618,60 @@ func run() error {
 			return err
 		}
 	}
-	tellerServer := teller.New(log, exchangeClient, addrManager, cfg)
+
+	// create the alerter, which alerts the operators of WatchNotice logs and degraded health
+	alertScanners := make(map[string]alert.ScanStatuser)
+	if btcScanner != nil {
+		alertScanners[config.CoinTypeBTC] = btcScanner
+	}
+	if ethScanner != nil {
+		alertScanners[config.CoinTypeETH] = ethScanner
+	}
+	if skyScanner != nil {
+		alertScanners[config.CoinTypeSKY] = skyScanner
+	}
+
+	alerter, err := alert.New(log, cfg.Alerts, exchangeClient, addrManager, alertScanners)
+	if err != nil {
+		log.WithError(err).Error("alert.New failed")
+		return err
+	}
+
+	if cfg.Alerts.Enabled() {
+		rusloggger.AddHook(alerter.Hook())
+	}
+
+	background("alerter.Run", errC, alerter.Run)
+
+	tellerServer := teller.New(log, exchangeClient, addrManager, denyLists, cfg)
 
 	// Run the service
 	background("tellerServer.Run", errC, tellerServer.Run)
+
+	// Reload the config on SIGHUP
+	reloader := &configReloader{
+		log:        log,
+		configName: *configNameOpt,
+		appDir:     *appDirOpt,
+		startup:    cfg,
+		cfg:        cfg,
+		exchange:   exchangeClient,
+		teller:     tellerServer,
+		addrs:      make(map[string]*addrs.Addrs),
+	}
+	if btcAddrMgr != nil {
+		reloader.addrs[config.CoinTypeBTC] = btcAddrMgr
+	}
+	if ethAddrMgr != nil {
+		reloader.addrs[config.CoinTypeETH] = ethAddrMgr
+	}
+	if skyAddrMgr != nil {
+		reloader.addrs[config.CoinTypeSKY] = skyAddrMgr
+	}
+	go catchReload(quit, reloader)
+
 	// Start monitor service
-	monitorService := monitor.New(log, cfg, addrManager, exchangeClient, scanStore, db)
+	monitorService := monitor.New(log, cfg, addrManager, exchangeClient, exchangeClient, exchangeClient, exchangeClient, exchangeClient, reloader, webhooks, scanStore, denyLists, db)
 	background("monitorService.Run", errC, monitorService.Run)
 
 	var finalErr error
@@ -453,6 +712,20 @@ func run() error {
 	log.Info("Shutting down exchangeClient")
 	exchangeClient.Shutdown()
 
+	log.Info("Shutting down denyLists")
+	denyLists.Shutdown()
+
+	log.Info("Shutting down webhooks")
+	webhooks.Shutdown()
+
+	log.Info("Shutting down alerter")
+	alerter.Shutdown()
+
+	if sweeper != nil {
+		log.Info("Shutting down sweeper")
+		sweeper.Shutdown()
+	}
+
 	// close the skycoin send service
 	if sendService != nil {
 		log.Info("Shutting down sendService")
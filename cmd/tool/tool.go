@@ -7,6 +7,7 @@ import (
 	"os/user"
 
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -20,8 +21,12 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	btcrpcclient "github.com/btcsuite/btcd/rpcclient"
+	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/wallet"
+
+	"github.com/skycoin/teller/src/util/walletcrypt"
 )
 
 const (
@@ -40,6 +45,7 @@ Usage:
 The commands are:
 
     addbtcaddress       add the bitcoin address to the deposit address pool
+    encryptwallet       encrypt the secret keys of a skycoin wallet for use as a hot wallet
     getbtcaddress       list all bitcoin deposit address in the pool
     newbtcaddress       generate bitcoin address
     scanblock           scan block from specific height to get all vout with interger value
@@ -105,6 +111,8 @@ func main() {
 			fmt.Println("usage: server user pass cert_path height")
 		case "newkeys":
 			fmt.Println("usage: newkeys")
+		case "encryptwallet":
+			fmt.Println("usage: encryptwallet wallet_file out_file. The password is read from TELLER_WALLET_PASSWORD or prompted for. The wallet seed is not included in out_file.")
 		}
 		return
 	case "newkeys":
@@ -122,6 +130,20 @@ func main() {
 			return
 		}
 		fmt.Println(string(v))
+	case "encryptwallet":
+		if len(args) != 3 {
+			fmt.Println("Invalid arguments")
+			fmt.Println(usage)
+			return
+		}
+
+		if err := encryptWallet(args[1], args[2]); err != nil {
+			fmt.Println("Encrypt wallet failed:", err)
+			return
+		}
+
+		fmt.Println("Encrypted wallet written to", args[2])
+		fmt.Println("The wallet seed is not stored in the encrypted wallet, make sure it is backed up")
 	case "addbtcaddress":
 		v, err := ioutil.ReadFile(*btcAddrFile)
 		if err != nil {
@@ -266,3 +288,65 @@ func main() {
 		log.Printf("Unknown command: %s\n", cmd)
 	}
 }
+
+// encryptWallet writes the wallet in walletFile to outFile with its secret keys encrypted
+func encryptWallet(walletFile, outFile string) error {
+	wlt, err := wallet.Load(walletFile)
+	if err != nil {
+		return err
+	}
+	defer walletcrypt.Zero(wlt)
+
+	if err := wlt.Validate(); err != nil {
+		return err
+	}
+
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for i := range password {
+			password[i] = 0
+		}
+	}()
+
+	ew, err := walletcrypt.Encrypt(wlt, password, walletcrypt.DefaultIterations)
+	if err != nil {
+		return err
+	}
+
+	return ew.Save(outFile)
+}
+
+// readNewPassword reads a password from TELLER_WALLET_PASSWORD, or prompts for it twice
+func readNewPassword() ([]byte, error) {
+	if password, ok := os.LookupEnv(walletcrypt.PasswordEnv); ok {
+		return []byte(password), nil
+	}
+
+	stdin := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(stdin) {
+		return nil, errors.New("stdin is not a terminal, set TELLER_WALLET_PASSWORD")
+	}
+
+	fmt.Fprint(os.Stderr, "Wallet password: ")
+	password, err := terminal.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm wallet password: ")
+	confirm, err := terminal.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(password, confirm) {
+		return nil, errors.New("passwords do not match")
+	}
+
+	return password, nil
+}
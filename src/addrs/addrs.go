@@ -34,7 +34,7 @@ type AddrGenerator interface {
 type Addrs struct {
 	sync.RWMutex
 	log       logrus.FieldLogger
-	used      *Store   // all used addresses
+	used      Storer   // all used addresses
 	addresses []string // address pool for deposit
 }
 
@@ -98,7 +98,12 @@ func NewAddrs(log logrus.FieldLogger, db *bolt.DB, addresses []string, bucketKey
 		return nil, err
 	}
 
-	addresses, err = removeUsedAddresses(used, addresses)
+	return NewAddrsWithStore(log, used, addresses)
+}
+
+// NewAddrsWithStore creates Addrs instance, recording the used addresses in used
+func NewAddrsWithStore(log logrus.FieldLogger, used Storer, addresses []string) (*Addrs, error) {
+	addresses, err := removeUsedAddresses(used, addresses)
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +115,7 @@ func NewAddrs(log logrus.FieldLogger, db *bolt.DB, addresses []string, bucketKey
 	}, nil
 }
 
-func removeUsedAddresses(s *Store, addrs []string) ([]string, error) {
+func removeUsedAddresses(s Storer, addrs []string) ([]string, error) {
 	var newAddrs []string
 
 	for _, addr := range addrs {
@@ -160,6 +165,37 @@ func (a *Addrs) NewAddress() (string, error) {
 	return chosenAddr, nil
 }
 
+// SetAddresses replaces the address pool, e.g. after the addresses file was reloaded.
+// Addresses that were already used are removed.
+func (a *Addrs) SetAddresses(addresses []string) error {
+	addresses, err := a.UnusedAddresses(addresses)
+	if err != nil {
+		return err
+	}
+
+	a.ReplaceAddresses(addresses)
+	return nil
+}
+
+// UnusedAddresses returns the addresses that were not used yet
+func (a *Addrs) UnusedAddresses(addresses []string) ([]string, error) {
+	return removeUsedAddresses(a.used, addresses)
+}
+
+// ReplaceAddresses replaces the address pool with addresses returned by UnusedAddresses.
+// An address used since then is skipped by NewAddress.
+func (a *Addrs) ReplaceAddresses(addresses []string) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.log.WithFields(logrus.Fields{
+		"previous":  len(a.addresses),
+		"remaining": len(addresses),
+	}).Info("Replaced the deposit address pool")
+
+	a.addresses = addresses
+}
+
 // Remaining returns the rest btc address number
 func (a *Addrs) Remaining() uint64 {
 	a.RLock()
@@ -117,6 +117,39 @@ func TestNewAddress(t *testing.T) {
 	require.Equal(t, ErrDepositAddressEmpty, err)
 }
 
+func TestSetAddresses(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	btca, addresses := testNewBtcAddrManager(t, db, log)
+
+	addr, err := btca.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, addresses[0], addr)
+
+	// The used address is removed from the new pool
+	newAddr := "1LEkderht5M5yWj82M87bEd4XDBsczLkp9"
+	err = btca.SetAddresses(append(addresses, newAddr))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), btca.Remaining())
+	require.Equal(t, append(addresses[1:], newAddr), btca.addresses)
+
+	err = btca.SetAddresses(nil)
+	require.NoError(t, err)
+	_, err = btca.NewAddress()
+	require.Equal(t, ErrDepositAddressEmpty, err)
+
+	// UnusedAddresses only filters, the pool is replaced by ReplaceAddresses
+	unused, err := btca.UnusedAddresses(addresses)
+	require.NoError(t, err)
+	require.Equal(t, addresses[1:], unused)
+	require.Equal(t, uint64(0), btca.Remaining())
+
+	btca.ReplaceAddresses(unused)
+	require.Equal(t, uint64(len(addresses)-1), btca.Remaining())
+}
+
 func TestNewEthAddrs(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
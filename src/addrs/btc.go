@@ -19,6 +19,16 @@ const btcBucketKey = "used_btc_address"
 
 // NewBTCAddrs returns an Addrs loaded with BTC addresses
 func NewBTCAddrs(log logrus.FieldLogger, db *bolt.DB, addrsFile string) (*Addrs, error) {
+	addrs, err := LoadBTCAddresses(addrsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAddrs(log, db, addrs, btcBucketKey)
+}
+
+// LoadBTCAddresses loads and verifies the BTC addresses of a file
+func LoadBTCAddresses(addrsFile string) ([]string, error) {
 	f, err := ioutil.ReadFile(addrsFile)
 	if err != nil {
 		return nil, fmt.Errorf("Load deposit bitcoin address list failed: %v", err)
@@ -43,7 +53,7 @@ func NewBTCAddrs(log logrus.FieldLogger, db *bolt.DB, addrsFile string) (*Addrs,
 		return nil, err
 	}
 
-	return NewAddrs(log, db, addrs, btcBucketKey)
+	return addrs, nil
 }
 
 func loadBTCAddressesJSON(addrsReader io.Reader) ([]string, error) {
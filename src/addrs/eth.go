@@ -18,6 +18,16 @@ const ethBucketKey = "used_eth_address"
 
 // NewETHAddrs returns an Addrs loaded with ETH addresses
 func NewETHAddrs(log logrus.FieldLogger, db *bolt.DB, addrsFile string) (*Addrs, error) {
+	addrs, err := LoadETHAddresses(addrsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAddrs(log, db, addrs, ethBucketKey)
+}
+
+// LoadETHAddresses loads and verifies the ETH addresses of a file
+func LoadETHAddresses(addrsFile string) ([]string, error) {
 	f, err := ioutil.ReadFile(addrsFile)
 	if err != nil {
 		return nil, fmt.Errorf("Load deposit bitcoin address list failed: %v", err)
@@ -42,7 +52,7 @@ func NewETHAddrs(log logrus.FieldLogger, db *bolt.DB, addrsFile string) (*Addrs,
 		return nil, err
 	}
 
-	return NewAddrs(log, db, addrs, ethBucketKey)
+	return addrs, nil
 }
 
 func loadETHAddressesJSON(addrsReader io.Reader) ([]string, error) {
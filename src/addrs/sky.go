@@ -19,6 +19,16 @@ const skyBucketKey = "used_sky_address"
 
 // NewSKYAddrs returns an Addrs loaded with SKY addresses
 func NewSKYAddrs(log logrus.FieldLogger, db *bolt.DB, addrsFile string) (*Addrs, error) {
+	addrs, err := LoadSKYAddresses(addrsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAddrs(log, db, addrs, skyBucketKey)
+}
+
+// LoadSKYAddresses loads and verifies the SKY addresses of a file
+func LoadSKYAddresses(addrsFile string) ([]string, error) {
 	f, err := ioutil.ReadFile(addrsFile)
 	if err != nil {
 		return nil, fmt.Errorf("Load deposit bitcoin address list failed: %v", err)
@@ -43,7 +53,7 @@ func NewSKYAddrs(log logrus.FieldLogger, db *bolt.DB, addrsFile string) (*Addrs,
 		return nil, err
 	}
 
-	return NewAddrs(log, db, addrs, skyBucketKey)
+	return addrs, nil
 }
 
 func loadSKYAddressesJSON(addrsReader io.Reader) ([]string, error) {
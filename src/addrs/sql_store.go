@@ -0,0 +1,142 @@
+package addrs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/sqlutil"
+)
+
+// sqlSchema creates the used addresses table, which replaces the used address buckets of all coin types
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS used_addresses (
+		coin_type TEXT NOT NULL,
+		address TEXT NOT NULL,
+		PRIMARY KEY (coin_type, address)
+	)`,
+}
+
+const usedAddressesTable = "used_addresses"
+
+// usedAddressBkts maps a coin type to the bucket of its used addresses
+var usedAddressBkts = map[string]string{
+	config.CoinTypeBTC: btcBucketKey,
+	config.CoinTypeETH: ethBucketKey,
+	config.CoinTypeSKY: skyBucketKey,
+}
+
+func init() {
+	// Check that usedAddressBkts handles all possible coin types
+	for _, ct := range config.CoinTypes {
+		if usedAddressBkts[ct] == "" {
+			panic(fmt.Sprintf("usedAddressBkts has no bucket for %s", ct))
+		}
+	}
+}
+
+// SQLStore saves the used addresses of a coin type in a SQL database
+type SQLStore struct {
+	db       *sqlutil.DB
+	coinType string
+}
+
+// NewSQLStore creates a SQLStore for a coin type
+func NewSQLStore(db *sqlutil.DB, coinType string) (*SQLStore, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+
+	if _, ok := usedAddressBkts[coinType]; !ok {
+		return nil, config.ErrUnsupportedCoinType
+	}
+
+	if err := db.CreateTables(sqlSchema); err != nil {
+		return nil, err
+	}
+
+	return &SQLStore{
+		db:       db,
+		coinType: coinType,
+	}, nil
+}
+
+// Put marks an address as used
+func (s *SQLStore) Put(addr string) error {
+	return s.db.Update(func(tx *sqlutil.Tx) error {
+		return putUsedAddressSQLTx(tx, s.coinType, addr)
+	})
+}
+
+func putUsedAddressSQLTx(tx *sqlutil.Tx, coinType, addr string) error {
+	_, err := tx.Exec(`INSERT INTO used_addresses (coin_type, address) VALUES (?, ?)
+		ON CONFLICT (coin_type, address) DO NOTHING`, coinType, addr)
+	return err
+}
+
+// IsUsed checks if address is mark as used
+func (s *SQLStore) IsUsed(addr string) (bool, error) {
+	var n int
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		return tx.QueryRow("SELECT COUNT(*) FROM used_addresses WHERE coin_type = ? AND address = ?",
+			s.coinType, addr).Scan(&n)
+	}); err != nil {
+		return false, err
+	}
+
+	return n != 0, nil
+}
+
+// ImportBolt copies the used addresses of all coin types from a bolt database
+func ImportBolt(sqlDB *sqlutil.DB, db *bolt.DB) error {
+	if err := sqlDB.CreateTables(sqlSchema); err != nil {
+		return err
+	}
+
+	return db.View(func(boltTx *bolt.Tx) error {
+		return sqlDB.Update(func(tx *sqlutil.Tx) error {
+			for _, ct := range config.CoinTypes {
+				if err := dbutil.ForEachIfExists(boltTx, []byte(usedAddressBkts[ct]), func(k, v []byte) error {
+					return putUsedAddressSQLTx(tx, ct, string(k))
+				}); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+}
+
+// RowCounts returns the number of rows of the used addresses table
+func RowCounts(sqlDB *sqlutil.DB) (sqlutil.RowCounts, error) {
+	counts := make(sqlutil.RowCounts)
+	if err := sqlDB.View(func(tx *sqlutil.Tx) error {
+		n, err := sqlutil.CountRows(tx, usedAddressesTable)
+		counts[usedAddressesTable] = n
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// BoltRowCounts returns the number of rows that ImportBolt copies from a bolt database to the used addresses table
+func BoltRowCounts(db *bolt.DB) (sqlutil.RowCounts, error) {
+	counts := make(sqlutil.RowCounts)
+	if err := db.View(func(tx *bolt.Tx) error {
+		counts[usedAddressesTable] = 0
+		for _, ct := range config.CoinTypes {
+			counts[usedAddressesTable] += dbutil.BucketKeyCount(tx, []byte(usedAddressBkts[ct]))
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
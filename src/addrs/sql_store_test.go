@@ -0,0 +1,73 @@
+package addrs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestSQLStore(t *testing.T) {
+	db, shutdown := testutil.PrepareSQLDB(t)
+	defer shutdown()
+
+	_, err := NewSQLStore(db, "foo")
+	require.Equal(t, config.ErrUnsupportedCoinType, err)
+
+	btc, err := NewSQLStore(db, config.CoinTypeBTC)
+	require.NoError(t, err)
+	sky, err := NewSQLStore(db, config.CoinTypeSKY)
+	require.NoError(t, err)
+
+	require.NoError(t, btc.Put("a1"))
+	// Putting an address twice is allowed, as it is in bolt
+	require.NoError(t, btc.Put("a1"))
+
+	used, err := btc.IsUsed("a1")
+	require.NoError(t, err)
+	require.True(t, used)
+
+	// The used addresses of each coin type are separate
+	used, err = sky.IsUsed("a1")
+	require.NoError(t, err)
+	require.False(t, used)
+}
+
+func TestSQLStoreImportBolt(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	btc, err := NewStore(db, btcBucketKey)
+	require.NoError(t, err)
+	require.NoError(t, btc.Put("a1"))
+	require.NoError(t, btc.Put("a2"))
+
+	eth, err := NewStore(db, ethBucketKey)
+	require.NoError(t, err)
+	require.NoError(t, eth.Put("e1"))
+
+	sqlDB, sqlShutdown := testutil.PrepareSQLDB(t)
+	defer sqlShutdown()
+
+	require.NoError(t, ImportBolt(sqlDB, db))
+
+	s, err := NewSQLStore(sqlDB, config.CoinTypeETH)
+	require.NoError(t, err)
+
+	used, err := s.IsUsed("e1")
+	require.NoError(t, err)
+	require.True(t, used)
+
+	used, err = s.IsUsed("a1")
+	require.NoError(t, err)
+	require.False(t, used)
+
+	boltCounts, err := BoltRowCounts(db)
+	require.NoError(t, err)
+	sqlCounts, err := RowCounts(sqlDB)
+	require.NoError(t, err)
+	require.Empty(t, boltCounts.Diff(sqlCounts))
+	require.Equal(t, 3, sqlCounts[usedAddressesTable])
+}
@@ -8,6 +8,12 @@ import (
 	"github.com/skycoin/teller/src/util/dbutil"
 )
 
+// Storer records the used addresses
+type Storer interface {
+	Put(addr string) error
+	IsUsed(addr string) (bool, error)
+}
+
 // Store saves used addresses in a bucket
 type Store struct {
 	db        *bolt.DB
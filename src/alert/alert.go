@@ -0,0 +1,543 @@
+// Package alert notifies operators of WatchNotice logs and degraded health, by email, webhook or a local command
+package alert
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/api/cli"
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/sender"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const (
+	// CheckWatchNotice alerts of a log with a WatchNotice field
+	CheckWatchNotice = "watch_notice"
+	// CheckScannerLag alerts of a scanner falling behind its node's best block
+	CheckScannerLag = "scanner_lag"
+	// CheckScannerStale alerts of a scanner that has not reached its node
+	CheckScannerStale = "scanner_stale"
+	// CheckHotWalletBalance alerts of a low hot wallet balance
+	CheckHotWalletBalance = "hot_wallet_balance"
+	// CheckAddressPool alerts of a nearly empty deposit address pool
+	CheckAddressPool = "address_pool"
+	// CheckProcessorError alerts of a deposit processor error
+	CheckProcessorError = "processor_error"
+	// CheckSenderError alerts of a sender error
+	CheckSenderError = "sender_error"
+	// CheckStuckDeposits alerts of deposits that have not changed status for too long
+	CheckStuckDeposits = "stuck_deposits"
+
+	// Number of WatchNotice logs waiting to be alerted. Further logs are dropped until they are handled.
+	noticeBufferSize = 100
+	// Most deposit IDs listed in a CheckStuckDeposits alert
+	maxStuckDepositIDs = 10
+)
+
+// processingStatuses are the statuses of deposits that teller is still processing.
+// A deposit stuck in one of them needs the operator's attention.
+var processingStatuses = map[string]struct{}{
+	exchange.StatusWaitDecide:                   {},
+	exchange.StatusWaitSend:                     {},
+	exchange.StatusWaitConfirm:                  {},
+	exchange.StatusWaitPassthrough:              {},
+	exchange.StatusWaitPassthroughOrderComplete: {},
+}
+
+// Alert is a notification sent to the operators
+type Alert struct {
+	// Identifies the condition alerted of. Alerts with the same key are deduplicated.
+	Key       string            `json:"key"`
+	Check     string            `json:"check"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Timestamp int64             `json:"timestamp"`
+	// The condition of an earlier alert with the same key has cleared
+	Resolved bool `json:"resolved"`
+}
+
+// Exchanger provides the exchange's health
+type Exchanger interface {
+	ProcessorStatus() error
+	SenderStatus() error
+	Balance() (*cli.Balance, error)
+	QueryDeposits(q exchange.DepositQuery) ([]exchange.DepositInfo, error)
+}
+
+// AddrManager provides the number of deposit addresses left
+type AddrManager interface {
+	Remaining(coinType string) (uint64, error)
+}
+
+// ScanStatuser provides a scanner's progress
+type ScanStatuser interface {
+	ScanStatus() scanner.ScanStatus
+}
+
+// Alerter sends alerts for the logs with a WatchNotice field, captured by its Hook,
+// and for the health checks it runs every cfg.CheckWait.
+// A health check's alert is repeated every cfg.RepeatWait while its condition lasts,
+// and is followed by a resolved alert once it clears. A WatchNotice log is not alerted
+// again if a log with the same message was alerted less than cfg.RepeatWait ago.
+// At most cfg.MaxPerHour alerts are sent in an hour, not counting the resolved alerts.
+type Alerter struct {
+	log         logrus.FieldLogger
+	cfg         config.Alerts
+	exchanger   Exchanger
+	addrManager AddrManager
+	// Scanners of the enabled coin types, whose address pools are checked too
+	scanners   map[string]ScanStatuser
+	notifiers  []Notifier
+	minBalance uint64
+	notices    chan Alert
+	// Conditions found by the last health checks, by key
+	active map[string]Alert
+	// When an alert was last sent, by key
+	lastSent map[string]time.Time
+	// WatchNotice logs not alerted since the last alert with the same key
+	suppressed map[string]int
+	// When the alerts of the last hour were sent
+	sent      []time.Time
+	startedAt time.Time
+	quit      chan struct{}
+	done      chan struct{}
+}
+
+// New creates an Alerter
+func New(log logrus.FieldLogger, cfg config.Alerts, exchanger Exchanger, addrManager AddrManager, scanners map[string]ScanStatuser) (*Alerter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var minBalance uint64
+	if cfg.MinHotWalletBalance != "" {
+		var err error
+		minBalance, err = droplet.FromString(cfg.MinHotWalletBalance)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Alerter{
+		log:         log.WithField("prefix", "teller.alert"),
+		cfg:         cfg,
+		exchanger:   exchanger,
+		addrManager: addrManager,
+		scanners:    scanners,
+		notifiers:   NewNotifiers(cfg),
+		minBalance:  minBalance,
+		notices:     make(chan Alert, noticeBufferSize),
+		active:      make(map[string]Alert),
+		lastSent:    make(map[string]time.Time),
+		suppressed:  make(map[string]int),
+		startedAt:   time.Now().UTC(),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}, 1),
+	}, nil
+}
+
+// Hook returns a logrus.Hook that captures the logs with a WatchNotice field for alerting.
+// It only queues the logs, so it never blocks logging.
+func (a *Alerter) Hook() logrus.Hook {
+	return noticeHook{
+		notices: a.notices,
+	}
+}
+
+// noticeHook is a logrus.Hook that queues the logs with a WatchNotice field as alerts
+type noticeHook struct {
+	notices chan<- Alert
+}
+
+// Levels returns logrus.AllLevels
+func (h noticeHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire queues the logrus.Entry as an alert if it has a WatchNotice field.
+// The entry is dropped if the queue is full.
+func (h noticeHook) Fire(entry *logrus.Entry) error {
+	if notice, ok := entry.Data["notice"].(string); !ok || notice != logger.WatchNotice {
+		return nil
+	}
+
+	fields := make(map[string]string, len(entry.Data))
+	for k, v := range entry.Data {
+		if k == "notice" {
+			continue
+		}
+		fields[k] = fmt.Sprint(v)
+	}
+	fields["level"] = entry.Level.String()
+
+	select {
+	case h.notices <- Alert{
+		Key:       CheckWatchNotice + ":" + entry.Message,
+		Check:     CheckWatchNotice,
+		Message:   entry.Message,
+		Fields:    fields,
+		Timestamp: entry.Time.UTC().Unix(),
+	}:
+	default:
+	}
+
+	return nil
+}
+
+// Run sends the alerts until Shutdown is called
+func (a *Alerter) Run() error {
+	log := a.log
+	log.Info("Start alert service...")
+	defer func() {
+		log.Info("Closed alert service")
+		a.done <- struct{}{}
+	}()
+
+	if len(a.notifiers) == 0 {
+		log.Info("No alert notifiers configured")
+		<-a.quit
+		return nil
+	}
+
+	ticker := time.NewTicker(a.cfg.CheckWait)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.quit:
+			return nil
+		case n := <-a.notices:
+			a.handleNotice(n, time.Now().UTC())
+		case <-ticker.C:
+			now := time.Now().UTC()
+			a.handleChecks(a.runChecks(now), now)
+		}
+	}
+}
+
+// Shutdown stops a previous call to Run
+func (a *Alerter) Shutdown() {
+	a.log.Info("Shutting down Alerter")
+	close(a.quit)
+	a.log.Info("Waiting for run to finish")
+	<-a.done
+	a.log.Info("Shutdown complete")
+}
+
+// handleNotice sends the alert of a WatchNotice log, unless one with the same key was sent less than cfg.RepeatWait ago
+func (a *Alerter) handleNotice(n Alert, now time.Time) {
+	if last, ok := a.lastSent[n.Key]; ok && now.Sub(last) < a.cfg.RepeatWait {
+		a.suppressed[n.Key]++
+		return
+	}
+
+	if count := a.suppressed[n.Key]; count > 0 {
+		n.Fields["suppressed"] = strconv.Itoa(count)
+	}
+
+	if a.send(n, now) {
+		a.lastSent[n.Key] = now
+		delete(a.suppressed, n.Key)
+	}
+}
+
+// handleChecks sends the alerts of the conditions found by the health checks, and the resolved alerts
+// of the conditions that cleared
+func (a *Alerter) handleChecks(found []Alert, now time.Time) {
+	foundKeys := make(map[string]struct{}, len(found))
+	for _, f := range found {
+		foundKeys[f.Key] = struct{}{}
+		a.active[f.Key] = f
+
+		if last, ok := a.lastSent[f.Key]; ok && now.Sub(last) < a.cfg.RepeatWait {
+			continue
+		}
+
+		if a.send(f, now) {
+			a.lastSent[f.Key] = now
+		}
+	}
+
+	for key, f := range a.active {
+		if _, ok := foundKeys[key]; ok {
+			continue
+		}
+
+		delete(a.active, key)
+
+		// Nothing to resolve if the alert was never sent
+		if _, ok := a.lastSent[key]; !ok {
+			continue
+		}
+		delete(a.lastSent, key)
+
+		f.Resolved = true
+		f.Timestamp = now.Unix()
+		a.send(f, now)
+	}
+
+	// Forget the WatchNotice logs alerted long ago
+	for key, last := range a.lastSent {
+		if _, ok := a.active[key]; !ok && now.Sub(last) >= a.cfg.RepeatWait {
+			delete(a.lastSent, key)
+		}
+	}
+}
+
+// send sends an alert with every notifier, unless cfg.MaxPerHour alerts were sent in the last hour.
+// Resolved alerts are always sent, since they follow an alert that was sent.
+// Returns true if any notifier sent it.
+func (a *Alerter) send(al Alert, now time.Time) bool {
+	log := a.log.WithFields(logrus.Fields{
+		"key":      al.Key,
+		"resolved": al.Resolved,
+	})
+
+	sent := a.sent[:0]
+	for _, t := range a.sent {
+		if now.Sub(t) < time.Hour {
+			sent = append(sent, t)
+		}
+	}
+	a.sent = sent
+
+	if !al.Resolved && len(a.sent) >= a.cfg.MaxPerHour {
+		log.Warn("Alert rate limit reached, alert dropped")
+		return false
+	}
+
+	ok := false
+	for _, n := range a.notifiers {
+		if err := n.Notify(al); err != nil {
+			// Not logged with a WatchNotice, which would alert again
+			log.WithError(err).WithField("notifier", n.Name()).Error("Sending alert failed")
+			continue
+		}
+		ok = true
+	}
+
+	if ok {
+		a.sent = append(a.sent, now)
+		log.Info("Sent alert")
+	}
+
+	return ok
+}
+
+// runChecks runs the health checks, returning an alert for each condition found
+func (a *Alerter) runChecks(now time.Time) []Alert {
+	var found []Alert
+	found = append(found, a.checkScanners(now)...)
+	found = append(found, a.checkHotWallet(now)...)
+	found = append(found, a.checkAddresses(now)...)
+	found = append(found, a.checkExchange(now)...)
+	found = append(found, a.checkStuckDeposits(now)...)
+	return found
+}
+
+func (a *Alerter) coinTypes() []string {
+	coinTypes := make([]string, 0, len(a.scanners))
+	for ct := range a.scanners {
+		coinTypes = append(coinTypes, ct)
+	}
+	sort.Strings(coinTypes)
+	return coinTypes
+}
+
+func (a *Alerter) checkScanners(now time.Time) []Alert {
+	var found []Alert
+
+	for _, ct := range a.coinTypes() {
+		st := a.scanners[ct].ScanStatus()
+
+		if a.cfg.ScannerStaleWait > 0 {
+			checkedAt := a.startedAt
+			if st.CheckedAt != 0 {
+				checkedAt = time.Unix(st.CheckedAt, 0)
+			}
+
+			if now.Sub(checkedAt) > a.cfg.ScannerStaleWait {
+				found = append(found, Alert{
+					Key:     CheckScannerStale + ":" + ct,
+					Check:   CheckScannerStale,
+					Message: fmt.Sprintf("%s scanner has not reached its node for over %s", ct, a.cfg.ScannerStaleWait),
+					Fields: map[string]string{
+						"coinType":  ct,
+						"checkedAt": strconv.FormatInt(st.CheckedAt, 10),
+					},
+					Timestamp: now.Unix(),
+				})
+			}
+		}
+
+		if a.cfg.MaxScannerLag > 0 && st.ScannedAt != 0 && st.BestHeight-st.Height > a.cfg.MaxScannerLag {
+			found = append(found, Alert{
+				Key:     CheckScannerLag + ":" + ct,
+				Check:   CheckScannerLag,
+				Message: fmt.Sprintf("%s scanner is %d blocks behind its node", ct, st.BestHeight-st.Height),
+				Fields: map[string]string{
+					"coinType":   ct,
+					"height":     strconv.FormatInt(st.Height, 10),
+					"bestHeight": strconv.FormatInt(st.BestHeight, 10),
+				},
+				Timestamp: now.Unix(),
+			})
+		}
+	}
+
+	return found
+}
+
+func (a *Alerter) checkHotWallet(now time.Time) []Alert {
+	if a.cfg.MinHotWalletBalance == "" {
+		return nil
+	}
+
+	bal, err := a.exchanger.Balance()
+	if err != nil {
+		// An unreachable wallet is reported by the sender check
+		a.log.WithError(err).Error("exchanger.Balance failed")
+		return nil
+	}
+
+	coins, err := droplet.FromString(bal.Coins)
+	if err != nil {
+		a.log.WithError(err).WithField("coins", bal.Coins).Error("droplet.FromString failed")
+		return nil
+	}
+
+	if coins >= a.minBalance {
+		return nil
+	}
+
+	return []Alert{{
+		Key:     CheckHotWalletBalance,
+		Check:   CheckHotWalletBalance,
+		Message: fmt.Sprintf("Hot wallet balance %s is below %s", bal.Coins, a.cfg.MinHotWalletBalance),
+		Fields: map[string]string{
+			"balance":    bal.Coins,
+			"minBalance": a.cfg.MinHotWalletBalance,
+		},
+		Timestamp: now.Unix(),
+	}}
+}
+
+func (a *Alerter) checkAddresses(now time.Time) []Alert {
+	if a.cfg.MinAddresses == 0 {
+		return nil
+	}
+
+	var found []Alert
+	for _, ct := range a.coinTypes() {
+		remaining, err := a.addrManager.Remaining(ct)
+		if err != nil {
+			a.log.WithError(err).WithField("coinType", ct).Error("addrManager.Remaining failed")
+			continue
+		}
+
+		if remaining >= a.cfg.MinAddresses {
+			continue
+		}
+
+		found = append(found, Alert{
+			Key:     CheckAddressPool + ":" + ct,
+			Check:   CheckAddressPool,
+			Message: fmt.Sprintf("Only %d %s deposit addresses left", remaining, ct),
+			Fields: map[string]string{
+				"coinType":  ct,
+				"remaining": strconv.FormatUint(remaining, 10),
+			},
+			Timestamp: now.Unix(),
+		})
+	}
+
+	return found
+}
+
+func (a *Alerter) checkExchange(now time.Time) []Alert {
+	var found []Alert
+
+	if err := a.exchanger.ProcessorStatus(); err != nil {
+		found = append(found, Alert{
+			Key:     CheckProcessorError,
+			Check:   CheckProcessorError,
+			Message: "Deposit processor failed",
+			Fields: map[string]string{
+				"error": err.Error(),
+			},
+			Timestamp: now.Unix(),
+		})
+	}
+
+	// Other sender errors are transient and common, see the teller health API
+	err := a.exchanger.SenderStatus()
+	switch err.(type) {
+	case sender.RPCError:
+		found = append(found, Alert{
+			Key:     CheckSenderError,
+			Check:   CheckSenderError,
+			Message: "Sender failed, the hot wallet may have an insufficient balance",
+			Fields: map[string]string{
+				"error": err.Error(),
+			},
+			Timestamp: now.Unix(),
+		})
+	default:
+	}
+
+	return found
+}
+
+func (a *Alerter) checkStuckDeposits(now time.Time) []Alert {
+	if a.cfg.StuckDepositWait == 0 {
+		return nil
+	}
+
+	before := now.Add(-a.cfg.StuckDepositWait).Unix()
+	statuses := make([]string, 0, len(processingStatuses))
+	for s := range processingStatuses {
+		statuses = append(statuses, s)
+	}
+
+	deposits, err := a.exchanger.QueryDeposits(exchange.DepositQuery{
+		Statuses:  statuses,
+		UpdatedTo: before - 1,
+	})
+	if err != nil {
+		a.log.WithError(err).Error("exchanger.QueryDeposits failed")
+		return nil
+	}
+
+	if len(deposits) == 0 {
+		return nil
+	}
+
+	sort.Slice(deposits, func(i, j int) bool {
+		return deposits[i].UpdatedAt < deposits[j].UpdatedAt
+	})
+
+	var ids []string
+	for i := 0; i < len(deposits) && i < maxStuckDepositIDs; i++ {
+		ids = append(ids, deposits[i].DepositID)
+	}
+
+	return []Alert{{
+		Key:     CheckStuckDeposits,
+		Check:   CheckStuckDeposits,
+		Message: fmt.Sprintf("%d deposits have not changed status for over %s", len(deposits), a.cfg.StuckDepositWait),
+		Fields: map[string]string{
+			"count":      strconv.Itoa(len(deposits)),
+			"depositIDs": strings.Join(ids, ","),
+		},
+		Timestamp: now.Unix(),
+	}}
+}
@@ -0,0 +1,340 @@
+package alert
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/api/cli"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/sender"
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+// recordNotifier records the alerts sent, and fails while fail is set
+type recordNotifier struct {
+	alerts []Alert
+	fail   bool
+}
+
+func (n *recordNotifier) Name() string {
+	return "record"
+}
+
+func (n *recordNotifier) Notify(a Alert) error {
+	if n.fail {
+		return errors.New("notify failed")
+	}
+	n.alerts = append(n.alerts, a)
+	return nil
+}
+
+func (n *recordNotifier) keys() []string {
+	var keys []string
+	for _, a := range n.alerts {
+		key := a.Key
+		if a.Resolved {
+			key = "resolved:" + key
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+type dummyExchanger struct {
+	processorErr error
+	senderErr    error
+	coins        string
+	deposits     []exchange.DepositInfo
+}
+
+func (e *dummyExchanger) ProcessorStatus() error {
+	return e.processorErr
+}
+
+func (e *dummyExchanger) SenderStatus() error {
+	return e.senderErr
+}
+
+func (e *dummyExchanger) Balance() (*cli.Balance, error) {
+	return &cli.Balance{
+		Coins: e.coins,
+		Hours: "0",
+	}, nil
+}
+
+func (e *dummyExchanger) QueryDeposits(q exchange.DepositQuery) ([]exchange.DepositInfo, error) {
+	var dis []exchange.DepositInfo
+	for _, di := range e.deposits {
+		if q.Matches(di) {
+			dis = append(dis, di)
+		}
+	}
+	return dis, nil
+}
+
+type dummyAddrManager map[string]uint64
+
+func (m dummyAddrManager) Remaining(coinType string) (uint64, error) {
+	return m[coinType], nil
+}
+
+type dummyScanner struct {
+	status scanner.ScanStatus
+}
+
+func (s *dummyScanner) ScanStatus() scanner.ScanStatus {
+	return s.status
+}
+
+func testCfg() config.Alerts {
+	return config.Alerts{
+		CheckWait:  time.Minute,
+		RepeatWait: time.Hour,
+		MaxPerHour: 10,
+	}
+}
+
+func newTestAlerter(t *testing.T, cfg config.Alerts, ex Exchanger, am AddrManager, scanners map[string]ScanStatuser) (*Alerter, *recordNotifier) {
+	log, _ := testutil.NewLogger(t)
+
+	a, err := New(log, cfg, ex, am, scanners)
+	require.NoError(t, err)
+
+	rec := &recordNotifier{}
+	a.notifiers = []Notifier{rec}
+
+	return a, rec
+}
+
+func TestHook(t *testing.T) {
+	a, _ := newTestAlerter(t, testCfg(), &dummyExchanger{}, dummyAddrManager{}, nil)
+
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	log.Hooks.Add(a.Hook())
+
+	log.WithField("txid", "foo-txid").Error("Not a notice")
+	log.WithField("notice", logger.WatchNotice).WithField("txid", "foo-txid").Error("Sending failed")
+
+	require.Len(t, a.notices, 1)
+	n := <-a.notices
+	require.Equal(t, CheckWatchNotice+":Sending failed", n.Key)
+	require.Equal(t, CheckWatchNotice, n.Check)
+	require.Equal(t, "Sending failed", n.Message)
+	require.Equal(t, map[string]string{
+		"txid":  "foo-txid",
+		"level": "error",
+	}, n.Fields)
+	require.NotZero(t, n.Timestamp)
+
+	// Logs are dropped while the queue is full, without blocking
+	for i := 0; i < noticeBufferSize+10; i++ {
+		log.WithField("notice", logger.WatchNotice).Error("Sending failed")
+	}
+	require.Len(t, a.notices, noticeBufferSize)
+}
+
+func TestHandleNotice(t *testing.T) {
+	a, rec := newTestAlerter(t, testCfg(), &dummyExchanger{}, dummyAddrManager{}, nil)
+
+	notice := func(msg string) Alert {
+		return Alert{
+			Key:     CheckWatchNotice + ":" + msg,
+			Check:   CheckWatchNotice,
+			Message: msg,
+			Fields:  map[string]string{},
+		}
+	}
+
+	now := time.Now().UTC()
+	a.handleNotice(notice("foo"), now)
+	a.handleNotice(notice("foo"), now.Add(time.Minute))
+	a.handleNotice(notice("bar"), now.Add(time.Minute))
+	a.handleNotice(notice("foo"), now.Add(time.Minute*2))
+	require.Equal(t, []string{"watch_notice:foo", "watch_notice:bar"}, rec.keys())
+
+	// Repeated after RepeatWait, with the number of logs suppressed meanwhile
+	a.handleNotice(notice("foo"), now.Add(time.Hour))
+	require.Equal(t, []string{"watch_notice:foo", "watch_notice:bar", "watch_notice:foo"}, rec.keys())
+	require.Equal(t, "2", rec.alerts[2].Fields["suppressed"])
+
+	// Retried if sending failed
+	rec.fail = true
+	a.handleNotice(notice("baz"), now.Add(time.Hour))
+	rec.fail = false
+	a.handleNotice(notice("baz"), now.Add(time.Hour))
+	require.Equal(t, []string{"watch_notice:foo", "watch_notice:bar", "watch_notice:foo", "watch_notice:baz"}, rec.keys())
+}
+
+func TestHandleChecks(t *testing.T) {
+	cfg := testCfg()
+	cfg.MaxPerHour = 3
+	a, rec := newTestAlerter(t, cfg, &dummyExchanger{}, dummyAddrManager{}, nil)
+
+	alert := func(key string) Alert {
+		return Alert{
+			Key:   key,
+			Check: key,
+		}
+	}
+
+	now := time.Now().UTC()
+	a.handleChecks([]Alert{alert("foo"), alert("bar")}, now)
+	require.Equal(t, []string{"foo", "bar"}, rec.keys())
+
+	// Not repeated while active, until RepeatWait elapsed
+	a.handleChecks([]Alert{alert("foo"), alert("bar")}, now.Add(time.Minute))
+	require.Equal(t, []string{"foo", "bar"}, rec.keys())
+
+	// Resolved once cleared
+	a.handleChecks([]Alert{alert("foo")}, now.Add(time.Minute*2))
+	require.Equal(t, []string{"foo", "bar", "resolved:bar"}, rec.keys())
+	require.True(t, rec.alerts[2].Resolved)
+
+	// Dropped over MaxPerHour, and sent once the hour elapsed
+	a.handleChecks([]Alert{alert("foo"), alert("baz")}, now.Add(time.Minute*3))
+	require.Equal(t, []string{"foo", "bar", "resolved:bar"}, rec.keys())
+
+	a.handleChecks([]Alert{alert("foo"), alert("baz")}, now.Add(time.Hour+time.Minute))
+	require.Equal(t, []string{"foo", "bar", "resolved:bar", "foo", "baz"}, rec.keys())
+
+	// Resolved alerts are not dropped over MaxPerHour.
+	// A condition that cleared before its alert was sent is not resolved.
+	a.handleChecks([]Alert{alert("foo"), alert("baz"), alert("qux"), alert("quux")}, now.Add(time.Hour+time.Minute*2))
+	require.Equal(t, []string{"foo", "bar", "resolved:bar", "foo", "baz", "qux"}, rec.keys())
+
+	a.handleChecks(nil, now.Add(time.Hour+time.Minute*3))
+	require.Len(t, rec.alerts, 9)
+	require.ElementsMatch(t, []string{"resolved:foo", "resolved:baz", "resolved:qux"}, rec.keys()[6:])
+	require.Empty(t, a.active)
+}
+
+func TestRunChecks(t *testing.T) {
+	cfg := testCfg()
+	cfg.MaxScannerLag = 10
+	cfg.ScannerStaleWait = time.Minute * 10
+	cfg.MinHotWalletBalance = "100"
+	cfg.MinAddresses = 5
+	cfg.StuckDepositWait = time.Hour
+
+	now := time.Now().UTC()
+
+	ex := &dummyExchanger{
+		coins: "1000.000000",
+	}
+	am := dummyAddrManager{
+		config.CoinTypeBTC: 100,
+		config.CoinTypeSKY: 100,
+	}
+	btcScanner := &dummyScanner{
+		status: scanner.ScanStatus{
+			CoinType:   config.CoinTypeBTC,
+			Height:     100,
+			BestHeight: 101,
+			CheckedAt:  now.Unix(),
+			ScannedAt:  now.Unix(),
+		},
+	}
+	skyScanner := &dummyScanner{
+		status: scanner.ScanStatus{
+			CoinType: config.CoinTypeSKY,
+		},
+	}
+
+	a, _ := newTestAlerter(t, cfg, ex, am, map[string]ScanStatuser{
+		config.CoinTypeBTC: btcScanner,
+		config.CoinTypeSKY: skyScanner,
+	})
+
+	require.Empty(t, a.runChecks(now))
+
+	keys := func(alerts []Alert) []string {
+		var keys []string
+		for _, a := range alerts {
+			keys = append(keys, a.Key)
+		}
+		return keys
+	}
+
+	// A scanner that never reached its node is stale once ScannerStaleWait elapsed from the start
+	later := a.startedAt.Add(time.Minute * 11)
+	btcScanner.status.CheckedAt = later.Unix()
+	require.Equal(t, []string{"scanner_stale:SKY"}, keys(a.runChecks(later)))
+
+	btcScanner.status.BestHeight = 120
+	btcScanner.status.CheckedAt = now.Add(-time.Hour).Unix()
+	ex.coins = "99.999999"
+	am[config.CoinTypeSKY] = 4
+	ex.processorErr = errors.New("processor failed")
+	ex.senderErr = sender.NewRPCError(errors.New("insufficient balance"))
+	ex.deposits = []exchange.DepositInfo{
+		{
+			DepositID: "foo-tx:0",
+			Status:    exchange.StatusWaitSend,
+			UpdatedAt: now.Add(-time.Hour * 3).Unix(),
+		},
+		{
+			DepositID: "foo-tx:1",
+			Status:    exchange.StatusWaitConfirm,
+			UpdatedAt: now.Add(-time.Hour * 2).Unix(),
+		},
+		{
+			DepositID: "foo-tx:2",
+			Status:    exchange.StatusWaitConfirm,
+			UpdatedAt: now.Unix(),
+		},
+		{
+			DepositID: "foo-tx:3",
+			Status:    exchange.StatusDone,
+			UpdatedAt: now.Add(-time.Hour * 3).Unix(),
+		},
+	}
+
+	found := a.runChecks(now)
+	require.Equal(t, []string{
+		"scanner_stale:BTC",
+		"scanner_lag:BTC",
+		"hot_wallet_balance",
+		"address_pool:SKY",
+		"processor_error",
+		"sender_error",
+		"stuck_deposits",
+	}, keys(found))
+
+	require.Equal(t, "120", found[1].Fields["bestHeight"])
+	require.Equal(t, "100", found[1].Fields["height"])
+	require.Equal(t, "99.999999", found[2].Fields["balance"])
+	require.Equal(t, "4", found[3].Fields["remaining"])
+	require.Equal(t, "processor failed", found[4].Fields["error"])
+	require.Equal(t, "2", found[6].Fields["count"])
+	require.Equal(t, "foo-tx:0,foo-tx:1", found[6].Fields["depositIDs"])
+
+	// Transient sender errors are not alerted
+	ex.senderErr = errors.New("not confirmed")
+	require.NotContains(t, keys(a.runChecks(now)), CheckSenderError)
+}
+
+func TestRunDisabled(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	a, err := New(log, testCfg(), &dummyExchanger{}, dummyAddrManager{}, nil)
+	require.NoError(t, err)
+	require.Empty(t, a.notifiers)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, a.Run())
+	}()
+
+	a.Shutdown()
+	<-done
+}
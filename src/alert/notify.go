@@ -0,0 +1,247 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/webhook"
+)
+
+// Largest response body read from the alert webhook
+const maxResponseSize = 64 * 1024
+
+// Notifier sends alerts to the operators
+type Notifier interface {
+	Name() string
+	Notify(a Alert) error
+}
+
+// NewNotifiers creates the notifiers configured in cfg
+func NewNotifiers(cfg config.Alerts) []Notifier {
+	var notifiers []Notifier
+
+	if cfg.SMTP.Host != "" {
+		notifiers = append(notifiers, &SMTPNotifier{
+			cfg: cfg.SMTP,
+		})
+	}
+
+	if cfg.Webhook.URL != "" {
+		notifiers = append(notifiers, &WebhookNotifier{
+			cfg: cfg.Webhook,
+			client: &http.Client{
+				Timeout: cfg.Webhook.Timeout,
+			},
+		})
+	}
+
+	if cfg.Command.Path != "" {
+		notifiers = append(notifiers, &CommandNotifier{
+			cfg: cfg.Command,
+		})
+	}
+
+	return notifiers
+}
+
+// subject returns the one line summary of an alert
+func subject(a Alert) string {
+	if a.Resolved {
+		return "[teller] RESOLVED: " + a.Message
+	}
+	return "[teller] ALERT: " + a.Message
+}
+
+// SMTPNotifier sends alerts by email
+type SMTPNotifier struct {
+	cfg config.AlertSMTP
+}
+
+// Name returns "smtp"
+func (n *SMTPNotifier) Name() string {
+	return "smtp"
+}
+
+// Notify sends an alert by email
+func (n *SMTPNotifier) Notify(a Alert) error {
+	host, _, err := net.SplitHostPort(n.cfg.Host)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", n.cfg.Host, n.cfg.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(n.cfg.Timeout)); err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{
+			ServerName: host,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if n.cfg.Username != "" {
+		// smtp.PlainAuth refuses to send the password over an unencrypted connection, except to localhost
+		if err := c.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(n.cfg.From); err != nil {
+		return err
+	}
+
+	for _, to := range n.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(n.message(a)); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// message returns the email of an alert
+func (n *SMTPNotifier) message(a Alert) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject(a))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Unix(a.Timestamp, 0).UTC().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	fmt.Fprintf(&b, "%s\r\n\r\n", a.Message)
+	fmt.Fprintf(&b, "check: %s\r\n", a.Check)
+	fmt.Fprintf(&b, "key: %s\r\n", a.Key)
+	fmt.Fprintf(&b, "resolved: %v\r\n", a.Resolved)
+	fmt.Fprintf(&b, "time: %s\r\n", time.Unix(a.Timestamp, 0).UTC().Format(time.RFC3339))
+
+	keys := make([]string, 0, len(a.Fields))
+	for k := range a.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, a.Fields[k])
+	}
+
+	return b.Bytes()
+}
+
+// WebhookNotifier posts alerts as JSON to a URL
+type WebhookNotifier struct {
+	cfg    config.AlertWebhook
+	client *http.Client
+}
+
+// Name returns "webhook"
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Notify posts an alert. If a secret is configured, the request is signed like the deposit webhooks,
+// in the webhook.SignatureHeader header.
+func (n *WebhookNotifier) Notify(a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if n.cfg.Secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(n.cfg.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Read the body so the connection can be reused
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Alert webhook returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	return nil
+}
+
+// CommandNotifier runs a local command for each alert, with the alert as JSON on its stdin
+type CommandNotifier struct {
+	cfg config.AlertCommand
+}
+
+// Name returns "command"
+func (n *CommandNotifier) Name() string {
+	return "command"
+}
+
+// Notify runs the command, killing it after the configured timeout
+func (n *CommandNotifier) Notify(a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.cfg.Path, n.cfg.Args...)
+	cmd.Stdin = bytes.NewReader(body)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Alert command failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package alert
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/webhook"
+)
+
+var testAlert = Alert{
+	Key:     CheckStuckDeposits,
+	Check:   CheckStuckDeposits,
+	Message: "2 deposits have not changed status for over 1h0m0s",
+	Fields: map[string]string{
+		"count":      "2",
+		"depositIDs": "foo-tx:0,foo-tx:1",
+	},
+	Timestamp: 1520000000,
+}
+
+// smtpServer is a local SMTP stand-in, recording the commands and messages it receives
+type smtpServer struct {
+	sync.Mutex
+	t        *testing.T
+	ln       net.Listener
+	commands []string
+	messages []string
+	wg       sync.WaitGroup
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &smtpServer{
+		t:  t,
+		ln: ln,
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, err := conn.Write([]byte(line + "\r\n"))
+		require.NoError(s.t, err)
+	}
+
+	reply("220 localhost ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		s.Lock()
+		s.commands = append(s.commands, line)
+		s.Unlock()
+
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			reply("235 Authentication successful")
+		case "MAIL", "RCPT":
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+
+			var msg []string
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg = append(msg, l)
+			}
+
+			s.Lock()
+			s.messages = append(s.messages, strings.Join(msg, ""))
+			s.Unlock()
+
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *smtpServer) close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	s := newSMTPServer(t)
+	defer s.close()
+
+	n := NewNotifiers(config.Alerts{
+		SMTP: config.AlertSMTP{
+			Host:     s.ln.Addr().String(),
+			Username: "teller",
+			Password: "pass",
+			From:     "teller@example.org",
+			To:       []string{"ops@example.org", "oncall@example.org"},
+			Timeout:  time.Second,
+		},
+	})
+	require.Len(t, n, 1)
+	require.Equal(t, "smtp", n[0].Name())
+
+	require.NoError(t, n[0].Notify(testAlert))
+
+	s.Lock()
+	defer s.Unlock()
+
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00teller\x00pass"))
+	require.Equal(t, []string{
+		"EHLO localhost",
+		"AUTH PLAIN " + auth,
+		"MAIL FROM:<teller@example.org>",
+		"RCPT TO:<ops@example.org>",
+		"RCPT TO:<oncall@example.org>",
+		"DATA",
+		"QUIT",
+	}, s.commands)
+
+	require.Len(t, s.messages, 1)
+	msg := s.messages[0]
+	require.Contains(t, msg, "From: teller@example.org\r\n")
+	require.Contains(t, msg, "To: ops@example.org, oncall@example.org\r\n")
+	require.Contains(t, msg, "Subject: [teller] ALERT: 2 deposits have not changed status for over 1h0m0s\r\n")
+	require.Contains(t, msg, "check: stuck_deposits\r\n")
+	require.Contains(t, msg, "depositIDs: foo-tx:0,foo-tx:1\r\n")
+}
+
+func TestSMTPNotifierUnreachable(t *testing.T) {
+	s := newSMTPServer(t)
+	addr := s.ln.Addr().String()
+	s.close()
+
+	n := NewNotifiers(config.Alerts{
+		SMTP: config.AlertSMTP{
+			Host:    addr,
+			From:    "teller@example.org",
+			To:      []string{"ops@example.org"},
+			Timeout: time.Second,
+		},
+	})
+	require.Error(t, n[0].Notify(testAlert))
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received []Alert
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, webhook.Sign("s3cret", body), r.Header.Get(webhook.SignatureHeader))
+
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		var a Alert
+		require.NoError(t, json.Unmarshal(body, &a))
+		received = append(received, a)
+	}))
+	defer srv.Close()
+
+	n := NewNotifiers(config.Alerts{
+		Webhook: config.AlertWebhook{
+			URL:     srv.URL,
+			Secret:  "s3cret",
+			Timeout: time.Second,
+		},
+	})
+	require.Len(t, n, 1)
+	require.Equal(t, "webhook", n[0].Name())
+
+	require.NoError(t, n[0].Notify(testAlert))
+	require.Equal(t, []Alert{testAlert}, received)
+
+	fail = true
+	err := n[0].Notify(testAlert)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "503")
+}
+
+func TestCommandNotifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "alert.json")
+
+	n := NewNotifiers(config.Alerts{
+		Command: config.AlertCommand{
+			Path:    "sh",
+			Args:    []string{"-c", "cat > " + out},
+			Timeout: time.Second,
+		},
+	})
+	require.Len(t, n, 1)
+	require.Equal(t, "command", n[0].Name())
+
+	require.NoError(t, n[0].Notify(testAlert))
+
+	b, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	var a Alert
+	require.NoError(t, json.Unmarshal(b, &a))
+	require.Equal(t, testAlert, a)
+
+	// A failed command's output is included in the error
+	n = NewNotifiers(config.Alerts{
+		Command: config.AlertCommand{
+			Path:    "sh",
+			Args:    []string{"-c", "echo oops; exit 1"},
+			Timeout: time.Second,
+		},
+	})
+	err = n[0].Notify(testAlert)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "oops")
+
+	// Killed after the timeout
+	n = NewNotifiers(config.Alerts{
+		Command: config.AlertCommand{
+			Path:    "sleep",
+			Args:    []string{"10"},
+			Timeout: time.Millisecond * 100,
+		},
+	})
+	start := time.Now()
+	require.Error(t, n[0].Notify(testAlert))
+	require.True(t, time.Since(start) < time.Second*5)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -13,10 +14,12 @@ import (
 	"github.com/shopspring/decimal"
 	"github.com/spf13/viper"
 
-	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/util/droplet"
 	"github.com/skycoin/skycoin/src/wallet"
 
+	"github.com/skycoin/teller/src/fiber"
 	"github.com/skycoin/teller/src/util/mathutil"
+	"github.com/skycoin/teller/src/util/walletcrypt"
 )
 
 const (
@@ -24,6 +27,9 @@ const (
 	BuyMethodDirect = "direct"
 	// BuyMethodPassthrough is used when coins are first bought from an exchange before sending from the local hot wallet
 	BuyMethodPassthrough = "passthrough"
+	// BuyMethodHybrid is used when coins are bought directly from the local hot wallet if it can cover the deposit,
+	// otherwise they are bought from an exchange first like BuyMethodPassthrough
+	BuyMethodHybrid = "hybrid"
 
 	// CoinTypeBTC is BTC coin type
 	CoinTypeBTC = "BTC"
@@ -61,7 +67,7 @@ func ValidateCoinType(coinType string) error {
 // ValidateBuyMethod returns an error if a buy method string is invalid
 func ValidateBuyMethod(m string) error {
 	switch m {
-	case BuyMethodDirect, BuyMethodPassthrough:
+	case BuyMethodDirect, BuyMethodPassthrough, BuyMethodHybrid:
 		return nil
 	default:
 		return ErrInvalidBuyMethod
@@ -92,6 +98,9 @@ type Config struct {
 
 	Teller Teller `mapstructure:"teller"`
 
+	// The Skycoin-fiber coin sent to buyers. Its node and wallets are configured by sky_rpc and sky_exchanger.
+	Coin fiber.Coin `mapstructure:"coin"`
+
 	SkyRPC SkyRPC `mapstructure:"sky_rpc"`
 	BtcRPC BtcRPC `mapstructure:"btc_rpc"`
 	EthRPC EthRPC `mapstructure:"eth_rpc"`
@@ -105,6 +114,14 @@ type Config struct {
 
 	AdminPanel AdminPanel `mapstructure:"admin_panel"`
 
+	Screening Screening `mapstructure:"screening"`
+
+	Webhooks Webhooks `mapstructure:"webhooks"`
+
+	Alerts Alerts `mapstructure:"alerts"`
+
+	Storage Storage `mapstructure:"storage"`
+
 	Dummy Dummy `mapstructure:"dummy"`
 }
 
@@ -170,16 +187,39 @@ type SkyExchanger struct {
 	SkySkyExchangeRate string `mapstructure:"sky_sky_exchange_rate"`
 	// Number of decimal places to truncate SKY to
 	MaxDecimals int `mapstructure:"max_decimals"`
+	// Coin is set from the coin section after loading, not parsed from the sky_exchanger section
+	Coin fiber.Coin `mapstructure:"-"`
 	// How long to wait before rechecking transaction confirmations
 	TxConfirmationCheckWait time.Duration `mapstructure:"tx_confirmation_check_wait"`
+	// How long a sent transaction can be unconfirmed before it is rebroadcast,
+	// or replaced if its inputs were spent by another transaction
+	TxRebroadcastTimeout time.Duration `mapstructure:"tx_rebroadcast_timeout"`
 	// Path of hot Skycoin wallet file on disk
 	Wallet string `mapstructure:"wallet"`
+	// Additional hot wallets. Each payout is sent from the wallet with the largest spendable balance that can cover it
+	Wallets []SkyWallet `mapstructure:"wallets"`
+	// Sweeping of excess hot wallet balance to cold storage
+	Sweep Sweep `mapstructure:"sweep"`
+	// External signer holding the hot wallets, instead of wallet files
+	Signer Signer `mapstructure:"signer"`
 	// Allow sending of coins (deposits will still be received and recorded)
 	SendEnabled bool `mapstructure:"send_enabled"`
-	// Method of purchasing coins ("direct buy" or "passthrough"
+	// Method of purchasing coins ("direct buy", "passthrough" or "hybrid")
 	BuyMethod string `mapstructure:"buy_method"`
 	// C2CX configuration
 	C2CX C2CX `mapstructure:"c2cx"`
+	// Hybrid buy method configuration
+	Hybrid Hybrid `mapstructure:"hybrid"`
+	// Failed deposit retry configuration
+	Retry Retry `mapstructure:"retry"`
+	// Rules that hold deposits for operator approval
+	Risk Risk `mapstructure:"risk"`
+	// Volume limits, beyond which binds are refused and deposits are refunded
+	Limits Limits `mapstructure:"limits"`
+	// Hot wallet circuit breaker, which pauses binding when the wallet can't cover its obligations
+	HotWallet HotWallet `mapstructure:"hot_wallet"`
+	// Service fees deducted from the SKY sent for each deposit coin type
+	Fees Fees `mapstructure:"fees"`
 }
 
 // C2CX config for the C2CX implementation from skycoin/exchange-api
@@ -190,6 +230,21 @@ type C2CX struct {
 	RatelimitWait      time.Duration   `mapstructure:"ratelimit_wait"`
 	CheckOrderWait     time.Duration   `mapstructure:"check_order_wait"`
 	BtcMinimumVolume   decimal.Decimal `mapstructure:"btc_minimum_volume"`
+	// Deduct the exchange commission from the SKY sent to the user, instead of absorbing it
+	PassFeesToUser bool `mapstructure:"pass_fees_to_user"`
+}
+
+// Hybrid config for buy_method hybrid
+type Hybrid struct {
+	// How long to wait before retrying a failed hot wallet balance check
+	BalanceCheckWait time.Duration `mapstructure:"balance_check_wait"`
+	// Place a replenishment buy on C2CX when the hot wallet's spendable SKY,
+	// net of outstanding obligations, falls below this amount. Disabled if empty.
+	ReplenishThreshold string `mapstructure:"replenish_threshold"`
+	// Amount of BTC to spend on each replenishment buy
+	ReplenishBtcAmount string `mapstructure:"replenish_btc_amount"`
+	// Minimum time between replenishment buys
+	ReplenishWait time.Duration `mapstructure:"replenish_wait"`
 }
 
 // Validate validates the SkyExchanger config
@@ -224,22 +279,452 @@ func (c SkyExchanger) validate() []error {
 		errs = append(errs, errors.New("sky_exchanger.max_decimals can't be negative"))
 	}
 
-	if uint64(c.MaxDecimals) > visor.MaxDropletPrecision {
-		errs = append(errs, fmt.Errorf("sky_exchanger.max_decimals is larger than visor.MaxDropletPrecision=%d", visor.MaxDropletPrecision))
+	if uint64(c.MaxDecimals) > c.Coin.MaxDropletPrecision {
+		errs = append(errs, fmt.Errorf("sky_exchanger.max_decimals is larger than coin.max_droplet_precision=%d", c.Coin.MaxDropletPrecision))
 	}
 
 	if err := ValidateBuyMethod(c.BuyMethod); err != nil {
-		errs = append(errs, fmt.Errorf("sky_exchanger.buy_method must be \"%s\" or \"%s\"", BuyMethodDirect, BuyMethodPassthrough))
+		errs = append(errs, fmt.Errorf("sky_exchanger.buy_method must be \"%s\", \"%s\" or \"%s\"", BuyMethodDirect, BuyMethodPassthrough, BuyMethodHybrid))
 	}
 
-	if c.BuyMethod == BuyMethodPassthrough {
+	if c.BuyMethod == BuyMethodPassthrough || c.BuyMethod == BuyMethodHybrid {
 		if c.C2CX.Key == "" {
-			errs = append(errs, errors.New("c2cx.key must be set for buy_method passthrough"))
+			errs = append(errs, fmt.Errorf("c2cx.key must be set for buy_method %s", c.BuyMethod))
 		}
 
 		if c.C2CX.Secret == "" {
-			errs = append(errs, errors.New("c2cx.secret must be set for buy_method passthrough"))
+			errs = append(errs, fmt.Errorf("c2cx.secret must be set for buy_method %s", c.BuyMethod))
+		}
+	}
+
+	if c.BuyMethod == BuyMethodHybrid {
+		errs = append(errs, c.Hybrid.validate()...)
+	}
+
+	errs = append(errs, c.Retry.validate()...)
+	errs = append(errs, c.Risk.validate()...)
+	errs = append(errs, c.Limits.validate()...)
+	errs = append(errs, c.HotWallet.validate()...)
+	errs = append(errs, c.Fees.validate()...)
+
+	return errs
+}
+
+func (c Hybrid) validate() []error {
+	var errs []error
+
+	if c.BalanceCheckWait < 0 {
+		errs = append(errs, errors.New("sky_exchanger.hybrid.balance_check_wait can't be negative"))
+	}
+
+	if c.ReplenishThreshold == "" {
+		return errs
+	}
+
+	if _, err := droplet.FromString(c.ReplenishThreshold); err != nil {
+		errs = append(errs, fmt.Errorf("sky_exchanger.hybrid.replenish_threshold invalid: %v", err))
+	}
+
+	amount, err := decimal.NewFromString(c.ReplenishBtcAmount)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("sky_exchanger.hybrid.replenish_btc_amount invalid: %v", err))
+	} else if amount.Sign() <= 0 {
+		errs = append(errs, errors.New("sky_exchanger.hybrid.replenish_btc_amount must be positive"))
+	}
+
+	if c.ReplenishWait < 0 {
+		errs = append(errs, errors.New("sky_exchanger.hybrid.replenish_wait can't be negative"))
+	}
+
+	return errs
+}
+
+// Retry config for retrying deposits that failed processing
+type Retry struct {
+	// Number of attempts before a deposit is marked failed. Retrying is disabled if 0.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// How long to wait before the first retry. The wait doubles after each attempt.
+	InitialWait time.Duration `mapstructure:"initial_wait"`
+	// Maximum wait between retries
+	MaxWait time.Duration `mapstructure:"max_wait"`
+	// How often to check for deposits due to be retried
+	CheckWait time.Duration `mapstructure:"check_wait"`
+}
+
+func (c Retry) validate() []error {
+	var errs []error
+
+	if c.MaxAttempts < 0 {
+		errs = append(errs, errors.New("sky_exchanger.retry.max_attempts can't be negative"))
+	}
+
+	if c.MaxAttempts == 0 {
+		return errs
+	}
+
+	if c.InitialWait <= 0 {
+		errs = append(errs, errors.New("sky_exchanger.retry.initial_wait must be positive"))
+	}
+
+	if c.MaxWait < c.InitialWait {
+		errs = append(errs, errors.New("sky_exchanger.retry.max_wait can't be less than sky_exchanger.retry.initial_wait"))
+	}
+
+	if c.CheckWait <= 0 {
+		errs = append(errs, errors.New("sky_exchanger.retry.check_wait must be positive"))
+	}
+
+	return errs
+}
+
+// Risk config for the rules that hold deposits for operator approval.
+// Each rule is disabled if its value is empty or false.
+type Risk struct {
+	// Hold deposits larger than these amounts, in BTC, ETH and SKY
+	BtcMaxDeposit string `mapstructure:"btc_max_deposit"`
+	EthMaxDeposit string `mapstructure:"eth_max_deposit"`
+	SkyMaxDeposit string `mapstructure:"sky_max_deposit"`
+	// Hold deposits that would take the SKY owed to a skycoin address
+	// in the last 24 hours over this amount
+	SkyAddressDailyMax string `mapstructure:"sky_address_daily_max"`
+	// Hold deposits to a skycoin address that has not completed a deposit before
+	HoldFirstDeposit bool `mapstructure:"hold_first_deposit"`
+	// Hold deposits that differ by more than this percentage from the amount
+	// expected when their address was bound. Addresses bound without an amount are not checked.
+	InvoiceTolerance string `mapstructure:"invoice_tolerance"`
+}
+
+// MaxDeposit returns the configured maximum deposit for a coin type.
+// The maximum is zero if the rule is disabled.
+func (c Risk) MaxDeposit(coinType string) (decimal.Decimal, error) {
+	var v string
+	switch coinType {
+	case CoinTypeBTC:
+		v = c.BtcMaxDeposit
+	case CoinTypeETH:
+		v = c.EthMaxDeposit
+	case CoinTypeSKY:
+		v = c.SkyMaxDeposit
+	default:
+		return decimal.Zero, ErrUnsupportedCoinType
+	}
+
+	if v == "" {
+		return decimal.Zero, nil
+	}
+
+	return decimal.NewFromString(v)
+}
+
+func (c Risk) validate() []error {
+	var errs []error
+
+	for _, ct := range CoinTypes {
+		max, err := c.MaxDeposit(ct)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sky_exchanger.risk.%s_max_deposit invalid: %v", strings.ToLower(ct), err))
+		} else if max.Sign() < 0 {
+			errs = append(errs, fmt.Errorf("sky_exchanger.risk.%s_max_deposit can't be negative", strings.ToLower(ct)))
+		}
+	}
+
+	if c.SkyAddressDailyMax != "" {
+		if _, err := droplet.FromString(c.SkyAddressDailyMax); err != nil {
+			errs = append(errs, fmt.Errorf("sky_exchanger.risk.sky_address_daily_max invalid: %v", err))
+		}
+	}
+
+	if c.InvoiceTolerance != "" {
+		tolerance, err := decimal.NewFromString(c.InvoiceTolerance)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sky_exchanger.risk.invoice_tolerance invalid: %v", err))
+		} else if tolerance.Sign() < 0 {
+			errs = append(errs, errors.New("sky_exchanger.risk.invoice_tolerance can't be negative"))
+		}
+	}
+
+	return errs
+}
+
+// Limits config for the volume limits.
+// Binds are refused once a limit is reached, and deposits that would exceed a limit are set to refund pending.
+// Each limit is disabled if its value is empty.
+type Limits struct {
+	// Total SKY to sell. Binding is disabled once this much SKY is sold or owed
+	TotalSkySold string `mapstructure:"total_sky_sold"`
+	// SKY to sell to a skycoin address in the last 24 hours
+	SkyAddressDaily string `mapstructure:"sky_address_daily"`
+	// SKY to sell to a skycoin address in total
+	SkyAddressLifetime string `mapstructure:"sky_address_lifetime"`
+	// Amounts to accept in the last 24 hours, in BTC, ETH and SKY
+	BtcDaily string `mapstructure:"btc_daily"`
+	EthDaily string `mapstructure:"eth_daily"`
+	SkyDaily string `mapstructure:"sky_daily"`
+}
+
+// CoinDaily returns the configured daily limit for a coin type.
+// The limit is zero if it is disabled.
+func (c Limits) CoinDaily(coinType string) (decimal.Decimal, error) {
+	var v string
+	switch coinType {
+	case CoinTypeBTC:
+		v = c.BtcDaily
+	case CoinTypeETH:
+		v = c.EthDaily
+	case CoinTypeSKY:
+		v = c.SkyDaily
+	default:
+		return decimal.Zero, ErrUnsupportedCoinType
+	}
+
+	if v == "" {
+		return decimal.Zero, nil
+	}
+
+	return decimal.NewFromString(v)
+}
+
+func (c Limits) validate() []error {
+	var errs []error
+
+	for _, ct := range CoinTypes {
+		limit, err := c.CoinDaily(ct)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sky_exchanger.limits.%s_daily invalid: %v", strings.ToLower(ct), err))
+		} else if limit.Sign() < 0 {
+			errs = append(errs, fmt.Errorf("sky_exchanger.limits.%s_daily can't be negative", strings.ToLower(ct)))
+		}
+	}
+
+	for k, v := range map[string]string{
+		"total_sky_sold":       c.TotalSkySold,
+		"sky_address_daily":    c.SkyAddressDaily,
+		"sky_address_lifetime": c.SkyAddressLifetime,
+	} {
+		if v == "" {
+			continue
+		}
+
+		if _, err := droplet.FromString(v); err != nil {
+			errs = append(errs, fmt.Errorf("sky_exchanger.limits.%s invalid: %v", k, err))
+		}
+	}
+
+	return errs
+}
+
+// Fees config for the service fee of each deposit coin type
+type Fees struct {
+	BTC Fee `mapstructure:"btc"`
+	ETH Fee `mapstructure:"eth"`
+	SKY Fee `mapstructure:"sky"`
+}
+
+// Fee config for the service fee deducted from the SKY sent for a deposit.
+// The fee is the percentage of the SKY owed plus the flat fee, and at least the minimum.
+// There is no fee if all values are empty.
+type Fee struct {
+	// Percentage of the SKY owed, e.g. "1.5" for 1.5%
+	Percent string `mapstructure:"percent" json:"percent"`
+	// SKY charged for every deposit
+	Flat string `mapstructure:"flat" json:"flat"`
+	// Smallest fee to charge, in SKY
+	Minimum string `mapstructure:"minimum" json:"minimum"`
+}
+
+// CoinFee returns the fee configured for a coin type
+func (c Fees) CoinFee(coinType string) (Fee, error) {
+	switch coinType {
+	case CoinTypeBTC:
+		return c.BTC, nil
+	case CoinTypeETH:
+		return c.ETH, nil
+	case CoinTypeSKY:
+		return c.SKY, nil
+	default:
+		return Fee{}, ErrUnsupportedCoinType
+	}
+}
+
+// Percentage returns the fee percentage, which is zero if not set
+func (c Fee) Percentage() (decimal.Decimal, error) {
+	if c.Percent == "" {
+		return decimal.Zero, nil
+	}
+
+	return decimal.NewFromString(c.Percent)
+}
+
+// FlatDroplets returns the flat fee in droplets, which is zero if not set
+func (c Fee) FlatDroplets() (uint64, error) {
+	if c.Flat == "" {
+		return 0, nil
+	}
+
+	return droplet.FromString(c.Flat)
+}
+
+// MinimumDroplets returns the minimum fee in droplets, which is zero if not set
+func (c Fee) MinimumDroplets() (uint64, error) {
+	if c.Minimum == "" {
+		return 0, nil
+	}
+
+	return droplet.FromString(c.Minimum)
+}
+
+func (c Fees) validate() []error {
+	var errs []error
+
+	for _, ct := range CoinTypes {
+		fee, err := c.CoinFee(ct)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		name := fmt.Sprintf("sky_exchanger.fees.%s", strings.ToLower(ct))
+
+		if pct, err := fee.Percentage(); err != nil {
+			errs = append(errs, fmt.Errorf("%s.percent invalid: %v", name, err))
+		} else if pct.Sign() < 0 || pct.GreaterThan(decimal.New(100, 0)) {
+			errs = append(errs, fmt.Errorf("%s.percent must be between 0 and 100", name))
+		}
+
+		if _, err := fee.FlatDroplets(); err != nil {
+			errs = append(errs, fmt.Errorf("%s.flat invalid: %v", name, err))
+		}
+
+		if _, err := fee.MinimumDroplets(); err != nil {
+			errs = append(errs, fmt.Errorf("%s.minimum invalid: %v", name, err))
+		}
+	}
+
+	return errs
+}
+
+// HotWallet config for the hot wallet circuit breaker.
+// Binding is paused while the hot wallet's balance minus the SKY owed to deposits is below Reserve.
+type HotWallet struct {
+	// SKY to keep in the hot wallet beyond its obligations. The circuit breaker is disabled if empty.
+	Reserve string `mapstructure:"reserve"`
+	// SKY expected for each bound address that has not received a deposit yet
+	BoundAddressEstimate string `mapstructure:"bound_address_estimate"`
+	// How long after binding an address without a deposit is counted with BoundAddressEstimate
+	BoundAddressWindow time.Duration `mapstructure:"bound_address_window"`
+	// How often to check the hot wallet balance
+	CheckWait time.Duration `mapstructure:"check_wait"`
+}
+
+func (c HotWallet) validate() []error {
+	var errs []error
+
+	if c.Reserve == "" {
+		return errs
+	}
+
+	if _, err := droplet.FromString(c.Reserve); err != nil {
+		errs = append(errs, fmt.Errorf("sky_exchanger.hot_wallet.reserve invalid: %v", err))
+	}
+
+	if c.BoundAddressEstimate != "" {
+		if _, err := droplet.FromString(c.BoundAddressEstimate); err != nil {
+			errs = append(errs, fmt.Errorf("sky_exchanger.hot_wallet.bound_address_estimate invalid: %v", err))
 		}
+
+		if c.BoundAddressWindow <= 0 {
+			errs = append(errs, errors.New("sky_exchanger.hot_wallet.bound_address_window must be positive"))
+		}
+	}
+
+	if c.CheckWait <= 0 {
+		errs = append(errs, errors.New("sky_exchanger.hot_wallet.check_wait must be positive"))
+	}
+
+	return errs
+}
+
+// SkyWallet config for a hot Skycoin wallet
+type SkyWallet struct {
+	// Path of the wallet file on disk
+	File string `mapstructure:"file"`
+	// Largest single payout to send from this wallet, in SKY. Unlimited if empty.
+	// It caps each payout, not the total sent; the sweep ceiling bounds the SKY held by the wallet.
+	MaxPayout string `mapstructure:"max_payout"`
+	// Largest total of payouts to send from this wallet in the last 24 hours, in SKY. Unlimited if empty.
+	DailyLimit string `mapstructure:"daily_limit"`
+}
+
+// Sweep config for sweeping excess hot wallet balance to cold storage.
+// Sweeping is disabled if ColdAddress is empty.
+type Sweep struct {
+	// Skycoin address to sweep to
+	ColdAddress string `mapstructure:"cold_address"`
+	// Spendable SKY to leave in each hot wallet. The balance above this is swept.
+	Ceiling string `mapstructure:"ceiling"`
+	// How often to check the hot wallet balances
+	CheckWait time.Duration `mapstructure:"check_wait"`
+}
+
+// Signer config for an external signer that holds the hot wallets.
+// Transactions are created unsigned and sent to the signer to be signed.
+// The external signer is disabled if Socket is empty.
+type Signer struct {
+	// Unix socket of the signer
+	Socket string `mapstructure:"socket"`
+	// File holding the auth token shared with the signer
+	TokenFile string `mapstructure:"token_file"`
+	// Timeout of requests to the signer
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+func (c Signer) validate() []error {
+	var errs []error
+
+	if c.TokenFile == "" {
+		errs = append(errs, errors.New("sky_exchanger.signer.token_file must be set if sky_exchanger.signer.socket is set"))
+	} else if _, err := os.Stat(c.TokenFile); os.IsNotExist(err) {
+		errs = append(errs, fmt.Errorf("sky_exchanger.signer.token_file %s does not exist", c.TokenFile))
+	}
+
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("sky_exchanger.signer.timeout must be positive"))
+	}
+
+	return errs
+}
+
+// HotWallets returns the hot wallets, sky_exchanger.wallet first
+func (c SkyExchanger) HotWallets() []SkyWallet {
+	var wallets []SkyWallet
+	if c.Wallet != "" {
+		wallets = append(wallets, SkyWallet{
+			File: c.Wallet,
+		})
+	}
+
+	return append(wallets, c.Wallets...)
+}
+
+func (c Sweep) validate(coin fiber.Coin) []error {
+	var errs []error
+
+	if c.ColdAddress == "" {
+		return errs
+	}
+
+	if _, err := coin.DecodeAddress(c.ColdAddress); err != nil {
+		errs = append(errs, fmt.Errorf("sky_exchanger.sweep.cold_address invalid: %v", err))
+	}
+
+	if c.Ceiling == "" {
+		errs = append(errs, errors.New("sky_exchanger.sweep.ceiling must be set if sky_exchanger.sweep.cold_address is set"))
+	} else if _, err := droplet.FromString(c.Ceiling); err != nil {
+		errs = append(errs, fmt.Errorf("sky_exchanger.sweep.ceiling invalid: %v", err))
+	}
+
+	if c.CheckWait <= 0 {
+		errs = append(errs, errors.New("sky_exchanger.sweep.check_wait must be positive"))
 	}
 
 	return errs
@@ -248,22 +733,80 @@ func (c SkyExchanger) validate() []error {
 func (c SkyExchanger) validateWallet() []error {
 	var errs []error
 
-	if c.Wallet == "" {
+	wallets := c.HotWallets()
+
+	if c.Signer.Socket != "" {
+		if len(wallets) != 0 {
+			errs = append(errs, errors.New("sky_exchanger.wallet and sky_exchanger.wallets must not be set if sky_exchanger.signer.socket is set"))
+		}
+
+		errs = append(errs, c.Signer.validate()...)
+		errs = append(errs, c.Sweep.validate(c.Coin)...)
+
+		return errs
+	}
+
+	if len(wallets) == 0 {
 		errs = append(errs, errors.New("sky_exchanger.wallet missing"))
 	}
 
-	if _, err := os.Stat(c.Wallet); os.IsNotExist(err) {
-		errs = append(errs, fmt.Errorf("sky_exchanger.wallet file %s does not exist", c.Wallet))
+	for _, w := range wallets {
+		if w.File == "" {
+			errs = append(errs, errors.New("sky_exchanger.wallets file missing"))
+			continue
+		}
+
+		if _, err := os.Stat(w.File); os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("sky_exchanger.wallet file %s does not exist", w.File))
+		}
+
+		if err := validateWalletFile(w.File); err != nil {
+			errs = append(errs, err)
+		}
+
+		if w.MaxPayout != "" {
+			if _, err := droplet.FromString(w.MaxPayout); err != nil {
+				errs = append(errs, fmt.Errorf("sky_exchanger.wallets max_payout of %s invalid: %v", w.File, err))
+			}
+		}
+
+		if w.DailyLimit != "" {
+			if _, err := droplet.FromString(w.DailyLimit); err != nil {
+				errs = append(errs, fmt.Errorf("sky_exchanger.wallets daily_limit of %s invalid: %v", w.File, err))
+			}
+		}
 	}
 
-	w, err := wallet.Load(c.Wallet)
+	errs = append(errs, c.Sweep.validate(c.Coin)...)
+
+	return errs
+}
+
+// validateWalletFile checks that a wallet file loads, whether it is encrypted or not
+func validateWalletFile(file string) error {
+	encrypted, err := walletcrypt.IsEncrypted(file)
 	if err != nil {
-		errs = append(errs, fmt.Errorf("sky_exchanger.wallet file %s failed to load: %v", c.Wallet, err))
-	} else if err := w.Validate(); err != nil {
-		errs = append(errs, fmt.Errorf("sky_exchanger.wallet file %s is invalid: %v", c.Wallet, err))
+		return fmt.Errorf("sky_exchanger.wallet file %s failed to load: %v", file, err)
 	}
 
-	return errs
+	if encrypted {
+		if _, err := walletcrypt.Load(file); err != nil {
+			return fmt.Errorf("sky_exchanger.wallet file %s failed to load: %v", file, err)
+		}
+		return nil
+	}
+
+	wlt, err := wallet.Load(file)
+	if err != nil {
+		return fmt.Errorf("sky_exchanger.wallet file %s failed to load: %v", file, err)
+	}
+	defer walletcrypt.Zero(wlt)
+
+	if err := wlt.Validate(); err != nil {
+		return fmt.Errorf("sky_exchanger.wallet file %s is invalid: %v", file, err)
+	}
+
+	return nil
 }
 
 // Web config for the teller HTTP interface
@@ -308,6 +851,335 @@ func (c Web) Validate() error {
 // AdminPanel config for the admin panel AdminPanel
 type AdminPanel struct {
 	Host string `mapstructure:"host"`
+	// Operators allowed to act on deposits, as "username:password" entries.
+	// The deposit actions are disabled if no users are configured.
+	Users []string `mapstructure:"users"`
+}
+
+// Credentials returns the configured users' passwords, keyed by username
+func (c AdminPanel) Credentials() (map[string]string, error) {
+	credentials := make(map[string]string, len(c.Users))
+	for _, u := range c.Users {
+		pts := strings.SplitN(u, ":", 2)
+		if len(pts) != 2 || pts[0] == "" || pts[1] == "" {
+			return nil, errors.New("admin_panel.users entries must be formatted as \"username:password\"")
+		}
+
+		if _, ok := credentials[pts[0]]; ok {
+			return nil, fmt.Errorf("admin_panel.users has duplicate user \"%s\"", pts[0])
+		}
+
+		credentials[pts[0]] = pts[1]
+	}
+
+	return credentials, nil
+}
+
+// Screening config for the address deny lists.
+// Each deny list is a file with one address per line. Blank lines and lines starting with # are ignored.
+type Screening struct {
+	// Path of the deny list of SKY addresses
+	SkyDenyList string `mapstructure:"sky_deny_list"`
+	// Path of the deny list of BTC addresses
+	BtcDenyList string `mapstructure:"btc_deny_list"`
+	// Path of the deny list of ETH addresses
+	EthDenyList string `mapstructure:"eth_deny_list"`
+	// How often to check the deny list files for changes
+	ReloadWait time.Duration `mapstructure:"reload_wait"`
+}
+
+// DenyList returns the path of the deny list for a coin type, empty if not configured
+func (c Screening) DenyList(coinType string) (string, error) {
+	switch coinType {
+	case CoinTypeBTC:
+		return c.BtcDenyList, nil
+	case CoinTypeETH:
+		return c.EthDenyList, nil
+	case CoinTypeSKY:
+		return c.SkyDenyList, nil
+	default:
+		return "", ErrUnsupportedCoinType
+	}
+}
+
+// Validate validates the Screening config
+func (c Screening) Validate() error {
+	for _, ct := range CoinTypes {
+		path, err := c.DenyList(ct)
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			continue
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("screening.%s_deny_list invalid: %v", strings.ToLower(ct), err)
+		}
+	}
+
+	if c.ReloadWait <= 0 {
+		return errors.New("screening.reload_wait must be positive")
+	}
+
+	return nil
+}
+
+// Webhooks config for notifying other systems of deposit events.
+// Webhooks are disabled if no endpoints are configured.
+type Webhooks struct {
+	// The URLs the events are posted to
+	Endpoints []WebhookEndpoint `mapstructure:"endpoints"`
+	// Timeout of each delivery request
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Number of failed attempts at delivering an event before it is skipped
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// How long to wait before retrying a failed delivery. The wait doubles after each attempt.
+	InitialWait time.Duration `mapstructure:"initial_wait"`
+	// Maximum wait between retries
+	MaxWait time.Duration `mapstructure:"max_wait"`
+	// How often to check for new events
+	CheckWait time.Duration `mapstructure:"check_wait"`
+	// How long to keep the events that every endpoint has received, so that they can be replayed
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// WebhookEndpoint config for a URL that events are posted to
+type WebhookEndpoint struct {
+	URL string `mapstructure:"url"`
+	// Key the deliveries are signed with, using HMAC-SHA256
+	Secret string `mapstructure:"secret"`
+	// Event types to deliver. All events are delivered if empty.
+	Events []string `mapstructure:"events"`
+}
+
+// Validate validates the Webhooks config
+func (c Webhooks) Validate() error {
+	if len(c.Endpoints) == 0 {
+		return nil
+	}
+
+	urls := make(map[string]struct{}, len(c.Endpoints))
+	for _, e := range c.Endpoints {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return fmt.Errorf("webhooks.endpoints url \"%s\" invalid: %v", e.URL, err)
+		}
+
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhooks.endpoints url \"%s\" must be an http or https URL", e.URL)
+		}
+
+		if _, ok := urls[e.URL]; ok {
+			return fmt.Errorf("webhooks.endpoints has duplicate url \"%s\"", e.URL)
+		}
+		urls[e.URL] = struct{}{}
+
+		if e.Secret == "" {
+			return fmt.Errorf("webhooks.endpoints secret of \"%s\" missing", e.URL)
+		}
+	}
+
+	if c.Timeout <= 0 {
+		return errors.New("webhooks.timeout must be positive")
+	}
+
+	if c.MaxAttempts <= 0 {
+		return errors.New("webhooks.max_attempts must be positive")
+	}
+
+	if c.InitialWait <= 0 {
+		return errors.New("webhooks.initial_wait must be positive")
+	}
+
+	if c.MaxWait < c.InitialWait {
+		return errors.New("webhooks.max_wait can't be less than webhooks.initial_wait")
+	}
+
+	if c.CheckWait <= 0 {
+		return errors.New("webhooks.check_wait must be positive")
+	}
+
+	if c.Retention < 0 {
+		return errors.New("webhooks.retention can't be negative")
+	}
+
+	return nil
+}
+
+// Alerts config for notifying operators of WatchNotice logs and degraded health.
+// Alerts are disabled if no notifier is configured. Each check is disabled if its value is empty or zero.
+type Alerts struct {
+	// How often to run the health checks
+	CheckWait time.Duration `mapstructure:"check_wait"`
+	// How long to wait before repeating an alert that is still active, or a WatchNotice log with the same message
+	RepeatWait time.Duration `mapstructure:"repeat_wait"`
+	// Maximum number of alerts sent in an hour. Further alerts are dropped.
+	MaxPerHour int `mapstructure:"max_per_hour"`
+	// Alert if a scanner's last scanned block is more than this many blocks behind its node's best block
+	MaxScannerLag int64 `mapstructure:"max_scanner_lag"`
+	// Alert if a scanner has not reached its node for this long
+	ScannerStaleWait time.Duration `mapstructure:"scanner_stale_wait"`
+	// Alert if the hot wallet balance is below this amount of SKY
+	MinHotWalletBalance string `mapstructure:"min_hot_wallet_balance"`
+	// Alert if fewer deposit addresses than this are left for an enabled coin type
+	MinAddresses uint64 `mapstructure:"min_addresses"`
+	// Alert if a deposit has been processing without a status change for this long
+	StuckDepositWait time.Duration `mapstructure:"stuck_deposit_wait"`
+
+	SMTP    AlertSMTP    `mapstructure:"smtp"`
+	Webhook AlertWebhook `mapstructure:"webhook"`
+	Command AlertCommand `mapstructure:"command"`
+}
+
+// AlertSMTP config for sending alerts by email. Disabled if Host is empty.
+type AlertSMTP struct {
+	// SMTP server host:port. STARTTLS is used if the server supports it.
+	Host string `mapstructure:"host"`
+	// Credentials for PLAIN authentication, which is skipped if Username is empty
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	From     string        `mapstructure:"from"`
+	To       []string      `mapstructure:"to"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// AlertWebhook config for posting alerts as JSON to a URL. Disabled if URL is empty.
+type AlertWebhook struct {
+	URL string `mapstructure:"url"`
+	// Key the requests are signed with, using HMAC-SHA256. Requests are not signed if empty.
+	Secret  string        `mapstructure:"secret"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// AlertCommand config for running a local command for each alert, with the alert as JSON on stdin.
+// Disabled if Path is empty.
+type AlertCommand struct {
+	Path    string        `mapstructure:"path"`
+	Args    []string      `mapstructure:"args"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Enabled returns true if any notifier is configured
+func (c Alerts) Enabled() bool {
+	return c.SMTP.Host != "" || c.Webhook.URL != "" || c.Command.Path != ""
+}
+
+// Validate validates the Alerts config
+func (c Alerts) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	if c.CheckWait <= 0 {
+		return errors.New("alerts.check_wait must be positive")
+	}
+
+	if c.RepeatWait <= 0 {
+		return errors.New("alerts.repeat_wait must be positive")
+	}
+
+	if c.MaxPerHour <= 0 {
+		return errors.New("alerts.max_per_hour must be positive")
+	}
+
+	if c.MaxScannerLag < 0 {
+		return errors.New("alerts.max_scanner_lag can't be negative")
+	}
+
+	if c.ScannerStaleWait < 0 {
+		return errors.New("alerts.scanner_stale_wait can't be negative")
+	}
+
+	if c.MinHotWalletBalance != "" {
+		if _, err := droplet.FromString(c.MinHotWalletBalance); err != nil {
+			return fmt.Errorf("alerts.min_hot_wallet_balance invalid: %v", err)
+		}
+	}
+
+	if c.StuckDepositWait < 0 {
+		return errors.New("alerts.stuck_deposit_wait can't be negative")
+	}
+
+	if c.SMTP.Host != "" {
+		if _, _, err := net.SplitHostPort(c.SMTP.Host); err != nil {
+			return fmt.Errorf("alerts.smtp.host invalid: %v", err)
+		}
+
+		if c.SMTP.From == "" {
+			return errors.New("alerts.smtp.from missing")
+		}
+
+		if len(c.SMTP.To) == 0 {
+			return errors.New("alerts.smtp.to missing")
+		}
+
+		if c.SMTP.Timeout <= 0 {
+			return errors.New("alerts.smtp.timeout must be positive")
+		}
+	}
+
+	if c.Webhook.URL != "" {
+		u, err := url.Parse(c.Webhook.URL)
+		if err != nil {
+			return fmt.Errorf("alerts.webhook.url invalid: %v", err)
+		}
+
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("alerts.webhook.url must be an http or https URL")
+		}
+
+		if c.Webhook.Timeout <= 0 {
+			return errors.New("alerts.webhook.timeout must be positive")
+		}
+	}
+
+	if c.Command.Path != "" && c.Command.Timeout <= 0 {
+		return errors.New("alerts.command.timeout must be positive")
+	}
+
+	return nil
+}
+
+const (
+	// StorageBolt keeps all data in the bolt database
+	StorageBolt = "bolt"
+	// StorageSQLite3 keeps the exchange, scanner, used addresses and webhook data in a SQLite database
+	StorageSQLite3 = "sqlite3"
+	// StoragePostgres keeps the exchange, scanner, used addresses and webhook data in a PostgreSQL database
+	StoragePostgres = "postgres"
+)
+
+// Storage config for the database of the exchange, scanner, used addresses and webhook delivery.
+// The deny lists and the teller-signer records are always kept in the bolt database.
+type Storage struct {
+	// Storage backend, "bolt", "sqlite3" or "postgres". Empty is "bolt".
+	Backend string `mapstructure:"backend"`
+	// Data source name of the SQL database.
+	// For sqlite3, the path of the database file, relative to the data directory if not absolute.
+	// For postgres, a connection URL or key=value connection string.
+	DSN string `mapstructure:"dsn"`
+}
+
+// IsSQL returns true if the storage backend is a SQL database
+func (c Storage) IsSQL() bool {
+	return c.Backend == StorageSQLite3 || c.Backend == StoragePostgres
+}
+
+// Validate validates the storage config
+func (c Storage) Validate() error {
+	switch c.Backend {
+	case "", StorageBolt:
+	case StorageSQLite3, StoragePostgres:
+		if c.DSN == "" {
+			return errors.New("storage.dsn missing")
+		}
+	default:
+		return fmt.Errorf("storage.backend must be one of \"%s\", \"%s\" or \"%s\"", StorageBolt, StorageSQLite3, StoragePostgres)
+	}
+
+	return nil
 }
 
 // Dummy config for the fake sender and scanner
@@ -359,6 +1231,30 @@ func (c Config) Redacted() Config {
 		c.SkyExchanger.C2CX.Secret = redacted
 	}
 
+	if len(c.Webhooks.Endpoints) != 0 {
+		endpoints := make([]WebhookEndpoint, len(c.Webhooks.Endpoints))
+		copy(endpoints, c.Webhooks.Endpoints)
+		for i := range endpoints {
+			if endpoints[i].Secret != "" {
+				endpoints[i].Secret = redacted
+			}
+		}
+		c.Webhooks.Endpoints = endpoints
+	}
+
+	if c.Alerts.SMTP.Password != "" {
+		c.Alerts.SMTP.Password = redacted
+	}
+
+	if c.Alerts.Webhook.Secret != "" {
+		c.Alerts.Webhook.Secret = redacted
+	}
+
+	// A PostgreSQL DSN may include the password
+	if c.Storage.Backend == StoragePostgres && c.Storage.DSN != "" {
+		c.Storage.DSN = redacted
+	}
+
 	return c
 }
 
@@ -450,6 +1346,8 @@ func (c Config) Validate() error {
 		oops("sky_scanner.initial_scan_height must be >= 0")
 	}
 
+	// Hybrid deposits of other coin types are always bought directly,
+	// so the scanner restriction only applies to passthrough
 	if c.SkyExchanger.BuyMethod == BuyMethodPassthrough {
 		if c.EthScanner.Enabled {
 			oops("eth_scanner must be disabled for buy_method passthrough")
@@ -459,6 +1357,15 @@ func (c Config) Validate() error {
 		}
 	}
 
+	if err := c.Coin.Validate(); err != nil {
+		oops(err.Error())
+	}
+
+	// The sky scanner watches the node at sky_rpc.address, which is the configured coin's node
+	if c.SkyScanner.Enabled && c.Coin.Name != fiber.Skycoin.Name {
+		oops(fmt.Sprintf("sky_scanner must be disabled if coin.name is not %s", fiber.Skycoin.Name))
+	}
+
 	exchangeErrs := c.SkyExchanger.validate()
 	for _, err := range exchangeErrs {
 		oops(err.Error())
@@ -475,6 +1382,26 @@ func (c Config) Validate() error {
 		oops(err.Error())
 	}
 
+	if _, err := c.AdminPanel.Credentials(); err != nil {
+		oops(err.Error())
+	}
+
+	if err := c.Screening.Validate(); err != nil {
+		oops(err.Error())
+	}
+
+	if err := c.Webhooks.Validate(); err != nil {
+		oops(err.Error())
+	}
+
+	if err := c.Alerts.Validate(); err != nil {
+		oops(err.Error())
+	}
+
+	if err := c.Storage.Validate(); err != nil {
+		oops(err.Error())
+	}
+
 	if len(errs) == 0 {
 		return nil
 	}
@@ -488,10 +1415,17 @@ func setDefaults() {
 	viper.SetDefault("logfile", "./teller.log")
 	viper.SetDefault("dbfile", "teller.db")
 
+	// Storage
+	viper.SetDefault("storage.backend", StorageBolt)
+
 	// Teller
 	viper.SetDefault("teller.max_bound_btc_addrs", 5)
 	viper.SetDefault("teller.bind_enabled", true)
 
+	// Coin
+	viper.SetDefault("coin.name", fiber.Skycoin.Name)
+	viper.SetDefault("coin.max_droplet_precision", fiber.Skycoin.MaxDropletPrecision)
+
 	// SkyRPC
 	viper.SetDefault("sky_rpc.address", "127.0.0.1:6430")
 
@@ -518,6 +1452,7 @@ func setDefaults() {
 
 	// SkyExchanger
 	viper.SetDefault("sky_exchanger.tx_confirmation_check_wait", time.Second*5)
+	viper.SetDefault("sky_exchanger.tx_rebroadcast_timeout", time.Minute*10)
 	viper.SetDefault("sky_exchanger.max_decimals", 3)
 	viper.SetDefault("sky_exchanger.buy_method", BuyMethodDirect)
 
@@ -530,6 +1465,19 @@ func setDefaults() {
 	viper.SetDefault("sky_exchanger.c2cx.request_failure_wait", time.Second*10)
 	viper.SetDefault("sky_exchanger.c2cx.ratelimit_wait", time.Second*30)
 	viper.SetDefault("sky_exchanger.c2cx.check_order_wait", time.Second*2)
+	viper.SetDefault("sky_exchanger.c2cx.pass_fees_to_user", false)
+
+	// Hybrid
+	viper.SetDefault("sky_exchanger.hybrid.balance_check_wait", time.Second*10)
+	viper.SetDefault("sky_exchanger.hybrid.replenish_wait", time.Hour)
+	viper.SetDefault("sky_exchanger.retry.max_attempts", 5)
+	viper.SetDefault("sky_exchanger.retry.initial_wait", time.Minute)
+	viper.SetDefault("sky_exchanger.retry.max_wait", time.Hour)
+	viper.SetDefault("sky_exchanger.retry.check_wait", time.Second*10)
+	viper.SetDefault("sky_exchanger.hot_wallet.check_wait", time.Second*30)
+	viper.SetDefault("sky_exchanger.hot_wallet.bound_address_window", time.Hour*24)
+	viper.SetDefault("sky_exchanger.sweep.check_wait", time.Minute*10)
+	viper.SetDefault("sky_exchanger.signer.timeout", time.Second*30)
 
 	// Web
 	viper.SetDefault("web.send_enabled", true)
@@ -542,6 +1490,29 @@ func setDefaults() {
 	// AdminPanel
 	viper.SetDefault("admin_panel.host", "127.0.0.1:7711")
 
+	// Screening
+	viper.SetDefault("screening.reload_wait", time.Minute)
+
+	// Webhooks
+	viper.SetDefault("webhooks.timeout", time.Second*10)
+	viper.SetDefault("webhooks.max_attempts", 10)
+	viper.SetDefault("webhooks.initial_wait", time.Second*10)
+	viper.SetDefault("webhooks.max_wait", time.Hour)
+	viper.SetDefault("webhooks.check_wait", time.Second*5)
+	viper.SetDefault("webhooks.retention", time.Hour*24*7)
+
+	// Alerts
+	viper.SetDefault("alerts.check_wait", time.Minute)
+	viper.SetDefault("alerts.repeat_wait", time.Hour)
+	viper.SetDefault("alerts.max_per_hour", 20)
+	viper.SetDefault("alerts.max_scanner_lag", int64(0))
+	viper.SetDefault("alerts.scanner_stale_wait", time.Minute*30)
+	viper.SetDefault("alerts.min_addresses", uint64(0))
+	viper.SetDefault("alerts.stuck_deposit_wait", time.Hour*2)
+	viper.SetDefault("alerts.smtp.timeout", time.Second*30)
+	viper.SetDefault("alerts.webhook.timeout", time.Second*10)
+	viper.SetDefault("alerts.command.timeout", time.Second*30)
+
 	// DummySender
 	viper.SetDefault("dummy.http_addr", "127.0.0.1:4121")
 	viper.SetDefault("dummy.scanner", false)
@@ -572,6 +1543,8 @@ func Load(configName, appDir string) (Config, error) {
 		return cfg, err
 	}
 
+	cfg.SkyExchanger.Coin = cfg.Coin
+
 	if err := cfg.Validate(); err != nil {
 		return cfg, err
 	}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ReloadableKeys are the settings that can be changed by reloading the config while running.
+// A key ending in "." covers all the settings under it.
+// Changes to any other setting need a restart.
+var ReloadableKeys = []string{
+	"btc_addresses",
+	"eth_addresses",
+	"sky_addresses",
+	"teller.bind_enabled",
+	"sky_exchanger.sky_btc_exchange_rate",
+	"sky_exchanger.sky_eth_exchange_rate",
+	"sky_exchanger.sky_sky_exchange_rate",
+	"sky_exchanger.send_enabled",
+	"sky_exchanger.limits.",
+	"web.throttle_max",
+	"web.throttle_duration",
+	"web.cors_allowed",
+}
+
+// Settings whose values are not shown in a Change
+var redactedKeys = map[string]struct{}{
+	"btc_rpc.user":              {},
+	"btc_rpc.pass":              {},
+	"sky_exchanger.c2cx.key":    {},
+	"sky_exchanger.c2cx.secret": {},
+	"admin_panel.users":         {},
+	"webhooks.endpoints":        {},
+	"alerts.smtp.password":      {},
+	"alerts.webhook.secret":     {},
+	"storage.dsn":               {},
+}
+
+// ReloadRequiresRestart is the reason a change was ignored if its setting can't be reloaded
+const ReloadRequiresRestart = "requires a restart"
+
+// IsReloadable returns true if a setting can be changed by reloading the config
+func IsReloadable(key string) bool {
+	for _, k := range ReloadableKeys {
+		if k == key || (strings.HasSuffix(k, ".") && strings.HasPrefix(key, k)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Change is a setting that differs between two configs
+type Change struct {
+	Key    string `json:"key"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+	Reason string `json:"reason,omitempty"` // Why the change was ignored
+}
+
+// ReloadDiff lists the changes found by reloading the config
+type ReloadDiff struct {
+	Applied []Change `json:"applied"` // Changes applied while running
+	Ignored []Change `json:"ignored"` // Changes that were not applied, which need a restart
+}
+
+// Ignore moves the applied change of key to the ignored changes
+func (d *ReloadDiff) Ignore(key, reason string) {
+	for i, c := range d.Applied {
+		if c.Key != key {
+			continue
+		}
+
+		d.Applied = append(d.Applied[:i], d.Applied[i+1:]...)
+		c.Reason = reason
+		d.Ignored = append(d.Ignored, c)
+		sortChanges(d.Ignored)
+		return
+	}
+}
+
+// Reload returns the config to run with after the config file changed from c to n,
+// which is c with the reloadable settings of n, and the changes that were applied and ignored
+func (c Config) Reload(n Config) (Config, ReloadDiff) {
+	applied := c
+
+	applied.BtcAddresses = n.BtcAddresses
+	applied.EthAddresses = n.EthAddresses
+	applied.SkyAddresses = n.SkyAddresses
+	applied.Teller.BindEnabled = n.Teller.BindEnabled
+	applied.SkyExchanger.SkyBtcExchangeRate = n.SkyExchanger.SkyBtcExchangeRate
+	applied.SkyExchanger.SkyEthExchangeRate = n.SkyExchanger.SkyEthExchangeRate
+	applied.SkyExchanger.SkySkyExchangeRate = n.SkyExchanger.SkySkyExchangeRate
+	applied.SkyExchanger.SendEnabled = n.SkyExchanger.SendEnabled
+	applied.SkyExchanger.Limits = n.SkyExchanger.Limits
+	applied.Web.ThrottleMax = n.Web.ThrottleMax
+	applied.Web.ThrottleDuration = n.Web.ThrottleDuration
+	applied.Web.CORSAllowed = n.Web.CORSAllowed
+
+	diff := ReloadDiff{
+		Applied: []Change{},
+		Ignored: []Change{},
+	}
+
+	for _, ch := range Diff(c, n) {
+		if IsReloadable(ch.Key) {
+			diff.Applied = append(diff.Applied, ch)
+		} else {
+			ch.Reason = ReloadRequiresRestart
+			diff.Ignored = append(diff.Ignored, ch)
+		}
+	}
+
+	return applied, diff
+}
+
+// Diff returns the settings that differ between two configs, sorted by key.
+// Settings that are not parsed from the config file are not compared,
+// and the values of sensitive settings are redacted.
+func Diff(a, b Config) []Change {
+	av := make(map[string]string)
+	bv := make(map[string]string)
+	flatten("", reflect.ValueOf(a), av)
+	flatten("", reflect.ValueOf(b), bv)
+
+	var changes []Change
+	for k, v := range av {
+		if bv[k] == v {
+			continue
+		}
+
+		ch := Change{
+			Key: k,
+			Old: v,
+			New: bv[k],
+		}
+
+		if _, ok := redactedKeys[k]; ok {
+			ch.Old = "<redacted>"
+			ch.New = "<redacted>"
+		}
+
+		changes = append(changes, ch)
+	}
+
+	sortChanges(changes)
+
+	return changes
+}
+
+// flatten records the values of a config struct's settings, keyed by their dotted config file names
+func flatten(prefix string, v reflect.Value, out map[string]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		key := prefix + name
+		fv := v.Field(i)
+
+		if s, ok := fv.Interface().(fmt.Stringer); ok {
+			out[key] = s.String()
+		} else if fv.Kind() == reflect.Struct {
+			flatten(key+".", fv, out)
+		} else {
+			out[key] = fmt.Sprint(fv.Interface())
+		}
+	}
+}
+
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+}
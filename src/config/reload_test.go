@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsReloadable(t *testing.T) {
+	require.True(t, IsReloadable("teller.bind_enabled"))
+	require.True(t, IsReloadable("sky_exchanger.limits.btc_daily"))
+	require.True(t, IsReloadable("web.cors_allowed"))
+
+	require.False(t, IsReloadable("teller.max_bound_addrs"))
+	require.False(t, IsReloadable("sky_exchanger.limits"))
+	require.False(t, IsReloadable("sky_exchanger.risk.btc_max_deposit"))
+	require.False(t, IsReloadable("web.http_addr"))
+}
+
+func TestConfigReload(t *testing.T) {
+	c := Config{
+		BtcAddresses: "btc_addresses.json",
+		Teller: Teller{
+			BindEnabled: true,
+		},
+		BtcRPC: BtcRPC{
+			Pass: "secret",
+		},
+		SkyExchanger: SkyExchanger{
+			SkyBtcExchangeRate: "500",
+			MaxDecimals:        3,
+			SendEnabled:        true,
+		},
+		Web: Web{
+			HTTPAddr:         "127.0.0.1:7071",
+			ThrottleMax:      60,
+			ThrottleDuration: time.Minute,
+		},
+		GitCommit: "abc",
+	}
+
+	applied, diff := c.Reload(c)
+	require.Equal(t, c, applied)
+	require.Empty(t, diff.Applied)
+	require.Empty(t, diff.Ignored)
+
+	n := c
+	n.BtcAddresses = "btc_addresses_2.json"
+	n.Teller.BindEnabled = false
+	n.BtcRPC.Pass = "new secret"
+	n.SkyExchanger.SkyBtcExchangeRate = "600"
+	n.SkyExchanger.MaxDecimals = 2
+	n.SkyExchanger.Limits.BtcDaily = "10"
+	n.Web.HTTPAddr = "127.0.0.1:7072"
+	n.Web.ThrottleDuration = time.Second
+	n.Web.CORSAllowed = []string{"https://example.com"}
+	n.GitCommit = "def"
+
+	applied, diff = c.Reload(n)
+
+	require.Equal(t, []Change{
+		{Key: "btc_addresses", Old: "btc_addresses.json", New: "btc_addresses_2.json"},
+		{Key: "sky_exchanger.limits.btc_daily", Old: "", New: "10"},
+		{Key: "sky_exchanger.sky_btc_exchange_rate", Old: "500", New: "600"},
+		{Key: "teller.bind_enabled", Old: "true", New: "false"},
+		{Key: "web.cors_allowed", Old: "[]", New: "[https://example.com]"},
+		{Key: "web.throttle_duration", Old: "1m0s", New: "1s"},
+	}, diff.Applied)
+
+	require.Equal(t, []Change{
+		{Key: "btc_rpc.pass", Old: "<redacted>", New: "<redacted>", Reason: ReloadRequiresRestart},
+		{Key: "sky_exchanger.max_decimals", Old: "3", New: "2", Reason: ReloadRequiresRestart},
+		{Key: "web.http_addr", Old: "127.0.0.1:7071", New: "127.0.0.1:7072", Reason: ReloadRequiresRestart},
+	}, diff.Ignored)
+
+	// Only the ignored changes remain between the applied config and the new config
+	require.Len(t, Diff(applied, n), len(diff.Ignored))
+	require.Equal(t, c.Web.HTTPAddr, applied.Web.HTTPAddr)
+	require.Equal(t, c.GitCommit, applied.GitCommit)
+
+	diff.Ignore("teller.bind_enabled", "binding can't be disabled")
+	require.Len(t, diff.Applied, 5)
+	require.Equal(t, Change{
+		Key:    "teller.bind_enabled",
+		Old:    "true",
+		New:    "false",
+		Reason: "binding can't be disabled",
+	}, diff.Ignored[2])
+}
@@ -0,0 +1,264 @@
+package exchange
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+var (
+	// ErrBindingPaused is returned when binding while the hot wallet can't cover its obligations and reserve
+	ErrBindingPaused = errors.New("Binding is paused until the hot wallet is topped up")
+)
+
+// HotWalletStatus reports the hot wallet balance against the SKY it owes
+type HotWalletStatus struct {
+	Enabled bool   `json:"enabled"`
+	Balance string `json:"balance"`
+	// SKY owed to deposits that are not sent yet, plus the SKY expected for recently bound addresses without a deposit
+	Obligations string `json:"obligations"`
+	Reserve     string `json:"reserve"`
+	// Binding is paused while the circuit breaker is tripped
+	Tripped   bool  `json:"tripped"`
+	CheckedAt int64 `json:"checked_at"`
+}
+
+// CircuitBreaker periodically compares the hot wallet balance to the SKY owed to deposits.
+// While the balance minus the obligations is below the configured reserve, the breaker is tripped
+// and binding is paused. It resumes once the wallet is topped up.
+type CircuitBreaker struct {
+	log         logrus.FieldLogger
+	cfg         config.HotWallet
+	maxDecimals int
+	fees        config.Fees
+	store       Storer
+	balancer    Balancer
+	reserve     uint64
+	estimate    uint64
+	quit        chan struct{}
+	done        chan struct{}
+	statusLock  sync.RWMutex
+	status      HotWalletStatus
+}
+
+// NewCircuitBreaker creates a CircuitBreaker. It is disabled if cfg.HotWallet.Reserve is empty.
+func NewCircuitBreaker(log logrus.FieldLogger, cfg config.SkyExchanger, store Storer, balancer Balancer) (*CircuitBreaker, error) {
+	b := &CircuitBreaker{
+		log:         log.WithField("prefix", "teller.exchange.breaker"),
+		cfg:         cfg.HotWallet,
+		maxDecimals: cfg.MaxDecimals,
+		fees:        cfg.Fees,
+		store:       store,
+		balancer:    balancer,
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}, 1),
+	}
+
+	if cfg.HotWallet.Reserve == "" {
+		return b, nil
+	}
+
+	var err error
+	b.reserve, err = droplet.FromString(cfg.HotWallet.Reserve)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.HotWallet.BoundAddressEstimate != "" {
+		b.estimate, err = droplet.FromString(cfg.HotWallet.BoundAddressEstimate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b.status = HotWalletStatus{
+		Enabled: true,
+		Reserve: cfg.HotWallet.Reserve,
+	}
+
+	return b, nil
+}
+
+// Run checks the hot wallet balance every cfg.CheckWait
+func (b *CircuitBreaker) Run() error {
+	log := b.log
+	log.Info("Start hot wallet circuit breaker...")
+	defer func() {
+		log.Info("Closed hot wallet circuit breaker")
+		b.done <- struct{}{}
+	}()
+
+	if !b.Status().Enabled {
+		log.Info("Hot wallet circuit breaker is disabled")
+		<-b.quit
+		return nil
+	}
+
+	b.check()
+
+	ticker := time.NewTicker(b.cfg.CheckWait)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.quit:
+			log.Info("quit")
+			return nil
+		case <-ticker.C:
+			b.check()
+		}
+	}
+}
+
+// Shutdown stops the CircuitBreaker
+func (b *CircuitBreaker) Shutdown() {
+	close(b.quit)
+	b.log.Info("Waiting for run to finish")
+	<-b.done
+	b.log.Info("Shutdown complete")
+}
+
+// Status returns the result of the last hot wallet check
+func (b *CircuitBreaker) Status() HotWalletStatus {
+	b.statusLock.RLock()
+	defer b.statusLock.RUnlock()
+	return b.status
+}
+
+// CheckBind returns ErrBindingPaused if the circuit breaker is tripped
+func (b *CircuitBreaker) CheckBind() error {
+	if b.Status().Tripped {
+		return ErrBindingPaused
+	}
+	return nil
+}
+
+// check compares the hot wallet balance minus its obligations to the reserve and
+// trips or resets the breaker. If the balance can't be checked, the breaker is left as it is.
+func (b *CircuitBreaker) check() {
+	log := b.log
+
+	bal, err := b.balancer.Balance()
+	if err != nil {
+		log.WithError(err).Error("Hot wallet balance check failed")
+		return
+	}
+
+	balance, err := droplet.FromString(bal.Coins)
+	if err != nil {
+		log.WithError(err).Error("droplet.FromString failed")
+		return
+	}
+
+	obligations, err := b.obligations()
+	if err != nil {
+		log.WithError(err).Error("obligations failed")
+		return
+	}
+
+	obligationsStr, err := droplet.ToString(obligations)
+	if err != nil {
+		log.WithError(err).Error("droplet.ToString failed")
+		return
+	}
+
+	tripped := obligations > balance || balance-obligations < b.reserve
+
+	b.statusLock.Lock()
+	wasTripped := b.status.Tripped
+	b.status.Balance = bal.Coins
+	b.status.Obligations = obligationsStr
+	b.status.Tripped = tripped
+	b.status.CheckedAt = time.Now().UTC().Unix()
+	b.statusLock.Unlock()
+
+	log = log.WithFields(logrus.Fields{
+		"balance":     bal.Coins,
+		"obligations": obligationsStr,
+		"reserve":     b.cfg.Reserve,
+	})
+
+	switch {
+	case tripped && !wasTripped:
+		log.WithField("notice", logger.WatchNotice).Error("Hot wallet balance minus obligations is below the reserve, binding is paused until the wallet is topped up")
+	case !tripped && wasTripped:
+		log.WithField("notice", logger.WatchNotice).Info("Hot wallet was topped up, binding resumed")
+	}
+}
+
+// obligationStatuses are the statuses of deposits that are owed SKY from the hot wallet
+var obligationStatuses = []string{
+	StatusWaitSend,
+	StatusWaitDecide,
+	StatusWaitApproval,
+	StatusWaitPassthrough,
+	StatusWaitPassthroughOrderComplete,
+}
+
+// depositObligations returns the SKY owed to the deposits that are not sent yet, in droplets.
+// Deposits waiting to be sent count their payout net of fees, the others the SKY owed at their conversion rate.
+// The deposit with ID excludeID is not counted.
+func depositObligations(store Storer, maxDecimals int, fees config.Fees, excludeID string) (uint64, error) {
+	dis, err := store.QueryDepositInfo(DepositQuery{
+		Statuses: obligationStatuses,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var total uint64
+	for _, di := range dis {
+		if di.DepositID == excludeID {
+			continue
+		}
+
+		var amt uint64
+		if di.Status == StatusWaitSend {
+			amt, err = calculateSkyDroplets(di, maxDecimals, fees)
+		} else {
+			amt, err = calculateSkyOwed(di, maxDecimals)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		total += amt
+	}
+
+	return total, nil
+}
+
+// obligations returns the SKY owed to deposits that are not sent yet, plus the SKY expected
+// for each address bound within cfg.BoundAddressWindow that has not received a deposit, in droplets.
+// Addresses bound earlier are assumed to be abandoned.
+func (b *CircuitBreaker) obligations() (uint64, error) {
+	total, err := depositObligations(b.store, b.maxDecimals, b.fees, "")
+	if err != nil {
+		return 0, err
+	}
+
+	if b.estimate == 0 {
+		return total, nil
+	}
+
+	unpaidAddrs, err := b.store.GetUnpaidBindAddresses()
+	if err != nil {
+		return 0, err
+	}
+
+	boundSince := time.Now().UTC().Add(-b.cfg.BoundAddressWindow).Unix()
+	for _, ba := range unpaidAddrs {
+		if ba.BoundAt >= boundSince {
+			total += b.estimate
+		}
+	}
+
+	return total, nil
+}
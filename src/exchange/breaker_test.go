@@ -0,0 +1,195 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func setupCircuitBreaker(t *testing.T, cfg config.HotWallet) (*CircuitBreaker, *Store, *mockBalancer, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	balancer := &mockBalancer{
+		coins: "1000.000000",
+	}
+
+	exchangeCfg := defaultCfg
+	exchangeCfg.HotWallet = cfg
+
+	b, err := NewCircuitBreaker(log, exchangeCfg, store, balancer)
+	require.NoError(t, err)
+
+	return b, store, balancer, shutdown
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b, _, _, shutdown := setupCircuitBreaker(t, config.HotWallet{})
+	defer shutdown()
+
+	require.Equal(t, HotWalletStatus{}, b.Status())
+	require.NoError(t, b.CheckBind())
+
+	go testutil.CheckError(t, b.Run)
+	b.Shutdown()
+
+	require.Equal(t, HotWalletStatus{}, b.Status())
+}
+
+func TestCircuitBreakerObligations(t *testing.T) {
+	b, s, _, shutdown := setupCircuitBreaker(t, config.HotWallet{
+		Reserve:            "100",
+		BoundAddressWindow: time.Hour,
+		CheckWait:          time.Second,
+	})
+	defer shutdown()
+
+	amt, err := b.obligations()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), amt)
+
+	// 1 BTC is 100 SKY at testSkyBtcRate
+	mustAddRiskDepositInfo(t, s, 1, 1e8)
+	amt, err = b.obligations()
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), amt)
+
+	for i, status := range []string{
+		StatusWaitSend,
+		StatusWaitApproval,
+		StatusWaitPassthrough,
+		StatusWaitPassthroughOrderComplete,
+		StatusWaitConfirm,
+		StatusDone,
+		StatusRefundPending,
+	} {
+		di := mustAddRiskDepositInfo(t, s, i+2, 1e8)
+		_, err := s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+			di.Status = status
+			return di
+		})
+		require.NoError(t, err)
+	}
+
+	// Only deposits that are not sent yet are owed
+	amt, err = b.obligations()
+	require.NoError(t, err)
+	require.Equal(t, uint64(500e6), amt)
+
+	// Bound addresses are only counted with bound_address_estimate
+	_, err = s.BindAddress(testSkyAddr, "unpaid-deposit-addr", config.CoinTypeBTC, config.BuyMethodDirect, 0)
+	require.NoError(t, err)
+
+	amt, err = b.obligations()
+	require.NoError(t, err)
+	require.Equal(t, uint64(500e6), amt)
+
+	b.estimate = 50e6
+	amt, err = b.obligations()
+	require.NoError(t, err)
+	require.Equal(t, uint64(550e6), amt)
+
+	// Addresses bound before bound_address_window are not counted
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		ba := BoundAddress{
+			SkyAddress: testSkyAddr,
+			Address:    "abandoned-deposit-addr",
+			CoinType:   config.CoinTypeBTC,
+			BuyMethod:  config.BuyMethodDirect,
+			BoundAt:    time.Now().UTC().Add(-time.Hour * 2).Unix(),
+		}
+		return dbutil.PutBucketValue(tx, MustGetBindAddressBkt(config.CoinTypeBTC), ba.Address, ba)
+	})
+	require.NoError(t, err)
+
+	amt, err = b.obligations()
+	require.NoError(t, err)
+	require.Equal(t, uint64(550e6), amt)
+
+	b.cfg.BoundAddressWindow = time.Hour * 3
+	amt, err = b.obligations()
+	require.NoError(t, err)
+	require.Equal(t, uint64(600e6), amt)
+}
+
+func TestCircuitBreakerCheck(t *testing.T) {
+	b, s, balancer, shutdown := setupCircuitBreaker(t, config.HotWallet{
+		Reserve:   "200",
+		CheckWait: time.Second,
+	})
+	defer shutdown()
+
+	require.Equal(t, HotWalletStatus{
+		Enabled: true,
+		Reserve: "200",
+	}, b.Status())
+
+	mustAddRiskDepositInfo(t, s, 1, 5e8)
+
+	// 1000 SKY less 500 SKY owed is above the reserve
+	b.check()
+	status := b.Status()
+	require.False(t, status.Tripped)
+	require.Equal(t, "1000.000000", status.Balance)
+	require.Equal(t, "500.000000", status.Obligations)
+	require.NotZero(t, status.CheckedAt)
+	require.NoError(t, b.CheckBind())
+
+	// 650 SKY less 500 SKY owed is below the reserve
+	balancer.coins = "650.000000"
+	b.check()
+	require.True(t, b.Status().Tripped)
+	require.Equal(t, ErrBindingPaused, b.CheckBind())
+
+	// The breaker stays tripped if the balance can't be checked
+	balancer.err = errors.New("balance failed")
+	b.check()
+	require.True(t, b.Status().Tripped)
+	require.Equal(t, "650.000000", b.Status().Balance)
+
+	// Owing more than the balance trips the breaker
+	balancer.err = nil
+	balancer.coins = "400.000000"
+	b.check()
+	require.True(t, b.Status().Tripped)
+
+	// Binding resumes once the wallet is topped up
+	balancer.coins = "700.000000"
+	b.check()
+	require.False(t, b.Status().Tripped)
+	require.NoError(t, b.CheckBind())
+}
+
+func TestCircuitBreakerRun(t *testing.T) {
+	b, _, balancer, shutdown := setupCircuitBreaker(t, config.HotWallet{
+		Reserve:   "200",
+		CheckWait: time.Millisecond * 10,
+	})
+	defer shutdown()
+
+	balancer.coins = "100.000000"
+
+	go testutil.CheckError(t, b.Run)
+
+	// The balance is checked when the breaker starts
+	timeout := time.After(time.Second)
+	for !b.Status().Tripped {
+		select {
+		case <-timeout:
+			t.Fatal("Expected the circuit breaker to trip")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	b.Shutdown()
+}
@@ -1,11 +1,16 @@
 package exchange
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/shopspring/decimal"
+
+	"github.com/skycoin/skycoin/src/coin"
+
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/scanner"
 	"github.com/skycoin/teller/src/util/mathutil"
@@ -26,11 +31,24 @@ const (
 	StatusWaitPassthroughOrderComplete = "waiting_passthrough_order_complete"
 	// StatusDone coins sent and confirmed
 	StatusDone = "done"
+	// StatusFailed processing failed and was retried the maximum number of times
+	StatusFailed = "failed"
+	// StatusWaitApproval deposit matched a risk rule and is held for operator approval
+	StatusWaitApproval = "waiting_approval"
+	// StatusRefundPending deposit was rejected and its coins should be refunded
+	StatusRefundPending = "refund_pending"
 	// StatusUnknown fallback value
 	StatusUnknown = "unknown"
 
 	// PassthroughExchangeC2CX for deposits using passthrough to c2cx.com
 	PassthroughExchangeC2CX = "c2cx"
+
+	// TxAttemptPending transaction was broadcast and is waiting to be confirmed
+	TxAttemptPending = "pending"
+	// TxAttemptConfirmed transaction was confirmed
+	TxAttemptConfirmed = "confirmed"
+	// TxAttemptReplaced transaction's inputs were spent by another transaction, so it was replaced
+	TxAttemptReplaced = "replaced"
 )
 
 var (
@@ -46,6 +64,9 @@ var (
 		StatusWaitDecide,
 		StatusWaitPassthrough,
 		StatusWaitPassthroughOrderComplete,
+		StatusFailed,
+		StatusWaitApproval,
+		StatusRefundPending,
 	}
 )
 
@@ -60,30 +81,49 @@ func ValidateStatus(s string) error {
 	return ErrInvalidStatus
 }
 
+// isProcessedStatus returns true if deposits with this status are processed by the exchange.
+// Deposits that are finished or held for an operator are not processed.
+func isProcessedStatus(s string) bool {
+	switch s {
+	case StatusDone, StatusFailed, StatusWaitApproval, StatusRefundPending:
+		return false
+	default:
+		return true
+	}
+}
+
 // BoundAddress records information about an address binding
 type BoundAddress struct {
 	SkyAddress string
 	Address    string
 	CoinType   string
 	BuyMethod  string
+	// Unix time the address was bound. 0 for addresses bound before bind times were recorded.
+	BoundAt int64
+	// Amount the buyer expects to deposit, in the units of DepositInfo.DepositValue. 0 if not given.
+	ExpectedValue int64
 }
 
 // DepositInfo records the deposit info
 type DepositInfo struct {
-	Seq            uint64          `json:"seq"`
-	UpdatedAt      int64           `json:"updated_at"`
-	Status         string          `json:"status"`
-	CoinType       string          `json:"coin_type"`
-	SkyAddress     string          `json:"sky_address"`
-	BuyMethod      string          `json:"buy_method"`
-	DepositAddress string          `json:"deposit_address"`
-	DepositID      string          `json:"deposit_id"`
-	Txid           string          `json:"txid"`
-	ConversionRate string          `json:"conversion_rate"` // SKY per other coin, as a decimal string (allows integers, floats, fractions)
-	DepositValue   int64           `json:"deposit_value"`   // Deposit amount. Should be measured in the smallest unit possible (e.g. satoshis for BTC)
-	SkySent        uint64          `json:"sky_sent"`        // SKY sent, measured in droplets
-	Passthrough    PassthroughData `json:"passthrough"`
-	Error          string          `json:"error"` // An error that occurred during processing
+	Seq             uint64          `json:"seq"`
+	UpdatedAt       int64           `json:"updated_at"`
+	Status          string          `json:"status"`
+	CoinType        string          `json:"coin_type"`
+	SkyAddress      string          `json:"sky_address"`
+	BuyMethod       string          `json:"buy_method"`
+	DepositAddress  string          `json:"deposit_address"`
+	DepositID       string          `json:"deposit_id"`
+	Txid            string          `json:"txid"`
+	ConversionRate  string          `json:"conversion_rate"`  // SKY per other coin, as a decimal string (allows integers, floats, fractions)
+	DepositValue    int64           `json:"deposit_value"`    // Deposit amount. Should be measured in the smallest unit possible (e.g. satoshis for BTC)
+	SourceAddresses []string        `json:"source_addresses"` // Addresses that funded the deposit, if the scanner could resolve them
+	SkySent         uint64          `json:"sky_sent"`         // SKY sent, measured in droplets
+	Payout          PayoutData      `json:"payout"`           // SKY owed before and after the service fee, recorded when the coins are sent
+	Passthrough     PassthroughData `json:"passthrough"`
+	Risk            RiskData        `json:"risk"`
+	TxAttempts      []TxAttempt     `json:"tx_attempts"` // The transactions created to send the coins, oldest first. Txid is the last.
+	Error           string          `json:"error"`       // An error that occurred during processing
 	// The original Deposit is saved for the records, in case there is a mistake.
 	// Do not use this data directly.  All necessary data is copied to the top level
 	// of DepositInfo (e.g. DepositID, DepositAddress, DepositValue, CoinType).
@@ -96,24 +136,164 @@ type PassthroughData struct {
 	SkyBought         uint64           `json:"sky_bought"`
 	DepositValueSpent int64            `json:"deposit_value_spent"`
 	RequestedAmount   string           `json:"requested_amount"`
+	Fee               uint64           `json:"fee"`                // Commission charged by the exchange, measured in droplets
+	FeePassedThrough  bool             `json:"fee_passed_through"` // If true, Fee is deducted from the SKY sent to the user
+	ReferenceSky      uint64           `json:"reference_sky"`      // SKY that DepositValueSpent buys at ConversionRate, measured in droplets
+	Slippage          string           `json:"slippage"`           // (ReferenceSky - SkyBought) / ReferenceSky, as a decimal string
 	Order             PassthroughOrder `json:"order"`
 }
 
+// PayoutData records the service fee deducted from the SKY sent for a deposit.
+// All amounts are measured in droplets.
+type PayoutData struct {
+	Gross uint64 `json:"gross"` // SKY owed before the service fee
+	Fee   uint64 `json:"fee"`   // Service fee
+	Net   uint64 `json:"net"`   // SKY owed after the service fee, which is sent
+}
+
+// RiskData records the risk rule that held a deposit for operator approval
+type RiskData struct {
+	Rule     string `json:"rule"`     // The rule that fired, e.g. "max_deposit"
+	Detail   string `json:"detail"`   // Why the rule fired
+	Approved bool   `json:"approved"` // If true, an operator approved the deposit and the rules are not checked again
+}
+
+// TxAttempt records a skycoin transaction that was broadcast to send a deposit's coins
+type TxAttempt struct {
+	Txid            string `json:"txid"`
+	RawTx           string `json:"raw_tx"` // Hex-encoded serialized transaction, for rebroadcasting
+	Status          string `json:"status"`
+	BroadcastAt     int64  `json:"broadcast_at"`
+	LastBroadcastAt int64  `json:"last_broadcast_at"`
+	Rebroadcasts    int    `json:"rebroadcasts"`
+	ConflictTxid    string `json:"conflict_txid"` // The transaction that spent the inputs of a replaced attempt
+}
+
+func newTxAttempt(tx *coin.Transaction, now int64) TxAttempt {
+	return TxAttempt{
+		Txid:            tx.TxIDHex(),
+		RawTx:           hex.EncodeToString(tx.Serialize()),
+		Status:          TxAttemptPending,
+		BroadcastAt:     now,
+		LastBroadcastAt: now,
+	}
+}
+
+// Transaction returns the deserialized transaction
+func (a TxAttempt) Transaction() (*coin.Transaction, error) {
+	b, err := hex.DecodeString(a.RawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := coin.TransactionDeserialize(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// txAttempt returns the index of the attempt of txid in TxAttempts, or -1 if there is none
+func (di DepositInfo) txAttempt(txid string) int {
+	for i, a := range di.TxAttempts {
+		if a.Txid == txid {
+			return i
+		}
+	}
+	return -1
+}
+
 // PassthroughOrder encapsulates 3rd party exchange order data
 type PassthroughOrder struct {
 	CustomerID      string `json:"customer_id"`
 	OrderID         string `json:"order_id"`
 	CompletedAmount string `json:"completed_amount"`
 	Price           string `json:"price"`
+	Fee             string `json:"fee"`
 	Status          string `json:"status"`
 	Final           bool   `json:"final"`
 	Original        string `json:"original"`
 }
 
+// DepositTransition records a change of a deposit's status, error or buy method
+type DepositTransition struct {
+	Timestamp  int64  `json:"timestamp"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Component  string `json:"component"` // The component that made the change, e.g. "send"
+	Action     string `json:"action"`    // The operator action, if the change was made by an operator
+	Actor      string `json:"actor"`     // The operator who made the change
+	Reason     string `json:"reason"`    // The operator's reason for the change
+	BuyMethod  string `json:"buy_method"`
+	SkyAddress string `json:"sky_address"`
+	Error      string `json:"error"`
+	Txid       string `json:"txid"`
+	OrderID    string `json:"order_id"`
+}
+
+// DepositRetry records a deposit whose processing failed and is waiting to be retried
+type DepositRetry struct {
+	DepositID     string `json:"deposit_id"`
+	Status        string `json:"status"`          // The deposit's status when it failed
+	Component     string `json:"component"`       // The component that failed to process the deposit
+	Attempts      int    `json:"attempts"`        // Number of failed attempts
+	NextAttemptAt int64  `json:"next_attempt_at"` // When to retry, 0 if the deposit has been resubmitted
+	LastError     string `json:"last_error"`
+}
+
 // DepositStats records overall statistics about deposits
 type DepositStats struct {
-	Received map[string]int64 `json:"received"`
-	Sent     int64            `json:"sent"`
+	Received    map[string]int64 `json:"received"`
+	Sent        int64            `json:"sent"`
+	Fees        int64            `json:"fees"` // Service fees deducted from the SKY sent, measured in droplets
+	Passthrough PassthroughStats `json:"passthrough"`
+}
+
+// newDepositStats returns DepositStats with nothing received of every coin type
+func newDepositStats() *DepositStats {
+	received := make(map[string]int64, len(config.CoinTypes))
+	for _, k := range config.CoinTypes {
+		received[k] = 0
+	}
+
+	return &DepositStats{
+		Received: received,
+	}
+}
+
+// add adds a deposit to the statistics
+func (ds *DepositStats) add(dpi DepositInfo) {
+	ds.Received[dpi.CoinType] += dpi.DepositValue
+	ds.Sent += int64(dpi.SkySent)
+	ds.Fees += int64(dpi.Payout.Fee)
+
+	if dpi.BuyMethod == config.BuyMethodPassthrough {
+		ds.Passthrough.SkyBought += int64(dpi.Passthrough.SkyBought)
+		ds.Passthrough.DepositValueSpent += dpi.Passthrough.DepositValueSpent
+		ds.Passthrough.ReferenceSky += int64(dpi.Passthrough.ReferenceSky)
+		if dpi.Passthrough.FeePassedThrough {
+			ds.Passthrough.FeesPassedThrough += int64(dpi.Passthrough.Fee)
+		} else {
+			ds.Passthrough.FeesAbsorbed += int64(dpi.Passthrough.Fee)
+		}
+	}
+}
+
+// PassthroughStats records overall statistics about passthrough orders.
+// SKY amounts are measured in droplets, DepositValueSpent in satoshis.
+type PassthroughStats struct {
+	SkyBought         int64 `json:"sky_bought"`
+	DepositValueSpent int64 `json:"deposit_value_spent"`
+	ReferenceSky      int64 `json:"reference_sky"`
+	FeesAbsorbed      int64 `json:"fees_absorbed"`
+	FeesPassedThrough int64 `json:"fees_passed_through"`
+}
+
+// Slippage returns the volume-weighted slippage of all passthrough orders
+// against their reference rates, as a fraction of the reference amount
+func (s PassthroughStats) Slippage() decimal.Decimal {
+	return calculateSlippage(uint64(s.ReferenceSky), uint64(s.SkyBought))
 }
 
 // ValidateForStatus does a consistency check of the data based upon the Status value
@@ -143,6 +323,13 @@ func (di DepositInfo) ValidateForStatus() error {
 		}
 		switch di.BuyMethod {
 		case config.BuyMethodDirect, config.BuyMethodPassthrough:
+		case config.BuyMethodHybrid:
+			// A hybrid deposit is resolved to direct or passthrough when leaving StatusWaitDecide
+			switch di.Status {
+			case StatusWaitDecide, StatusWaitApproval, StatusRefundPending:
+			default:
+				return errors.New("BuyMethod hybrid is only valid until the deposit is decided")
+			}
 		case "":
 			return errors.New("BuyMethod missing")
 		default:
@@ -153,6 +340,27 @@ func (di DepositInfo) ValidateForStatus() error {
 	}
 
 	switch di.Status {
+	case StatusFailed:
+		if di.Error == "" {
+			return errors.New("Error missing")
+		}
+		if di.DepositID == "" {
+			return errors.New("DepositID missing")
+		}
+		return nil
+
+	case StatusWaitApproval:
+		if di.Risk.Rule == "" {
+			return errors.New("Risk.Rule missing")
+		}
+		return checkWaitSend()
+
+	case StatusRefundPending:
+		if di.Txid != "" {
+			return errors.New("Txid set, coins were already sent")
+		}
+		return checkWaitSend()
+
 	case StatusDone:
 		if di.Error != ErrEmptySendAmount.Error() && di.Txid == "" {
 			return errors.New("Txid missing")
@@ -0,0 +1,97 @@
+package exchange
+
+import (
+	"encoding/binary"
+)
+
+// DepositQuery selects deposits through the deposit indexes.
+// Zero fields do not restrict the deposits selected.
+type DepositQuery struct {
+	Statuses    []string // Deposits with any of these statuses
+	CoinType    string
+	Errored     bool  // Deposits with an error
+	UpdatedFrom int64 // Deposits last updated at or after this time
+	UpdatedTo   int64 // Deposits last updated at or before this time
+}
+
+// Matches returns true if the query selects di
+func (q DepositQuery) Matches(di DepositInfo) bool {
+	if len(q.Statuses) != 0 {
+		found := false
+		for _, s := range q.Statuses {
+			if di.Status == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if q.CoinType != "" && di.CoinType != q.CoinType {
+		return false
+	}
+
+	if q.Errored && di.Error == "" {
+		return false
+	}
+
+	if q.UpdatedFrom != 0 && di.UpdatedAt < q.UpdatedFrom {
+		return false
+	}
+
+	if q.UpdatedTo != 0 && di.UpdatedAt > q.UpdatedTo {
+		return false
+	}
+
+	return true
+}
+
+// depositIndexEntry is the key of a deposit in an index bucket
+type depositIndexEntry struct {
+	bkt []byte
+	key []byte
+}
+
+// depositIndexEntries returns the index keys of a deposit
+func depositIndexEntries(di DepositInfo) []depositIndexEntry {
+	entries := []depositIndexEntry{
+		{DepositStatusIndexBkt, depositPrefixIndexKey(di.Status, di.DepositID)},
+		{DepositUpdatedIndexBkt, depositUpdatedIndexKey(di.UpdatedAt, di.DepositID)},
+		{DepositCoinTypeIndexBkt, depositPrefixIndexKey(di.CoinType, di.DepositID)},
+	}
+
+	if di.Error != "" {
+		entries = append(entries, depositIndexEntry{DepositErrorIndexBkt, []byte(di.DepositID)})
+	}
+
+	return entries
+}
+
+// depositPrefixIndexPrefix returns the prefix of the keys of the deposits indexed under value
+func depositPrefixIndexPrefix(value string) []byte {
+	return []byte(value + "/")
+}
+
+// depositPrefixIndexKey returns the key of a deposit indexed under value, e.g. its status
+func depositPrefixIndexKey(value, depositID string) []byte {
+	return append(depositPrefixIndexPrefix(value), depositID...)
+}
+
+// depositUpdatedIndexKey returns the key of a deposit indexed by its update time.
+// The time is big-endian, so that the keys are sorted by time.
+func depositUpdatedIndexKey(updatedAt int64, depositID string) []byte {
+	if updatedAt < 0 {
+		updatedAt = 0
+	}
+
+	key := make([]byte, 8, 8+len(depositID))
+	binary.BigEndian.PutUint64(key, uint64(updatedAt))
+	return append(key, depositID...)
+}
+
+// parseDepositUpdatedIndexKey returns the update time and DepositID of a depositUpdatedIndexKey
+func parseDepositUpdatedIndexKey(key []byte) (int64, string) {
+	return int64(binary.BigEndian.Uint64(key[:8])), string(key[8:])
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/skycoin/teller/src/config"
-	"github.com/skycoin/teller/src/util/logger"
 )
 
 // Processor is a component that processes deposits from a Receiver and sends them to a Sender
@@ -32,6 +31,7 @@ type DirectBuy struct {
 	done       chan struct{}
 	statusLock sync.RWMutex
 	status     error
+	failer     DepositFailer // Handles deposits that failed processing
 }
 
 // NewDirectBuy creates DirectBuy
@@ -43,7 +43,7 @@ func NewDirectBuy(log logrus.FieldLogger, cfg config.SkyExchanger, store Storer,
 	return &DirectBuy{
 		log:      log.WithField("prefix", "teller.exchange.directbuy"),
 		cfg:      cfg,
-		store:    store,
+		store:    withComponent(store, "directbuy"),
 		receiver: receiver,
 		deposits: make(chan DepositInfo, 100),
 		quit:     make(chan struct{}),
@@ -85,11 +85,8 @@ func (p *DirectBuy) runUpdateStatus() {
 			updatedDeposit, err := p.updateStatus(d)
 			p.setStatus(err)
 			if err != nil {
-				msg := "updateStatus failed. This deposit will not be reprocessed until teller is restarted."
-				log.WithFields(logrus.Fields{
-					"depositInfo": d,
-					"notice":      logger.WatchNotice,
-				}).WithError(err).Error(msg)
+				log.WithField("depositInfo", d).WithError(err).Error("updateStatus failed")
+				failDeposit(log, p.failer, "directbuy", d, err)
 				continue
 			}
 
@@ -8,6 +8,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/skycoin/skycoin/src/api/cli"
+	"github.com/skycoin/skycoin/src/util/droplet"
 
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/scanner"
@@ -16,6 +17,7 @@ import (
 
 const (
 	txConfirmationCheckWait = time.Second * 3
+	txRebroadcastTimeout    = time.Minute * 10
 )
 
 var (
@@ -30,6 +32,10 @@ var (
 	ErrDepositStatusInvalid = errors.New("Deposit status cannot be handled")
 	// ErrNoBoundAddress is returned if no skycoin address is bound to a deposit's address
 	ErrNoBoundAddress = errors.New("Deposit has no bound skycoin address")
+	// ErrDepositChanged is returned when a queued deposit was changed by an operator before it was processed
+	ErrDepositChanged = errors.New("Deposit was changed while queued for processing")
+	// ErrSendHalted is returned when a deposit would be sent while sending is halted
+	ErrSendHalted = errors.New("Sending is halted")
 )
 
 // DepositFilter filters deposits
@@ -43,15 +49,21 @@ type Runner interface {
 
 // Exchanger provides APIs to interact with the exchange service
 type Exchanger interface {
-	BindAddress(skyAddr, depositAddr, coinType string) (*BoundAddress, error)
+	BindAddress(skyAddr, depositAddr, coinType string, expectedValue int64) (*BoundAddress, error)
 	GetDepositStatuses(skyAddr string) ([]DepositStatus, error)
 	GetDeposits(flt DepositFilter) ([]DepositInfo, error)
+	QueryDeposits(q DepositQuery) ([]DepositInfo, error)
 	GetBindNum(skyAddr string) (int, error)
 	GetDepositStats() (*DepositStats, error)
 	SenderStatus() error
 	ProcessorStatus() error
 	Balance() (*cli.Balance, error)
 	ErroredDeposits() ([]DepositInfo, error)
+	GetDepositHistory(depositID string) ([]DepositTransition, error)
+	CheckBindLimits(skyAddr, coinType string) error
+	SaleCap() (*SaleCap, error)
+	HotWalletStatus() HotWalletStatus
+	PauseStatus() PauseStatus
 }
 
 // Exchange encompasses an entire coin<>skycoin deposit-process-send flow
@@ -59,12 +71,20 @@ type Exchange struct {
 	log   logrus.FieldLogger
 	store Storer
 	cfg   config.SkyExchanger
+	risk  *riskRules
 	quit  chan struct{}
 	done  chan struct{}
 
-	Receiver  ReceiveRunner
-	Processor ProcessRunner
-	Sender    SendRunner
+	pauses    *pauses
+	pauseLock sync.Mutex  // Only one pause change is applied at a time
+	live      *liveConfig // Settings that can be changed by reloading the config
+
+	Receiver   ReceiveRunner
+	Processor  ProcessRunner
+	Sender     SendRunner
+	Retrier    *Retrier
+	Breaker    *CircuitBreaker
+	Reconciler *Reconciler
 }
 
 // NewDirectExchange creates an Exchange which performs "direct buy", i.e. directly selling from a local skycoin wallet
@@ -92,7 +112,7 @@ func NewDirectExchange(log logrus.FieldLogger, cfg config.SkyExchanger, store St
 		return nil, err
 	}
 
-	return &Exchange{
+	e := &Exchange{
 		log:       log.WithField("prefix", "teller.exchange.exchange"),
 		store:     store,
 		cfg:       cfg,
@@ -101,7 +121,34 @@ func NewDirectExchange(log logrus.FieldLogger, cfg config.SkyExchanger, store St
 		Receiver:  receiver,
 		Processor: processor,
 		Sender:    sender,
-	}, nil
+	}
+
+	e.Retrier = NewRetrier(log, cfg.Retry, store, e.resubmit)
+	receiver.failer = e.Retrier
+	e.risk = receiver.risk
+	processor.failer = e.Retrier
+	sender.failer = e.Retrier
+
+	e.Breaker, err = NewCircuitBreaker(log, cfg, store, sender)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Reconciler = NewReconciler(log, cfg, store, coinSender, sender)
+
+	e.pauses, err = newPauses(store)
+	if err != nil {
+		return nil, err
+	}
+	receiver.pauses = e.pauses
+	sender.pauses = e.pauses
+
+	e.live = newLiveConfig(cfg)
+	receiver.live = e.live
+	receiver.risk.live = e.live
+	sender.live = e.live
+
+	return e, nil
 }
 
 // NewPassthroughExchange creates an Exchange which performs "passthrough buy",
@@ -130,7 +177,7 @@ func NewPassthroughExchange(log logrus.FieldLogger, cfg config.SkyExchanger, sto
 		return nil, err
 	}
 
-	return &Exchange{
+	e := &Exchange{
 		log:       log.WithField("prefix", "teller.exchange.exchange"),
 		store:     store,
 		cfg:       cfg,
@@ -139,7 +186,107 @@ func NewPassthroughExchange(log logrus.FieldLogger, cfg config.SkyExchanger, sto
 		Receiver:  receiver,
 		Processor: processor,
 		Sender:    sender,
-	}, nil
+	}
+
+	e.Retrier = NewRetrier(log, cfg.Retry, store, e.resubmit)
+	receiver.failer = e.Retrier
+	e.risk = receiver.risk
+	processor.failer = e.Retrier
+	sender.failer = e.Retrier
+
+	e.Breaker, err = NewCircuitBreaker(log, cfg, store, sender)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Reconciler = NewReconciler(log, cfg, store, coinSender, sender)
+
+	e.pauses, err = newPauses(store)
+	if err != nil {
+		return nil, err
+	}
+	receiver.pauses = e.pauses
+	sender.pauses = e.pauses
+
+	e.live = newLiveConfig(cfg)
+	receiver.live = e.live
+	receiver.risk.live = e.live
+	sender.live = e.live
+
+	return e, nil
+}
+
+// NewHybridExchange creates an Exchange which performs "hybrid buy",
+// i.e. it sends directly from a local skycoin wallet if the wallet can cover the deposit,
+// otherwise it purchases coins from an exchange before sending from the wallet
+func NewHybridExchange(log logrus.FieldLogger, cfg config.SkyExchanger, store Storer, multiplexer *scanner.Multiplexer, coinSender sender.Sender) (*Exchange, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.BuyMethod != config.BuyMethodHybrid {
+		return nil, config.ErrInvalidBuyMethod
+	}
+
+	receiver, err := NewReceive(log, cfg, store, multiplexer)
+	if err != nil {
+		return nil, err
+	}
+
+	processor, err := NewHybrid(log, cfg, store, receiver, coinSender)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := NewSend(log, cfg, store, coinSender, processor)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Exchange{
+		log:       log.WithField("prefix", "teller.exchange.exchange"),
+		store:     store,
+		cfg:       cfg,
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}, 1),
+		Receiver:  receiver,
+		Processor: processor,
+		Sender:    sender,
+	}
+
+	e.Retrier = NewRetrier(log, cfg.Retry, store, e.resubmit)
+	receiver.failer = e.Retrier
+	e.risk = receiver.risk
+	processor.failer = e.Retrier
+	sender.failer = e.Retrier
+	processor.passthrough.failer = e.Retrier
+
+	e.Breaker, err = NewCircuitBreaker(log, cfg, store, sender)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Reconciler = NewReconciler(log, cfg, store, coinSender, sender)
+
+	e.pauses, err = newPauses(store)
+	if err != nil {
+		return nil, err
+	}
+	receiver.pauses = e.pauses
+	sender.pauses = e.pauses
+
+	e.live = newLiveConfig(cfg)
+	receiver.live = e.live
+	receiver.risk.live = e.live
+	sender.live = e.live
+
+	return e, nil
+}
+
+// SetAddressScreener sets the screener that received deposits are checked against.
+// It must be called before Run.
+func (e *Exchange) SetAddressScreener(s AddressScreener) {
+	e.risk.screener = s
 }
 
 // Run runs all components of the Exchange
@@ -154,7 +301,10 @@ func (e *Exchange) Run() error {
 	// Create channels for linking two components, initialize the components with the channels
 	// Close them to teardown
 
-	errC := make(chan error, 3)
+	// Nothing is sent until the deposits are reconciled against the blockchain
+	e.Reconciler.haltUntilReconciled()
+
+	errC := make(chan error, 6)
 	var wg sync.WaitGroup
 
 	wg.Add(1)
@@ -184,6 +334,33 @@ func (e *Exchange) Run() error {
 		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := e.Retrier.Run(); err != nil {
+			e.log.WithError(err).Error("Retrier.Run failed")
+			errC <- err
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := e.Breaker.Run(); err != nil {
+			e.log.WithError(err).Error("Breaker.Run failed")
+			errC <- err
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := e.Reconciler.Run(); err != nil {
+			e.log.WithError(err).Error("Reconciler.Run failed")
+			errC <- err
+		}
+	}()
+
 	var err error
 	select {
 	case <-e.quit:
@@ -206,6 +383,9 @@ func (e *Exchange) Shutdown() {
 	e.Receiver.Shutdown()
 	e.Processor.Shutdown()
 	e.Sender.Shutdown()
+	e.Retrier.Shutdown()
+	e.Breaker.Shutdown()
+	e.Reconciler.Shutdown()
 
 	e.log.Info("Waiting for run to finish")
 	<-e.done
@@ -214,10 +394,25 @@ func (e *Exchange) Shutdown() {
 
 // DepositStatus json struct for deposit status
 type DepositStatus struct {
-	Seq       uint64 `json:"seq"`
-	UpdatedAt int64  `json:"updated_at"`
+	Seq       uint64               `json:"seq"`
+	UpdatedAt int64                `json:"updated_at"`
+	Status    string               `json:"status"`
+	CoinType  string               `json:"coin_type"`
+	Payout    *DepositStatusPayout `json:"payout,omitempty"` // Set once the coins are sent
+	History   []DepositStatusStep  `json:"history"`
+}
+
+// DepositStatusPayout json struct for the SKY sent for a deposit, before and after the service fee
+type DepositStatusPayout struct {
+	Gross string `json:"gross"`
+	Fee   string `json:"fee"`
+	Net   string `json:"net"`
+}
+
+// DepositStatusStep json struct for a status reached by a deposit, a summary of a DepositTransition
+type DepositStatusStep struct {
 	Status    string `json:"status"`
-	CoinType  string `json:"coin_type"`
+	UpdatedAt int64  `json:"updated_at"`
 }
 
 // GetDepositStatuses returns DepositStatus array of given skycoin address
@@ -229,21 +424,90 @@ func (e *Exchange) GetDepositStatuses(skyAddr string) ([]DepositStatus, error) {
 
 	dss := make([]DepositStatus, 0, len(dis))
 	for _, di := range dis {
+		// StatusWaitDeposit entries are placeholders for bound addresses without a deposit
+		var history []DepositTransition
+		if di.DepositID != "" {
+			history, err = e.store.GetDepositHistory(di.DepositID)
+			if err != nil {
+				return []DepositStatus{}, err
+			}
+		}
+
+		var payout *DepositStatusPayout
+		if di.Payout != (PayoutData{}) {
+			payout, err = newDepositStatusPayout(di.Payout)
+			if err != nil {
+				return []DepositStatus{}, err
+			}
+		}
+
 		dss = append(dss, DepositStatus{
 			Seq:       di.Seq,
 			UpdatedAt: di.UpdatedAt,
 			Status:    di.Status,
 			CoinType:  di.CoinType,
+			Payout:    payout,
+			History:   summarizeDepositHistory(history),
 		})
 	}
 	return dss, nil
 }
 
+func newDepositStatusPayout(p PayoutData) (*DepositStatusPayout, error) {
+	gross, err := droplet.ToString(p.Gross)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, err := droplet.ToString(p.Fee)
+	if err != nil {
+		return nil, err
+	}
+
+	net, err := droplet.ToString(p.Net)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DepositStatusPayout{
+		Gross: gross,
+		Fee:   fee,
+		Net:   net,
+	}, nil
+}
+
+// summarizeDepositHistory returns the statuses reached by a deposit, omitting
+// transitions that did not change the status
+func summarizeDepositHistory(history []DepositTransition) []DepositStatusStep {
+	steps := make([]DepositStatusStep, 0, len(history))
+	for _, t := range history {
+		if t.FromStatus == t.ToStatus {
+			continue
+		}
+
+		steps = append(steps, DepositStatusStep{
+			Status:    t.ToStatus,
+			UpdatedAt: t.Timestamp,
+		})
+	}
+	return steps
+}
+
+// GetDepositHistory returns the status transitions of a deposit
+func (e *Exchange) GetDepositHistory(depositID string) ([]DepositTransition, error) {
+	return e.store.GetDepositHistory(depositID)
+}
+
 // GetDeposits returns deposit status details
 func (e *Exchange) GetDeposits(flt DepositFilter) ([]DepositInfo, error) {
 	return e.store.GetDepositInfoArray(flt)
 }
 
+// QueryDeposits returns the deposits selected by a query, looked up through the deposit indexes
+func (e *Exchange) QueryDeposits(q DepositQuery) ([]DepositInfo, error) {
+	return e.store.QueryDepositInfo(q)
+}
+
 // GetBindNum returns the number of btc/eth address the given sky address binded
 func (e *Exchange) GetBindNum(skyAddr string) (int, error) {
 	addrs, err := e.store.GetSkyBindAddresses(skyAddr)
@@ -255,6 +519,23 @@ func (e *Exchange) GetDepositStats() (*DepositStats, error) {
 	return e.store.GetDepositStats()
 }
 
+// GetJournalEntries returns the ledger's journal entries timestamped between from and to inclusive, oldest first.
+// A zero from or to is unbounded.
+func (e *Exchange) GetJournalEntries(from, to int64) ([]JournalEntry, error) {
+	return e.store.GetJournalEntries(from, to)
+}
+
+// GetLedgerBalances returns the balance of every ledger account as of asOf, or the current balances if asOf is zero
+func (e *Exchange) GetLedgerBalances(asOf int64) (LedgerBalances, error) {
+	return e.store.GetLedgerBalances(asOf)
+}
+
+// GetStatsPeriods returns the deposit statistics of an interval's periods that start between from and to inclusive,
+// oldest first. A zero from or to is unbounded.
+func (e *Exchange) GetStatsPeriods(interval string, from, to int64) ([]StatsPeriod, error) {
+	return e.store.GetStatsPeriods(interval, from, to)
+}
+
 // Balance returns the number of coins left in the OTC wallet
 func (e *Exchange) Balance() (*cli.Balance, error) {
 	return e.Sender.Balance()
@@ -272,8 +553,8 @@ func (e *Exchange) ProcessorStatus() error {
 
 // ErroredDeposits returns deposits with an error status
 func (e *Exchange) ErroredDeposits() ([]DepositInfo, error) {
-	deposits, err := e.store.GetDepositInfoArray(func(di DepositInfo) bool {
-		return di.Error != ""
+	deposits, err := e.store.QueryDepositInfo(DepositQuery{
+		Errored: true,
 	})
 	if err != nil {
 		return nil, err
@@ -282,10 +563,48 @@ func (e *Exchange) ErroredDeposits() ([]DepositInfo, error) {
 	return deposits, nil
 }
 
+// CheckBindLimits returns an error if binding a skycoin address for a coin type
+// is refused by a volume limit
+func (e *Exchange) CheckBindLimits(skyAddr, coinType string) error {
+	return e.risk.checkBindLimits(skyAddr, coinType, time.Now().UTC())
+}
+
+// SaleCap returns the SKY sold against the sale cap
+func (e *Exchange) SaleCap() (*SaleCap, error) {
+	return e.risk.saleCap()
+}
+
+// HotWalletStatus returns the hot wallet balance against the SKY it owes,
+// and whether binding is paused because of it
+func (e *Exchange) HotWalletStatus() HotWalletStatus {
+	return e.Breaker.Status()
+}
+
+// PauseStatus returns which parts of the exchange are paused by an operator
+func (e *Exchange) PauseStatus() PauseStatus {
+	return e.pauses.Status()
+}
+
+// GetPauseChanges returns the record of operators pausing and resuming parts of the exchange, oldest first
+func (e *Exchange) GetPauseChanges() ([]PauseChange, error) {
+	return e.store.GetPauseChanges()
+}
+
+// Reconcile reconciles the deposits against the hot wallet transactions on the blockchain.
+// Sending is halted while it runs, and stays halted if it finds issues it can't resolve.
+func (e *Exchange) Reconcile() (*ReconcileReport, error) {
+	return e.Reconciler.Reconcile()
+}
+
+// ReconcileReport returns the last reconciliation report, or nil if reconciliation has not run
+func (e *Exchange) ReconcileReport() *ReconcileReport {
+	return e.Reconciler.Report()
+}
+
 // BindAddress binds deposit address with skycoin address, and
 // add the btc/eth address to scan service, when detect deposit coin
 // to the btc/eth address, will send specific skycoin to the binded
 // skycoin address
-func (e *Exchange) BindAddress(skyAddr, depositAddr, coinType string) (*BoundAddress, error) {
-	return e.Receiver.BindAddress(skyAddr, depositAddr, coinType, e.cfg.BuyMethod)
+func (e *Exchange) BindAddress(skyAddr, depositAddr, coinType string, expectedValue int64) (*BoundAddress, error) {
+	return e.Receiver.BindAddress(skyAddr, depositAddr, coinType, e.cfg.BuyMethod, expectedValue)
 }
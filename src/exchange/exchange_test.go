@@ -21,6 +21,7 @@ import (
 	"github.com/skycoin/skycoin/src/coin"
 
 	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/fiber"
 	"github.com/skycoin/teller/src/scanner"
 	"github.com/skycoin/teller/src/sender"
 	"github.com/skycoin/teller/src/util/testutil"
@@ -34,6 +35,12 @@ type dummySender struct {
 	txidConfirmMap          map[string]bool
 	changeAddr              string
 	changeCoins             uint64
+	walletHistory           sender.WalletHistory
+	walletHistoryErr        error
+	inputs                  []cipher.SHA256   // Inputs of created transactions
+	inputSpends             map[string]string // Txids of the transactions that spent inputs
+	rebroadcastErr          error
+	rebroadcasts            []string
 }
 
 func newDummySender() *dummySender {
@@ -53,6 +60,7 @@ func (s *dummySender) CreateTransaction(destAddr string, coins uint64) (*coin.Tr
 	changeAddr := cipher.MustDecodeBase58Address(s.changeAddr)
 
 	return &coin.Transaction{
+		In: s.inputs,
 		Out: []coin.TransactionOutput{
 			{
 				Address: changeAddr,
@@ -85,6 +93,27 @@ func (s *dummySender) BroadcastTransaction(tx *coin.Transaction) *sender.Broadca
 	}
 }
 
+func (s *dummySender) RebroadcastTransaction(tx *coin.Transaction) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.rebroadcasts = append(s.rebroadcasts, tx.TxIDHex())
+	return s.rebroadcastErr
+}
+
+func (s *dummySender) InputSpends(uxids []string) (map[string]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	spends := make(map[string]string)
+	for _, uxid := range uxids {
+		if txid, ok := s.inputSpends[uxid]; ok {
+			spends[uxid] = txid
+		}
+	}
+	return spends, nil
+}
+
 func (s *dummySender) IsTxConfirmed(txid string) *sender.ConfirmResponse {
 	s.RLock()
 	defer s.RUnlock()
@@ -120,6 +149,33 @@ func (s *dummySender) setTxConfirmed(txid string) {
 	s.txidConfirmMap[txid] = true
 }
 
+func (s *dummySender) WalletHistory(pending []string) (*sender.WalletHistory, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.walletHistoryErr != nil {
+		return nil, s.walletHistoryErr
+	}
+
+	history := s.walletHistory
+	return &history, nil
+}
+
+// requireTxAttempts checks that a sent deposit's only transaction attempt is its Txid, with status.
+// It returns the deposit's attempts, to compare the rest of the deposit.
+func requireTxAttempts(t *testing.T, di DepositInfo, status string) []TxAttempt {
+	require.Len(t, di.TxAttempts, 1)
+	require.Equal(t, di.Txid, di.TxAttempts[0].Txid)
+	require.Equal(t, status, di.TxAttempts[0].Status)
+	require.NotEmpty(t, di.TxAttempts[0].BroadcastAt)
+
+	tx, err := di.TxAttempts[0].Transaction()
+	require.NoError(t, err)
+	require.Equal(t, di.Txid, tx.TxIDHex())
+
+	return di.TxAttempts
+}
+
 func (s *dummySender) Balance() (*cli.Balance, error) {
 	return &cli.Balance{
 		Coins: "100.000000",
@@ -180,6 +236,7 @@ var (
 		SkyBtcExchangeRate:      testSkyBtcRate,
 		SkyEthExchangeRate:      testSkyEthRate,
 		SkySkyExchangeRate:      testSkySkyRate,
+		Coin:                    fiber.Skycoin,
 		TxConfirmationCheckWait: time.Millisecond * 100,
 		Wallet:                  testWalletFile,
 		SendEnabled:             true,
@@ -253,6 +310,15 @@ func runExchangeMockStore(t *testing.T, buyMethod string) (*Exchange, func(), *l
 	store := &MockStore{}
 	log, hook := testutil.NewLogger(t)
 
+	// The startup reconciliation finds nothing to reconcile
+	store.On("QueryDepositInfo", mock.MatchedBy(func(q DepositQuery) bool {
+		return q.Matches(DepositInfo{Status: StatusDone, Txid: "txid"})
+	})).Return(nil, nil).Once()
+	store.On("GetBindAddresses").Return(nil, nil).Once()
+
+	// Nothing is paused
+	store.On("GetPauseChanges").Return(nil, nil).Once()
+
 	bscr := newDummyScanner()
 	escr := newDummyScanner()
 	multiplexer := scanner.NewMultiplexer(log)
@@ -377,7 +443,7 @@ func TestExchangeRunSend(t *testing.T) {
 	go func() {
 		defer close(done)
 		for range time.Tick(dbCheckWaitTime) {
-			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 			require.NoError(t, err)
 
 			if di.Status == StatusWaitConfirm {
@@ -393,7 +459,7 @@ func TestExchangeRunSend(t *testing.T) {
 	}
 
 	// Check DepositInfo
-	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 
 	require.NotEmpty(t, di.UpdatedAt)
@@ -402,12 +468,14 @@ func TestExchangeRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       config.CoinTypeBTC,
 		UpdatedAt:      di.UpdatedAt,
+		TxAttempts:     requireTxAttempts(t, di, TxAttemptPending),
 		Status:         StatusWaitConfirm,
 		SkyAddress:     skyAddr,
 		DepositAddress: dn.Deposit.Address,
 		DepositID:      dn.Deposit.ID(),
 		Txid:           txid,
 		SkySent:        100e6,
+		Payout:         PayoutData{Gross: 100e6, Net: 100e6},
 		BuyMethod:      config.BuyMethodDirect,
 		ConversionRate: testSkyBtcRate,
 		DepositValue:   dn.Deposit.Value,
@@ -424,7 +492,7 @@ func TestExchangeRunSend(t *testing.T) {
 	go func() {
 		defer close(done)
 		for range time.Tick(dbCheckWaitTime) {
-			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 			require.NoError(t, err)
 
 			if di.Status == StatusDone {
@@ -442,7 +510,7 @@ func TestExchangeRunSend(t *testing.T) {
 	checkExchangerStatus(t, e, nil)
 
 	// Check DepositInfo
-	di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	di, err = e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 
 	require.NotEmpty(t, di.UpdatedAt)
@@ -451,12 +519,14 @@ func TestExchangeRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       config.CoinTypeBTC,
 		UpdatedAt:      di.UpdatedAt,
+		TxAttempts:     requireTxAttempts(t, di, TxAttemptConfirmed),
 		Status:         StatusDone,
 		SkyAddress:     skyAddr,
 		DepositAddress: dn.Deposit.Address,
 		DepositID:      dn.Deposit.ID(),
 		Txid:           txid,
 		SkySent:        100e6,
+		Payout:         PayoutData{Gross: 100e6, Net: 100e6},
 		BuyMethod:      config.BuyMethodDirect,
 		ConversionRate: testSkyBtcRate,
 		DepositValue:   dn.Deposit.Value,
@@ -509,7 +579,7 @@ func TestExchangeUpdateBroadcastTxFailure(t *testing.T) {
 
 	// Check the DepositInfo in the database
 	// Sky should not be sent
-	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 	require.NotEmpty(t, di.UpdatedAt)
 	require.Equal(t, DepositInfo{
@@ -567,7 +637,7 @@ func TestExchangeCreateTxFailure(t *testing.T) {
 	checkExchangerStatus(t, e, createTransactionErr)
 
 	// Check the DepositInfo in the database
-	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 	require.NotEmpty(t, di.UpdatedAt)
 	require.Equal(t, DepositInfo{
@@ -633,7 +703,7 @@ func TestExchangeTxConfirmFailure(t *testing.T) {
 		defer close(done)
 		for range time.Tick(dbCheckWaitTime) {
 			// Check the DepositInfo in the database
-			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 			require.NoError(t, err)
 
 			if di.Status == StatusWaitConfirm {
@@ -648,18 +718,20 @@ func TestExchangeTxConfirmFailure(t *testing.T) {
 		t.Fatal("Waiting to check for StatusWaitSend deposits timed out")
 	}
 
-	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 	require.NotEmpty(t, di.UpdatedAt)
 	require.Equal(t, DepositInfo{
 		Seq:            1,
 		CoinType:       config.CoinTypeBTC,
 		UpdatedAt:      di.UpdatedAt,
+		TxAttempts:     requireTxAttempts(t, di, TxAttemptPending),
 		SkyAddress:     skyAddr,
 		DepositAddress: btcAddr,
 		DepositID:      dn.Deposit.ID(),
 		Txid:           txid,
 		SkySent:        100e6,
+		Payout:         PayoutData{Gross: 100e6, Net: 100e6},
 		DepositValue:   dn.Deposit.Value,
 		BuyMethod:      config.BuyMethodDirect,
 		Status:         StatusWaitConfirm,
@@ -712,6 +784,7 @@ func TestExchangeQuitBeforeConfirm(t *testing.T) {
 		DepositID:      dn.Deposit.ID(),
 		Txid:           txid,
 		SkySent:        100e6,
+		Payout:         PayoutData{Gross: 100e6, Net: 100e6},
 		BuyMethod:      config.BuyMethodDirect,
 		DepositValue:   dn.Deposit.Value,
 		ConversionRate: testSkyBtcRate,
@@ -723,7 +796,7 @@ func TestExchangeQuitBeforeConfirm(t *testing.T) {
 	go func() {
 		defer close(done)
 		for range time.Tick(dbCheckWaitTime) {
-			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 			require.NoError(t, err)
 
 			if di.Status != expectedDeposit.Status {
@@ -734,6 +807,7 @@ func TestExchangeQuitBeforeConfirm(t *testing.T) {
 
 			ed := expectedDeposit
 			ed.UpdatedAt = di.UpdatedAt
+			ed.TxAttempts = requireTxAttempts(t, di, TxAttemptPending)
 
 			require.Equal(t, ed, di)
 			return
@@ -748,12 +822,13 @@ func TestExchangeQuitBeforeConfirm(t *testing.T) {
 
 	e.Shutdown()
 
-	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 
 	require.NotEmpty(t, di.UpdatedAt)
 	ed := expectedDeposit
 	ed.UpdatedAt = di.UpdatedAt
+	ed.TxAttempts = requireTxAttempts(t, di, TxAttemptPending)
 
 	require.Equal(t, ed, di)
 }
@@ -813,7 +888,7 @@ func TestExchangeSendZeroCoins(t *testing.T) {
 	go func() {
 		defer close(done)
 		for range time.Tick(dbCheckWaitTime) {
-			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 			require.NoError(t, err)
 
 			if di.Status != expectedDeposit.Status {
@@ -838,7 +913,7 @@ func TestExchangeSendZeroCoins(t *testing.T) {
 
 	e.Shutdown()
 
-	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 
 	require.NotEmpty(t, di.UpdatedAt)
@@ -933,6 +1008,12 @@ func testExchangeRunProcessDepositBacklog(t *testing.T, dis []DepositInfo, confi
 			expectedDis[i].SkySent = amt
 		}
 
+		// Deposits sent by the exchange record their transaction
+		if di.Status != StatusWaitConfirm {
+			expectedDis[i].TxAttempts = requireTxAttempts(t, confirmed[i], TxAttemptConfirmed)
+			expectedDis[i].Payout = PayoutData{Gross: expectedDis[i].SkySent, Net: expectedDis[i].SkySent}
+		}
+
 		require.NotEmpty(t, confirmed[i].UpdatedAt)
 		expectedDis[i].UpdatedAt = confirmed[i].UpdatedAt
 
@@ -1058,7 +1139,7 @@ func TestExchangeProcessWaitSendDeposits(t *testing.T) {
 	}
 
 	testExchangeRunProcessDepositBacklog(t, dis, func(e *Exchange, di DepositInfo) {
-		boundAddr, err := e.store.BindAddress(di.SkyAddress, di.DepositAddress, di.CoinType, di.BuyMethod)
+		boundAddr, err := e.store.BindAddress(di.SkyAddress, di.DepositAddress, di.CoinType, di.BuyMethod, 0)
 		require.NoError(t, err)
 		require.Equal(t, di.SkyAddress, boundAddr.SkyAddress)
 		require.Equal(t, di.DepositAddress, boundAddr.Address)
@@ -1130,7 +1211,7 @@ func TestExchangeProcessWaitDecideDeposits(t *testing.T) {
 	}
 
 	testExchangeRunProcessDepositBacklog(t, dis, func(e *Exchange, di DepositInfo) {
-		boundAddr, err := e.store.BindAddress(di.SkyAddress, di.DepositAddress, di.CoinType, di.BuyMethod)
+		boundAddr, err := e.store.BindAddress(di.SkyAddress, di.DepositAddress, di.CoinType, di.BuyMethod, 0)
 		require.NoError(t, err)
 		require.Equal(t, di.SkyAddress, boundAddr.SkyAddress)
 		require.Equal(t, di.DepositAddress, boundAddr.Address)
@@ -1174,10 +1255,8 @@ func TestExchangeSaveIncomingDepositCreateDepositFailed(t *testing.T) {
 
 	// Configure database mocks
 
-	// GetDepositInfoArray is called twice on startup
-	e.store.(*MockStore).On("GetDepositInfoArray", mock.MatchedBy(func(filt DepositFilter) bool {
-		return true
-	})).Return(nil, nil).Times(3)
+	// QueryDepositInfo is called by each component on startup
+	e.store.(*MockStore).On("QueryDepositInfo", mock.Anything).Return(nil, nil).Times(3)
 
 	// Return error on GetOrCreateDepositInfo
 	createDepositErr := errors.New("GetOrCreateDepositInfo failed")
@@ -1189,11 +1268,20 @@ func TestExchangeSaveIncomingDepositCreateDepositFailed(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, createDepositErr, err)
 
-	// Check that we logged the failed save, so that we can recover it later
-	logEntry := hook.LastEntry()
-	require.Equal(t, logEntry.Message, "saveIncomingDeposit failed. This deposit will not be reprocessed until teller is restarted.")
-	loggedDeposit := logEntry.Data["deposit"].(scanner.Deposit)
-	require.Equal(t, dn.Deposit, loggedDeposit)
+	// Check that we logged the failed save, so that we can recover it later.
+	// Other goroutines log concurrently, so the entry is not necessarily the last one.
+	foundMsg := false
+	for _, e := range hook.AllEntries() {
+		if e.Message != "saveIncomingDeposit failed. This deposit will not be reprocessed until teller is restarted." {
+			continue
+		}
+		foundMsg = true
+		loggedDeposit, ok := e.Data["deposit"].(scanner.Deposit)
+		require.True(t, ok)
+		require.Equal(t, dn.Deposit, loggedDeposit)
+	}
+
+	require.True(t, foundMsg)
 }
 
 func TestExchangeProcessWaitSendDepositFailed(t *testing.T) {
@@ -1226,10 +1314,8 @@ func TestExchangeProcessWaitSendDepositFailed(t *testing.T) {
 
 	// Configure database mocks
 
-	// GetDepositInfoArray is called twice on startup
-	e.store.(*MockStore).On("GetDepositInfoArray", mock.MatchedBy(func(filt DepositFilter) bool {
-		return true
-	})).Return(nil, nil).Times(3)
+	// QueryDepositInfo is called by each component on startup
+	e.store.(*MockStore).On("QueryDepositInfo", mock.Anything).Return(nil, nil).Times(3)
 
 	// GetBindAddress returns a bound address
 	e.store.(*MockStore).On("GetBindAddress", btcAddr).Return(skyAddr, nil)
@@ -1286,7 +1372,7 @@ func TestExchangeProcessWaitSendDepositFailed(t *testing.T) {
 			continue
 		}
 		foundMsg = true
-		require.Equal(t, "updateStatus failed. This deposit will not be reprocessed until teller is restarted.", e.Message)
+		require.Equal(t, "updateStatus failed", e.Message)
 		loggedDepositInfo, ok := e.Data["depositInfo"].(DepositInfo)
 		require.True(t, ok)
 		require.Equal(t, di, loggedDepositInfo)
@@ -1323,11 +1409,20 @@ func TestExchangeProcessWaitSendNoSkyAddrBound(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, err, ErrNoBoundAddress)
 
-	// Check that we logged the failed save, so that we can recover it later
-	logEntry := hook.LastEntry()
-	require.Equal(t, logEntry.Message, "saveIncomingDeposit failed. This deposit will not be reprocessed until teller is restarted.")
-	loggedDeposit := logEntry.Data["deposit"].(scanner.Deposit)
-	require.Equal(t, dn.Deposit, loggedDeposit)
+	// Check that we logged the failed save, so that we can recover it later.
+	// Other goroutines log concurrently, so the entry is not necessarily the last one.
+	foundMsg := false
+	for _, e := range hook.AllEntries() {
+		if e.Message != "saveIncomingDeposit failed. This deposit will not be reprocessed until teller is restarted." {
+			continue
+		}
+		foundMsg = true
+		loggedDeposit, ok := e.Data["deposit"].(scanner.Deposit)
+		require.True(t, ok)
+		require.Equal(t, dn.Deposit, loggedDeposit)
+	}
+
+	require.True(t, foundMsg)
 }
 
 func TestExchangeBindAddress(t *testing.T) {
@@ -1347,7 +1442,7 @@ func TestExchangeBindAddress(t *testing.T) {
 
 	require.Len(t, dummyScanner.addrs, 0)
 
-	boundAddr, err := s.BindAddress("a", "b", config.CoinTypeBTC)
+	boundAddr, err := s.BindAddress("a", "b", config.CoinTypeBTC, 0)
 	require.NoError(t, err)
 	require.Equal(t, "a", boundAddr.SkyAddress)
 	require.Equal(t, "b", boundAddr.Address)
@@ -1359,12 +1454,13 @@ func TestExchangeBindAddress(t *testing.T) {
 	// Should be in the store
 	skyAddr, err := s.store.GetBindAddress("b", config.CoinTypeBTC)
 	require.NoError(t, err)
-	require.Equal(t, &BoundAddress{
+	require.NotNil(t, skyAddr)
+	require.Equal(t, BoundAddress{
 		SkyAddress: "a",
 		Address:    "b",
 		CoinType:   config.CoinTypeBTC,
 		BuyMethod:  config.BuyMethodDirect,
-	}, skyAddr)
+	}, requireBoundNow(t, *skyAddr))
 }
 
 func TestExchangeCreateTransaction(t *testing.T) {
@@ -1372,7 +1468,9 @@ func TestExchangeCreateTransaction(t *testing.T) {
 	cfg.SkyBtcExchangeRate = "111"
 
 	log, _ := testutil.NewLogger(t)
-	s, err := NewDirectExchange(log, cfg, nil, nil, newDummySender())
+	store := &MockStore{}
+	store.On("GetPauseChanges").Return(nil, nil)
+	s, err := NewDirectExchange(log, cfg, store, nil, newDummySender())
 	require.NoError(t, err)
 
 	// Create transaction with no SkyAddress
@@ -1384,7 +1482,7 @@ func TestExchangeCreateTransaction(t *testing.T) {
 		BuyMethod:      config.BuyMethodDirect,
 	}
 
-	_, err = s.Sender.(*Send).createTransaction(di)
+	_, _, err = s.Sender.(*Send).createTransaction(di)
 	require.Equal(t, ErrNoBoundAddress, err)
 
 	// Create transaction with no coins sent, due to a very low DepositValue
@@ -1395,7 +1493,7 @@ func TestExchangeCreateTransaction(t *testing.T) {
 		ConversionRate: "100",
 		BuyMethod:      config.BuyMethodDirect,
 	}
-	_, err = s.Sender.(*Send).createTransaction(di)
+	_, _, err = s.Sender.(*Send).createTransaction(di)
 	require.Equal(t, ErrEmptySendAmount, err)
 
 	// Create valid transaction
@@ -1410,7 +1508,7 @@ func TestExchangeCreateTransaction(t *testing.T) {
 	// that the DepositInfo's ConversionRate is used instead of cfg.SkyBtcExchangeRate
 	require.NotEqual(t, s.cfg.SkyBtcExchangeRate, di.ConversionRate)
 
-	tx, err := s.Sender.(*Send).createTransaction(di)
+	tx, _, err := s.Sender.(*Send).createTransaction(di)
 	require.NoError(t, err)
 	// Should have one output for destination and one for change
 	require.Len(t, tx.Out, 2)
@@ -1447,12 +1545,12 @@ func TestExchangeGetDepositStatuses(t *testing.T) {
 
 	require.Len(t, dummyScanner.addrs, 0)
 
-	boundAddr, err := s.BindAddress("a", "b", config.CoinTypeBTC)
+	boundAddr, err := s.BindAddress("a", "b", config.CoinTypeBTC, 0)
 	require.NoError(t, err)
 	require.Equal(t, "a", boundAddr.SkyAddress)
 	require.Equal(t, "b", boundAddr.Address)
 
-	boundAddr, err = s.BindAddress("a", "e", config.CoinTypeETH)
+	boundAddr, err = s.BindAddress("a", "e", config.CoinTypeETH, 0)
 	require.NoError(t, err)
 	require.Equal(t, "a", boundAddr.SkyAddress)
 	require.Equal(t, "e", boundAddr.Address)
@@ -1478,6 +1576,66 @@ func TestExchangeGetDepositStatuses(t *testing.T) {
 	require.Equal(t, config.CoinTypeETH, depositInfo.CoinType)
 	require.Equal(t, StatusWaitDeposit, depositInfo.Status)
 	require.NotEmpty(t, depositInfo.UpdatedAt)
+
+	// Addresses without a deposit have no history
+	statuses, err := s.GetDepositStatuses("a")
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	for _, st := range statuses {
+		require.Equal(t, StatusWaitDeposit, st.Status)
+		require.Empty(t, st.History)
+	}
+
+	// A deposit's history is summarised by the statuses it reached
+	di, err := store.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: config.CoinTypeBTC,
+		Address:  "b",
+		Value:    1e6,
+		Height:   400000,
+		Tx:       "btc-tx",
+		N:        1,
+	}, testSkyBtcRate)
+	require.NoError(t, err)
+
+	_, err = store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Error = "temporary failure"
+		return di
+	})
+	require.NoError(t, err)
+
+	history, err := s.GetDepositHistory(di.DepositID)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+
+	statuses, err = s.GetDepositStatuses("a")
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+
+	var found bool
+	for _, st := range statuses {
+		if st.Status != StatusWaitSend {
+			continue
+		}
+
+		found = true
+		require.Equal(t, []DepositStatusStep{
+			{
+				Status:    StatusWaitDecide,
+				UpdatedAt: history[0].Timestamp,
+			},
+			{
+				Status:    StatusWaitSend,
+				UpdatedAt: history[1].Timestamp,
+			},
+		}, st.History)
+	}
+	require.True(t, found)
 }
 
 func TestExchangeGetDeposits(t *testing.T) {
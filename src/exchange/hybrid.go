@@ -0,0 +1,424 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/exchange-api/exchange/c2cx"
+
+	"github.com/skycoin/skycoin/src/api/cli"
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+/*
+
+Hybrid decides how to buy the coins for each deposit while it is in StatusWaitDecide.
+
+If the hot wallet's spendable balance, net of the SKY already owed to deposits
+waiting to be sent, can cover the deposit, the deposit is sent directly like DirectBuy.
+Otherwise the deposit is handed to an embedded Passthrough, which buys the coins from c2cx.com first.
+
+The decision is recorded by replacing the deposit's BuyMethod "hybrid" with "direct" or "passthrough".
+
+*/
+
+var errBalanceCheck = errors.New("Hot wallet balance check failed")
+
+// Balancer reports the spendable balance of the hot wallet
+type Balancer interface {
+	Balance() (*cli.Balance, error)
+}
+
+// Hybrid implements a Processor. Deposits are sent directly from the hot wallet
+// when it can cover them, otherwise they are bought from c2cx.com first.
+type Hybrid struct {
+	log                 logrus.FieldLogger
+	cfg                 config.SkyExchanger
+	receiver            Receiver
+	store               Storer
+	balancer            Balancer
+	passthrough         *Passthrough
+	passthroughDeposits chan DepositInfo
+	deposits            chan DepositInfo
+	quit                chan struct{}
+	done                chan struct{}
+	statusLock          sync.RWMutex
+	status              error
+	failer              DepositFailer // Handles deposits that failed processing
+
+	replenishThreshold uint64
+	replenishAmount    decimal.Decimal
+	lastReplenish      time.Time
+}
+
+// hybridReceiver feeds the deposits routed to passthrough into the embedded Passthrough
+type hybridReceiver struct {
+	deposits chan DepositInfo
+}
+
+// Deposits returns a channel of deposits routed to passthrough
+func (r hybridReceiver) Deposits() <-chan DepositInfo {
+	return r.deposits
+}
+
+// BindAddress is not supported, addresses are bound by the Hybrid's own Receiver
+func (r hybridReceiver) BindAddress(skyAddr, depositAddr, coinType, buyMethod string, expectedValue int64) (*BoundAddress, error) {
+	return nil, errors.New("hybridReceiver does not bind addresses")
+}
+
+// NewHybrid creates Hybrid
+func NewHybrid(log logrus.FieldLogger, cfg config.SkyExchanger, store Storer, receiver Receiver, balancer Balancer) (*Hybrid, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Hybrid.BalanceCheckWait == 0 {
+		cfg.Hybrid.BalanceCheckWait = time.Second * 10
+	}
+
+	var replenishThreshold uint64
+	var replenishAmount decimal.Decimal
+	if cfg.Hybrid.ReplenishThreshold != "" {
+		var err error
+		replenishThreshold, err = droplet.FromString(cfg.Hybrid.ReplenishThreshold)
+		if err != nil {
+			return nil, err
+		}
+
+		replenishAmount, err = decimal.NewFromString(cfg.Hybrid.ReplenishBtcAmount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	passthroughDeposits := make(chan DepositInfo, 100)
+
+	passthrough, err := NewPassthrough(log, cfg, store, hybridReceiver{
+		deposits: passthroughDeposits,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Hybrid{
+		log:                 log.WithField("prefix", "teller.exchange.hybrid"),
+		cfg:                 cfg,
+		store:               withComponent(store, "hybrid"),
+		receiver:            receiver,
+		balancer:            balancer,
+		passthrough:         passthrough,
+		passthroughDeposits: passthroughDeposits,
+		deposits:            make(chan DepositInfo, 100),
+		quit:                make(chan struct{}),
+		done:                make(chan struct{}, 1),
+		replenishThreshold:  replenishThreshold,
+		replenishAmount:     replenishAmount,
+	}, nil
+}
+
+// Run begins the Hybrid service and its embedded Passthrough
+func (h *Hybrid) Run() error {
+	log := h.log
+	log.Info("Start hybrid buy service...")
+	defer func() {
+		log.Info("Closed hybrid buy service")
+		h.done <- struct{}{}
+	}()
+
+	errC := make(chan error, 1)
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := h.passthrough.Run(); err != nil {
+			log.WithError(err).Error("Passthrough.Run failed")
+			errC <- err
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.runDecide()
+	}()
+
+	// Merge the passthrough's completed deposits into deposits
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.receivePassthroughDeposits()
+	}()
+
+	var err error
+	select {
+	case <-h.quit:
+	case err = <-errC:
+		log.WithError(err).Error("Terminating early")
+		return err
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// runDecide reads deposits from the Receiver and routes them to direct send or passthrough
+func (h *Hybrid) runDecide() {
+	log := h.log.WithField("goroutine", "runDecide")
+	for {
+		select {
+		case <-h.quit:
+			log.Info("quit")
+			return
+		case d := <-h.receiver.Deposits():
+			h.processDeposit(d)
+		}
+	}
+}
+
+func (h *Hybrid) receivePassthroughDeposits() {
+	log := h.log.WithField("goroutine", "receivePassthroughDeposits")
+	for {
+		select {
+		case <-h.quit:
+			log.Info("quit")
+			return
+		case d := <-h.passthrough.Deposits():
+			log.WithField("depositInfo", d).Info("Received deposit from passthrough")
+			h.deposits <- d
+		}
+	}
+}
+
+// Shutdown stops a previous call to Run
+func (h *Hybrid) Shutdown() {
+	h.log.Info("Shutting down Hybrid")
+	close(h.quit)
+	h.passthrough.Shutdown()
+	h.log.Info("Waiting for run to finish")
+	<-h.done
+	h.log.Info("Shutdown complete")
+}
+
+// Deposits returns a channel of processed deposits
+func (h *Hybrid) Deposits() <-chan DepositInfo {
+	return h.deposits
+}
+
+// Resubmit queues a passthrough deposit changed by an operator for processing
+func (h *Hybrid) Resubmit(di DepositInfo) error {
+	return h.passthrough.Resubmit(di)
+}
+
+// processDeposit routes a deposit, retrying if the hot wallet balance could not be checked
+func (h *Hybrid) processDeposit(di DepositInfo) {
+	log := h.log.WithField("depositInfo", di)
+
+	for {
+		err := h.routeDeposit(di)
+		h.setStatus(err)
+
+		switch err {
+		case nil:
+			return
+		case errQuit:
+			return
+		case errBalanceCheck:
+			log.WithError(err).Error("routeDeposit failed, retrying")
+			select {
+			case <-time.After(h.cfg.Hybrid.BalanceCheckWait):
+			case <-h.quit:
+				return
+			}
+		default:
+			log.WithError(err).Error("routeDeposit failed")
+			failDeposit(log, h.failer, "hybrid", di, err)
+			return
+		}
+	}
+}
+
+// routeDeposit decides the buy method of a StatusWaitDecide deposit if it is "hybrid",
+// then sends it to the Sender directly or through passthrough.
+// Deposits that were already decided before a restart keep their buy method.
+func (h *Hybrid) routeDeposit(di DepositInfo) error {
+	log := h.log.WithField("depositInfo", di)
+
+	if di.BuyMethod == config.BuyMethodHybrid {
+		buyMethod, available, err := h.decideBuyMethod(di)
+		if err != nil {
+			log.WithError(err).Error("decideBuyMethod failed")
+			return err
+		}
+
+		log = log.WithField("buyMethod", buyMethod)
+		log.Info("Decided buy method")
+
+		di, err = h.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+			di.BuyMethod = buyMethod
+			return di
+		})
+		if err != nil {
+			log.WithError(err).Error("UpdateDepositInfo set BuyMethod failed")
+			return err
+		}
+
+		h.replenish(available)
+	}
+
+	switch di.BuyMethod {
+	case config.BuyMethodDirect:
+		di, err := h.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+			di.Status = StatusWaitSend
+			return di
+		})
+		if err != nil {
+			log.WithError(err).Error("UpdateDepositInfo set StatusWaitSend failed")
+			return err
+		}
+
+		select {
+		case <-h.quit:
+			return errQuit
+		case h.deposits <- di:
+		}
+
+	case config.BuyMethodPassthrough:
+		select {
+		case <-h.quit:
+			return errQuit
+		case h.passthroughDeposits <- di:
+		}
+
+	default:
+		log.WithError(config.ErrInvalidBuyMethod).Error()
+		return config.ErrInvalidBuyMethod
+	}
+
+	return nil
+}
+
+// decideBuyMethod returns BuyMethodDirect if the hot wallet can cover the deposit,
+// otherwise BuyMethodPassthrough. Only BTC deposits can be bought through passthrough,
+// other coin types are always sent directly.
+// It also returns the SKY that will be available in the hot wallet once the deposit is decided.
+func (h *Hybrid) decideBuyMethod(di DepositInfo) (string, uint64, error) {
+	log := h.log.WithField("depositInfo", di)
+
+	required, err := calculateDirectSkyDroplets(di, h.cfg.MaxDecimals)
+	if err != nil {
+		log.WithError(err).Error("calculateDirectSkyDroplets failed")
+		return "", 0, err
+	}
+
+	available, err := h.availableSky(di.DepositID)
+	if err != nil {
+		log.WithError(err).Error("availableSky failed")
+		return "", 0, errBalanceCheck
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"required":  required,
+		"available": available,
+	})
+
+	if required <= available {
+		return config.BuyMethodDirect, available - required, nil
+	}
+
+	if di.CoinType != config.CoinTypeBTC {
+		log.Warn("Hot wallet cannot cover deposit, but only BTC deposits can be bought through passthrough")
+		return config.BuyMethodDirect, 0, nil
+	}
+
+	return config.BuyMethodPassthrough, available, nil
+}
+
+// availableSky returns the hot wallet's spendable SKY, net of the SKY owed to the deposits
+// that are not sent yet other than excludeID, in droplets
+func (h *Hybrid) availableSky(excludeID string) (uint64, error) {
+	bal, err := h.balancer.Balance()
+	if err != nil {
+		return 0, err
+	}
+
+	spendable, err := droplet.FromString(bal.Coins)
+	if err != nil {
+		return 0, err
+	}
+
+	obligations, err := depositObligations(h.store, h.cfg.MaxDecimals, h.cfg.Fees, excludeID)
+	if err != nil {
+		return 0, err
+	}
+
+	if obligations >= spendable {
+		return 0, nil
+	}
+
+	return spendable - obligations, nil
+}
+
+// replenish places an inventory replenishment buy on c2cx.com if the hot wallet's
+// available SKY has fallen below the configured threshold. The SKY bought must be
+// withdrawn to the hot wallet by the operator.
+func (h *Hybrid) replenish(available uint64) {
+	if h.replenishThreshold == 0 || available >= h.replenishThreshold {
+		return
+	}
+
+	if !h.lastReplenish.IsZero() && time.Since(h.lastReplenish) < h.cfg.Hybrid.ReplenishWait {
+		return
+	}
+
+	h.lastReplenish = time.Now()
+
+	customerID := fmt.Sprintf("replenish:%d", h.lastReplenish.Unix())
+
+	log := h.log.WithFields(logrus.Fields{
+		"available":  available,
+		"threshold":  h.replenishThreshold,
+		"amount":     h.replenishAmount.String(),
+		"customerID": customerID,
+	})
+
+	if err := h.passthrough.checkBalance(h.replenishAmount); err != nil {
+		log.WithField("notice", logger.WatchNotice).WithError(err).Error("Replenishment buy skipped")
+		return
+	}
+
+	orderID, err := h.passthrough.exchangeClient.MarketBuy(c2cx.BtcSky, h.replenishAmount, &customerID)
+	if err != nil {
+		log.WithField("notice", logger.WatchNotice).WithError(err).Error("Replenishment buy failed")
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"orderID": orderID,
+		"notice":  logger.WatchNotice,
+	}).Warn("Placed replenishment buy, withdraw the SKY bought to the hot wallet")
+}
+
+func (h *Hybrid) setStatus(err error) {
+	defer h.statusLock.Unlock()
+	h.statusLock.Lock()
+	h.status = err
+}
+
+// Status returns the last return value of the processing state
+func (h *Hybrid) Status() error {
+	defer h.statusLock.RUnlock()
+	h.statusLock.RLock()
+	if h.status != nil {
+		return h.status
+	}
+	return h.passthrough.Status()
+}
@@ -0,0 +1,333 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	logrus_test "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/exchange-api/exchange/c2cx"
+	"github.com/skycoin/skycoin/src/api/cli"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/fiber"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+var (
+	defaultHybridCfg = config.SkyExchanger{
+		SkyBtcExchangeRate:      testSkyBtcRate,
+		SkyEthExchangeRate:      testSkyEthRate,
+		SkySkyExchangeRate:      testSkySkyRate,
+		MaxDecimals:             3,
+		Coin:                    fiber.Skycoin,
+		TxConfirmationCheckWait: time.Second,
+		Wallet:                  testWalletFile,
+		SendEnabled:             true,
+		BuyMethod:               config.BuyMethodHybrid,
+		C2CX:                    defaultPassthroughCfg.C2CX,
+		Hybrid: config.Hybrid{
+			BalanceCheckWait: time.Millisecond * 10,
+		},
+	}
+)
+
+type mockBalancer struct {
+	coins string
+	err   error
+}
+
+func (b *mockBalancer) Balance() (*cli.Balance, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	return &cli.Balance{
+		Coins: b.coins,
+		Hours: "100",
+	}, nil
+}
+
+func setupHybrid(t *testing.T, cfg config.SkyExchanger) (*Hybrid, func(), *MockC2CXClient, *mockBalancer, *logrus_test.Hook) {
+	db, shutdown := testutil.PrepareDB(t)
+
+	log, hook := testutil.NewLogger(t)
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	balancer := &mockBalancer{
+		coins: "100.000000",
+	}
+
+	h, err := NewHybrid(log, cfg, store, newMockReceiver(), balancer)
+	require.NoError(t, err)
+
+	mockClient := &MockC2CXClient{}
+	h.passthrough.exchangeClient = mockClient
+
+	return h, shutdown, mockClient, balancer, hook
+}
+
+func createHybridDepositStatusWaitDecide(t *testing.T, h *Hybrid, coinType string, value int64, n uint32) DepositInfo {
+	depositAddr := testutil.RandString(t, 16)
+	_, err := h.store.BindAddress(testSkyAddr, depositAddr, coinType, config.BuyMethodHybrid, 0)
+	require.NoError(t, err)
+
+	rate, err := getRate(h.cfg, coinType)
+	require.NoError(t, err)
+
+	di, err := h.store.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType:  coinType,
+		Address:   depositAddr,
+		Value:     value,
+		Height:    400000,
+		Tx:        "deposit-tx-id",
+		N:         n,
+		Processed: true,
+	}, rate)
+	require.NoError(t, err)
+	require.Equal(t, config.BuyMethodHybrid, di.BuyMethod)
+	require.Equal(t, StatusWaitDecide, di.Status)
+
+	return di
+}
+
+func TestHybridDecideBuyMethod(t *testing.T) {
+	// 0.01 BTC at 100 SKY/BTC requires 1 SKY
+	btcDeposit := DepositInfo{CoinType: config.CoinTypeBTC, DepositValue: 1e6}
+	// 1 ETH at 10 SKY/ETH requires 10 SKY
+	ethDeposit := DepositInfo{CoinType: config.CoinTypeETH, DepositValue: 1e9}
+
+	cases := []struct {
+		name              string
+		coins             string
+		di                DepositInfo
+		expectedBuyMethod string
+		expectedAvailable uint64
+	}{
+		{
+			name:              "wallet covers btc deposit",
+			coins:             "100.000000",
+			di:                btcDeposit,
+			expectedBuyMethod: config.BuyMethodDirect,
+			expectedAvailable: 99e6,
+		},
+		{
+			name:              "wallet exactly covers btc deposit",
+			coins:             "1.000000",
+			di:                btcDeposit,
+			expectedBuyMethod: config.BuyMethodDirect,
+			expectedAvailable: 0,
+		},
+		{
+			name:              "wallet does not cover btc deposit",
+			coins:             "0.999000",
+			di:                btcDeposit,
+			expectedBuyMethod: config.BuyMethodPassthrough,
+			expectedAvailable: 999e3,
+		},
+		{
+			name:              "wallet does not cover eth deposit",
+			coins:             "5.000000",
+			di:                ethDeposit,
+			expectedBuyMethod: config.BuyMethodDirect,
+			expectedAvailable: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Each deposit is decided alone, so that the other deposits are not obligations
+			h, shutdown, _, balancer, _ := setupHybrid(t, defaultHybridCfg)
+			defer shutdown()
+
+			balancer.coins = tc.coins
+
+			di := createHybridDepositStatusWaitDecide(t, h, tc.di.CoinType, tc.di.DepositValue, 1)
+			buyMethod, available, err := h.decideBuyMethod(di)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedBuyMethod, buyMethod)
+			require.Equal(t, tc.expectedAvailable, available)
+		})
+	}
+}
+
+func TestHybridDecideBuyMethodObligations(t *testing.T) {
+	h, shutdown, _, balancer, _ := setupHybrid(t, defaultHybridCfg)
+	defer shutdown()
+
+	balancer.coins = "10.000000"
+
+	// A deposit waiting to be sent owes 9 SKY from the wallet
+	owed := createHybridDepositStatusWaitDecide(t, h, config.CoinTypeBTC, 9e6, 1)
+	_, err := h.store.UpdateDepositInfo(owed.DepositID, func(di DepositInfo) DepositInfo {
+		di.BuyMethod = config.BuyMethodDirect
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+
+	available, err := h.availableSky("")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1e6), available)
+
+	// The deposit being decided is not counted against itself
+	di := createHybridDepositStatusWaitDecide(t, h, config.CoinTypeBTC, 2e6, 2)
+	buyMethod, available, err := h.decideBuyMethod(di)
+	require.NoError(t, err)
+	require.Equal(t, config.BuyMethodPassthrough, buyMethod)
+	require.Equal(t, uint64(1e6), available)
+
+	// Deposits that are not decided, held or bought through passthrough are owed SKY too
+	balancer.coins = "20.000000"
+	available, err = h.availableSky("")
+	require.NoError(t, err)
+	require.Equal(t, uint64(9e6), available)
+
+	for i, status := range []string{StatusWaitApproval, StatusWaitPassthrough} {
+		held := createHybridDepositStatusWaitDecide(t, h, config.CoinTypeBTC, 1e6, uint32(i+3))
+		_, err := h.store.UpdateDepositInfo(held.DepositID, func(di DepositInfo) DepositInfo {
+			di.Status = status
+			di.BuyMethod = config.BuyMethodPassthrough
+			return di
+		})
+		require.NoError(t, err)
+	}
+
+	available, err = h.availableSky("")
+	require.NoError(t, err)
+	require.Equal(t, uint64(7e6), available)
+
+	available, err = h.availableSky(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(9e6), available)
+
+	// Obligations larger than the balance leave nothing available
+	balancer.coins = "5.000000"
+	available, err = h.availableSky("")
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), available)
+}
+
+func TestHybridRouteDeposit(t *testing.T) {
+	h, shutdown, _, balancer, _ := setupHybrid(t, defaultHybridCfg)
+	defer shutdown()
+
+	balancer.coins = "1.500000"
+
+	// The first deposit is sent directly, which leaves 0.5 SKY available
+	di := createHybridDepositStatusWaitDecide(t, h, config.CoinTypeBTC, 1e6, 1)
+	err := h.routeDeposit(di)
+	require.NoError(t, err)
+
+	var direct DepositInfo
+	select {
+	case direct = <-h.Deposits():
+	default:
+		t.Fatal("Expected deposit to be sent directly")
+	}
+
+	require.Equal(t, di.DepositID, direct.DepositID)
+	require.Equal(t, config.BuyMethodDirect, direct.BuyMethod)
+	require.Equal(t, StatusWaitSend, direct.Status)
+
+	// The second deposit is routed to passthrough
+	di = createHybridDepositStatusWaitDecide(t, h, config.CoinTypeBTC, 1e6, 2)
+	err = h.routeDeposit(di)
+	require.NoError(t, err)
+
+	var passthrough DepositInfo
+	select {
+	case passthrough = <-h.passthroughDeposits:
+	default:
+		t.Fatal("Expected deposit to be routed to passthrough")
+	}
+
+	require.Equal(t, di.DepositID, passthrough.DepositID)
+	require.Equal(t, config.BuyMethodPassthrough, passthrough.BuyMethod)
+	require.Equal(t, StatusWaitDecide, passthrough.Status)
+
+	dis, err := h.store.GetDepositInfoArray(func(di DepositInfo) bool {
+		return di.DepositID == passthrough.DepositID
+	})
+	require.NoError(t, err)
+	require.Len(t, dis, 1)
+	require.Equal(t, config.BuyMethodPassthrough, dis[0].BuyMethod)
+
+	// An already decided deposit is not decided again
+	balancer.coins = "100.000000"
+	err = h.routeDeposit(passthrough)
+	require.NoError(t, err)
+
+	select {
+	case d := <-h.passthroughDeposits:
+		require.Equal(t, passthrough.DepositID, d.DepositID)
+	default:
+		t.Fatal("Expected decided deposit to stay on passthrough")
+	}
+}
+
+func TestHybridRouteDepositBalanceCheckFailed(t *testing.T) {
+	h, shutdown, _, balancer, _ := setupHybrid(t, defaultHybridCfg)
+	defer shutdown()
+
+	balancer.err = errors.New("skycoin node unavailable")
+
+	di := createHybridDepositStatusWaitDecide(t, h, config.CoinTypeBTC, 1e6, 1)
+	err := h.routeDeposit(di)
+	require.Equal(t, errBalanceCheck, err)
+
+	// The deposit is left undecided
+	dis, err := h.store.GetDepositInfoArray(func(d DepositInfo) bool {
+		return d.DepositID == di.DepositID
+	})
+	require.NoError(t, err)
+	require.Len(t, dis, 1)
+	require.Equal(t, config.BuyMethodHybrid, dis[0].BuyMethod)
+	require.Equal(t, StatusWaitDecide, dis[0].Status)
+}
+
+func TestHybridReplenish(t *testing.T) {
+	cfg := defaultHybridCfg
+	cfg.Hybrid.ReplenishThreshold = "10"
+	cfg.Hybrid.ReplenishBtcAmount = "0.1"
+	cfg.Hybrid.ReplenishWait = time.Hour
+
+	h, shutdown, mockClient, _, _ := setupHybrid(t, cfg)
+	defer shutdown()
+
+	amount := decimal.New(1, -1)
+
+	mockClient.On("GetBalanceSummary").Return(&c2cx.BalanceSummary{
+		Balance: c2cx.Balances{
+			Btc: decimal.New(1, 0),
+		},
+	}, nil)
+	mockClient.On("MarketBuy", c2cx.BtcSky, mock.MatchedBy(func(v decimal.Decimal) bool {
+		return v.Equal(amount)
+	}), mock.MatchedBy(func(customerID *string) bool {
+		return customerID != nil && *customerID == fmt.Sprintf("replenish:%d", h.lastReplenish.Unix())
+	})).Return(c2cx.OrderID(1234), nil)
+
+	// Above the threshold, nothing is bought
+	h.replenish(10e6)
+	mockClient.AssertNotCalled(t, "MarketBuy", mock.Anything, mock.Anything, mock.Anything)
+
+	// Below the threshold, a replenishment buy is placed
+	h.replenish(9e6)
+	mockClient.AssertNumberOfCalls(t, "MarketBuy", 1)
+
+	// Another buy is not placed until ReplenishWait has elapsed
+	h.replenish(1e6)
+	mockClient.AssertNumberOfCalls(t, "MarketBuy", 1)
+
+	h.lastReplenish = h.lastReplenish.Add(-cfg.Hybrid.ReplenishWait)
+	h.replenish(1e6)
+	mockClient.AssertNumberOfCalls(t, "MarketBuy", 2)
+}
@@ -0,0 +1,375 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/config"
+)
+
+// Ledger accounts. A posting's amount is a debit if positive and a credit if negative,
+// so assets and expenses have positive balances, and liabilities, revenue and equity negative balances.
+const (
+	// AccountDeposits coins received at the deposit addresses
+	AccountDeposits = "assets:deposits"
+	// AccountHotWallet SKY held in the hot wallets
+	AccountHotWallet = "assets:hot_wallet"
+	// AccountExchange coins held on the passthrough exchange
+	AccountExchange = "assets:exchange"
+	// AccountUserLiabilities coins owed to users for their deposits
+	AccountUserLiabilities = "liabilities:users"
+	// AccountRefunds deposits owed back to users, for rejected deposits
+	AccountRefunds = "liabilities:refunds"
+	// AccountServiceFees service fees kept from the payouts
+	AccountServiceFees = "revenue:service_fees"
+	// AccountExchangeFees commissions charged by the passthrough exchange
+	AccountExchangeFees = "expenses:exchange_fees"
+	// AccountConversion trading account for coins converted to SKY. Each entry balances in every coin type,
+	// so a deposit paid out in SKY moves the deposit coin into this account and the SKY out of it.
+	AccountConversion = "equity:conversion"
+	// AccountAdjustments counterpart of manual adjustments, e.g. for funding the hot wallet
+	AccountAdjustments = "equity:adjustments"
+)
+
+// Journal entry types. The entries of a deposit are derived from the change in its DepositInfo.
+// If an earlier entry is undone, e.g. when a dropped payout is requeued, it is reversed with an
+// entry of type "<type>_reversal". If its amount changes, e.g. when an operator completes a deposit
+// with a different amount, the difference is posted with an entry of type "<type>_correction".
+const (
+	// EntryDepositReceived a deposit was received
+	EntryDepositReceived = "deposit_received"
+	// EntryPassthroughBuy deposit coins were spent on the passthrough exchange
+	EntryPassthroughBuy = "passthrough_buy"
+	// EntryPayout SKY was sent for a deposit
+	EntryPayout = "payout"
+	// EntryRefund a deposit was rejected and is owed back to the user
+	EntryRefund = "refund"
+	// EntryAdjustment an operator adjusted the ledger
+	EntryAdjustment = "adjustment"
+
+	entryReversalSuffix   = "_reversal"
+	entryCorrectionSuffix = "_correction"
+)
+
+var (
+	// Accounts is all ledger accounts
+	Accounts = []string{
+		AccountDeposits,
+		AccountHotWallet,
+		AccountExchange,
+		AccountUserLiabilities,
+		AccountRefunds,
+		AccountServiceFees,
+		AccountExchangeFees,
+		AccountConversion,
+		AccountAdjustments,
+	}
+
+	// ErrInvalidAccount is returned for unknown ledger accounts
+	ErrInvalidAccount = errors.New("Invalid ledger account")
+	// ErrUnbalancedEntry is returned for a journal entry whose debits and credits differ
+	ErrUnbalancedEntry = errors.New("Journal entry debits and credits are not equal")
+	// ErrEmptyEntry is returned for a journal entry without postings
+	ErrEmptyEntry = errors.New("Journal entry has no postings")
+)
+
+// ValidateAccount returns an error if an account is invalid
+func ValidateAccount(account string) error {
+	for _, a := range Accounts {
+		if a == account {
+			return nil
+		}
+	}
+
+	return ErrInvalidAccount
+}
+
+// Posting is a debit or credit of an account
+type Posting struct {
+	Account  string `json:"account"`
+	CoinType string `json:"coin_type"`
+	// Debit if positive, credit if negative. Measured in the smallest unit of CoinType.
+	Amount int64 `json:"amount"`
+}
+
+// JournalEntry records a value movement. Journal entries are never modified or deleted.
+type JournalEntry struct {
+	Seq       uint64    `json:"seq"`
+	Timestamp int64     `json:"timestamp"`
+	Type      string    `json:"type"`
+	DepositID string    `json:"deposit_id"`
+	Txid      string    `json:"txid"`
+	Actor     string    `json:"actor"` // Set for entries made by an operator
+	Memo      string    `json:"memo"`
+	Postings  []Posting `json:"postings"`
+}
+
+// Validate returns an error if the entry's postings are invalid or don't balance in every coin type
+func (e JournalEntry) Validate() error {
+	if e.Type == "" {
+		return errors.New("Journal entry type missing")
+	}
+
+	if len(e.Postings) == 0 {
+		return ErrEmptyEntry
+	}
+
+	sums := make(map[string]int64)
+	for _, p := range e.Postings {
+		if err := ValidateAccount(p.Account); err != nil {
+			return fmt.Errorf("%v: %q", err, p.Account)
+		}
+
+		if err := config.ValidateCoinType(p.CoinType); err != nil {
+			return err
+		}
+
+		if p.Amount == 0 {
+			return errors.New("Journal entry has a zero posting")
+		}
+
+		sums[p.CoinType] += p.Amount
+	}
+
+	for _, sum := range sums {
+		if sum != 0 {
+			return ErrUnbalancedEntry
+		}
+	}
+
+	return nil
+}
+
+// LedgerBalances maps an account to its balance in each coin type.
+// Balances are positive for debit balances and negative for credit balances.
+type LedgerBalances map[string]map[string]int64
+
+// add adds the postings of an entry to the balances
+func (b LedgerBalances) add(e JournalEntry) {
+	for _, p := range e.Postings {
+		if b[p.Account] == nil {
+			b[p.Account] = make(map[string]int64)
+		}
+		b[p.Account][p.CoinType] += p.Amount
+	}
+}
+
+// LedgerAmountToString converts a posting amount or balance to its fixed string representation.
+// Unlike DepositAmountToString, negative amounts are allowed.
+func LedgerAmountToString(coinType string, amount int64) (string, error) {
+	exp, err := coinExponent(coinType)
+	if err != nil {
+		return "", err
+	}
+
+	return decimal.New(amount, -exp).StringFixed(exp), nil
+}
+
+// LedgerAmountFromString parses a decimal amount of coinType, e.g. "1.5", to its smallest unit
+func LedgerAmountFromString(coinType, amount string) (int64, error) {
+	exp, err := coinExponent(coinType)
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := decimal.NewFromString(amount)
+	if err != nil {
+		return 0, err
+	}
+
+	v := d.Mul(decimal.New(1, exp))
+	if !v.Equal(v.Truncate(0)) {
+		return 0, fmt.Errorf("%s amount has more than %d decimal places", coinType, exp)
+	}
+
+	return v.IntPart(), nil
+}
+
+// coinExponent returns the number of decimal places of the smallest unit of a coin type
+func coinExponent(coinType string) (int32, error) {
+	switch coinType {
+	case config.CoinTypeBTC:
+		return int32(SatoshiExponent), nil
+	case config.CoinTypeETH:
+		return int32(WeiExponent), nil
+	case config.CoinTypeSKY:
+		return droplet.Exponent, nil
+	default:
+		return 0, config.ErrUnsupportedCoinType
+	}
+}
+
+// depositJournalEntries returns the journal entries for a change of a deposit from oldDi to newDi.
+// oldDi is empty for a new deposit. The entries have no Seq, Timestamp or Actor.
+func depositJournalEntries(oldDi, newDi DepositInfo) []JournalEntry {
+	var entries []JournalEntry
+
+	for _, x := range []struct {
+		entryType string
+		postings  func(DepositInfo) []Posting
+	}{
+		{EntryDepositReceived, depositReceivedPostings},
+		{EntryPassthroughBuy, passthroughBuyPostings},
+		{EntryPayout, payoutPostings},
+		{EntryRefund, refundPostings},
+	} {
+		oldPostings := x.postings(oldDi)
+		newPostings := x.postings(newDi)
+
+		postings := diffPostings(oldPostings, newPostings)
+		if len(postings) == 0 {
+			continue
+		}
+
+		entryType := x.entryType
+		switch {
+		case len(oldPostings) == 0:
+		case len(newPostings) == 0:
+			entryType += entryReversalSuffix
+		default:
+			entryType += entryCorrectionSuffix
+		}
+
+		// A reversed payout has no txid anymore
+		txid := newDi.Txid
+		if txid == "" {
+			txid = oldDi.Txid
+		}
+
+		entries = append(entries, JournalEntry{
+			Type:      entryType,
+			DepositID: newDi.DepositID,
+			Txid:      txid,
+			Postings:  postings,
+		})
+	}
+
+	return entries
+}
+
+// diffPostings returns the postings that change the balances posted by oldPostings into those posted by newPostings
+func diffPostings(oldPostings, newPostings []Posting) []Posting {
+	type key struct {
+		account  string
+		coinType string
+	}
+
+	var keys []key
+	amounts := make(map[key]int64)
+	add := func(p Posting, sign int64) {
+		k := key{p.Account, p.CoinType}
+		if _, ok := amounts[k]; !ok {
+			keys = append(keys, k)
+		}
+		amounts[k] += sign * p.Amount
+	}
+
+	for _, p := range newPostings {
+		add(p, 1)
+	}
+	for _, p := range oldPostings {
+		add(p, -1)
+	}
+
+	var postings []Posting
+	for _, k := range keys {
+		if amounts[k] == 0 {
+			continue
+		}
+
+		postings = append(postings, Posting{
+			Account:  k.account,
+			CoinType: k.coinType,
+			Amount:   amounts[k],
+		})
+	}
+
+	return postings
+}
+
+// newPostings returns a debit and a credit of amt, or nil if amt is zero
+func newPostings(debit, credit, coinType string, amt int64) []Posting {
+	if amt == 0 {
+		return nil
+	}
+
+	return []Posting{
+		{Account: debit, CoinType: coinType, Amount: amt},
+		{Account: credit, CoinType: coinType, Amount: -amt},
+	}
+}
+
+// depositReceivedPostings records the deposit's coins, which are owed to the user until they are paid out
+func depositReceivedPostings(di DepositInfo) []Posting {
+	if di.DepositID == "" {
+		return nil
+	}
+
+	return newPostings(AccountDeposits, AccountUserLiabilities, di.CoinType, di.DepositValue)
+}
+
+// passthroughBuyPostings records the deposit coins spent and the SKY bought on the passthrough exchange
+func passthroughBuyPostings(di DepositInfo) []Posting {
+	pd := di.Passthrough
+	if !pd.Order.Final {
+		return nil
+	}
+
+	fee := pd.Fee
+	if fee > pd.SkyBought {
+		fee = pd.SkyBought
+	}
+
+	var postings []Posting
+	postings = append(postings, newPostings(AccountConversion, AccountDeposits, di.CoinType, pd.DepositValueSpent)...)
+	postings = append(postings, newPostings(AccountExchange, AccountConversion, config.CoinTypeSKY, int64(pd.SkyBought-fee))...)
+	postings = append(postings, newPostings(AccountExchangeFees, AccountConversion, config.CoinTypeSKY, int64(fee))...)
+	return postings
+}
+
+// isPaidOut returns true if the deposit's coins were sent, or it finished without coins to send
+func isPaidOut(di DepositInfo) bool {
+	return di.Txid != "" || di.Status == StatusDone
+}
+
+// payoutPostings settles the user's deposit by converting it to SKY, which is sent from the hot wallet less the service fee
+func payoutPostings(di DepositInfo) []Posting {
+	if !isPaidOut(di) {
+		return nil
+	}
+
+	payout := di.Payout
+	if payout.Net != di.SkySent {
+		// SkySent was recorded without a payout, or changed by an operator
+		payout.Net = di.SkySent
+		payout.Gross = di.SkySent + payout.Fee
+	}
+
+	var postings []Posting
+	postings = append(postings, newPostings(AccountUserLiabilities, AccountConversion, di.CoinType, di.DepositValue)...)
+	postings = append(postings, newPostings(AccountConversion, AccountHotWallet, config.CoinTypeSKY, int64(payout.Net))...)
+	postings = append(postings, newPostings(AccountConversion, AccountServiceFees, config.CoinTypeSKY, int64(payout.Fee))...)
+	return postings
+}
+
+// refundPostings moves a rejected deposit from the users' liabilities to the refunds owed
+func refundPostings(di DepositInfo) []Posting {
+	if di.Status != StatusRefundPending {
+		return nil
+	}
+
+	return newPostings(AccountUserLiabilities, AccountRefunds, di.CoinType, di.DepositValue)
+}
+
+// sortJournalEntries sorts entries by Seq.
+// Keys are sorted as strings, not numbers, so entries read from the db must be sorted.
+func sortJournalEntries(entries []JournalEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+}
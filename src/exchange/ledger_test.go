@@ -0,0 +1,436 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+// requireBalanced checks that every journal entry balances and returns the entry types, oldest first
+func requireBalanced(t *testing.T, s *Store) []string {
+	entries, err := s.GetJournalEntries(0, 0)
+	require.NoError(t, err)
+
+	var types []string
+	for i, e := range entries {
+		require.NoError(t, e.Validate())
+		require.Equal(t, uint64(i+1), e.Seq)
+		types = append(types, e.Type)
+	}
+
+	return types
+}
+
+func requireBalances(t *testing.T, s *Store, expected LedgerBalances) {
+	balances, err := s.GetLedgerBalances(0)
+	require.NoError(t, err)
+
+	// Drop settled balances
+	for account, coins := range balances {
+		for coinType, v := range coins {
+			if v == 0 {
+				delete(coins, coinType)
+			}
+		}
+		if len(coins) == 0 {
+			delete(balances, account)
+		}
+	}
+
+	require.Equal(t, expected, balances)
+}
+
+func TestLedgerDirectDeposit(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	di, err := s.addDepositInfo(DepositInfo{
+		CoinType:       config.CoinTypeBTC,
+		DepositID:      "btx1:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr1",
+		DepositValue:   1e6,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitSend,
+		BuyMethod:      config.BuyMethodDirect,
+	})
+	require.NoError(t, err)
+
+	requireBalances(t, s, LedgerBalances{
+		AccountDeposits:        {config.CoinTypeBTC: 1e6},
+		AccountUserLiabilities: {config.CoinTypeBTC: -1e6},
+	})
+
+	send := func(txid string) {
+		_, err := s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+			di.Status = StatusWaitConfirm
+			di.Txid = txid
+			di.SkySent = 99e5
+			di.Payout = PayoutData{Gross: 100e5, Fee: 1e5, Net: 99e5}
+			return di
+		})
+		require.NoError(t, err)
+	}
+
+	paid := LedgerBalances{
+		AccountDeposits:    {config.CoinTypeBTC: 1e6},
+		AccountConversion:  {config.CoinTypeBTC: -1e6, config.CoinTypeSKY: 100e5},
+		AccountHotWallet:   {config.CoinTypeSKY: -99e5},
+		AccountServiceFees: {config.CoinTypeSKY: -1e5},
+	}
+
+	send("txid-1")
+	requireBalances(t, s, paid)
+
+	// The transaction was dropped, so the payout is reversed
+	_, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		di.Txid = ""
+		di.SkySent = 0
+		return di
+	})
+	require.NoError(t, err)
+
+	requireBalances(t, s, LedgerBalances{
+		AccountDeposits:        {config.CoinTypeBTC: 1e6},
+		AccountUserLiabilities: {config.CoinTypeBTC: -1e6},
+	})
+
+	send("txid-2")
+	requireBalances(t, s, paid)
+
+	// Confirming the payout posts nothing
+	_, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.NoError(t, err)
+
+	// An operator corrects the amount sent
+	_, err = s.WithOperator(OperatorActionComplete, "alice", "sent more").UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.SkySent = 100e5
+		return di
+	})
+	require.NoError(t, err)
+
+	requireBalances(t, s, LedgerBalances{
+		AccountDeposits:    {config.CoinTypeBTC: 1e6},
+		AccountConversion:  {config.CoinTypeBTC: -1e6, config.CoinTypeSKY: 101e5},
+		AccountHotWallet:   {config.CoinTypeSKY: -100e5},
+		AccountServiceFees: {config.CoinTypeSKY: -1e5},
+	})
+
+	require.Equal(t, []string{
+		EntryDepositReceived,
+		EntryPayout,
+		EntryPayout + entryReversalSuffix,
+		EntryPayout,
+		EntryPayout + entryCorrectionSuffix,
+	}, requireBalanced(t, s))
+
+	entries, err := s.GetJournalEntries(0, 0)
+	require.NoError(t, err)
+	require.Equal(t, "txid-1", entries[2].Txid)
+	require.Equal(t, "alice", entries[4].Actor)
+	require.Equal(t, "sent more", entries[4].Memo)
+	require.Equal(t, []Posting{
+		{Account: AccountConversion, CoinType: config.CoinTypeSKY, Amount: 1e5},
+		{Account: AccountHotWallet, CoinType: config.CoinTypeSKY, Amount: -1e5},
+	}, entries[4].Postings)
+}
+
+func TestLedgerPassthroughDeposit(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	di, err := s.addDepositInfo(DepositInfo{
+		CoinType:       config.CoinTypeBTC,
+		DepositID:      "btx1:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr1",
+		DepositValue:   1e6,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitDecide,
+		BuyMethod:      config.BuyMethodPassthrough,
+	})
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		di.Passthrough.SkyBought = 98e5
+		di.Passthrough.DepositValueSpent = 999e3
+		di.Passthrough.Fee = 2e5
+		di.Passthrough.Order.Final = true
+		return di
+	})
+	require.NoError(t, err)
+
+	requireBalances(t, s, LedgerBalances{
+		AccountDeposits:        {config.CoinTypeBTC: 1e3},
+		AccountUserLiabilities: {config.CoinTypeBTC: -1e6},
+		AccountConversion:      {config.CoinTypeBTC: 999e3, config.CoinTypeSKY: -98e5},
+		AccountExchange:        {config.CoinTypeSKY: 96e5},
+		AccountExchangeFees:    {config.CoinTypeSKY: 2e5},
+	})
+
+	_, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "txid-1"
+		di.SkySent = 98e5
+		di.Payout = PayoutData{Gross: 98e5, Net: 98e5}
+		return di
+	})
+	require.NoError(t, err)
+
+	requireBalances(t, s, LedgerBalances{
+		AccountDeposits:     {config.CoinTypeBTC: 1e3},
+		AccountConversion:   {config.CoinTypeBTC: -1e3},
+		AccountExchange:     {config.CoinTypeSKY: 96e5},
+		AccountExchangeFees: {config.CoinTypeSKY: 2e5},
+		AccountHotWallet:    {config.CoinTypeSKY: -98e5},
+	})
+
+	require.Equal(t, []string{
+		EntryDepositReceived,
+		EntryPassthroughBuy,
+		EntryPayout,
+	}, requireBalanced(t, s))
+}
+
+func TestLedgerRefund(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	di, err := s.addDepositInfo(DepositInfo{
+		CoinType:       config.CoinTypeETH,
+		DepositID:      "etx1:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "ethaddr1",
+		DepositValue:   5e9,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitApproval,
+		BuyMethod:      config.BuyMethodDirect,
+		Risk:           RiskData{Rule: RiskRuleMaxDeposit},
+	})
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusRefundPending
+		return di
+	})
+	require.NoError(t, err)
+
+	requireBalances(t, s, LedgerBalances{
+		AccountDeposits: {config.CoinTypeETH: 5e9},
+		AccountRefunds:  {config.CoinTypeETH: -5e9},
+	})
+
+	// Setting the deposit back to a processed status reverses the refund
+	_, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitDecide
+		return di
+	})
+	require.NoError(t, err)
+
+	requireBalances(t, s, LedgerBalances{
+		AccountDeposits:        {config.CoinTypeETH: 5e9},
+		AccountUserLiabilities: {config.CoinTypeETH: -5e9},
+	})
+
+	require.Equal(t, []string{
+		EntryDepositReceived,
+		EntryRefund,
+		EntryRefund + entryReversalSuffix,
+	}, requireBalanced(t, s))
+}
+
+func TestLedgerInitExistingDeposits(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	for _, di := range []DepositInfo{
+		{
+			CoinType:       config.CoinTypeBTC,
+			DepositID:      "btx1:1",
+			SkyAddress:     "skyaddr1",
+			DepositAddress: "btcaddr1",
+			DepositValue:   1e6,
+			ConversionRate: testSkyBtcRate,
+			Status:         StatusDone,
+			BuyMethod:      config.BuyMethodDirect,
+			Txid:           "txid-1",
+			SkySent:        100e5,
+		},
+		{
+			CoinType:       config.CoinTypeBTC,
+			DepositID:      "btx2:1",
+			SkyAddress:     "skyaddr1",
+			DepositAddress: "btcaddr2",
+			DepositValue:   2e6,
+			ConversionRate: testSkyBtcRate,
+			Status:         StatusWaitSend,
+			BuyMethod:      config.BuyMethodDirect,
+		},
+	} {
+		_, err := s.addDepositInfo(di)
+		require.NoError(t, err)
+	}
+
+	expected := LedgerBalances{
+		AccountDeposits:        {config.CoinTypeBTC: 3e6},
+		AccountUserLiabilities: {config.CoinTypeBTC: -2e6},
+		AccountConversion:      {config.CoinTypeBTC: -1e6, config.CoinTypeSKY: 100e5},
+		AccountHotWallet:       {config.CoinTypeSKY: -100e5},
+	}
+	requireBalances(t, s, expected)
+
+	// Simulate a db from before the ledger existed
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(LedgerBkt); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(LedgerBkt); err != nil {
+			return err
+		}
+		return dbutil.DeleteBucketValue(tx, ExchangeMetaBkt, ledgerInitializedKey)
+	})
+	require.NoError(t, err)
+	requireBalances(t, s, LedgerBalances{})
+
+	require.NoError(t, s.initLedger())
+	requireBalances(t, s, expected)
+	require.Len(t, requireBalanced(t, s), 3)
+
+	// The existing deposits are only posted once
+	require.NoError(t, s.initLedger())
+	require.Len(t, requireBalanced(t, s), 3)
+}
+
+func TestLedgerAsOf(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	for _, e := range []JournalEntry{
+		{
+			Timestamp: 100,
+			Type:      EntryAdjustment,
+			Postings: []Posting{
+				{Account: AccountHotWallet, CoinType: config.CoinTypeSKY, Amount: 10},
+				{Account: AccountAdjustments, CoinType: config.CoinTypeSKY, Amount: -10},
+			},
+		},
+		{
+			Timestamp: 200,
+			Type:      EntryAdjustment,
+			Postings: []Posting{
+				{Account: AccountHotWallet, CoinType: config.CoinTypeSKY, Amount: 5},
+				{Account: AccountAdjustments, CoinType: config.CoinTypeSKY, Amount: -5},
+			},
+		},
+	} {
+		_, err := s.AddJournalEntry(e)
+		require.NoError(t, err)
+	}
+
+	balances, err := s.GetLedgerBalances(199)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), balances[AccountHotWallet][config.CoinTypeSKY])
+
+	balances, err = s.GetLedgerBalances(200)
+	require.NoError(t, err)
+	require.Equal(t, int64(15), balances[AccountHotWallet][config.CoinTypeSKY])
+
+	entries, err := s.GetJournalEntries(150, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, int64(200), entries[0].Timestamp)
+}
+
+func TestJournalEntryValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		postings []Posting
+		err      error
+	}{
+		{
+			name: "balanced in each coin type",
+			postings: []Posting{
+				{Account: AccountUserLiabilities, CoinType: config.CoinTypeBTC, Amount: 10},
+				{Account: AccountConversion, CoinType: config.CoinTypeBTC, Amount: -10},
+				{Account: AccountConversion, CoinType: config.CoinTypeSKY, Amount: 7},
+				{Account: AccountHotWallet, CoinType: config.CoinTypeSKY, Amount: -7},
+			},
+		},
+		{
+			name: "balanced across coin types",
+			postings: []Posting{
+				{Account: AccountDeposits, CoinType: config.CoinTypeBTC, Amount: 10},
+				{Account: AccountHotWallet, CoinType: config.CoinTypeSKY, Amount: -10},
+			},
+			err: ErrUnbalancedEntry,
+		},
+		{
+			name: "unbalanced",
+			postings: []Posting{
+				{Account: AccountDeposits, CoinType: config.CoinTypeBTC, Amount: 10},
+				{Account: AccountUserLiabilities, CoinType: config.CoinTypeBTC, Amount: -9},
+			},
+			err: ErrUnbalancedEntry,
+		},
+		{
+			name: "invalid coin type",
+			postings: []Posting{
+				{Account: AccountDeposits, CoinType: "LTC", Amount: 10},
+				{Account: AccountUserLiabilities, CoinType: "LTC", Amount: -10},
+			},
+			err: config.ErrUnsupportedCoinType,
+		},
+		{
+			name: "no postings",
+			err:  ErrEmptyEntry,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := JournalEntry{
+				Type:     EntryAdjustment,
+				Postings: tc.postings,
+			}.Validate()
+			require.Equal(t, tc.err, err)
+		})
+	}
+
+	err := JournalEntry{
+		Type: EntryAdjustment,
+		Postings: []Posting{
+			{Account: "assets:bank", CoinType: config.CoinTypeSKY, Amount: 10},
+			{Account: AccountAdjustments, CoinType: config.CoinTypeSKY, Amount: -10},
+		},
+	}.Validate()
+	require.Error(t, err)
+}
+
+func TestLedgerAmountFromString(t *testing.T) {
+	v, err := LedgerAmountFromString(config.CoinTypeSKY, "12.5")
+	require.NoError(t, err)
+	require.Equal(t, int64(12500000), v)
+
+	v, err = LedgerAmountFromString(config.CoinTypeBTC, "0.00000001")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), v)
+
+	_, err = LedgerAmountFromString(config.CoinTypeBTC, "0.000000001")
+	require.Error(t, err)
+
+	_, err = LedgerAmountFromString("LTC", "1")
+	require.Equal(t, config.ErrUnsupportedCoinType, err)
+
+	s, err := LedgerAmountToString(config.CoinTypeSKY, -12500000)
+	require.NoError(t, err)
+	require.Equal(t, "-12.500000", s)
+}
@@ -0,0 +1,373 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+)
+
+const (
+	// LimitTotalSkySold refuses deposits that take the total SKY sold over sky_exchanger.limits.total_sky_sold
+	LimitTotalSkySold = "total_sky_sold"
+	// LimitSkyAddressDaily refuses deposits that take the SKY sold to a skycoin address in 24 hours over the limit
+	LimitSkyAddressDaily = "sky_address_daily"
+	// LimitSkyAddressLifetime refuses deposits that take the SKY sold to a skycoin address over the limit
+	LimitSkyAddressLifetime = "sky_address_lifetime"
+	// LimitCoinDaily refuses deposits that take the amount of a coin received in 24 hours over the limit
+	LimitCoinDaily = "coin_daily"
+
+	// skySoldCacheTTL is how long the SKY sold totals are reused when checking bind limits and reporting the sale cap
+	skySoldCacheTTL = time.Second * 10
+)
+
+var (
+	// ErrSaleCapReached is returned when binding after the total SKY sold has reached sky_exchanger.limits.total_sky_sold
+	ErrSaleCapReached = errors.New("The SKY sale cap has been reached")
+	// ErrSkyAddressLimitReached is returned when binding a skycoin address that has reached its SKY limit
+	ErrSkyAddressLimitReached = errors.New("The SKY limit of this skycoin address has been reached")
+	// ErrCoinDailyLimitReached is returned when binding a coin type that has reached its daily limit
+	ErrCoinDailyLimitReached = errors.New("The daily deposit limit of this coin has been reached")
+)
+
+// SaleCap reports the SKY sold against sky_exchanger.limits.total_sky_sold
+type SaleCap struct {
+	Enabled bool   `json:"enabled"`
+	Cap     string `json:"cap"`
+	Sold    string `json:"sold"` // SKY sent or owed to deposits that are not pending refund
+	Reached bool   `json:"reached"`
+}
+
+// limitUsage totals the deposits that count towards the volume limits
+type limitUsage struct {
+	skySold            uint64 // SKY sent or owed to all deposits, in droplets
+	skyAddressDaily    uint64 // SKY sent or owed to the skycoin address in the last 24 hours, in droplets
+	skyAddressLifetime uint64 // SKY sent or owed to the skycoin address, in droplets
+	coinDaily          int64  // Deposit value of the coin type received in the last 24 hours
+}
+
+// skySoldTotals is the SKY sent or owed to all deposits, and to the deposits of each skycoin address, in droplets
+type skySoldTotals struct {
+	total        uint64
+	bySkyAddress map[string]uint64
+}
+
+// skySoldCache holds the skySoldTotals last computed for the public endpoints
+type skySoldCache struct {
+	sync.Mutex
+	ttl    time.Duration
+	totals *skySoldTotals
+	at     time.Time
+}
+
+// limitStatuses are the statuses of the deposits that count towards the volume limits
+var limitStatuses = []string{
+	StatusWaitDecide,
+	StatusWaitPassthrough,
+	StatusWaitPassthroughOrderComplete,
+	StatusWaitSend,
+	StatusWaitConfirm,
+	StatusDone,
+	StatusFailed,
+	StatusWaitApproval,
+}
+
+// countsTowardsLimits returns true if a deposit other than excludeID counts towards the volume limits.
+// Deposits pending refund are not counted.
+func countsTowardsLimits(di DepositInfo, excludeID string) bool {
+	return di.DepositID != "" && di.DepositID != excludeID && di.Status != StatusRefundPending
+}
+
+// skySoldTotals totals the SKY sold to the deposits other than excludeID that count towards the volume limits
+func (r *riskRules) skySoldTotals(excludeID string) (*skySoldTotals, error) {
+	dis, err := r.store.QueryDepositInfo(DepositQuery{
+		Statuses: limitStatuses,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	totals := &skySoldTotals{
+		bySkyAddress: make(map[string]uint64),
+	}
+
+	for _, d := range dis {
+		if !countsTowardsLimits(d, excludeID) {
+			continue
+		}
+
+		owed, err := calculateSkyOwed(d, r.maxDecimals)
+		if err != nil {
+			return nil, err
+		}
+
+		totals.total += owed
+		totals.bySkyAddress[d.SkyAddress] += owed
+	}
+
+	return totals, nil
+}
+
+// cachedSkySoldTotals returns the totals of skySoldTotals, recomputing them once they are older than the cache's TTL.
+// Binding and the sale cap are checked on public endpoints, so the totals are not recomputed on every request.
+func (r *riskRules) cachedSkySoldTotals(now time.Time) (*skySoldTotals, error) {
+	c := &r.skySold
+	c.Lock()
+	defer c.Unlock()
+
+	if c.totals != nil && !now.Before(c.at) && now.Sub(c.at) < c.ttl {
+		return c.totals, nil
+	}
+
+	totals, err := r.skySoldTotals("")
+	if err != nil {
+		return nil, err
+	}
+
+	c.totals = totals
+	c.at = now
+
+	return totals, nil
+}
+
+// limitUsage totals the deposits other than excludeID that count towards the volume limits.
+// If cached is true, the totals of all time may be up to skySoldCacheTTL old.
+// The deposits of the last 24 hours are looked up through the update time index.
+func (r *riskRules) limitUsage(skyAddr, coinType, excludeID string, now time.Time, cached bool) (limitUsage, error) {
+	var u limitUsage
+
+	var totals *skySoldTotals
+	var err error
+	if cached {
+		totals, err = r.cachedSkySoldTotals(now)
+	} else {
+		totals, err = r.skySoldTotals(excludeID)
+	}
+	if err != nil {
+		return u, err
+	}
+
+	u.skySold = totals.total
+	u.skyAddressLifetime = totals.bySkyAddress[skyAddr]
+
+	if skyAddr == "" && coinType == "" {
+		return u, nil
+	}
+
+	// A deposit that was last updated before the window was also created before it
+	since := now.Add(-riskDailyWindow).Unix()
+	dis, err := r.store.QueryDepositInfo(DepositQuery{
+		UpdatedFrom: since,
+	})
+	if err != nil {
+		return u, err
+	}
+
+	for _, d := range dis {
+		if !countsTowardsLimits(d, excludeID) {
+			continue
+		}
+
+		if d.SkyAddress != skyAddr && d.CoinType != coinType {
+			continue
+		}
+
+		createdAt, err := r.depositCreatedAt(d)
+		if err != nil {
+			return u, err
+		}
+
+		if createdAt < since {
+			continue
+		}
+
+		if d.SkyAddress == skyAddr {
+			owed, err := calculateSkyOwed(d, r.maxDecimals)
+			if err != nil {
+				return u, err
+			}
+
+			u.skyAddressDaily += owed
+		}
+
+		if d.CoinType == coinType {
+			u.coinDaily += d.DepositValue
+		}
+	}
+
+	return u, nil
+}
+
+// checkLimits returns the first volume limit that a deposit would exceed, or nil if it exceeds none
+func (r *riskRules) checkLimits(di DepositInfo, now time.Time) (*RiskData, error) {
+	limits := r.live.get().Limits
+
+	// A deposit is checked against exact totals, so that a burst of deposits cannot pass the limits
+	u, err := r.limitUsage(di.SkyAddress, di.CoinType, di.DepositID, now, false)
+	if err != nil {
+		return nil, err
+	}
+
+	owed, err := calculateSkyOwed(di, r.maxDecimals)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range []struct {
+		rule   string
+		limit  string
+		total  uint64
+		detail string
+	}{
+		{
+			rule:   LimitTotalSkySold,
+			limit:  limits.TotalSkySold,
+			total:  u.skySold + owed,
+			detail: "Total SKY sold would be %s, more than the sale cap of %s",
+		},
+		{
+			rule:   LimitSkyAddressLifetime,
+			limit:  limits.SkyAddressLifetime,
+			total:  u.skyAddressLifetime + owed,
+			detail: "SKY sold to " + di.SkyAddress + " would be %s, more than the limit of %s",
+		},
+		{
+			rule:   LimitSkyAddressDaily,
+			limit:  limits.SkyAddressDaily,
+			total:  u.skyAddressDaily + owed,
+			detail: "SKY sold to " + di.SkyAddress + " in the last 24 hours would be %s, more than the limit of %s",
+		},
+	} {
+		if l.limit == "" {
+			continue
+		}
+
+		limit, err := droplet.FromString(l.limit)
+		if err != nil {
+			return nil, err
+		}
+
+		if l.total <= limit {
+			continue
+		}
+
+		totalStr, err := droplet.ToString(l.total)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RiskData{
+			Rule:   l.rule,
+			Detail: fmt.Sprintf(l.detail, totalStr, l.limit),
+		}, nil
+	}
+
+	limit, err := limits.CoinDaily(di.CoinType)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit.Sign() == 0 {
+		return nil, nil
+	}
+
+	amount, err := depositValueToDecimal(di.CoinType, u.coinDaily+di.DepositValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if amount.LessThanOrEqual(limit) {
+		return nil, nil
+	}
+
+	return &RiskData{
+		Rule:   LimitCoinDaily,
+		Detail: fmt.Sprintf("%s received in the last 24 hours would be %s, more than the limit of %s", di.CoinType, amount, limit),
+	}, nil
+}
+
+// checkBindLimits returns an error if a skycoin address or coin type has reached a volume limit
+func (r *riskRules) checkBindLimits(skyAddr, coinType string, now time.Time) error {
+	limits := r.live.get().Limits
+
+	u, err := r.limitUsage(skyAddr, coinType, "", now, true)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range []struct {
+		limit string
+		total uint64
+		err   error
+	}{
+		{limits.TotalSkySold, u.skySold, ErrSaleCapReached},
+		{limits.SkyAddressLifetime, u.skyAddressLifetime, ErrSkyAddressLimitReached},
+		{limits.SkyAddressDaily, u.skyAddressDaily, ErrSkyAddressLimitReached},
+	} {
+		if l.limit == "" {
+			continue
+		}
+
+		limit, err := droplet.FromString(l.limit)
+		if err != nil {
+			return err
+		}
+
+		if l.total >= limit {
+			return l.err
+		}
+	}
+
+	limit, err := limits.CoinDaily(coinType)
+	if err != nil {
+		return err
+	}
+
+	if limit.Sign() == 0 {
+		return nil
+	}
+
+	amount, err := depositValueToDecimal(coinType, u.coinDaily)
+	if err != nil {
+		return err
+	}
+
+	if amount.GreaterThanOrEqual(limit) {
+		return ErrCoinDailyLimitReached
+	}
+
+	return nil
+}
+
+// saleCap returns the SKY sold against the sale cap
+func (r *riskRules) saleCap() (*SaleCap, error) {
+	limits := r.live.get().Limits
+
+	if limits.TotalSkySold == "" {
+		return &SaleCap{}, nil
+	}
+
+	limit, err := droplet.FromString(limits.TotalSkySold)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := r.limitUsage("", "", "", time.Now().UTC(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	sold, err := droplet.ToString(u.skySold)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SaleCap{
+		Enabled: true,
+		Cap:     limits.TotalSkySold,
+		Sold:    sold,
+		Reached: u.skySold >= limit,
+	}, nil
+}
@@ -0,0 +1,282 @@
+package exchange
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func setupLimits(t *testing.T, cfg config.Limits) (*riskRules, *Store, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	exchangeCfg := defaultCfg
+	exchangeCfg.Limits = cfg
+
+	r := newRiskRules(log, exchangeCfg, store)
+	// Recompute the SKY sold on every check, see TestRiskRulesSkySoldCache
+	r.skySold.ttl = 0
+
+	return r, store, shutdown
+}
+
+func TestRiskRulesCheckLimitsTotalSkySold(t *testing.T) {
+	r, s, shutdown := setupLimits(t, config.Limits{
+		TotalSkySold: "250",
+	})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	// 1 BTC is 100 SKY at testSkyBtcRate
+	first := mustAddRiskDepositInfo(t, s, 1, 1e8)
+	refuse, err := r.checkLimits(first, now)
+	require.NoError(t, err)
+	require.Nil(t, refuse)
+
+	second := mustAddRiskDepositInfo(t, s, 2, 1e8)
+	refuse, err = r.checkLimits(second, now)
+	require.NoError(t, err)
+	require.Nil(t, refuse)
+
+	third := mustAddRiskDepositInfo(t, s, 3, 1e8)
+	refuse, err = r.checkLimits(third, now)
+	require.NoError(t, err)
+	require.NotNil(t, refuse)
+	require.Equal(t, LimitTotalSkySold, refuse.Rule)
+	require.Equal(t, "Total SKY sold would be 300.000000, more than the sale cap of 250", refuse.Detail)
+
+	// Deposits pending refund are not counted
+	_, err = s.UpdateDepositInfo(second.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusRefundPending
+		return di
+	})
+	require.NoError(t, err)
+
+	refuse, err = r.checkLimits(third, now)
+	require.NoError(t, err)
+	require.Nil(t, refuse)
+}
+
+func TestRiskRulesCheckLimitsSkyAddress(t *testing.T) {
+	r, s, shutdown := setupLimits(t, config.Limits{
+		SkyAddressDaily:    "150",
+		SkyAddressLifetime: "250",
+	})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	first := mustAddRiskDepositInfo(t, s, 1, 1e8)
+	refuse, err := r.checkLimits(first, now)
+	require.NoError(t, err)
+	require.Nil(t, refuse)
+
+	second := mustAddRiskDepositInfo(t, s, 2, 1e8)
+	refuse, err = r.checkLimits(second, now)
+	require.NoError(t, err)
+	require.NotNil(t, refuse)
+	require.Equal(t, LimitSkyAddressDaily, refuse.Rule)
+	require.Equal(t, fmt.Sprintf("SKY sold to %s in the last 24 hours would be 200.000000, more than the limit of 150", testSkyAddr), refuse.Detail)
+
+	// The daily limit doesn't count deposits older than 24 hours, but the lifetime limit does
+	later := now.Add(riskDailyWindow + time.Hour)
+	refuse, err = r.checkLimits(second, later)
+	require.NoError(t, err)
+	require.Nil(t, refuse)
+
+	third := mustAddRiskDepositInfo(t, s, 3, 1e8)
+	refuse, err = r.checkLimits(third, later)
+	require.NoError(t, err)
+	require.NotNil(t, refuse)
+	require.Equal(t, LimitSkyAddressLifetime, refuse.Rule)
+	require.Equal(t, fmt.Sprintf("SKY sold to %s would be 300.000000, more than the limit of 250", testSkyAddr), refuse.Detail)
+}
+
+func TestRiskRulesCheckLimitsCoinDaily(t *testing.T) {
+	r, s, shutdown := setupLimits(t, config.Limits{
+		BtcDaily: "1.5",
+	})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	first := mustAddRiskDepositInfo(t, s, 1, 1e8)
+	refuse, err := r.checkLimits(first, now)
+	require.NoError(t, err)
+	require.Nil(t, refuse)
+
+	second := mustAddRiskDepositInfo(t, s, 2, 5e7)
+	refuse, err = r.checkLimits(second, now)
+	require.NoError(t, err)
+	require.Nil(t, refuse)
+
+	third := mustAddRiskDepositInfo(t, s, 3, 1)
+	refuse, err = r.checkLimits(third, now)
+	require.NoError(t, err)
+	require.NotNil(t, refuse)
+	require.Equal(t, LimitCoinDaily, refuse.Rule)
+	require.Equal(t, "BTC received in the last 24 hours would be 1.50000001, more than the limit of 1.5", refuse.Detail)
+
+	// Other coin types are not limited
+	eth := newOperatorDepositInfo(StatusWaitDecide)
+	eth.CoinType = config.CoinTypeETH
+	eth.DepositValue = 1e12
+	refuse, err = r.checkLimits(eth, now)
+	require.NoError(t, err)
+	require.Nil(t, refuse)
+}
+
+func TestRiskRulesCheckBindLimits(t *testing.T) {
+	r, s, shutdown := setupLimits(t, config.Limits{
+		TotalSkySold:       "300",
+		SkyAddressLifetime: "200",
+		BtcDaily:           "3",
+	})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	err := r.checkBindLimits(testSkyAddr, config.CoinTypeBTC, now)
+	require.NoError(t, err)
+
+	mustAddRiskDepositInfo(t, s, 1, 1e8)
+	err = r.checkBindLimits(testSkyAddr, config.CoinTypeBTC, now)
+	require.NoError(t, err)
+
+	mustAddRiskDepositInfo(t, s, 2, 1e8)
+	err = r.checkBindLimits(testSkyAddr, config.CoinTypeBTC, now)
+	require.Equal(t, ErrSkyAddressLimitReached, err)
+
+	// Another skycoin address can still bind
+	err = r.checkBindLimits("2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm", config.CoinTypeBTC, now)
+	require.NoError(t, err)
+
+	mustAddRiskDepositInfo(t, s, 3, 1e8)
+	err = r.checkBindLimits("2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm", config.CoinTypeBTC, now)
+	require.Equal(t, ErrSaleCapReached, err)
+}
+
+func TestRiskRulesCheckBindLimitsCoinDaily(t *testing.T) {
+	r, s, shutdown := setupLimits(t, config.Limits{
+		BtcDaily: "2",
+	})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	mustAddRiskDepositInfo(t, s, 1, 2e8)
+	err := r.checkBindLimits(testSkyAddr, config.CoinTypeBTC, now)
+	require.Equal(t, ErrCoinDailyLimitReached, err)
+
+	err = r.checkBindLimits(testSkyAddr, config.CoinTypeETH, now)
+	require.NoError(t, err)
+
+	err = r.checkBindLimits(testSkyAddr, config.CoinTypeBTC, now.Add(riskDailyWindow+time.Hour))
+	require.NoError(t, err)
+}
+
+func TestRiskRulesSaleCap(t *testing.T) {
+	r, _, shutdown := setupLimits(t, config.Limits{})
+	defer shutdown()
+
+	sc, err := r.saleCap()
+	require.NoError(t, err)
+	require.Equal(t, SaleCap{}, *sc)
+
+	r, s, shutdown := setupLimits(t, config.Limits{
+		TotalSkySold: "200",
+	})
+	defer shutdown()
+
+	mustAddRiskDepositInfo(t, s, 1, 1e8)
+	sc, err = r.saleCap()
+	require.NoError(t, err)
+	require.Equal(t, SaleCap{
+		Enabled: true,
+		Cap:     "200",
+		Sold:    "100.000000",
+	}, *sc)
+
+	mustAddRiskDepositInfo(t, s, 2, 1e8)
+	sc, err = r.saleCap()
+	require.NoError(t, err)
+	require.True(t, sc.Reached)
+	require.Equal(t, "200.000000", sc.Sold)
+}
+
+func TestRiskRulesSkySoldCache(t *testing.T) {
+	r, s, shutdown := setupLimits(t, config.Limits{
+		TotalSkySold:       "200",
+		SkyAddressLifetime: "100",
+	})
+	defer shutdown()
+	r.skySold.ttl = skySoldCacheTTL
+
+	now := time.Now().UTC()
+
+	err := r.checkBindLimits(testSkyAddr, config.CoinTypeBTC, now)
+	require.NoError(t, err)
+
+	// The bind limits reuse the SKY sold until the cache expires
+	di := mustAddRiskDepositInfo(t, s, 1, 1e8)
+	err = r.checkBindLimits(testSkyAddr, config.CoinTypeBTC, now.Add(skySoldCacheTTL-time.Second))
+	require.NoError(t, err)
+
+	err = r.checkBindLimits(testSkyAddr, config.CoinTypeBTC, now.Add(skySoldCacheTTL))
+	require.Equal(t, ErrSkyAddressLimitReached, err)
+
+	// A deposit is checked against the current SKY sold
+	second := mustAddRiskDepositInfo(t, s, 2, 1e8)
+	refuse, err := r.checkLimits(second, now.Add(skySoldCacheTTL))
+	require.NoError(t, err)
+	require.NotNil(t, refuse)
+	require.Equal(t, LimitSkyAddressLifetime, refuse.Rule)
+
+	// The daily limits are not cached, while the SKY sold is still the total cached before the second deposit
+	_, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusRefundPending
+		return di
+	})
+	require.NoError(t, err)
+
+	u, err := r.limitUsage(testSkyAddr, config.CoinTypeBTC, "", now.Add(skySoldCacheTTL), true)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), u.skySold)
+	require.Equal(t, int64(1e8), u.coinDaily)
+}
+
+func TestRiskRulesScreenLimit(t *testing.T) {
+	r, s, shutdown := setupLimits(t, config.Limits{
+		TotalSkySold: "150",
+	})
+	defer shutdown()
+
+	// A deposit exceeding a limit is refused, even if it would also be held
+	r.cfg.HoldFirstDeposit = true
+
+	first := mustAddRiskDepositInfo(t, s, 1, 1e8)
+	screened, ok, err := r.screen(first)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, StatusWaitApproval, screened.Status)
+
+	second := mustAddRiskDepositInfo(t, s, 2, 1e8)
+	screened, ok, err = r.screen(second)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, StatusRefundPending, screened.Status)
+	require.Equal(t, LimitTotalSkySold, screened.Risk.Rule)
+
+	stored, err := s.GetDepositInfo(second.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, screened, stored)
+}
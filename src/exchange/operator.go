@@ -0,0 +1,518 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/skycoin/exchange-api/exchange/c2cx"
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const (
+	// OperatorComponent is the component recorded in the history of deposits changed by an operator
+	OperatorComponent = "admin"
+
+	// OperatorActionRetry retries an errored deposit
+	OperatorActionRetry = "retry"
+	// OperatorActionSetStatus forces a deposit to a status
+	OperatorActionSetStatus = "set_status"
+	// OperatorActionComplete marks a deposit done with coins that were sent outside of teller
+	OperatorActionComplete = "complete"
+	// OperatorActionSetSkyAddress changes the skycoin address that a deposit pays out to
+	OperatorActionSetSkyAddress = "set_sky_address"
+	// OperatorActionApprove approves a deposit held by a risk rule
+	OperatorActionApprove = "approve"
+	// OperatorActionReject rejects a deposit held by a risk rule, making it a refund candidate
+	OperatorActionReject = "reject"
+	// OperatorActionAdjustLedger posts a manual adjustment to the ledger
+	OperatorActionAdjustLedger = "adjust_ledger"
+	// OperatorActionPause pauses binding, processing a coin type's deposits or sending
+	OperatorActionPause = "pause"
+	// OperatorActionResume resumes what OperatorActionPause paused
+	OperatorActionResume = "resume"
+)
+
+var (
+	// ErrReasonRequired is returned if an operator action is missing a reason
+	ErrReasonRequired = errors.New("A reason is required")
+	// ErrDepositNotErrored is returned when retrying a deposit that has no error
+	ErrDepositNotErrored = errors.New("Deposit has no error to retry")
+	// ErrDepositPartiallyBought is returned when retrying a passthrough deposit that already bought some coins
+	ErrDepositPartiallyBought = errors.New("Deposit has bought coins through passthrough and cannot be retried")
+	// ErrDepositOrderPlaced is returned when moving a passthrough deposit back to a status that would place a second order
+	ErrDepositOrderPlaced = errors.New("Deposit has a passthrough order and can only be moved forward")
+	// ErrDepositInProcess is returned when forcing the status of a deposit that is queued or being processed
+	ErrDepositInProcess = errors.New("Deposit is being processed and has no error")
+	// ErrDepositAlreadySent is returned when an operator action would send a deposit's coins a second time
+	ErrDepositAlreadySent = errors.New("Deposit coins have already been sent")
+	// ErrDepositAlreadyDone is returned when completing a deposit that completed without error
+	ErrDepositAlreadyDone = errors.New("Deposit is already done")
+	// ErrDepositPayoutPending is returned when completing a deposit with another txid than its own payout, which may still confirm
+	ErrDepositPayoutPending = errors.New("Deposit has a payout transaction that may still confirm, complete it with that txid")
+	// ErrStatusNotAllowed is returned when forcing a deposit to a status that cannot be processed
+	ErrStatusNotAllowed = errors.New("Deposit cannot be set to this status")
+	// ErrStatusNotHandled is returned when forcing a deposit to a status that the exchange's processor does not handle
+	ErrStatusNotHandled = errors.New("Deposit status is not handled by this exchange's buy method")
+	// ErrDepositNotWaitingApproval is returned when approving or rejecting a deposit that is not held by a risk rule
+	ErrDepositNotWaitingApproval = errors.New("Deposit is not waiting for approval")
+	// ErrAdjustmentAmountInvalid is returned when adjusting the ledger by an amount that is not positive
+	ErrAdjustmentAmountInvalid = errors.New("Adjustment amount must be positive")
+	// ErrAdjustmentSameAccount is returned when adjusting the ledger with the same debit and credit account
+	ErrAdjustmentSameAccount = errors.New("Adjustment debit and credit accounts must differ")
+)
+
+// Operator provides APIs for an operator to act on deposits.
+// Every action requires the operator's name and a reason, which are recorded in the deposit's history.
+// A changed deposit is resubmitted to the component that handles its new status.
+type Operator interface {
+	RetryDeposit(depositID, actor, reason string) (*DepositInfo, error)
+	SetDepositStatus(depositID, status, actor, reason string) (*DepositInfo, error)
+	CompleteDeposit(depositID, txid string, skySent uint64, actor, reason string) (*DepositInfo, error)
+	SetDepositSkyAddress(depositID, skyAddr, actor, reason string) (*DepositInfo, error)
+	ApproveDeposit(depositID, actor, reason string) (*DepositInfo, error)
+	RejectDeposit(depositID, actor, reason string) (*DepositInfo, error)
+	AdjustLedger(debit, credit, coinType string, amount int64, actor, reason string) (*JournalEntry, error)
+	Pause(target, coinType, actor, reason string) (*PauseChange, error)
+	Resume(target, coinType, actor, reason string) (*PauseChange, error)
+}
+
+// Resubmitter is implemented by components that accept deposits changed by an operator
+type Resubmitter interface {
+	Resubmit(DepositInfo) error
+}
+
+// RetryDeposit clears a deposit's error and restarts it from StatusWaitDecide.
+// A deposit whose coins were already sent only has its error cleared.
+// A passthrough deposit is given a new CustomerID so that a new order can be placed,
+// unless it placed an order that is not known to have finished without buying anything.
+func (e *Exchange) RetryDeposit(depositID, actor, reason string) (*DepositInfo, error) {
+	return e.operate(depositID, OperatorActionRetry, actor, reason, func(di DepositInfo) (DepositInfo, error) {
+		if di.Error == "" {
+			return di, ErrDepositNotErrored
+		}
+
+		di.Error = ""
+
+		if di.Txid != "" {
+			return di, nil
+		}
+
+		if di.Passthrough.SkyBought != 0 {
+			return di, ErrDepositPartiallyBought
+		}
+
+		if di.Passthrough.Order.OrderID != "" && !orderFinalUnfilled(di.Passthrough.Order) {
+			return di, ErrDepositOrderPlaced
+		}
+
+		if di.BuyMethod == config.BuyMethodPassthrough || di.Passthrough.ExchangeName != "" {
+			di.Passthrough = PassthroughData{
+				Order: PassthroughOrder{
+					CustomerID: fmt.Sprintf("%s:retry:%d", di.DepositID, time.Now().UTC().Unix()),
+				},
+			}
+		}
+
+		di.Status = StatusWaitDecide
+		di.SkySent = 0
+
+		return di, nil
+	}, alwaysResubmit)
+}
+
+// orderFinalUnfilled returns true if a passthrough order has a final status and bought nothing.
+// Orders that ended with a fatal status only record the original order returned by the exchange, so it is read from there.
+func orderFinalUnfilled(o PassthroughOrder) bool {
+	if !o.Final {
+		return false
+	}
+
+	completedAmount := o.CompletedAmount
+	if completedAmount == "" {
+		if o.Original == "" {
+			return false
+		}
+
+		var order c2cx.Order
+		if err := json.Unmarshal([]byte(o.Original), &order); err != nil {
+			return false
+		}
+
+		return order.CompletedAmount.Sign() == 0
+	}
+
+	amount, err := decimal.NewFromString(completedAmount)
+	if err != nil {
+		return false
+	}
+
+	return amount.Sign() == 0
+}
+
+// SetDepositStatus forces a deposit to a status and clears its error.
+// Only errored deposits and deposits that are not being processed can be changed.
+// A deposit whose coins were already sent cannot be moved back to a status that would send them again,
+// and a passthrough deposit that placed an order cannot be moved back to a status that would place another.
+func (e *Exchange) SetDepositStatus(depositID, status, actor, reason string) (*DepositInfo, error) {
+	if err := ValidateStatus(status); err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case StatusWaitDeposit, StatusUnknown, StatusFailed, StatusWaitApproval, StatusRefundPending:
+		return nil, ErrStatusNotAllowed
+	}
+
+	if _, ok := e.resubmitter(status); !ok {
+		return nil, ErrStatusNotHandled
+	}
+
+	return e.operate(depositID, OperatorActionSetStatus, actor, reason, func(di DepositInfo) (DepositInfo, error) {
+		// A deposit without an error is still queued or in flight,
+		// and resubmitting it would process it twice
+		if di.Error == "" && isProcessedStatus(di.Status) {
+			return di, ErrDepositInProcess
+		}
+
+		switch status {
+		case StatusWaitDecide, StatusWaitPassthrough, StatusWaitPassthroughOrderComplete, StatusWaitSend:
+			if di.Txid != "" {
+				return di, ErrDepositAlreadySent
+			}
+		}
+
+		switch status {
+		case StatusWaitDecide, StatusWaitPassthrough:
+			if di.Passthrough.Order.OrderID != "" || di.Passthrough.SkyBought != 0 {
+				return di, ErrDepositOrderPlaced
+			}
+		}
+
+		switch status {
+		case StatusWaitPassthrough, StatusWaitPassthroughOrderComplete:
+			if di.BuyMethod != config.BuyMethodPassthrough {
+				return di, ErrStatusNotHandled
+			}
+		}
+
+		di.Status = status
+		di.Error = ""
+
+		return di, nil
+	}, alwaysResubmit)
+}
+
+// CompleteDeposit marks a deposit done with the txid of coins that were sent outside of teller.
+// If skySent is 0, the deposit's recorded SkySent is kept.
+// A deposit without an error whose payout teller already created can only be completed with that payout's txid,
+// so that the payout and the coins sent outside of teller are not both paid.
+func (e *Exchange) CompleteDeposit(depositID, txid string, skySent uint64, actor, reason string) (*DepositInfo, error) {
+	if _, err := cipher.SHA256FromHex(txid); err != nil {
+		return nil, fmt.Errorf("Invalid txid: %v", err)
+	}
+
+	return e.operate(depositID, OperatorActionComplete, actor, reason, func(di DepositInfo) (DepositInfo, error) {
+		if di.Status == StatusDone && di.Error == "" {
+			return di, ErrDepositAlreadyDone
+		}
+
+		if di.Error == "" && di.Txid != "" && di.Txid != txid {
+			return di, ErrDepositPayoutPending
+		}
+
+		di.Status = StatusDone
+		di.Txid = txid
+		di.Error = ""
+		if skySent != 0 {
+			di.SkySent = skySent
+		}
+
+		return di, nil
+	}, alwaysResubmit)
+}
+
+// SetDepositSkyAddress changes the skycoin address that a deposit's coins are sent to.
+// The address cannot be changed once the coins have been sent.
+func (e *Exchange) SetDepositSkyAddress(depositID, skyAddr, actor, reason string) (*DepositInfo, error) {
+	if _, err := e.cfg.Coin.DecodeAddress(skyAddr); err != nil {
+		return nil, fmt.Errorf("Invalid %s address: %v", e.cfg.Coin.Name, err)
+	}
+
+	return e.operate(depositID, OperatorActionSetSkyAddress, actor, reason, func(di DepositInfo) (DepositInfo, error) {
+		if di.Txid != "" || di.Status == StatusWaitConfirm || di.Status == StatusDone {
+			return di, ErrDepositAlreadySent
+		}
+
+		di.SkyAddress = skyAddr
+
+		return di, nil
+	}, func(di DepositInfo) bool {
+		// Other statuses read the new address from the store when they are next updated,
+		// but a queued StatusWaitSend copy is dropped by Send once it sees the change
+		return di.Status == StatusWaitSend
+	})
+}
+
+// ApproveDeposit releases a deposit held by a risk rule for processing.
+// The risk rules are not checked again for an approved deposit.
+func (e *Exchange) ApproveDeposit(depositID, actor, reason string) (*DepositInfo, error) {
+	return e.operate(depositID, OperatorActionApprove, actor, reason, func(di DepositInfo) (DepositInfo, error) {
+		if di.Status != StatusWaitApproval {
+			return di, ErrDepositNotWaitingApproval
+		}
+
+		di.Status = StatusWaitDecide
+		di.Risk.Approved = true
+
+		return di, nil
+	}, alwaysResubmit)
+}
+
+// RejectDeposit rejects a deposit held by a risk rule. The deposit is set to StatusRefundPending
+// and is not processed further; its coins should be refunded by the operator.
+func (e *Exchange) RejectDeposit(depositID, actor, reason string) (*DepositInfo, error) {
+	return e.operate(depositID, OperatorActionReject, actor, reason, func(di DepositInfo) (DepositInfo, error) {
+		if di.Status != StatusWaitApproval {
+			return di, ErrDepositNotWaitingApproval
+		}
+
+		di.Status = StatusRefundPending
+
+		return di, nil
+	}, alwaysResubmit)
+}
+
+// AdjustLedger posts a manual adjustment to the ledger, debiting one account and crediting another by amount.
+// The amount is measured in the smallest unit of coinType.
+// Use it to record value movements made outside of teller, e.g. funding the hot wallet or paying a refund.
+func (e *Exchange) AdjustLedger(debit, credit, coinType string, amount int64, actor, reason string) (*JournalEntry, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+
+	if amount <= 0 {
+		return nil, ErrAdjustmentAmountInvalid
+	}
+
+	if debit == credit {
+		return nil, ErrAdjustmentSameAccount
+	}
+
+	log := e.log.WithField("action", OperatorActionAdjustLedger).WithField("actor", actor)
+
+	je, err := e.store.AddJournalEntry(JournalEntry{
+		Type:  EntryAdjustment,
+		Actor: actor,
+		Memo:  reason,
+		Postings: []Posting{
+			{Account: debit, CoinType: coinType, Amount: amount},
+			{Account: credit, CoinType: coinType, Amount: -amount},
+		},
+	})
+	if err != nil {
+		log.WithError(err).Error("Operator action failed")
+		return nil, err
+	}
+
+	log.WithField("journalEntry", je).WithField("reason", reason).Info("Operator action applied")
+
+	return &je, nil
+}
+
+// Pause pauses binding, processing the deposits of coinType or sending until Resume is called.
+// The pause is recorded in the db and lasts across restarts.
+// Pausing sending waits for a transaction being created or broadcast to finish,
+// so that no transaction is broadcast once it returns.
+func (e *Exchange) Pause(target, coinType, actor, reason string) (*PauseChange, error) {
+	return e.setPaused(target, coinType, true, actor, reason)
+}
+
+// Resume resumes binding, processing the deposits of coinType or sending paused by Pause.
+// The deposits received while processing was paused are queued for processing.
+func (e *Exchange) Resume(target, coinType, actor, reason string) (*PauseChange, error) {
+	return e.setPaused(target, coinType, false, actor, reason)
+}
+
+// sendWaiter is implemented by senders that can wait for a transaction being created or broadcast
+type sendWaiter interface {
+	waitSend()
+}
+
+func (e *Exchange) setPaused(target, coinType string, paused bool, actor, reason string) (*PauseChange, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+
+	if err := ValidatePause(target, coinType); err != nil {
+		return nil, err
+	}
+
+	action := OperatorActionResume
+	if paused {
+		action = OperatorActionPause
+	}
+
+	log := e.log.WithField("action", action).WithField("actor", actor).WithField("target", target)
+	if coinType != "" {
+		log = log.WithField("coinType", coinType)
+	}
+
+	c, held, err := e.applyPause(PauseChange{
+		Target:   target,
+		CoinType: coinType,
+		Paused:   paused,
+		Actor:    actor,
+		Reason:   reason,
+	})
+	if err != nil {
+		log.WithError(err).Error("Operator action failed")
+		return nil, err
+	}
+
+	if target == PauseSend && paused {
+		if w, ok := e.Sender.(sendWaiter); ok {
+			w.waitSend()
+		}
+	}
+
+	log.WithField("pauseChange", c).WithField("notice", logger.WatchNotice).Info("Operator action applied")
+
+	// Queue the deposits that were held while processing was paused
+	for _, depositID := range held {
+		di, err := e.store.GetDepositInfo(depositID)
+		if err != nil {
+			log.WithField("depositID", depositID).WithError(err).Error("GetDepositInfo failed")
+			continue
+		}
+
+		// The deposit may have been changed by an operator while it was held
+		if di.Status != StatusWaitDecide {
+			continue
+		}
+
+		if err := e.resubmit(di); err != nil {
+			log.WithField("depositInfo", di).WithField("notice", logger.WatchNotice).WithError(err).Error("Resubmitting held deposit failed. This deposit will not be reprocessed until teller is restarted.")
+		}
+	}
+
+	return &c, nil
+}
+
+// applyPause records a pause change and applies it, returning the IDs of the deposits held while processing was paused
+func (e *Exchange) applyPause(c PauseChange) (PauseChange, []string, error) {
+	e.pauseLock.Lock()
+	defer e.pauseLock.Unlock()
+
+	if e.pauses.Paused(c.Target, c.CoinType) == c.Paused {
+		if c.Paused {
+			return c, nil, ErrAlreadyPaused
+		}
+		return c, nil, ErrNotPaused
+	}
+
+	c, err := e.store.AddPauseChange(c)
+	if err != nil {
+		return c, nil, err
+	}
+
+	return c, e.pauses.set(c), nil
+}
+
+func alwaysResubmit(DepositInfo) bool {
+	return true
+}
+
+// operate applies an operator action to a deposit, then resubmits the deposit for processing if resubmit returns true.
+// The change is rolled back if update fails or the updated deposit is invalid.
+func (e *Exchange) operate(depositID, action, actor, reason string, update func(DepositInfo) (DepositInfo, error), resubmit func(DepositInfo) bool) (*DepositInfo, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+
+	log := e.log.WithField("depositID", depositID).WithField("action", action).WithField("actor", actor)
+
+	store := withOperator(e.store, action, actor, reason)
+
+	var updateErr error
+	di, err := store.UpdateDepositInfoCallback(depositID, func(di DepositInfo) DepositInfo {
+		newDi, err := update(di)
+		if err != nil {
+			updateErr = err
+			return di
+		}
+		return newDi
+	}, func(di DepositInfo) error {
+		if updateErr != nil {
+			return updateErr
+		}
+
+		if _, ok := e.resubmitter(di.Status); !ok {
+			return ErrStatusNotHandled
+		}
+
+		return di.ValidateForStatus()
+	})
+	if err != nil {
+		log.WithError(err).Error("Operator action failed")
+		return nil, err
+	}
+
+	log = log.WithField("depositInfo", di)
+	log.WithField("reason", reason).Info("Operator action applied")
+
+	if !resubmit(di) {
+		return &di, nil
+	}
+
+	if err := e.resubmit(di); err != nil {
+		log.WithField("notice", logger.WatchNotice).WithError(err).Error("Resubmitting deposit failed. This deposit will not be reprocessed until teller is restarted.")
+		return nil, err
+	}
+
+	return &di, nil
+}
+
+// resubmitter returns the component that processes deposits of a status.
+// Finished and held deposits are not processed, so the returned Resubmitter is nil.
+func (e *Exchange) resubmitter(status string) (Resubmitter, bool) {
+	if !isProcessedStatus(status) {
+		return nil, true
+	}
+
+	var component interface{}
+	switch status {
+	case StatusWaitDecide:
+		component = e.Receiver
+	case StatusWaitPassthrough, StatusWaitPassthroughOrderComplete:
+		// Only passthrough processors implement Resubmitter
+		component = e.Processor
+	case StatusWaitSend, StatusWaitConfirm:
+		component = e.Sender
+	default:
+		return nil, false
+	}
+
+	r, ok := component.(Resubmitter)
+	return r, ok
+}
+
+// resubmit queues a deposit changed by an operator on the component that handles its status
+func (e *Exchange) resubmit(di DepositInfo) error {
+	r, ok := e.resubmitter(di.Status)
+	if !ok {
+		return ErrStatusNotHandled
+	}
+
+	if r == nil {
+		return nil
+	}
+
+	return r.Resubmit(di)
+}
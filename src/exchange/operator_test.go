@@ -0,0 +1,566 @@
+package exchange
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+const (
+	testOperatorTxid = "c2ab0a2bb6e0fa5cd4ba2ab0a0a1a8a1ec9a4ff5da6c1fb2c1b1c8e4a2d6c0a1"
+)
+
+func setupOperatorExchange(t *testing.T, buyMethod string) (*Exchange, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+	e := newTestExchange(t, buyMethod, log, db)
+	return e, func() {
+		closeMultiplexer(e)
+		shutdown()
+	}
+}
+
+func newOperatorDepositInfo(status string) DepositInfo {
+	return DepositInfo{
+		Seq:            1,
+		Status:         status,
+		CoinType:       config.CoinTypeBTC,
+		SkyAddress:     testSkyAddr,
+		BuyMethod:      config.BuyMethodDirect,
+		DepositAddress: "foo-deposit-addr",
+		DepositID:      "foo-deposit-id:1",
+		ConversionRate: testSkyBtcRate,
+		DepositValue:   1e8,
+	}
+}
+
+func mustAddOperatorDepositInfo(t *testing.T, e *Exchange, di DepositInfo) DepositInfo {
+	di, err := e.store.(*Store).addDepositInfo(di)
+	require.NoError(t, err)
+	return di
+}
+
+func requireQueued(t *testing.T, c <-chan DepositInfo, expected DepositInfo) {
+	select {
+	case di := <-c:
+		require.Equal(t, expected, di)
+	default:
+		t.Fatal("Expected deposit to be resubmitted")
+	}
+}
+
+func requireNotQueued(t *testing.T, c <-chan DepositInfo) {
+	select {
+	case di := <-c:
+		t.Fatalf("Unexpected resubmitted deposit %+v", di)
+	default:
+	}
+}
+
+func requireLastOperatorTransition(t *testing.T, e *Exchange, depositID, action, fromStatus, toStatus string) {
+	history, err := e.store.GetDepositHistory(depositID)
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+
+	last := history[len(history)-1]
+	require.Equal(t, OperatorComponent, last.Component)
+	require.Equal(t, action, last.Action)
+	require.Equal(t, "alice", last.Actor)
+	require.Equal(t, "support ticket", last.Reason)
+	require.Equal(t, fromStatus, last.FromStatus)
+	require.Equal(t, toStatus, last.ToStatus)
+}
+
+func TestExchangeRetryDeposit(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	receiver := e.Receiver.(*Receive)
+
+	di := newOperatorDepositInfo(StatusWaitSend)
+	di.Error = "skycoin node unavailable"
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	_, err := e.RetryDeposit(di.DepositID, "alice", " ")
+	require.Equal(t, ErrReasonRequired, err)
+
+	_, err = e.RetryDeposit("missing-deposit-id:1", "alice", "support ticket")
+	require.IsType(t, dbutil.ObjectNotExistErr{}, err)
+
+	retried, err := e.RetryDeposit(di.DepositID, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitDecide, retried.Status)
+	require.Empty(t, retried.Error)
+
+	requireQueued(t, receiver.Deposits(), *retried)
+	requireLastOperatorTransition(t, e, di.DepositID, OperatorActionRetry, StatusWaitSend, StatusWaitDecide)
+
+	// A deposit without an error cannot be retried
+	_, err = e.RetryDeposit(di.DepositID, "alice", "support ticket")
+	require.Equal(t, ErrDepositNotErrored, err)
+	requireNotQueued(t, receiver.Deposits())
+
+	// A sent deposit only has its error cleared
+	sent := newOperatorDepositInfo(StatusDone)
+	sent.Seq = 2
+	sent.DepositID = "foo-deposit-id:2"
+	sent.Txid = testOperatorTxid
+	sent.Error = "unexpected error"
+	sent = mustAddOperatorDepositInfo(t, e, sent)
+
+	retried, err = e.RetryDeposit(sent.DepositID, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, retried.Status)
+	require.Equal(t, testOperatorTxid, retried.Txid)
+	require.Empty(t, retried.Error)
+	requireNotQueued(t, receiver.Deposits())
+}
+
+func TestExchangeRetryPassthroughDeposit(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodPassthrough)
+	defer shutdown()
+
+	newFailedDepositInfo := func(seq uint64) DepositInfo {
+		di := newOperatorDepositInfo(StatusWaitPassthroughOrderComplete)
+		di.Seq = seq
+		di.DepositID = fmt.Sprintf("foo-deposit-id:%d", seq)
+		di.BuyMethod = config.BuyMethodPassthrough
+		di.Error = "limit value: 0.001"
+		di.Passthrough = PassthroughData{
+			ExchangeName:    PassthroughExchangeC2CX,
+			RequestedAmount: "1.00000",
+			Order: PassthroughOrder{
+				CustomerID:      di.DepositID,
+				OrderID:         "1234",
+				CompletedAmount: "0",
+				Status:          "Cancelled",
+				Final:           true,
+			},
+		}
+		return di
+	}
+
+	di := mustAddOperatorDepositInfo(t, e, newFailedDepositInfo(1))
+
+	retried, err := e.RetryDeposit(di.DepositID, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitDecide, retried.Status)
+	require.Empty(t, retried.Passthrough.Order.OrderID)
+	require.True(t, strings.HasPrefix(retried.Passthrough.Order.CustomerID, di.DepositID+":retry:"))
+
+	requireQueued(t, e.Receiver.(*Receive).Deposits(), *retried)
+
+	// The WaitDecide step keeps the retry CustomerID
+	p := e.Processor.(*Passthrough)
+	updated, err := p.handleDepositInfoState(*retried)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitPassthrough, updated.Status)
+	require.Equal(t, retried.Passthrough.Order.CustomerID, updated.Passthrough.Order.CustomerID)
+
+	// A deposit that bought coins cannot be retried
+	bought := newFailedDepositInfo(2)
+	bought.Passthrough.SkyBought = 1e6
+	bought = mustAddOperatorDepositInfo(t, e, bought)
+
+	_, err = e.RetryDeposit(bought.DepositID, "alice", "support ticket")
+	require.Equal(t, ErrDepositPartiallyBought, err)
+
+	// A deposit whose order was placed but not filled cannot be retried,
+	// since the order could still be filled and a second order would buy twice
+	placed := newFailedDepositInfo(3)
+	placed.Status = StatusWaitPassthroughOrderComplete
+	placed.Error = "GetOrderInfo failed"
+	placed.Passthrough.Order.CompletedAmount = ""
+	placed.Passthrough.Order.Status = ""
+	placed.Passthrough.Order.Final = false
+	placed = mustAddOperatorDepositInfo(t, e, placed)
+
+	_, err = e.RetryDeposit(placed.DepositID, "alice", "support ticket")
+	require.Equal(t, ErrDepositOrderPlaced, err)
+
+	stored, err := e.store.(*Store).GetDepositInfo(placed.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, placed, stored)
+
+	// A final order that bought some coins cannot be retried either
+	filled := newFailedDepositInfo(4)
+	filled.Passthrough.Order.CompletedAmount = "0.5"
+	filled = mustAddOperatorDepositInfo(t, e, filled)
+
+	_, err = e.RetryDeposit(filled.DepositID, "alice", "support ticket")
+	require.Equal(t, ErrDepositOrderPlaced, err)
+
+	// A final order recorded without a completed amount is read from the original order
+	original := newFailedDepositInfo(5)
+	original.Passthrough.Order.CompletedAmount = ""
+	original.Passthrough.Order.Original = `{"completedAmount":"0","status":5}`
+	original = mustAddOperatorDepositInfo(t, e, original)
+
+	retried, err = e.RetryDeposit(original.DepositID, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitDecide, retried.Status)
+}
+
+func TestExchangeSetDepositStatus(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	send := e.Sender.(*Send)
+
+	di := newOperatorDepositInfo(StatusWaitDecide)
+	di.Error = "unexpected error"
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	_, err := e.SetDepositStatus(di.DepositID, "foo", "alice", "support ticket")
+	require.Equal(t, ErrInvalidStatus, err)
+
+	_, err = e.SetDepositStatus(di.DepositID, StatusWaitDeposit, "alice", "support ticket")
+	require.Equal(t, ErrStatusNotAllowed, err)
+
+	// The direct buy processor does not handle passthrough statuses
+	_, err = e.SetDepositStatus(di.DepositID, StatusWaitPassthrough, "alice", "support ticket")
+	require.Equal(t, ErrStatusNotHandled, err)
+
+	// An invalid deposit is rolled back
+	_, err = e.SetDepositStatus(di.DepositID, StatusDone, "alice", "support ticket")
+	require.Error(t, err)
+
+	stored, err := e.store.(*Store).GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, di, stored)
+
+	history, err := e.store.GetDepositHistory(di.DepositID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	updated, err := e.SetDepositStatus(di.DepositID, StatusWaitSend, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, updated.Status)
+	require.Empty(t, updated.Error)
+
+	requireQueued(t, send.depositChan, *updated)
+	requireLastOperatorTransition(t, e, di.DepositID, OperatorActionSetStatus, StatusWaitDecide, StatusWaitSend)
+
+	// The deposit is queued again, so it cannot be changed until it fails
+	_, err = e.SetDepositStatus(di.DepositID, StatusWaitSend, "alice", "support ticket")
+	require.Equal(t, ErrDepositInProcess, err)
+	requireNotQueued(t, send.depositChan)
+
+	// A sent deposit cannot be sent again
+	_, err = e.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = testOperatorTxid
+		di.SkySent = 100e6
+		di.Error = "unexpected error"
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = e.SetDepositStatus(di.DepositID, StatusWaitSend, "alice", "support ticket")
+	require.Equal(t, ErrDepositAlreadySent, err)
+	requireNotQueued(t, send.depositChan)
+}
+
+func TestExchangeSetPassthroughDepositStatus(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodPassthrough)
+	defer shutdown()
+
+	p := e.Processor.(*Passthrough)
+
+	di := newOperatorDepositInfo(StatusWaitPassthroughOrderComplete)
+	di.BuyMethod = config.BuyMethodPassthrough
+	di.Error = "GetOrderInfo failed"
+	di.Passthrough = PassthroughData{
+		ExchangeName:    PassthroughExchangeC2CX,
+		RequestedAmount: "1.00000",
+		Order: PassthroughOrder{
+			CustomerID: di.DepositID,
+			OrderID:    "1234",
+		},
+	}
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	// A deposit that placed an order cannot place another
+	for _, status := range []string{StatusWaitDecide, StatusWaitPassthrough} {
+		_, err := e.SetDepositStatus(di.DepositID, status, "alice", "support ticket")
+		require.Equal(t, ErrDepositOrderPlaced, err)
+	}
+	requireNotQueued(t, p.internalDeposits)
+
+	// It can be moved forward to wait for its order again
+	updated, err := e.SetDepositStatus(di.DepositID, StatusWaitPassthroughOrderComplete, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, di.Passthrough, updated.Passthrough)
+	requireQueued(t, p.internalDeposits, *updated)
+}
+
+func TestExchangeCompleteDeposit(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	di := newOperatorDepositInfo(StatusWaitSend)
+	di.Error = "insufficient balance"
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	_, err := e.CompleteDeposit(di.DepositID, "foo", 0, "alice", "support ticket")
+	require.Error(t, err)
+
+	completed, err := e.CompleteDeposit(di.DepositID, testOperatorTxid, 100e6, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, completed.Status)
+	require.Equal(t, testOperatorTxid, completed.Txid)
+	require.Equal(t, uint64(100e6), completed.SkySent)
+	require.Empty(t, completed.Error)
+
+	requireNotQueued(t, e.Sender.(*Send).depositChan)
+	requireLastOperatorTransition(t, e, di.DepositID, OperatorActionComplete, StatusWaitSend, StatusDone)
+
+	_, err = e.CompleteDeposit(di.DepositID, testOperatorTxid, 0, "alice", "support ticket")
+	require.Equal(t, ErrDepositAlreadyDone, err)
+}
+
+func TestExchangeCompleteDepositPayoutPending(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	// The deposit's own payout is waiting to confirm
+	di := newOperatorDepositInfo(StatusWaitConfirm)
+	di.Txid = testOperatorTxid
+	di.SkySent = 100e6
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	otherTxid := "1b8e4ce9e01b3fe1bb2fcd8a8f98ae8d55f66fcb0e01d1b6f15bbe4e1aeae4a7"
+	_, err := e.CompleteDeposit(di.DepositID, otherTxid, 100e6, "alice", "sent from the cold wallet")
+	require.Equal(t, ErrDepositPayoutPending, err)
+
+	unchanged, err := e.store.GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, unchanged.Status)
+	require.Equal(t, testOperatorTxid, unchanged.Txid)
+
+	// It can be completed with its own payout's txid
+	completed, err := e.CompleteDeposit(di.DepositID, testOperatorTxid, 0, "alice", "confirmed on the explorer")
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, completed.Status)
+	require.Equal(t, uint64(100e6), completed.SkySent)
+
+	// An errored deposit with a payout txid can be completed with another txid
+	errored := newOperatorDepositInfo(StatusWaitConfirm)
+	errored.DepositID = "errored-deposit:1"
+	errored.Txid = testOperatorTxid
+	errored.SkySent = 100e6
+	errored.Error = "transaction was not confirmed"
+	errored = mustAddOperatorDepositInfo(t, e, errored)
+
+	completed, err = e.CompleteDeposit(errored.DepositID, otherTxid, 100e6, "alice", "sent from the cold wallet")
+	require.NoError(t, err)
+	require.Equal(t, otherTxid, completed.Txid)
+}
+
+func TestExchangeSetDepositSkyAddress(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	send := e.Sender.(*Send)
+
+	di := newOperatorDepositInfo(StatusWaitDecide)
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	_, err := e.SetDepositSkyAddress(di.DepositID, "foo", "alice", "support ticket")
+	require.Error(t, err)
+
+	// A StatusWaitDecide deposit reads the new address on its next update, and is not resubmitted
+	updated, err := e.SetDepositSkyAddress(di.DepositID, testSkyAddr2, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, testSkyAddr2, updated.SkyAddress)
+	require.Equal(t, StatusWaitDecide, updated.Status)
+	requireNotQueued(t, e.Receiver.(*Receive).Deposits())
+
+	history, err := e.store.GetDepositHistory(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, testSkyAddr2, history[len(history)-1].SkyAddress)
+	requireLastOperatorTransition(t, e, di.DepositID, OperatorActionSetSkyAddress, StatusWaitDecide, StatusWaitDecide)
+
+	// A StatusWaitSend deposit is resubmitted
+	_, err = e.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+
+	updated, err = e.SetDepositSkyAddress(di.DepositID, testSkyAddr, "alice", "support ticket")
+	require.NoError(t, err)
+	requireQueued(t, send.depositChan, *updated)
+
+	// The address of a sent deposit cannot be changed
+	_, err = e.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = testOperatorTxid
+		di.SkySent = 100e6
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = e.SetDepositSkyAddress(di.DepositID, testSkyAddr2, "alice", "support ticket")
+	require.Equal(t, ErrDepositAlreadySent, err)
+}
+
+func TestSendChangedDepositNotSent(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	di := newOperatorDepositInfo(StatusWaitSend)
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	// The operator changes the address of the queued deposit
+	_, err := e.SetDepositSkyAddress(di.DepositID, testSkyAddr2, "alice", "support ticket")
+	require.NoError(t, err)
+
+	// The stale copy is not sent
+	_, err = e.Sender.(*Send).handleDepositInfoState(di)
+	require.Equal(t, ErrDepositChanged, err)
+
+	stored, err := e.store.(*Store).GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, stored.Status)
+	require.Empty(t, stored.Txid)
+
+	// The resubmitted copy is sent to the new address
+	resubmitted := <-e.Sender.(*Send).depositChan
+	sent, err := e.Sender.(*Send).handleDepositInfoState(resubmitted)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, sent.Status)
+	require.Equal(t, testSkyAddr2, sent.SkyAddress)
+}
+
+func TestExchangeApproveDeposit(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	receiver := e.Receiver.(*Receive)
+	receiver.risk.cfg.BtcMaxDeposit = "0.5"
+
+	di := newOperatorDepositInfo(StatusWaitApproval)
+	di.Risk = RiskData{
+		Rule:   RiskRuleMaxDeposit,
+		Detail: "Deposit of 1 BTC is larger than the maximum of 0.5 BTC",
+	}
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	// The approved deposit is queued although it still matches the rule
+	approved, err := e.ApproveDeposit(di.DepositID, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitDecide, approved.Status)
+	require.True(t, approved.Risk.Approved)
+	require.Equal(t, RiskRuleMaxDeposit, approved.Risk.Rule)
+
+	requireQueued(t, receiver.Deposits(), *approved)
+	requireLastOperatorTransition(t, e, di.DepositID, OperatorActionApprove, StatusWaitApproval, StatusWaitDecide)
+
+	_, err = e.ApproveDeposit(di.DepositID, "alice", "support ticket")
+	require.Equal(t, ErrDepositNotWaitingApproval, err)
+	requireNotQueued(t, receiver.Deposits())
+
+	// Held deposits cannot be forced to another status, or to the held statuses
+	_, err = e.SetDepositStatus(di.DepositID, StatusWaitApproval, "alice", "support ticket")
+	require.Equal(t, ErrStatusNotAllowed, err)
+	_, err = e.SetDepositStatus(di.DepositID, StatusRefundPending, "alice", "support ticket")
+	require.Equal(t, ErrStatusNotAllowed, err)
+}
+
+func TestExchangeRejectDeposit(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	receiver := e.Receiver.(*Receive)
+
+	di := newOperatorDepositInfo(StatusWaitApproval)
+	di.Risk = RiskData{
+		Rule:   RiskRuleFirstDeposit,
+		Detail: testSkyAddr + " has not completed a deposit before",
+	}
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	rejected, err := e.RejectDeposit(di.DepositID, "alice", "support ticket")
+	require.NoError(t, err)
+	require.Equal(t, StatusRefundPending, rejected.Status)
+	require.False(t, rejected.Risk.Approved)
+
+	requireNotQueued(t, receiver.Deposits())
+	requireNotQueued(t, e.Sender.(*Send).depositChan)
+	requireLastOperatorTransition(t, e, di.DepositID, OperatorActionReject, StatusWaitApproval, StatusRefundPending)
+
+	_, err = e.RejectDeposit(di.DepositID, "alice", "support ticket")
+	require.Equal(t, ErrDepositNotWaitingApproval, err)
+
+	_, err = e.ApproveDeposit(di.DepositID, "alice", "support ticket")
+	require.Equal(t, ErrDepositNotWaitingApproval, err)
+}
+
+func TestExchangeAdjustLedger(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	_, err := e.AdjustLedger(AccountHotWallet, AccountAdjustments, config.CoinTypeSKY, 1e6, "alice", "")
+	require.Equal(t, ErrReasonRequired, err)
+
+	_, err = e.AdjustLedger(AccountHotWallet, AccountAdjustments, config.CoinTypeSKY, 0, "alice", "funded")
+	require.Equal(t, ErrAdjustmentAmountInvalid, err)
+
+	_, err = e.AdjustLedger(AccountHotWallet, AccountHotWallet, config.CoinTypeSKY, 1e6, "alice", "funded")
+	require.Equal(t, ErrAdjustmentSameAccount, err)
+
+	_, err = e.AdjustLedger("assets:bank", AccountAdjustments, config.CoinTypeSKY, 1e6, "alice", "funded")
+	require.Error(t, err)
+
+	je, err := e.AdjustLedger(AccountHotWallet, AccountAdjustments, config.CoinTypeSKY, 1e6, "alice", "funded")
+	require.NoError(t, err)
+	require.Equal(t, EntryAdjustment, je.Type)
+	require.Equal(t, "alice", je.Actor)
+	require.Equal(t, "funded", je.Memo)
+	require.NotZero(t, je.Timestamp)
+
+	entries, err := e.GetJournalEntries(0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []JournalEntry{*je}, entries)
+
+	balances, err := e.GetLedgerBalances(0)
+	require.NoError(t, err)
+	require.Equal(t, LedgerBalances{
+		AccountHotWallet:   {config.CoinTypeSKY: 1e6},
+		AccountAdjustments: {config.CoinTypeSKY: -1e6},
+	}, balances)
+}
+
+func TestReceiveHoldsRiskyDeposit(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	receiver := e.Receiver.(*Receive)
+	receiver.risk.cfg.BtcMaxDeposit = "0.5"
+
+	di := newOperatorDepositInfo(StatusWaitDecide)
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	err := receiver.Resubmit(di)
+	require.NoError(t, err)
+	requireNotQueued(t, receiver.Deposits())
+
+	stored, err := e.store.(*Store).GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitApproval, stored.Status)
+	require.Equal(t, RiskRuleMaxDeposit, stored.Risk.Rule)
+
+	// Held deposits are not retried
+	e.Retrier.cfg = config.Retry{MaxAttempts: 1}
+	e.Retrier.Fail("directbuy", stored, ErrDepositChanged)
+	stored, err = e.store.(*Store).GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitApproval, stored.Status)
+}
@@ -36,6 +36,7 @@ var (
 	ErrInsufficientExchangeBalance = errors.New("Exchange balance is insufficient")
 
 	errCompletedAmountNegative = errors.New("Calculated amount of SKY bought is unexpectedly negative")
+	errFeeNegative             = errors.New("Calculated exchange fee is unexpectedly negative")
 	errQuit                    = errors.New("quit")
 )
 
@@ -60,6 +61,7 @@ type Passthrough struct {
 	statusLock       sync.RWMutex
 	status           error
 	exchangeClient   C2CXClient
+	failer           DepositFailer // Handles deposits that failed processing
 }
 
 // C2CXClient defines an interface for c2cx.Client
@@ -89,7 +91,7 @@ func NewPassthrough(log logrus.FieldLogger, cfg config.SkyExchanger, store Store
 	return &Passthrough{
 		log:              log.WithField("prefix", "teller.exchange.passthrough"),
 		cfg:              cfg,
-		store:            store,
+		store:            withComponent(store, "passthrough"),
 		receiver:         receiver,
 		internalDeposits: make(chan DepositInfo, 100),
 		deposits:         make(chan DepositInfo, 100),
@@ -126,21 +128,21 @@ func (p *Passthrough) Run() error {
 	}
 
 	// Load StatusWaitPassthrough and StatusWaitPassthroughOrderComplete deposits for reprocessing
-	waitPassthroughDeposits, err := p.store.GetDepositInfoArray(func(di DepositInfo) bool {
-		return di.Status == StatusWaitPassthrough
+	waitPassthroughDeposits, err := p.store.QueryDepositInfo(DepositQuery{
+		Statuses: []string{StatusWaitPassthrough},
 	})
 
 	if err != nil {
-		log.WithError(err).Error("GetDepositInfoArray failed")
+		log.WithError(err).Error("QueryDepositInfo failed")
 		return err
 	}
 
-	waitPassthroughOrderCompleteDeposits, err := p.store.GetDepositInfoArray(func(di DepositInfo) bool {
-		return di.Status == StatusWaitPassthroughOrderComplete
+	waitPassthroughOrderCompleteDeposits, err := p.store.QueryDepositInfo(DepositQuery{
+		Statuses: []string{StatusWaitPassthroughOrderComplete},
 	})
 
 	if err != nil {
-		log.WithError(err).Error("GetDepositInfoArray failed")
+		log.WithError(err).Error("QueryDepositInfo failed")
 		return err
 	}
 
@@ -196,11 +198,13 @@ func (p *Passthrough) runBuy() {
 			log := log.WithField("depositInfo", d)
 
 			if err != nil {
-				msg := "handleDeposit failed, this deposit will be reprocessed when teller is restarted"
 				if d.Status == StatusDone {
-					msg = "handleDeposit failed, this deposit will never be reprocessed. If this is a mistake, you must recover manually"
+					msg := "handleDeposit failed, this deposit will never be reprocessed. If this is a mistake, you must recover manually"
+					log.WithField("notice", logger.WatchNotice).WithError(err).Error(msg)
+				} else {
+					log.WithError(err).Error("handleDeposit failed")
+					failDeposit(log, p.failer, "passthrough", d, err)
 				}
-				log.WithField("notice", logger.WatchNotice).WithError(err).Error(msg)
 			} else {
 				log.Info("Deposit processed")
 				p.deposits <- d
@@ -237,6 +241,16 @@ func (p *Passthrough) Deposits() <-chan DepositInfo {
 	return p.deposits
 }
 
+// Resubmit queues a passthrough deposit changed by an operator for processing
+func (p *Passthrough) Resubmit(di DepositInfo) error {
+	select {
+	case <-p.quit:
+		return errQuit
+	case p.internalDeposits <- di:
+		return nil
+	}
+}
+
 // processDeposit advances a single deposit through these states:
 // StatusWaitDecide -> StatusWaitPassthrough
 // StatusWaitPassthrough -> StatusWaitPassthroughOrderComplete
@@ -352,7 +366,10 @@ func (p *Passthrough) handleDepositInfoState(di DepositInfo) (DepositInfo, error
 			di.Status = StatusWaitPassthrough
 			di.Passthrough.ExchangeName = PassthroughExchangeC2CX
 			di.Passthrough.RequestedAmount = calculateRequestedAmount(di.DepositValue).String()
-			di.Passthrough.Order.CustomerID = di.DepositID
+			// A deposit retried by an operator already has a fresh CustomerID
+			if di.Passthrough.Order.CustomerID == "" {
+				di.Passthrough.Order.CustomerID = di.DepositID
+			}
 			return di
 		})
 		if err != nil {
@@ -365,6 +382,29 @@ func (p *Passthrough) handleDepositInfoState(di DepositInfo) (DepositInfo, error
 		return di, nil
 
 	case StatusWaitPassthrough:
+		// A deposit being retried may have placed its order in the failed attempt, if MarketBuy
+		// failed after C2CX accepted the order or the DB update below failed.
+		// Recover that order instead of placing a second one.
+		dr, err := p.store.GetDepositRetry(di.DepositID)
+		if err != nil {
+			log.WithError(err).Error("GetDepositRetry failed")
+			return di, err
+		}
+
+		if dr != nil {
+			recovered, err := p.recoverOrders([]DepositInfo{di})
+			if err != nil {
+				log.WithError(err).Error("recoverOrders failed")
+				return di, err
+			}
+
+			if len(recovered) != 0 {
+				di = recovered[0]
+				log.WithField("depositInfo", di).Info("Recovered order placed by a failed attempt, DepositInfo status set to StatusWaitPassthroughOrderComplete")
+				return di, nil
+			}
+		}
+
 		// Place a market order for the amount of BTC to spend.
 		// NOTE: if the balance on the exchange is insufficient, the order will be "suspended"
 		// until the balance is high enough.
@@ -379,8 +419,8 @@ func (p *Passthrough) handleDepositInfoState(di DepositInfo) (DepositInfo, error
 
 		// NOTE: if the DB update fails, the order had already been placed and we lost this info.
 		// To handle this case, during startup, for any deposits of StatusWaitPassthrough,
-		// we scan our orders on C2CX to see if any have a CustomerID matching our DepositID,
-		// and update the DepositInfo in the database to recover.
+		// and before a retried deposit places its order, we scan our orders on C2CX to see
+		// if any have a CustomerID matching our DepositID, and update the DepositInfo in the database to recover.
 		di, err = p.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
 			di.Status = StatusWaitPassthroughOrderComplete
 			di.Passthrough.Order.OrderID = fmt.Sprint(orderID)
@@ -402,9 +442,12 @@ func (p *Passthrough) handleDepositInfoState(di DepositInfo) (DepositInfo, error
 
 		switch err {
 		case nil:
+			// Only the order's result is copied, so that changes made by an operator
+			// while the order was filling, e.g. to the sky address, are kept
 			di, err = p.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
-				newDepositInfo.Status = StatusWaitSend
-				return newDepositInfo
+				di.Passthrough = newDepositInfo.Passthrough
+				di.Status = StatusWaitSend
+				return di
 			})
 			if err != nil {
 				log.WithError(err).Error("UpdateDepositInfo set StatusWaitSend failed")
@@ -433,9 +476,10 @@ func (p *Passthrough) handleDepositInfoState(di DepositInfo) (DepositInfo, error
 				// figure out a solution to reprocessing.
 				var updateErr error
 				di, updateErr = p.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
-					newDepositInfo.Status = StatusDone
-					newDepositInfo.Error = err.Error()
-					return newDepositInfo
+					di.Passthrough = newDepositInfo.Passthrough
+					di.Status = StatusDone
+					di.Error = err.Error()
+					return di
 				})
 				if updateErr != nil {
 					log.WithError(updateErr).Error("UpdateDepositInfo set StatusDone failed")
@@ -467,15 +511,14 @@ func (p *Passthrough) fixUnrecordedOrders() ([]DepositInfo, error) {
 	// Here, we query all c2cx orders and see if any have a CustomerID that matches
 	// a DepositInfo whose status is StatusWaitPassthrough.
 	log := p.log.WithField("method", "fixUnrecordedOrders")
-	var updates []DepositInfo
 
 	// Check all orders on StatusWaitPassthrough, to see if the order had actually been placed.
 	// The order can be placed but then fail to update the DB, and we should not place the order twice.
-	deposits, err := p.store.GetDepositInfoArray(func(di DepositInfo) bool {
-		return di.Status == StatusWaitPassthrough
+	deposits, err := p.store.QueryDepositInfo(DepositQuery{
+		Statuses: []string{StatusWaitPassthrough},
 	})
 	if err != nil {
-		log.WithError(err).Error("GetDepositInfoArray failed")
+		log.WithError(err).Error("QueryDepositInfo failed")
 		return nil, err
 	}
 
@@ -488,6 +531,16 @@ func (p *Passthrough) fixUnrecordedOrders() ([]DepositInfo, error) {
 
 	log.Info("Found StatusWaitPassthrough deposits")
 
+	return p.recoverOrders(deposits)
+}
+
+// recoverOrders looks for orders placed with the CustomerIDs of StatusWaitPassthrough deposits,
+// and records any order found, setting the deposit's status to StatusWaitPassthroughOrderComplete.
+// The updated deposits are returned.
+func (p *Passthrough) recoverOrders(deposits []DepositInfo) ([]DepositInfo, error) {
+	log := p.log.WithField("method", "recoverOrders")
+	var updates []DepositInfo
+
 	cidToDeposits := make(map[string]DepositInfo, len(deposits))
 	for _, di := range deposits {
 		if di.Passthrough.Order.CustomerID == "" {
@@ -668,14 +721,36 @@ waitCompletedLoop:
 
 				btcSpent := calculateBtcSpent(order)
 
+				fee, err := calculateFee(order)
+				if err != nil {
+					p.log.WithFields(logrus.Fields{
+						"order":       order,
+						"depositInfo": di,
+						"notice":      logger.WatchNotice,
+					}).WithError(err).Error("calculateFee failed, fee will not be recorded")
+				}
+
+				referenceSky, err := calculateReferenceSky(btcSpent, di.ConversionRate)
+				if err != nil {
+					p.log.WithFields(logrus.Fields{
+						"order":       order,
+						"depositInfo": di,
+					}).WithError(err).Error("calculateReferenceSky failed, slippage will not be recorded")
+				}
+
 				di.Passthrough.SkyBought = skyBought
 				di.Passthrough.DepositValueSpent = btcSpent
+				di.Passthrough.Fee = fee
+				di.Passthrough.FeePassedThrough = p.cfg.C2CX.PassFeesToUser
+				di.Passthrough.ReferenceSky = referenceSky
+				di.Passthrough.Slippage = calculateSlippage(referenceSky, skyBought).String()
 
 				di.Passthrough.Order.Status = order.Status.String()
 				di.Passthrough.Order.Final = true
 
 				di.Passthrough.Order.CompletedAmount = order.CompletedAmount.String()
 				di.Passthrough.Order.Price = order.AvgPrice.String()
+				di.Passthrough.Order.Fee = order.Fee.String()
 
 				originalData, err := json.Marshal(order)
 				if err != nil {
@@ -714,9 +789,7 @@ func calculateRequestedAmount(depositValue int64) decimal.Decimal {
 
 // calculateSkyBought returns the amount of SKY bought in droplets
 // The amount of SKY bought is in order.CompletedAmount
-// This amount is not adjusted for the C2CX commission, which is not
-// known through the API, so the actual amount bought is less.
-// For now, ignore the commission and eat the fee.
+// This amount is not adjusted for the C2CX commission, see calculateFee.
 func calculateSkyBought(order *c2cx.Order) (uint64, error) {
 	// Convert CompletedAmount from whole skycoin to droplets
 	skyBought := order.CompletedAmount.Mul(decimal.New(droplet.Multiplier, 0)).IntPart()
@@ -726,6 +799,51 @@ func calculateSkyBought(order *c2cx.Order) (uint64, error) {
 	return uint64(skyBought), nil
 }
 
+// calculateFee returns the commission charged by the exchange for an order, in droplets.
+// The commission of a buy order is charged in the currency bought, so the amount
+// of SKY credited to the exchange account is order.CompletedAmount less the fee.
+func calculateFee(order *c2cx.Order) (uint64, error) {
+	fee := order.Fee.Mul(decimal.New(droplet.Multiplier, 0)).IntPart()
+	if fee < 0 {
+		return 0, errFeeNegative
+	}
+	return uint64(fee), nil
+}
+
+// calculateReferenceSky returns the amount of SKY in droplets that btcSpent would
+// have bought at the reference rate. The reference rate is the deposit's ConversionRate,
+// which was recorded when the deposit was received.
+func calculateReferenceSky(btcSpent int64, rate string) (uint64, error) {
+	return CalculateBtcSkyValue(btcSpent, rate, droplet.Exponent)
+}
+
+// calculateSlippage returns the fraction of the reference amount of SKY that was not bought.
+// A positive value means the order filled at a worse price than the reference rate.
+func calculateSlippage(referenceSky, skyBought uint64) decimal.Decimal {
+	if referenceSky == 0 {
+		return decimal.Zero
+	}
+
+	ref := decimal.New(int64(referenceSky), 0)
+	bought := decimal.New(int64(skyBought), 0)
+	return ref.Sub(bought).DivRound(ref, 8)
+}
+
+// calculatePassthroughSkySent returns the amount of SKY to send for a completed
+// passthrough order, in droplets. If the fee is passed through to the user it
+// is deducted from the amount bought, otherwise the fee is absorbed.
+func calculatePassthroughSkySent(pd PassthroughData) uint64 {
+	if !pd.FeePassedThrough {
+		return pd.SkyBought
+	}
+
+	if pd.Fee >= pd.SkyBought {
+		return 0
+	}
+
+	return pd.SkyBought - pd.Fee
+}
+
 // calculateBtcSpent returns the amount of BTC spent in satoshis.
 // The amount spent can be less than the amount requested to be spent, due to the
 // minimum BTC price of the smallest purchasable unit of SKY on the exchange.
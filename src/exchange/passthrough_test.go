@@ -20,6 +20,7 @@ import (
 	"github.com/skycoin/exchange-api/exchange/c2cx"
 
 	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/fiber"
 	"github.com/skycoin/teller/src/scanner"
 	"github.com/skycoin/teller/src/util/testutil"
 )
@@ -30,6 +31,7 @@ var (
 		SkyEthExchangeRate:      testSkyEthRate,
 		SkySkyExchangeRate:      testSkySkyRate,
 		MaxDecimals:             3,
+		Coin:                    fiber.Skycoin,
 		TxConfirmationCheckWait: time.Second,
 		Wallet:                  testWalletFile,
 		SendEnabled:             true,
@@ -59,13 +61,13 @@ func (m *mockReceiver) Deposits() <-chan DepositInfo {
 	return m.deposits
 }
 
-func (m *mockReceiver) BindAddress(a, b, c, d string) (*BoundAddress, error) {
+func (m *mockReceiver) BindAddress(a, b, c, d string, e int64) (*BoundAddress, error) {
 	return nil, errors.New("mockReceiver.BindAddress not implemented")
 }
 
 func createDepositStatusWaitDecide(t *testing.T, p *Passthrough, skyAddr string, n uint32) DepositInfo {
 	btcAddr := testutil.RandString(t, 16)
-	_, err := p.store.BindAddress(skyAddr, btcAddr, config.CoinTypeBTC, config.BuyMethodPassthrough)
+	_, err := p.store.BindAddress(skyAddr, btcAddr, config.CoinTypeBTC, config.BuyMethodPassthrough, 0)
 	require.NoError(t, err)
 
 	depositInfo, err := p.store.GetOrCreateDepositInfo(scanner.Deposit{
@@ -185,6 +187,40 @@ func TestPassthroughFixUnrecordedOrders(t *testing.T) {
 	require.Equal(t, fmt.Sprint(orderID+2), updatedDi.Passthrough.Order.OrderID)
 }
 
+func TestPassthroughRetryRecoversPlacedOrder(t *testing.T) {
+	// Tests that a retried deposit records the order placed by its failed attempt instead of placing another
+	p, shutdown, mockClient, _ := setupPassthrough(t)
+	defer shutdown()
+
+	di := createDepositStatusWaitPassthrough(t, p, testSkyAddr, 0)
+
+	orderID := c2cx.OrderID(1234)
+	mockClient.On("GetOrderByStatus", c2cx.BtcSky, c2cx.StatusAll).Return([]c2cx.Order{
+		{
+			OrderID:    orderID,
+			CustomerID: &di.Passthrough.Order.CustomerID,
+		},
+	}, nil).Once()
+
+	err := p.store.PutDepositRetry(DepositRetry{
+		DepositID: di.DepositID,
+		Status:    StatusWaitPassthrough,
+		Component: "passthrough",
+		Attempts:  1,
+		LastError: "MarketBuy failed",
+	})
+	require.NoError(t, err)
+
+	updated, err := p.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitPassthroughOrderComplete, updated.Status)
+	require.Equal(t, fmt.Sprint(orderID), updated.Passthrough.Order.OrderID)
+
+	// MarketBuy was not called
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "MarketBuy", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestPassthroughLoadExistingDeposits(t *testing.T) {
 	// Tests that existing StatusWaitPassthrough and StatusWaitPassthroughOrderComplete
 	// deposits are loaded and processed.
@@ -371,7 +407,7 @@ func TestPassthroughOrderNotCompleted(t *testing.T) {
 
 		// Check serialized original order
 
-		deposit, err := p.store.(*Store).getDepositInfo(deposit.DepositID)
+		deposit, err := p.store.(*Store).GetDepositInfo(deposit.DepositID)
 		require.NoError(t, err)
 
 		var order c2cx.Order
@@ -391,6 +427,37 @@ func TestPassthroughOrderNotCompleted(t *testing.T) {
 	wg.Wait()
 }
 
+func TestPassthroughOrderCompleteKeepsOperatorChanges(t *testing.T) {
+	// Tests that a change made while the order was filling is not overwritten when the order completes
+	p, shutdown, mockClient, _ := setupPassthrough(t)
+	defer shutdown()
+
+	orderID := c2cx.OrderID(1234)
+
+	di := createDepositStatusWaitPassthroughOrderComplete(t, p, testSkyAddr, 0, orderID)
+
+	mockClient.On("GetOrderInfo", c2cx.BtcSky, orderID).Return(&c2cx.Order{
+		OrderID:         orderID,
+		CustomerID:      &di.Passthrough.Order.CustomerID,
+		Status:          c2cx.StatusCompleted,
+		CompletedAmount: decimal.New(123, -2),
+		AvgPrice:        decimal.New(182, -5),
+	}, nil).Once()
+
+	_, err := p.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.SkyAddress = testSkyAddr2
+		return di
+	})
+	require.NoError(t, err)
+
+	updated, err := p.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, updated.Status)
+	require.Equal(t, testSkyAddr2, updated.SkyAddress)
+	require.Equal(t, uint64(123e4), updated.Passthrough.SkyBought)
+	require.True(t, updated.Passthrough.Order.Final)
+}
+
 func TestPassthroughOrderFatalStatus(t *testing.T) {
 	// Tests that if an order has a fatal status, the deposit skips to StatusDone
 	p, shutdown, mockClient, hook := setupPassthrough(t)
@@ -431,7 +498,7 @@ func TestPassthroughOrderFatalStatus(t *testing.T) {
 			case <-stop:
 				return
 			case <-time.After(dbCheckWaitTime):
-				deposit, err := p.store.(*Store).getDepositInfo(di.DepositID)
+				deposit, err := p.store.(*Store).GetDepositInfo(di.DepositID)
 				require.NoError(t, err)
 
 				if deposit.Status == StatusDone {
@@ -449,7 +516,7 @@ func TestPassthroughOrderFatalStatus(t *testing.T) {
 		t.Fatal("Waiting for sent deposit timed out")
 	}
 
-	deposit, err := p.store.(*Store).getDepositInfo(di.DepositID)
+	deposit, err := p.store.(*Store).GetDepositInfo(di.DepositID)
 	require.NoError(t, err)
 
 	require.Equal(t, di.DepositID, deposit.DepositID)
@@ -535,7 +602,7 @@ func TestPassthroughOrderVolumeTooLow(t *testing.T) {
 			case <-stop:
 				return
 			case <-time.After(dbCheckWaitTime):
-				deposit, err := p.store.(*Store).getDepositInfo(di.DepositID)
+				deposit, err := p.store.(*Store).GetDepositInfo(di.DepositID)
 				require.NoError(t, err)
 
 				if deposit.Status == StatusDone {
@@ -553,7 +620,7 @@ func TestPassthroughOrderVolumeTooLow(t *testing.T) {
 		t.Fatal("Waiting for sent deposit timed out")
 	}
 
-	deposit, err := p.store.(*Store).getDepositInfo(di.DepositID)
+	deposit, err := p.store.(*Store).GetDepositInfo(di.DepositID)
 	require.NoError(t, err)
 
 	require.Equal(t, di.DepositID, deposit.DepositID)
@@ -653,7 +720,7 @@ func testPassthroughRetryError(t *testing.T, getOrderInfoErr error) {
 
 		// Check serialized original order
 
-		deposit, err := p.store.(*Store).getDepositInfo(deposit.DepositID)
+		deposit, err := p.store.(*Store).GetDepositInfo(deposit.DepositID)
 		require.NoError(t, err)
 
 		var order c2cx.Order
@@ -763,7 +830,7 @@ func TestPassthroughRetryInsufficientBalance(t *testing.T) {
 
 		// Check serialized original order
 
-		deposit, err := p.store.(*Store).getDepositInfo(deposit.DepositID)
+		deposit, err := p.store.(*Store).GetDepositInfo(deposit.DepositID)
 		require.NoError(t, err)
 
 		var order c2cx.Order
@@ -825,7 +892,7 @@ func TestPassthroughShutdownWhileCheckingOrderStatus(t *testing.T) {
 	wg.Wait()
 
 	// Check the deposit in the store
-	deposit, err := p.store.(*Store).getDepositInfo(di.DepositID)
+	deposit, err := p.store.(*Store).GetDepositInfo(di.DepositID)
 	require.NoError(t, err)
 
 	require.Equal(t, di.DepositID, deposit.DepositID)
@@ -850,7 +917,7 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 
 	skyAddr := testSkyAddr
 	btcAddr := "foo-btc-addr"
-	_, err := e.store.BindAddress(skyAddr, btcAddr, config.CoinTypeBTC, config.BuyMethodPassthrough)
+	_, err := e.store.BindAddress(skyAddr, btcAddr, config.CoinTypeBTC, config.BuyMethodPassthrough, 0)
 	require.NoError(t, err)
 
 	dn := scanner.DepositNote{
@@ -873,6 +940,7 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 		Status:          c2cx.StatusCompleted,
 		CompletedAmount: decimal.New(123, -2),
 		AvgPrice:        decimal.New(182, -5),
+		Fee:             decimal.New(1, -2),
 	}
 
 	orderCompleteBytes, err := json.Marshal(orderComplete)
@@ -880,6 +948,9 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 
 	requestedAmount := calculateRequestedAmount(dn.Deposit.Value)
 
+	referenceSky, err := calculateReferenceSky(calculateBtcSpent(orderComplete), testSkyBtcRate)
+	require.NoError(t, err)
+
 	mockClient := e.Processor.(*Passthrough).exchangeClient.(*MockC2CXClient)
 	mockClient.On("GetOrderByStatus", c2cx.BtcSky, c2cx.StatusAll).Return(nil, nil).Once()
 	mockClient.On("GetBalanceSummary").Return(&c2cx.BalanceSummary{
@@ -912,7 +983,7 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 	go func() {
 		defer close(done)
 		for range time.Tick(dbCheckWaitTime) {
-			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 			log.Printf("loop getDepositInfo %+v %v\n", di, err)
 			require.NoError(t, err)
 
@@ -929,7 +1000,7 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 	}
 
 	// Check DepositInfo
-	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 
 	require.NotEmpty(t, di.UpdatedAt)
@@ -938,12 +1009,14 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       config.CoinTypeBTC,
 		UpdatedAt:      di.UpdatedAt,
+		TxAttempts:     requireTxAttempts(t, di, TxAttemptPending),
 		Status:         StatusWaitConfirm,
 		SkyAddress:     skyAddr,
 		DepositAddress: dn.Deposit.Address,
 		DepositID:      dn.Deposit.ID(),
 		Txid:           txid,
 		SkySent:        skySent,
+		Payout:         PayoutData{Gross: skySent, Net: skySent},
 		BuyMethod:      config.BuyMethodPassthrough,
 		ConversionRate: testSkyBtcRate,
 		DepositValue:   dn.Deposit.Value,
@@ -953,11 +1026,15 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 			RequestedAmount:   requestedAmount.String(),
 			DepositValueSpent: calculateBtcSpent(orderComplete),
 			SkyBought:         skySent,
+			Fee:               1e4,
+			ReferenceSky:      referenceSky,
+			Slippage:          calculateSlippage(referenceSky, skySent).String(),
 			Order: PassthroughOrder{
 				CustomerID:      customerID,
 				OrderID:         fmt.Sprint(orderID),
 				CompletedAmount: orderComplete.CompletedAmount.String(),
 				Price:           orderComplete.AvgPrice.String(),
+				Fee:             orderComplete.Fee.String(),
 				Status:          orderComplete.Status.String(),
 				Final:           true,
 				Original:        string(orderCompleteBytes),
@@ -975,7 +1052,7 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 	go func() {
 		defer close(done)
 		for range time.Tick(dbCheckWaitTime) {
-			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			di, err := e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 			require.NoError(t, err)
 
 			if di.Status == StatusDone {
@@ -993,7 +1070,7 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 	checkExchangerStatus(t, e, nil)
 
 	// Check DepositInfo
-	di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	di, err = e.store.(*Store).GetDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 
 	require.NotEmpty(t, di.UpdatedAt)
@@ -1002,12 +1079,14 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       config.CoinTypeBTC,
 		UpdatedAt:      di.UpdatedAt,
+		TxAttempts:     requireTxAttempts(t, di, TxAttemptConfirmed),
 		Status:         StatusDone,
 		SkyAddress:     skyAddr,
 		DepositAddress: dn.Deposit.Address,
 		DepositID:      dn.Deposit.ID(),
 		Txid:           txid,
 		SkySent:        skySent,
+		Payout:         PayoutData{Gross: skySent, Net: skySent},
 		BuyMethod:      config.BuyMethodPassthrough,
 		ConversionRate: testSkyBtcRate,
 		DepositValue:   dn.Deposit.Value,
@@ -1017,11 +1096,15 @@ func TestPassthroughExchangeRunSend(t *testing.T) {
 			RequestedAmount:   requestedAmount.String(),
 			DepositValueSpent: calculateBtcSpent(orderComplete),
 			SkyBought:         skySent,
+			Fee:               1e4,
+			ReferenceSky:      referenceSky,
+			Slippage:          calculateSlippage(referenceSky, skySent).String(),
 			Order: PassthroughOrder{
 				CustomerID:      customerID,
 				OrderID:         fmt.Sprint(orderID),
 				CompletedAmount: orderComplete.CompletedAmount.String(),
 				Price:           orderComplete.AvgPrice.String(),
+				Fee:             orderComplete.Fee.String(),
 				Status:          orderComplete.Status.String(),
 				Final:           true,
 				Original:        string(orderCompleteBytes),
@@ -1241,3 +1324,132 @@ func TestCalculateBtcSpent(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculateFee(t *testing.T) {
+	cases := []struct {
+		name string
+		fee  decimal.Decimal
+		amt  uint64
+		err  error
+	}{
+		{
+			name: "zero",
+			fee:  decimal.New(0, 0),
+			amt:  0,
+		},
+		{
+			name: "fraction",
+			fee:  decimal.New(1234, -3),
+			amt:  1234000,
+		},
+		{
+			name: "truncated to droplets",
+			fee:  decimal.New(12345678, -8),
+			amt:  123456,
+		},
+		{
+			name: "negative",
+			fee:  decimal.New(-1, 0),
+			err:  errFeeNegative,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			amt, err := calculateFee(&c2cx.Order{
+				Fee: tc.fee,
+			})
+
+			if tc.err != nil {
+				require.Error(t, err)
+				require.Equal(t, tc.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.amt, amt)
+		})
+	}
+}
+
+func TestCalculateSlippage(t *testing.T) {
+	cases := []struct {
+		name         string
+		referenceSky uint64
+		skyBought    uint64
+		slippage     string
+	}{
+		{
+			name:         "no reference",
+			referenceSky: 0,
+			skyBought:    100e6,
+			slippage:     "0",
+		},
+		{
+			name:         "exact",
+			referenceSky: 100e6,
+			skyBought:    100e6,
+			slippage:     "0",
+		},
+		{
+			name:         "worse price",
+			referenceSky: 100e6,
+			skyBought:    98e6,
+			slippage:     "0.02",
+		},
+		{
+			name:         "better price",
+			referenceSky: 100e6,
+			skyBought:    101e6,
+			slippage:     "-0.01",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			slippage := calculateSlippage(tc.referenceSky, tc.skyBought)
+			require.Equal(t, tc.slippage, slippage.String())
+		})
+	}
+}
+
+func TestCalculatePassthroughSkySent(t *testing.T) {
+	cases := []struct {
+		name string
+		pd   PassthroughData
+		amt  uint64
+	}{
+		{
+			name: "fee absorbed",
+			pd: PassthroughData{
+				SkyBought: 100e6,
+				Fee:       1e6,
+			},
+			amt: 100e6,
+		},
+		{
+			name: "fee passed through",
+			pd: PassthroughData{
+				SkyBought:        100e6,
+				Fee:              1e6,
+				FeePassedThrough: true,
+			},
+			amt: 99e6,
+		},
+		{
+			name: "fee passed through exceeds amount bought",
+			pd: PassthroughData{
+				SkyBought:        1e6,
+				Fee:              2e6,
+				FeePassedThrough: true,
+			},
+			amt: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.amt, calculatePassthroughSkySent(tc.pd))
+		})
+	}
+}
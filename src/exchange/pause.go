@@ -0,0 +1,216 @@
+package exchange
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/skycoin/teller/src/config"
+)
+
+const (
+	// PauseBind pauses binding new deposit addresses
+	PauseBind = "bind"
+	// PauseProcess pauses processing the deposits of a coin type. Deposits are still received and recorded,
+	// and are processed once it resumes. Deposits already queued for processing are not paused.
+	PauseProcess = "process"
+	// PauseSend pauses sending coins. Unlike a halt by the reconciler, it lasts until an operator resumes it.
+	PauseSend = "send"
+)
+
+var (
+	// PauseTargets is all parts of the exchange that can be paused
+	PauseTargets = []string{
+		PauseBind,
+		PauseProcess,
+		PauseSend,
+	}
+
+	// ErrInvalidPauseTarget is returned when pausing or resuming an unknown part of the exchange
+	ErrInvalidPauseTarget = errors.New("Invalid pause target")
+	// ErrPauseCoinTypeRequired is returned when pausing or resuming processing without a coin type
+	ErrPauseCoinTypeRequired = errors.New("Processing is paused per coin type, a coin type is required")
+	// ErrPauseCoinTypeNotAllowed is returned when pausing or resuming binding or sending with a coin type
+	ErrPauseCoinTypeNotAllowed = errors.New("Only processing is paused per coin type")
+	// ErrAlreadyPaused is returned when pausing something that is paused
+	ErrAlreadyPaused = errors.New("Already paused")
+	// ErrNotPaused is returned when resuming something that is not paused
+	ErrNotPaused = errors.New("Not paused")
+	// ErrBindPausedByOperator is returned when binding while an operator paused binding
+	ErrBindPausedByOperator = errors.New("Binding is paused by an operator")
+	// ErrSendPaused is the reason sending is halted while an operator paused sending
+	ErrSendPaused = errors.New("Sending is paused by an operator")
+)
+
+// ValidatePause returns an error if target can't be paused for coinType.
+// coinType is required for PauseProcess and must be empty otherwise.
+func ValidatePause(target, coinType string) error {
+	switch target {
+	case PauseBind, PauseSend:
+		if coinType != "" {
+			return ErrPauseCoinTypeNotAllowed
+		}
+		return nil
+	case PauseProcess:
+		if coinType == "" {
+			return ErrPauseCoinTypeRequired
+		}
+		return config.ValidateCoinType(coinType)
+	default:
+		return ErrInvalidPauseTarget
+	}
+}
+
+// PauseChange records an operator pausing or resuming part of the exchange
+type PauseChange struct {
+	Seq       uint64 `json:"seq"`
+	Timestamp int64  `json:"timestamp"`
+	Target    string `json:"target"`
+	CoinType  string `json:"coin_type,omitempty"` // Set for PauseProcess
+	Paused    bool   `json:"paused"`
+	Actor     string `json:"actor"`
+	Reason    string `json:"reason"`
+}
+
+// PauseStatus reports which parts of the exchange are paused by an operator
+type PauseStatus struct {
+	Bind    bool            `json:"bind"`
+	Process map[string]bool `json:"process"` // Keyed by coin type
+	Send    bool            `json:"send"`
+}
+
+func newPauseStatus() PauseStatus {
+	s := PauseStatus{
+		Process: make(map[string]bool, len(config.CoinTypes)),
+	}
+	for _, ct := range config.CoinTypes {
+		s.Process[ct] = false
+	}
+	return s
+}
+
+// Paused returns true if target is paused for coinType
+func (s PauseStatus) Paused(target, coinType string) bool {
+	switch target {
+	case PauseBind:
+		return s.Bind
+	case PauseProcess:
+		return s.Process[coinType]
+	case PauseSend:
+		return s.Send
+	default:
+		return false
+	}
+}
+
+// pauses holds the PauseStatus shared by the paused components,
+// and the deposits held while processing of their coin type is paused
+type pauses struct {
+	sync.RWMutex
+	status PauseStatus
+	held   map[string][]string // Maps a coin type to the IDs of its held deposits, in the order they were held
+}
+
+// newPauses restores the PauseStatus from the pause changes recorded in the store
+func newPauses(store Storer) (*pauses, error) {
+	changes, err := store.GetPauseChanges()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pauses{
+		status: newPauseStatus(),
+		held:   make(map[string][]string),
+	}
+
+	for _, c := range changes {
+		p.set(c)
+	}
+
+	return p, nil
+}
+
+// Status returns the PauseStatus. A nil pauses has nothing paused.
+func (p *pauses) Status() PauseStatus {
+	s := newPauseStatus()
+	if p == nil {
+		return s
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	s.Bind = p.status.Bind
+	s.Send = p.status.Send
+	for k, v := range p.status.Process {
+		s.Process[k] = v
+	}
+
+	return s
+}
+
+// Paused returns true if target is paused for coinType. A nil pauses has nothing paused.
+func (p *pauses) Paused(target, coinType string) bool {
+	if p == nil {
+		return false
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+	return p.status.Paused(target, coinType)
+}
+
+// hold holds a deposit if processing of its coin type is paused, and returns true if it was held.
+// A nil pauses holds nothing.
+func (p *pauses) hold(di DepositInfo) bool {
+	if p == nil {
+		return false
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.status.Process[di.CoinType] {
+		return false
+	}
+
+	for _, id := range p.held[di.CoinType] {
+		if id == di.DepositID {
+			return true
+		}
+	}
+
+	p.held[di.CoinType] = append(p.held[di.CoinType], di.DepositID)
+	return true
+}
+
+// set applies a pause change. If processing of a coin type resumed,
+// the IDs of the deposits held while it was paused are returned.
+func (p *pauses) set(c PauseChange) []string {
+	p.Lock()
+	defer p.Unlock()
+
+	switch c.Target {
+	case PauseBind:
+		p.status.Bind = c.Paused
+	case PauseSend:
+		p.status.Send = c.Paused
+	case PauseProcess:
+		p.status.Process[c.CoinType] = c.Paused
+		if !c.Paused {
+			held := p.held[c.CoinType]
+			delete(p.held, c.CoinType)
+			return held
+		}
+	}
+
+	return nil
+}
+
+// sortPauseChanges sorts changes by Seq.
+// Keys are sorted as strings, not numbers, so changes read from the db must be sorted.
+func sortPauseChanges(changes []PauseChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Seq < changes[j].Seq
+	})
+}
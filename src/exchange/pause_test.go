@@ -0,0 +1,137 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+)
+
+func TestValidatePause(t *testing.T) {
+	require.NoError(t, ValidatePause(PauseBind, ""))
+	require.NoError(t, ValidatePause(PauseSend, ""))
+	require.NoError(t, ValidatePause(PauseProcess, config.CoinTypeBTC))
+
+	require.Equal(t, ErrInvalidPauseTarget, ValidatePause("scan", ""))
+	require.Equal(t, ErrPauseCoinTypeRequired, ValidatePause(PauseProcess, ""))
+	require.Equal(t, ErrPauseCoinTypeNotAllowed, ValidatePause(PauseSend, config.CoinTypeBTC))
+	require.Equal(t, config.ErrUnsupportedCoinType, ValidatePause(PauseProcess, "LTC"))
+}
+
+func TestExchangePause(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	require.Equal(t, newPauseStatus(), e.PauseStatus())
+
+	_, err := e.Pause(PauseBind, "", "alice", " ")
+	require.Equal(t, ErrReasonRequired, err)
+
+	_, err = e.Pause("scan", "", "alice", "incident")
+	require.Equal(t, ErrInvalidPauseTarget, err)
+
+	_, err = e.Resume(PauseBind, "", "alice", "incident")
+	require.Equal(t, ErrNotPaused, err)
+
+	c, err := e.Pause(PauseBind, "", "alice", "incident")
+	require.NoError(t, err)
+	require.Equal(t, PauseBind, c.Target)
+	require.True(t, c.Paused)
+	require.Equal(t, "alice", c.Actor)
+	require.Equal(t, "incident", c.Reason)
+	require.NotZero(t, c.Timestamp)
+	require.True(t, e.PauseStatus().Bind)
+
+	_, err = e.Pause(PauseBind, "", "alice", "incident")
+	require.Equal(t, ErrAlreadyPaused, err)
+
+	changes, err := e.GetPauseChanges()
+	require.NoError(t, err)
+	require.Equal(t, []PauseChange{*c}, changes)
+
+	// The pauses are restored from the db
+	p, err := newPauses(e.store)
+	require.NoError(t, err)
+	require.True(t, p.Status().Bind)
+	require.False(t, p.Status().Send)
+
+	_, err = e.Resume(PauseBind, "", "bob", "resolved")
+	require.NoError(t, err)
+	require.False(t, e.PauseStatus().Bind)
+
+	p, err = newPauses(e.store)
+	require.NoError(t, err)
+	require.Equal(t, newPauseStatus(), p.Status())
+}
+
+func TestExchangePauseSend(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	send := e.Sender.(*Send)
+	require.NoError(t, send.Halted())
+
+	_, err := e.Pause(PauseSend, "", "alice", "incident")
+	require.NoError(t, err)
+	require.Equal(t, ErrSendPaused, send.Halted())
+
+	// A halt takes precedence, and resuming it leaves sending paused
+	send.Halt(ErrReconciling)
+	require.Equal(t, ErrReconciling, send.Halted())
+	send.Resume()
+	require.Equal(t, ErrSendPaused, send.Halted())
+
+	_, err = e.Resume(PauseSend, "", "alice", "resolved")
+	require.NoError(t, err)
+	require.NoError(t, send.Halted())
+}
+
+func TestExchangePauseProcess(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	receiver := e.Receiver.(*Receive)
+
+	_, err := e.Pause(PauseProcess, "", "alice", "incident")
+	require.Equal(t, ErrPauseCoinTypeRequired, err)
+
+	_, err = e.Pause(PauseProcess, config.CoinTypeBTC, "alice", "incident")
+	require.NoError(t, err)
+	require.True(t, e.PauseStatus().Process[config.CoinTypeBTC])
+	require.False(t, e.PauseStatus().Process[config.CoinTypeETH])
+
+	di := mustAddOperatorDepositInfo(t, e, newOperatorDepositInfo(StatusWaitDecide))
+
+	// A paused coin type's deposits are held, once
+	require.NoError(t, receiver.queueDeposit(di))
+	require.NoError(t, receiver.Resubmit(di))
+	requireNotQueued(t, receiver.Deposits())
+
+	// A held deposit that was changed by an operator is not queued when processing resumes
+	changed := newOperatorDepositInfo(StatusWaitDecide)
+	changed.Seq = 2
+	changed.DepositID = "foo-deposit-id:2"
+	changed = mustAddOperatorDepositInfo(t, e, changed)
+	require.NoError(t, receiver.queueDeposit(changed))
+	_, err = e.RejectDeposit(changed.DepositID, "alice", "support ticket")
+	require.Equal(t, ErrDepositNotWaitingApproval, err)
+	_, err = e.CompleteDeposit(changed.DepositID, testOperatorTxid, 100e6, "alice", "support ticket")
+	require.NoError(t, err)
+	requireNotQueued(t, receiver.Deposits())
+
+	// Other coin types are processed
+	ethDi := newOperatorDepositInfo(StatusWaitDecide)
+	ethDi.Seq = 3
+	ethDi.CoinType = config.CoinTypeETH
+	ethDi.DepositID = "foo-deposit-id:3"
+	ethDi = mustAddOperatorDepositInfo(t, e, ethDi)
+	require.NoError(t, receiver.queueDeposit(ethDi))
+	requireQueued(t, receiver.Deposits(), ethDi)
+
+	// The held deposits are queued when processing resumes
+	_, err = e.Resume(PauseProcess, config.CoinTypeBTC, "alice", "resolved")
+	require.NoError(t, err)
+	requireQueued(t, receiver.Deposits(), di)
+	requireNotQueued(t, receiver.Deposits())
+}
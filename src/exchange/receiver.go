@@ -32,7 +32,7 @@ func init() {
 // Receiver is a component that reads deposits from a scanner.Scanner and records them
 type Receiver interface {
 	Deposits() <-chan DepositInfo
-	BindAddress(skyAddr, depositAddr, coinType, buyMethod string) (*BoundAddress, error)
+	BindAddress(skyAddr, depositAddr, coinType, buyMethod string, expectedValue int64) (*BoundAddress, error)
 }
 
 // ReceiveRunner is a Receiver than can be run
@@ -48,9 +48,13 @@ type Receive struct {
 	cfg         config.SkyExchanger
 	multiplexer *scanner.Multiplexer
 	store       Storer
+	risk        *riskRules
 	deposits    chan DepositInfo
 	quit        chan struct{}
 	done        chan struct{}
+	failer      DepositFailer // Handles deposits that failed processing
+	pauses      *pauses       // Holds deposits while processing of their coin type is paused
+	live        *liveConfig   // The exchange rates, which can be changed by reloading the config
 }
 
 // NewReceive creates a Receive
@@ -64,11 +68,13 @@ func NewReceive(log logrus.FieldLogger, cfg config.SkyExchanger, store Storer, m
 	return &Receive{
 		log:         log.WithField("prefix", "teller.exchange.Receive"),
 		cfg:         cfg,
-		store:       store,
+		store:       withComponent(store, "receive"),
+		risk:        newRiskRules(log, cfg, store),
 		multiplexer: multiplexer,
 		deposits:    make(chan DepositInfo, 100),
 		quit:        make(chan struct{}),
 		done:        make(chan struct{}, 1),
+		live:        newLiveConfig(cfg),
 	}, nil
 }
 
@@ -82,12 +88,12 @@ func (r *Receive) Run() error {
 	}()
 
 	// Load StatusWaitDecide deposits for resubmission
-	waitDecideDeposits, err := r.store.GetDepositInfoArray(func(di DepositInfo) bool {
-		return di.Status == StatusWaitDecide
+	waitDecideDeposits, err := r.store.QueryDepositInfo(DepositQuery{
+		Statuses: []string{StatusWaitDecide},
 	})
 
 	if err != nil {
-		err = fmt.Errorf("GetDepositInfoArray failed: %v", err)
+		err = fmt.Errorf("QueryDepositInfo failed: %v", err)
 		log.WithError(err).Error(err)
 		return err
 	}
@@ -97,10 +103,11 @@ func (r *Receive) Run() error {
 	// the Processor is running to receive them
 queueWaitDecideDeposits:
 	for _, di := range waitDecideDeposits {
-		select {
-		case <-r.quit:
-			break queueWaitDecideDeposits
-		case r.deposits <- di:
+		if err := r.queueDeposit(di); err != nil {
+			if err == errQuit {
+				break queueWaitDecideDeposits
+			}
+			failDeposit(log, r.failer, "receive", di, err)
 		}
 	}
 
@@ -149,7 +156,12 @@ func (r *Receive) runReadMultiplexer() {
 			dv.ErrC <- err
 		} else {
 			dv.ErrC <- nil
-			r.deposits <- d
+			if err := r.queueDeposit(d); err != nil {
+				if err == errQuit {
+					return
+				}
+				failDeposit(log, r.failer, "receive", d, err)
+			}
 		}
 	}
 }
@@ -168,6 +180,40 @@ func (r *Receive) Deposits() <-chan DepositInfo {
 	return r.deposits
 }
 
+// Resubmit queues a StatusWaitDecide deposit changed by an operator for processing
+func (r *Receive) Resubmit(di DepositInfo) error {
+	return r.queueDeposit(di)
+}
+
+// queueDeposit checks a deposit against the risk rules and queues it for processing,
+// unless it was held for approval or processing of its coin type is paused
+func (r *Receive) queueDeposit(di DepositInfo) error {
+	if r.pauses.hold(di) {
+		r.log.WithField("depositInfo", di).Info("Processing is paused for this coin type, holding deposit until it resumes")
+		return nil
+	}
+
+	di, ok, err := r.risk.screen(di)
+	if err != nil {
+		if err == ErrDepositChanged {
+			r.log.WithField("depositInfo", di).Warn("Dropping stale copy of deposit")
+			return nil
+		}
+		return err
+	}
+
+	if !ok {
+		return nil
+	}
+
+	select {
+	case <-r.quit:
+		return errQuit
+	case r.deposits <- di:
+		return nil
+	}
+}
+
 // saveIncomingDeposit is called when receiving a deposit from the scanner
 func (r *Receive) saveIncomingDeposit(dv scanner.Deposit) (DepositInfo, error) {
 	log := r.log.WithField("deposit", dv)
@@ -193,7 +239,7 @@ func (r *Receive) saveIncomingDeposit(dv scanner.Deposit) (DepositInfo, error) {
 
 // getRate returns conversion rate according to coin type
 func (r *Receive) getRate(coinType string) (string, error) {
-	return getRate(r.cfg, coinType)
+	return getRate(r.live.get(), coinType)
 }
 
 // getRate returns conversion rate according to coin type
@@ -216,7 +262,7 @@ func getRate(cfg config.SkyExchanger, coinType string) (string, error) {
 // add the btc/eth address to scan service, when detect deposit coin
 // to the btc/eth address, will send specific skycoin to the binded
 // skycoin address
-func (r *Receive) BindAddress(skyAddr, depositAddr, coinType, buyMethod string) (*BoundAddress, error) {
+func (r *Receive) BindAddress(skyAddr, depositAddr, coinType, buyMethod string, expectedValue int64) (*BoundAddress, error) {
 	if err := config.ValidateBuyMethod(buyMethod); err != nil {
 		return nil, err
 	}
@@ -225,7 +271,7 @@ func (r *Receive) BindAddress(skyAddr, depositAddr, coinType, buyMethod string)
 		return nil, err
 	}
 
-	boundAddr, err := r.store.BindAddress(skyAddr, depositAddr, coinType, buyMethod)
+	boundAddr, err := r.store.BindAddress(skyAddr, depositAddr, coinType, buyMethod, expectedValue)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,475 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/sender"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const (
+	reconcileRetryWait = time.Second * 10
+
+	// ReconcileUnrecordedPayment is a transaction that paid a bound address but is not recorded by any deposit
+	ReconcileUnrecordedPayment = "unrecorded_payment"
+	// ReconcileDuplicatePayment is a transaction that paid a deposit which was already paid by another transaction
+	ReconcileDuplicatePayment = "duplicate_payment"
+	// ReconcileDroppedTransaction is a deposit's transaction that the skycoin node does not know
+	ReconcileDroppedTransaction = "dropped_transaction"
+	// ReconcileUnknownSpend is a hot wallet output being spent by an unconfirmed transaction that teller did not make
+	ReconcileUnknownSpend = "unknown_spend"
+)
+
+var (
+	// ErrReconciling is the reason sending is halted while reconciling, and until the startup reconciliation succeeds
+	ErrReconciling = errors.New("Sending is halted until the deposits are reconciled against the blockchain")
+	// ErrReconcileUnresolved is the reason sending is halted when reconciliation found issues it could not resolve
+	ErrReconcileUnresolved = errors.New("Sending is halted, reconciliation found payments that need an operator")
+)
+
+// WalletHistorian provides the transactions sent from the hot wallets
+type WalletHistorian interface {
+	WalletHistory(pending []string) (*sender.WalletHistory, error)
+}
+
+// SendHalter is a Sender whose sending can be halted
+type SendHalter interface {
+	Halt(reason error)
+	Resume()
+	Halted() error
+}
+
+// ReconcileIssue is a difference between the deposits and the hot wallet transactions on the blockchain
+type ReconcileIssue struct {
+	Kind       string   `json:"kind"`
+	Txid       string   `json:"txid,omitempty"`
+	Output     string   `json:"output,omitempty"`
+	DepositIDs []string `json:"deposit_ids,omitempty"`
+	SkyAddress string   `json:"sky_address,omitempty"`
+	Coins      uint64   `json:"coins,omitempty"`
+	// Resolved issues were repaired by reconciliation. Unresolved issues halt sending.
+	Resolved bool `json:"resolved"`
+}
+
+// ReconcileReport is the result of a reconciliation
+type ReconcileReport struct {
+	ReconciledAt int64            `json:"reconciled_at"`
+	Deposits     int              `json:"deposits"`
+	Transactions int              `json:"transactions"`
+	Issues       []ReconcileIssue `json:"issues"`
+	Halted       bool             `json:"halted"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// Unresolved returns the issues that reconciliation could not resolve
+func (r ReconcileReport) Unresolved() []ReconcileIssue {
+	var issues []ReconcileIssue
+	for _, i := range r.Issues {
+		if !i.Resolved {
+			issues = append(issues, i)
+		}
+	}
+	return issues
+}
+
+// Reconciler compares the deposits that were sent, or are waiting to be sent or confirmed,
+// against the transactions sent from the hot wallets on the blockchain.
+//
+// A payment to a bound address that no deposit records is recorded on the one StatusWaitSend deposit
+// it pays, e.g. after teller crashed between broadcasting a transaction and saving it.
+// A StatusWaitConfirm deposit whose transaction the node does not know is rebroadcast by Send if the
+// transaction was recorded, otherwise the deposit is set back to StatusWaitSend.
+// Anything else, such as a deposit paid twice or an unrecorded payment that matches no deposit,
+// halts sending until an operator resolves it and reconciles again.
+//
+// Reconciliation runs at startup, before anything is sent, and on demand.
+type Reconciler struct {
+	log        logrus.FieldLogger
+	cfg        config.SkyExchanger
+	store      Storer
+	history    WalletHistorian
+	send       SendHalter
+	retryWait  time.Duration
+	quit       chan struct{}
+	done       chan struct{}
+	reportLock sync.RWMutex
+	report     *ReconcileReport
+	sync.Mutex // Only one reconciliation runs at a time
+}
+
+// NewReconciler creates a Reconciler
+func NewReconciler(log logrus.FieldLogger, cfg config.SkyExchanger, store Storer, history WalletHistorian, send SendHalter) *Reconciler {
+	return &Reconciler{
+		log:       log.WithField("prefix", "teller.exchange.reconcile"),
+		cfg:       cfg,
+		store:     withComponent(store, "reconcile"),
+		history:   history,
+		send:      send,
+		retryWait: reconcileRetryWait,
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}, 1),
+	}
+}
+
+// haltUntilReconciled halts sending until the startup reconciliation succeeds.
+// It must be called before the Sender starts running.
+func (r *Reconciler) haltUntilReconciled() {
+	if r.cfg.SendEnabled {
+		r.send.Halt(ErrReconciling)
+	}
+}
+
+// Run reconciles once at startup, retrying until it succeeds
+func (r *Reconciler) Run() error {
+	log := r.log
+	log.Info("Start reconcile service...")
+	defer func() {
+		log.Info("Closed reconcile service")
+		r.done <- struct{}{}
+	}()
+
+	if !r.cfg.SendEnabled {
+		log.Info("Sending is disabled, startup reconciliation is skipped")
+		<-r.quit
+		return nil
+	}
+
+	for {
+		if _, err := r.Reconcile(); err == nil {
+			break
+		}
+
+		select {
+		case <-r.quit:
+			return nil
+		case <-time.After(r.retryWait):
+		}
+	}
+
+	<-r.quit
+	return nil
+}
+
+// Shutdown stops the Reconciler
+func (r *Reconciler) Shutdown() {
+	close(r.quit)
+	r.log.Info("Waiting for run to finish")
+	<-r.done
+	r.log.Info("Shutdown complete")
+}
+
+// Report returns the last reconciliation report, or nil if reconciliation has not run
+func (r *Reconciler) Report() *ReconcileReport {
+	r.reportLock.RLock()
+	defer r.reportLock.RUnlock()
+	return r.report
+}
+
+// Reconcile halts sending and reconciles the deposits against the blockchain.
+// Sending resumes unless an issue could not be resolved or reconciliation failed.
+func (r *Reconciler) Reconcile() (*ReconcileReport, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	log := r.log
+
+	// Nothing can be broadcast while the deposits and the blockchain are compared
+	wasHalted := r.send.Halted()
+	r.send.Halt(ErrReconciling)
+
+	report, err := r.reconcile()
+	if err != nil {
+		log.WithError(err).Error("Reconciliation failed, sending is halted")
+		report = &ReconcileReport{
+			ReconciledAt: time.Now().UTC().Unix(),
+			Halted:       true,
+			Error:        err.Error(),
+		}
+		r.setReport(report)
+		return report, err
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"deposits":     report.Deposits,
+		"transactions": report.Transactions,
+	})
+
+	for _, i := range report.Issues {
+		log.WithField("issue", i).Warn("Reconciliation issue")
+	}
+
+	if unresolved := report.Unresolved(); len(unresolved) != 0 {
+		report.Halted = true
+		r.send.Halt(ErrReconcileUnresolved)
+		log.WithField("notice", logger.WatchNotice).WithField("unresolved", len(unresolved)).Error(ErrReconcileUnresolved.Error())
+	} else {
+		r.send.Resume()
+		if wasHalted == ErrReconcileUnresolved {
+			log.WithField("notice", logger.WatchNotice).Info("Reconciliation found no unresolved issues, sending resumed")
+		} else {
+			log.Info("Reconciliation complete")
+		}
+	}
+
+	r.setReport(report)
+
+	return report, nil
+}
+
+func (r *Reconciler) setReport(report *ReconcileReport) {
+	r.reportLock.Lock()
+	defer r.reportLock.Unlock()
+	r.report = report
+}
+
+func (r *Reconciler) reconcile() (*ReconcileReport, error) {
+	// The deposits waiting to send and the deposits with a txid. A txid is kept if an operator
+	// moves a sent deposit to one of the statuses that are not processed.
+	queried, err := r.store.QueryDepositInfo(DepositQuery{
+		Statuses: []string{StatusWaitSend, StatusWaitConfirm, StatusDone, StatusFailed, StatusWaitApproval, StatusRefundPending},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("QueryDepositInfo failed: %v", err)
+	}
+
+	var dis []DepositInfo
+	for _, di := range queried {
+		if di.Txid != "" || di.Status == StatusWaitSend {
+			dis = append(dis, di)
+		}
+	}
+
+	boundAddrs, err := r.store.GetBindAddresses()
+	if err != nil {
+		return nil, fmt.Errorf("GetBindAddresses failed: %v", err)
+	}
+
+	bound := make(map[string]struct{}, len(boundAddrs))
+	for _, ba := range boundAddrs {
+		bound[ba.SkyAddress] = struct{}{}
+	}
+
+	// Deposits by their txid, the unpaid deposits and the paid deposits by their skycoin address
+	recorded := make(map[string][]DepositInfo)
+	unpaid := make(map[string][]DepositInfo)
+	paid := make(map[string][]DepositInfo)
+	var pending []string
+	for _, di := range dis {
+		bound[di.SkyAddress] = struct{}{}
+
+		if di.Txid == "" {
+			unpaid[di.SkyAddress] = append(unpaid[di.SkyAddress], di)
+			continue
+		}
+
+		recorded[di.Txid] = append(recorded[di.Txid], di)
+		paid[di.SkyAddress] = append(paid[di.SkyAddress], di)
+		if di.Status == StatusWaitConfirm {
+			pending = append(pending, di.Txid)
+		}
+	}
+
+	history, err := r.history.WalletHistory(pending)
+	if err != nil {
+		return nil, fmt.Errorf("WalletHistory failed: %v", err)
+	}
+
+	report := &ReconcileReport{
+		ReconciledAt: time.Now().UTC().Unix(),
+		Deposits:     len(dis),
+		Transactions: len(history.Transactions),
+		Issues:       []ReconcileIssue{},
+	}
+
+	for _, tx := range history.Transactions {
+		if _, ok := recorded[tx.Txid]; ok {
+			continue
+		}
+
+		for _, o := range tx.Outputs {
+			// Outputs to other addresses are sweeps to cold storage or transfers made outside of teller
+			if _, ok := bound[o.Address]; !ok {
+				continue
+			}
+
+			issue, err := r.matchPayment(tx, o, unpaid, paid)
+			if err != nil {
+				return nil, err
+			}
+
+			report.Issues = append(report.Issues, *issue)
+		}
+	}
+
+	for _, txid := range history.Missing {
+		for _, di := range recorded[txid] {
+			if di.Status != StatusWaitConfirm {
+				continue
+			}
+
+			issue := ReconcileIssue{
+				Kind:       ReconcileDroppedTransaction,
+				Txid:       txid,
+				DepositIDs: []string{di.DepositID},
+				SkyAddress: di.SkyAddress,
+				Coins:      di.SkySent,
+			}
+
+			// Send rebroadcasts a recorded transaction, or replaces it if its inputs were spent elsewhere.
+			// If an unknown transaction is spending hot wallet outputs, it could be this one
+			// broadcast through another node, so sending a new transaction could pay the deposit twice
+			if di.txAttempt(txid) != -1 {
+				issue.Resolved = true
+			} else if len(history.UnknownSpends) == 0 {
+				issue.Resolved, err = r.requeue(di, txid)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	for _, uxid := range history.UnknownSpends {
+		report.Issues = append(report.Issues, ReconcileIssue{
+			Kind:   ReconcileUnknownSpend,
+			Output: uxid,
+		})
+	}
+
+	return report, nil
+}
+
+// matchPayment records an unrecorded payment on the StatusWaitSend deposit it pays,
+// if there is exactly one. Otherwise the payment is an unresolved issue.
+func (r *Reconciler) matchPayment(tx sender.OutgoingTx, o sender.TxOutput, unpaid, paid map[string][]DepositInfo) (*ReconcileIssue, error) {
+	issue := &ReconcileIssue{
+		Kind:       ReconcileUnrecordedPayment,
+		Txid:       tx.Txid,
+		SkyAddress: o.Address,
+		Coins:      o.Coins,
+	}
+
+	var candidates []DepositInfo
+	var payouts []PayoutData
+	for _, di := range unpaid[o.Address] {
+		payout, err := calculateSkyPayout(di, r.cfg.MaxDecimals, r.cfg.Fees)
+		if err != nil {
+			return nil, err
+		}
+
+		if payout.Net == o.Coins {
+			candidates = append(candidates, di)
+			payouts = append(payouts, payout)
+		}
+	}
+
+	// Teller's payouts have a single output besides change
+	if len(candidates) == 1 && len(tx.Outputs) == 1 {
+		di := candidates[0]
+		issue.DepositIDs = []string{di.DepositID}
+
+		recorded, err := r.recordPayment(di, tx.Txid, payouts[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if recorded {
+			issue.Resolved = true
+
+			var remaining []DepositInfo
+			for _, d := range unpaid[o.Address] {
+				if d.DepositID != di.DepositID {
+					remaining = append(remaining, d)
+				}
+			}
+			unpaid[o.Address] = remaining
+		}
+
+		return issue, nil
+	}
+
+	// A payment of the amount already sent to a deposit pays it twice
+	for _, di := range paid[o.Address] {
+		if di.SkySent == o.Coins {
+			issue.DepositIDs = append(issue.DepositIDs, di.DepositID)
+		}
+	}
+
+	if len(issue.DepositIDs) != 0 {
+		issue.Kind = ReconcileDuplicatePayment
+		return issue, nil
+	}
+
+	for _, di := range candidates {
+		issue.DepositIDs = append(issue.DepositIDs, di.DepositID)
+	}
+
+	return issue, nil
+}
+
+// recordPayment records txid as the transaction that paid a StatusWaitSend deposit.
+// It returns false if the deposit is no longer waiting to be sent.
+func (r *Reconciler) recordPayment(di DepositInfo, txid string, payout PayoutData) (bool, error) {
+	changed := false
+	_, err := r.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		if di.Status != StatusWaitSend {
+			changed = true
+			return di
+		}
+
+		di.Status = StatusWaitConfirm
+		di.Txid = txid
+		di.SkySent = payout.Net
+		di.Payout = payout
+		return di
+	})
+	if err != nil {
+		return false, fmt.Errorf("UpdateDepositInfo failed: %v", err)
+	}
+
+	if !changed {
+		r.log.WithFields(logrus.Fields{
+			"depositID": di.DepositID,
+			"txid":      txid,
+		}).Info("Recorded unrecorded payment of deposit")
+	}
+
+	return !changed, nil
+}
+
+// requeue sets a StatusWaitConfirm deposit whose transaction was dropped back to StatusWaitSend.
+// It returns false if the deposit changed since it was read.
+func (r *Reconciler) requeue(di DepositInfo, txid string) (bool, error) {
+	changed := false
+	_, err := r.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		if di.Status != StatusWaitConfirm || di.Txid != txid {
+			changed = true
+			return di
+		}
+
+		di.Status = StatusWaitSend
+		di.Txid = ""
+		di.SkySent = 0
+		return di
+	})
+	if err != nil {
+		return false, fmt.Errorf("UpdateDepositInfo failed: %v", err)
+	}
+
+	if !changed {
+		r.log.WithFields(logrus.Fields{
+			"depositID": di.DepositID,
+			"txid":      txid,
+		}).Info("Transaction was dropped, deposit set back to StatusWaitSend")
+	}
+
+	return !changed, nil
+}
@@ -0,0 +1,375 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/sender"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type fakeWalletHistorian struct {
+	history sender.WalletHistory
+	err     error
+	pending []string
+}
+
+func (h *fakeWalletHistorian) WalletHistory(pending []string) (*sender.WalletHistory, error) {
+	h.pending = pending
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	history := h.history
+	return &history, nil
+}
+
+type fakeSendHalter struct {
+	halted error
+}
+
+func (s *fakeSendHalter) Halt(reason error) {
+	s.halted = reason
+}
+
+func (s *fakeSendHalter) Resume() {
+	s.halted = nil
+}
+
+func (s *fakeSendHalter) Halted() error {
+	return s.halted
+}
+
+func setupReconciler(t *testing.T) (*Reconciler, *Store, *fakeWalletHistorian, *fakeSendHalter, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	historian := &fakeWalletHistorian{}
+	halter := &fakeSendHalter{}
+
+	r := NewReconciler(log, defaultCfg, store, historian, halter)
+
+	return r, store, historian, halter, shutdown
+}
+
+// addReconcileDeposit adds a deposit paying skyAddr, and returns it with the SKY it is owed
+func addReconcileDeposit(t *testing.T, store *Store, n int, skyAddr, status, txid string) (DepositInfo, uint64) {
+	di := newOperatorDepositInfo(status)
+	di.Seq = uint64(n)
+	di.SkyAddress = skyAddr
+	di.DepositID = "foo-deposit-id:" + string(rune('0'+n))
+	di.DepositAddress = "foo-deposit-addr-" + string(rune('0'+n))
+
+	skySent, err := calculateSkyDroplets(di, defaultCfg.MaxDecimals, defaultCfg.Fees)
+	require.NoError(t, err)
+
+	if txid != "" {
+		di.Txid = txid
+		di.SkySent = skySent
+	}
+
+	di, err = store.addDepositInfo(di)
+	require.NoError(t, err)
+
+	return di, skySent
+}
+
+func payment(txid string, confirmed bool, addr string, coins uint64) sender.OutgoingTx {
+	return sender.OutgoingTx{
+		Txid:      txid,
+		Confirmed: confirmed,
+		Outputs: []sender.TxOutput{{
+			Address: addr,
+			Coins:   coins,
+		}},
+	}
+}
+
+func TestReconcileClean(t *testing.T) {
+	r, store, historian, halter, shutdown := setupReconciler(t)
+	defer shutdown()
+
+	_, _ = addReconcileDeposit(t, store, 1, testSkyAddr, StatusWaitSend, "")
+	_, sent := addReconcileDeposit(t, store, 2, testSkyAddr, StatusDone, "tx2")
+	_, _ = addReconcileDeposit(t, store, 3, testSkyAddr2, StatusWaitConfirm, "tx3")
+
+	pk, _ := cipher.GenerateKeyPair()
+	coldAddr := cipher.AddressFromPubKey(pk).String()
+
+	// A sweep to cold storage is not a payment
+	historian.history.Transactions = []sender.OutgoingTx{
+		payment("tx2", true, testSkyAddr, sent),
+		payment("tx3", false, testSkyAddr2, sent),
+		payment("sweep", true, coldAddr, 500e6),
+	}
+
+	halter.Halt(ErrReconciling)
+
+	report, err := r.Reconcile()
+	require.NoError(t, err)
+	require.Equal(t, []string{"tx3"}, historian.pending)
+	require.Equal(t, 3, report.Deposits)
+	require.Equal(t, 3, report.Transactions)
+	require.Empty(t, report.Issues)
+	require.False(t, report.Halted)
+	require.NoError(t, halter.Halted())
+	require.Equal(t, report, r.Report())
+}
+
+func TestReconcileUnrecordedPayment(t *testing.T) {
+	r, store, historian, halter, shutdown := setupReconciler(t)
+	defer shutdown()
+
+	di, owed := addReconcileDeposit(t, store, 1, testSkyAddr, StatusWaitSend, "")
+
+	// Teller crashed after broadcasting the deposit's payment, before saving it
+	historian.history.Transactions = []sender.OutgoingTx{
+		payment("tx1", false, testSkyAddr, owed),
+	}
+
+	report, err := r.Reconcile()
+	require.NoError(t, err)
+	require.Equal(t, []ReconcileIssue{{
+		Kind:       ReconcileUnrecordedPayment,
+		Txid:       "tx1",
+		DepositIDs: []string{di.DepositID},
+		SkyAddress: testSkyAddr,
+		Coins:      owed,
+		Resolved:   true,
+	}}, report.Issues)
+	require.NoError(t, halter.Halted())
+
+	stored, err := store.GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, stored.Status)
+	require.Equal(t, "tx1", stored.Txid)
+	require.Equal(t, owed, stored.SkySent)
+
+	history, err := store.GetDepositHistory(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, "reconcile", history[len(history)-1].Component)
+
+	// The payment is recorded now
+	report, err = r.Reconcile()
+	require.NoError(t, err)
+	require.Empty(t, report.Issues)
+}
+
+func TestReconcileUnresolved(t *testing.T) {
+	r, store, historian, halter, shutdown := setupReconciler(t)
+	defer shutdown()
+
+	paid, sent := addReconcileDeposit(t, store, 1, testSkyAddr, StatusDone, "tx1")
+	_, owed := addReconcileDeposit(t, store, 2, testSkyAddr2, StatusWaitSend, "")
+	_, _ = addReconcileDeposit(t, store, 3, testSkyAddr2, StatusWaitSend, "")
+
+	historian.history.Transactions = []sender.OutgoingTx{
+		payment("tx1", true, testSkyAddr, sent),
+		// A restored backup lost the record of a payment, and the deposit was paid again
+		payment("tx2", true, testSkyAddr, sent),
+		// Two deposits are waiting to be paid the same amount, so the payment is ambiguous
+		payment("tx3", true, testSkyAddr2, owed),
+		// Payments that match no deposit are unrecorded
+		payment("tx4", true, testSkyAddr, 1e6),
+	}
+
+	report, err := r.Reconcile()
+	require.NoError(t, err)
+	require.True(t, report.Halted)
+	require.Equal(t, ErrReconcileUnresolved, halter.Halted())
+	require.Len(t, report.Unresolved(), 3)
+
+	require.Equal(t, ReconcileDuplicatePayment, report.Issues[0].Kind)
+	require.Equal(t, "tx2", report.Issues[0].Txid)
+	require.Equal(t, []string{paid.DepositID}, report.Issues[0].DepositIDs)
+
+	require.Equal(t, ReconcileUnrecordedPayment, report.Issues[1].Kind)
+	require.Equal(t, "tx3", report.Issues[1].Txid)
+	require.Len(t, report.Issues[1].DepositIDs, 2)
+
+	require.Equal(t, ReconcileUnrecordedPayment, report.Issues[2].Kind)
+	require.Equal(t, "tx4", report.Issues[2].Txid)
+	require.Empty(t, report.Issues[2].DepositIDs)
+
+	// Nothing was changed
+	dis, err := store.GetDepositInfoArray(func(di DepositInfo) bool {
+		return di.Status == StatusWaitSend
+	})
+	require.NoError(t, err)
+	require.Len(t, dis, 2)
+
+	// Once an operator has resolved the issues, sending resumes
+	historian.history.Transactions = historian.history.Transactions[:1]
+	report, err = r.Reconcile()
+	require.NoError(t, err)
+	require.False(t, report.Halted)
+	require.NoError(t, halter.Halted())
+}
+
+func TestReconcileDroppedTransaction(t *testing.T) {
+	r, store, historian, halter, shutdown := setupReconciler(t)
+	defer shutdown()
+
+	di, sent := addReconcileDeposit(t, store, 1, testSkyAddr, StatusWaitConfirm, "tx1")
+
+	// While an unknown transaction spends hot wallet outputs, the dropped transaction isn't sent again
+	historian.history.Missing = []string{"tx1"}
+	historian.history.UnknownSpends = []string{"ux1"}
+
+	report, err := r.Reconcile()
+	require.NoError(t, err)
+	require.Equal(t, []ReconcileIssue{
+		{
+			Kind:       ReconcileDroppedTransaction,
+			Txid:       "tx1",
+			DepositIDs: []string{di.DepositID},
+			SkyAddress: testSkyAddr,
+			Coins:      sent,
+		},
+		{
+			Kind:   ReconcileUnknownSpend,
+			Output: "ux1",
+		},
+	}, report.Issues)
+	require.Equal(t, ErrReconcileUnresolved, halter.Halted())
+
+	stored, err := store.GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, stored.Status)
+
+	// Otherwise the deposit is sent again
+	historian.history.UnknownSpends = nil
+
+	report, err = r.Reconcile()
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 1)
+	require.True(t, report.Issues[0].Resolved)
+	require.NoError(t, halter.Halted())
+
+	stored, err = store.GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, stored.Status)
+	require.Empty(t, stored.Txid)
+	require.Zero(t, stored.SkySent)
+}
+
+func TestReconcileFailed(t *testing.T) {
+	r, _, historian, halter, shutdown := setupReconciler(t)
+	defer shutdown()
+
+	historian.err = errors.New("skycoin node unavailable")
+
+	report, err := r.Reconcile()
+	require.Error(t, err)
+	require.True(t, report.Halted)
+	require.Equal(t, "WalletHistory failed: skycoin node unavailable", report.Error)
+	require.Equal(t, ErrReconciling, halter.Halted())
+}
+
+func TestReconcileStartup(t *testing.T) {
+	r, _, historian, halter, shutdown := setupReconciler(t)
+	defer shutdown()
+
+	r.retryWait = statusCheckInterval
+	historian.err = errors.New("skycoin node unavailable")
+
+	r.haltUntilReconciled()
+	require.Equal(t, ErrReconciling, halter.Halted())
+
+	go testutil.CheckError(t, r.Run)
+	defer r.Shutdown()
+
+	// Startup reconciliation is retried until it succeeds
+	r.Lock()
+	historian.err = nil
+	r.Unlock()
+
+	for i := 0; i < 100; i++ {
+		if report := r.Report(); report != nil && report.Error == "" {
+			break
+		}
+		<-time.After(statusCheckInterval)
+	}
+
+	require.NotNil(t, r.Report())
+	require.Empty(t, r.Report().Error)
+
+	r.Lock()
+	require.NoError(t, halter.Halted())
+	r.Unlock()
+}
+
+func TestSendHalt(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	send := e.Sender.(*Send)
+	di := mustAddOperatorDepositInfo(t, e, newOperatorDepositInfo(StatusWaitSend))
+
+	// Nothing is sent while sending is halted
+	send.Halt(ErrReconciling)
+	require.Equal(t, ErrReconciling, send.Halted())
+
+	_, err := send.handleDepositInfoState(di)
+	require.Equal(t, ErrSendHalted, err)
+
+	stored, err := e.store.(*Store).GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, stored.Status)
+
+	send.Resume()
+	require.NoError(t, send.Halted())
+
+	di, err = send.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, di.Status)
+
+	// A queued copy is reloaded, and dropped once it no longer needs sending
+	_, err = e.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = send.reloadDeposit(di)
+	require.Equal(t, ErrDepositChanged, err)
+}
+
+func TestReconcileDroppedTransactionRebroadcast(t *testing.T) {
+	r, store, historian, halter, shutdown := setupReconciler(t)
+	defer shutdown()
+
+	di := newOperatorDepositInfo(StatusWaitConfirm)
+	di.Txid = "tx1"
+	di.SkySent = 100e6
+	di.TxAttempts = []TxAttempt{{
+		Txid:   "tx1",
+		RawTx:  "00",
+		Status: TxAttemptPending,
+	}}
+	di, err := store.addDepositInfo(di)
+	require.NoError(t, err)
+
+	// A recorded transaction is rebroadcast by Send, so it stays StatusWaitConfirm
+	historian.history.Missing = []string{"tx1"}
+
+	report, err := r.Reconcile()
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 1)
+	require.Equal(t, ReconcileDroppedTransaction, report.Issues[0].Kind)
+	require.True(t, report.Issues[0].Resolved)
+	require.NoError(t, halter.Halted())
+
+	stored, err := store.GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, di, stored)
+}
@@ -0,0 +1,76 @@
+package exchange
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+var (
+	// ErrSendEnableRequiresRestart is returned when reloading a config that enables sending, if sending was disabled at startup
+	ErrSendEnableRequiresRestart = errors.New("Sending was disabled at startup, enabling it requires a restart")
+	// ErrSendDisabled is the reason sending is halted after a reloaded config disabled sending
+	ErrSendDisabled = errors.New("Sending is disabled")
+)
+
+// liveConfig holds the settings of the config that can be changed while running:
+// the exchange rates, the volume limits and sky_exchanger.send_enabled.
+// The components read these settings from it instead of their own copy of the config.
+type liveConfig struct {
+	sync.RWMutex
+	cfg config.SkyExchanger
+}
+
+func newLiveConfig(cfg config.SkyExchanger) *liveConfig {
+	return &liveConfig{
+		cfg: cfg,
+	}
+}
+
+func (c *liveConfig) get() config.SkyExchanger {
+	c.RLock()
+	defer c.RUnlock()
+	return c.cfg
+}
+
+func (c *liveConfig) set(cfg config.SkyExchanger) {
+	c.Lock()
+	defer c.Unlock()
+	c.cfg = cfg
+}
+
+// ApplyConfig applies the exchange rates, volume limits and send_enabled of a reloaded config.
+// Disabling sending waits for a transaction being created or broadcast to finish.
+// Deposits received after it returns are recorded at the new rates.
+func (e *Exchange) ApplyConfig(cfg config.SkyExchanger) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.SendEnabled && !e.cfg.SendEnabled {
+		return ErrSendEnableRequiresRestart
+	}
+
+	wasEnabled := e.live.get().SendEnabled
+	e.live.set(cfg)
+
+	if wasEnabled && !cfg.SendEnabled {
+		if w, ok := e.Sender.(sendWaiter); ok {
+			w.waitSend()
+		}
+	}
+
+	e.log.WithField("notice", logger.WatchNotice).WithFields(logrus.Fields{
+		"skyBtcExchangeRate": cfg.SkyBtcExchangeRate,
+		"skyEthExchangeRate": cfg.SkyEthExchangeRate,
+		"skySkyExchangeRate": cfg.SkySkyExchangeRate,
+		"limits":             cfg.Limits,
+		"sendEnabled":        cfg.SendEnabled,
+	}).Info("Applied reloaded config")
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+)
+
+func TestExchangeApplyConfig(t *testing.T) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	defer shutdown()
+
+	receiver := e.Receiver.(*Receive)
+	send := e.Sender.(*Send)
+
+	rate, err := receiver.getRate(config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, testSkyBtcRate, rate)
+
+	saleCap, err := e.SaleCap()
+	require.NoError(t, err)
+	require.False(t, saleCap.Enabled)
+
+	cfg := defaultCfg
+	cfg.SkyBtcExchangeRate = "1000"
+	cfg.Limits.TotalSkySold = "100"
+	cfg.SendEnabled = false
+
+	// An invalid config is not applied
+	invalidCfg := cfg
+	invalidCfg.Limits.BtcDaily = "-1"
+	require.Error(t, e.ApplyConfig(invalidCfg))
+
+	rate, err = receiver.getRate(config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, testSkyBtcRate, rate)
+
+	require.NoError(t, e.ApplyConfig(cfg))
+
+	rate, err = receiver.getRate(config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, "1000", rate)
+
+	saleCap, err = e.SaleCap()
+	require.NoError(t, err)
+	require.True(t, saleCap.Enabled)
+	require.Equal(t, "100", saleCap.Cap)
+
+	require.Equal(t, ErrSendDisabled, send.Halted())
+
+	// The settings that need a restart are not changed
+	require.Equal(t, defaultCfg, e.cfg)
+
+	cfg.SendEnabled = true
+	require.NoError(t, e.ApplyConfig(cfg))
+	require.NoError(t, send.Halted())
+
+	// Sending can't be enabled if it was disabled at startup
+	e.cfg.SendEnabled = false
+	require.Equal(t, ErrSendEnableRequiresRestart, e.ApplyConfig(cfg))
+}
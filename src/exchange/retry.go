@@ -0,0 +1,273 @@
+package exchange
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// DepositFailer handles deposits whose processing failed
+type DepositFailer interface {
+	Fail(component string, di DepositInfo, err error)
+}
+
+// failDeposit hands a failed deposit to failer.
+// Without a failer, the deposit will not be reprocessed until teller is restarted.
+func failDeposit(log logrus.FieldLogger, failer DepositFailer, component string, di DepositInfo, err error) {
+	if failer == nil {
+		msg := "Processing deposit failed. This deposit will not be reprocessed until teller is restarted."
+		log.WithField("notice", logger.WatchNotice).WithError(err).Error(msg)
+		return
+	}
+
+	failer.Fail(component, di, err)
+}
+
+// Retrier retries deposits that failed processing, waiting exponentially longer
+// after each failed attempt. Failed deposits are recorded in the store, so that
+// the attempts are remembered across restarts.
+// Once a deposit has failed cfg.MaxAttempts times, its status is set to StatusFailed.
+type Retrier struct {
+	log      logrus.FieldLogger
+	cfg      config.Retry
+	store    Storer
+	resubmit func(DepositInfo) error
+	quit     chan struct{}
+	done     chan struct{}
+	// Protects the DepositRetry records from concurrent updates by Fail and the scheduler
+	sync.Mutex
+}
+
+// NewRetrier creates a Retrier. resubmit queues a deposit on the component that handles its status.
+func NewRetrier(log logrus.FieldLogger, cfg config.Retry, store Storer, resubmit func(DepositInfo) error) *Retrier {
+	return &Retrier{
+		log:      log.WithField("prefix", "teller.exchange.retry"),
+		cfg:      cfg,
+		store:    withComponent(store, "retry"),
+		resubmit: resubmit,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}, 1),
+	}
+}
+
+// Run retries failed deposits when they are due
+func (r *Retrier) Run() error {
+	log := r.log
+	log.Info("Start retry service...")
+	defer func() {
+		log.Info("Closed retry service")
+		r.done <- struct{}{}
+	}()
+
+	if r.cfg.MaxAttempts == 0 {
+		log.Info("Retrying failed deposits is disabled")
+		<-r.quit
+		return nil
+	}
+
+	// All unfinished deposits are reprocessed on startup, so any resubmission
+	// scheduled before the restart is already happening
+	if err := r.markResubmitted(); err != nil {
+		log.WithError(err).Error("markResubmitted failed")
+		return err
+	}
+
+	ticker := time.NewTicker(r.cfg.CheckWait)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.quit:
+			log.Info("quit")
+			return nil
+		case <-ticker.C:
+			if err := r.retryDue(time.Now().UTC()); err != nil {
+				log.WithError(err).Error("retryDue failed")
+			}
+		}
+	}
+}
+
+// Shutdown stops the Retrier
+func (r *Retrier) Shutdown() {
+	close(r.quit)
+	r.log.Info("Waiting for run to finish")
+	<-r.done
+	r.log.Info("Shutdown complete")
+}
+
+// Fail records a failed attempt at processing a deposit and schedules the next attempt.
+// After cfg.MaxAttempts failed attempts, the deposit's status is set to StatusFailed.
+func (r *Retrier) Fail(component string, di DepositInfo, err error) {
+	log := r.log.WithFields(logrus.Fields{
+		"depositInfo": di,
+		"component":   component,
+	}).WithError(err)
+
+	if r.cfg.MaxAttempts == 0 {
+		msg := "Processing deposit failed. This deposit will not be reprocessed until teller is restarted."
+		log.WithField("notice", logger.WatchNotice).Error(msg)
+		return
+	}
+
+	if !isProcessedStatus(di.Status) {
+		msg := "Processing deposit failed, but the deposit is finished or held and will not be retried. If this is a mistake, you must recover manually"
+		log.WithField("notice", logger.WatchNotice).Error(msg)
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	dr, getErr := r.store.GetDepositRetry(di.DepositID)
+	if getErr != nil {
+		log.WithField("notice", logger.WatchNotice).WithError(getErr).Error("GetDepositRetry failed. This deposit will not be reprocessed until teller is restarted.")
+		return
+	}
+
+	if dr == nil {
+		dr = &DepositRetry{
+			DepositID: di.DepositID,
+		}
+	}
+
+	dr.Status = di.Status
+	dr.Component = component
+	dr.Attempts++
+	dr.LastError = err.Error()
+
+	log = log.WithField("attempts", dr.Attempts)
+
+	if dr.Attempts >= r.cfg.MaxAttempts {
+		if _, updateErr := r.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+			di.Status = StatusFailed
+			di.Error = err.Error()
+			return di
+		}); updateErr != nil {
+			log.WithField("notice", logger.WatchNotice).WithError(updateErr).Error("UpdateDepositInfo set StatusFailed failed. This deposit will not be reprocessed until teller is restarted.")
+			return
+		}
+
+		if deleteErr := r.store.DeleteDepositRetry(di.DepositID); deleteErr != nil {
+			log.WithError(deleteErr).Error("DeleteDepositRetry failed")
+		}
+
+		log.WithField("notice", logger.WatchNotice).Error("Processing deposit failed too many times, DepositInfo set to StatusFailed")
+		return
+	}
+
+	wait := r.backoff(dr.Attempts)
+	dr.NextAttemptAt = time.Now().UTC().Add(wait).Unix()
+
+	if putErr := r.store.PutDepositRetry(*dr); putErr != nil {
+		log.WithField("notice", logger.WatchNotice).WithError(putErr).Error("PutDepositRetry failed. This deposit will not be reprocessed until teller is restarted.")
+		return
+	}
+
+	log.WithField("wait", wait).Warn("Processing deposit failed, scheduled retry")
+}
+
+// backoff returns how long to wait after a number of failed attempts
+func (r *Retrier) backoff(attempts int) time.Duration {
+	wait := r.cfg.InitialWait
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= r.cfg.MaxWait {
+			return r.cfg.MaxWait
+		}
+	}
+
+	return wait
+}
+
+// markResubmitted marks all scheduled retries as resubmitted
+func (r *Retrier) markResubmitted() error {
+	r.Lock()
+	defer r.Unlock()
+
+	drs, err := r.store.GetDepositRetries()
+	if err != nil {
+		return err
+	}
+
+	for _, dr := range drs {
+		if dr.NextAttemptAt == 0 {
+			continue
+		}
+
+		dr.NextAttemptAt = 0
+		if err := r.store.PutDepositRetry(dr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retryDue resubmits the deposits due to be retried at now, and forgets
+// the retries of deposits that have since finished or been held
+func (r *Retrier) retryDue(now time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+
+	drs, err := r.store.GetDepositRetries()
+	if err != nil {
+		return err
+	}
+
+	for _, dr := range drs {
+		log := r.log.WithField("depositRetry", dr)
+
+		di, err := r.store.GetDepositInfo(dr.DepositID)
+		if err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				log.Error("DepositRetry has no DepositInfo")
+				if err := r.store.DeleteDepositRetry(dr.DepositID); err != nil {
+					return err
+				}
+				continue
+			default:
+				return err
+			}
+		}
+
+		switch {
+		case !isProcessedStatus(di.Status):
+			log.WithField("depositInfo", di).Info("Deposit finished or held, forgetting retry")
+			if err := r.store.DeleteDepositRetry(dr.DepositID); err != nil {
+				return err
+			}
+
+		case dr.NextAttemptAt != 0 && dr.NextAttemptAt <= now.Unix():
+			log = log.WithField("depositInfo", di)
+
+			dr.NextAttemptAt = 0
+			if err := r.store.PutDepositRetry(dr); err != nil {
+				return err
+			}
+
+			// Resubmitting blocks if the component's queue is full, so release the lock
+			r.Unlock()
+			err := r.resubmit(di)
+			r.Lock()
+
+			if err != nil {
+				if err == errQuit {
+					return nil
+				}
+				log.WithError(err).Error("Resubmitting deposit failed")
+				continue
+			}
+
+			log.Info("Resubmitted deposit for retry")
+		}
+	}
+
+	return nil
+}
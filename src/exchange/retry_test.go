@@ -0,0 +1,234 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+var (
+	defaultRetryCfg = config.Retry{
+		MaxAttempts: 3,
+		InitialWait: time.Minute,
+		MaxWait:     time.Minute * 3,
+		CheckWait:   time.Millisecond * 10,
+	}
+)
+
+type resubmitRecorder struct {
+	deposits []DepositInfo
+	err      error
+}
+
+func (r *resubmitRecorder) resubmit(di DepositInfo) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.deposits = append(r.deposits, di)
+	return nil
+}
+
+func setupRetrier(t *testing.T, cfg config.Retry) (*Retrier, *Store, *resubmitRecorder, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	recorder := &resubmitRecorder{}
+	return NewRetrier(log, cfg, store, recorder.resubmit), store, recorder, shutdown
+}
+
+func mustAddRetryDepositInfo(t *testing.T, s *Store, seq uint64, status string) DepositInfo {
+	di := newOperatorDepositInfo(status)
+	di.Seq = seq
+	di.DepositID = "foo-deposit-id:" + string('0'+rune(seq))
+	if status == StatusDone {
+		di.Txid = testOperatorTxid
+	}
+
+	di, err := s.addDepositInfo(di)
+	require.NoError(t, err)
+	return di
+}
+
+func TestRetrierBackoff(t *testing.T) {
+	r, _, _, shutdown := setupRetrier(t, defaultRetryCfg)
+	defer shutdown()
+
+	require.Equal(t, time.Minute, r.backoff(1))
+	require.Equal(t, time.Minute*2, r.backoff(2))
+	require.Equal(t, time.Minute*3, r.backoff(3))
+	require.Equal(t, time.Minute*3, r.backoff(10))
+}
+
+func TestRetrierFail(t *testing.T) {
+	r, s, _, shutdown := setupRetrier(t, defaultRetryCfg)
+	defer shutdown()
+
+	di := mustAddRetryDepositInfo(t, s, 1, StatusWaitSend)
+	failErr := errors.New("skycoin node unavailable")
+
+	start := time.Now().UTC()
+	r.Fail("send", di, failErr)
+
+	dr, err := s.GetDepositRetry(di.DepositID)
+	require.NoError(t, err)
+	require.NotNil(t, dr)
+	require.Equal(t, 1, dr.Attempts)
+	require.Equal(t, StatusWaitSend, dr.Status)
+	require.Equal(t, "send", dr.Component)
+	require.Equal(t, failErr.Error(), dr.LastError)
+	require.True(t, dr.NextAttemptAt >= start.Add(time.Minute).Unix())
+
+	r.Fail("send", di, failErr)
+
+	dr, err = s.GetDepositRetry(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, 2, dr.Attempts)
+	require.True(t, dr.NextAttemptAt >= start.Add(time.Minute*2).Unix())
+
+	// The deposit is unchanged while it is being retried
+	stored, err := s.GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, stored.Status)
+	require.Empty(t, stored.Error)
+
+	// After the maximum attempts, the deposit is failed
+	r.Fail("send", di, failErr)
+
+	dr, err = s.GetDepositRetry(di.DepositID)
+	require.NoError(t, err)
+	require.Nil(t, dr)
+
+	stored, err = s.GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusFailed, stored.Status)
+	require.Equal(t, failErr.Error(), stored.Error)
+
+	history, err := s.GetDepositHistory(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, "retry", history[len(history)-1].Component)
+	require.Equal(t, StatusFailed, history[len(history)-1].ToStatus)
+
+	// Finished deposits are not retried
+	done := mustAddRetryDepositInfo(t, s, 2, StatusDone)
+	r.Fail("passthrough", done, failErr)
+
+	dr, err = s.GetDepositRetry(done.DepositID)
+	require.NoError(t, err)
+	require.Nil(t, dr)
+}
+
+func TestRetrierFailDisabled(t *testing.T) {
+	r, s, _, shutdown := setupRetrier(t, config.Retry{})
+	defer shutdown()
+
+	di := mustAddRetryDepositInfo(t, s, 1, StatusWaitSend)
+	r.Fail("send", di, errors.New("skycoin node unavailable"))
+
+	drs, err := s.GetDepositRetries()
+	require.NoError(t, err)
+	require.Empty(t, drs)
+}
+
+func TestRetrierRetryDue(t *testing.T) {
+	r, s, recorder, shutdown := setupRetrier(t, defaultRetryCfg)
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	due := mustAddRetryDepositInfo(t, s, 1, StatusWaitSend)
+	notDue := mustAddRetryDepositInfo(t, s, 2, StatusWaitDecide)
+	finished := mustAddRetryDepositInfo(t, s, 3, StatusDone)
+	resubmitted := mustAddRetryDepositInfo(t, s, 4, StatusWaitSend)
+
+	for _, dr := range []DepositRetry{
+		{
+			DepositID:     due.DepositID,
+			Attempts:      1,
+			NextAttemptAt: now.Add(-time.Second).Unix(),
+		},
+		{
+			DepositID:     notDue.DepositID,
+			Attempts:      1,
+			NextAttemptAt: now.Add(time.Minute).Unix(),
+		},
+		{
+			DepositID:     finished.DepositID,
+			Attempts:      1,
+			NextAttemptAt: now.Add(-time.Second).Unix(),
+		},
+		{
+			DepositID: resubmitted.DepositID,
+			Attempts:  1,
+		},
+	} {
+		err := s.PutDepositRetry(dr)
+		require.NoError(t, err)
+	}
+
+	err := r.retryDue(now)
+	require.NoError(t, err)
+
+	require.Equal(t, []DepositInfo{due}, recorder.deposits)
+
+	// The resubmitted deposit's retry is kept, so that its attempts are counted if it fails again
+	dr, err := s.GetDepositRetry(due.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), dr.NextAttemptAt)
+	require.Equal(t, 1, dr.Attempts)
+
+	dr, err = s.GetDepositRetry(notDue.DepositID)
+	require.NoError(t, err)
+	require.NotEqual(t, int64(0), dr.NextAttemptAt)
+
+	dr, err = s.GetDepositRetry(finished.DepositID)
+	require.NoError(t, err)
+	require.Nil(t, dr)
+
+	// Nothing is due on the next check
+	recorder.deposits = nil
+	err = r.retryDue(now)
+	require.NoError(t, err)
+	require.Empty(t, recorder.deposits)
+}
+
+func TestRetrierRun(t *testing.T) {
+	r, s, recorder, shutdown := setupRetrier(t, defaultRetryCfg)
+	defer shutdown()
+
+	di := mustAddRetryDepositInfo(t, s, 1, StatusWaitSend)
+
+	// A retry scheduled before a restart is not resubmitted again,
+	// since the deposit is reprocessed on startup
+	err := s.PutDepositRetry(DepositRetry{
+		DepositID:     di.DepositID,
+		Attempts:      1,
+		NextAttemptAt: time.Now().UTC().Add(-time.Second).Unix(),
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := r.Run()
+		require.NoError(t, err)
+	}()
+
+	time.Sleep(defaultRetryCfg.CheckWait * 5)
+	r.Shutdown()
+	<-done
+
+	require.Empty(t, recorder.deposits)
+
+	dr, err := s.GetDepositRetry(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), dr.NextAttemptAt)
+	require.Equal(t, 1, dr.Attempts)
+}
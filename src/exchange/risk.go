@@ -0,0 +1,420 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/mathutil"
+)
+
+const (
+	// RiskRuleMaxDeposit holds deposits larger than the coin's maximum deposit
+	RiskRuleMaxDeposit = "max_deposit"
+	// RiskRuleSkyAddressDailyMax holds deposits that take the SKY owed to a skycoin address in 24 hours over the maximum
+	RiskRuleSkyAddressDailyMax = "sky_address_daily_max"
+	// RiskRuleFirstDeposit holds deposits to a skycoin address that has not completed a deposit before
+	RiskRuleFirstDeposit = "first_deposit"
+	// RiskRuleDenyList holds deposits whose skycoin address or source addresses are on a deny list
+	RiskRuleDenyList = "deny_list"
+	// RiskRuleInvoiceDeviation holds deposits that differ from the amount expected when the address was bound
+	RiskRuleInvoiceDeviation = "invoice_deviation"
+
+	// riskDailyWindow is the period that RiskRuleSkyAddressDailyMax totals deposits over
+	riskDailyWindow = time.Hour * 24
+)
+
+// AddressScreener checks addresses against deny lists
+type AddressScreener interface {
+	// Check returns an error if the address is denied. source describes what was screened.
+	Check(coinType, address, source string) error
+}
+
+// riskRules checks StatusWaitDecide deposits against the configured volume limits and risk rules.
+// Deposits that exceed a limit are set to StatusRefundPending,
+// and deposits that match a rule are held for operator approval.
+type riskRules struct {
+	log         logrus.FieldLogger
+	cfg         config.Risk
+	live        *liveConfig // The volume limits, which can be changed by reloading the config
+	maxDecimals int
+	store       Storer
+	screener    AddressScreener
+	skySold     skySoldCache // The SKY sold totals checked by the public endpoints
+}
+
+func newRiskRules(log logrus.FieldLogger, cfg config.SkyExchanger, store Storer) *riskRules {
+	return &riskRules{
+		log:         log.WithField("prefix", "teller.exchange.risk"),
+		cfg:         cfg.Risk,
+		live:        newLiveConfig(cfg),
+		maxDecimals: cfg.MaxDecimals,
+		store:       withComponent(store, "risk"),
+		skySold: skySoldCache{
+			ttl: skySoldCacheTTL,
+		},
+	}
+}
+
+// screen sets a deposit to StatusRefundPending if it exceeds a volume limit,
+// or holds it with StatusWaitApproval if it matches a risk rule.
+// It returns the deposit and true if the deposit can be processed.
+// Deposits that were approved by an operator are not checked again.
+func (r *riskRules) screen(di DepositInfo) (DepositInfo, bool, error) {
+	if di.Status != StatusWaitDecide || di.Risk.Approved {
+		return di, true, nil
+	}
+
+	log := r.log.WithField("depositInfo", di)
+	now := time.Now().UTC()
+
+	refuse, err := r.checkLimits(di, now)
+	if err != nil {
+		log.WithError(err).Error("Checking volume limits failed")
+		return di, false, err
+	}
+
+	if refuse != nil {
+		updatedDi, err := r.setStatus(di, StatusRefundPending, *refuse)
+		if err != nil {
+			log.WithError(err).Error("UpdateDepositInfo set StatusRefundPending failed")
+			return di, false, err
+		}
+
+		log.WithField("depositInfo", updatedDi).WithField("notice", logger.WatchNotice).Warn("Deposit exceeds a volume limit and is pending refund")
+
+		return updatedDi, false, nil
+	}
+
+	hold, err := r.check(di, now)
+	if err != nil {
+		log.WithError(err).Error("Checking risk rules failed")
+		return di, false, err
+	}
+
+	if hold == nil {
+		return di, true, nil
+	}
+
+	updatedDi, err := r.setStatus(di, StatusWaitApproval, *hold)
+	if err != nil {
+		log.WithError(err).Error("UpdateDepositInfo set StatusWaitApproval failed")
+		return di, false, err
+	}
+
+	log.WithField("depositInfo", updatedDi).WithField("notice", logger.WatchNotice).Warn("Deposit matched a risk rule and is waiting for approval")
+
+	return updatedDi, false, nil
+}
+
+// setStatus sets the status of a StatusWaitDecide deposit and records the rule that fired
+func (r *riskRules) setStatus(di DepositInfo, status string, data RiskData) (DepositInfo, error) {
+	// The deposit may have been changed by an operator since it was queued
+	var changed bool
+	return r.store.UpdateDepositInfoCallback(di.DepositID, func(di DepositInfo) DepositInfo {
+		changed = di.Status != StatusWaitDecide || di.Risk.Approved
+		di.Status = status
+		di.Risk = data
+		return di
+	}, func(di DepositInfo) error {
+		if changed {
+			return ErrDepositChanged
+		}
+		return di.ValidateForStatus()
+	})
+}
+
+// check returns the first risk rule that a deposit matches, or nil if it matches none
+func (r *riskRules) check(di DepositInfo, now time.Time) (*RiskData, error) {
+	if hold := r.checkDenyList(di); hold != nil {
+		return hold, nil
+	}
+
+	if hold, err := r.checkMaxDeposit(di); err != nil || hold != nil {
+		return hold, err
+	}
+
+	if hold, err := r.checkInvoiceDeviation(di); err != nil || hold != nil {
+		return hold, err
+	}
+
+	if r.cfg.SkyAddressDailyMax == "" && !r.cfg.HoldFirstDeposit {
+		return nil, nil
+	}
+
+	// Other deposits to the same skycoin address
+	dis, err := r.store.GetDepositInfoOfSkyAddress(di.SkyAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	var others []DepositInfo
+	for _, d := range dis {
+		if d.DepositID == "" || d.DepositID == di.DepositID || d.SkyAddress != di.SkyAddress {
+			continue
+		}
+		others = append(others, d)
+	}
+
+	if hold, err := r.checkSkyAddressDailyMax(di, others, now); err != nil || hold != nil {
+		return hold, err
+	}
+
+	return r.checkFirstDeposit(di, others), nil
+}
+
+func (r *riskRules) checkDenyList(di DepositInfo) *RiskData {
+	if r.screener == nil {
+		return nil
+	}
+
+	source := fmt.Sprintf("deposit %s", di.DepositID)
+	if err := r.screener.Check(config.CoinTypeSKY, di.SkyAddress, source); err != nil {
+		return &RiskData{
+			Rule:   RiskRuleDenyList,
+			Detail: fmt.Sprintf("Skycoin address %s: %v", di.SkyAddress, err),
+		}
+	}
+
+	for _, addr := range di.SourceAddresses {
+		if err := r.screener.Check(di.CoinType, addr, source); err != nil {
+			return &RiskData{
+				Rule:   RiskRuleDenyList,
+				Detail: fmt.Sprintf("Source address %s: %v", addr, err),
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *riskRules) checkMaxDeposit(di DepositInfo) (*RiskData, error) {
+	max, err := r.cfg.MaxDeposit(di.CoinType)
+	if err != nil {
+		return nil, err
+	}
+
+	if max.Sign() == 0 {
+		return nil, nil
+	}
+
+	amount, err := depositValueToDecimal(di.CoinType, di.DepositValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if amount.LessThanOrEqual(max) {
+		return nil, nil
+	}
+
+	return &RiskData{
+		Rule:   RiskRuleMaxDeposit,
+		Detail: fmt.Sprintf("Deposit of %s %s is larger than the maximum of %s %s", amount, di.CoinType, max, di.CoinType),
+	}, nil
+}
+
+func (r *riskRules) checkInvoiceDeviation(di DepositInfo) (*RiskData, error) {
+	if r.cfg.InvoiceTolerance == "" {
+		return nil, nil
+	}
+
+	tolerance, err := decimal.NewFromString(r.cfg.InvoiceTolerance)
+	if err != nil {
+		return nil, err
+	}
+
+	boundAddr, err := r.store.GetBindAddress(di.DepositAddress, di.CoinType)
+	if err != nil {
+		return nil, err
+	}
+
+	// No amount was expected
+	if boundAddr == nil || boundAddr.ExpectedValue == 0 {
+		return nil, nil
+	}
+
+	expected := decimal.New(boundAddr.ExpectedValue, 0)
+	deviation := decimal.New(di.DepositValue, 0).Sub(expected).Abs().Div(expected).Mul(decimal.New(100, 0))
+	if deviation.LessThanOrEqual(tolerance) {
+		return nil, nil
+	}
+
+	amount, err := depositValueToDecimal(di.CoinType, di.DepositValue)
+	if err != nil {
+		return nil, err
+	}
+
+	expectedAmount, err := depositValueToDecimal(di.CoinType, boundAddr.ExpectedValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RiskData{
+		Rule:   RiskRuleInvoiceDeviation,
+		Detail: fmt.Sprintf("Deposit of %s %s differs from the expected %s %s by more than %s%%", amount, di.CoinType, expectedAmount, di.CoinType, r.cfg.InvoiceTolerance),
+	}, nil
+}
+
+func (r *riskRules) checkSkyAddressDailyMax(di DepositInfo, others []DepositInfo, now time.Time) (*RiskData, error) {
+	if r.cfg.SkyAddressDailyMax == "" {
+		return nil, nil
+	}
+
+	max, err := droplet.FromString(r.cfg.SkyAddressDailyMax)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := calculateSkyOwed(di, r.maxDecimals)
+	if err != nil {
+		return nil, err
+	}
+
+	since := now.Add(-riskDailyWindow).Unix()
+	for _, d := range others {
+		if d.Status == StatusRefundPending {
+			continue
+		}
+
+		createdAt, err := r.depositCreatedAt(d)
+		if err != nil {
+			return nil, err
+		}
+
+		if createdAt < since {
+			continue
+		}
+
+		owed, err := calculateSkyOwed(d, r.maxDecimals)
+		if err != nil {
+			return nil, err
+		}
+
+		total += owed
+	}
+
+	if total <= max {
+		return nil, nil
+	}
+
+	totalStr, err := droplet.ToString(total)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RiskData{
+		Rule:   RiskRuleSkyAddressDailyMax,
+		Detail: fmt.Sprintf("SKY owed to %s in the last 24 hours would be %s, more than the maximum of %s", di.SkyAddress, totalStr, r.cfg.SkyAddressDailyMax),
+	}, nil
+}
+
+func (r *riskRules) checkFirstDeposit(di DepositInfo, others []DepositInfo) *RiskData {
+	if !r.cfg.HoldFirstDeposit {
+		return nil
+	}
+
+	for _, d := range others {
+		if d.Status == StatusDone {
+			return nil
+		}
+	}
+
+	return &RiskData{
+		Rule:   RiskRuleFirstDeposit,
+		Detail: fmt.Sprintf("%s has not completed a deposit before", di.SkyAddress),
+	}
+}
+
+// depositCreatedAt returns when a deposit was received, from its first status transition
+func (r *riskRules) depositCreatedAt(di DepositInfo) (int64, error) {
+	history, err := r.store.GetDepositHistory(di.DepositID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Deposits received before the history was recorded have none
+	if len(history) == 0 {
+		return di.UpdatedAt, nil
+	}
+
+	return history[0].Timestamp, nil
+}
+
+// calculateSkyOwed returns the SKY sent for a deposit, or the SKY owed for it at its
+// conversion rate if none has been sent yet, in droplets
+func calculateSkyOwed(di DepositInfo, maxDecimals int) (uint64, error) {
+	if di.SkySent != 0 {
+		return di.SkySent, nil
+	}
+
+	if di.CoinType != config.CoinTypeSKY {
+		return calculateDirectSkyDroplets(di, maxDecimals)
+	}
+
+	rate, err := mathutil.ParseRate(di.ConversionRate)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(decimal.New(di.DepositValue, 0).Mul(rate).IntPart()), nil
+}
+
+// depositValueExponent returns the number of decimal places of a coin's DepositInfo.DepositValue units
+func depositValueExponent(coinType string) (int32, error) {
+	switch coinType {
+	case config.CoinTypeBTC:
+		return int32(SatoshiExponent), nil
+	case config.CoinTypeETH:
+		// ETH deposit values are stored in Gwei
+		return 9, nil
+	case config.CoinTypeSKY:
+		return int32(droplet.Exponent), nil
+	default:
+		return 0, config.ErrUnsupportedCoinType
+	}
+}
+
+// depositValueToDecimal converts a DepositInfo.DepositValue to a decimal amount of its coin
+func depositValueToDecimal(coinType string, v int64) (decimal.Decimal, error) {
+	exp, err := depositValueExponent(coinType)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return decimal.New(v, -exp), nil
+}
+
+// ParseDepositValue converts a positive decimal amount of a coin, e.g. "0.01" BTC,
+// to the units of DepositInfo.DepositValue
+func ParseDepositValue(coinType, amount string) (int64, error) {
+	exp, err := depositValueExponent(coinType)
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := decimal.NewFromString(amount)
+	if err != nil {
+		return 0, err
+	}
+
+	v := d.Mul(decimal.New(1, exp))
+
+	switch {
+	case v.Sign() <= 0:
+		return 0, errors.New("Amount must be positive")
+	case !v.Equal(v.Truncate(0)):
+		return 0, fmt.Errorf("Amount has more than %d decimal places", exp)
+	case v.GreaterThan(decimal.New(math.MaxInt64, 0)):
+		return 0, errors.New("Amount is too large")
+	}
+
+	return v.IntPart(), nil
+}
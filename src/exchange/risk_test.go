@@ -0,0 +1,365 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type fakeAddressScreener struct {
+	denied  map[string]bool
+	sources []string
+}
+
+func (s *fakeAddressScreener) Check(coinType, address, source string) error {
+	if !s.denied[coinType+":"+address] {
+		return nil
+	}
+	s.sources = append(s.sources, source)
+	return errors.New("Address is not allowed")
+}
+
+func setupRiskRules(t *testing.T, cfg config.Risk) (*riskRules, *Store, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	exchangeCfg := defaultCfg
+	exchangeCfg.Risk = cfg
+
+	return newRiskRules(log, exchangeCfg, store), store, shutdown
+}
+
+// mustAddRiskDepositInfo adds a StatusWaitDecide deposit of depositValue satoshis to testSkyAddr
+func mustAddRiskDepositInfo(t *testing.T, s *Store, n int, depositValue int64) DepositInfo {
+	depositAddr := fmt.Sprintf("risk-deposit-addr-%d", n)
+	_, err := s.BindAddress(testSkyAddr, depositAddr, config.CoinTypeBTC, config.BuyMethodDirect, 0)
+	require.NoError(t, err)
+
+	di := newOperatorDepositInfo(StatusWaitDecide)
+	di.DepositAddress = depositAddr
+	di.DepositID = fmt.Sprintf("risk-deposit-id:%d", n)
+	di.DepositValue = depositValue
+
+	di, err = s.addDepositInfo(di)
+	require.NoError(t, err)
+	return di
+}
+
+func TestRiskRulesMaxDeposit(t *testing.T) {
+	r, s, shutdown := setupRiskRules(t, config.Risk{
+		BtcMaxDeposit: "0.5",
+		EthMaxDeposit: "2",
+	})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	di := mustAddRiskDepositInfo(t, s, 1, 5e7)
+	hold, err := r.check(di, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+
+	di = mustAddRiskDepositInfo(t, s, 2, 50000001)
+	hold, err = r.check(di, now)
+	require.NoError(t, err)
+	require.NotNil(t, hold)
+	require.Equal(t, RiskRuleMaxDeposit, hold.Rule)
+	require.Equal(t, "Deposit of 0.50000001 BTC is larger than the maximum of 0.5 BTC", hold.Detail)
+
+	// ETH deposit values are measured in Gwei
+	eth := newOperatorDepositInfo(StatusWaitDecide)
+	eth.CoinType = config.CoinTypeETH
+	eth.DepositValue = 3e9
+	hold, err = r.check(eth, now)
+	require.NoError(t, err)
+	require.NotNil(t, hold)
+	require.Equal(t, RiskRuleMaxDeposit, hold.Rule)
+
+	eth.DepositValue = 2e9
+	hold, err = r.check(eth, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+
+	// SKY has no maximum configured
+	sky := newOperatorDepositInfo(StatusWaitDecide)
+	sky.CoinType = config.CoinTypeSKY
+	sky.DepositValue = 1e12
+	hold, err = r.check(sky, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+}
+
+func TestRiskRulesSkyAddressDailyMax(t *testing.T) {
+	r, s, shutdown := setupRiskRules(t, config.Risk{
+		SkyAddressDailyMax: "250",
+	})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	// 1 BTC is 100 SKY at testSkyBtcRate
+	first := mustAddRiskDepositInfo(t, s, 1, 1e8)
+	hold, err := r.check(first, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+
+	second := mustAddRiskDepositInfo(t, s, 2, 1e8)
+	hold, err = r.check(second, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+
+	third := mustAddRiskDepositInfo(t, s, 3, 1e8)
+	hold, err = r.check(third, now)
+	require.NoError(t, err)
+	require.NotNil(t, hold)
+	require.Equal(t, RiskRuleSkyAddressDailyMax, hold.Rule)
+	require.Equal(t, fmt.Sprintf("SKY owed to %s in the last 24 hours would be 300.000000, more than the maximum of 250", testSkyAddr), hold.Detail)
+
+	// Deposits older than 24 hours are not counted
+	hold, err = r.check(third, now.Add(riskDailyWindow+time.Hour))
+	require.NoError(t, err)
+	require.Nil(t, hold)
+
+	// Rejected deposits are not counted
+	_, err = s.UpdateDepositInfo(second.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusRefundPending
+		return di
+	})
+	require.NoError(t, err)
+
+	hold, err = r.check(third, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+}
+
+func TestRiskRulesFirstDeposit(t *testing.T) {
+	r, s, shutdown := setupRiskRules(t, config.Risk{
+		HoldFirstDeposit: true,
+	})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	first := mustAddRiskDepositInfo(t, s, 1, 1e8)
+	hold, err := r.check(first, now)
+	require.NoError(t, err)
+	require.NotNil(t, hold)
+	require.Equal(t, RiskRuleFirstDeposit, hold.Rule)
+
+	// A deposit is first until another deposit to the skycoin address is done
+	second := mustAddRiskDepositInfo(t, s, 2, 1e8)
+	hold, err = r.check(second, now)
+	require.NoError(t, err)
+	require.NotNil(t, hold)
+
+	_, err = s.UpdateDepositInfo(first.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		di.Txid = testOperatorTxid
+		di.SkySent = 100e6
+		return di
+	})
+	require.NoError(t, err)
+
+	hold, err = r.check(second, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+}
+
+func TestRiskRulesInvoiceDeviation(t *testing.T) {
+	r, s, shutdown := setupRiskRules(t, config.Risk{
+		InvoiceTolerance: "5",
+	})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	// An address bound without an amount is not checked
+	di := mustAddRiskDepositInfo(t, s, 1, 1e8)
+	hold, err := r.check(di, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+
+	for i, tc := range []struct {
+		depositValue int64
+		hold         bool
+	}{
+		{depositValue: 1e8},
+		{depositValue: 105e6},
+		{depositValue: 95e6},
+		{depositValue: 105e6 + 1, hold: true},
+		{depositValue: 5e7, hold: true},
+	} {
+		depositAddr := fmt.Sprintf("invoice-deposit-addr-%d", i)
+		_, err := s.BindAddress(testSkyAddr, depositAddr, config.CoinTypeBTC, config.BuyMethodDirect, 1e8)
+		require.NoError(t, err)
+
+		di := newOperatorDepositInfo(StatusWaitDecide)
+		di.DepositAddress = depositAddr
+		di.DepositID = fmt.Sprintf("invoice-deposit-id:%d", i)
+		di.DepositValue = tc.depositValue
+
+		hold, err := r.check(di, now)
+		require.NoError(t, err)
+
+		if !tc.hold {
+			require.Nil(t, hold)
+			continue
+		}
+
+		require.NotNil(t, hold)
+		require.Equal(t, RiskRuleInvoiceDeviation, hold.Rule)
+	}
+
+	_, err = s.BindAddress(testSkyAddr, "invoice-deposit-addr-detail", config.CoinTypeBTC, config.BuyMethodDirect, 1e8)
+	require.NoError(t, err)
+
+	di = newOperatorDepositInfo(StatusWaitDecide)
+	di.DepositAddress = "invoice-deposit-addr-detail"
+	di.DepositValue = 5e7
+
+	hold, err = r.check(di, now)
+	require.NoError(t, err)
+	require.NotNil(t, hold)
+	require.Equal(t, "Deposit of 0.5 BTC differs from the expected 1 BTC by more than 5%", hold.Detail)
+}
+
+func TestParseDepositValue(t *testing.T) {
+	cases := []struct {
+		coinType string
+		amount   string
+		value    int64
+		err      bool
+	}{
+		{coinType: config.CoinTypeBTC, amount: "0.01", value: 1e6},
+		{coinType: config.CoinTypeBTC, amount: "0.00000001", value: 1},
+		{coinType: config.CoinTypeBTC, amount: "0.000000001", err: true},
+		{coinType: config.CoinTypeBTC, amount: "0", err: true},
+		{coinType: config.CoinTypeBTC, amount: "-1", err: true},
+		{coinType: config.CoinTypeBTC, amount: "foo", err: true},
+		{coinType: config.CoinTypeBTC, amount: "100000000000", err: true},
+		// ETH deposit values are measured in Gwei
+		{coinType: config.CoinTypeETH, amount: "1.5", value: 15e8},
+		{coinType: config.CoinTypeSKY, amount: "2", value: 2e6},
+		{coinType: "FOO", amount: "1", err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.coinType+" "+tc.amount, func(t *testing.T) {
+			v, err := ParseDepositValue(tc.coinType, tc.amount)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.value, v)
+		})
+	}
+}
+
+func TestRiskRulesDenyList(t *testing.T) {
+	r, s, shutdown := setupRiskRules(t, config.Risk{})
+	defer shutdown()
+
+	now := time.Now().UTC()
+
+	di := mustAddRiskDepositInfo(t, s, 1, 1e8)
+
+	// No screener is set
+	hold, err := r.check(di, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+
+	screener := &fakeAddressScreener{
+		denied: map[string]bool{},
+	}
+	r.screener = screener
+
+	hold, err = r.check(di, now)
+	require.NoError(t, err)
+	require.Nil(t, hold)
+
+	screener.denied[config.CoinTypeSKY+":"+testSkyAddr] = true
+
+	hold, err = r.check(di, now)
+	require.NoError(t, err)
+	require.NotNil(t, hold)
+	require.Equal(t, RiskRuleDenyList, hold.Rule)
+	require.Equal(t, fmt.Sprintf("Skycoin address %s: Address is not allowed", testSkyAddr), hold.Detail)
+	require.Equal(t, []string{"deposit " + di.DepositID}, screener.sources)
+
+	// Source addresses are checked against the deny list of the deposit's coin
+	delete(screener.denied, config.CoinTypeSKY+":"+testSkyAddr)
+	screener.denied[config.CoinTypeBTC+":1PZ63K3G4gZP6A6E2TTbBwxT5bFQGLRRUz"] = true
+
+	di.SourceAddresses = []string{"13sHcgdvfMWJZ7Z3yXgJVpS3tk1S6m8sP7", "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGLRRUz"}
+	hold, err = r.check(di, now)
+	require.NoError(t, err)
+	require.NotNil(t, hold)
+	require.Equal(t, RiskRuleDenyList, hold.Rule)
+	require.Equal(t, "Source address 1PZ63K3G4gZP6A6E2TTbBwxT5bFQGLRRUz: Address is not allowed", hold.Detail)
+}
+
+func TestRiskRulesScreen(t *testing.T) {
+	r, s, shutdown := setupRiskRules(t, config.Risk{
+		BtcMaxDeposit: "0.5",
+	})
+	defer shutdown()
+
+	small := mustAddRiskDepositInfo(t, s, 1, 1e7)
+	screened, ok, err := r.screen(small)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, small, screened)
+
+	large := mustAddRiskDepositInfo(t, s, 2, 1e8)
+	screened, ok, err = r.screen(large)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, StatusWaitApproval, screened.Status)
+	require.Equal(t, RiskRuleMaxDeposit, screened.Risk.Rule)
+
+	stored, err := s.GetDepositInfo(large.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, screened, stored)
+
+	history, err := s.GetDepositHistory(large.DepositID)
+	require.NoError(t, err)
+	last := history[len(history)-1]
+	require.Equal(t, "risk", last.Component)
+	require.Equal(t, StatusWaitDecide, last.FromStatus)
+	require.Equal(t, StatusWaitApproval, last.ToStatus)
+
+	// Approved deposits are not checked again
+	approved := mustAddRiskDepositInfo(t, s, 3, 1e8)
+	approved.Risk.Approved = true
+	screened, ok, err = r.screen(approved)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, approved, screened)
+
+	// A stale copy of a deposit that was changed is not held
+	changed := mustAddRiskDepositInfo(t, s, 4, 1e8)
+	_, err = s.UpdateDepositInfo(changed.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+
+	_, ok, err = r.screen(changed)
+	require.Equal(t, ErrDepositChanged, err)
+	require.False(t, ok)
+
+	stored, err = s.GetDepositInfo(changed.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, stored.Status)
+}
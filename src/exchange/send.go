@@ -3,9 +3,11 @@ package exchange
 import (
 	"errors"
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 
 	"github.com/skycoin/skycoin/src/api/cli"
@@ -14,7 +16,6 @@ import (
 
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/sender"
-	"github.com/skycoin/teller/src/util/logger"
 	"github.com/skycoin/teller/src/util/mathutil"
 )
 
@@ -42,6 +43,12 @@ type Send struct {
 	depositChan chan DepositInfo
 	statusLock  sync.RWMutex
 	status      error
+	failer      DepositFailer // Handles deposits that failed processing
+	sendLock    sync.Mutex    // Held while a transaction is created and broadcast
+	haltLock    sync.RWMutex
+	halted      error       // Why sending is halted, nil if it is not
+	pauses      *pauses     // Sending is halted while an operator paused it
+	live        *liveConfig // Sending is halted while a reloaded config disabled it
 }
 
 // NewSend creates exchange service
@@ -54,15 +61,20 @@ func NewSend(log logrus.FieldLogger, cfg config.SkyExchanger, store Storer, send
 		cfg.TxConfirmationCheckWait = txConfirmationCheckWait
 	}
 
+	if cfg.TxRebroadcastTimeout == 0 {
+		cfg.TxRebroadcastTimeout = txRebroadcastTimeout
+	}
+
 	return &Send{
 		cfg:         cfg,
 		log:         log.WithField("prefix", "teller.exchange.send"),
 		processor:   processor,
 		sender:      sender,
-		store:       store,
+		store:       withComponent(store, "send"),
 		quit:        make(chan struct{}),
 		done:        make(chan struct{}, 1),
 		depositChan: make(chan DepositInfo, 100),
+		live:        newLiveConfig(cfg),
 	}, nil
 }
 
@@ -79,23 +91,23 @@ func (s *Send) Run() error {
 
 	if s.cfg.SendEnabled {
 		// Load StatusWaitSend deposits for processing later
-		waitSendDeposits, err := s.store.GetDepositInfoArray(func(di DepositInfo) bool {
-			return di.Status == StatusWaitSend
+		waitSendDeposits, err := s.store.QueryDepositInfo(DepositQuery{
+			Statuses: []string{StatusWaitSend},
 		})
 
 		if err != nil {
-			err = fmt.Errorf("GetDepositInfoArray failed: %v", err)
+			err = fmt.Errorf("QueryDepositInfo failed: %v", err)
 			log.WithError(err).Error(err)
 			return err
 		}
 
 		// Load StatusWaitConfirm deposits for processing later
-		waitConfirmDeposits, err := s.store.GetDepositInfoArray(func(di DepositInfo) bool {
-			return di.Status == StatusWaitConfirm
+		waitConfirmDeposits, err := s.store.QueryDepositInfo(DepositQuery{
+			Statuses: []string{StatusWaitConfirm},
 		})
 
 		if err != nil {
-			err = fmt.Errorf("GetDepositInfoArray failed: %v", err)
+			err = fmt.Errorf("QueryDepositInfo failed: %v", err)
 			log.WithError(err).Error(err)
 			return err
 		}
@@ -158,8 +170,13 @@ func (s *Send) runSend() {
 		case d := <-s.depositChan:
 			log := log.WithField("depositInfo", d)
 			if err := s.processWaitSendDeposit(d); err != nil {
-				msg := "processWaitSendDeposit failed. This deposit will not be reprocessed until teller is restarted."
-				log.WithField("notice", logger.WatchNotice).WithError(err).Error(msg)
+				if err == ErrDepositChanged {
+					log.WithError(err).Warn("Dropping stale copy of deposit")
+					continue
+				}
+
+				log.WithError(err).Error("processWaitSendDeposit failed")
+				failDeposit(log, s.failer, "send", d, err)
 			}
 		}
 	}
@@ -206,6 +223,79 @@ func (s *Send) Shutdown() {
 	s.log.Info("Shutdown complete")
 }
 
+// Resubmit queues a StatusWaitSend or StatusWaitConfirm deposit changed by an operator for processing
+func (s *Send) Resubmit(di DepositInfo) error {
+	select {
+	case <-s.quit:
+		return errQuit
+	case s.depositChan <- di:
+		return nil
+	}
+}
+
+// Halt halts sending for reason until Resume is called.
+// It waits for a transaction being created or broadcast to finish,
+// so that no transaction is broadcast once it returns.
+func (s *Send) Halt(reason error) {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+
+	s.haltLock.Lock()
+	defer s.haltLock.Unlock()
+	s.halted = reason
+}
+
+// Resume resumes sending halted by Halt
+func (s *Send) Resume() {
+	s.haltLock.Lock()
+	defer s.haltLock.Unlock()
+	s.halted = nil
+}
+
+// Halted returns why sending is halted, or nil if it is not.
+// A halt by Halt takes precedence over ErrSendPaused.
+func (s *Send) Halted() error {
+	s.haltLock.RLock()
+	halted := s.halted
+	s.haltLock.RUnlock()
+
+	if halted != nil {
+		return halted
+	}
+
+	if s.pauses.Paused(PauseSend, "") {
+		return ErrSendPaused
+	}
+
+	if !s.live.get().SendEnabled {
+		return ErrSendDisabled
+	}
+
+	return nil
+}
+
+// waitSend waits for a transaction being created or broadcast to finish
+func (s *Send) waitSend() {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+}
+
+// reloadDeposit returns the stored copy of a queued deposit, which may have changed while it was queued
+// or while sending was halted. ErrDepositChanged is returned if the deposit no longer needs sending.
+func (s *Send) reloadDeposit(di DepositInfo) (DepositInfo, error) {
+	stored, err := s.store.GetDepositInfo(di.DepositID)
+	if err != nil {
+		return di, err
+	}
+
+	switch stored.Status {
+	case StatusWaitSend, StatusWaitConfirm:
+		return stored, nil
+	default:
+		return di, ErrDepositChanged
+	}
+}
+
 // processDeposit advances a single deposit through three states:
 // StatusWaitSend -> StatusWaitConfirm
 // StatusWaitConfirm -> StatusDone
@@ -214,6 +304,7 @@ func (s *Send) processWaitSendDeposit(di DepositInfo) error {
 	log := s.log.WithField("depositInfo", di)
 	log.Info("Processing StatusWaitSend deposit")
 
+	reload := true
 	for {
 		select {
 		case <-s.quit:
@@ -221,13 +312,42 @@ func (s *Send) processWaitSendDeposit(di DepositInfo) error {
 		default:
 		}
 
-		log.Info("handleDepositInfoState")
+		if err := s.Halted(); err != nil {
+			if !reload {
+				log.WithError(err).Warn("Sending is halted")
+			}
+
+			reload = true
+			select {
+			case <-time.After(s.cfg.TxConfirmationCheckWait):
+			case <-s.quit:
+				return nil
+			}
+			continue
+		}
 
 		var err error
+		if reload {
+			di, err = s.reloadDeposit(di)
+			if err != nil {
+				return err
+			}
+			log = log.WithField("depositInfo", di)
+			reload = false
+		}
+
+		log.Info("handleDepositInfoState")
+
 		di, err = s.handleDepositInfoState(di)
 		log = log.WithField("depositInfo", di)
 
-		s.setStatus(err)
+		// A deposit that was not sent because sending was halted is sent once it resumes.
+		// A stale copy of a deposit says nothing about the sender's health
+		if err == ErrSendHalted {
+			continue
+		} else if err != ErrDepositChanged {
+			s.setStatus(err)
+		}
 
 		switch err.(type) {
 		case sender.RPCError:
@@ -274,8 +394,16 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 
 	switch di.Status {
 	case StatusWaitSend:
+		// Sending can't be halted while a transaction is being created and broadcast
+		s.sendLock.Lock()
+		defer s.sendLock.Unlock()
+
+		if s.Halted() != nil {
+			return di, ErrSendHalted
+		}
+
 		// Prepare skycoin transaction
-		skyTx, err := s.createTransaction(di)
+		skyTx, payout, err := s.createTransaction(di)
 
 		if err != nil {
 			log.WithError(err).Error("createTransaction failed")
@@ -286,6 +414,7 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 				di, err = s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
 					di.Status = StatusDone
 					di.Error = ErrEmptySendAmount.Error()
+					di.Payout = payout
 					return di
 				})
 				if err != nil {
@@ -305,14 +434,7 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 		// The skyTx contains one output sent to the destination address,
 		// so this check is safe.
 		// It is verified earlier by verifyCreatedTransaction
-		var skySent uint64
-		for _, o := range skyTx.Out {
-			if o.Address.String() == di.SkyAddress {
-				skySent = o.Coins
-				break
-			}
-		}
-
+		skySent := coinsSentTo(skyTx, di.SkyAddress)
 		if skySent == 0 {
 			err := errors.New("No output to destination address found in transaction")
 			log.WithError(err).Error(err)
@@ -322,12 +444,28 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 		// Within a bolt.DB transaction, update the db then send the coins
 		// If the send fails, the data is rolled back
 		// If the db save fails, no coins had been sent
+		// If an operator changed the deposit after it was queued, the stored deposit
+		// no longer matches the transaction and nothing is sent
+		var changedErr error
+		queuedDi := di
+		now := time.Now().UTC().Unix()
 		di, err = s.store.UpdateDepositInfoCallback(di.DepositID, func(di DepositInfo) DepositInfo {
+			if di.Status != StatusWaitSend || di.SkyAddress != queuedDi.SkyAddress {
+				changedErr = ErrDepositChanged
+				return di
+			}
+
 			di.Status = StatusWaitConfirm
 			di.Txid = skyTx.TxIDHex()
 			di.SkySent = skySent
+			di.Payout = payout
+			di.TxAttempts = append(di.TxAttempts, newTxAttempt(skyTx, now))
 			return di
 		}, func(di DepositInfo) error {
+			if changedErr != nil {
+				return changedErr
+			}
+
 			// NOTE: broadcastTransaction retries indefinitely on error
 			// If the skycoin node is not reachable, this will block,
 			// which will also block the database since it's in a transaction
@@ -364,20 +502,29 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 			return di, ErrNoResponse
 		}
 
-		if rsp.Err != nil {
+		if rsp.Err != nil && rsp.Err != sender.ErrTxNotFound {
 			log.WithError(rsp.Err).Error("IsTxConfirmed failed")
 			return di, rsp.Err
 		}
 
 		if !rsp.Confirmed {
-			log.Info("Transaction is not confirmed yet")
-			return di, ErrNotConfirmed
+			// A transaction dropped by the node is rebroadcast like any other stuck transaction
+			if rsp.Err == sender.ErrTxNotFound {
+				log.WithError(rsp.Err).Warn("Transaction is not known to the skycoin node")
+			} else {
+				log.Info("Transaction is not confirmed yet")
+			}
+
+			return s.handleUnconfirmed(di)
 		}
 
 		log.Info("Transaction is confirmed")
 
 		di, err := s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
 			di.Status = StatusDone
+			if i := di.txAttempt(di.Txid); i != -1 {
+				di.TxAttempts[i].Status = TxAttemptConfirmed
+			}
 			return di
 		})
 		if err != nil {
@@ -407,44 +554,321 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 	}
 }
 
-func (s *Send) calculateSkyDroplets(di DepositInfo) (uint64, error) {
-	log := s.log.WithField("depositInfo", di)
-	var err error
-	var skyAmt uint64
+// handleUnconfirmed checks a deposit's transaction that has been unconfirmed for longer than
+// TxRebroadcastTimeout. If none of its inputs were spent by another confirmed transaction, it is rebroadcast.
+// Otherwise it can never be confirmed and is replaced by a new transaction, unless an earlier
+// transaction of the deposit spent them, in which case that transaction paid the deposit.
+// A transaction is never replaced while it could still be confirmed, so the deposit can't be paid twice.
+func (s *Send) handleUnconfirmed(di DepositInfo) (DepositInfo, error) {
+	i := di.txAttempt(di.Txid)
+	if i == -1 {
+		// The transaction was sent before attempts were recorded, or recorded by an operator
+		// or by reconciliation, so there is no raw transaction to rebroadcast
+		return di, ErrNotConfirmed
+	}
+
+	attempt := di.TxAttempts[i]
+	if time.Since(time.Unix(attempt.LastBroadcastAt, 0)) < s.cfg.TxRebroadcastTimeout {
+		return di, ErrNotConfirmed
+	}
+
+	log := s.log.WithFields(logrus.Fields{
+		"depositInfo":  di,
+		"txid":         attempt.Txid,
+		"broadcastAt":  attempt.BroadcastAt,
+		"rebroadcasts": attempt.Rebroadcasts,
+	})
+
+	// Nothing is broadcast while sending is halted
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+
+	if s.Halted() != nil {
+		return di, ErrSendHalted
+	}
+
+	tx, err := attempt.Transaction()
+	if err != nil {
+		log.WithError(err).Error("TxAttempt.Transaction failed")
+		return di, err
+	}
+
+	uxids := make([]string, len(tx.In))
+	for j, in := range tx.In {
+		uxids[j] = in.Hex()
+	}
+
+	spends, err := s.sender.InputSpends(uxids)
+	if err != nil {
+		log.WithError(err).Error("sender.InputSpends failed")
+		return di, err
+	}
+
+	var conflict string
+	for _, uxid := range uxids {
+		if txid := spends[uxid]; txid != "" && txid != attempt.Txid {
+			conflict = txid
+			break
+		}
+	}
+
+	if conflict == "" {
+		return s.rebroadcastTransaction(log, di, tx)
+	}
+
+	log = log.WithField("conflictTxid", conflict)
+
+	if di.txAttempt(conflict) != -1 {
+		log.Warn("Transaction's inputs were spent by an earlier transaction of the deposit, which paid it")
+		return s.replaceTxAttempt(log, di, conflict, nil)
+	}
 
+	log.Warn("Transaction's inputs were spent by another transaction, replacing it")
+
+	newTx, _, err := s.createTransaction(di)
+	if err != nil {
+		log.WithError(err).Error("createTransaction failed")
+		return di, err
+	}
+
+	if skySent := coinsSentTo(newTx, di.SkyAddress); skySent != di.SkySent {
+		err := fmt.Errorf("Replacement transaction sends %d droplets instead of %d", skySent, di.SkySent)
+		log.WithError(err).Error(err)
+		return di, err
+	}
+
+	return s.replaceTxAttempt(log, di, conflict, newTx)
+}
+
+// rebroadcastTransaction broadcasts a deposit's transaction again, and records when
+func (s *Send) rebroadcastTransaction(log logrus.FieldLogger, di DepositInfo, tx *coin.Transaction) (DepositInfo, error) {
+	log.Warn("Transaction is unconfirmed for too long, rebroadcasting it")
+
+	// If the inputs are being spent by a transaction that is not confirmed yet, the broadcast fails.
+	// The transaction is checked again after the timeout, and replaced once that transaction is confirmed.
+	if err := s.sender.RebroadcastTransaction(tx); err != nil {
+		log.WithError(err).Warn("sender.RebroadcastTransaction failed")
+	}
+
+	txid := di.Txid
+	now := time.Now().UTC().Unix()
+	var changedErr error
+	di, err := s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		i := di.txAttempt(txid)
+		if di.Status != StatusWaitConfirm || di.Txid != txid || i == -1 {
+			changedErr = ErrDepositChanged
+			return di
+		}
+
+		di.TxAttempts[i].LastBroadcastAt = now
+		di.TxAttempts[i].Rebroadcasts++
+		return di
+	})
+	if err != nil {
+		log.WithError(err).Error("UpdateDepositInfo failed")
+		return di, err
+	}
+
+	if changedErr != nil {
+		return di, changedErr
+	}
+
+	return di, ErrNotConfirmed
+}
+
+// replaceTxAttempt marks a deposit's transaction replaced because conflictTxid spent its inputs.
+// If newTx is nil, conflictTxid is an earlier transaction of the deposit, which becomes its transaction again.
+// Otherwise newTx is recorded and broadcast.
+func (s *Send) replaceTxAttempt(log logrus.FieldLogger, di DepositInfo, conflictTxid string, newTx *coin.Transaction) (DepositInfo, error) {
+	txid := di.Txid
+	now := time.Now().UTC().Unix()
+	var changedErr error
+	di, err := s.store.UpdateDepositInfoCallback(di.DepositID, func(di DepositInfo) DepositInfo {
+		i := di.txAttempt(txid)
+		if di.Status != StatusWaitConfirm || di.Txid != txid || i == -1 {
+			changedErr = ErrDepositChanged
+			return di
+		}
+
+		di.TxAttempts[i].Status = TxAttemptReplaced
+		di.TxAttempts[i].ConflictTxid = conflictTxid
+
+		if newTx == nil {
+			di.Txid = conflictTxid
+			return di
+		}
+
+		di.Txid = newTx.TxIDHex()
+		di.TxAttempts = append(di.TxAttempts, newTxAttempt(newTx, now))
+		return di
+	}, func(di DepositInfo) error {
+		if changedErr != nil || newTx == nil {
+			return changedErr
+		}
+
+		// NOTE: broadcastTransaction retries indefinitely on error, like the first broadcast
+		rsp, err := s.broadcastTransaction(newTx)
+		if err != nil {
+			log.WithError(err).Error("broadcastTransaction failed")
+			return err
+		}
+
+		if rsp.Txid != newTx.TxIDHex() {
+			log.Error("CRITICAL ERROR: BroadcastTxResponse.Txid != newTx.TxIDHex()")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		log.WithError(err).Error("store.UpdateDepositInfoCallback failed")
+		return di, err
+	}
+
+	log.WithField("newTxid", di.Txid).Info("Deposit's transaction replaced")
+
+	return di, nil
+}
+
+// coinsSentTo returns the coins sent to addr by a transaction
+func coinsSentTo(tx *coin.Transaction, addr string) uint64 {
+	for _, o := range tx.Out {
+		if o.Address.String() == addr {
+			return o.Coins
+		}
+	}
+	return 0
+}
+
+func (s *Send) calculateSkyPayout(di DepositInfo) (PayoutData, error) {
+	payout, err := calculateSkyPayout(di, s.cfg.MaxDecimals, s.cfg.Fees)
+	if err != nil {
+		s.log.WithField("depositInfo", di).WithError(err).Error("calculateSkyPayout failed")
+		return PayoutData{}, err
+	}
+
+	return payout, nil
+}
+
+// calculateSkyDroplets returns the amount of SKY owed for a deposit after the service fee, in droplets
+func calculateSkyDroplets(di DepositInfo, maxDecimals int, fees config.Fees) (uint64, error) {
+	payout, err := calculateSkyPayout(di, maxDecimals, fees)
+	if err != nil {
+		return 0, err
+	}
+
+	return payout.Net, nil
+}
+
+// calculateSkyPayout returns the amount of SKY owed for a deposit before and after the service fee, in droplets.
+// A payout recorded on the deposit is returned as is, so that changing the fees doesn't change
+// the amount of a deposit that was already sent.
+func calculateSkyPayout(di DepositInfo, maxDecimals int, fees config.Fees) (PayoutData, error) {
+	if di.Payout != (PayoutData{}) {
+		return di.Payout, nil
+	}
+
+	var gross uint64
 	switch di.BuyMethod {
 	case config.BuyMethodPassthrough:
-		skyAmt = di.Passthrough.SkyBought
-
+		gross = calculatePassthroughSkySent(di.Passthrough)
 	case config.BuyMethodDirect:
-		switch di.CoinType {
-		case config.CoinTypeBTC:
-			skyAmt, err = CalculateBtcSkyValue(di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
-			if err != nil {
-				log.WithError(err).Error("CalculateBtcSkyValue failed")
-				return 0, err
-			}
-		case config.CoinTypeETH:
-			//Gwei convert to wei, because stored-value is Gwei in case overflow of uint64
-			skyAmt, err = CalculateEthSkyValue(mathutil.Gwei2Wei(di.DepositValue), di.ConversionRate, s.cfg.MaxDecimals)
-			if err != nil {
-				log.WithError(err).Error("CalculateEthSkyValue failed")
-				return 0, err
-			}
-		default:
-			log.WithError(config.ErrUnsupportedCoinType).Error()
-			return 0, config.ErrUnsupportedCoinType
+		var err error
+		gross, err = calculateDirectSkyDroplets(di, maxDecimals)
+		if err != nil {
+			return PayoutData{}, err
 		}
-
 	default:
-		log.WithError(config.ErrInvalidBuyMethod).Error()
-		return 0, config.ErrInvalidBuyMethod
+		return PayoutData{}, config.ErrInvalidBuyMethod
+	}
+
+	fee, err := fees.CoinFee(di.CoinType)
+	if err != nil {
+		return PayoutData{}, err
+	}
+
+	feeAmt, err := calculateServiceFee(gross, fee, maxDecimals)
+	if err != nil {
+		return PayoutData{}, err
 	}
 
-	return skyAmt, nil
+	return PayoutData{
+		Gross: gross,
+		Fee:   feeAmt,
+		Net:   gross - feeAmt,
+	}, nil
 }
 
-func (s *Send) createTransaction(di DepositInfo) (*coin.Transaction, error) {
+// calculateServiceFee returns the service fee for an amount of SKY, in droplets.
+// The fee is rounded up so that the SKY left is truncated to maxDecimals, and is never more than the amount.
+func calculateServiceFee(amt uint64, fee config.Fee, maxDecimals int) (uint64, error) {
+	pct, err := fee.Percentage()
+	if err != nil {
+		return 0, err
+	}
+
+	flat, err := fee.FlatDroplets()
+	if err != nil {
+		return 0, err
+	}
+
+	minimum, err := fee.MinimumDroplets()
+	if err != nil {
+		return 0, err
+	}
+
+	pctAmt := decimal.New(int64(amt), 0).Mul(pct).Div(decimal.New(100, 0)).Ceil().IntPart()
+	if pctAmt < 0 {
+		return 0, errors.New("calculated fee is negative")
+	}
+
+	total := uint64(pctAmt) + flat
+	if total < minimum {
+		total = minimum
+	}
+
+	if total == 0 {
+		return 0, nil
+	}
+
+	if total >= amt {
+		return amt, nil
+	}
+
+	// The SKY sent can't be more precise than maxDecimals
+	net := amt - total
+	if maxDecimals < droplet.Exponent {
+		net -= net % uint64(math.Pow10(droplet.Exponent-maxDecimals))
+	}
+
+	return amt - net, nil
+}
+
+// calculateDirectSkyDroplets returns the amount of SKY owed for a deposit
+// at its fixed conversion rate, in droplets
+func calculateDirectSkyDroplets(di DepositInfo, maxDecimals int) (uint64, error) {
+	switch di.CoinType {
+	case config.CoinTypeBTC:
+		skyAmt, err := CalculateBtcSkyValue(di.DepositValue, di.ConversionRate, maxDecimals)
+		if err != nil {
+			return 0, err
+		}
+		return skyAmt, nil
+	case config.CoinTypeETH:
+		//Gwei convert to wei, because stored-value is Gwei in case overflow of uint64
+		skyAmt, err := CalculateEthSkyValue(mathutil.Gwei2Wei(di.DepositValue), di.ConversionRate, maxDecimals)
+		if err != nil {
+			return 0, err
+		}
+		return skyAmt, nil
+	default:
+		return 0, config.ErrUnsupportedCoinType
+	}
+}
+
+// createTransaction creates the transaction sending the SKY owed for a deposit, and returns the payout it sends.
+// The payout is also returned with ErrEmptySendAmount, when the fee takes all the SKY owed.
+func (s *Send) createTransaction(di DepositInfo) (*coin.Transaction, PayoutData, error) {
 	log := s.log.WithField("deposit", di)
 
 	// This should never occur, the DepositInfo is saved with a SkyAddress
@@ -452,49 +876,51 @@ func (s *Send) createTransaction(di DepositInfo) (*coin.Transaction, error) {
 	if di.SkyAddress == "" {
 		err := ErrNoBoundAddress
 		log.WithError(err).Error(err)
-		return nil, err
+		return nil, PayoutData{}, err
 	}
 
 	log = log.WithField("skyAddr", di.SkyAddress)
 	log = log.WithField("skyRate", di.ConversionRate)
 	log = log.WithField("maxDecimals", s.cfg.MaxDecimals)
 
-	skyAmt, err := s.calculateSkyDroplets(di)
+	payout, err := s.calculateSkyPayout(di)
 	if err != nil {
-		log.WithError(err).Error("calculateSkyDroplets failed")
-		return nil, err
+		log.WithError(err).Error("calculateSkyPayout failed")
+		return nil, PayoutData{}, err
 	}
+	skyAmt := payout.Net
 	skyAmtCoins, err := droplet.ToString(skyAmt)
 	if err != nil {
 		log.WithError(err).Error("droplet.ToString failed")
-		return nil, err
+		return nil, PayoutData{}, err
 	}
 
 	log = log.WithField("sendAmtDroplets", skyAmt)
 	log = log.WithField("sendAmtCoins", skyAmtCoins)
+	log = log.WithField("feeDroplets", payout.Fee)
 
 	log.Info("Creating skycoin transaction")
 
 	if skyAmt == 0 {
 		err := ErrEmptySendAmount
 		log.WithError(err).Error(err)
-		return nil, err
+		return nil, payout, err
 	}
 
 	tx, err := s.sender.CreateTransaction(di.SkyAddress, skyAmt)
 	if err != nil {
 		log.WithError(err).Error("sender.CreateTransaction failed")
-		return nil, err
+		return nil, PayoutData{}, err
 	}
 
 	log = log.WithField("transactionOutput", tx.Out)
 
 	if err := verifyCreatedTransaction(tx, di, skyAmt); err != nil {
 		log.WithError(err).Error("verifyCreatedTransaction failed")
-		return nil, err
+		return nil, PayoutData{}, err
 	}
 
-	return tx, nil
+	return tx, payout, nil
 }
 
 func verifyCreatedTransaction(tx *coin.Transaction, di DepositInfo, skyAmt uint64) error {
@@ -0,0 +1,297 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/sender"
+)
+
+func setupSendExchange(t *testing.T) (*Exchange, *Send, *dummySender, func()) {
+	e, shutdown := setupOperatorExchange(t, config.BuyMethodDirect)
+	send := e.Sender.(*Send)
+	return e, send, send.sender.(*dummySender), shutdown
+}
+
+func testUxid(name string) cipher.SHA256 {
+	return cipher.SumSHA256([]byte(name))
+}
+
+// backdateTxAttempt makes a deposit's transaction look unconfirmed for longer than the rebroadcast timeout
+func backdateTxAttempt(t *testing.T, e *Exchange, send *Send, depositID string) DepositInfo {
+	di, err := e.store.UpdateDepositInfo(depositID, func(di DepositInfo) DepositInfo {
+		i := di.txAttempt(di.Txid)
+		require.NotEqual(t, -1, i)
+		di.TxAttempts[i].LastBroadcastAt -= int64((send.cfg.TxRebroadcastTimeout + time.Minute) / time.Second)
+		return di
+	})
+	require.NoError(t, err)
+	return di
+}
+
+func TestSendRebroadcastAndReplace(t *testing.T) {
+	e, send, ds, shutdown := setupSendExchange(t)
+	defer shutdown()
+
+	ds.inputs = []cipher.SHA256{testUxid("ux1"), testUxid("ux2")}
+	di := mustAddOperatorDepositInfo(t, e, newOperatorDepositInfo(StatusWaitSend))
+
+	di, err := send.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, di.Status)
+	firstTxid := di.Txid
+	requireTxAttempts(t, di, TxAttemptPending)
+
+	// Nothing is rebroadcast before the timeout
+	di, err = send.handleDepositInfoState(di)
+	require.Equal(t, ErrNotConfirmed, err)
+	require.Empty(t, ds.rebroadcasts)
+
+	// Nothing is rebroadcast while sending is halted
+	di = backdateTxAttempt(t, e, send, di.DepositID)
+	send.Halt(ErrReconciling)
+	_, err = send.handleDepositInfoState(di)
+	require.Equal(t, ErrSendHalted, err)
+	require.Empty(t, ds.rebroadcasts)
+	send.Resume()
+
+	// A transaction whose inputs are unspent is rebroadcast
+	di, err = send.handleDepositInfoState(di)
+	require.Equal(t, ErrNotConfirmed, err)
+	require.Equal(t, []string{firstTxid}, ds.rebroadcasts)
+	require.Equal(t, 1, di.TxAttempts[0].Rebroadcasts)
+	require.True(t, time.Now().Unix()-di.TxAttempts[0].LastBroadcastAt < 60)
+
+	// A failed rebroadcast is tried again after the timeout
+	ds.rebroadcastErr = errors.New("Transaction inputs are being spent")
+	di = backdateTxAttempt(t, e, send, di.DepositID)
+	di, err = send.handleDepositInfoState(di)
+	require.Equal(t, ErrNotConfirmed, err)
+	require.Len(t, ds.rebroadcasts, 2)
+	require.Equal(t, 2, di.TxAttempts[0].Rebroadcasts)
+
+	// Once an input is spent by another confirmed transaction, the transaction is replaced with fresh inputs
+	ds.inputSpends = map[string]string{
+		testUxid("ux2").Hex(): "sweep-txid",
+	}
+	ds.inputs = []cipher.SHA256{testUxid("ux3")}
+	di = backdateTxAttempt(t, e, send, di.DepositID)
+
+	di, err = send.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, di.Status)
+	require.Len(t, di.TxAttempts, 2)
+	require.NotEqual(t, firstTxid, di.Txid)
+	require.Equal(t, TxAttemptReplaced, di.TxAttempts[0].Status)
+	require.Equal(t, "sweep-txid", di.TxAttempts[0].ConflictTxid)
+	require.Equal(t, di.Txid, di.TxAttempts[1].Txid)
+	require.Equal(t, TxAttemptPending, di.TxAttempts[1].Status)
+	require.Equal(t, uint64(100e6), di.SkySent)
+
+	stored, err := e.store.(*Store).GetDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, di, stored)
+
+	// The replacement is confirmed
+	ds.setTxConfirmed(di.Txid)
+	di, err = send.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, di.Status)
+	require.Equal(t, TxAttemptReplaced, di.TxAttempts[0].Status)
+	require.Equal(t, TxAttemptConfirmed, di.TxAttempts[1].Status)
+}
+
+func TestSendReplacedByEarlierAttempt(t *testing.T) {
+	e, send, ds, shutdown := setupSendExchange(t)
+	defer shutdown()
+
+	ds.inputs = []cipher.SHA256{testUxid("ux1")}
+	di := mustAddOperatorDepositInfo(t, e, newOperatorDepositInfo(StatusWaitSend))
+
+	di, err := send.handleDepositInfoState(di)
+	require.NoError(t, err)
+	firstTxid := di.Txid
+
+	ds.inputSpends = map[string]string{
+		testUxid("ux1").Hex(): "sweep-txid",
+	}
+	ds.inputs = []cipher.SHA256{testUxid("ux2")}
+	di = backdateTxAttempt(t, e, send, di.DepositID)
+
+	di, err = send.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Len(t, di.TxAttempts, 2)
+
+	// The replacement's input was spent by the first transaction, so the first transaction paid the deposit
+	// and no further transaction is created
+	ds.inputSpends = map[string]string{
+		testUxid("ux2").Hex(): firstTxid,
+	}
+	ds.inputs = []cipher.SHA256{testUxid("ux3")}
+	di = backdateTxAttempt(t, e, send, di.DepositID)
+
+	di, err = send.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Len(t, di.TxAttempts, 2)
+	require.Equal(t, firstTxid, di.Txid)
+	require.Equal(t, TxAttemptReplaced, di.TxAttempts[1].Status)
+	require.Equal(t, firstTxid, di.TxAttempts[1].ConflictTxid)
+
+	ds.setTxConfirmed(firstTxid)
+	di, err = send.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, di.Status)
+	require.Equal(t, firstTxid, di.Txid)
+}
+
+func TestSendUnconfirmedWithoutAttempts(t *testing.T) {
+	e, send, ds, shutdown := setupSendExchange(t)
+	defer shutdown()
+
+	// A deposit sent before transaction attempts were recorded has nothing to rebroadcast
+	di := newOperatorDepositInfo(StatusWaitConfirm)
+	di.Txid = testOperatorTxid
+	di.SkySent = 100e6
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	send.cfg.TxRebroadcastTimeout = time.Nanosecond
+	ds.confirmErr = sender.ErrTxNotFound
+
+	_, err := send.handleDepositInfoState(di)
+	require.Equal(t, ErrNotConfirmed, err)
+	require.Empty(t, ds.rebroadcasts)
+}
+
+func TestCalculateServiceFee(t *testing.T) {
+	tt := []struct {
+		name        string
+		amt         uint64
+		fee         config.Fee
+		maxDecimals int
+		out         uint64
+	}{
+		{
+			name:        "no fee",
+			amt:         100e6,
+			maxDecimals: 3,
+			out:         0,
+		},
+		{
+			name: "percentage",
+			amt:  100e6,
+			fee: config.Fee{
+				Percent: "1.5",
+			},
+			maxDecimals: 3,
+			out:         15e5,
+		},
+		{
+			name: "percentage and flat",
+			amt:  100e6,
+			fee: config.Fee{
+				Percent: "2.5",
+				Flat:    "0.1234",
+			},
+			maxDecimals: 3,
+			out:         2624e3,
+		},
+		{
+			name: "rounded up to max decimals",
+			amt:  100e6,
+			fee: config.Fee{
+				Percent: "2.5",
+				Flat:    "0.1234",
+			},
+			maxDecimals: 0,
+			out:         3e6,
+		},
+		{
+			name: "minimum",
+			amt:  100e6,
+			fee: config.Fee{
+				Percent: "1",
+				Minimum: "2",
+			},
+			maxDecimals: 3,
+			out:         2e6,
+		},
+		{
+			name: "minimum below fee",
+			amt:  100e6,
+			fee: config.Fee{
+				Percent: "3",
+				Minimum: "2",
+			},
+			maxDecimals: 3,
+			out:         3e6,
+		},
+		{
+			name: "fee larger than amount",
+			amt:  1e6,
+			fee: config.Fee{
+				Flat: "2",
+			},
+			maxDecimals: 3,
+			out:         1e6,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			fee, err := calculateServiceFee(tc.amt, tc.fee, tc.maxDecimals)
+			require.NoError(t, err)
+			require.Equal(t, tc.out, fee)
+		})
+	}
+}
+
+func TestSendServiceFee(t *testing.T) {
+	e, send, _, shutdown := setupSendExchange(t)
+	defer shutdown()
+
+	send.cfg.MaxDecimals = 3
+	send.cfg.Fees.BTC = config.Fee{
+		Percent: "2.5",
+		Flat:    "0.1234",
+	}
+
+	di := newOperatorDepositInfo(StatusWaitSend)
+	_, err := e.store.BindAddress(di.SkyAddress, di.DepositAddress, di.CoinType, di.BuyMethod, 0)
+	require.NoError(t, err)
+	di = mustAddOperatorDepositInfo(t, e, di)
+
+	di, err = send.handleDepositInfoState(di)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, di.Status)
+	require.Equal(t, PayoutData{
+		Gross: 100e6,
+		Fee:   2624e3,
+		Net:   97376e3,
+	}, di.Payout)
+	require.Equal(t, di.Payout.Net, di.SkySent)
+
+	// The recorded payout is kept if the fees change
+	send.cfg.Fees.BTC.Percent = "5"
+	payout, err := send.calculateSkyPayout(di)
+	require.NoError(t, err)
+	require.Equal(t, di.Payout, payout)
+
+	statuses, err := e.GetDepositStatuses(di.SkyAddress)
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	require.Equal(t, &DepositStatusPayout{
+		Gross: "100.000000",
+		Fee:   "2.624000",
+		Net:   "97.376000",
+	}, statuses[0].Payout)
+
+	stats, err := e.store.GetDepositStats()
+	require.NoError(t, err)
+	require.Equal(t, int64(2624e3), stats.Fees)
+}
@@ -0,0 +1,1498 @@
+package exchange
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/sqlutil"
+	"github.com/skycoin/teller/src/webhook"
+)
+
+// sqlSchema creates the exchange tables.
+// The bind_address buckets are merged into bound_addresses, and the stats buckets into stats_periods.
+// The sky_deposit_seqs_index and btc_txs buckets are replaced by indexes.
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS exchange_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS bound_addresses (
+		coin_type TEXT NOT NULL,
+		address TEXT NOT NULL,
+		sky_address TEXT NOT NULL,
+		buy_method TEXT NOT NULL,
+		seq BIGINT NOT NULL,
+		bound_at BIGINT NOT NULL DEFAULT 0,
+		expected_value BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (coin_type, address)
+	)`,
+	`CREATE INDEX IF NOT EXISTS bound_addresses_sky_address ON bound_addresses (sky_address)`,
+	`CREATE TABLE IF NOT EXISTS deposit_info (
+		deposit_id TEXT PRIMARY KEY,
+		seq BIGINT NOT NULL,
+		coin_type TEXT NOT NULL,
+		deposit_address TEXT NOT NULL,
+		sky_address TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL,
+		updated_at BIGINT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS deposit_info_deposit_address ON deposit_info (deposit_address)`,
+	`CREATE INDEX IF NOT EXISTS deposit_info_status ON deposit_info (status)`,
+	`CREATE INDEX IF NOT EXISTS deposit_info_updated_at ON deposit_info (updated_at)`,
+	`CREATE INDEX IF NOT EXISTS deposit_info_coin_type ON deposit_info (coin_type)`,
+	`CREATE INDEX IF NOT EXISTS deposit_info_errored ON deposit_info (deposit_id) WHERE error <> ''`,
+	`CREATE TABLE IF NOT EXISTS deposit_history (
+		deposit_id TEXT NOT NULL,
+		n INTEGER NOT NULL,
+		timestamp BIGINT NOT NULL,
+		to_status TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (deposit_id, n)
+	)`,
+	`CREATE TABLE IF NOT EXISTS deposit_retries (
+		deposit_id TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS ledger_entries (
+		seq BIGINT PRIMARY KEY,
+		timestamp BIGINT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS ledger_entries_timestamp ON ledger_entries (timestamp)`,
+	`CREATE TABLE IF NOT EXISTS stats_periods (
+		stats_interval TEXT NOT NULL,
+		start BIGINT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (stats_interval, start)
+	)`,
+	`CREATE TABLE IF NOT EXISTS pause_changes (
+		seq BIGINT PRIMARY KEY,
+		timestamp BIGINT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+}
+
+// The tables that replace a bucket have its name, and their sequences are named after them
+var (
+	exchangeMetaTable   = string(ExchangeMetaBkt)
+	boundAddressesTable = "bound_addresses"
+	depositInfoTable    = string(DepositInfoBkt)
+	depositHistoryTable = string(DepositHistoryBkt)
+	depositRetryTable   = string(DepositRetryBkt)
+	ledgerTable         = string(LedgerBkt)
+	statsPeriodsTable   = "stats_periods"
+	pauseChangesTable   = string(PauseChangesBkt)
+)
+
+// ErrSQLStoreNotEmpty is returned by SQLStore.ImportBolt if the SQL database already has deposits or journal entries
+var ErrSQLStoreNotEmpty = errors.New("SQL database is not empty")
+
+// SQLStore storage for exchange, in a SQL database
+type SQLStore struct {
+	storeActor
+	db     *sqlutil.DB
+	log    logrus.FieldLogger
+	outbox *outbox
+}
+
+// NewSQLStore creates a SQLStore instance
+func NewSQLStore(log logrus.FieldLogger, db *sqlutil.DB) (*SQLStore, error) {
+	if db == nil {
+		return nil, errors.New("new exchange SQLStore failed, db is nil")
+	}
+
+	if err := db.CreateTables(sqlSchema); err != nil {
+		return nil, err
+	}
+
+	// The webhook events are added in the same transaction as the changes they report
+	if err := db.CreateTables(webhook.EventsTableSchema); err != nil {
+		return nil, err
+	}
+
+	s := &SQLStore{
+		db:     db,
+		log:    log.WithField("prefix", "exchange.SQLStore"),
+		outbox: &outbox{},
+	}
+
+	if err := s.initLedger(); err != nil {
+		return nil, err
+	}
+
+	if err := s.initStats(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// initLedger posts the journal entries of the deposits made before the ledger existed.
+// Their entries are timestamped with the deposit's last update.
+func (s *SQLStore) initLedger() error {
+	return s.db.Update(func(tx *sqlutil.Tx) error {
+		if hasKey, err := hasMetaKeySQLTx(tx, ledgerInitializedKey); err != nil {
+			return err
+		} else if hasKey {
+			return nil
+		}
+
+		dis, err := queryDepositInfosSQLTx(tx, "SELECT data FROM deposit_info ORDER BY updated_at, seq")
+		if err != nil {
+			return err
+		}
+
+		for _, di := range dis {
+			if err := s.addDepositJournalEntriesSQLTx(tx, DepositInfo{}, di); err != nil {
+				return err
+			}
+		}
+
+		if len(dis) != 0 {
+			s.log.WithField("deposits", len(dis)).Info("Posted ledger entries for existing deposits")
+		}
+
+		return putMetaSQLTx(tx, ledgerInitializedKey, true)
+	})
+}
+
+// initStats records the statistics of the deposits made before the statistics were recorded
+func (s *SQLStore) initStats() error {
+	return s.db.Update(func(tx *sqlutil.Tx) error {
+		if hasKey, err := hasMetaKeySQLTx(tx, statsInitializedKey); err != nil {
+			return err
+		} else if hasKey {
+			return nil
+		}
+
+		dis, err := queryDepositInfosSQLTx(tx, "SELECT data FROM deposit_info ORDER BY seq")
+		if err != nil {
+			return err
+		}
+
+		var updates []statsUpdate
+		for _, di := range dis {
+			history, err := getDepositHistorySQLTx(tx, di.DepositID)
+			if err != nil {
+				return err
+			}
+
+			updates = append(updates, existingDepositStatsUpdates(di, history)...)
+		}
+
+		if err := applyStatsSQLTx(tx, updates); err != nil {
+			return err
+		}
+
+		return putMetaSQLTx(tx, statsInitializedKey, true)
+	})
+}
+
+// WithComponent returns a SQLStore sharing the same database, which records component
+// as responsible for the status transitions it makes
+func (s *SQLStore) WithComponent(component string) Storer {
+	return &SQLStore{
+		db:     s.db,
+		log:    s.log.WithField("component", component),
+		outbox: s.outbox,
+		storeActor: storeActor{
+			component: component,
+		},
+	}
+}
+
+// WithOperator returns a SQLStore sharing the same database, which records an operator action
+// with its actor and reason for every deposit it updates
+func (s *SQLStore) WithOperator(action, actor, reason string) Storer {
+	return &SQLStore{
+		db: s.db,
+		log: s.log.WithFields(logrus.Fields{
+			"component": OperatorComponent,
+			"action":    action,
+			"actor":     actor,
+		}),
+		outbox: s.outbox,
+		storeActor: storeActor{
+			component: OperatorComponent,
+			action:    action,
+			actor:     actor,
+			reason:    reason,
+		},
+	}
+}
+
+// SetWebhookEvents sets whether the store and its copies add webhook events to the outbox
+func (s *SQLStore) SetWebhookEvents(enabled bool) {
+	s.outbox.setEnabled(enabled)
+}
+
+func hasMetaKeySQLTx(tx *sqlutil.Tx, key string) (bool, error) {
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM exchange_meta WHERE key = ?", key).Scan(&n); err != nil {
+		return false, err
+	}
+	return n != 0, nil
+}
+
+func putMetaSQLTx(tx *sqlutil.Tx, key string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO exchange_meta (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, string(b))
+	return err
+}
+
+// GetBindAddress returns bound skycoin address of given bitcoin address.
+// If no skycoin address is found, returns empty string and nil error.
+func (s *SQLStore) GetBindAddress(depositAddr, coinType string) (*BoundAddress, error) {
+	var boundAddr *BoundAddress
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var err error
+		boundAddr, err = getBindAddressSQLTx(tx, depositAddr, coinType)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return boundAddr, nil
+}
+
+// getBindAddressSQLTx returns the BoundAddress of a deposit address, or nil if it is not bound
+func getBindAddressSQLTx(tx *sqlutil.Tx, depositAddr, coinType string) (*BoundAddress, error) {
+	if _, err := GetBindAddressBkt(coinType); err != nil {
+		return nil, err
+	}
+
+	boundAddr := BoundAddress{
+		Address:  depositAddr,
+		CoinType: coinType,
+	}
+
+	err := tx.QueryRow("SELECT sky_address, buy_method, bound_at, expected_value FROM bound_addresses WHERE coin_type = ? AND address = ?",
+		coinType, depositAddr).Scan(&boundAddr.SkyAddress, &boundAddr.BuyMethod, &boundAddr.BoundAt, &boundAddr.ExpectedValue)
+	switch err {
+	case nil:
+		return &boundAddr, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+// queryBoundAddressesSQLTx returns the bound addresses selected by a query of their columns
+func queryBoundAddressesSQLTx(tx *sqlutil.Tx, query string, args ...interface{}) ([]BoundAddress, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var boundAddrs []BoundAddress
+	for rows.Next() {
+		var ba BoundAddress
+		if err := rows.Scan(&ba.SkyAddress, &ba.Address, &ba.CoinType, &ba.BuyMethod, &ba.BoundAt, &ba.ExpectedValue); err != nil {
+			return nil, err
+		}
+
+		boundAddrs = append(boundAddrs, ba)
+	}
+
+	return boundAddrs, rows.Err()
+}
+
+func putBoundAddressSQLTx(tx *sqlutil.Tx, ba BoundAddress, seq uint64) error {
+	_, err := tx.Exec(`INSERT INTO bound_addresses (coin_type, address, sky_address, buy_method, seq, bound_at, expected_value)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, ba.CoinType, ba.Address, ba.SkyAddress, ba.BuyMethod, int64(seq), ba.BoundAt, ba.ExpectedValue)
+	return err
+}
+
+// BindAddress binds a skycoin address to a deposit address
+func (s *SQLStore) BindAddress(skyAddr, depositAddr, coinType, buyMethod string, expectedValue int64) (*BoundAddress, error) {
+	log := s.log.WithField("skyAddr", skyAddr)
+	log = log.WithField("depositAddr", depositAddr)
+	log = log.WithField("coinType", coinType)
+	log = log.WithField("buyMethod", buyMethod)
+	log = log.WithField("expectedValue", expectedValue)
+
+	if _, err := GetBindAddressBkt(coinType); err != nil {
+		return nil, err
+	}
+
+	boundAddr := BoundAddress{
+		SkyAddress:    skyAddr,
+		Address:       depositAddr,
+		CoinType:      coinType,
+		BuyMethod:     buyMethod,
+		BoundAt:       time.Now().UTC().Unix(),
+		ExpectedValue: expectedValue,
+	}
+
+	if err := s.db.Update(func(tx *sqlutil.Tx) error {
+		existingSkyAddr, err := getBindAddressSQLTx(tx, depositAddr, coinType)
+		if err != nil {
+			return err
+		}
+
+		if existingSkyAddr != nil {
+			err := ErrAddressAlreadyBound
+			log.WithError(err).Error("Attempted to bind an address twice")
+			return err
+		}
+
+		seq, err := sqlutil.NextSequence(tx, boundAddressesTable)
+		if err != nil {
+			return err
+		}
+
+		if err := putBoundAddressSQLTx(tx, boundAddr, seq); err != nil {
+			return err
+		}
+
+		return s.outbox.addAddressBoundEventSQLTx(tx, boundAddr)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &boundAddr, nil
+}
+
+// GetOrCreateDepositInfo creates a DepositInfo unless one exists with the DepositInfo.DepositID key,
+// in which case it returns the existing DepositInfo.
+func (s *SQLStore) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, error) {
+	log := s.log.WithField("deposit", dv)
+	log = log.WithField("rate", rate)
+
+	var finalDepositInfo DepositInfo
+	if err := s.db.Update(func(tx *sqlutil.Tx) error {
+		di, err := getDepositInfoSQLTx(tx, dv.ID())
+
+		switch err.(type) {
+		case nil:
+			finalDepositInfo = di
+			return nil
+
+		case dbutil.ObjectNotExistErr:
+			log.Info("DepositInfo not found in DB, inserting")
+			boundAddr, err := getBindAddressSQLTx(tx, dv.Address, dv.CoinType)
+			if err != nil {
+				err = fmt.Errorf("GetBindAddress failed: %v", err)
+				log.WithError(err).Error(err)
+				return err
+			}
+
+			if boundAddr == nil {
+				err = ErrNoBoundAddress
+				log.WithError(err).Error(err)
+				return err
+			}
+
+			log = log.WithField("boundAddr", boundAddr)
+
+			di := DepositInfo{
+				CoinType:       dv.CoinType,
+				DepositAddress: dv.Address,
+				SkyAddress:     boundAddr.SkyAddress,
+				BuyMethod:      boundAddr.BuyMethod,
+				DepositID:      dv.ID(),
+				Status:         StatusWaitDecide,
+				DepositValue:   dv.Value,
+				// Save the rate at the time this deposit was noticed
+				ConversionRate:  rate,
+				SourceAddresses: dv.SourceAddresses,
+				Deposit:         dv,
+			}
+
+			log = log.WithField("depositInfo", di)
+
+			updatedDi, err := s.addDepositInfoSQLTx(tx, di)
+			if err != nil {
+				err = fmt.Errorf("addDepositInfoSQLTx failed: %v", err)
+				log.WithError(err).Error(err)
+				return err
+			}
+
+			finalDepositInfo = updatedDi
+
+			return nil
+
+		default:
+			err = fmt.Errorf("getDepositInfo failed: %v", err)
+			log.WithError(err).Error(err)
+			return err
+		}
+	}); err != nil {
+		return DepositInfo{}, err
+	}
+
+	return finalDepositInfo, nil
+}
+
+// addDepositInfoSQLTx adds a new DepositInfo, with its Seq and UpdatedAt set
+func (s *SQLStore) addDepositInfoSQLTx(tx *sqlutil.Tx, di DepositInfo) (DepositInfo, error) {
+	log := s.log.WithField("depositInfo", di)
+
+	if _, err := getDepositInfoSQLTx(tx, di.DepositID); err == nil {
+		return di, fmt.Errorf("deposit info of btctx \"%s\" already exists", di.DepositID)
+	} else if _, ok := err.(dbutil.ObjectNotExistErr); !ok {
+		return di, err
+	}
+
+	seq, err := sqlutil.NextSequence(tx, depositInfoTable)
+	if err != nil {
+		return di, err
+	}
+
+	updatedDi := di
+	updatedDi.Seq = seq
+	updatedDi.UpdatedAt = time.Now().UTC().Unix()
+
+	if err := updatedDi.ValidateForStatus(); err != nil {
+		log.WithError(err).Error("FIXME: Constructed invalid DepositInfo")
+		return di, err
+	}
+
+	if err := putDepositInfoSQLTx(tx, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := s.addDepositChangeSQLTx(tx, DepositInfo{}, updatedDi); err != nil {
+		return di, err
+	}
+
+	return updatedDi, nil
+}
+
+// addDepositChangeSQLTx records the statistics, history, journal entries and webhook events
+// of a change of a deposit from oldDi to newDi
+func (s *SQLStore) addDepositChangeSQLTx(tx *sqlutil.Tx, oldDi, newDi DepositInfo) error {
+	if err := s.addDepositStatsSQLTx(tx, oldDi, newDi); err != nil {
+		return err
+	}
+
+	if t, ok := s.depositTransition(oldDi, newDi); ok {
+		if err := addDepositTransitionSQLTx(tx, newDi.DepositID, t); err != nil {
+			return err
+		}
+	}
+
+	if err := s.addDepositJournalEntriesSQLTx(tx, oldDi, newDi); err != nil {
+		return err
+	}
+
+	return s.outbox.addDepositEventsSQLTx(tx, oldDi, newDi)
+}
+
+// putDepositInfoSQLTx inserts or replaces a DepositInfo
+func putDepositInfoSQLTx(tx *sqlutil.Tx, di DepositInfo) error {
+	b, err := json.Marshal(di)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO deposit_info
+		(deposit_id, seq, coin_type, deposit_address, sky_address, status, error, updated_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (deposit_id) DO UPDATE SET
+		sky_address = excluded.sky_address, status = excluded.status, error = excluded.error,
+		updated_at = excluded.updated_at, data = excluded.data`,
+		di.DepositID, int64(di.Seq), di.CoinType, di.DepositAddress, di.SkyAddress, di.Status, di.Error, di.UpdatedAt, string(b))
+	return err
+}
+
+// GetDepositInfo returns the DepositInfo of a deposit
+func (s *SQLStore) GetDepositInfo(btcTx string) (DepositInfo, error) {
+	var di DepositInfo
+
+	err := s.db.View(func(tx *sqlutil.Tx) error {
+		var err error
+		di, err = getDepositInfoSQLTx(tx, btcTx)
+		return err
+	})
+
+	return di, err
+}
+
+// getDepositInfoSQLTx returns the DepositInfo of a deposit.
+// Returns dbutil.ObjectNotExistErr if it does not exist, as Store does.
+func getDepositInfoSQLTx(tx *sqlutil.Tx, btcTx string) (DepositInfo, error) {
+	var data string
+	err := tx.QueryRow("SELECT data FROM deposit_info WHERE deposit_id = ?", btcTx).Scan(&data)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		return DepositInfo{}, dbutil.NewObjectNotExistErr(DepositInfoBkt, []byte(btcTx))
+	default:
+		return DepositInfo{}, err
+	}
+
+	var di DepositInfo
+	if err := json.Unmarshal([]byte(data), &di); err != nil {
+		return DepositInfo{}, fmt.Errorf("decode value failed: %v", err)
+	}
+
+	return di, nil
+}
+
+// queryDepositInfosSQLTx returns the deposits selected by a query of their data
+func queryDepositInfosSQLTx(tx *sqlutil.Tx, query string, args ...interface{}) ([]DepositInfo, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dis []DepositInfo
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var di DepositInfo
+		if err := json.Unmarshal([]byte(data), &di); err != nil {
+			return nil, err
+		}
+
+		dis = append(dis, di)
+	}
+
+	return dis, rows.Err()
+}
+
+// GetDepositInfoArray returns filtered deposit info
+func (s *SQLStore) GetDepositInfoArray(flt DepositFilter) ([]DepositInfo, error) {
+	var dpis []DepositInfo
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		dis, err := queryDepositInfosSQLTx(tx, "SELECT data FROM deposit_info ORDER BY seq")
+		if err != nil {
+			return err
+		}
+
+		for _, di := range dis {
+			if flt(di) {
+				dpis = append(dpis, di)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return dpis, nil
+}
+
+// QueryDepositInfo returns the deposits selected by a query, in the order they were received
+func (s *SQLStore) QueryDepositInfo(q DepositQuery) ([]DepositInfo, error) {
+	where, args := timeRangeSQL("updated_at", q.UpdatedFrom, q.UpdatedTo)
+
+	if len(q.Statuses) != 0 {
+		where += " AND status IN (?" + strings.Repeat(", ?", len(q.Statuses)-1) + ")"
+		for _, status := range q.Statuses {
+			args = append(args, status)
+		}
+	}
+
+	if q.CoinType != "" {
+		where += " AND coin_type = ?"
+		args = append(args, q.CoinType)
+	}
+
+	if q.Errored {
+		where += " AND error <> ''"
+	}
+
+	var dpis []DepositInfo
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var err error
+		dpis, err = queryDepositInfosSQLTx(tx, "SELECT data FROM deposit_info WHERE "+where+" ORDER BY seq", args...)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return dpis, nil
+}
+
+// GetDepositInfoOfSkyAddress returns all deposit info that are bound
+// to the given skycoin address
+func (s *SQLStore) GetDepositInfoOfSkyAddress(skyAddr string) ([]DepositInfo, error) {
+	var dpis []DepositInfo
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		boundAddrs, err := getSkyBindAddressesSQLTx(tx, skyAddr)
+		if err != nil {
+			return err
+		}
+
+		for _, boundAddr := range boundAddrs {
+			dis, err := queryDepositInfosSQLTx(tx, "SELECT data FROM deposit_info WHERE deposit_address = ? ORDER BY seq", boundAddr.Address)
+			if err != nil {
+				return err
+			}
+
+			// If this db has no DepositInfo records yet, it means the scanner
+			// has not sent a deposit to the exchange, so the status is
+			// StatusWaitDeposit.
+			if len(dis) == 0 {
+				dpis = append(dpis, DepositInfo{
+					Status:         StatusWaitDeposit,
+					DepositAddress: boundAddr.Address,
+					SkyAddress:     skyAddr,
+					UpdatedAt:      time.Now().UTC().Unix(),
+					CoinType:       boundAddr.CoinType,
+				})
+			}
+
+			dpis = append(dpis, dis...)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// sort the dpis by update time
+	sort.Slice(dpis, func(i, j int) bool {
+		return dpis[i].UpdatedAt < dpis[j].UpdatedAt
+	})
+
+	// renumber the seqs in the dpis
+	for i := range dpis {
+		dpis[i].Seq = uint64(i)
+	}
+
+	return dpis, nil
+}
+
+// UpdateDepositInfo updates deposit info. The update func takes a DepositInfo
+// and returns a modified copy of it.
+func (s *SQLStore) UpdateDepositInfo(btcTx string, update func(DepositInfo) DepositInfo) (DepositInfo, error) {
+	return s.UpdateDepositInfoCallback(btcTx, update, func(di DepositInfo) error { return nil })
+}
+
+// UpdateDepositInfoCallback updates deposit info. The update func takes a DepositInfo
+// and returns a modified copy of it.  After updating the DepositInfo, it calls callback,
+// inside of the transaction.  If the callback returns an error, the DepositInfo update
+// is rolled back.
+func (s *SQLStore) UpdateDepositInfoCallback(btcTx string, update func(DepositInfo) DepositInfo, callback func(DepositInfo) error) (DepositInfo, error) {
+	log := s.log.WithField("btcTx", btcTx)
+
+	var dpi DepositInfo
+	if err := s.db.Update(func(tx *sqlutil.Tx) error {
+		var err error
+		dpi, err = getDepositInfoSQLTx(tx, btcTx)
+		if err != nil {
+			return err
+		}
+
+		log = log.WithField("depositInfo", dpi)
+
+		if dpi.DepositID != btcTx {
+			log.Error("DepositInfo.DepositID does not match btcTx")
+			err := fmt.Errorf("DepositInfo %+v saved under different key %s", dpi, btcTx)
+			return err
+		}
+
+		oldDpi := dpi
+		dpi = update(dpi)
+		dpi.UpdatedAt = time.Now().UTC().Unix()
+
+		if err := putDepositInfoSQLTx(tx, dpi); err != nil {
+			return err
+		}
+
+		if err := s.addDepositChangeSQLTx(tx, oldDpi, dpi); err != nil {
+			return err
+		}
+
+		return callback(dpi)
+
+	}); err != nil {
+		return DepositInfo{}, err
+	}
+
+	return dpi, nil
+}
+
+// addDepositTransitionSQLTx appends a DepositTransition to a deposit's history
+func addDepositTransitionSQLTx(tx *sqlutil.Tx, depositID string, t DepositTransition) error {
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM deposit_history WHERE deposit_id = ?", depositID).Scan(&n); err != nil {
+		return err
+	}
+
+	return putDepositTransitionSQLTx(tx, depositID, n, t)
+}
+
+func putDepositTransitionSQLTx(tx *sqlutil.Tx, depositID string, n int, t DepositTransition) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO deposit_history (deposit_id, n, timestamp, to_status, data) VALUES (?, ?, ?, ?, ?)",
+		depositID, n, t.Timestamp, t.ToStatus, string(b))
+	return err
+}
+
+// addDepositJournalEntriesSQLTx posts the journal entries for a change of a deposit from oldDi to newDi
+func (s *SQLStore) addDepositJournalEntriesSQLTx(tx *sqlutil.Tx, oldDi, newDi DepositInfo) error {
+	for _, e := range s.validDepositJournalEntries(s.log, oldDi, newDi) {
+		if _, err := addJournalEntrySQLTx(tx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addJournalEntrySQLTx validates and appends a JournalEntry to the ledger
+func addJournalEntrySQLTx(tx *sqlutil.Tx, e JournalEntry) (JournalEntry, error) {
+	if err := e.Validate(); err != nil {
+		return e, err
+	}
+
+	seq, err := sqlutil.NextSequence(tx, ledgerTable)
+	if err != nil {
+		return e, err
+	}
+
+	e.Seq = seq
+
+	if err := putJournalEntrySQLTx(tx, e); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+func putJournalEntrySQLTx(tx *sqlutil.Tx, e JournalEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO ledger_entries (seq, timestamp, data) VALUES (?, ?, ?)", int64(e.Seq), e.Timestamp, string(b))
+	return err
+}
+
+// AddJournalEntry appends a JournalEntry to the ledger. Its Timestamp is set to now if not set.
+func (s *SQLStore) AddJournalEntry(e JournalEntry) (JournalEntry, error) {
+	if e.Timestamp == 0 {
+		e.Timestamp = time.Now().UTC().Unix()
+	}
+
+	if err := s.db.Update(func(tx *sqlutil.Tx) error {
+		var err error
+		e, err = addJournalEntrySQLTx(tx, e)
+		return err
+	}); err != nil {
+		return JournalEntry{}, err
+	}
+
+	return e, nil
+}
+
+// GetJournalEntries returns the journal entries timestamped between from and to inclusive, oldest first.
+// A zero from or to is unbounded.
+func (s *SQLStore) GetJournalEntries(from, to int64) ([]JournalEntry, error) {
+	var entries []JournalEntry
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		where, args := timeRangeSQL("timestamp", from, to)
+		rows, err := tx.Query("SELECT data FROM ledger_entries WHERE "+where, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+
+			var e JournalEntry
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				return err
+			}
+
+			entries = append(entries, e)
+		}
+
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	sortJournalEntries(entries)
+
+	return entries, nil
+}
+
+// timeRangeSQL returns the condition and arguments selecting the rows whose column is between from and to inclusive.
+// A zero from or to is unbounded.
+func timeRangeSQL(column string, from, to int64) (string, []interface{}) {
+	where := "1 = 1"
+	var args []interface{}
+
+	if from != 0 {
+		where += " AND " + column + " >= ?"
+		args = append(args, from)
+	}
+
+	if to != 0 {
+		where += " AND " + column + " <= ?"
+		args = append(args, to)
+	}
+
+	return where, args
+}
+
+// GetLedgerBalances returns the balance of every account as of asOf, including the entries timestamped at asOf.
+// If asOf is zero, the current balances are returned.
+func (s *SQLStore) GetLedgerBalances(asOf int64) (LedgerBalances, error) {
+	entries, err := s.GetJournalEntries(0, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(LedgerBalances)
+	for _, e := range entries {
+		balances.add(e)
+	}
+
+	return balances, nil
+}
+
+// addDepositStatsSQLTx records the statistics for a change of a deposit from oldDi to newDi.
+// It must be called before the change is added to the deposit's history.
+func (s *SQLStore) addDepositStatsSQLTx(tx *sqlutil.Tx, oldDi, newDi DepositInfo) error {
+	var history []DepositTransition
+	if oldDi.DepositID != "" {
+		var err error
+		history, err = getDepositHistorySQLTx(tx, newDi.DepositID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return applyStatsSQLTx(tx, depositStatsUpdates(oldDi, newDi, history))
+}
+
+// applyStatsSQLTx applies statistics updates to the periods of every interval
+func applyStatsSQLTx(tx *sqlutil.Tx, updates []statsUpdate) error {
+	for _, interval := range StatsIntervals {
+		periods := make(map[int64]*StatsPeriod)
+		for _, u := range updates {
+			start, err := statsPeriodStart(interval, u.Timestamp)
+			if err != nil {
+				return err
+			}
+
+			p, ok := periods[start]
+			if !ok {
+				period := newStatsPeriod(start)
+
+				var data string
+				err := tx.QueryRow("SELECT data FROM stats_periods WHERE stats_interval = ? AND start = ?", interval, start).Scan(&data)
+				switch err {
+				case nil:
+					if err := json.Unmarshal([]byte(data), &period); err != nil {
+						return err
+					}
+				case sql.ErrNoRows:
+				default:
+					return err
+				}
+
+				p = &period
+				periods[start] = p
+			}
+
+			u.Apply(p)
+		}
+
+		for _, p := range periods {
+			if err := putStatsPeriodSQLTx(tx, interval, *p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func putStatsPeriodSQLTx(tx *sqlutil.Tx, interval string, p StatsPeriod) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO stats_periods (stats_interval, start, data) VALUES (?, ?, ?)
+		ON CONFLICT (stats_interval, start) DO UPDATE SET data = excluded.data`, interval, p.Start, string(b))
+	return err
+}
+
+// GetStatsPeriods returns the statistics of an interval's periods that start between from and to inclusive, oldest first.
+// A zero from or to is unbounded. Periods without activity are omitted.
+func (s *SQLStore) GetStatsPeriods(interval string, from, to int64) ([]StatsPeriod, error) {
+	if _, err := GetStatsBkt(interval); err != nil {
+		return nil, err
+	}
+
+	var periods []StatsPeriod
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		where, args := timeRangeSQL("start", from, to)
+		args = append([]interface{}{interval}, args...)
+		rows, err := tx.Query("SELECT data FROM stats_periods WHERE stats_interval = ? AND "+where+" ORDER BY start", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+
+			var p StatsPeriod
+			if err := json.Unmarshal([]byte(data), &p); err != nil {
+				return err
+			}
+
+			periods = append(periods, p)
+		}
+
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	return periods, nil
+}
+
+// GetDepositHistory returns the status transitions of a deposit, oldest first.
+// Deposits created before the history was recorded have no history.
+func (s *SQLStore) GetDepositHistory(depositID string) ([]DepositTransition, error) {
+	var history []DepositTransition
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var err error
+		history, err = getDepositHistorySQLTx(tx, depositID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// getDepositHistorySQLTx returns the status transitions of a deposit, oldest first
+func getDepositHistorySQLTx(tx *sqlutil.Tx, depositID string) ([]DepositTransition, error) {
+	rows, err := tx.Query("SELECT data FROM deposit_history WHERE deposit_id = ? ORDER BY n", depositID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []DepositTransition
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var t DepositTransition
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return nil, err
+		}
+
+		history = append(history, t)
+	}
+
+	return history, rows.Err()
+}
+
+// GetDepositRetry returns the DepositRetry of a deposit, or nil if the deposit is not waiting to be retried
+func (s *SQLStore) GetDepositRetry(depositID string) (*DepositRetry, error) {
+	var dr DepositRetry
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var data string
+		if err := tx.QueryRow("SELECT data FROM deposit_retries WHERE deposit_id = ?", depositID).Scan(&data); err != nil {
+			return err
+		}
+
+		return json.Unmarshal([]byte(data), &dr)
+	}); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &dr, nil
+}
+
+// GetDepositRetries returns all DepositRetries
+func (s *SQLStore) GetDepositRetries() ([]DepositRetry, error) {
+	var drs []DepositRetry
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		rows, err := tx.Query("SELECT data FROM deposit_retries ORDER BY deposit_id")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+
+			var dr DepositRetry
+			if err := json.Unmarshal([]byte(data), &dr); err != nil {
+				return err
+			}
+
+			drs = append(drs, dr)
+		}
+
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	return drs, nil
+}
+
+// PutDepositRetry saves a DepositRetry
+func (s *SQLStore) PutDepositRetry(dr DepositRetry) error {
+	if dr.DepositID == "" {
+		return errors.New("DepositRetry.DepositID missing")
+	}
+
+	return s.db.Update(func(tx *sqlutil.Tx) error {
+		return putDepositRetrySQLTx(tx, dr)
+	})
+}
+
+func putDepositRetrySQLTx(tx *sqlutil.Tx, dr DepositRetry) error {
+	b, err := json.Marshal(dr)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO deposit_retries (deposit_id, data) VALUES (?, ?)
+		ON CONFLICT (deposit_id) DO UPDATE SET data = excluded.data`, dr.DepositID, string(b))
+	return err
+}
+
+// DeleteDepositRetry deletes the DepositRetry of a deposit
+func (s *SQLStore) DeleteDepositRetry(depositID string) error {
+	return s.db.Update(func(tx *sqlutil.Tx) error {
+		_, err := tx.Exec("DELETE FROM deposit_retries WHERE deposit_id = ?", depositID)
+		return err
+	})
+}
+
+// GetSkyBindAddresses returns the addresses of the given sky address bound
+func (s *SQLStore) GetSkyBindAddresses(skyAddr string) ([]BoundAddress, error) {
+	var boundAddrs []BoundAddress
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var err error
+		boundAddrs, err = getSkyBindAddressesSQLTx(tx, skyAddr)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return boundAddrs, nil
+}
+
+// getSkyBindAddressesSQLTx returns the addresses bound to a sky address, in the order they were bound
+func getSkyBindAddressesSQLTx(tx *sqlutil.Tx, skyAddr string) ([]BoundAddress, error) {
+	return queryBoundAddressesSQLTx(tx, `SELECT sky_address, address, coin_type, buy_method, bound_at, expected_value
+		FROM bound_addresses WHERE sky_address = ? ORDER BY seq`, skyAddr)
+}
+
+// GetBindAddresses returns all bound addresses of all coin types
+func (s *SQLStore) GetBindAddresses() ([]BoundAddress, error) {
+	var boundAddrs []BoundAddress
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var err error
+		boundAddrs, err = queryBoundAddressesSQLTx(tx, `SELECT sky_address, address, coin_type, buy_method, bound_at, expected_value
+			FROM bound_addresses ORDER BY seq`)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return boundAddrs, nil
+}
+
+// GetUnpaidBindAddresses returns the bound addresses of all coin types that have not received a deposit
+func (s *SQLStore) GetUnpaidBindAddresses() ([]BoundAddress, error) {
+	var boundAddrs []BoundAddress
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var err error
+		boundAddrs, err = queryBoundAddressesSQLTx(tx, `SELECT sky_address, address, coin_type, buy_method, bound_at, expected_value
+			FROM bound_addresses b
+			WHERE NOT EXISTS (SELECT 1 FROM deposit_info d WHERE d.deposit_address = b.address)
+			ORDER BY b.seq`)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return boundAddrs, nil
+}
+
+// GetDepositStats returns SKY sent, amounts received per coin type and passthrough order totals
+func (s *SQLStore) GetDepositStats() (*DepositStats, error) {
+	stats := newDepositStats()
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		dis, err := queryDepositInfosSQLTx(tx, "SELECT data FROM deposit_info")
+		if err != nil {
+			return err
+		}
+
+		for _, di := range dis {
+			stats.add(di)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// AddPauseChange appends a PauseChange to the pause changes. Its Timestamp is set to now if not set.
+func (s *SQLStore) AddPauseChange(c PauseChange) (PauseChange, error) {
+	if err := ValidatePause(c.Target, c.CoinType); err != nil {
+		return PauseChange{}, err
+	}
+
+	if c.Timestamp == 0 {
+		c.Timestamp = time.Now().UTC().Unix()
+	}
+
+	if err := s.db.Update(func(tx *sqlutil.Tx) error {
+		seq, err := sqlutil.NextSequence(tx, pauseChangesTable)
+		if err != nil {
+			return err
+		}
+
+		c.Seq = seq
+
+		return putPauseChangeSQLTx(tx, c)
+	}); err != nil {
+		return PauseChange{}, err
+	}
+
+	return c, nil
+}
+
+func putPauseChangeSQLTx(tx *sqlutil.Tx, c PauseChange) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO pause_changes (seq, timestamp, data) VALUES (?, ?, ?)", int64(c.Seq), c.Timestamp, string(b))
+	return err
+}
+
+// GetPauseChanges returns all pause changes, oldest first
+func (s *SQLStore) GetPauseChanges() ([]PauseChange, error) {
+	var changes []PauseChange
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		rows, err := tx.Query("SELECT data FROM pause_changes ORDER BY seq")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+
+			var c PauseChange
+			if err := json.Unmarshal([]byte(data), &c); err != nil {
+				return err
+			}
+
+			changes = append(changes, c)
+		}
+
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	sortPauseChanges(changes)
+
+	return changes, nil
+}
+
+// ImportBolt copies the exchange data of a bolt database, keeping the sequence numbers.
+// The webhook events are copied by webhook.SQLStore.ImportBolt.
+// Returns ErrSQLStoreNotEmpty if the SQL database already has exchange data.
+func (s *SQLStore) ImportBolt(db *bolt.DB) error {
+	return db.View(func(boltTx *bolt.Tx) error {
+		return s.db.Update(func(tx *sqlutil.Tx) error {
+			for _, table := range []string{boundAddressesTable, depositInfoTable, ledgerTable, pauseChangesTable} {
+				n, err := sqlutil.CountRows(tx, table)
+				if err != nil {
+					return err
+				}
+				if n != 0 {
+					return ErrSQLStoreNotEmpty
+				}
+			}
+
+			// The metadata is replaced, so that the ledger and statistics are initialized
+			// from the imported deposits if they were not in the bolt database
+			if _, err := tx.Exec("DELETE FROM exchange_meta"); err != nil {
+				return err
+			}
+
+			if err := dbutil.ForEachIfExists(boltTx, ExchangeMetaBkt, func(k, v []byte) error {
+				_, err := tx.Exec("INSERT INTO exchange_meta (key, value) VALUES (?, ?)", string(k), string(v))
+				return err
+			}); err != nil {
+				return err
+			}
+
+			if err := importBoundAddressesSQLTx(tx, boltTx); err != nil {
+				return err
+			}
+
+			if err := dbutil.ForEachIfExists(boltTx, DepositInfoBkt, func(k, v []byte) error {
+				var di DepositInfo
+				if err := json.Unmarshal(v, &di); err != nil {
+					return err
+				}
+				return putDepositInfoSQLTx(tx, di)
+			}); err != nil {
+				return err
+			}
+
+			if err := dbutil.ForEachIfExists(boltTx, DepositHistoryBkt, func(k, v []byte) error {
+				var history []DepositTransition
+				if err := json.Unmarshal(v, &history); err != nil {
+					return err
+				}
+
+				for i, t := range history {
+					if err := putDepositTransitionSQLTx(tx, string(k), i, t); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			if err := dbutil.ForEachIfExists(boltTx, DepositRetryBkt, func(k, v []byte) error {
+				var dr DepositRetry
+				if err := json.Unmarshal(v, &dr); err != nil {
+					return err
+				}
+				return putDepositRetrySQLTx(tx, dr)
+			}); err != nil {
+				return err
+			}
+
+			if err := dbutil.ForEachIfExists(boltTx, LedgerBkt, func(k, v []byte) error {
+				var e JournalEntry
+				if err := json.Unmarshal(v, &e); err != nil {
+					return err
+				}
+				return putJournalEntrySQLTx(tx, e)
+			}); err != nil {
+				return err
+			}
+
+			for _, interval := range StatsIntervals {
+				if err := dbutil.ForEachIfExists(boltTx, MustGetStatsBkt(interval), func(k, v []byte) error {
+					var p StatsPeriod
+					if err := json.Unmarshal(v, &p); err != nil {
+						return err
+					}
+					return putStatsPeriodSQLTx(tx, interval, p)
+				}); err != nil {
+					return err
+				}
+			}
+
+			if err := dbutil.ForEachIfExists(boltTx, PauseChangesBkt, func(k, v []byte) error {
+				var c PauseChange
+				if err := json.Unmarshal(v, &c); err != nil {
+					return err
+				}
+				return putPauseChangeSQLTx(tx, c)
+			}); err != nil {
+				return err
+			}
+
+			for _, bkt := range [][]byte{DepositInfoBkt, LedgerBkt, PauseChangesBkt} {
+				if err := sqlutil.SetSequence(tx, string(bkt), dbutil.BucketSequence(boltTx, bkt)); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+}
+
+// importBoundAddressesSQLTx copies the bound addresses of a bolt database.
+// They are numbered in the order they were bound to each SKY address, as recorded in SkyDepositSeqsIndexBkt.
+func importBoundAddressesSQLTx(tx *sqlutil.Tx, boltTx *bolt.Tx) error {
+	type key struct {
+		coinType string
+		address  string
+	}
+
+	var seq uint64
+	seqs := make(map[key]uint64)
+	if err := dbutil.ForEachIfExists(boltTx, SkyDepositSeqsIndexBkt, func(k, v []byte) error {
+		var addrs []BoundAddress
+		if err := json.Unmarshal(v, &addrs); err != nil {
+			return err
+		}
+
+		for _, ba := range addrs {
+			seq++
+			seqs[key{ba.CoinType, ba.Address}] = seq
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, ct := range config.CoinTypes {
+		if err := dbutil.ForEachIfExists(boltTx, MustGetBindAddressBkt(ct), func(k, v []byte) error {
+			var ba BoundAddress
+			if err := json.Unmarshal(v, &ba); err != nil {
+				return err
+			}
+
+			baSeq, ok := seqs[key{ba.CoinType, ba.Address}]
+			if !ok {
+				seq++
+				baSeq = seq
+			}
+
+			return putBoundAddressSQLTx(tx, ba, baSeq)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return sqlutil.SetSequence(tx, boundAddressesTable, seq)
+}
+
+// sqlTables are the exchange tables whose rows are counted by RowCounts.
+// exchange_meta is left out, its keys are set by NewSQLStore if they were missing in bolt.
+var sqlTables = []string{
+	boundAddressesTable,
+	depositInfoTable,
+	depositHistoryTable,
+	depositRetryTable,
+	ledgerTable,
+	statsPeriodsTable,
+	pauseChangesTable,
+}
+
+// RowCounts returns the number of rows of the exchange tables
+func RowCounts(db *sqlutil.DB) (sqlutil.RowCounts, error) {
+	counts := make(sqlutil.RowCounts)
+	if err := db.View(func(tx *sqlutil.Tx) error {
+		for _, table := range sqlTables {
+			n, err := sqlutil.CountRows(tx, table)
+			if err != nil {
+				return err
+			}
+			counts[table] = n
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// BoltRowCounts returns the number of rows that SQLStore.ImportBolt copies from a bolt database to each table counted by RowCounts
+func BoltRowCounts(db *bolt.DB) (sqlutil.RowCounts, error) {
+	counts := make(sqlutil.RowCounts)
+	if err := db.View(func(tx *bolt.Tx) error {
+		counts[depositInfoTable] = dbutil.BucketKeyCount(tx, DepositInfoBkt)
+		counts[depositRetryTable] = dbutil.BucketKeyCount(tx, DepositRetryBkt)
+		counts[ledgerTable] = dbutil.BucketKeyCount(tx, LedgerBkt)
+		counts[pauseChangesTable] = dbutil.BucketKeyCount(tx, PauseChangesBkt)
+
+		counts[boundAddressesTable] = 0
+		for _, ct := range config.CoinTypes {
+			counts[boundAddressesTable] += dbutil.BucketKeyCount(tx, MustGetBindAddressBkt(ct))
+		}
+
+		counts[statsPeriodsTable] = 0
+		for _, interval := range StatsIntervals {
+			counts[statsPeriodsTable] += dbutil.BucketKeyCount(tx, MustGetStatsBkt(interval))
+		}
+
+		counts[depositHistoryTable] = 0
+		return dbutil.ForEachIfExists(tx, DepositHistoryBkt, func(k, v []byte) error {
+			var history []DepositTransition
+			if err := json.Unmarshal(v, &history); err != nil {
+				return err
+			}
+
+			counts[depositHistoryTable] += len(history)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
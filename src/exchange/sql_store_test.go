@@ -0,0 +1,351 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func newTestSQLStore(t *testing.T) (*SQLStore, func()) {
+	db, shutdown := testutil.PrepareSQLDB(t)
+
+	log, _ := testutil.NewLogger(t)
+	s, err := NewSQLStore(log, db)
+	require.NoError(t, err)
+
+	return s, shutdown
+}
+
+// testDepositQueries are the deposit queries compared by storeSnapshot
+var testDepositQueries = []DepositQuery{
+	{Statuses: []string{StatusWaitDecide}},
+	{Statuses: []string{StatusWaitConfirm}},
+	{Statuses: []string{StatusDone, StatusFailed}},
+	{Errored: true},
+	{CoinType: config.CoinTypeBTC},
+	{CoinType: config.CoinTypeETH},
+}
+
+// storeSnapshot is the state of a Storer, with the timestamps set by the store zeroed
+type storeSnapshot struct {
+	BindAddresses []BoundAddress
+	Deposits      []DepositInfo
+	Queried       [][]DepositInfo
+	History       map[string][]DepositTransition
+	Retries       []DepositRetry
+	Journal       []JournalEntry
+	Balances      LedgerBalances
+	Stats         *DepositStats
+	PauseChanges  []PauseChange
+}
+
+func takeStoreSnapshot(t *testing.T, s Storer, zeroTimestamps bool) storeSnapshot {
+	var snap storeSnapshot
+	var err error
+
+	snap.BindAddresses, err = s.GetBindAddresses()
+	require.NoError(t, err)
+
+	snap.Deposits, err = s.GetDepositInfoArray(func(DepositInfo) bool { return true })
+	require.NoError(t, err)
+
+	for _, q := range testDepositQueries {
+		dis, err := s.QueryDepositInfo(q)
+		require.NoError(t, err)
+
+		if zeroTimestamps {
+			for i := range dis {
+				dis[i].UpdatedAt = 0
+			}
+		}
+
+		snap.Queried = append(snap.Queried, dis)
+	}
+
+	snap.History = make(map[string][]DepositTransition)
+	for i, di := range snap.Deposits {
+		history, err := s.GetDepositHistory(di.DepositID)
+		require.NoError(t, err)
+
+		if zeroTimestamps {
+			snap.Deposits[i].UpdatedAt = 0
+			for j := range history {
+				history[j].Timestamp = 0
+			}
+		}
+
+		snap.History[di.DepositID] = history
+	}
+
+	snap.Retries, err = s.GetDepositRetries()
+	require.NoError(t, err)
+
+	snap.Journal, err = s.GetJournalEntries(0, 0)
+	require.NoError(t, err)
+
+	snap.Balances, err = s.GetLedgerBalances(0)
+	require.NoError(t, err)
+
+	snap.Stats, err = s.GetDepositStats()
+	require.NoError(t, err)
+
+	snap.PauseChanges, err = s.GetPauseChanges()
+	require.NoError(t, err)
+
+	if zeroTimestamps {
+		for i := range snap.Journal {
+			snap.Journal[i].Timestamp = 0
+		}
+		for i := range snap.PauseChanges {
+			snap.PauseChanges[i].Timestamp = 0
+		}
+	}
+
+	return snap
+}
+
+// runStoreScenario makes the changes of a deposit's lifetime
+func runStoreScenario(t *testing.T, s Storer) {
+	mustBindAddress(t, s, "skyaddr1", "btcaddr1")
+	mustBindAddress(t, s, "skyaddr1", "btcaddr2")
+	mustBindAddress(t, s, "skyaddr2", "btcaddr3")
+
+	_, err := s.BindAddress("skyaddr3", "btcaddr1", config.CoinTypeBTC, config.BuyMethodDirect, 0)
+	require.Equal(t, ErrAddressAlreadyBound, err)
+
+	for i, addr := range []string{"btcaddr1", "btcaddr2", "btcaddr3"} {
+		_, err := s.GetOrCreateDepositInfo(scanner.Deposit{
+			CoinType: config.CoinTypeBTC,
+			Address:  addr,
+			Value:    int64(i+1) * 1e6,
+			Height:   20,
+			Tx:       "btx" + addr,
+			N:        1,
+		}, testSkyBtcRate)
+		require.NoError(t, err)
+	}
+
+	send := withComponent(s, "send")
+
+	_, err = send.UpdateDepositInfo("btxbtcaddr1:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "skytx1"
+		di.SkySent = 1e8
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = send.UpdateDepositInfo("btxbtcaddr1:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.NoError(t, err)
+
+	// A failed callback rolls back the update and everything recorded with it
+	callbackErr := errors.New("broadcast failed")
+	_, err = send.UpdateDepositInfoCallback("btxbtcaddr2:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "skytx2"
+		di.SkySent = 2e8
+		return di
+	}, func(DepositInfo) error {
+		return callbackErr
+	})
+	require.Equal(t, callbackErr, err)
+
+	_, err = withOperator(s, "fail", "alice", "bad deposit").UpdateDepositInfo("btxbtcaddr3:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusFailed
+		di.Error = "bad deposit"
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo("btxbtcaddr4:1", func(di DepositInfo) DepositInfo {
+		return di
+	})
+	require.IsType(t, dbutil.ObjectNotExistErr{}, err)
+
+	err = s.PutDepositRetry(DepositRetry{
+		DepositID:     "btxbtcaddr2:1",
+		Status:        StatusWaitSend,
+		Component:     "send",
+		Attempts:      1,
+		NextAttemptAt: 1000,
+		LastError:     "broadcast failed",
+	})
+	require.NoError(t, err)
+
+	err = s.PutDepositRetry(DepositRetry{
+		DepositID: "btxbtcaddr3:1",
+		Status:    StatusWaitSend,
+		Component: "send",
+		Attempts:  1,
+	})
+	require.NoError(t, err)
+
+	err = s.DeleteDepositRetry("btxbtcaddr3:1")
+	require.NoError(t, err)
+
+	_, err = s.AddPauseChange(PauseChange{
+		Target: PauseSend,
+		Paused: true,
+		Actor:  "alice",
+		Reason: "maintenance",
+	})
+	require.NoError(t, err)
+}
+
+func TestSQLStoreMatchesStore(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	sqlStore, sqlShutdown := newTestSQLStore(t)
+	defer sqlShutdown()
+
+	runStoreScenario(t, s)
+	runStoreScenario(t, sqlStore)
+
+	snap := takeStoreSnapshot(t, s, true)
+	sqlSnap := takeStoreSnapshot(t, sqlStore, true)
+	require.Equal(t, snap, sqlSnap)
+
+	// The rolled back update left the deposit as it was created, without history or ledger entries
+	di, err := sqlStore.GetDepositInfo("btxbtcaddr2:1")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitDecide, di.Status)
+	require.Empty(t, di.Txid)
+	require.Len(t, sqlSnap.History["btxbtcaddr2:1"], 1)
+
+	for _, e := range sqlSnap.Journal {
+		require.NotEqual(t, "skytx2", e.Txid)
+	}
+
+	require.Len(t, sqlSnap.Retries, 1)
+	require.Equal(t, "btxbtcaddr2:1", sqlSnap.Retries[0].DepositID)
+
+	// The queries are answered from the committed deposits
+	require.Len(t, sqlSnap.Queried[0], 1)
+	require.Equal(t, "btxbtcaddr2:1", sqlSnap.Queried[0][0].DepositID)
+	require.Empty(t, sqlSnap.Queried[1])
+	require.Len(t, sqlSnap.Queried[2], 2)
+	require.Len(t, sqlSnap.Queried[3], 1)
+	require.Equal(t, "btxbtcaddr3:1", sqlSnap.Queried[3][0].DepositID)
+	require.Len(t, sqlSnap.Queried[4], 3)
+	require.Empty(t, sqlSnap.Queried[5])
+
+	require.Equal(t, "alice", sqlSnap.History["btxbtcaddr3:1"][1].Actor)
+	require.Equal(t, "send", sqlSnap.History["btxbtcaddr1:1"][2].Component)
+}
+
+func TestSQLStoreGetDepositInfoOfSkyAddress(t *testing.T) {
+	s, shutdown := newTestSQLStore(t)
+	defer shutdown()
+
+	runStoreScenario(t, s)
+
+	dis, err := s.GetDepositInfoOfSkyAddress("skyaddr1")
+	require.NoError(t, err)
+	require.Len(t, dis, 2)
+	require.Equal(t, "btxbtcaddr1:1", dis[0].DepositID)
+	require.Equal(t, "btxbtcaddr2:1", dis[1].DepositID)
+
+	dis, err = s.GetDepositInfoOfSkyAddress("skyaddr3")
+	require.NoError(t, err)
+	require.Empty(t, dis)
+
+	bas, err := s.GetUnpaidBindAddresses()
+	require.NoError(t, err)
+	require.Empty(t, bas)
+
+	mustBindAddress(t, s, "skyaddr3", "btcaddr4")
+
+	bas, err = s.GetUnpaidBindAddresses()
+	require.NoError(t, err)
+	require.Len(t, bas, 1)
+	require.Equal(t, "btcaddr4", bas[0].Address)
+	requireBoundNow(t, bas[0])
+
+	bas, err = s.GetSkyBindAddresses("skyaddr1")
+	require.NoError(t, err)
+	require.Len(t, bas, 2)
+
+	ba, err := s.GetBindAddress("btcaddr3", config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, "skyaddr2", ba.SkyAddress)
+
+	ba, err = s.GetBindAddress("btcaddr3", config.CoinTypeETH)
+	require.NoError(t, err)
+	require.Nil(t, ba)
+
+	// The expected amount is kept with the bound address
+	_, err = s.BindAddress("skyaddr3", "btcaddr5", config.CoinTypeBTC, config.BuyMethodDirect, 1e6)
+	require.NoError(t, err)
+
+	ba, err = s.GetBindAddress("btcaddr5", config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, int64(1e6), ba.ExpectedValue)
+
+	bas, err = s.GetSkyBindAddresses("skyaddr3")
+	require.NoError(t, err)
+	require.Len(t, bas, 2)
+	require.Equal(t, int64(1e6), bas[1].ExpectedValue)
+
+	_, err = s.GetDepositInfo("btxbtcaddr4:1")
+	require.IsType(t, dbutil.ObjectNotExistErr{}, err)
+
+	dr, err := s.GetDepositRetry("btxbtcaddr3:1")
+	require.NoError(t, err)
+	require.Nil(t, dr)
+}
+
+func TestSQLStoreImportBolt(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	runStoreScenario(t, s)
+
+	sqlStore, sqlShutdown := newTestSQLStore(t)
+	defer sqlShutdown()
+
+	err := sqlStore.ImportBolt(s.db)
+	require.NoError(t, err)
+
+	// The data is copied as is, including the timestamps
+	require.Equal(t, takeStoreSnapshot(t, s, false), takeStoreSnapshot(t, sqlStore, false))
+
+	boltCounts, err := BoltRowCounts(s.db)
+	require.NoError(t, err)
+	sqlCounts, err := RowCounts(sqlStore.db)
+	require.NoError(t, err)
+	require.Empty(t, boltCounts.Diff(sqlCounts))
+	require.Equal(t, 3, sqlCounts[depositInfoTable])
+
+	// The sequences continue from the bolt database's
+	mustBindAddress(t, sqlStore, "skyaddr4", "btcaddr4")
+	di, err := sqlStore.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: config.CoinTypeBTC,
+		Address:  "btcaddr4",
+		Value:    1e6,
+		Tx:       "btxbtcaddr4",
+		N:        1,
+	}, testSkyBtcRate)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), di.Seq)
+
+	c, err := sqlStore.AddPauseChange(PauseChange{
+		Target: PauseSend,
+		Actor:  "alice",
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), c.Seq)
+
+	// The store must be empty
+	err = sqlStore.ImportBolt(s.db)
+	require.Equal(t, ErrSQLStoreNotEmpty, err)
+}
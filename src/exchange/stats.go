@@ -0,0 +1,230 @@
+package exchange
+
+import (
+	"errors"
+	"time"
+
+	"github.com/skycoin/teller/src/config"
+)
+
+const (
+	// StatsIntervalHour hourly statistics
+	StatsIntervalHour = "hour"
+	// StatsIntervalDay daily statistics, starting at midnight UTC
+	StatsIntervalDay = "day"
+	// StatsIntervalWeek weekly statistics, starting on Monday at midnight UTC
+	StatsIntervalWeek = "week"
+
+	// StageDepositToPayout is the stage from receiving a deposit to sending its coins
+	StageDepositToPayout = "deposit_to_payout"
+)
+
+var (
+	// StatsIntervals is all statistics intervals
+	StatsIntervals = []string{
+		StatsIntervalHour,
+		StatsIntervalDay,
+		StatsIntervalWeek,
+	}
+
+	// ErrInvalidStatsInterval is returned for invalid statistics intervals
+	ErrInvalidStatsInterval = errors.New("Invalid stats interval")
+)
+
+// ValidateStatsInterval returns an error if a statistics interval is invalid
+func ValidateStatsInterval(interval string) error {
+	for _, k := range StatsIntervals {
+		if k == interval {
+			return nil
+		}
+	}
+
+	return ErrInvalidStatsInterval
+}
+
+// statsPeriodStart returns the start of the period of an interval that includes ts
+func statsPeriodStart(interval string, ts int64) (int64, error) {
+	t := time.Unix(ts, 0).UTC()
+
+	switch interval {
+	case StatsIntervalHour:
+		return t.Truncate(time.Hour).Unix(), nil
+	case StatsIntervalDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix(), nil
+	case StatsIntervalWeek:
+		// Days since Monday
+		days := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, time.UTC).Unix(), nil
+	default:
+		return 0, ErrInvalidStatsInterval
+	}
+}
+
+// StatsPeriod records the deposit activity of an hour, day or week.
+// Activity is recorded in the period it happened in, e.g. a deposit received on Monday
+// and paid out on Tuesday counts as a deposit on Monday and a payout on Tuesday.
+type StatsPeriod struct {
+	Start        int64            `json:"start"`
+	Deposits     map[string]int64 `json:"deposits"`      // Number of deposits received per coin type
+	DepositValue map[string]int64 `json:"deposit_value"` // Value of the deposits received per coin type, in the coin's smallest unit
+	Payouts      int64            `json:"payouts"`       // Number of deposits paid out
+	SkySent      int64            `json:"sky_sent"`      // SKY sent, in droplets
+	Errors       int64            `json:"errors"`        // Number of errors recorded on deposits
+	// Time spent in each stage by the deposits that left it, keyed by status, and StageDepositToPayout
+	Stages map[string]StageDuration `json:"stages"`
+}
+
+func newStatsPeriod(start int64) StatsPeriod {
+	return StatsPeriod{
+		Start:        start,
+		Deposits:     make(map[string]int64, len(config.CoinTypes)),
+		DepositValue: make(map[string]int64, len(config.CoinTypes)),
+		Stages:       make(map[string]StageDuration),
+	}
+}
+
+// StageDuration records the time deposits spent in a stage
+type StageDuration struct {
+	Count   int64 `json:"count"`
+	Seconds int64 `json:"seconds"` // Total seconds spent in the stage
+}
+
+// Average returns the average time spent in the stage
+func (d StageDuration) Average() time.Duration {
+	if d.Count == 0 {
+		return 0
+	}
+
+	return time.Duration(d.Seconds) * time.Second / time.Duration(d.Count)
+}
+
+// statsUpdate is a change to the statistics of the periods that include Timestamp
+type statsUpdate struct {
+	Timestamp int64
+	Apply     func(*StatsPeriod)
+}
+
+func depositReceivedStats(ts int64, di DepositInfo) statsUpdate {
+	return statsUpdate{ts, func(p *StatsPeriod) {
+		p.Deposits[di.CoinType]++
+		p.DepositValue[di.CoinType] += di.DepositValue
+	}}
+}
+
+func payoutStats(ts int64, payouts, skySent int64) statsUpdate {
+	return statsUpdate{ts, func(p *StatsPeriod) {
+		p.Payouts += payouts
+		p.SkySent += skySent
+	}}
+}
+
+func errorStats(ts int64) statsUpdate {
+	return statsUpdate{ts, func(p *StatsPeriod) {
+		p.Errors++
+	}}
+}
+
+func stageStats(ts int64, stage string, seconds int64) statsUpdate {
+	return statsUpdate{ts, func(p *StatsPeriod) {
+		d := p.Stages[stage]
+		d.Count++
+		d.Seconds += seconds
+		p.Stages[stage] = d
+	}}
+}
+
+// stageEnteredAt returns when a deposit last entered a status, from its history
+func stageEnteredAt(history []DepositTransition, status string) (int64, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		t := history[i]
+		if t.ToStatus == status && t.FromStatus != t.ToStatus {
+			return t.Timestamp, true
+		}
+	}
+
+	return 0, false
+}
+
+// depositStatsUpdates returns the statistics updates for a change of a deposit from oldDi to newDi.
+// history is the deposit's history before the change.
+func depositStatsUpdates(oldDi, newDi DepositInfo, history []DepositTransition) []statsUpdate {
+	ts := newDi.UpdatedAt
+
+	var updates []statsUpdate
+
+	if oldDi.DepositID == "" {
+		updates = append(updates, depositReceivedStats(ts, newDi))
+	}
+
+	if newDi.Error != "" && newDi.Error != oldDi.Error {
+		updates = append(updates, errorStats(ts))
+	}
+
+	if oldDi.Status != "" && oldDi.Status != newDi.Status {
+		if enteredAt, ok := stageEnteredAt(history, oldDi.Status); ok {
+			updates = append(updates, stageStats(ts, oldDi.Status, ts-enteredAt))
+		}
+	}
+
+	oldPaid := isPaidOut(oldDi)
+	newPaid := isPaidOut(newDi)
+	switch {
+	case !oldPaid && newPaid:
+		updates = append(updates, payoutStats(ts, 1, int64(newDi.SkySent)))
+		if len(history) != 0 {
+			updates = append(updates, stageStats(ts, StageDepositToPayout, ts-history[0].Timestamp))
+		}
+	case oldPaid && !newPaid:
+		updates = append(updates, payoutStats(ts, -1, -int64(oldDi.SkySent)))
+	case oldPaid && newPaid && oldDi.SkySent != newDi.SkySent:
+		updates = append(updates, payoutStats(ts, 0, int64(newDi.SkySent)-int64(oldDi.SkySent)))
+	}
+
+	return updates
+}
+
+// existingDepositStatsUpdates returns the statistics updates for a deposit made before the statistics were recorded.
+// They are reconstructed from the deposit's history, if it has one.
+func existingDepositStatsUpdates(di DepositInfo, history []DepositTransition) []statsUpdate {
+	if len(history) == 0 {
+		updates := []statsUpdate{depositReceivedStats(di.UpdatedAt, di)}
+		if di.Error != "" {
+			updates = append(updates, errorStats(di.UpdatedAt))
+		}
+		if isPaidOut(di) {
+			updates = append(updates, payoutStats(di.UpdatedAt, 1, int64(di.SkySent)))
+		}
+		return updates
+	}
+
+	updates := []statsUpdate{depositReceivedStats(history[0].Timestamp, di)}
+
+	paidAt := int64(0)
+	for i, t := range history {
+		if t.Error != "" && (i == 0 || t.Error != history[i-1].Error) {
+			updates = append(updates, errorStats(t.Timestamp))
+		}
+
+		if i == 0 || t.FromStatus == t.ToStatus {
+			continue
+		}
+
+		if enteredAt, ok := stageEnteredAt(history[:i], t.FromStatus); ok {
+			updates = append(updates, stageStats(t.Timestamp, t.FromStatus, t.Timestamp-enteredAt))
+		}
+
+		if paidAt == 0 && (t.ToStatus == StatusWaitConfirm || t.ToStatus == StatusDone) {
+			paidAt = t.Timestamp
+		}
+	}
+
+	if isPaidOut(di) {
+		if paidAt == 0 {
+			paidAt = di.UpdatedAt
+		}
+		updates = append(updates, payoutStats(paidAt, 1, int64(di.SkySent)))
+		updates = append(updates, stageStats(paidAt, StageDepositToPayout, paidAt-history[0].Timestamp))
+	}
+
+	return updates
+}
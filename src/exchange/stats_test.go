@@ -0,0 +1,249 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+func TestStatsPeriodStart(t *testing.T) {
+	// Wednesday
+	ts := time.Date(2018, 3, 7, 15, 42, 10, 0, time.UTC).Unix()
+
+	cases := []struct {
+		interval string
+		start    time.Time
+	}{
+		{StatsIntervalHour, time.Date(2018, 3, 7, 15, 0, 0, 0, time.UTC)},
+		{StatsIntervalDay, time.Date(2018, 3, 7, 0, 0, 0, 0, time.UTC)},
+		{StatsIntervalWeek, time.Date(2018, 3, 5, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.interval, func(t *testing.T) {
+			start, err := statsPeriodStart(tc.interval, ts)
+			require.NoError(t, err)
+			require.Equal(t, tc.start.Unix(), start)
+		})
+	}
+
+	// A Sunday belongs to the week that started on the Monday before it
+	start, err := statsPeriodStart(StatsIntervalWeek, time.Date(2018, 3, 11, 23, 0, 0, 0, time.UTC).Unix())
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2018, 3, 5, 0, 0, 0, 0, time.UTC).Unix(), start)
+
+	_, err = statsPeriodStart("month", ts)
+	require.Equal(t, ErrInvalidStatsInterval, err)
+}
+
+func applyStatsUpdates(updates []statsUpdate) StatsPeriod {
+	p := newStatsPeriod(0)
+	for _, u := range updates {
+		u.Apply(&p)
+	}
+	return p
+}
+
+func TestDepositStatsUpdates(t *testing.T) {
+	di := DepositInfo{
+		CoinType:     config.CoinTypeBTC,
+		DepositID:    "btx1:1",
+		DepositValue: 1e6,
+		Status:       StatusWaitDecide,
+		UpdatedAt:    1000,
+	}
+
+	p := applyStatsUpdates(depositStatsUpdates(DepositInfo{}, di, nil))
+	require.Equal(t, int64(1), p.Deposits[config.CoinTypeBTC])
+	require.Equal(t, int64(1e6), p.DepositValue[config.CoinTypeBTC])
+
+	history := []DepositTransition{
+		{Timestamp: 1000, ToStatus: StatusWaitDecide},
+		{Timestamp: 1010, FromStatus: StatusWaitDecide, ToStatus: StatusWaitSend},
+		// An error doesn't restart the stage
+		{Timestamp: 1020, FromStatus: StatusWaitSend, ToStatus: StatusWaitSend, Error: "send failed"},
+	}
+
+	oldDi := di
+	oldDi.Status = StatusWaitSend
+	oldDi.Error = "send failed"
+
+	newDi := oldDi
+	newDi.Status = StatusWaitConfirm
+	newDi.Error = ""
+	newDi.Txid = "txid"
+	newDi.SkySent = 99e5
+	newDi.UpdatedAt = 1100
+
+	p = applyStatsUpdates(depositStatsUpdates(oldDi, newDi, history))
+	require.Equal(t, int64(0), p.Deposits[config.CoinTypeBTC])
+	require.Equal(t, int64(1), p.Payouts)
+	require.Equal(t, int64(99e5), p.SkySent)
+	require.Equal(t, int64(0), p.Errors)
+	require.Equal(t, map[string]StageDuration{
+		StatusWaitSend:       {Count: 1, Seconds: 90},
+		StageDepositToPayout: {Count: 1, Seconds: 100},
+	}, p.Stages)
+
+	// A new error is counted
+	erroredDi := oldDi
+	erroredDi.Error = "send failed again"
+	p = applyStatsUpdates(depositStatsUpdates(oldDi, erroredDi, history))
+	require.Equal(t, int64(1), p.Errors)
+	require.Empty(t, p.Stages)
+
+	// A reversed payout is subtracted
+	requeuedDi := newDi
+	requeuedDi.Status = StatusWaitSend
+	requeuedDi.Txid = ""
+	requeuedDi.SkySent = 0
+	p = applyStatsUpdates(depositStatsUpdates(newDi, requeuedDi, nil))
+	require.Equal(t, int64(-1), p.Payouts)
+	require.Equal(t, int64(-99e5), p.SkySent)
+}
+
+func TestExistingDepositStatsUpdates(t *testing.T) {
+	di := DepositInfo{
+		CoinType:     config.CoinTypeBTC,
+		DepositID:    "btx1:1",
+		DepositValue: 1e6,
+		Status:       StatusDone,
+		Txid:         "txid",
+		SkySent:      99e5,
+		UpdatedAt:    2000,
+	}
+
+	history := []DepositTransition{
+		{Timestamp: 1000, ToStatus: StatusWaitDecide},
+		{Timestamp: 1010, FromStatus: StatusWaitDecide, ToStatus: StatusWaitSend},
+		{Timestamp: 1020, FromStatus: StatusWaitSend, ToStatus: StatusWaitSend, Error: "send failed"},
+		{Timestamp: 1100, FromStatus: StatusWaitSend, ToStatus: StatusWaitConfirm},
+		{Timestamp: 1300, FromStatus: StatusWaitConfirm, ToStatus: StatusDone},
+	}
+
+	p := applyStatsUpdates(existingDepositStatsUpdates(di, history))
+	require.Equal(t, int64(1), p.Deposits[config.CoinTypeBTC])
+	require.Equal(t, int64(1e6), p.DepositValue[config.CoinTypeBTC])
+	require.Equal(t, int64(1), p.Payouts)
+	require.Equal(t, int64(99e5), p.SkySent)
+	require.Equal(t, int64(1), p.Errors)
+	require.Equal(t, map[string]StageDuration{
+		StatusWaitDecide:     {Count: 1, Seconds: 10},
+		StatusWaitSend:       {Count: 1, Seconds: 90},
+		StatusWaitConfirm:    {Count: 1, Seconds: 200},
+		StageDepositToPayout: {Count: 1, Seconds: 100},
+	}, p.Stages)
+
+	// Deposits without history are recorded at their last update
+	updates := existingDepositStatsUpdates(di, nil)
+	for _, u := range updates {
+		require.Equal(t, di.UpdatedAt, u.Timestamp)
+	}
+	p = applyStatsUpdates(updates)
+	require.Equal(t, int64(1), p.Deposits[config.CoinTypeBTC])
+	require.Equal(t, int64(1), p.Payouts)
+	require.Empty(t, p.Stages)
+}
+
+func TestStoreStats(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	di, err := s.addDepositInfo(DepositInfo{
+		CoinType:       config.CoinTypeBTC,
+		DepositID:      "btx1:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr1",
+		DepositValue:   1e6,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitSend,
+		BuyMethod:      config.BuyMethodDirect,
+	})
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "txid"
+		di.SkySent = 99e5
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = s.addDepositInfo(DepositInfo{
+		CoinType:       config.CoinTypeETH,
+		DepositID:      "etx1:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "ethaddr1",
+		DepositValue:   5e9,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitSend,
+		BuyMethod:      config.BuyMethodDirect,
+	})
+	require.NoError(t, err)
+
+	requireStats := func() {
+		for _, interval := range StatsIntervals {
+			periods, err := s.GetStatsPeriods(interval, 0, 0)
+			require.NoError(t, err)
+
+			var p StatsPeriod
+			if len(periods) == 1 {
+				p = periods[0]
+			} else {
+				// The deposits were made across the end of a period
+				p = newStatsPeriod(0)
+				for _, x := range periods {
+					for k, v := range x.Deposits {
+						p.Deposits[k] += v
+					}
+					p.Payouts += x.Payouts
+					p.SkySent += x.SkySent
+				}
+			}
+
+			require.Equal(t, int64(1), p.Deposits[config.CoinTypeBTC])
+			require.Equal(t, int64(1), p.Deposits[config.CoinTypeETH])
+			require.Equal(t, int64(1), p.Payouts)
+			require.Equal(t, int64(99e5), p.SkySent)
+		}
+	}
+
+	requireStats()
+
+	periods, err := s.GetStatsPeriods(StatsIntervalDay, time.Now().Add(time.Hour).Unix(), 0)
+	require.NoError(t, err)
+	require.Empty(t, periods)
+
+	_, err = s.GetStatsPeriods("month", 0, 0)
+	require.Equal(t, ErrInvalidStatsInterval, err)
+
+	// Simulate a db from before the statistics were recorded
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		for _, interval := range StatsIntervals {
+			bktName, err := GetStatsBkt(interval)
+			if err != nil {
+				return err
+			}
+			if err := tx.DeleteBucket(bktName); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(bktName); err != nil {
+				return err
+			}
+		}
+		return dbutil.DeleteBucketValue(tx, ExchangeMetaBkt, statsInitializedKey)
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s.initStats())
+	requireStats()
+
+	// The existing deposits are only recorded once
+	require.NoError(t, s.initStats())
+	requireStats()
+}
@@ -1,10 +1,12 @@
 package exchange
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -13,10 +15,12 @@ import (
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/scanner"
 	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/webhook"
 )
 
 var (
-	// ExchangeMetaBkt stores metadata about the exchange (unused)
+	// ExchangeMetaBkt stores metadata about the exchange
 	ExchangeMetaBkt = []byte("exchange_meta")
 
 	// DepositInfoBkt maps a BTC transaction to a DepositInfo
@@ -28,11 +32,81 @@ var (
 	// SkyDepositSeqsIndexBkt maps a SKY address to its BTC addresses
 	SkyDepositSeqsIndexBkt = []byte("sky_deposit_seqs_index")
 
+	// DepositHistoryBkt maps a DepositID to its DepositTransitions
+	DepositHistoryBkt = []byte("deposit_history")
+
+	// DepositRetryBkt maps a DepositID to its DepositRetry, for deposits waiting to be retried
+	DepositRetryBkt = []byte("deposit_retries")
+
+	// LedgerBkt maps a sequence number to a JournalEntry
+	LedgerBkt = []byte("ledger_entries")
+
+	// StatsHourBkt, StatsDayBkt and StatsWeekBkt map the start of a period to its StatsPeriod
+	StatsHourBkt = []byte("stats_hour")
+	StatsDayBkt  = []byte("stats_day")
+	StatsWeekBkt = []byte("stats_week")
+
+	// PauseChangesBkt maps a sequence number to a PauseChange
+	PauseChangesBkt = []byte("pause_changes")
+
+	// DepositStatusIndexBkt indexes DepositInfoBkt by status, with keys "status/DepositID"
+	DepositStatusIndexBkt = []byte("deposit_status_index")
+
+	// DepositUpdatedIndexBkt indexes DepositInfoBkt by update time,
+	// with keys of the big-endian UpdatedAt followed by the DepositID
+	DepositUpdatedIndexBkt = []byte("deposit_updated_index")
+
+	// DepositCoinTypeIndexBkt indexes DepositInfoBkt by coin type, with keys "coinType/DepositID"
+	DepositCoinTypeIndexBkt = []byte("deposit_coin_type_index")
+
+	// DepositErrorIndexBkt indexes the deposits in DepositInfoBkt that have an error, by DepositID
+	DepositErrorIndexBkt = []byte("deposit_error_index")
+
+	// depositIndexBkts are the indexes of DepositInfoBkt, updated in the same transaction as it
+	depositIndexBkts = [][]byte{
+		DepositStatusIndexBkt,
+		DepositUpdatedIndexBkt,
+		DepositCoinTypeIndexBkt,
+		DepositErrorIndexBkt,
+	}
+
 	// ErrAddressAlreadyBound is returned if an address has already been bound to a SKY address
 	ErrAddressAlreadyBound = errors.New("Address already bound to a SKY address")
 )
 
-const bindAddressBktPrefix = "bind_address"
+const (
+	bindAddressBktPrefix = "bind_address"
+
+	// ledgerInitializedKey is set in ExchangeMetaBkt once the ledger has entries for the deposits made before it existed
+	ledgerInitializedKey = "ledger_initialized"
+	// statsInitializedKey is set in ExchangeMetaBkt once the statistics include the deposits made before they were recorded
+	statsInitializedKey = "stats_initialized"
+	// depositIndexesInitializedKey is set in ExchangeMetaBkt once the deposit indexes include the deposits made before they existed
+	depositIndexesInitializedKey = "deposit_indexes_initialized"
+)
+
+// GetStatsBkt returns the statistics bucket name for an interval
+func GetStatsBkt(interval string) ([]byte, error) {
+	switch interval {
+	case StatsIntervalHour:
+		return StatsHourBkt, nil
+	case StatsIntervalDay:
+		return StatsDayBkt, nil
+	case StatsIntervalWeek:
+		return StatsWeekBkt, nil
+	default:
+		return nil, ErrInvalidStatsInterval
+	}
+}
+
+// MustGetStatsBkt panics if GetStatsBkt returns an error
+func MustGetStatsBkt(interval string) []byte {
+	name, err := GetStatsBkt(interval)
+	if err != nil {
+		panic(err)
+	}
+	return name
+}
 
 // GetBindAddressBkt returns the bind_address bucket name for a given coin type
 func GetBindAddressBkt(coinType string) ([]byte, error) {
@@ -76,20 +150,71 @@ func init() {
 // Storer interface for exchange storage
 type Storer interface {
 	GetBindAddress(depositAddr, coinType string) (*BoundAddress, error)
-	BindAddress(skyAddr, depositAddr, coinType, buyMethod string) (*BoundAddress, error)
+	BindAddress(skyAddr, depositAddr, coinType, buyMethod string, expectedValue int64) (*BoundAddress, error)
 	GetOrCreateDepositInfo(scanner.Deposit, string) (DepositInfo, error)
+	GetDepositInfo(string) (DepositInfo, error)
 	GetDepositInfoArray(DepositFilter) ([]DepositInfo, error)
+	QueryDepositInfo(DepositQuery) ([]DepositInfo, error)
 	GetDepositInfoOfSkyAddress(string) ([]DepositInfo, error)
 	UpdateDepositInfo(string, func(DepositInfo) DepositInfo) (DepositInfo, error)
 	UpdateDepositInfoCallback(string, func(DepositInfo) DepositInfo, func(DepositInfo) error) (DepositInfo, error)
 	GetSkyBindAddresses(string) ([]BoundAddress, error)
+	GetBindAddresses() ([]BoundAddress, error)
+	GetUnpaidBindAddresses() ([]BoundAddress, error)
 	GetDepositStats() (*DepositStats, error)
+	GetDepositHistory(string) ([]DepositTransition, error)
+	GetDepositRetry(string) (*DepositRetry, error)
+	GetDepositRetries() ([]DepositRetry, error)
+	PutDepositRetry(DepositRetry) error
+	DeleteDepositRetry(string) error
+	AddJournalEntry(JournalEntry) (JournalEntry, error)
+	GetJournalEntries(from, to int64) ([]JournalEntry, error)
+	GetLedgerBalances(asOf int64) (LedgerBalances, error)
+	GetStatsPeriods(interval string, from, to int64) ([]StatsPeriod, error)
+	AddPauseChange(PauseChange) (PauseChange, error)
+	GetPauseChanges() ([]PauseChange, error)
+}
+
+// componentStorer is implemented by a Storer that can record
+// the component or operator responsible for a deposit's status transitions
+type componentStorer interface {
+	WithComponent(string) Storer
+	WithOperator(action, actor, reason string) Storer
+}
+
+// withComponent returns a Storer that records component in the history of the deposits
+// it updates, if the store supports it
+func withComponent(store Storer, component string) Storer {
+	if cs, ok := store.(componentStorer); ok {
+		return cs.WithComponent(component)
+	}
+	return store
+}
+
+// withOperator returns a Storer that records an operator action in the history of the deposits
+// it updates, if the store supports it
+func withOperator(store Storer, action, actor, reason string) Storer {
+	if cs, ok := store.(componentStorer); ok {
+		return cs.WithOperator(action, actor, reason)
+	}
+	return store
+}
+
+// storeActor records who is responsible for the changes made through a store
+type storeActor struct {
+	component string
+	// Set for updates made by an operator
+	action string
+	actor  string
+	reason string
 }
 
 // Store storage for exchange
 type Store struct {
-	db  *bolt.DB
-	log logrus.FieldLogger
+	storeActor
+	db     *bolt.DB
+	log    logrus.FieldLogger
+	outbox *outbox
 }
 
 // NewStore creates a Store instance
@@ -125,15 +250,176 @@ func NewStore(log logrus.FieldLogger, db *bolt.DB) (*Store, error) {
 			return dbutil.NewCreateBucketFailedErr(BtcTxsBkt, err)
 		}
 
+		if _, err := tx.CreateBucketIfNotExists(DepositHistoryBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(DepositHistoryBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(DepositRetryBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(DepositRetryBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(LedgerBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(LedgerBkt, err)
+		}
+
+		for _, interval := range StatsIntervals {
+			bktName, err := GetStatsBkt(interval)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucketIfNotExists(bktName); err != nil {
+				return dbutil.NewCreateBucketFailedErr(bktName, err)
+			}
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(PauseChangesBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(PauseChangesBkt, err)
+		}
+
+		for _, bktName := range depositIndexBkts {
+			if _, err := tx.CreateBucketIfNotExists(bktName); err != nil {
+				return dbutil.NewCreateBucketFailedErr(bktName, err)
+			}
+		}
+
+		// The webhook events are added in the same transaction as the changes they report
+		if _, err := tx.CreateBucketIfNotExists(webhook.EventsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(webhook.EventsBkt, err)
+		}
+
 		return nil
 	}); err != nil {
 		return nil, err
 	}
 
+	s := &Store{
+		db:     db,
+		log:    log.WithField("prefix", "exchange.Store"),
+		outbox: &outbox{},
+	}
+
+	if err := s.initLedger(); err != nil {
+		return nil, err
+	}
+
+	if err := s.initStats(); err != nil {
+		return nil, err
+	}
+
+	if err := s.initDepositIndexes(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// initLedger posts the journal entries of the deposits made before the ledger existed.
+// Their entries are timestamped with the deposit's last update.
+func (s *Store) initLedger() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if hasKey, err := dbutil.BucketHasKey(tx, ExchangeMetaBkt, ledgerInitializedKey); err != nil {
+			return err
+		} else if hasKey {
+			return nil
+		}
+
+		var dis []DepositInfo
+		if err := dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
+			var di DepositInfo
+			if err := json.Unmarshal(v, &di); err != nil {
+				return err
+			}
+
+			dis = append(dis, di)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		sort.Slice(dis, func(i, j int) bool {
+			return dis[i].UpdatedAt < dis[j].UpdatedAt
+		})
+
+		for _, di := range dis {
+			if err := s.addDepositJournalEntriesTx(tx, DepositInfo{}, di); err != nil {
+				return err
+			}
+		}
+
+		if len(dis) != 0 {
+			s.log.WithField("deposits", len(dis)).Info("Posted ledger entries for existing deposits")
+		}
+
+		return dbutil.PutBucketValue(tx, ExchangeMetaBkt, ledgerInitializedKey, true)
+	})
+}
+
+// initDepositIndexes indexes the deposits made before the deposit indexes existed
+func (s *Store) initDepositIndexes() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if hasKey, err := dbutil.BucketHasKey(tx, ExchangeMetaBkt, depositIndexesInitializedKey); err != nil {
+			return err
+		} else if hasKey {
+			return nil
+		}
+
+		n := 0
+		if err := dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
+			var di DepositInfo
+			if err := json.Unmarshal(v, &di); err != nil {
+				return err
+			}
+
+			n++
+			return updateDepositIndexesTx(tx, DepositInfo{}, di)
+		}); err != nil {
+			return err
+		}
+
+		if n != 0 {
+			s.log.WithField("deposits", n).Info("Indexed existing deposits")
+		}
+
+		return dbutil.PutBucketValue(tx, ExchangeMetaBkt, depositIndexesInitializedKey, true)
+	})
+}
+
+// WithComponent returns a Store sharing the same database, which records component
+// as responsible for the status transitions it makes
+func (s *Store) WithComponent(component string) Storer {
+	return &Store{
+		db:     s.db,
+		log:    s.log.WithField("component", component),
+		outbox: s.outbox,
+		storeActor: storeActor{
+			component: component,
+		},
+	}
+}
+
+// WithOperator returns a Store sharing the same database, which records an operator action
+// with its actor and reason for every deposit it updates
+func (s *Store) WithOperator(action, actor, reason string) Storer {
 	return &Store{
-		db:  db,
-		log: log.WithField("prefix", "exchange.Store"),
-	}, nil
+		db: s.db,
+		log: s.log.WithFields(logrus.Fields{
+			"component": OperatorComponent,
+			"action":    action,
+			"actor":     actor,
+		}),
+		outbox: s.outbox,
+		storeActor: storeActor{
+			component: OperatorComponent,
+			action:    action,
+			actor:     actor,
+			reason:    reason,
+		},
+	}
+}
+
+// SetWebhookEvents sets whether the store and its copies add webhook events to the outbox
+func (s *Store) SetWebhookEvents(enabled bool) {
+	s.outbox.setEnabled(enabled)
 }
 
 // GetBindAddress returns bound skycoin address of given bitcoin address.
@@ -172,11 +458,12 @@ func (s *Store) getBindAddressTx(tx *bolt.Tx, depositAddr, coinType string) (*Bo
 }
 
 // BindAddress binds a skycoin address to a deposit address
-func (s *Store) BindAddress(skyAddr, depositAddr, coinType, buyMethod string) (*BoundAddress, error) {
+func (s *Store) BindAddress(skyAddr, depositAddr, coinType, buyMethod string, expectedValue int64) (*BoundAddress, error) {
 	log := s.log.WithField("skyAddr", skyAddr)
 	log = log.WithField("depositAddr", depositAddr)
 	log = log.WithField("coinType", coinType)
 	log = log.WithField("buyMethod", buyMethod)
+	log = log.WithField("expectedValue", expectedValue)
 
 	bindBktFullName, err := GetBindAddressBkt(coinType)
 	if err != nil {
@@ -184,10 +471,12 @@ func (s *Store) BindAddress(skyAddr, depositAddr, coinType, buyMethod string) (*
 	}
 
 	boundAddr := BoundAddress{
-		SkyAddress: skyAddr,
-		Address:    depositAddr,
-		CoinType:   coinType,
-		BuyMethod:  buyMethod,
+		SkyAddress:    skyAddr,
+		Address:       depositAddr,
+		CoinType:      coinType,
+		BuyMethod:     buyMethod,
+		BoundAt:       time.Now().UTC().Unix(),
+		ExpectedValue: expectedValue,
 	}
 
 	if err := s.db.Update(func(tx *bolt.Tx) error {
@@ -218,7 +507,11 @@ func (s *Store) BindAddress(skyAddr, depositAddr, coinType, buyMethod string) (*
 			return err
 		}
 
-		return dbutil.PutBucketValue(tx, bindBktFullName, depositAddr, boundAddr)
+		if err := dbutil.PutBucketValue(tx, bindBktFullName, depositAddr, boundAddr); err != nil {
+			return err
+		}
+
+		return s.outbox.addAddressBoundEventTx(tx, boundAddr)
 	}); err != nil {
 		return nil, err
 	}
@@ -279,8 +572,9 @@ func (s *Store) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (Deposit
 				Status:         StatusWaitDecide,
 				DepositValue:   dv.Value,
 				// Save the rate at the time this deposit was noticed
-				ConversionRate: rate,
-				Deposit:        dv,
+				ConversionRate:  rate,
+				SourceAddresses: dv.SourceAddresses,
+				Deposit:         dv,
 			}
 
 			log = log.WithField("depositInfo", di)
@@ -348,7 +642,23 @@ func (s *Store) addDepositInfoTx(tx *bolt.Tx, di DepositInfo) (DepositInfo, erro
 		return di, err
 	}
 
-	if err := dbutil.PutBucketValue(tx, DepositInfoBkt, updatedDi.DepositID, updatedDi); err != nil {
+	if err := putDepositInfoTx(tx, DepositInfo{}, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := s.addDepositStatsTx(tx, DepositInfo{}, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := s.addDepositTransitionTx(tx, DepositInfo{}, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := s.addDepositJournalEntriesTx(tx, DepositInfo{}, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := s.outbox.addDepositEventsTx(tx, DepositInfo{}, updatedDi); err != nil {
 		return di, err
 	}
 
@@ -371,7 +681,7 @@ func (s *Store) addDepositInfoTx(tx *bolt.Tx, di DepositInfo) (DepositInfo, erro
 }
 
 // getDepositInfo returns deposit info of given address
-func (s *Store) getDepositInfo(btcTx string) (DepositInfo, error) {
+func (s *Store) GetDepositInfo(btcTx string) (DepositInfo, error) {
 	var di DepositInfo
 
 	err := s.db.View(func(tx *bolt.Tx) error {
@@ -418,6 +728,158 @@ func (s *Store) GetDepositInfoArray(flt DepositFilter) ([]DepositInfo, error) {
 	return dpis, nil
 }
 
+// putDepositInfoTx saves a DepositInfo that was oldDi, or is new if oldDi is empty, and updates the deposit indexes
+func putDepositInfoTx(tx *bolt.Tx, oldDi, newDi DepositInfo) error {
+	if err := dbutil.PutBucketValue(tx, DepositInfoBkt, newDi.DepositID, newDi); err != nil {
+		return err
+	}
+
+	return updateDepositIndexesTx(tx, oldDi, newDi)
+}
+
+// updateDepositIndexesTx replaces the index entries of oldDi with those of newDi.
+// If oldDi is empty, the entries of newDi are added.
+func updateDepositIndexesTx(tx *bolt.Tx, oldDi, newDi DepositInfo) error {
+	if oldDi.DepositID != "" {
+		for _, e := range depositIndexEntries(oldDi) {
+			bkt := tx.Bucket(e.bkt)
+			if bkt == nil {
+				return dbutil.NewBucketNotExistErr(e.bkt)
+			}
+
+			if err := bkt.Delete(e.key); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, e := range depositIndexEntries(newDi) {
+		bkt := tx.Bucket(e.bkt)
+		if bkt == nil {
+			return dbutil.NewBucketNotExistErr(e.bkt)
+		}
+
+		if err := bkt.Put(e.key, []byte{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QueryDepositInfo returns the deposits selected by a query, in the order they were received.
+// The deposits are looked up through the most selective index of the query.
+func (s *Store) QueryDepositInfo(q DepositQuery) ([]DepositInfo, error) {
+	var dpis []DepositInfo
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		ids, err := queryDepositIndexesTx(tx, q)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			var dpi DepositInfo
+			if err := dbutil.GetBucketObject(tx, DepositInfoBkt, id, &dpi); err != nil {
+				return err
+			}
+
+			if q.Matches(dpi) {
+				dpis = append(dpis, dpi)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(dpis, func(i, j int) bool {
+		return dpis[i].Seq < dpis[j].Seq
+	})
+
+	return dpis, nil
+}
+
+// queryDepositIndexesTx returns the DepositIDs found in the index that best narrows down a query.
+// The deposits found may not match the query's other conditions.
+func queryDepositIndexesTx(tx *bolt.Tx, q DepositQuery) ([]string, error) {
+	var ids []string
+
+	switch {
+	case q.Errored:
+		if err := dbutil.ForEach(tx, DepositErrorIndexBkt, func(k, v []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+	case len(q.Statuses) != 0:
+		seen := make(map[string]struct{}, len(q.Statuses))
+		for _, status := range q.Statuses {
+			if _, ok := seen[status]; ok {
+				continue
+			}
+			seen[status] = struct{}{}
+
+			statusIDs, err := prefixIndexIDsTx(tx, DepositStatusIndexBkt, status)
+			if err != nil {
+				return nil, err
+			}
+
+			ids = append(ids, statusIDs...)
+		}
+
+	case q.CoinType != "":
+		return prefixIndexIDsTx(tx, DepositCoinTypeIndexBkt, q.CoinType)
+
+	case q.UpdatedFrom != 0 || q.UpdatedTo != 0:
+		bkt := tx.Bucket(DepositUpdatedIndexBkt)
+		if bkt == nil {
+			return nil, dbutil.NewBucketNotExistErr(DepositUpdatedIndexBkt)
+		}
+
+		c := bkt.Cursor()
+		for k, _ := c.Seek(depositUpdatedIndexKey(q.UpdatedFrom, "")); k != nil; k, _ = c.Next() {
+			updatedAt, id := parseDepositUpdatedIndexKey(k)
+			if q.UpdatedTo != 0 && updatedAt > q.UpdatedTo {
+				break
+			}
+
+			ids = append(ids, id)
+		}
+
+	default:
+		if err := dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// prefixIndexIDsTx returns the DepositIDs indexed under value in an index bucket with "value/DepositID" keys
+func prefixIndexIDsTx(tx *bolt.Tx, bktName []byte, value string) ([]string, error) {
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return nil, dbutil.NewBucketNotExistErr(bktName)
+	}
+
+	prefix := depositPrefixIndexPrefix(value)
+
+	var ids []string
+	c := bkt.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		ids = append(ids, string(k[len(prefix):]))
+	}
+
+	return ids, nil
+}
+
 // GetDepositInfoOfSkyAddress returns all deposit info that are bound
 // to the given skycoin address
 func (s *Store) GetDepositInfoOfSkyAddress(skyAddr string) ([]DepositInfo, error) {
@@ -508,10 +970,27 @@ func (s *Store) UpdateDepositInfoCallback(btcTx string, update func(DepositInfo)
 			return err
 		}
 
+		oldDpi := dpi
 		dpi = update(dpi)
 		dpi.UpdatedAt = time.Now().UTC().Unix()
 
-		if err := dbutil.PutBucketValue(tx, DepositInfoBkt, btcTx, dpi); err != nil {
+		if err := putDepositInfoTx(tx, oldDpi, dpi); err != nil {
+			return err
+		}
+
+		if err := s.addDepositStatsTx(tx, oldDpi, dpi); err != nil {
+			return err
+		}
+
+		if err := s.addDepositTransitionTx(tx, oldDpi, dpi); err != nil {
+			return err
+		}
+
+		if err := s.addDepositJournalEntriesTx(tx, oldDpi, dpi); err != nil {
+			return err
+		}
+
+		if err := s.outbox.addDepositEventsTx(tx, oldDpi, dpi); err != nil {
 			return err
 		}
 
@@ -524,6 +1003,385 @@ func (s *Store) UpdateDepositInfoCallback(btcTx string, update func(DepositInfo)
 	return dpi, nil
 }
 
+// addDepositTransitionTx appends a DepositTransition to the deposit's history,
+// if its status, error or buy method changed, or if the change was made by an operator
+func (s *Store) addDepositTransitionTx(tx *bolt.Tx, oldDi, newDi DepositInfo) error {
+	t, ok := s.depositTransition(oldDi, newDi)
+	if !ok {
+		return nil
+	}
+
+	var history []DepositTransition
+	if err := dbutil.GetBucketObject(tx, DepositHistoryBkt, newDi.DepositID, &history); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+		default:
+			return err
+		}
+	}
+
+	history = append(history, t)
+
+	return dbutil.PutBucketValue(tx, DepositHistoryBkt, newDi.DepositID, history)
+}
+
+// depositTransition returns the DepositTransition recorded for a change of a deposit from oldDi to newDi.
+// Returns false if its status, error and buy method did not change, unless the change was made by an operator.
+func (a storeActor) depositTransition(oldDi, newDi DepositInfo) (DepositTransition, bool) {
+	if a.action == "" && oldDi.Status == newDi.Status && oldDi.Error == newDi.Error && oldDi.BuyMethod == newDi.BuyMethod {
+		return DepositTransition{}, false
+	}
+
+	return DepositTransition{
+		Timestamp:  newDi.UpdatedAt,
+		FromStatus: oldDi.Status,
+		ToStatus:   newDi.Status,
+		Component:  a.component,
+		Action:     a.action,
+		Actor:      a.actor,
+		Reason:     a.reason,
+		BuyMethod:  newDi.BuyMethod,
+		SkyAddress: newDi.SkyAddress,
+		Error:      newDi.Error,
+		Txid:       newDi.Txid,
+		OrderID:    newDi.Passthrough.Order.OrderID,
+	}, true
+}
+
+// addDepositJournalEntriesTx posts the journal entries for a change of a deposit from oldDi to newDi
+func (s *Store) addDepositJournalEntriesTx(tx *bolt.Tx, oldDi, newDi DepositInfo) error {
+	for _, e := range s.validDepositJournalEntries(s.log, oldDi, newDi) {
+		if _, err := s.addJournalEntryTx(tx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validDepositJournalEntries returns the journal entries for a change of a deposit from oldDi to newDi.
+// An invalid entry is skipped rather than failing the deposit update, which may be recording
+// coins that were already sent.
+func (a storeActor) validDepositJournalEntries(log logrus.FieldLogger, oldDi, newDi DepositInfo) []JournalEntry {
+	var entries []JournalEntry
+	for _, e := range depositJournalEntries(oldDi, newDi) {
+		e.Timestamp = newDi.UpdatedAt
+		e.Actor = a.actor
+		e.Memo = a.reason
+
+		if err := e.Validate(); err != nil {
+			log.WithError(err).WithFields(logrus.Fields{
+				"oldDepositInfo": oldDi,
+				"depositInfo":    newDi,
+				"journalEntry":   e,
+				"notice":         logger.WatchNotice,
+			}).Error("FIXME: Constructed invalid JournalEntry, it was not posted to the ledger")
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+// addJournalEntryTx validates and appends a JournalEntry to the ledger
+func (s *Store) addJournalEntryTx(tx *bolt.Tx, e JournalEntry) (JournalEntry, error) {
+	if err := e.Validate(); err != nil {
+		return e, err
+	}
+
+	seq, err := dbutil.NextSequence(tx, LedgerBkt)
+	if err != nil {
+		return e, err
+	}
+
+	e.Seq = seq
+
+	if err := dbutil.PutBucketValue(tx, LedgerBkt, strconv.FormatUint(seq, 10), e); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// AddJournalEntry appends a JournalEntry to the ledger. Its Timestamp is set to now if not set.
+func (s *Store) AddJournalEntry(e JournalEntry) (JournalEntry, error) {
+	if e.Timestamp == 0 {
+		e.Timestamp = time.Now().UTC().Unix()
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		e, err = s.addJournalEntryTx(tx, e)
+		return err
+	}); err != nil {
+		return JournalEntry{}, err
+	}
+
+	return e, nil
+}
+
+// GetJournalEntries returns the journal entries timestamped between from and to inclusive, oldest first.
+// A zero from or to is unbounded.
+func (s *Store) GetJournalEntries(from, to int64) ([]JournalEntry, error) {
+	var entries []JournalEntry
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, LedgerBkt, func(k, v []byte) error {
+			var e JournalEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			if (from != 0 && e.Timestamp < from) || (to != 0 && e.Timestamp > to) {
+				return nil
+			}
+
+			entries = append(entries, e)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sortJournalEntries(entries)
+
+	return entries, nil
+}
+
+// GetLedgerBalances returns the balance of every account as of asOf, including the entries timestamped at asOf.
+// If asOf is zero, the current balances are returned.
+func (s *Store) GetLedgerBalances(asOf int64) (LedgerBalances, error) {
+	entries, err := s.GetJournalEntries(0, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(LedgerBalances)
+	for _, e := range entries {
+		balances.add(e)
+	}
+
+	return balances, nil
+}
+
+// initStats records the statistics of the deposits made before the statistics were recorded
+func (s *Store) initStats() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if hasKey, err := dbutil.BucketHasKey(tx, ExchangeMetaBkt, statsInitializedKey); err != nil {
+			return err
+		} else if hasKey {
+			return nil
+		}
+
+		var updates []statsUpdate
+		if err := dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
+			var di DepositInfo
+			if err := json.Unmarshal(v, &di); err != nil {
+				return err
+			}
+
+			history, err := s.getDepositHistoryTx(tx, di.DepositID)
+			if err != nil {
+				return err
+			}
+
+			updates = append(updates, existingDepositStatsUpdates(di, history)...)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := s.applyStatsTx(tx, updates); err != nil {
+			return err
+		}
+
+		return dbutil.PutBucketValue(tx, ExchangeMetaBkt, statsInitializedKey, true)
+	})
+}
+
+// addDepositStatsTx records the statistics for a change of a deposit from oldDi to newDi.
+// It must be called before the change is added to the deposit's history.
+func (s *Store) addDepositStatsTx(tx *bolt.Tx, oldDi, newDi DepositInfo) error {
+	var history []DepositTransition
+	if oldDi.DepositID != "" {
+		var err error
+		history, err = s.getDepositHistoryTx(tx, newDi.DepositID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.applyStatsTx(tx, depositStatsUpdates(oldDi, newDi, history))
+}
+
+// applyStatsTx applies statistics updates to the periods of every interval
+func (s *Store) applyStatsTx(tx *bolt.Tx, updates []statsUpdate) error {
+	for _, interval := range StatsIntervals {
+		bktName, err := GetStatsBkt(interval)
+		if err != nil {
+			return err
+		}
+
+		periods := make(map[int64]*StatsPeriod)
+		for _, u := range updates {
+			start, err := statsPeriodStart(interval, u.Timestamp)
+			if err != nil {
+				return err
+			}
+
+			p, ok := periods[start]
+			if !ok {
+				period := newStatsPeriod(start)
+				if err := dbutil.GetBucketObject(tx, bktName, strconv.FormatInt(start, 10), &period); err != nil {
+					switch err.(type) {
+					case dbutil.ObjectNotExistErr:
+					default:
+						return err
+					}
+				}
+				p = &period
+				periods[start] = p
+			}
+
+			u.Apply(p)
+		}
+
+		for start, p := range periods {
+			if err := dbutil.PutBucketValue(tx, bktName, strconv.FormatInt(start, 10), p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetStatsPeriods returns the statistics of an interval's periods that start between from and to inclusive, oldest first.
+// A zero from or to is unbounded. Periods without activity are omitted.
+func (s *Store) GetStatsPeriods(interval string, from, to int64) ([]StatsPeriod, error) {
+	bktName, err := GetStatsBkt(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	var periods []StatsPeriod
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, bktName, func(k, v []byte) error {
+			var p StatsPeriod
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+
+			if (from != 0 && p.Start < from) || (to != 0 && p.Start > to) {
+				return nil
+			}
+
+			periods = append(periods, p)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].Start < periods[j].Start
+	})
+
+	return periods, nil
+}
+
+// GetDepositHistory returns the status transitions of a deposit, oldest first.
+// Deposits created before the history was recorded have no history.
+func (s *Store) GetDepositHistory(depositID string) ([]DepositTransition, error) {
+	var history []DepositTransition
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		history, err = s.getDepositHistoryTx(tx, depositID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// getDepositHistoryTx returns the status transitions of a deposit, oldest first
+func (s *Store) getDepositHistoryTx(tx *bolt.Tx, depositID string) ([]DepositTransition, error) {
+	var history []DepositTransition
+
+	if err := dbutil.GetBucketObject(tx, DepositHistoryBkt, depositID, &history); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return history, nil
+}
+
+// GetDepositRetry returns the DepositRetry of a deposit, or nil if the deposit is not waiting to be retried
+func (s *Store) GetDepositRetry(depositID string) (*DepositRetry, error) {
+	var dr DepositRetry
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.GetBucketObject(tx, DepositRetryBkt, depositID, &dr)
+	}); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &dr, nil
+}
+
+// GetDepositRetries returns all DepositRetries
+func (s *Store) GetDepositRetries() ([]DepositRetry, error) {
+	var drs []DepositRetry
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, DepositRetryBkt, func(k, v []byte) error {
+			var dr DepositRetry
+			if err := json.Unmarshal(v, &dr); err != nil {
+				return err
+			}
+
+			drs = append(drs, dr)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return drs, nil
+}
+
+// PutDepositRetry saves a DepositRetry
+func (s *Store) PutDepositRetry(dr DepositRetry) error {
+	if dr.DepositID == "" {
+		return errors.New("DepositRetry.DepositID missing")
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, DepositRetryBkt, dr.DepositID, dr)
+	})
+}
+
+// DeleteDepositRetry deletes the DepositRetry of a deposit
+func (s *Store) DeleteDepositRetry(depositID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.DeleteBucketValue(tx, DepositRetryBkt, depositID)
+	})
+}
+
 // GetSkyBindAddresses returns the addresses of the given sky address bound
 func (s *Store) GetSkyBindAddresses(skyAddr string) ([]BoundAddress, error) {
 	var boundAddrs []BoundAddress
@@ -557,15 +1415,105 @@ func (s *Store) getSkyBindAddressesTx(tx *bolt.Tx, skyAddr string) ([]BoundAddre
 	return addrs, nil
 }
 
-// GetDepositStats returns SKY sent and amounts received per coin type
-func (s *Store) GetDepositStats() (*DepositStats, error) {
-	var skySent int64
-	received := make(map[string]int64, len(config.CoinTypes))
+// GetBindAddresses returns all bound addresses of all coin types
+func (s *Store) GetBindAddresses() ([]BoundAddress, error) {
+	var boundAddrs []BoundAddress
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		for _, ct := range config.CoinTypes {
+			if err := dbutil.ForEach(tx, MustGetBindAddressBkt(ct), func(k, v []byte) error {
+				var ba BoundAddress
+				if err := json.Unmarshal(v, &ba); err != nil {
+					return err
+				}
+
+				boundAddrs = append(boundAddrs, ba)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return boundAddrs, nil
+}
+
+// GetUnpaidBindAddresses returns the bound addresses of all coin types that have not received a deposit
+func (s *Store) GetUnpaidBindAddresses() ([]BoundAddress, error) {
+	var boundAddrs []BoundAddress
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		for _, ct := range config.CoinTypes {
+			if err := dbutil.ForEach(tx, MustGetBindAddressBkt(ct), func(k, v []byte) error {
+				var ba BoundAddress
+				if err := json.Unmarshal(v, &ba); err != nil {
+					return err
+				}
 
-	for _, k := range config.CoinTypes {
-		received[k] = 0
+				paid, err := dbutil.BucketHasKey(tx, BtcTxsBkt, ba.Address)
+				if err != nil {
+					return err
+				}
+
+				if !paid {
+					boundAddrs = append(boundAddrs, ba)
+				}
+
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return boundAddrs, nil
+}
+
+// GetBoundSkyAddresses returns the SKY addresses bound in db.
+// It only reads db, so it can be used on an exported teller database opened read-only.
+func GetBoundSkyAddresses(db *bolt.DB) ([]string, error) {
+	seen := make(map[string]struct{})
+	var skyAddrs []string
+
+	if err := db.View(func(tx *bolt.Tx) error {
+		for _, ct := range config.CoinTypes {
+			if err := dbutil.ForEach(tx, MustGetBindAddressBkt(ct), func(k, v []byte) error {
+				var ba BoundAddress
+				if err := json.Unmarshal(v, &ba); err != nil {
+					return err
+				}
+
+				if _, ok := seen[ba.SkyAddress]; !ok {
+					seen[ba.SkyAddress] = struct{}{}
+					skyAddrs = append(skyAddrs, ba.SkyAddress)
+				}
+
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
+	return skyAddrs, nil
+}
+
+// GetDepositStats returns SKY sent, amounts received per coin type and passthrough order totals
+func (s *Store) GetDepositStats() (*DepositStats, error) {
+	stats := newDepositStats()
+
 	if err := s.db.View(func(tx *bolt.Tx) error {
 		return dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
 			var dpi DepositInfo
@@ -573,17 +1521,61 @@ func (s *Store) GetDepositStats() (*DepositStats, error) {
 				return err
 			}
 
-			received[dpi.CoinType] += dpi.DepositValue
-			skySent += int64(dpi.SkySent)
+			stats.add(dpi)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// AddPauseChange appends a PauseChange to the pause changes. Its Timestamp is set to now if not set.
+func (s *Store) AddPauseChange(c PauseChange) (PauseChange, error) {
+	if err := ValidatePause(c.Target, c.CoinType); err != nil {
+		return PauseChange{}, err
+	}
+
+	if c.Timestamp == 0 {
+		c.Timestamp = time.Now().UTC().Unix()
+	}
 
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		seq, err := dbutil.NextSequence(tx, PauseChangesBkt)
+		if err != nil {
+			return err
+		}
+
+		c.Seq = seq
+
+		return dbutil.PutBucketValue(tx, PauseChangesBkt, strconv.FormatUint(seq, 10), c)
+	}); err != nil {
+		return PauseChange{}, err
+	}
+
+	return c, nil
+}
+
+// GetPauseChanges returns all pause changes, oldest first
+func (s *Store) GetPauseChanges() ([]PauseChange, error) {
+	var changes []PauseChange
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, PauseChangesBkt, func(k, v []byte) error {
+			var c PauseChange
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+
+			changes = append(changes, c)
 			return nil
 		})
 	}); err != nil {
 		return nil, err
 	}
 
-	return &DepositStats{
-		Sent:     skySent,
-		Received: received,
-	}, nil
+	sortPauseChanges(changes)
+
+	return changes, nil
 }
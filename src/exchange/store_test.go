@@ -1,7 +1,9 @@
 package exchange
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/stretchr/testify/mock"
@@ -11,6 +13,7 @@ import (
 	"github.com/skycoin/teller/src/scanner"
 	"github.com/skycoin/teller/src/util/dbutil"
 	"github.com/skycoin/teller/src/util/testutil"
+	"github.com/skycoin/teller/src/webhook"
 )
 
 type MockStore struct {
@@ -28,8 +31,8 @@ func (m *MockStore) GetBindAddress(btcAddr, coinType string) (*BoundAddress, err
 	return ba.(*BoundAddress), args.Error(1)
 }
 
-func (m *MockStore) BindAddress(skyAddr, btcAddr, coinType, buyMethod string) (*BoundAddress, error) {
-	args := m.Called(skyAddr, btcAddr, coinType, buyMethod)
+func (m *MockStore) BindAddress(skyAddr, btcAddr, coinType, buyMethod string, expectedValue int64) (*BoundAddress, error) {
+	args := m.Called(skyAddr, btcAddr, coinType, buyMethod, expectedValue)
 
 	ba := args.Get(0)
 	if ba == nil {
@@ -44,6 +47,11 @@ func (m *MockStore) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (Dep
 	return args.Get(0).(DepositInfo), args.Error(1)
 }
 
+func (m *MockStore) GetDepositInfo(depositID string) (DepositInfo, error) {
+	args := m.Called(depositID)
+	return args.Get(0).(DepositInfo), args.Error(1)
+}
+
 func (m *MockStore) GetDepositInfoArray(filt DepositFilter) ([]DepositInfo, error) {
 	args := m.Called(filt)
 
@@ -55,6 +63,17 @@ func (m *MockStore) GetDepositInfoArray(filt DepositFilter) ([]DepositInfo, erro
 	return dis.([]DepositInfo), args.Error(1)
 }
 
+func (m *MockStore) QueryDepositInfo(q DepositQuery) ([]DepositInfo, error) {
+	args := m.Called(q)
+
+	dis := args.Get(0)
+	if dis == nil {
+		return nil, args.Error(1)
+	}
+
+	return dis.([]DepositInfo), args.Error(1)
+}
+
 func (m *MockStore) GetDepositInfoOfSkyAddress(skyAddr string) ([]DepositInfo, error) {
 	args := m.Called(skyAddr)
 
@@ -92,6 +111,125 @@ func (m *MockStore) GetDepositStats() (*DepositStats, error) {
 	return args.Get(0).(*DepositStats), args.Error(2)
 }
 
+func (m *MockStore) GetDepositHistory(depositID string) ([]DepositTransition, error) {
+	args := m.Called(depositID)
+
+	history := args.Get(0)
+	if history == nil {
+		return nil, args.Error(1)
+	}
+
+	return history.([]DepositTransition), args.Error(1)
+}
+
+func (m *MockStore) GetBindAddresses() ([]BoundAddress, error) {
+	args := m.Called()
+
+	addrs := args.Get(0)
+	if addrs == nil {
+		return nil, args.Error(1)
+	}
+
+	return addrs.([]BoundAddress), args.Error(1)
+}
+
+func (m *MockStore) GetUnpaidBindAddresses() ([]BoundAddress, error) {
+	args := m.Called()
+
+	addrs := args.Get(0)
+	if addrs == nil {
+		return nil, args.Error(1)
+	}
+
+	return addrs.([]BoundAddress), args.Error(1)
+}
+
+func (m *MockStore) GetDepositRetry(depositID string) (*DepositRetry, error) {
+	args := m.Called(depositID)
+
+	dr := args.Get(0)
+	if dr == nil {
+		return nil, args.Error(1)
+	}
+
+	return dr.(*DepositRetry), args.Error(1)
+}
+
+func (m *MockStore) GetDepositRetries() ([]DepositRetry, error) {
+	args := m.Called()
+
+	drs := args.Get(0)
+	if drs == nil {
+		return nil, args.Error(1)
+	}
+
+	return drs.([]DepositRetry), args.Error(1)
+}
+
+func (m *MockStore) PutDepositRetry(dr DepositRetry) error {
+	args := m.Called(dr)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteDepositRetry(depositID string) error {
+	args := m.Called(depositID)
+	return args.Error(0)
+}
+
+func (m *MockStore) AddJournalEntry(e JournalEntry) (JournalEntry, error) {
+	args := m.Called(e)
+	return args.Get(0).(JournalEntry), args.Error(1)
+}
+
+func (m *MockStore) GetJournalEntries(from, to int64) ([]JournalEntry, error) {
+	args := m.Called(from, to)
+
+	entries := args.Get(0)
+	if entries == nil {
+		return nil, args.Error(1)
+	}
+
+	return entries.([]JournalEntry), args.Error(1)
+}
+
+func (m *MockStore) GetLedgerBalances(asOf int64) (LedgerBalances, error) {
+	args := m.Called(asOf)
+
+	balances := args.Get(0)
+	if balances == nil {
+		return nil, args.Error(1)
+	}
+
+	return balances.(LedgerBalances), args.Error(1)
+}
+
+func (m *MockStore) GetStatsPeriods(interval string, from, to int64) ([]StatsPeriod, error) {
+	args := m.Called(interval, from, to)
+
+	periods := args.Get(0)
+	if periods == nil {
+		return nil, args.Error(1)
+	}
+
+	return periods.([]StatsPeriod), args.Error(1)
+}
+
+func (m *MockStore) AddPauseChange(c PauseChange) (PauseChange, error) {
+	args := m.Called(c)
+	return args.Get(0).(PauseChange), args.Error(1)
+}
+
+func (m *MockStore) GetPauseChanges() ([]PauseChange, error) {
+	args := m.Called()
+
+	changes := args.Get(0)
+	if changes == nil {
+		return nil, args.Error(1)
+	}
+
+	return changes.([]PauseChange), args.Error(1)
+}
+
 func newTestStore(t *testing.T) (*Store, func()) {
 	db, shutdown := testutil.PrepareDB(t)
 
@@ -115,6 +253,12 @@ func TestStoreNewStore(t *testing.T) {
 		require.NotNil(t, tx.Bucket(MustGetBindAddressBkt(config.CoinTypeSKY)))
 		require.NotNil(t, tx.Bucket(SkyDepositSeqsIndexBkt))
 		require.NotNil(t, tx.Bucket(BtcTxsBkt))
+		require.NotNil(t, tx.Bucket(DepositHistoryBkt))
+		require.NotNil(t, tx.Bucket(DepositRetryBkt))
+		for _, bkt := range depositIndexBkts {
+			require.NotNil(t, tx.Bucket(bkt))
+		}
+		require.NotNil(t, tx.Bucket(webhook.EventsBkt))
 		return nil
 	})
 	require.NoError(t, err)
@@ -192,7 +336,7 @@ func TestStoreAddDepositInfo(t *testing.T) {
 }
 
 func mustBindAddress(t *testing.T, s Storer, skyAddr, addr string) {
-	boundAddr, err := s.BindAddress(skyAddr, addr, config.CoinTypeBTC, config.BuyMethodDirect)
+	boundAddr, err := s.BindAddress(skyAddr, addr, config.CoinTypeBTC, config.BuyMethodDirect, 0)
 	require.NoError(t, err)
 	require.NotNil(t, boundAddr)
 	require.Equal(t, skyAddr, boundAddr.SkyAddress)
@@ -201,6 +345,20 @@ func mustBindAddress(t *testing.T, s Storer, skyAddr, addr string) {
 	require.Equal(t, config.BuyMethodDirect, boundAddr.BuyMethod)
 }
 
+// requireBoundNow checks that an address was bound in the last minute and returns it with BoundAt cleared
+func requireBoundNow(t *testing.T, ba BoundAddress) BoundAddress {
+	require.WithinDuration(t, time.Now(), time.Unix(ba.BoundAt, 0), time.Minute)
+	ba.BoundAt = 0
+	return ba
+}
+
+func requireAllBoundNow(t *testing.T, bas []BoundAddress) []BoundAddress {
+	for i := range bas {
+		bas[i] = requireBoundNow(t, bas[i])
+	}
+	return bas
+}
+
 func TestStoreBindAddress(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
@@ -218,7 +376,7 @@ func TestStoreBindAddress(t *testing.T) {
 			Address:    "ba1",
 			CoinType:   config.CoinTypeBTC,
 			BuyMethod:  config.BuyMethodDirect,
-		}, ba)
+		}, requireBoundNow(t, ba))
 
 		var addrs []BoundAddress
 		err = dbutil.GetBucketObject(tx, SkyDepositSeqsIndexBkt, "sa1", &addrs)
@@ -228,7 +386,7 @@ func TestStoreBindAddress(t *testing.T) {
 			Address:    "ba1",
 			CoinType:   config.CoinTypeBTC,
 			BuyMethod:  config.BuyMethodDirect,
-		}, addrs[0])
+		}, requireBoundNow(t, addrs[0]))
 
 		return nil
 	})
@@ -244,12 +402,12 @@ func TestStoreBindAddressTwiceFails(t *testing.T) {
 
 	mustBindAddress(t, s, "a", "b")
 
-	boundAddr, err := s.BindAddress("a", "b", config.CoinTypeBTC, config.BuyMethodDirect)
+	boundAddr, err := s.BindAddress("a", "b", config.CoinTypeBTC, config.BuyMethodDirect, 0)
 	require.Error(t, err)
 	require.Equal(t, ErrAddressAlreadyBound, err)
 	require.Nil(t, boundAddr)
 
-	boundAddr, err = s.BindAddress("c", "b", config.CoinTypeBTC, config.BuyMethodDirect)
+	boundAddr, err = s.BindAddress("c", "b", config.CoinTypeBTC, config.BuyMethodDirect, 0)
 	require.Error(t, err)
 	require.Equal(t, ErrAddressAlreadyBound, err)
 	require.Nil(t, boundAddr)
@@ -312,7 +470,7 @@ func TestStoreGetBindAddress(t *testing.T) {
 					Address:    tc.btcAddr,
 					CoinType:   config.CoinTypeBTC,
 					BuyMethod:  config.BuyMethodDirect,
-				}, *addr)
+				}, requireBoundNow(t, *addr))
 			} else {
 				require.Nil(t, addr)
 			}
@@ -320,6 +478,81 @@ func TestStoreGetBindAddress(t *testing.T) {
 	}
 }
 
+func TestStoreGetBindAddresses(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	addrs, err := s.GetBindAddresses()
+	require.NoError(t, err)
+	require.Empty(t, addrs)
+
+	mustBindAddress(t, s, "skyaddr1", "btcaddr1")
+	mustBindAddress(t, s, "skyaddr2", "btcaddr2")
+
+	_, err = s.BindAddress("skyaddr1", "ethaddr1", config.CoinTypeETH, config.BuyMethodDirect, 0)
+	require.NoError(t, err)
+
+	addrs, err = s.GetBindAddresses()
+	require.NoError(t, err)
+	require.Equal(t, []BoundAddress{
+		{
+			SkyAddress: "skyaddr1",
+			Address:    "btcaddr1",
+			CoinType:   config.CoinTypeBTC,
+			BuyMethod:  config.BuyMethodDirect,
+		},
+		{
+			SkyAddress: "skyaddr2",
+			Address:    "btcaddr2",
+			CoinType:   config.CoinTypeBTC,
+			BuyMethod:  config.BuyMethodDirect,
+		},
+		{
+			SkyAddress: "skyaddr1",
+			Address:    "ethaddr1",
+			CoinType:   config.CoinTypeETH,
+			BuyMethod:  config.BuyMethodDirect,
+		},
+	}, requireAllBoundNow(t, addrs))
+
+	skyAddrs, err := GetBoundSkyAddresses(s.db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"skyaddr1", "skyaddr2"}, skyAddrs)
+}
+
+func TestStoreGetUnpaidBindAddresses(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	addrs, err := s.GetUnpaidBindAddresses()
+	require.NoError(t, err)
+	require.Empty(t, addrs)
+
+	mustBindAddress(t, s, "skyaddr1", "btcaddr1")
+	mustBindAddress(t, s, "skyaddr2", "btcaddr2")
+
+	_, err = s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: config.CoinTypeBTC,
+		Address:  "btcaddr1",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "btx1",
+		N:        1,
+	}, testSkyBtcRate)
+	require.NoError(t, err)
+
+	addrs, err = s.GetUnpaidBindAddresses()
+	require.NoError(t, err)
+	require.Equal(t, []BoundAddress{
+		{
+			SkyAddress: "skyaddr2",
+			Address:    "btcaddr2",
+			CoinType:   config.CoinTypeBTC,
+			BuyMethod:  config.BuyMethodDirect,
+		},
+	}, requireAllBoundNow(t, addrs))
+}
+
 func TestStoreGetDepositInfo(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
@@ -337,7 +570,7 @@ func TestStoreGetDepositInfo(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	dpi, err := s.getDepositInfo("btx1:1")
+	dpi, err := s.GetDepositInfo("btx1:1")
 	require.NoError(t, err)
 	require.Equal(t, "btcaddr1", dpi.DepositAddress)
 	require.Equal(t, "skyaddr1", dpi.SkyAddress)
@@ -425,6 +658,156 @@ func TestStoreUpdateDepositInfo(t *testing.T) {
 	// TODO: test no exist deposit info
 }
 
+func TestStoreDepositHistory(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	// Deposits without history return an empty history
+	history, err := s.GetDepositHistory("btx1:1")
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	di, err := s.addDepositInfo(DepositInfo{
+		DepositID:      "btx1:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr1",
+		DepositValue:   1e6,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitDecide,
+		BuyMethod:      config.BuyMethodDirect,
+	})
+	require.NoError(t, err)
+
+	send := s.WithComponent("send")
+
+	_, err = send.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+
+	// Updates that don't change the status, error or buy method are not recorded
+	_, err = send.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.ConversionRate = "200"
+		return di
+	})
+	require.NoError(t, err)
+
+	// Updates rolled back by the callback are not recorded
+	callbackErr := errors.New("broadcast failed")
+	_, err = send.UpdateDepositInfoCallback(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "txid-1"
+		return di
+	}, func(di DepositInfo) error {
+		return callbackErr
+	})
+	require.Equal(t, callbackErr, err)
+
+	final, err := send.UpdateDepositInfoCallback(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "txid-2"
+		return di
+	}, func(di DepositInfo) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Operator updates are recorded even if the status does not change
+	operated, err := s.WithOperator(OperatorActionSetSkyAddress, "alice", "wrong address").UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.SkyAddress = "skyaddr2"
+		return di
+	})
+	require.NoError(t, err)
+
+	history, err = s.GetDepositHistory(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, []DepositTransition{
+		{
+			Timestamp:  di.UpdatedAt,
+			FromStatus: "",
+			ToStatus:   StatusWaitDecide,
+			BuyMethod:  config.BuyMethodDirect,
+			SkyAddress: "skyaddr1",
+		},
+		{
+			Timestamp:  history[1].Timestamp,
+			FromStatus: StatusWaitDecide,
+			ToStatus:   StatusWaitSend,
+			Component:  "send",
+			BuyMethod:  config.BuyMethodDirect,
+			SkyAddress: "skyaddr1",
+		},
+		{
+			Timestamp:  final.UpdatedAt,
+			FromStatus: StatusWaitSend,
+			ToStatus:   StatusWaitConfirm,
+			Component:  "send",
+			BuyMethod:  config.BuyMethodDirect,
+			SkyAddress: "skyaddr1",
+			Txid:       "txid-2",
+		},
+		{
+			Timestamp:  operated.UpdatedAt,
+			FromStatus: StatusWaitConfirm,
+			ToStatus:   StatusWaitConfirm,
+			Component:  OperatorComponent,
+			Action:     OperatorActionSetSkyAddress,
+			Actor:      "alice",
+			Reason:     "wrong address",
+			BuyMethod:  config.BuyMethodDirect,
+			SkyAddress: "skyaddr2",
+			Txid:       "txid-2",
+		},
+	}, history)
+}
+
+func TestStoreDepositRetry(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	dr, err := s.GetDepositRetry("btx1:1")
+	require.NoError(t, err)
+	require.Nil(t, dr)
+
+	drs, err := s.GetDepositRetries()
+	require.NoError(t, err)
+	require.Empty(t, drs)
+
+	err = s.PutDepositRetry(DepositRetry{})
+	require.Error(t, err)
+
+	retry := DepositRetry{
+		DepositID:     "btx1:1",
+		Status:        StatusWaitSend,
+		Component:     "send",
+		Attempts:      2,
+		NextAttemptAt: 1522494557,
+		LastError:     "skycoin node unavailable",
+	}
+	err = s.PutDepositRetry(retry)
+	require.NoError(t, err)
+
+	dr, err = s.GetDepositRetry("btx1:1")
+	require.NoError(t, err)
+	require.Equal(t, &retry, dr)
+
+	drs, err = s.GetDepositRetries()
+	require.NoError(t, err)
+	require.Equal(t, []DepositRetry{retry}, drs)
+
+	err = s.DeleteDepositRetry("btx1:1")
+	require.NoError(t, err)
+
+	dr, err = s.GetDepositRetry("btx1:1")
+	require.NoError(t, err)
+	require.Nil(t, dr)
+
+	// Deleting a missing retry is not an error
+	err = s.DeleteDepositRetry("btx1:1")
+	require.NoError(t, err)
+}
+
 func TestStoreGetDepositInfoOfSkyAddress(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
@@ -541,6 +924,126 @@ func TestStoreGetDepositInfoArray(t *testing.T) {
 	require.Equal(t, dpis[1].SkyAddress, ds1[0].SkyAddress)
 }
 
+// putTestDeposits saves deposits as they are, including their UpdatedAt
+func putTestDeposits(t *testing.T, s *Store, dis []DepositInfo) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, di := range dis {
+			if err := putDepositInfoTx(tx, DepositInfo{}, di); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+// requireQueried checks the DepositIDs of the deposits a query selects
+func requireQueried(t *testing.T, s Storer, q DepositQuery, ids ...string) {
+	dis, err := s.QueryDepositInfo(q)
+	require.NoError(t, err)
+
+	var found []string
+	for _, di := range dis {
+		found = append(found, di.DepositID)
+	}
+	require.Equal(t, ids, found)
+}
+
+func TestStoreQueryDepositInfo(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	putTestDeposits(t, s, []DepositInfo{
+		{Seq: 1, DepositID: "t1:1", CoinType: config.CoinTypeBTC, Status: StatusWaitSend, UpdatedAt: 300},
+		{Seq: 2, DepositID: "t2:1", CoinType: config.CoinTypeETH, Status: StatusWaitConfirm, UpdatedAt: 100},
+		{Seq: 3, DepositID: "t3:1", CoinType: config.CoinTypeBTC, Status: StatusDone, UpdatedAt: 200},
+		{Seq: 4, DepositID: "t4:1", CoinType: config.CoinTypeBTC, Status: StatusWaitSend, UpdatedAt: 200, Error: "failed"},
+	})
+
+	requireQueried(t, s, DepositQuery{}, "t1:1", "t2:1", "t3:1", "t4:1")
+	requireQueried(t, s, DepositQuery{Statuses: []string{StatusWaitSend}}, "t1:1", "t4:1")
+	requireQueried(t, s, DepositQuery{Statuses: []string{StatusDone, StatusWaitConfirm, StatusDone}}, "t2:1", "t3:1")
+	requireQueried(t, s, DepositQuery{Statuses: []string{StatusWaitDecide}})
+	requireQueried(t, s, DepositQuery{CoinType: config.CoinTypeETH}, "t2:1")
+	requireQueried(t, s, DepositQuery{Errored: true}, "t4:1")
+	requireQueried(t, s, DepositQuery{UpdatedFrom: 200}, "t1:1", "t3:1", "t4:1")
+	requireQueried(t, s, DepositQuery{UpdatedTo: 200}, "t2:1", "t3:1", "t4:1")
+	requireQueried(t, s, DepositQuery{UpdatedFrom: 150, UpdatedTo: 250}, "t3:1", "t4:1")
+
+	// Conditions not covered by the index used are applied to the deposits found
+	requireQueried(t, s, DepositQuery{Statuses: []string{StatusWaitSend}, UpdatedTo: 250}, "t4:1")
+	requireQueried(t, s, DepositQuery{CoinType: config.CoinTypeBTC, Errored: true}, "t4:1")
+
+	// The indexes follow the updates of the deposits
+	_, err := s.UpdateDepositInfo("t4:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		di.Error = ""
+		return di
+	})
+	require.NoError(t, err)
+
+	requireQueried(t, s, DepositQuery{Statuses: []string{StatusWaitSend}}, "t1:1")
+	requireQueried(t, s, DepositQuery{Statuses: []string{StatusDone}}, "t3:1", "t4:1")
+	requireQueried(t, s, DepositQuery{Errored: true})
+	requireQueried(t, s, DepositQuery{UpdatedTo: 250}, "t2:1", "t3:1")
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		for _, bkt := range []struct {
+			name []byte
+			n    int
+		}{
+			{DepositStatusIndexBkt, 4},
+			{DepositUpdatedIndexBkt, 4},
+			{DepositCoinTypeIndexBkt, 4},
+			{DepositErrorIndexBkt, 0},
+		} {
+			require.Equal(t, bkt.n, dbutil.BucketKeyCount(tx, bkt.name), string(bkt.name))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestStoreInitDepositIndexes(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	putTestDeposits(t, s, []DepositInfo{
+		{Seq: 1, DepositID: "t1:1", CoinType: config.CoinTypeBTC, Status: StatusWaitSend, UpdatedAt: 100},
+		{Seq: 2, DepositID: "t2:1", CoinType: config.CoinTypeSKY, Status: StatusFailed, UpdatedAt: 200, Error: "failed"},
+	})
+
+	// Simulate a db from before the deposit indexes existed
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, bkt := range depositIndexBkts {
+			if err := tx.DeleteBucket(bkt); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(bkt); err != nil {
+				return err
+			}
+		}
+		return dbutil.DeleteBucketValue(tx, ExchangeMetaBkt, depositIndexesInitializedKey)
+	})
+	require.NoError(t, err)
+	requireQueried(t, s, DepositQuery{Statuses: []string{StatusWaitSend}})
+
+	require.NoError(t, s.initDepositIndexes())
+
+	requireQueried(t, s, DepositQuery{Statuses: []string{StatusWaitSend}}, "t1:1")
+	requireQueried(t, s, DepositQuery{CoinType: config.CoinTypeSKY}, "t2:1")
+	requireQueried(t, s, DepositQuery{Errored: true}, "t2:1")
+	requireQueried(t, s, DepositQuery{UpdatedFrom: 150}, "t2:1")
+
+	// The existing deposits are only indexed once
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(DepositErrorIndexBkt).Delete([]byte("t2:1"))
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.initDepositIndexes())
+	requireQueried(t, s, DepositQuery{Errored: true})
+}
+
 func TestStoreIsValidBtcTx(t *testing.T) {
 	cases := []struct {
 		name  string
@@ -613,7 +1116,7 @@ func TestStoreGetOrCreateDepositInfoAlreadyExists(t *testing.T) {
 	require.NoError(t, err)
 
 	// Check the saved deposit info
-	foundDi, err := s.getDepositInfo(di.DepositID)
+	foundDi, err := s.GetDepositInfo(di.DepositID)
 	require.NoError(t, err)
 	// Seq and UpdatedAt should be set by addDepositInfo
 	require.Equal(t, uint64(1), foundDi.Seq)
@@ -644,6 +1147,32 @@ func TestStoreGetOrCreateDepositInfoAlreadyExists(t *testing.T) {
 	require.Equal(t, di, existsDi)
 }
 
+func TestStoreGetOrCreateDepositInfoSourceAddresses(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	_, err := s.BindAddress("foo-sky-addr", "foo-btc-addr", config.CoinTypeBTC, config.BuyMethodDirect, 0)
+	require.NoError(t, err)
+
+	dv := scanner.Deposit{
+		CoinType:        config.CoinTypeBTC,
+		Address:         "foo-btc-addr",
+		Value:           1e6,
+		Height:          20,
+		Tx:              "foo-tx",
+		N:               1,
+		SourceAddresses: []string{"foo-source-addr-1", "foo-source-addr-2"},
+	}
+
+	di, err := s.GetOrCreateDepositInfo(dv, testSkyBtcRate)
+	require.NoError(t, err)
+	require.Equal(t, dv.SourceAddresses, di.SourceAddresses)
+
+	foundDi, err := s.GetDepositInfo(dv.ID())
+	require.NoError(t, err)
+	require.Equal(t, dv.SourceAddresses, foundDi.SourceAddresses)
+}
+
 func TestStoreGetOrCreateDepositInfoNoBoundSkyAddr(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
@@ -674,7 +1203,7 @@ func TestStoreGetSkyBindAddresses(t *testing.T) {
 	addrs, err = s.GetSkyBindAddresses(skyAddr)
 	require.NoError(t, err)
 	require.Len(t, addrs, 1)
-	require.Equal(t, addrs[0], BoundAddress{
+	require.Equal(t, requireBoundNow(t, addrs[0]), BoundAddress{
 		Address:    btcAddr1,
 		SkyAddress: skyAddr,
 		BuyMethod:  config.BuyMethodDirect,
@@ -687,16 +1216,107 @@ func TestStoreGetSkyBindAddresses(t *testing.T) {
 	addrs, err = s.GetSkyBindAddresses(skyAddr)
 	require.NoError(t, err)
 	require.Len(t, addrs, 2)
-	require.Equal(t, addrs[0], BoundAddress{
+	require.Equal(t, requireBoundNow(t, addrs[0]), BoundAddress{
 		Address:    btcAddr1,
 		SkyAddress: skyAddr,
 		BuyMethod:  config.BuyMethodDirect,
 		CoinType:   config.CoinTypeBTC,
 	})
-	require.Equal(t, addrs[1], BoundAddress{
+	require.Equal(t, requireBoundNow(t, addrs[1]), BoundAddress{
 		Address:    btcAddr2,
 		SkyAddress: skyAddr,
 		BuyMethod:  config.BuyMethodDirect,
 		CoinType:   config.CoinTypeBTC,
 	})
 }
+
+func TestStoreGetDepositStats(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	dpis := []DepositInfo{
+		{
+			DepositID:      "t1:1",
+			CoinType:       config.CoinTypeBTC,
+			DepositAddress: "b1",
+			SkyAddress:     "s1",
+			DepositValue:   1e6,
+			ConversionRate: testSkyBtcRate,
+			Txid:           "txid-1",
+			SkySent:        1e6,
+			Payout:         PayoutData{Gross: 11e5, Fee: 1e5, Net: 1e6},
+			Status:         StatusDone,
+			BuyMethod:      config.BuyMethodDirect,
+		},
+		{
+			DepositID:      "t2:1",
+			CoinType:       config.CoinTypeBTC,
+			DepositAddress: "b2",
+			SkyAddress:     "s2",
+			DepositValue:   2e6,
+			ConversionRate: testSkyBtcRate,
+			Txid:           "txid-2",
+			SkySent:        99e6,
+			Status:         StatusDone,
+			BuyMethod:      config.BuyMethodPassthrough,
+			Passthrough: PassthroughData{
+				ExchangeName:      PassthroughExchangeC2CX,
+				RequestedAmount:   "0.02",
+				SkyBought:         100e6,
+				DepositValueSpent: 2e6,
+				Fee:               1e6,
+				FeePassedThrough:  true,
+				ReferenceSky:      2e6,
+				Order: PassthroughOrder{
+					CustomerID: "t2:1",
+					OrderID:    "1",
+				},
+			},
+		},
+		{
+			DepositID:      "t3:1",
+			CoinType:       config.CoinTypeBTC,
+			DepositAddress: "b3",
+			SkyAddress:     "s3",
+			DepositValue:   1e6,
+			ConversionRate: testSkyBtcRate,
+			Txid:           "txid-3",
+			SkySent:        50e6,
+			Status:         StatusDone,
+			BuyMethod:      config.BuyMethodPassthrough,
+			Passthrough: PassthroughData{
+				ExchangeName:      PassthroughExchangeC2CX,
+				RequestedAmount:   "0.01",
+				SkyBought:         50e6,
+				DepositValueSpent: 1e6,
+				Fee:               5e5,
+				ReferenceSky:      1e6,
+				Order: PassthroughOrder{
+					CustomerID: "t3:1",
+					OrderID:    "2",
+				},
+			},
+		},
+	}
+
+	for _, dpi := range dpis {
+		_, err := s.addDepositInfo(dpi)
+		require.NoError(t, err)
+	}
+
+	stats, err := s.GetDepositStats()
+	require.NoError(t, err)
+
+	require.Equal(t, int64(150e6), stats.Sent)
+	require.Equal(t, int64(1e5), stats.Fees)
+	require.Equal(t, int64(4e6), stats.Received[config.CoinTypeBTC])
+	require.Equal(t, int64(0), stats.Received[config.CoinTypeETH])
+	require.Equal(t, PassthroughStats{
+		SkyBought:         150e6,
+		DepositValueSpent: 3e6,
+		ReferenceSky:      3e6,
+		FeesAbsorbed:      5e5,
+		FeesPassedThrough: 1e6,
+	}, stats.Passthrough)
+	require.Equal(t, "-49", stats.Passthrough.Slippage().String())
+}
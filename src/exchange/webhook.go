@@ -0,0 +1,192 @@
+package exchange
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/sqlutil"
+	"github.com/skycoin/teller/src/webhook"
+)
+
+// AddressBoundEvent is the data of a webhook.EventAddressBound event
+type AddressBoundEvent struct {
+	SkyAddress     string `json:"sky_address"`
+	DepositAddress string `json:"deposit_address"`
+	CoinType       string `json:"coin_type"`
+	BuyMethod      string `json:"buy_method"`
+}
+
+// DepositEvent is the data of the webhook events of a deposit
+type DepositEvent struct {
+	FromStatus string           `json:"from_status"` // The status before the change, empty for webhook.EventDepositDetected
+	Deposit    DepositEventInfo `json:"deposit"`
+}
+
+// DepositEventInfo is the part of a DepositInfo sent in webhook events.
+// Internal records such as the raw transactions and the original deposit are left out.
+type DepositEventInfo struct {
+	Seq            uint64 `json:"seq"`
+	UpdatedAt      int64  `json:"updated_at"`
+	Status         string `json:"status"`
+	CoinType       string `json:"coin_type"`
+	SkyAddress     string `json:"sky_address"`
+	BuyMethod      string `json:"buy_method"`
+	DepositAddress string `json:"deposit_address"`
+	DepositID      string `json:"deposit_id"`
+	DepositValue   int64  `json:"deposit_value"`
+	ConversionRate string `json:"conversion_rate"`
+	SkySent        uint64 `json:"sky_sent"`
+	Fee            uint64 `json:"fee"` // Service fee deducted from the payout, measured in droplets
+	Txid           string `json:"txid"`
+	Error          string `json:"error"`
+}
+
+func newDepositEventInfo(di DepositInfo) DepositEventInfo {
+	return DepositEventInfo{
+		Seq:            di.Seq,
+		UpdatedAt:      di.UpdatedAt,
+		Status:         di.Status,
+		CoinType:       di.CoinType,
+		SkyAddress:     di.SkyAddress,
+		BuyMethod:      di.BuyMethod,
+		DepositAddress: di.DepositAddress,
+		DepositID:      di.DepositID,
+		DepositValue:   di.DepositValue,
+		ConversionRate: di.ConversionRate,
+		SkySent:        di.SkySent,
+		Fee:            di.Payout.Fee,
+		Txid:           di.Txid,
+		Error:          di.Error,
+	}
+}
+
+// outbox decides whether a store adds webhook events for the changes it makes.
+// It is shared by a store and the copies returned by WithComponent and WithOperator.
+type outbox struct {
+	disabled int32
+}
+
+func (o *outbox) enabled() bool {
+	return atomic.LoadInt32(&o.disabled) == 0
+}
+
+func (o *outbox) setEnabled(enabled bool) {
+	var disabled int32
+	if !enabled {
+		disabled = 1
+	}
+	atomic.StoreInt32(&o.disabled, disabled)
+}
+
+// webhookEventsStorer is implemented by a Storer that adds webhook events to an outbox
+type webhookEventsStorer interface {
+	SetWebhookEvents(bool)
+}
+
+// SetWebhookEvents sets whether store adds webhook events to the outbox, if it supports it.
+// The events are added by default. Disable them when no webhook endpoints are configured,
+// since nothing would deliver or prune them.
+func SetWebhookEvents(store Storer, enabled bool) {
+	if ws, ok := store.(webhookEventsStorer); ok {
+		ws.SetWebhookEvents(enabled)
+	}
+}
+
+// depositEventTypes returns the webhook event types emitted for a change of a deposit from oldDi to newDi.
+// oldDi is empty for a new deposit.
+func depositEventTypes(oldDi, newDi DepositInfo) []string {
+	var types []string
+
+	if oldDi.DepositID == "" {
+		types = append(types, webhook.EventDepositDetected)
+	} else if oldDi.Status != newDi.Status {
+		types = append(types, webhook.EventStatusChanged)
+	}
+
+	if oldDi.Status != newDi.Status {
+		switch newDi.Status {
+		case StatusWaitConfirm:
+			types = append(types, webhook.EventPayoutSent)
+		case StatusDone:
+			types = append(types, webhook.EventPayoutConfirmed)
+		}
+	}
+
+	if newDi.Error != "" && newDi.Error != oldDi.Error {
+		types = append(types, webhook.EventDepositErrored)
+	}
+
+	return types
+}
+
+// addEventFunc adds an event to the outbox of a store's transaction
+type addEventFunc func(eventType string, timestamp int64, data interface{}) (webhook.Event, error)
+
+// addDepositEvents adds the webhook events for a change of a deposit from oldDi to newDi to the outbox
+func addDepositEvents(addEvent addEventFunc, oldDi, newDi DepositInfo) error {
+	for _, t := range depositEventTypes(oldDi, newDi) {
+		if _, err := addEvent(t, newDi.UpdatedAt, DepositEvent{
+			FromStatus: oldDi.Status,
+			Deposit:    newDepositEventInfo(newDi),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addAddressBoundEvent adds the webhook event for a bound address to the outbox
+func addAddressBoundEvent(addEvent addEventFunc, boundAddr BoundAddress) error {
+	_, err := addEvent(webhook.EventAddressBound, time.Now().UTC().Unix(), AddressBoundEvent{
+		SkyAddress:     boundAddr.SkyAddress,
+		DepositAddress: boundAddr.Address,
+		CoinType:       boundAddr.CoinType,
+		BuyMethod:      boundAddr.BuyMethod,
+	})
+	return err
+}
+
+// addEventTx returns an addEventFunc adding to the outbox of a bolt.Tx
+func addEventTx(tx *bolt.Tx) addEventFunc {
+	return func(eventType string, timestamp int64, data interface{}) (webhook.Event, error) {
+		return webhook.AddEventTx(tx, eventType, timestamp, data)
+	}
+}
+
+// addEventSQLTx returns an addEventFunc adding to the outbox of a sqlutil.Tx
+func addEventSQLTx(tx *sqlutil.Tx) addEventFunc {
+	return func(eventType string, timestamp int64, data interface{}) (webhook.Event, error) {
+		return webhook.AddEventSQLTx(tx, eventType, timestamp, data)
+	}
+}
+
+func (o *outbox) addDepositEventsTx(tx *bolt.Tx, oldDi, newDi DepositInfo) error {
+	if !o.enabled() {
+		return nil
+	}
+	return addDepositEvents(addEventTx(tx), oldDi, newDi)
+}
+
+func (o *outbox) addAddressBoundEventTx(tx *bolt.Tx, boundAddr BoundAddress) error {
+	if !o.enabled() {
+		return nil
+	}
+	return addAddressBoundEvent(addEventTx(tx), boundAddr)
+}
+
+func (o *outbox) addDepositEventsSQLTx(tx *sqlutil.Tx, oldDi, newDi DepositInfo) error {
+	if !o.enabled() {
+		return nil
+	}
+	return addDepositEvents(addEventSQLTx(tx), oldDi, newDi)
+}
+
+func (o *outbox) addAddressBoundEventSQLTx(tx *sqlutil.Tx, boundAddr BoundAddress) error {
+	if !o.enabled() {
+		return nil
+	}
+	return addAddressBoundEvent(addEventSQLTx(tx), boundAddr)
+}
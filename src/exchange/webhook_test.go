@@ -0,0 +1,221 @@
+package exchange
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/webhook"
+)
+
+func TestDepositEventTypes(t *testing.T) {
+	waitSend := DepositInfo{
+		DepositID: "foo-tx:1",
+		Status:    StatusWaitSend,
+	}
+
+	withStatus := func(di DepositInfo, status string) DepositInfo {
+		di.Status = status
+		return di
+	}
+
+	withError := func(di DepositInfo, err string) DepositInfo {
+		di.Error = err
+		return di
+	}
+
+	cases := []struct {
+		name  string
+		oldDi DepositInfo
+		newDi DepositInfo
+		types []string
+	}{
+		{
+			name:  "detected",
+			newDi: waitSend,
+			types: []string{webhook.EventDepositDetected},
+		},
+		{
+			name:  "detected and held",
+			newDi: withError(withStatus(waitSend, StatusWaitApproval), "max_deposit"),
+			types: []string{webhook.EventDepositDetected, webhook.EventDepositErrored},
+		},
+		{
+			name:  "unchanged",
+			oldDi: waitSend,
+			newDi: waitSend,
+		},
+		{
+			name:  "sent",
+			oldDi: waitSend,
+			newDi: withStatus(waitSend, StatusWaitConfirm),
+			types: []string{webhook.EventStatusChanged, webhook.EventPayoutSent},
+		},
+		{
+			name:  "confirmed",
+			oldDi: withStatus(waitSend, StatusWaitConfirm),
+			newDi: withStatus(waitSend, StatusDone),
+			types: []string{webhook.EventStatusChanged, webhook.EventPayoutConfirmed},
+		},
+		{
+			name:  "errored",
+			oldDi: waitSend,
+			newDi: withError(waitSend, "send failed"),
+			types: []string{webhook.EventDepositErrored},
+		},
+		{
+			name:  "same error",
+			oldDi: withError(waitSend, "send failed"),
+			newDi: withError(waitSend, "send failed"),
+		},
+		{
+			name:  "failed",
+			oldDi: withError(waitSend, "send failed"),
+			newDi: withError(withStatus(waitSend, StatusFailed), "send failed, too many attempts"),
+			types: []string{webhook.EventStatusChanged, webhook.EventDepositErrored},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.types, depositEventTypes(tc.oldDi, tc.newDi))
+		})
+	}
+}
+
+func TestStoreWebhookEvents(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	webhookStore, err := webhook.NewStore(s.db)
+	require.NoError(t, err)
+
+	_, err = s.BindAddress("foo-sky-addr", "foo-btc-addr", config.CoinTypeBTC, config.BuyMethodDirect, 0)
+	require.NoError(t, err)
+
+	di, err := s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: config.CoinTypeBTC,
+		Address:  "foo-btc-addr",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "foo-tx",
+		N:        1,
+	}, testSkyBtcRate)
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "foo-sky-txid"
+		di.TxAttempts = []TxAttempt{{
+			Txid:  "foo-sky-txid",
+			RawTx: "00ff",
+		}}
+		return di
+	})
+	require.NoError(t, err)
+
+	lastSeq, err := webhookStore.LastEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), lastSeq)
+
+	var types []string
+	for seq := uint64(1); seq <= lastSeq; seq++ {
+		e, err := webhookStore.GetEvent(seq)
+		require.NoError(t, err)
+		require.NotNil(t, e)
+		types = append(types, e.Type)
+	}
+
+	require.Equal(t, []string{
+		webhook.EventAddressBound,
+		webhook.EventDepositDetected,
+		webhook.EventStatusChanged,
+		webhook.EventPayoutSent,
+	}, types)
+
+	e, err := webhookStore.GetEvent(1)
+	require.NoError(t, err)
+	var bound AddressBoundEvent
+	require.NoError(t, json.Unmarshal(e.Data, &bound))
+	require.Equal(t, AddressBoundEvent{
+		SkyAddress:     "foo-sky-addr",
+		DepositAddress: "foo-btc-addr",
+		CoinType:       config.CoinTypeBTC,
+		BuyMethod:      config.BuyMethodDirect,
+	}, bound)
+
+	e, err = webhookStore.GetEvent(4)
+	require.NoError(t, err)
+	var de DepositEvent
+	require.NoError(t, json.Unmarshal(e.Data, &de))
+	require.Equal(t, StatusWaitDecide, de.FromStatus)
+	require.Equal(t, StatusWaitConfirm, de.Deposit.Status)
+	require.Equal(t, "foo-sky-txid", de.Deposit.Txid)
+	require.Equal(t, de.Deposit.UpdatedAt, e.Timestamp)
+	require.Equal(t, di.DepositID, de.Deposit.DepositID)
+	require.Equal(t, int64(1e6), de.Deposit.DepositValue)
+
+	// The internal records of the deposit are not sent
+	var data struct {
+		Deposit map[string]interface{} `json:"deposit"`
+	}
+	require.NoError(t, json.Unmarshal(e.Data, &data))
+	require.NotContains(t, data.Deposit, "tx_attempts")
+	require.NotContains(t, data.Deposit, "deposit")
+
+	// A failed update adds no events
+	_, err = s.UpdateDepositInfo("missing-tx:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.Error(t, err)
+
+	lastSeq, err = webhookStore.LastEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), lastSeq)
+}
+
+func TestStoreWebhookEventsDisabled(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	webhookStore, err := webhook.NewStore(s.db)
+	require.NoError(t, err)
+
+	// Disabling the events of a store disables them for its copies
+	SetWebhookEvents(s, false)
+	cs := s.WithComponent("send")
+
+	_, err = cs.BindAddress("foo-sky-addr", "foo-btc-addr", config.CoinTypeBTC, config.BuyMethodDirect, 0)
+	require.NoError(t, err)
+
+	di, err := cs.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: config.CoinTypeBTC,
+		Address:  "foo-btc-addr",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "foo-tx",
+		N:        1,
+	}, testSkyBtcRate)
+	require.NoError(t, err)
+
+	lastSeq, err := webhookStore.LastEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), lastSeq)
+
+	SetWebhookEvents(s, true)
+
+	_, err = cs.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "foo-sky-txid"
+		return di
+	})
+	require.NoError(t, err)
+
+	lastSeq, err = webhookStore.LastEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lastSeq)
+}
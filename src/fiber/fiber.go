@@ -0,0 +1,93 @@
+// Package fiber describes the Skycoin-fiber coin that teller sends to buyers.
+// Fibers are coins built from the skycoin codebase, e.g. MDL. They share skycoin's
+// transaction format and droplet units, but can differ in the decimal precision
+// allowed in transaction outputs.
+//
+// Only fibers with skycoin's address version 0 are supported: hot wallets,
+// unsigned transactions and the signer use the skycoin cipher and wallet
+// libraries, which only accept version 0 addresses.
+package fiber
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/base58"
+	"github.com/skycoin/skycoin/src/util/droplet"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+var (
+	// ErrInvalidAddressLength is returned if a decoded address is not 25 bytes
+	ErrInvalidAddressLength = errors.New("Invalid address length")
+	// ErrInvalidAddressVersion is returned if an address's version is not 0
+	ErrInvalidAddressVersion = errors.New("Invalid address version")
+	// ErrInvalidAddressChecksum is returned if an address's checksum does not match
+	ErrInvalidAddressChecksum = errors.New("Invalid address checksum")
+)
+
+// Skycoin is the default coin
+var Skycoin = Coin{
+	Name:                "SKY",
+	MaxDropletPrecision: visor.MaxDropletPrecision,
+}
+
+// Coin describes a Skycoin-fiber coin
+type Coin struct {
+	// Name of the coin, e.g. SKY
+	Name string `mapstructure:"name" json:"name"`
+	// Number of decimal places allowed in transaction outputs
+	MaxDropletPrecision uint64 `mapstructure:"max_droplet_precision" json:"max_droplet_precision"`
+}
+
+// Validate returns an error if the coin can't be used
+func (c Coin) Validate() error {
+	if c.Name == "" {
+		return errors.New("coin.name missing")
+	}
+
+	if c.MaxDropletPrecision > droplet.Exponent {
+		return fmt.Errorf("coin.max_droplet_precision can't be larger than %d", droplet.Exponent)
+	}
+
+	return nil
+}
+
+// DecodeAddress decodes a base58 address of the coin
+func (c Coin) DecodeAddress(addr string) (cipher.Address, error) {
+	b, err := base58.Base582Hex(addr)
+	if err != nil {
+		return cipher.Address{}, err
+	}
+
+	if len(b) != 20+1+4 {
+		return cipher.Address{}, ErrInvalidAddressLength
+	}
+
+	a := cipher.Address{
+		Version: b[20],
+	}
+	copy(a.Key[:], b[:20])
+
+	if a.Version != 0 {
+		return cipher.Address{}, ErrInvalidAddressVersion
+	}
+
+	var checksum cipher.Checksum
+	copy(checksum[:], b[21:])
+	if checksum != a.Checksum() {
+		return cipher.Address{}, ErrInvalidAddressChecksum
+	}
+
+	return a, nil
+}
+
+// MaxDropletDivisor returns the divisor that transaction output amounts must be a multiple of
+func (c Coin) MaxDropletDivisor() uint64 {
+	divisor := uint64(1)
+	for i := c.MaxDropletPrecision; i < droplet.Exponent; i++ {
+		divisor *= 10
+	}
+	return divisor
+}
@@ -0,0 +1,87 @@
+package fiber
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+func TestCoinDecodeAddress(t *testing.T) {
+	skyAddr := cipher.AddressFromPubKey(cipher.MustPubKeyFromHex("03d3c2c2e8e9a8c8c7d1f3a1b4d0f0bd2a9b8f70cf8f2dbd4cfcb7a2ff2dc0b7ff"))
+
+	otherVersionAddr := skyAddr
+	otherVersionAddr.Version = 7
+
+	fiberCoin := Coin{
+		Name:                "MDL",
+		MaxDropletPrecision: 3,
+	}
+
+	tt := []struct {
+		name string
+		coin Coin
+		addr string
+		out  cipher.Address
+		err  error
+	}{
+		{
+			name: "skycoin address",
+			coin: Skycoin,
+			addr: skyAddr.String(),
+			out:  skyAddr,
+		},
+		{
+			name: "fiber address",
+			coin: fiberCoin,
+			addr: skyAddr.String(),
+			out:  skyAddr,
+		},
+		{
+			name: "other address version",
+			coin: fiberCoin,
+			addr: otherVersionAddr.String(),
+			err:  ErrInvalidAddressVersion,
+		},
+		{
+			name: "bad checksum",
+			coin: Skycoin,
+			addr: skyAddr.String()[:len(skyAddr.String())-1] + "1",
+			err:  ErrInvalidAddressChecksum,
+		},
+		{
+			name: "bad length",
+			coin: Skycoin,
+			addr: skyAddr.String()[:20],
+			err:  ErrInvalidAddressLength,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, err := tc.coin.DecodeAddress(tc.addr)
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.out, addr)
+			require.Equal(t, tc.addr, addr.String())
+		})
+	}
+}
+
+func TestCoinMaxDropletDivisor(t *testing.T) {
+	require.Equal(t, visor.MaxDropletDivisor(), Skycoin.MaxDropletDivisor())
+	require.Equal(t, uint64(1), Coin{MaxDropletPrecision: 6}.MaxDropletDivisor())
+	require.Equal(t, uint64(1e6), Coin{MaxDropletPrecision: 0}.MaxDropletDivisor())
+}
+
+func TestCoinValidate(t *testing.T) {
+	require.NoError(t, Skycoin.Validate())
+	require.Error(t, Coin{MaxDropletPrecision: 3}.Validate())
+	require.Error(t, Coin{Name: "MDL", MaxDropletPrecision: 7}.Validate())
+}
@@ -4,6 +4,7 @@ package monitor
 
 import (
 	"context"
+	"encoding/csv"
 	"net/http"
 	"time"
 
@@ -11,15 +12,20 @@ import (
 
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/boltdb/bolt"
 
+	"github.com/skycoin/skycoin/src/util/droplet"
+
 	"github.com/skycoin/teller/src/addrs"
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/screening"
 	"github.com/skycoin/teller/src/util/dbutil"
 	"github.com/skycoin/teller/src/util/httputil"
 	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/webhook"
 )
 
 const (
@@ -41,8 +47,55 @@ type AddrManager interface {
 // DepositStatusGetter interface provides an API to access exchange resource
 type DepositStatusGetter interface {
 	GetDeposits(flt exchange.DepositFilter) ([]exchange.DepositInfo, error)
+	QueryDeposits(q exchange.DepositQuery) ([]exchange.DepositInfo, error)
 	GetDepositStats() (*exchange.DepositStats, error)
 	ErroredDeposits() ([]exchange.DepositInfo, error)
+	GetDepositHistory(depositID string) ([]exchange.DepositTransition, error)
+	GetStatsPeriods(interval string, from, to int64) ([]exchange.StatsPeriod, error)
+}
+
+// DepositOperator interface provides an API for operators to act on deposits
+type DepositOperator interface {
+	RetryDeposit(depositID, actor, reason string) (*exchange.DepositInfo, error)
+	SetDepositStatus(depositID, status, actor, reason string) (*exchange.DepositInfo, error)
+	CompleteDeposit(depositID, txid string, skySent uint64, actor, reason string) (*exchange.DepositInfo, error)
+	SetDepositSkyAddress(depositID, skyAddr, actor, reason string) (*exchange.DepositInfo, error)
+	ApproveDeposit(depositID, actor, reason string) (*exchange.DepositInfo, error)
+	RejectDeposit(depositID, actor, reason string) (*exchange.DepositInfo, error)
+}
+
+// SendReconciler provides an API to reconcile the deposits against the blockchain
+type SendReconciler interface {
+	Reconcile() (*exchange.ReconcileReport, error)
+	ReconcileReport() *exchange.ReconcileReport
+}
+
+// Ledger provides the ledger's balances and journal entries, and manual adjustments by operators
+type Ledger interface {
+	GetLedgerBalances(asOf int64) (exchange.LedgerBalances, error)
+	GetJournalEntries(from, to int64) ([]exchange.JournalEntry, error)
+	AdjustLedger(debit, credit, coinType string, amount int64, actor, reason string) (*exchange.JournalEntry, error)
+}
+
+// Pauser provides APIs for operators to pause and resume binding, deposit processing and sending
+type Pauser interface {
+	PauseStatus() exchange.PauseStatus
+	GetPauseChanges() ([]exchange.PauseChange, error)
+	Pause(target, coinType, actor, reason string) (*exchange.PauseChange, error)
+	Resume(target, coinType, actor, reason string) (*exchange.PauseChange, error)
+}
+
+// ConfigReloader re-reads the config file and applies the settings that can be changed while running
+type ConfigReloader interface {
+	ReloadConfig(actor string) (*config.ReloadDiff, error)
+}
+
+// WebhookDispatcher provides the delivery progress of the webhook endpoints, and replays events to them
+type WebhookDispatcher interface {
+	LastEventSeq() (uint64, error)
+	EndpointStatuses() ([]webhook.EndpointStatus, error)
+	GetFailures() ([]webhook.Failure, error)
+	Replay(url string, fromSeq uint64, actor string) ([]webhook.EndpointStatus, error)
 }
 
 // ScanAddressGetter get scanning address interface
@@ -50,12 +103,24 @@ type ScanAddressGetter interface {
 	GetScanAddresses(string) ([]string, error)
 }
 
+// ScreeningHitGetter provides the addresses that were found on deny lists
+type ScreeningHitGetter interface {
+	GetHits() ([]screening.Hit, error)
+}
+
 // Monitor monitor service struct
 type Monitor struct {
 	log                 logrus.FieldLogger
 	addrManager         AddrManager
 	scanAddressGetter   ScanAddressGetter
 	depositStatusGetter DepositStatusGetter
+	depositOperator     DepositOperator
+	sendReconciler      SendReconciler
+	ledger              Ledger
+	pauser              Pauser
+	configReloader      ConfigReloader
+	webhooks            WebhookDispatcher
+	screeningHitGetter  ScreeningHitGetter
 	cfg                 config.Config
 	ln                  *http.Server
 	db                  *bolt.DB
@@ -63,13 +128,20 @@ type Monitor struct {
 }
 
 // New creates monitor service
-func New(log logrus.FieldLogger, cfg config.Config, addrManager AddrManager, dpstget DepositStatusGetter, sag ScanAddressGetter, db *bolt.DB) *Monitor {
+func New(log logrus.FieldLogger, cfg config.Config, addrManager AddrManager, dpstget DepositStatusGetter, dpstop DepositOperator, rec SendReconciler, ledger Ledger, pauser Pauser, reloader ConfigReloader, webhooks WebhookDispatcher, sag ScanAddressGetter, shg ScreeningHitGetter, db *bolt.DB) *Monitor {
 	return &Monitor{
 		log:                 log.WithField("prefix", "teller.monitor"),
 		cfg:                 cfg,
 		addrManager:         addrManager,
 		depositStatusGetter: dpstget,
+		depositOperator:     dpstop,
+		sendReconciler:      rec,
+		ledger:              ledger,
+		pauser:              pauser,
+		configReloader:      reloader,
+		webhooks:            webhooks,
 		scanAddressGetter:   sag,
+		screeningHitGetter:  shg,
 		db:                  db,
 		quit:                make(chan struct{}),
 	}
@@ -108,7 +180,35 @@ func (m *Monitor) setupMux() *http.ServeMux {
 	mux.Handle("/api/deposit-addresses", httputil.LogHandler(m.log, m.depositAddressesHandler()))
 	mux.Handle("/api/deposits", httputil.LogHandler(m.log, m.depositsByStatusHandler()))
 	mux.Handle("/api/deposits/errored", httputil.LogHandler(m.log, m.erroredDepositsHandler()))
+	mux.Handle("/api/deposits/history", httputil.LogHandler(m.log, m.depositHistoryHandler()))
+	mux.Handle("/api/screening/hits", httputil.LogHandler(m.log, m.screeningHitsHandler()))
 	mux.Handle("/api/accounting", httputil.LogHandler(m.log, m.accountingHandler()))
+	mux.Handle("/api/stats", httputil.LogHandler(m.log, m.statsHandler()))
+	mux.Handle("/api/reconcile/report", httputil.LogHandler(m.log, m.reconcileReportHandler()))
+	mux.Handle("/api/ledger/balances", httputil.LogHandler(m.log, m.ledgerBalancesHandler()))
+	mux.Handle("/api/ledger/journal.csv", httputil.LogHandler(m.log, m.ledgerJournalHandler()))
+	mux.Handle("/api/pauses", httputil.LogHandler(m.log, m.pausesHandler()))
+	mux.Handle("/api/webhooks", httputil.LogHandler(m.log, m.webhooksHandler()))
+
+	// Deposit actions require an operator's credentials
+	credentials, err := m.cfg.AdminPanel.Credentials()
+	if err != nil {
+		m.log.WithError(err).Error("Invalid admin_panel.users, deposit actions are disabled")
+		credentials = nil
+	}
+	mux.Handle("/api/deposits/retry", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.retryDepositHandler())))
+	mux.Handle("/api/deposits/set-status", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.setDepositStatusHandler())))
+	mux.Handle("/api/deposits/complete", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.completeDepositHandler())))
+	mux.Handle("/api/deposits/sky-address", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.setDepositSkyAddressHandler())))
+	mux.Handle("/api/deposits/approve", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.approveDepositHandler())))
+	mux.Handle("/api/deposits/reject", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.rejectDepositHandler())))
+	mux.Handle("/api/reconcile", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.reconcileHandler())))
+	mux.Handle("/api/ledger/adjust", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.adjustLedgerHandler())))
+	mux.Handle("/api/pause", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.pauseHandler(true))))
+	mux.Handle("/api/resume", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.pauseHandler(false))))
+	mux.Handle("/api/config/reload", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.reloadConfigHandler())))
+	mux.Handle("/api/webhooks/replay", httputil.LogHandler(m.log, m.operatorHandler(credentials, m.replayWebhooksHandler())))
+
 	mux.Handle("/api/backup", httputil.LogHandler(m.log, m.backupHandler()))
 	return mux
 }
@@ -219,7 +319,7 @@ type depositsByStatusResponse struct {
 // Method: GET
 // URI: /api/deposit_status
 // Args:
-//    status - Optional, one of "waiting_deposit", "waiting_send", "waiting_confirm", "done", "waiting_decide", "waiting_passthrough", "waiting_passthrough_order_complete"
+//    status - Optional, one of "waiting_deposit", "waiting_send", "waiting_confirm", "done", "waiting_decide", "waiting_passthrough", "waiting_passthrough_order_complete", "failed", "waiting_approval", "refund_pending"
 func (m *Monitor) depositsByStatusHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -260,11 +360,11 @@ func (m *Monitor) depositsByStatusHandler() http.HandlerFunc {
 				return
 			}
 
-			dpis, err := m.depositStatusGetter.GetDeposits(func(dpi exchange.DepositInfo) bool {
-				return dpi.Status == status
+			dpis, err := m.depositStatusGetter.QueryDeposits(exchange.DepositQuery{
+				Statuses: []string{status},
 			})
 			if err != nil {
-				log.WithError(err).Error("depositStatusGetter.GetDeposits failed")
+				log.WithError(err).Error("depositStatusGetter.QueryDeposits failed")
 				httputil.ErrResponse(w, http.StatusInternalServerError)
 				return
 			}
@@ -321,12 +421,273 @@ func (m *Monitor) erroredDepositsHandler() http.HandlerFunc {
 	}
 }
 
+type depositHistoryResponse struct {
+	DepositID string                       `json:"deposit_id"`
+	History   []exchange.DepositTransition `json:"history"`
+}
+
+// depositHistoryHandler returns the status transitions of a deposit
+// Method: GET
+// URI: /api/deposits/history
+// Args:
+//    id - Required, the deposit ID
+func (m *Monitor) depositHistoryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		depositID := r.FormValue("id")
+		if depositID == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "Missing id")
+			return
+		}
+
+		history, err := m.depositStatusGetter.GetDepositHistory(depositID)
+		if err != nil {
+			log.WithError(err).Error("depositStatusGetter.GetDepositHistory failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if history == nil {
+			history = []exchange.DepositTransition{}
+		}
+
+		if err := httputil.JSONResponse(w, depositHistoryResponse{
+			DepositID: depositID,
+			History:   history,
+		}); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+// screeningHitsHandler returns the addresses that were found on deny lists, oldest first
+// Method: GET
+// URI: /api/screening/hits
+func (m *Monitor) screeningHitsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		hits, err := m.screeningHitGetter.GetHits()
+		if err != nil {
+			log.WithError(err).Error("screeningHitGetter.GetHits failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if hits == nil {
+			hits = []screening.Hit{}
+		}
+
+		if err := httputil.JSONResponse(w, hits); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+// operatorHandler requires the credentials of a configured admin_panel.users entry.
+// If no users are configured, all requests are forbidden.
+func (m *Monitor) operatorHandler(credentials map[string]string, hd http.Handler) http.Handler {
+	if len(credentials) == 0 {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			httputil.ErrResponse(w, http.StatusForbidden, "Deposit actions are disabled, admin_panel.users is not configured")
+		})
+	}
+
+	return httputil.BasicAuthHandler("teller admin", credentials, hd)
+}
+
+// depositActionHandler handles a deposit action made by an authenticated operator.
+// The request must be a POST with the deposit's "id" and a "reason" for the action.
+// The updated deposit is returned.
+func (m *Monitor) depositActionHandler(action func(r *http.Request, depositID, actor, reason string) (*exchange.DepositInfo, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		actor := httputil.UsernameFromContext(ctx)
+		log := logger.FromContext(ctx).WithField("actor", actor)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		depositID := r.FormValue("id")
+		if depositID == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "Missing id")
+			return
+		}
+
+		reason := r.FormValue("reason")
+		if strings.TrimSpace(reason) == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "Missing reason")
+			return
+		}
+
+		log = log.WithField("depositID", depositID)
+
+		di, err := action(r, depositID, actor, reason)
+		if err != nil {
+			log.WithError(err).Error("Deposit action failed")
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				httputil.ErrResponse(w, http.StatusNotFound, "Deposit not found")
+			default:
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+
+		if err := httputil.JSONResponse(w, di); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+// retryDepositHandler clears an errored deposit's error and restarts its processing
+// Method: POST
+// URI: /api/deposits/retry
+// Args:
+//    id - Required, the deposit ID
+//    reason - Required, the reason for the action
+func (m *Monitor) retryDepositHandler() http.HandlerFunc {
+	return m.depositActionHandler(func(r *http.Request, depositID, actor, reason string) (*exchange.DepositInfo, error) {
+		return m.depositOperator.RetryDeposit(depositID, actor, reason)
+	})
+}
+
+// setDepositStatusHandler forces a deposit to a status
+// Method: POST
+// URI: /api/deposits/set-status
+// Args:
+//    id - Required, the deposit ID
+//    status - Required, one of "waiting_decide", "waiting_send", "waiting_confirm", "done", "waiting_passthrough", "waiting_passthrough_order_complete"
+//    reason - Required, the reason for the action
+func (m *Monitor) setDepositStatusHandler() http.HandlerFunc {
+	return m.depositActionHandler(func(r *http.Request, depositID, actor, reason string) (*exchange.DepositInfo, error) {
+		return m.depositOperator.SetDepositStatus(depositID, r.FormValue("status"), actor, reason)
+	})
+}
+
+// completeDepositHandler marks a deposit done with coins that were sent outside of teller
+// Method: POST
+// URI: /api/deposits/complete
+// Args:
+//    id - Required, the deposit ID
+//    txid - Required, the skycoin transaction that sent the coins
+//    sky_sent - Optional, the SKY sent, e.g. "12.5"
+//    reason - Required, the reason for the action
+func (m *Monitor) completeDepositHandler() http.HandlerFunc {
+	return m.depositActionHandler(func(r *http.Request, depositID, actor, reason string) (*exchange.DepositInfo, error) {
+		var skySent uint64
+		if v := r.FormValue("sky_sent"); v != "" {
+			var err error
+			skySent, err = droplet.FromString(v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid sky_sent: %v", err)
+			}
+		}
+
+		return m.depositOperator.CompleteDeposit(depositID, r.FormValue("txid"), skySent, actor, reason)
+	})
+}
+
+// setDepositSkyAddressHandler changes the skycoin address that a deposit's coins are sent to
+// Method: POST
+// URI: /api/deposits/sky-address
+// Args:
+//    id - Required, the deposit ID
+//    sky_address - Required, the new skycoin address
+//    reason - Required, the reason for the action
+func (m *Monitor) setDepositSkyAddressHandler() http.HandlerFunc {
+	return m.depositActionHandler(func(r *http.Request, depositID, actor, reason string) (*exchange.DepositInfo, error) {
+		return m.depositOperator.SetDepositSkyAddress(depositID, r.FormValue("sky_address"), actor, reason)
+	})
+}
+
+// approveDepositHandler releases a deposit held by a risk rule for processing
+// Method: POST
+// URI: /api/deposits/approve
+// Args:
+//    id - Required, the deposit ID
+//    reason - Required, the reason for the action
+func (m *Monitor) approveDepositHandler() http.HandlerFunc {
+	return m.depositActionHandler(func(r *http.Request, depositID, actor, reason string) (*exchange.DepositInfo, error) {
+		return m.depositOperator.ApproveDeposit(depositID, actor, reason)
+	})
+}
+
+// rejectDepositHandler rejects a deposit held by a risk rule, making it a refund candidate
+// Method: POST
+// URI: /api/deposits/reject
+// Args:
+//    id - Required, the deposit ID
+//    reason - Required, the reason for the action
+func (m *Monitor) rejectDepositHandler() http.HandlerFunc {
+	return m.depositActionHandler(func(r *http.Request, depositID, actor, reason string) (*exchange.DepositInfo, error) {
+		return m.depositOperator.RejectDeposit(depositID, actor, reason)
+	})
+}
+
 type accountingResponse struct {
-	Sent     string            `json:"sent"`
-	Received map[string]string `json:"received"`
+	Sent        string                        `json:"sent"`
+	Fees        string                        `json:"fees"`
+	Received    map[string]string             `json:"received"`
+	Passthrough accountingPassthroughResponse `json:"passthrough"`
+}
+
+type accountingPassthroughResponse struct {
+	SkyBought         string `json:"sky_bought"`
+	BtcSpent          string `json:"btc_spent"`
+	FeesAbsorbed      string `json:"fees_absorbed"`
+	FeesPassedThrough string `json:"fees_passed_through"`
+	Slippage          string `json:"slippage"`
+}
+
+func newAccountingPassthroughResponse(stats exchange.PassthroughStats) (*accountingPassthroughResponse, error) {
+	skyBought, err := exchange.SkyAmountToString(stats.SkyBought)
+	if err != nil {
+		return nil, err
+	}
+
+	feesAbsorbed, err := exchange.SkyAmountToString(stats.FeesAbsorbed)
+	if err != nil {
+		return nil, err
+	}
+
+	feesPassedThrough, err := exchange.SkyAmountToString(stats.FeesPassedThrough)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountingPassthroughResponse{
+		SkyBought:         skyBought,
+		BtcSpent:          exchange.BtcAmountToString(stats.DepositValueSpent),
+		FeesAbsorbed:      feesAbsorbed,
+		FeesPassedThrough: feesPassedThrough,
+		Slippage:          stats.Slippage().String(),
+	}, nil
 }
 
-// accountingHandler returns all deposit stats, including total BTC received and total SKY sent.
+// accountingHandler returns all deposit stats, including total BTC received, total SKY sent,
+// total service fees and the totals of passthrough orders, with exchange fees and slippage.
 // Method: GET
 // URI: /api/accounting
 func (m *Monitor) accountingHandler() http.HandlerFunc {
@@ -354,6 +715,13 @@ func (m *Monitor) accountingHandler() http.HandlerFunc {
 			return
 		}
 
+		fees, err := exchange.SkyAmountToString(stats.Fees)
+		if err != nil {
+			log.WithError(err).Error("exchange.SkyAmountToString failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
 		received := make(map[string]string, len(stats.Received))
 		for k, v := range stats.Received {
 			r, err := exchange.DepositAmountToString(k, v)
@@ -365,9 +733,457 @@ func (m *Monitor) accountingHandler() http.HandlerFunc {
 			received[k] = r
 		}
 
+		passthrough, err := newAccountingPassthroughResponse(stats.Passthrough)
+		if err != nil {
+			log.WithError(err).Error("newAccountingPassthroughResponse failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
 		if err := httputil.JSONResponse(w, accountingResponse{
-			Received: received,
-			Sent:     skySent,
+			Received:    received,
+			Sent:        skySent,
+			Fees:        fees,
+			Passthrough: *passthrough,
+		}); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+type statsResponse struct {
+	Interval string                `json:"interval"`
+	Periods  []statsPeriodResponse `json:"periods"`
+}
+
+type statsPeriodResponse struct {
+	Start        int64                         `json:"start"`
+	Deposits     map[string]int64              `json:"deposits"`
+	DepositValue map[string]string             `json:"deposit_value"`
+	Payouts      int64                         `json:"payouts"`
+	SkySent      string                        `json:"sky_sent"`
+	Errors       int64                         `json:"errors"`
+	Stages       map[string]statsStageResponse `json:"stages"`
+}
+
+type statsStageResponse struct {
+	Count          int64   `json:"count"`
+	AverageSeconds float64 `json:"average_seconds"`
+}
+
+func newStatsPeriodResponse(p exchange.StatsPeriod) (*statsPeriodResponse, error) {
+	skySent, err := exchange.LedgerAmountToString(config.CoinTypeSKY, p.SkySent)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &statsPeriodResponse{
+		Start:        p.Start,
+		Deposits:     make(map[string]int64, len(config.CoinTypes)),
+		DepositValue: make(map[string]string, len(config.CoinTypes)),
+		Payouts:      p.Payouts,
+		SkySent:      skySent,
+		Errors:       p.Errors,
+		Stages:       make(map[string]statsStageResponse, len(p.Stages)),
+	}
+
+	for _, ct := range config.CoinTypes {
+		v, err := exchange.LedgerAmountToString(ct, p.DepositValue[ct])
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Deposits[ct] = p.Deposits[ct]
+		resp.DepositValue[ct] = v
+	}
+
+	for stage, d := range p.Stages {
+		resp.Stages[stage] = statsStageResponse{
+			Count:          d.Count,
+			AverageSeconds: d.Average().Seconds(),
+		}
+	}
+
+	return resp, nil
+}
+
+// statsHandler returns deposit statistics per hour, day or week: the number and value of deposits received
+// per coin type, the number of payouts and SKY sent, the number of errors, and the average time spent in each stage.
+// Activity is counted in the period it happened in. Periods without activity are omitted.
+// Method: GET
+// URI: /api/stats
+// Args:
+//    interval - Optional, one of "hour", "day", "week". Defaults to "day".
+//    from - Optional, a unix timestamp or a YYYY-MM-DD date
+//    to - Optional, a unix timestamp or a YYYY-MM-DD date, which includes the whole day
+func (m *Monitor) statsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		interval := r.FormValue("interval")
+		if interval == "" {
+			interval = exchange.StatsIntervalDay
+		}
+
+		if err := exchange.ValidateStatsInterval(interval); err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, "Invalid interval")
+			return
+		}
+
+		from, err := parseTimeArg(r.FormValue("from"), false)
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid from: %v", err))
+			return
+		}
+
+		to, err := parseTimeArg(r.FormValue("to"), true)
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid to: %v", err))
+			return
+		}
+
+		periods, err := m.depositStatusGetter.GetStatsPeriods(interval, from, to)
+		if err != nil {
+			log.WithError(err).Error("depositStatusGetter.GetStatsPeriods failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		resp := statsResponse{
+			Interval: interval,
+			Periods:  make([]statsPeriodResponse, 0, len(periods)),
+		}
+
+		for _, p := range periods {
+			pr, err := newStatsPeriodResponse(p)
+			if err != nil {
+				log.WithError(err).Error("newStatsPeriodResponse failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+			resp.Periods = append(resp.Periods, *pr)
+		}
+
+		if err := httputil.JSONResponse(w, resp); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+// reconcileReportHandler returns the report of the last reconciliation of the deposits against the blockchain
+// Method: GET
+// URI: /api/reconcile/report
+func (m *Monitor) reconcileReportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := m.sendReconciler.ReconcileReport()
+		if report == nil {
+			httputil.ErrResponse(w, http.StatusNotFound, "Reconciliation has not run")
+			return
+		}
+
+		if err := httputil.JSONResponse(w, report); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+// reconcileHandler reconciles the deposits against the blockchain, halting sending while it runs.
+// Sending resumes if no unresolved issues are found. The report is returned.
+// Method: POST
+// URI: /api/reconcile
+func (m *Monitor) reconcileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx).WithField("actor", httputil.UsernameFromContext(ctx))
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		log.Info("Reconciliation requested")
+
+		report, err := m.sendReconciler.Reconcile()
+		if err != nil {
+			log.WithError(err).Error("sendReconciler.Reconcile failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if err := httputil.JSONResponse(w, report); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+// parseTimeArg parses a unix timestamp or a "2006-01-02" UTC date.
+// A date is parsed as the start of the day, or the last second of the day if endOfDay is true.
+// An empty value is returned as 0, which is unbounded.
+func parseTimeArg(v string, endOfDay bool) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return ts, nil
+	}
+
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return 0, fmt.Errorf("must be a unix timestamp or a YYYY-MM-DD date")
+	}
+
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+
+	return t.Unix(), nil
+}
+
+type ledgerBalancesResponse struct {
+	AsOf     int64                        `json:"as_of"`
+	Balances map[string]map[string]string `json:"balances"`
+}
+
+// ledgerBalancesHandler returns the balance of every ledger account in each coin type.
+// Debit balances are positive and credit balances negative.
+// Method: GET
+// URI: /api/ledger/balances
+// Args:
+//    as_of - Optional, a unix timestamp or a YYYY-MM-DD date, which includes the whole day. Defaults to now.
+func (m *Monitor) ledgerBalancesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		asOf, err := parseTimeArg(r.FormValue("as_of"), true)
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid as_of: %v", err))
+			return
+		}
+
+		if asOf == 0 {
+			asOf = time.Now().UTC().Unix()
+		}
+
+		balances, err := m.ledger.GetLedgerBalances(asOf)
+		if err != nil {
+			log.WithError(err).Error("ledger.GetLedgerBalances failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		resp := ledgerBalancesResponse{
+			AsOf:     asOf,
+			Balances: make(map[string]map[string]string, len(exchange.Accounts)),
+		}
+
+		for _, account := range exchange.Accounts {
+			resp.Balances[account] = make(map[string]string, len(balances[account]))
+			for coinType, v := range balances[account] {
+				amt, err := exchange.LedgerAmountToString(coinType, v)
+				if err != nil {
+					log.WithError(err).Error("exchange.LedgerAmountToString failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+					return
+				}
+				resp.Balances[account][coinType] = amt
+			}
+		}
+
+		if err := httputil.JSONResponse(w, resp); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+// ledgerJournalHandler exports the ledger's journal entries as CSV, one row per posting, oldest first
+// Method: GET
+// URI: /api/ledger/journal.csv
+// Args:
+//    from - Optional, a unix timestamp or a YYYY-MM-DD date
+//    to - Optional, a unix timestamp or a YYYY-MM-DD date, which includes the whole day
+func (m *Monitor) ledgerJournalHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		from, err := parseTimeArg(r.FormValue("from"), false)
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid from: %v", err))
+			return
+		}
+
+		to, err := parseTimeArg(r.FormValue("to"), true)
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid to: %v", err))
+			return
+		}
+
+		entries, err := m.ledger.GetJournalEntries(from, to)
+		if err != nil {
+			log.WithError(err).Error("ledger.GetJournalEntries failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		rows := [][]string{
+			{"seq", "timestamp", "date", "type", "deposit_id", "txid", "actor", "memo", "account", "coin_type", "debit", "credit"},
+		}
+
+		for _, e := range entries {
+			for _, p := range e.Postings {
+				amt, err := exchange.LedgerAmountToString(p.CoinType, p.Amount)
+				if err != nil {
+					log.WithError(err).Error("exchange.LedgerAmountToString failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+					return
+				}
+
+				debit, credit := amt, ""
+				if p.Amount < 0 {
+					debit, credit = "", strings.TrimPrefix(amt, "-")
+				}
+
+				rows = append(rows, []string{
+					strconv.FormatUint(e.Seq, 10),
+					strconv.FormatInt(e.Timestamp, 10),
+					time.Unix(e.Timestamp, 0).UTC().Format(time.RFC3339),
+					e.Type,
+					e.DepositID,
+					e.Txid,
+					e.Actor,
+					e.Memo,
+					p.Account,
+					p.CoinType,
+					debit,
+					credit,
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="%s"`, "teller-journal-"+strconv.Itoa(int(time.Now().Unix()))+".csv"))
+
+		if err := csv.NewWriter(w).WriteAll(rows); err != nil {
+			log.WithError(err).Error("Write CSV response failed")
+			return
+		}
+	}
+}
+
+// adjustLedgerHandler posts a manual adjustment to the ledger, debiting one account and crediting another.
+// The journal entry is returned.
+// Method: POST
+// URI: /api/ledger/adjust
+// Args:
+//    debit - Required, the account to debit, e.g. "assets:hot_wallet"
+//    credit - Required, the account to credit, e.g. "equity:adjustments"
+//    coin_type - Required, one of "BTC", "ETH", "SKY"
+//    amount - Required, the amount to adjust by, e.g. "12.5"
+//    reason - Required, the reason for the adjustment
+func (m *Monitor) adjustLedgerHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		actor := httputil.UsernameFromContext(ctx)
+		log := logger.FromContext(ctx).WithField("actor", actor)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		reason := r.FormValue("reason")
+		if strings.TrimSpace(reason) == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "Missing reason")
+			return
+		}
+
+		coinType := r.FormValue("coin_type")
+		amount, err := exchange.LedgerAmountFromString(coinType, r.FormValue("amount"))
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid amount: %v", err))
+			return
+		}
+
+		entry, err := m.ledger.AdjustLedger(r.FormValue("debit"), r.FormValue("credit"), coinType, amount, actor, reason)
+		if err != nil {
+			log.WithError(err).Error("ledger.AdjustLedger failed")
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := httputil.JSONResponse(w, entry); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+type pausesResponse struct {
+	Status  exchange.PauseStatus   `json:"status"`
+	Changes []exchange.PauseChange `json:"changes"`
+}
+
+// pausesHandler returns what is paused, and the record of operators pausing and resuming, oldest first
+// Method: GET
+// URI: /api/pauses
+func (m *Monitor) pausesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		changes, err := m.pauser.GetPauseChanges()
+		if err != nil {
+			log.WithError(err).Error("pauser.GetPauseChanges failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if changes == nil {
+			changes = []exchange.PauseChange{}
+		}
+
+		if err := httputil.JSONResponse(w, pausesResponse{
+			Status:  m.pauser.PauseStatus(),
+			Changes: changes,
 		}); err != nil {
 			log.WithError(err).Error("Write JSON response failed")
 			return
@@ -375,6 +1191,198 @@ func (m *Monitor) accountingHandler() http.HandlerFunc {
 	}
 }
 
+// pauseHandler pauses or resumes binding, processing the deposits of a coin type, or sending.
+// The recorded change is returned.
+// Method: POST
+// URI: /api/pause, /api/resume
+// Args:
+//    target - Required, one of "bind", "process", "send"
+//    coin_type - Required for "process", the coin type whose deposits are paused
+//    reason - Required, the reason for the action
+func (m *Monitor) pauseHandler(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		actor := httputil.UsernameFromContext(ctx)
+		log := logger.FromContext(ctx).WithField("actor", actor)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		reason := r.FormValue("reason")
+		if strings.TrimSpace(reason) == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "Missing reason")
+			return
+		}
+
+		target := r.FormValue("target")
+		coinType := r.FormValue("coin_type")
+
+		action := m.pauser.Resume
+		if paused {
+			action = m.pauser.Pause
+		}
+
+		c, err := action(target, coinType, actor, reason)
+		if err != nil {
+			log.WithError(err).Error("Pause action failed")
+			switch err {
+			case exchange.ErrAlreadyPaused, exchange.ErrNotPaused:
+				httputil.ErrResponse(w, http.StatusConflict, err.Error())
+			default:
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+
+		if err := httputil.JSONResponse(w, c); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+// reloadConfigHandler re-reads the config file and applies the settings that can be changed while running.
+// Changes to the other settings are ignored until teller is restarted.
+// The applied and ignored changes are returned. Nothing is applied if the config is invalid.
+// Method: POST
+// URI: /api/config/reload
+func (m *Monitor) reloadConfigHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		actor := httputil.UsernameFromContext(ctx)
+		log := logger.FromContext(ctx).WithField("actor", actor)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		diff, err := m.configReloader.ReloadConfig(actor)
+		if err != nil {
+			log.WithError(err).Error("configReloader.ReloadConfig failed")
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := httputil.JSONResponse(w, diff); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+type webhooksResponse struct {
+	LastEventSeq uint64                   `json:"last_event_seq"`
+	Endpoints    []webhook.EndpointStatus `json:"endpoints"`
+	Failures     []webhook.Failure        `json:"failures"`
+}
+
+// webhooksHandler returns the delivery progress of the webhook endpoints,
+// and the events that were skipped after failing to be delivered, oldest first
+// Method: GET
+// URI: /api/webhooks
+func (m *Monitor) webhooksHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		lastSeq, err := m.webhooks.LastEventSeq()
+		if err != nil {
+			log.WithError(err).Error("webhooks.LastEventSeq failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		endpoints, err := m.webhooks.EndpointStatuses()
+		if err != nil {
+			log.WithError(err).Error("webhooks.EndpointStatuses failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		failures, err := m.webhooks.GetFailures()
+		if err != nil {
+			log.WithError(err).Error("webhooks.GetFailures failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if failures == nil {
+			failures = []webhook.Failure{}
+		}
+
+		if err := httputil.JSONResponse(w, webhooksResponse{
+			LastEventSeq: lastSeq,
+			Endpoints:    endpoints,
+			Failures:     failures,
+		}); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
+// replayWebhooksHandler redelivers the webhook events from a sequence number onwards.
+// The endpoints' updated progress is returned.
+// Method: POST
+// URI: /api/webhooks/replay
+// Args:
+//    from - Required, the sequence number of the first event to redeliver
+//    url - Optional, the endpoint to redeliver to. All endpoints if not set.
+func (m *Monitor) replayWebhooksHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		actor := httputil.UsernameFromContext(ctx)
+		log := logger.FromContext(ctx).WithField("actor", actor)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		fromStr := r.FormValue("from")
+		if fromStr == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "Missing from")
+			return
+		}
+
+		from, err := strconv.ParseUint(fromStr, 10, 64)
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, "Invalid from")
+			return
+		}
+
+		statuses, err := m.webhooks.Replay(r.FormValue("url"), from, actor)
+		if err != nil {
+			log.WithError(err).Error("webhooks.Replay failed")
+			switch err {
+			case webhook.ErrUnknownEndpoint:
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+			case webhook.ErrInvalidReplaySeq, webhook.ErrReplayEventsPruned:
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			default:
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := httputil.JSONResponse(w, statuses); err != nil {
+			log.WithError(err).Error("Write JSON response failed")
+			return
+		}
+	}
+}
+
 // starts a timestamped database backup download
 // Method: GET
 // URI: /api/backup
@@ -1,10 +1,14 @@
 package monitor
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,7 +17,10 @@ import (
 	"github.com/skycoin/teller/src/addrs"
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/screening"
+	"github.com/skycoin/teller/src/util/dbutil"
 	"github.com/skycoin/teller/src/util/testutil"
+	"github.com/skycoin/teller/src/webhook"
 	"github.com/boltdb/bolt"
 )
 
@@ -52,7 +59,9 @@ func (db *dummySkyAddrMgr) Remaining() uint64 {
 }
 
 type dummyDepositStatusGetter struct {
-	dpis []exchange.DepositInfo
+	dpis    []exchange.DepositInfo
+	history map[string][]exchange.DepositTransition
+	periods map[string][]exchange.StatsPeriod
 }
 
 func (dps dummyDepositStatusGetter) GetDeposits(flt exchange.DepositFilter) ([]exchange.DepositInfo, error) {
@@ -65,6 +74,16 @@ func (dps dummyDepositStatusGetter) GetDeposits(flt exchange.DepositFilter) ([]e
 	return ds, nil
 }
 
+func (dps dummyDepositStatusGetter) QueryDeposits(q exchange.DepositQuery) ([]exchange.DepositInfo, error) {
+	var ds []exchange.DepositInfo
+	for _, dpi := range dps.dpis {
+		if q.Matches(dpi) {
+			ds = append(ds, dpi)
+		}
+	}
+	return ds, nil
+}
+
 func (dps dummyDepositStatusGetter) GetDepositStats() (*exchange.DepositStats, error) {
 	received := make(map[string]int64)
 	var sent int64
@@ -84,6 +103,251 @@ func (dps dummyDepositStatusGetter) ErroredDeposits() ([]exchange.DepositInfo, e
 	return nil, nil
 }
 
+func (dps dummyDepositStatusGetter) GetDepositHistory(depositID string) ([]exchange.DepositTransition, error) {
+	return dps.history[depositID], nil
+}
+
+func (dps dummyDepositStatusGetter) GetStatsPeriods(interval string, from, to int64) ([]exchange.StatsPeriod, error) {
+	var periods []exchange.StatsPeriod
+	for _, p := range dps.periods[interval] {
+		if (from == 0 || p.Start >= from) && (to == 0 || p.Start <= to) {
+			periods = append(periods, p)
+		}
+	}
+	return periods, nil
+}
+
+type dummyDepositOperator struct {
+	action  string
+	actor   string
+	reason  string
+	status  string
+	txid    string
+	skySent uint64
+	skyAddr string
+	err     error
+}
+
+func (o *dummyDepositOperator) record(action, depositID, actor, reason string) (*exchange.DepositInfo, error) {
+	o.action = action
+	o.actor = actor
+	o.reason = reason
+
+	if o.err != nil {
+		return nil, o.err
+	}
+
+	return &exchange.DepositInfo{
+		DepositID:  depositID,
+		Status:     o.status,
+		Txid:       o.txid,
+		SkySent:    o.skySent,
+		SkyAddress: o.skyAddr,
+	}, nil
+}
+
+func (o *dummyDepositOperator) RetryDeposit(depositID, actor, reason string) (*exchange.DepositInfo, error) {
+	o.status = exchange.StatusWaitDecide
+	return o.record(exchange.OperatorActionRetry, depositID, actor, reason)
+}
+
+func (o *dummyDepositOperator) SetDepositStatus(depositID, status, actor, reason string) (*exchange.DepositInfo, error) {
+	o.status = status
+	return o.record(exchange.OperatorActionSetStatus, depositID, actor, reason)
+}
+
+func (o *dummyDepositOperator) CompleteDeposit(depositID, txid string, skySent uint64, actor, reason string) (*exchange.DepositInfo, error) {
+	o.status = exchange.StatusDone
+	o.txid = txid
+	o.skySent = skySent
+	return o.record(exchange.OperatorActionComplete, depositID, actor, reason)
+}
+
+func (o *dummyDepositOperator) SetDepositSkyAddress(depositID, skyAddr, actor, reason string) (*exchange.DepositInfo, error) {
+	o.skyAddr = skyAddr
+	return o.record(exchange.OperatorActionSetSkyAddress, depositID, actor, reason)
+}
+
+func (o *dummyDepositOperator) ApproveDeposit(depositID, actor, reason string) (*exchange.DepositInfo, error) {
+	o.status = exchange.StatusWaitDecide
+	return o.record(exchange.OperatorActionApprove, depositID, actor, reason)
+}
+
+func (o *dummyDepositOperator) RejectDeposit(depositID, actor, reason string) (*exchange.DepositInfo, error) {
+	o.status = exchange.StatusRefundPending
+	return o.record(exchange.OperatorActionReject, depositID, actor, reason)
+}
+
+type dummyReconciler struct {
+	report *exchange.ReconcileReport
+	calls  int
+}
+
+func (r *dummyReconciler) Reconcile() (*exchange.ReconcileReport, error) {
+	r.calls++
+	r.report = &exchange.ReconcileReport{
+		ReconciledAt: 1,
+		Deposits:     2,
+		Issues:       []exchange.ReconcileIssue{},
+	}
+	return r.report, nil
+}
+
+func (r *dummyReconciler) ReconcileReport() *exchange.ReconcileReport {
+	return r.report
+}
+
+type dummyLedger struct {
+	entries []exchange.JournalEntry
+	asOf    int64
+	from    int64
+	to      int64
+}
+
+func (l *dummyLedger) GetLedgerBalances(asOf int64) (exchange.LedgerBalances, error) {
+	l.asOf = asOf
+	return exchange.LedgerBalances{
+		exchange.AccountHotWallet: {
+			config.CoinTypeSKY: -12500000,
+		},
+		exchange.AccountConversion: {
+			config.CoinTypeSKY: 12500000,
+		},
+	}, nil
+}
+
+func (l *dummyLedger) GetJournalEntries(from, to int64) ([]exchange.JournalEntry, error) {
+	l.from = from
+	l.to = to
+	return l.entries, nil
+}
+
+func (l *dummyLedger) AdjustLedger(debit, credit, coinType string, amount int64, actor, reason string) (*exchange.JournalEntry, error) {
+	e := exchange.JournalEntry{
+		Seq:   uint64(len(l.entries) + 1),
+		Type:  exchange.EntryAdjustment,
+		Actor: actor,
+		Memo:  reason,
+		Postings: []exchange.Posting{
+			{Account: debit, CoinType: coinType, Amount: amount},
+			{Account: credit, CoinType: coinType, Amount: -amount},
+		},
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	l.entries = append(l.entries, e)
+	return &e, nil
+}
+
+type dummyPauser struct {
+	changes []exchange.PauseChange
+}
+
+func (p *dummyPauser) PauseStatus() exchange.PauseStatus {
+	var status exchange.PauseStatus
+	for _, c := range p.changes {
+		switch c.Target {
+		case exchange.PauseBind:
+			status.Bind = c.Paused
+		case exchange.PauseSend:
+			status.Send = c.Paused
+		}
+	}
+	return status
+}
+
+func (p *dummyPauser) GetPauseChanges() ([]exchange.PauseChange, error) {
+	return p.changes, nil
+}
+
+func (p *dummyPauser) Pause(target, coinType, actor, reason string) (*exchange.PauseChange, error) {
+	return p.setPaused(target, coinType, true, actor, reason)
+}
+
+func (p *dummyPauser) Resume(target, coinType, actor, reason string) (*exchange.PauseChange, error) {
+	return p.setPaused(target, coinType, false, actor, reason)
+}
+
+func (p *dummyPauser) setPaused(target, coinType string, paused bool, actor, reason string) (*exchange.PauseChange, error) {
+	if err := exchange.ValidatePause(target, coinType); err != nil {
+		return nil, err
+	}
+
+	if p.PauseStatus().Paused(target, coinType) == paused {
+		if paused {
+			return nil, exchange.ErrAlreadyPaused
+		}
+		return nil, exchange.ErrNotPaused
+	}
+
+	c := exchange.PauseChange{
+		Seq:      uint64(len(p.changes) + 1),
+		Target:   target,
+		CoinType: coinType,
+		Paused:   paused,
+		Actor:    actor,
+		Reason:   reason,
+	}
+	p.changes = append(p.changes, c)
+	return &c, nil
+}
+
+type dummyWebhooks struct {
+	replays []string
+}
+
+func (d *dummyWebhooks) LastEventSeq() (uint64, error) {
+	return 3, nil
+}
+
+func (d *dummyWebhooks) EndpointStatuses() ([]webhook.EndpointStatus, error) {
+	return []webhook.EndpointStatus{
+		{URL: "https://crm.example.org/teller", LastSeq: 3},
+	}, nil
+}
+
+func (d *dummyWebhooks) GetFailures() ([]webhook.Failure, error) {
+	return nil, nil
+}
+
+func (d *dummyWebhooks) Replay(url string, fromSeq uint64, actor string) ([]webhook.EndpointStatus, error) {
+	if url != "" && url != "https://crm.example.org/teller" {
+		return nil, webhook.ErrUnknownEndpoint
+	}
+
+	if fromSeq == 0 || fromSeq > 3 {
+		return nil, webhook.ErrInvalidReplaySeq
+	}
+
+	d.replays = append(d.replays, actor)
+	return []webhook.EndpointStatus{
+		{URL: "https://crm.example.org/teller", LastSeq: fromSeq - 1},
+	}, nil
+}
+
+type dummyConfigReloader struct {
+	actors []string
+	err    error
+}
+
+func (r *dummyConfigReloader) ReloadConfig(actor string) (*config.ReloadDiff, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	r.actors = append(r.actors, actor)
+	return &config.ReloadDiff{
+		Applied: []config.Change{
+			{Key: "teller.bind_enabled", Old: "true", New: "false"},
+		},
+		Ignored: []config.Change{
+			{Key: "web.http_addr", Old: "127.0.0.1:7071", New: "127.0.0.1:7072", Reason: config.ReloadRequiresRestart},
+		},
+	}, nil
+}
+
 type dummyScanAddrs struct {
 	// addrs []string
 }
@@ -92,6 +356,14 @@ func (ds dummyScanAddrs) GetScanAddresses(string) ([]string, error) {
 	return []string{}, nil
 }
 
+type dummyScreeningHits struct {
+	hits []screening.Hit
+}
+
+func (dsh dummyScreeningHits) GetHits() ([]screening.Hit, error) {
+	return dsh.hits, nil
+}
+
 func TestRunMonitor(t *testing.T) {
 	dpis := []exchange.DepositInfo{
 		{
@@ -121,7 +393,25 @@ func TestRunMonitor(t *testing.T) {
 		},
 	}
 
-	dummyDps := dummyDepositStatusGetter{dpis: dpis}
+	history := map[string][]exchange.DepositTransition{
+		"t4:1": {
+			{
+				Timestamp: 1522494557,
+				ToStatus:  exchange.StatusWaitDecide,
+				Component: "receive",
+				BuyMethod: config.BuyMethodDirect,
+			},
+			{
+				Timestamp:  1522494558,
+				FromStatus: exchange.StatusWaitDecide,
+				ToStatus:   exchange.StatusWaitSend,
+				Component:  "directbuy",
+				BuyMethod:  config.BuyMethodDirect,
+			},
+		},
+	}
+
+	dummyDps := dummyDepositStatusGetter{dpis: dpis, history: history}
 
 	cfg := config.Config{
 		AdminPanel: config.AdminPanel{
@@ -140,7 +430,17 @@ func TestRunMonitor(t *testing.T) {
 	err = addrMgr.PushGenerator(&dummySkyAddrMgr{12}, config.CoinTypeSKY)
 	require.NoError(t, err)
 
-	m := New(log, cfg, addrMgr, &dummyDps, &dummyScanAddrs{}, &bolt.DB{})
+	hits := []screening.Hit{
+		{
+			Seq:       1,
+			Timestamp: 1519000000,
+			CoinType:  config.CoinTypeSKY,
+			Address:   "2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm",
+			Source:    "bind",
+		},
+	}
+
+	m := New(log, cfg, addrMgr, &dummyDps, &dummyDepositOperator{}, &dummyReconciler{}, &dummyLedger{}, &dummyPauser{}, &dummyConfigReloader{}, &dummyWebhooks{}, &dummyScanAddrs{}, &dummyScreeningHits{hits}, &bolt.DB{})
 
 	done := make(chan struct{})
 	go func() {
@@ -230,6 +530,685 @@ func TestRunMonitor(t *testing.T) {
 		})
 	}
 
+	t.Run("get deposit history", func(t *testing.T) {
+		rsp, err := http.Get("http://localhost:7908/api/deposits/history?id=t4:1")
+		require.NoError(t, err)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var hr depositHistoryResponse
+		err = json.NewDecoder(rsp.Body).Decode(&hr)
+		require.NoError(t, err)
+		require.Equal(t, depositHistoryResponse{
+			DepositID: "t4:1",
+			History:   history["t4:1"],
+		}, hr)
+	})
+
+	t.Run("get deposit history unknown deposit", func(t *testing.T) {
+		rsp, err := http.Get("http://localhost:7908/api/deposits/history?id=t5:1")
+		require.NoError(t, err)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var hr depositHistoryResponse
+		err = json.NewDecoder(rsp.Body).Decode(&hr)
+		require.NoError(t, err)
+		require.Equal(t, []exchange.DepositTransition{}, hr.History)
+	})
+
+	t.Run("get deposit history missing id", func(t *testing.T) {
+		rsp, err := http.Get("http://localhost:7908/api/deposits/history")
+		require.NoError(t, err)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	})
+
+	t.Run("get screening hits", func(t *testing.T) {
+		rsp, err := http.Get("http://localhost:7908/api/screening/hits")
+		require.NoError(t, err)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var rspHits []screening.Hit
+		err = json.NewDecoder(rsp.Body).Decode(&rspHits)
+		require.NoError(t, err)
+		require.Equal(t, hits, rspHits)
+	})
+
 	m.Shutdown()
 	<-done
 }
+
+func postDepositAction(t *testing.T, uri, username, password string, values url.Values) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, uri, strings.NewReader(values.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return rsp
+}
+
+func TestMonitorDepositActions(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	operator := &dummyDepositOperator{}
+	cfg := config.Config{
+		AdminPanel: config.AdminPanel{
+			Users: []string{"alice:secret"},
+		},
+	}
+	m := New(log, cfg, addrs.NewAddrManager(), &dummyDepositStatusGetter{}, operator, &dummyReconciler{}, &dummyLedger{}, &dummyPauser{}, &dummyConfigReloader{}, &dummyWebhooks{}, &dummyScanAddrs{}, &dummyScreeningHits{}, &bolt.DB{})
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	t.Run("missing credentials", func(t *testing.T) {
+		rsp := postDepositAction(t, srv.URL+"/api/deposits/retry", "", "", url.Values{
+			"id":     {"t1:1"},
+			"reason": {"fixed"},
+		})
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		rsp := postDepositAction(t, srv.URL+"/api/deposits/retry", "alice", "wrong", url.Values{
+			"id":     {"t1:1"},
+			"reason": {"fixed"},
+		})
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/deposits/retry?id=t1:1&reason=fixed", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("alice", "secret")
+		rsp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+	})
+
+	t.Run("missing reason", func(t *testing.T) {
+		rsp := postDepositAction(t, srv.URL+"/api/deposits/retry", "alice", "secret", url.Values{
+			"id": {"t1:1"},
+		})
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	})
+
+	t.Run("missing id", func(t *testing.T) {
+		rsp := postDepositAction(t, srv.URL+"/api/deposits/retry", "alice", "secret", url.Values{
+			"reason": {"fixed"},
+		})
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	})
+
+	cases := []struct {
+		name     string
+		uri      string
+		values   url.Values
+		action   string
+		expectDi exchange.DepositInfo
+	}{
+		{
+			name:   "retry",
+			uri:    "/api/deposits/retry",
+			action: exchange.OperatorActionRetry,
+			expectDi: exchange.DepositInfo{
+				DepositID: "t1:1",
+				Status:    exchange.StatusWaitDecide,
+			},
+		},
+		{
+			name: "set status",
+			uri:  "/api/deposits/set-status",
+			values: url.Values{
+				"status": {exchange.StatusWaitSend},
+			},
+			action: exchange.OperatorActionSetStatus,
+			expectDi: exchange.DepositInfo{
+				DepositID: "t1:1",
+				Status:    exchange.StatusWaitSend,
+			},
+		},
+		{
+			name: "complete",
+			uri:  "/api/deposits/complete",
+			values: url.Values{
+				"txid":     {"c2ab0a2bb6e0fa5cd4ba2ab0a0a1a8a1ec9a4ff5da6c1fb2c1b1c8e4a2d6c0a1"},
+				"sky_sent": {"12.5"},
+			},
+			action: exchange.OperatorActionComplete,
+			expectDi: exchange.DepositInfo{
+				DepositID: "t1:1",
+				Status:    exchange.StatusDone,
+				Txid:      "c2ab0a2bb6e0fa5cd4ba2ab0a0a1a8a1ec9a4ff5da6c1fb2c1b1c8e4a2d6c0a1",
+				SkySent:   12500000,
+			},
+		},
+		{
+			name: "set sky address",
+			uri:  "/api/deposits/sky-address",
+			values: url.Values{
+				"sky_address": {"2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW"},
+			},
+			action: exchange.OperatorActionSetSkyAddress,
+			expectDi: exchange.DepositInfo{
+				DepositID:  "t1:1",
+				SkyAddress: "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW",
+			},
+		},
+		{
+			name:   "approve",
+			uri:    "/api/deposits/approve",
+			action: exchange.OperatorActionApprove,
+			expectDi: exchange.DepositInfo{
+				DepositID: "t1:1",
+				Status:    exchange.StatusWaitDecide,
+			},
+		},
+		{
+			name:   "reject",
+			uri:    "/api/deposits/reject",
+			action: exchange.OperatorActionReject,
+			expectDi: exchange.DepositInfo{
+				DepositID: "t1:1",
+				Status:    exchange.StatusRefundPending,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			*operator = dummyDepositOperator{}
+
+			values := url.Values{
+				"id":     {"t1:1"},
+				"reason": {"customer support ticket 12"},
+			}
+			for k, v := range tc.values {
+				values[k] = v
+			}
+
+			rsp := postDepositAction(t, srv.URL+tc.uri, "alice", "secret", values)
+			defer testutil.CheckError(t, rsp.Body.Close)
+			require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+			var di exchange.DepositInfo
+			err := json.NewDecoder(rsp.Body).Decode(&di)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectDi, di)
+
+			require.Equal(t, tc.action, operator.action)
+			require.Equal(t, "alice", operator.actor)
+			require.Equal(t, "customer support ticket 12", operator.reason)
+		})
+	}
+
+	t.Run("invalid sky_sent", func(t *testing.T) {
+		rsp := postDepositAction(t, srv.URL+"/api/deposits/complete", "alice", "secret", url.Values{
+			"id":       {"t1:1"},
+			"reason":   {"fixed"},
+			"sky_sent": {"abc"},
+		})
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	})
+
+	t.Run("deposit not found", func(t *testing.T) {
+		operator.err = dbutil.NewObjectNotExistErr([]byte("deposit_info"), []byte("t9:1"))
+		defer func() {
+			operator.err = nil
+		}()
+
+		rsp := postDepositAction(t, srv.URL+"/api/deposits/retry", "alice", "secret", url.Values{
+			"id":     {"t9:1"},
+			"reason": {"fixed"},
+		})
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+	})
+
+	t.Run("action failed", func(t *testing.T) {
+		operator.err = exchange.ErrDepositNotErrored
+		defer func() {
+			operator.err = nil
+		}()
+
+		rsp := postDepositAction(t, srv.URL+"/api/deposits/retry", "alice", "secret", url.Values{
+			"id":     {"t1:1"},
+			"reason": {"fixed"},
+		})
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	})
+}
+
+func TestMonitorDepositActionsDisabled(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	m := New(log, config.Config{}, addrs.NewAddrManager(), &dummyDepositStatusGetter{}, &dummyDepositOperator{}, &dummyReconciler{}, &dummyLedger{}, &dummyPauser{}, &dummyConfigReloader{}, &dummyWebhooks{}, &dummyScanAddrs{}, &dummyScreeningHits{}, &bolt.DB{})
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp := postDepositAction(t, srv.URL+"/api/deposits/retry", "alice", "secret", url.Values{
+		"id":     {"t1:1"},
+		"reason": {"fixed"},
+	})
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusForbidden, rsp.StatusCode)
+}
+
+func TestMonitorReconcile(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	reconciler := &dummyReconciler{}
+	cfg := config.Config{
+		AdminPanel: config.AdminPanel{
+			Users: []string{"alice:secret"},
+		},
+	}
+	m := New(log, cfg, addrs.NewAddrManager(), &dummyDepositStatusGetter{}, &dummyDepositOperator{}, reconciler, &dummyLedger{}, &dummyPauser{}, &dummyConfigReloader{}, &dummyWebhooks{}, &dummyScanAddrs{}, &dummyScreeningHits{}, &bolt.DB{})
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	getReport := func() *http.Response {
+		rsp, err := http.Get(srv.URL + "/api/reconcile/report")
+		require.NoError(t, err)
+		return rsp
+	}
+
+	rsp := getReport()
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp = postDepositAction(t, srv.URL+"/api/reconcile", "", "", url.Values{})
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+	require.Equal(t, 0, reconciler.calls)
+
+	rsp = postDepositAction(t, srv.URL+"/api/reconcile", "alice", "secret", url.Values{})
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, 1, reconciler.calls)
+
+	var report exchange.ReconcileReport
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&report))
+	require.Equal(t, *reconciler.report, report)
+
+	rsp = getReport()
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	report = exchange.ReconcileReport{}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&report))
+	require.Equal(t, *reconciler.report, report)
+}
+
+func TestMonitorLedger(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	ledger := &dummyLedger{}
+	cfg := config.Config{
+		AdminPanel: config.AdminPanel{
+			Users: []string{"alice:secret"},
+		},
+	}
+	m := New(log, cfg, addrs.NewAddrManager(), &dummyDepositStatusGetter{}, &dummyDepositOperator{}, &dummyReconciler{}, ledger, &dummyPauser{}, &dummyConfigReloader{}, &dummyWebhooks{}, &dummyScanAddrs{}, &dummyScreeningHits{}, &bolt.DB{})
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	t.Run("balances", func(t *testing.T) {
+		rsp, err := http.Get(srv.URL + "/api/ledger/balances?as_of=2018-03-01")
+		require.NoError(t, err)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		asOf := time.Date(2018, 3, 1, 23, 59, 59, 0, time.UTC).Unix()
+		require.Equal(t, asOf, ledger.asOf)
+
+		var resp ledgerBalancesResponse
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&resp))
+		require.Equal(t, asOf, resp.AsOf)
+		require.Len(t, resp.Balances, len(exchange.Accounts))
+		require.Equal(t, "-12.500000", resp.Balances[exchange.AccountHotWallet][config.CoinTypeSKY])
+		require.Equal(t, "12.500000", resp.Balances[exchange.AccountConversion][config.CoinTypeSKY])
+		require.Empty(t, resp.Balances[exchange.AccountDeposits])
+
+		rsp, err = http.Get(srv.URL + "/api/ledger/balances?as_of=yesterday")
+		require.NoError(t, err)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	})
+
+	t.Run("adjust", func(t *testing.T) {
+		values := url.Values{
+			"debit":     {exchange.AccountHotWallet},
+			"credit":    {exchange.AccountAdjustments},
+			"coin_type": {config.CoinTypeSKY},
+			"amount":    {"100.5"},
+			"reason":    {"funded hot wallet"},
+		}
+
+		rsp := postDepositAction(t, srv.URL+"/api/ledger/adjust", "", "", values)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+		require.Empty(t, ledger.entries)
+
+		rsp = postDepositAction(t, srv.URL+"/api/ledger/adjust", "alice", "secret", values)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var e exchange.JournalEntry
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&e))
+		require.Equal(t, "alice", e.Actor)
+		require.Equal(t, "funded hot wallet", e.Memo)
+		require.Equal(t, []exchange.Posting{
+			{Account: exchange.AccountHotWallet, CoinType: config.CoinTypeSKY, Amount: 100500000},
+			{Account: exchange.AccountAdjustments, CoinType: config.CoinTypeSKY, Amount: -100500000},
+		}, e.Postings)
+
+		for _, v := range []url.Values{
+			{"debit": {exchange.AccountHotWallet}, "credit": {exchange.AccountAdjustments}, "coin_type": {config.CoinTypeSKY}, "amount": {"1"}},
+			{"debit": {exchange.AccountHotWallet}, "credit": {exchange.AccountAdjustments}, "coin_type": {config.CoinTypeSKY}, "amount": {"0.0000001"}, "reason": {"x"}},
+			{"debit": {"assets:bank"}, "credit": {exchange.AccountAdjustments}, "coin_type": {config.CoinTypeSKY}, "amount": {"1"}, "reason": {"x"}},
+		} {
+			rsp = postDepositAction(t, srv.URL+"/api/ledger/adjust", "alice", "secret", v)
+			defer testutil.CheckError(t, rsp.Body.Close)
+			require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+		}
+
+		require.Len(t, ledger.entries, 1)
+	})
+
+	t.Run("journal", func(t *testing.T) {
+		ledger.entries[0].Timestamp = 1519862400
+
+		rsp, err := http.Get(srv.URL + "/api/ledger/journal.csv?from=2018-03-01&to=1519948799")
+		require.NoError(t, err)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+		require.Equal(t, "text/csv", rsp.Header.Get("Content-Type"))
+		require.Equal(t, int64(1519862400), ledger.from)
+		require.Equal(t, int64(1519948799), ledger.to)
+
+		rows, err := csv.NewReader(rsp.Body).ReadAll()
+		require.NoError(t, err)
+		require.Equal(t, [][]string{
+			{"seq", "timestamp", "date", "type", "deposit_id", "txid", "actor", "memo", "account", "coin_type", "debit", "credit"},
+			{"1", "1519862400", "2018-03-01T00:00:00Z", "adjustment", "", "", "alice", "funded hot wallet", "assets:hot_wallet", "SKY", "100.500000", ""},
+			{"1", "1519862400", "2018-03-01T00:00:00Z", "adjustment", "", "", "alice", "funded hot wallet", "equity:adjustments", "SKY", "", "100.500000"},
+		}, rows)
+	})
+}
+
+func TestMonitorStats(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	day := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC).Unix()
+	dps := &dummyDepositStatusGetter{
+		periods: map[string][]exchange.StatsPeriod{
+			exchange.StatsIntervalDay: {
+				{
+					Start:        day,
+					Deposits:     map[string]int64{config.CoinTypeBTC: 2},
+					DepositValue: map[string]int64{config.CoinTypeBTC: 15e6},
+					Payouts:      1,
+					SkySent:      12500000,
+					Errors:       3,
+					Stages: map[string]exchange.StageDuration{
+						exchange.StatusWaitSend:       {Count: 2, Seconds: 25},
+						exchange.StageDepositToPayout: {Count: 1, Seconds: 600},
+					},
+				},
+				{
+					Start: day + 86400,
+				},
+			},
+		},
+	}
+
+	m := New(log, config.Config{}, addrs.NewAddrManager(), dps, &dummyDepositOperator{}, &dummyReconciler{}, &dummyLedger{}, &dummyPauser{}, &dummyConfigReloader{}, &dummyWebhooks{}, &dummyScanAddrs{}, &dummyScreeningHits{}, &bolt.DB{})
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/api/stats?to=2018-03-01")
+	require.NoError(t, err)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var resp statsResponse
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&resp))
+	require.Equal(t, statsResponse{
+		Interval: exchange.StatsIntervalDay,
+		Periods: []statsPeriodResponse{
+			{
+				Start: day,
+				Deposits: map[string]int64{
+					config.CoinTypeBTC: 2,
+					config.CoinTypeETH: 0,
+					config.CoinTypeSKY: 0,
+				},
+				DepositValue: map[string]string{
+					config.CoinTypeBTC: "0.15000000",
+					config.CoinTypeETH: "0.000000000000000000",
+					config.CoinTypeSKY: "0.000000",
+				},
+				Payouts: 1,
+				SkySent: "12.500000",
+				Errors:  3,
+				Stages: map[string]statsStageResponse{
+					exchange.StatusWaitSend:       {Count: 2, AverageSeconds: 12.5},
+					exchange.StageDepositToPayout: {Count: 1, AverageSeconds: 600},
+				},
+			},
+		},
+	}, resp)
+
+	rsp, err = http.Get(srv.URL + "/api/stats?interval=hour")
+	require.NoError(t, err)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	resp = statsResponse{}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&resp))
+	require.Equal(t, exchange.StatsIntervalHour, resp.Interval)
+	require.Empty(t, resp.Periods)
+
+	rsp, err = http.Get(srv.URL + "/api/stats?interval=month")
+	require.NoError(t, err)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+}
+
+func TestMonitorPauses(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	pauser := &dummyPauser{}
+	cfg := config.Config{
+		AdminPanel: config.AdminPanel{
+			Users: []string{"alice:secret"},
+		},
+	}
+	m := New(log, cfg, addrs.NewAddrManager(), &dummyDepositStatusGetter{}, &dummyDepositOperator{}, &dummyReconciler{}, &dummyLedger{}, pauser, &dummyConfigReloader{}, &dummyWebhooks{}, &dummyScanAddrs{}, &dummyScreeningHits{}, &bolt.DB{})
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	getPauses := func() pausesResponse {
+		rsp, err := http.Get(srv.URL + "/api/pauses")
+		require.NoError(t, err)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var resp pausesResponse
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&resp))
+		return resp
+	}
+
+	resp := getPauses()
+	require.False(t, resp.Status.Send)
+	require.Empty(t, resp.Changes)
+
+	values := url.Values{
+		"target": {exchange.PauseSend},
+		"reason": {"incident"},
+	}
+
+	rsp := postDepositAction(t, srv.URL+"/api/pause", "", "", values)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+	require.Empty(t, pauser.changes)
+
+	rsp = postDepositAction(t, srv.URL+"/api/pause", "alice", "secret", values)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var c exchange.PauseChange
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&c))
+	require.Equal(t, exchange.PauseChange{
+		Seq:    1,
+		Target: exchange.PauseSend,
+		Paused: true,
+		Actor:  "alice",
+		Reason: "incident",
+	}, c)
+
+	// Pausing twice is a conflict
+	rsp = postDepositAction(t, srv.URL+"/api/pause", "alice", "secret", values)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusConflict, rsp.StatusCode)
+
+	resp = getPauses()
+	require.True(t, resp.Status.Send)
+	require.Equal(t, []exchange.PauseChange{c}, resp.Changes)
+
+	for _, v := range []url.Values{
+		{"target": {exchange.PauseSend}},
+		{"target": {"scan"}, "reason": {"x"}},
+		{"target": {exchange.PauseProcess}, "reason": {"x"}},
+		{"target": {exchange.PauseBind}, "coin_type": {config.CoinTypeBTC}, "reason": {"x"}},
+	} {
+		rsp = postDepositAction(t, srv.URL+"/api/resume", "alice", "secret", v)
+		defer testutil.CheckError(t, rsp.Body.Close)
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	}
+
+	rsp = postDepositAction(t, srv.URL+"/api/resume", "alice", "secret", values)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	resp = getPauses()
+	require.False(t, resp.Status.Send)
+	require.Len(t, resp.Changes, 2)
+	require.False(t, resp.Changes[1].Paused)
+}
+
+func TestMonitorReloadConfig(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	reloader := &dummyConfigReloader{}
+	cfg := config.Config{
+		AdminPanel: config.AdminPanel{
+			Users: []string{"alice:secret"},
+		},
+	}
+	m := New(log, cfg, addrs.NewAddrManager(), &dummyDepositStatusGetter{}, &dummyDepositOperator{}, &dummyReconciler{}, &dummyLedger{}, &dummyPauser{}, reloader, &dummyWebhooks{}, &dummyScanAddrs{}, &dummyScreeningHits{}, &bolt.DB{})
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/api/config/reload")
+	require.NoError(t, err)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+
+	rsp = postDepositAction(t, srv.URL+"/api/config/reload", "alice", "wrong", url.Values{})
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+	require.Empty(t, reloader.actors)
+
+	rsp = postDepositAction(t, srv.URL+"/api/config/reload", "alice", "secret", url.Values{})
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, []string{"alice"}, reloader.actors)
+
+	var diff config.ReloadDiff
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&diff))
+	require.Len(t, diff.Applied, 1)
+	require.Equal(t, "teller.bind_enabled", diff.Applied[0].Key)
+	require.Len(t, diff.Ignored, 1)
+	require.Equal(t, config.ReloadRequiresRestart, diff.Ignored[0].Reason)
+
+	// An invalid config is rejected
+	reloader.err = errors.New("sky_exchanger.sky_btc_exchange_rate invalid")
+	rsp = postDepositAction(t, srv.URL+"/api/config/reload", "alice", "secret", url.Values{})
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+}
+
+func TestMonitorWebhooks(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	webhooks := &dummyWebhooks{}
+	cfg := config.Config{
+		AdminPanel: config.AdminPanel{
+			Users: []string{"alice:secret"},
+		},
+	}
+	m := New(log, cfg, addrs.NewAddrManager(), &dummyDepositStatusGetter{}, &dummyDepositOperator{}, &dummyReconciler{}, &dummyLedger{}, &dummyPauser{}, &dummyConfigReloader{}, webhooks, &dummyScanAddrs{}, &dummyScreeningHits{}, &bolt.DB{})
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/api/webhooks")
+	require.NoError(t, err)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var resp webhooksResponse
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&resp))
+	require.Equal(t, uint64(3), resp.LastEventSeq)
+	require.Len(t, resp.Endpoints, 1)
+	require.NotNil(t, resp.Failures)
+
+	// Replaying requires an operator's credentials
+	rsp, err = http.PostForm(srv.URL+"/api/webhooks/replay", url.Values{"from": []string{"1"}})
+	require.NoError(t, err)
+	defer testutil.CheckError(t, rsp.Body.Close)
+	require.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+
+	cases := []struct {
+		name   string
+		args   url.Values
+		status int
+	}{
+		{"missing from", url.Values{}, http.StatusBadRequest},
+		{"invalid from", url.Values{"from": []string{"x"}}, http.StatusBadRequest},
+		{"from out of range", url.Values{"from": []string{"4"}}, http.StatusBadRequest},
+		{"unknown url", url.Values{"from": []string{"1"}, "url": []string{"https://example.org"}}, http.StatusNotFound},
+		{"all endpoints", url.Values{"from": []string{"2"}}, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rsp := postDepositAction(t, srv.URL+"/api/webhooks/replay", "alice", "secret", tc.args)
+			defer testutil.CheckError(t, rsp.Body.Close)
+			require.Equal(t, tc.status, rsp.StatusCode)
+		})
+	}
+
+	require.Equal(t, []string{"alice"}, webhooks.replays)
+}
@@ -37,6 +37,7 @@ type commonScanner interface {
 	GetDeposit() <-chan DepositNote
 	GetQuitChan() <-chan struct{}
 	GetScannedDepositChan() chan<- Deposit
+	ScanStatus() ScanStatus
 	Shutdown()
 	Run(
 		getBlockCount func() (int64, error),
@@ -57,6 +58,18 @@ type BaseScanner struct {
 	quit            chan struct{}
 	done            chan struct{}
 	CoinType        string
+
+	statusLock sync.RWMutex
+	status     ScanStatus
+}
+
+// ScanStatus reports a scanner's progress through the blockchain
+type ScanStatus struct {
+	CoinType   string `json:"coin_type"`
+	Height     int64  `json:"height"`      // The last block scanned
+	BestHeight int64  `json:"best_height"` // The height of the best block when it was last checked
+	CheckedAt  int64  `json:"checked_at"`  // When the best block was last checked successfully
+	ScannedAt  int64  `json:"scanned_at"`  // When a block was last scanned
 }
 
 // CommonVout common transaction output info
@@ -66,12 +79,62 @@ type CommonVout struct {
 	Address string
 }
 
+// CommonVin common transaction input info.
+// Address is the address that owned the spent output, if known.
+// Txid and Vout reference the spent output, where the chain requires it to be looked up.
+type CommonVin struct {
+	Txid    string
+	Vout    uint32
+	Address string
+}
+
 // CommonTx common transaction info
 type CommonTx struct {
 	Txid string
+	Vin  []CommonVin
 	Vout []CommonVout
 }
 
+// SourceAddresses returns the known addresses of a transaction's inputs, without duplicates
+func (tx CommonTx) SourceAddresses() []string {
+	var addrs []string
+	seen := make(map[string]struct{}, len(tx.Vin))
+	for _, v := range tx.Vin {
+		if v.Address == "" {
+			continue
+		}
+
+		if _, ok := seen[v.Address]; ok {
+			continue
+		}
+
+		seen[v.Address] = struct{}{}
+		addrs = append(addrs, v.Address)
+	}
+
+	return addrs
+}
+
+// depositTxIndexes returns the indexes of the transactions in a block that pay to a scan address
+func depositTxIndexes(block *CommonBlock, scanAddrs []string) []int {
+	addrMap := make(map[string]struct{}, len(scanAddrs))
+	for _, a := range scanAddrs {
+		addrMap[a] = struct{}{}
+	}
+
+	var idxs []int
+	for i, tx := range block.RawTx {
+		for _, v := range tx.Vout {
+			if _, ok := addrMap[v.Address]; ok {
+				idxs = append(idxs, i)
+				break
+			}
+		}
+	}
+
+	return idxs
+}
+
 // CommonBlock interface argument, other coin's block must convert to this type
 type CommonBlock struct {
 	Height   int64
@@ -99,6 +162,9 @@ func NewBaseScanner(store Storer, log logrus.FieldLogger, coinType string, cfg C
 		done:            make(chan struct{}),
 		Cfg:             cfg,
 		CoinType:        coinType,
+		status: ScanStatus{
+			CoinType: coinType,
+		},
 	}
 }
 
@@ -198,6 +264,27 @@ func (s *BaseScanner) Shutdown() {
 	close(s.depositC)
 }
 
+// ScanStatus returns the scanner's progress through the blockchain
+func (s *BaseScanner) ScanStatus() ScanStatus {
+	s.statusLock.RLock()
+	defer s.statusLock.RUnlock()
+	return s.status
+}
+
+func (s *BaseScanner) setBestHeight(bestHeight int64) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	s.status.BestHeight = bestHeight
+	s.status.CheckedAt = time.Now().UTC().Unix()
+}
+
+func (s *BaseScanner) setScannedHeight(height int64) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	s.status.Height = height
+	s.status.ScannedAt = time.Now().UTC().Unix()
+}
+
 // Run starts the scanner
 func (s *BaseScanner) Run(
 	getBlockCount func() (int64, error),
@@ -285,6 +372,7 @@ func (s *BaseScanner) Run(
 			}
 
 			log = log.WithField("bestHeight", bestHeight)
+			s.setBestHeight(bestHeight)
 
 			// If not enough confirmations exist for this block, wait
 			if blockHeight+s.Cfg.ConfirmationsRequired > bestHeight {
@@ -310,6 +398,8 @@ func (s *BaseScanner) Run(
 				continue
 			}
 
+			s.setScannedHeight(blockHeight)
+
 			deposits += n
 			log.WithFields(logrus.Fields{
 				"scannedDeposits":      n,
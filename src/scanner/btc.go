@@ -16,6 +16,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
 )
 
 var (
@@ -48,6 +49,11 @@ func (s *BTCScanner) Run() error {
 	return s.base.Run(s.GetBlockCount, s.getBlockAtHeight, s.waitForNextBlock, s.scanBlock)
 }
 
+// ScanStatus returns the scanner's progress through the blockchain
+func (s *BTCScanner) ScanStatus() ScanStatus {
+	return s.base.ScanStatus()
+}
+
 // Shutdown shutdown the scanner
 func (s *BTCScanner) Shutdown() {
 	s.log.Info("Closing BTC scanner")
@@ -66,6 +72,11 @@ func (s *BTCScanner) scanBlock(block *CommonBlock) (int, error) {
 
 	log.Debug("Scanning block")
 
+	if err := s.resolveSourceAddresses(block); err != nil {
+		log.WithError(err).Error("resolveSourceAddresses failed")
+		return 0, err
+	}
+
 	dvs, err := s.base.GetStorer().ScanBlock(block, config.CoinTypeBTC)
 	if err != nil {
 		log.WithError(err).Error("store.ScanBlock failed")
@@ -88,6 +99,61 @@ func (s *BTCScanner) scanBlock(block *CommonBlock) (int, error) {
 	return n, nil
 }
 
+// resolveSourceAddresses looks up the addresses of the spent outputs of the transactions
+// that pay to a scan address. Inputs whose previous transaction can't be loaded are left
+// without an address, so that the deposit is still recorded.
+func (s *BTCScanner) resolveSourceAddresses(block *CommonBlock) error {
+	addrs, err := s.GetScanAddresses()
+	if err != nil {
+		return err
+	}
+
+	for _, i := range depositTxIndexes(block, addrs) {
+		tx := &block.RawTx[i]
+		prevTxs := make(map[string]*btcjson.TxRawResult)
+
+		for j := range tx.Vin {
+			vin := &tx.Vin[j]
+			log := s.log.WithFields(logrus.Fields{
+				"txid":     tx.Txid,
+				"prevTxid": vin.Txid,
+				"prevVout": vin.Vout,
+			})
+
+			prevTx, ok := prevTxs[vin.Txid]
+			if !ok {
+				hash, err := chainhash.NewHashFromStr(vin.Txid)
+				if err != nil {
+					log.WithError(err).Error("chainhash.NewHashFromStr failed")
+					continue
+				}
+
+				prevTx, err = s.btcClient.GetRawTransactionVerbose(hash)
+				if err != nil {
+					log.WithError(err).WithField("notice", logger.WatchNotice).Error("btcClient.GetRawTransactionVerbose failed, source address unknown")
+					continue
+				}
+
+				prevTxs[vin.Txid] = prevTx
+			}
+
+			if int(vin.Vout) >= len(prevTx.Vout) {
+				log.Error("Spent output is missing from the previous transaction")
+				continue
+			}
+
+			prevAddrs := prevTx.Vout[vin.Vout].ScriptPubKey.Addresses
+			if len(prevAddrs) != 1 {
+				continue
+			}
+
+			vin.Address = prevAddrs[0]
+		}
+	}
+
+	return nil
+}
+
 //GetBlockCount returns bitcoin block count
 func (s *BTCScanner) GetBlockCount() (int64, error) {
 	return s.btcClient.GetBlockCount()
@@ -128,8 +194,21 @@ func btcBlock2CommonBlock(block *btcjson.GetBlockVerboseResult) (*CommonBlock, e
 	for _, tx := range block.RawTx {
 		cbTx := CommonTx{}
 		cbTx.Txid = tx.Txid
+		cbTx.Vin = make([]CommonVin, 0, len(tx.Vin))
 		cbTx.Vout = make([]CommonVout, 0, len(tx.Vout))
 
+		for _, v := range tx.Vin {
+			if v.IsCoinBase() {
+				continue
+			}
+
+			// The spent output's address is resolved when the tx is a deposit
+			cbTx.Vin = append(cbTx.Vin, CommonVin{
+				Txid: v.Txid,
+				Vout: v.Vout,
+			})
+		}
+
 		for _, v := range tx.Vout {
 			amt, err := btcutil.NewAmount(v.Value)
 			if err != nil {
@@ -44,6 +44,9 @@ type dummyBtcrpcclient struct {
 	// used for testBtcScannerBlockNextHashAppears
 	blockNextHashMissingOnceAt int64
 	hasSetMissingHash          bool
+
+	// previous transactions of deposits, by txid
+	rawTxs map[string]*btcjson.TxRawResult
 }
 
 func openDummyBtcDB(t *testing.T) *bolt.DB {
@@ -109,6 +112,15 @@ func (dbc *dummyBtcrpcclient) GetBlockVerboseTx(hash *chainhash.Hash) (*btcjson.
 	return block, nil
 }
 
+func (dbc *dummyBtcrpcclient) GetRawTransactionVerbose(hash *chainhash.Hash) (*btcjson.TxRawResult, error) {
+	tx, ok := dbc.rawTxs[hash.String()]
+	if !ok {
+		return nil, fmt.Errorf("no transaction found with txid %s", hash.String())
+	}
+
+	return tx, nil
+}
+
 func (dbc *dummyBtcrpcclient) GetBlockCount() (int64, error) {
 	if dbc.blockCountError != nil {
 		// blockCountError is only returned once
@@ -574,3 +586,60 @@ func TestBtcScanner(t *testing.T) {
 		})
 	})
 }
+
+func TestBtcScannerResolveSourceAddresses(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	scr := setupBtcScannerWithDB(t, nil, db)
+
+	depositAddr := "1LcEkgX8DCrQczLMVh9LDTRnkdVV2oun3A"
+	err := scr.AddScanAddress(depositAddr, config.CoinTypeBTC)
+	require.NoError(t, err)
+
+	prevTxid := "a5f1e2c0b3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e"
+	missingTxid := "0000000000000000000000000000000000000000000000000000000000000001"
+
+	scr.btcClient.(*dummyBtcrpcclient).rawTxs = map[string]*btcjson.TxRawResult{
+		prevTxid: {
+			Txid: prevTxid,
+			Vout: []btcjson.Vout{
+				{N: 0, ScriptPubKey: btcjson.ScriptPubKeyResult{Addresses: []string{"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGLRRUz"}}},
+				{N: 1, ScriptPubKey: btcjson.ScriptPubKeyResult{Addresses: []string{"13sHcgdvfMWJZ7Z3yXgJVpS3tk1S6m8sP7"}}},
+			},
+		},
+	}
+
+	block, err := btcBlock2CommonBlock(&btcjson.GetBlockVerboseResult{
+		Height: 235206,
+		RawTx: []btcjson.TxRawResult{
+			{
+				Txid: "coinbase",
+				Vin:  []btcjson.Vin{{Coinbase: "03c69603"}},
+				Vout: []btcjson.Vout{{Value: 25, ScriptPubKey: btcjson.ScriptPubKeyResult{Addresses: []string{"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGLRRUz"}}}},
+			},
+			{
+				Txid: "deposit",
+				Vin: []btcjson.Vin{
+					{Txid: prevTxid, Vout: 1},
+					{Txid: prevTxid, Vout: 0},
+					{Txid: missingTxid, Vout: 0},
+				},
+				Vout: []btcjson.Vout{{Value: 0.1, ScriptPubKey: btcjson.ScriptPubKeyResult{Addresses: []string{depositAddr}}}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// Coinbase inputs don't spend an output
+	require.Empty(t, block.RawTx[0].Vin)
+	require.Len(t, block.RawTx[1].Vin, 3)
+
+	err = scr.resolveSourceAddresses(block)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"13sHcgdvfMWJZ7Z3yXgJVpS3tk1S6m8sP7",
+		"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGLRRUz",
+	}, block.RawTx[1].SourceAddresses())
+}
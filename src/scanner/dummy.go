@@ -148,14 +148,18 @@ func (s *DummyScanner) addDepositHandler(w http.ResponseWriter, r *http.Request)
 		n = uint32(n64)
 	}
 
+	// Optional, may be repeated
+	sourceAddrs := r.Form["source"]
+
 	select {
 	case s.deposits <- NewDepositNote(Deposit{
-		CoinType: coinType,
-		Address:  addr,
-		Value:    value,
-		Height:   height,
-		Tx:       tx,
-		N:        n,
+		CoinType:        coinType,
+		Address:         addr,
+		Value:           value,
+		Height:          height,
+		Tx:              tx,
+		N:               n,
+		SourceAddresses: sourceAddrs,
 	}):
 	default:
 		httputil.ErrResponse(w, http.StatusServiceUnavailable, "deposits channel is full")
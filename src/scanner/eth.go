@@ -46,6 +46,11 @@ func (s *ETHScanner) Run() error {
 	return s.base.Run(s.ethClient.GetBlockCount, s.getBlockAtHeight, s.waitForNextBlock, s.scanBlock)
 }
 
+// ScanStatus returns the scanner's progress through the blockchain
+func (s *ETHScanner) ScanStatus() ScanStatus {
+	return s.base.ScanStatus()
+}
+
 // Shutdown shutdown the scanner
 func (s *ETHScanner) Shutdown() {
 	s.log.Info("Closing ETH scanner")
@@ -172,6 +177,13 @@ func ethBlock2CommonBlock(block *types.Block) (*CommonBlock, error) {
 		}
 		cbTx := CommonTx{}
 		cbTx.Txid = tx.Hash().String()
+		cbTx.Vin = make([]CommonVin, 0, 1)
+		// The sender is recovered from the signature. If it can't be, the deposit is recorded without it
+		if from, err := ethTxSender(tx); err == nil {
+			cbTx.Vin = append(cbTx.Vin, CommonVin{
+				Address: strings.ToLower(from.String()),
+			})
+		}
 		cbTx.Vout = make([]CommonVout, 0, 1)
 		//1 eth = 1e18 wei ,tx.Value() is very big that may overflow(int64), so store it as Gwei(1Gwei=1e9wei) and recover it when used
 		amt := mathutil.Wei2Gwei(tx.Value())
@@ -188,6 +200,16 @@ func ethBlock2CommonBlock(block *types.Block) (*CommonBlock, error) {
 	return &cb, nil
 }
 
+// ethTxSender returns the address that signed a transaction
+func ethTxSender(tx *types.Transaction) (common.Address, error) {
+	var signer types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+
+	return types.Sender(signer, tx)
+}
+
 // EthClient is self-defined struct for implement EthRPCClient interface
 // because origin rpc.Client has't required interface
 type EthClient struct {
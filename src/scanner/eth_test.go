@@ -3,12 +3,15 @@ package scanner
 import (
 	"encoding/json"
 	"errors"
+	"math/big"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/stretchr/testify/require"
 
 	"github.com/skycoin/teller/src/config"
@@ -583,3 +586,35 @@ func TestEthScanner(t *testing.T) {
 		})
 	})
 }
+
+func TestEthBlock2CommonBlockSourceAddress(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	from := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).String())
+
+	to := common.HexToAddress("0x392cded14b8f12cb6cbb1c7922810f4fbd80c3f6")
+	amount := big.NewInt(1e18)
+
+	// A replay protected transaction
+	eip155Tx, err := types.SignTx(types.NewTransaction(0, to, amount, 21000, big.NewInt(1), nil), types.NewEIP155Signer(big.NewInt(1)), key)
+	require.NoError(t, err)
+
+	// A transaction signed before replay protection
+	homesteadTx, err := types.SignTx(types.NewTransaction(1, to, amount, 21000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+	require.NoError(t, err)
+
+	// An unsigned transaction
+	unsignedTx := types.NewTransaction(2, to, amount, 21000, big.NewInt(1), nil)
+
+	block := types.NewBlockWithHeader(&types.Header{
+		Number: big.NewInt(100),
+	}).WithBody([]*types.Transaction{eip155Tx, homesteadTx, unsignedTx}, nil)
+
+	cb, err := ethBlock2CommonBlock(block)
+	require.NoError(t, err)
+	require.Len(t, cb.RawTx, 3)
+
+	require.Equal(t, []string{from}, cb.RawTx[0].SourceAddresses())
+	require.Equal(t, []string{from}, cb.RawTx[1].SourceAddresses())
+	require.Empty(t, cb.RawTx[2].SourceAddresses())
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 
 	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/visor/historydb"
 )
 
 // Scanner provids apis for interacting with a scan service
@@ -21,6 +22,7 @@ type BtcRPCClient interface {
 	GetBlockVerboseTx(*chainhash.Hash) (*btcjson.GetBlockVerboseResult, error)
 	GetBlockHash(int64) (*chainhash.Hash, error)
 	GetBlockCount() (int64, error)
+	GetRawTransactionVerbose(*chainhash.Hash) (*btcjson.TxRawResult, error)
 	Shutdown()
 }
 
@@ -36,6 +38,7 @@ type EthRPCClient interface {
 type SkyRPCClient interface {
 	GetBlockVerboseTx(seq uint64) (*visor.ReadableBlock, error)
 	GetBlockCount() (int64, error)
+	GetUxOut(uxID string) (*historydb.UxOutJSON, error)
 	Shutdown()
 }
 
@@ -62,6 +65,8 @@ type Deposit struct {
 	Tx        string `json:"tx"`        // the transaction id
 	N         uint32 `json:"n"`         // the index of vout in the tx [BTC]
 	Processed bool   `json:"processed"` // whether this was received by the exchange and saved
+	// the addresses that funded the tx, if they could be resolved
+	SourceAddresses []string `json:"source_addresses"`
 }
 
 // ID returns $tx:$n formatted ID string
@@ -8,8 +8,10 @@ import (
 	"github.com/skycoin/skycoin/src/gui"
 	"github.com/skycoin/skycoin/src/util/droplet"
 	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/visor/historydb"
 
 	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
 )
 
 // SKYScanner blockchain scanner to check if there're deposit coins
@@ -49,6 +51,11 @@ func (s *SKYScanner) Run() error {
 	return s.base.Run(s.skyClient.GetBlockCount, s.getBlockAtHeight, s.waitForNextBlock, s.scanBlock)
 }
 
+// ScanStatus returns the scanner's progress through the blockchain
+func (s *SKYScanner) ScanStatus() ScanStatus {
+	return s.base.ScanStatus()
+}
+
 // Shutdown shutdown the scanner
 func (s *SKYScanner) Shutdown() {
 	s.log.Info("Closing SKY scanner")
@@ -67,6 +74,11 @@ func (s *SKYScanner) scanBlock(block *CommonBlock) (int, error) {
 
 	log.Debug("Scanning block")
 
+	if err := s.resolveSourceAddresses(block); err != nil {
+		log.WithError(err).Error("resolveSourceAddresses failed")
+		return 0, err
+	}
+
 	dvs, err := s.base.GetStorer().ScanBlock(block, config.CoinTypeSKY)
 	if err != nil {
 		log.WithError(err).Error("store.ScanBlock failed")
@@ -89,6 +101,36 @@ func (s *SKYScanner) scanBlock(block *CommonBlock) (int, error) {
 	return n, nil
 }
 
+// resolveSourceAddresses looks up the owners of the spent outputs of the transactions
+// that pay to a scan address. Inputs whose output can't be loaded are left
+// without an address, so that the deposit is still recorded.
+func (s *SKYScanner) resolveSourceAddresses(block *CommonBlock) error {
+	addrs, err := s.GetScanAddresses()
+	if err != nil {
+		return err
+	}
+
+	for _, i := range depositTxIndexes(block, addrs) {
+		tx := &block.RawTx[i]
+		for j := range tx.Vin {
+			vin := &tx.Vin[j]
+
+			ux, err := s.skyClient.GetUxOut(vin.Txid)
+			if err != nil {
+				s.log.WithError(err).WithFields(logrus.Fields{
+					"txid": tx.Txid,
+					"uxid": vin.Txid,
+				}).WithField("notice", logger.WatchNotice).Error("skyClient.GetUxOut failed, source address unknown")
+				continue
+			}
+
+			vin.Address = ux.OwnerAddress
+		}
+	}
+
+	return nil
+}
+
 //GetBlockCount returns skycoin block count
 func (sc *SkyClient) GetBlockCount() (int64, error) {
 	// get the last block
@@ -114,6 +156,11 @@ func (sc *SkyClient) GetBlockVerboseTx(seq uint64) (*visor.ReadableBlock, error)
 	return block, nil
 }
 
+// GetUxOut returns an unspent or spent output
+func (sc *SkyClient) GetUxOut(uxID string) (*historydb.UxOutJSON, error) {
+	return sc.c.UxOut(uxID)
+}
+
 // Shutdown placeholder
 func (sc *SkyClient) Shutdown() {
 }
@@ -136,6 +183,13 @@ func skyBlock2CommonBlock(block *visor.ReadableBlock) (*CommonBlock, error) {
 	for _, tx := range block.Body.Transactions {
 		cbTx := CommonTx{}
 		cbTx.Txid = tx.Hash
+		cbTx.Vin = make([]CommonVin, 0, len(tx.In))
+		for _, in := range tx.In {
+			// The spent output's owner is resolved when the tx is a deposit
+			cbTx.Vin = append(cbTx.Vin, CommonVin{
+				Txid: in,
+			})
+		}
 		cbTx.Vout = make([]CommonVout, 0, len(tx.Out))
 		for _, v := range tx.Out {
 			// internally skycoins are always represented as droplets
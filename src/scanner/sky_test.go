@@ -17,6 +17,7 @@ import (
 	"github.com/skycoin/skycoin/src/cipher/encoder"
 	"github.com/skycoin/skycoin/src/coin"
 	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/visor/historydb"
 )
 
 var (
@@ -38,6 +39,9 @@ type dummySkyrpcclient struct {
 	// used for testBtcScannerBlockNextHashAppears
 	blockNextHeightMissingOnceAt uint64
 	hasSetMissingHeight          bool
+
+	// owner addresses of outputs, by uxid
+	uxOutOwners map[string]string
 }
 
 func openDummySkyDB(t *testing.T) *bolt.DB {
@@ -126,6 +130,18 @@ func Itob(v uint64) []byte {
 	return b
 }
 
+func (dsc *dummySkyrpcclient) GetUxOut(uxID string) (*historydb.UxOutJSON, error) {
+	owner, ok := dsc.uxOutOwners[uxID]
+	if !ok {
+		return nil, errors.New("uxout not found")
+	}
+
+	return &historydb.UxOutJSON{
+		Uxid:         uxID,
+		OwnerAddress: owner,
+	}, nil
+}
+
 func (dsc *dummySkyrpcclient) Shutdown() {}
 
 func setupSkyScannerWithDB(t *testing.T, skyDB *bolt.DB, db *bolt.DB) *SKYScanner {
@@ -536,3 +552,49 @@ func TestSkyScanner(t *testing.T) {
 	})
 
 }
+
+func TestSkyScannerResolveSourceAddresses(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	scr := setupSkyScannerWithDB(t, nil, db)
+
+	depositAddr := "cBnu9sUvv12dovBmjQKTtfE4rbjMmf3fzW"
+	err := scr.AddScanAddress(depositAddr, config.CoinTypeSKY)
+	require.NoError(t, err)
+
+	scr.skyClient.(*dummySkyrpcclient).uxOutOwners = map[string]string{
+		"ux1": "2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm",
+		"ux2": "2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm",
+		"ux4": "v7Wc4hnU6ftJzJsmGjymZW9aktqBj6JjLj",
+	}
+
+	block := &CommonBlock{
+		Height: 10,
+		RawTx: []CommonTx{
+			{
+				Txid: "deposit",
+				Vin:  []CommonVin{{Txid: "ux1"}, {Txid: "ux2"}, {Txid: "ux3"}},
+				Vout: []CommonVout{{Address: depositAddr, Value: 1e6}},
+			},
+			{
+				Txid: "other",
+				Vin:  []CommonVin{{Txid: "ux4"}},
+				Vout: []CommonVout{{Address: "2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm", Value: 1e6}},
+			},
+		},
+	}
+
+	err = scr.resolveSourceAddresses(block)
+	require.NoError(t, err)
+
+	// The output that can't be loaded is left unresolved
+	require.Equal(t, []string{"2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm"}, block.RawTx[0].SourceAddresses())
+	// Transactions that are not deposits are not resolved
+	require.Empty(t, block.RawTx[1].SourceAddresses())
+
+	dvs, err := scr.base.GetStorer().ScanBlock(block, config.CoinTypeSKY)
+	require.NoError(t, err)
+	require.Len(t, dvs, 1)
+	require.Equal(t, []string{"2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm"}, dvs[0].SourceAddresses)
+}
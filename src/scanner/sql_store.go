@@ -0,0 +1,358 @@
+package scanner
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/sqlutil"
+)
+
+// sqlSchema creates the scanner tables.
+// The deposit addresses of the scan_meta buckets are merged into scan_addresses.
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS scan_addresses (
+		coin_type TEXT NOT NULL,
+		address TEXT NOT NULL,
+		seq BIGINT NOT NULL,
+		PRIMARY KEY (coin_type, address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS deposit_value (
+		deposit_id TEXT PRIMARY KEY,
+		coin_type TEXT NOT NULL,
+		processed BOOLEAN NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS deposit_value_processed ON deposit_value (coin_type, processed)`,
+}
+
+var (
+	scanAddressesTable = "scan_addresses"
+	depositTable       = string(DepositBkt)
+)
+
+// SQLStore records scanner meta info in a SQL database
+type SQLStore struct {
+	db  *sqlutil.DB
+	log logrus.FieldLogger
+}
+
+// NewSQLStore creates a scanner SQLStore
+func NewSQLStore(log logrus.FieldLogger, db *sqlutil.DB) (*SQLStore, error) {
+	if db == nil {
+		return nil, errors.New("new SQLStore failed: db is nil")
+	}
+
+	if err := db.CreateTables(sqlSchema); err != nil {
+		return nil, err
+	}
+
+	return &SQLStore{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+// AddSupportedCoin checks that a coin type is supported. The tables are shared by all coin types.
+func (s *SQLStore) AddSupportedCoin(coinType string) error {
+	_, err := GetScanMetaBkt(coinType)
+	return err
+}
+
+// GetScanAddresses returns all scan addresses, in the order they were added
+func (s *SQLStore) GetScanAddresses(coinType string) ([]string, error) {
+	var addrs []string
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var err error
+		addrs, err = getScanAddressesSQLTx(tx, coinType)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return addrs, nil
+}
+
+func getScanAddressesSQLTx(tx *sqlutil.Tx, coinType string) ([]string, error) {
+	if _, err := GetScanMetaBkt(coinType); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT address FROM scan_addresses WHERE coin_type = ? ORDER BY seq", coinType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addrs []string
+	for rows.Next() {
+		var addr string
+		if err := rows.Scan(&addr); err != nil {
+			return nil, err
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, rows.Err()
+}
+
+// AddScanAddress adds an address to the scan list
+func (s *SQLStore) AddScanAddress(addr, coinType string) error {
+	if _, err := GetScanMetaBkt(coinType); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *sqlutil.Tx) error {
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM scan_addresses WHERE coin_type = ? AND address = ?",
+			coinType, addr).Scan(&n); err != nil {
+			return err
+		}
+
+		if n != 0 {
+			return NewDuplicateDepositAddressErr(addr)
+		}
+
+		seq, err := sqlutil.NextSequence(tx, scanAddressesTable)
+		if err != nil {
+			return err
+		}
+
+		return putScanAddressSQLTx(tx, coinType, addr, seq)
+	})
+}
+
+func putScanAddressSQLTx(tx *sqlutil.Tx, coinType, addr string, seq uint64) error {
+	_, err := tx.Exec("INSERT INTO scan_addresses (coin_type, address, seq) VALUES (?, ?, ?)", coinType, addr, int64(seq))
+	return err
+}
+
+// SetDepositProcessed marks a Deposit as processed
+func (s *SQLStore) SetDepositProcessed(dvKey string) error {
+	return s.db.Update(func(tx *sqlutil.Tx) error {
+		var data string
+		err := tx.QueryRow("SELECT data FROM deposit_value WHERE deposit_id = ?", dvKey).Scan(&data)
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			return dbutil.NewObjectNotExistErr(DepositBkt, []byte(dvKey))
+		default:
+			return err
+		}
+
+		var dv Deposit
+		if err := json.Unmarshal([]byte(data), &dv); err != nil {
+			return err
+		}
+
+		if dv.ID() != dvKey {
+			return errors.New("CRITICAL ERROR: dv.ID() != dvKey")
+		}
+
+		dv.Processed = true
+
+		return putDepositSQLTx(tx, dv)
+	})
+}
+
+// putDepositSQLTx inserts or replaces a Deposit
+func putDepositSQLTx(tx *sqlutil.Tx, dv Deposit) error {
+	b, err := json.Marshal(dv)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO deposit_value (deposit_id, coin_type, processed, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (deposit_id) DO UPDATE SET processed = excluded.processed, data = excluded.data`,
+		dv.ID(), dv.CoinType, dv.Processed, string(b))
+	return err
+}
+
+// GetUnprocessedDeposits returns all Deposits not marked as Processed
+func (s *SQLStore) GetUnprocessedDeposits(coinType string) ([]Deposit, error) {
+	var dvs []Deposit
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		rows, err := tx.Query("SELECT data FROM deposit_value WHERE coin_type = ? AND processed = ? ORDER BY deposit_id",
+			coinType, false)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+
+			var dv Deposit
+			if err := json.Unmarshal([]byte(data), &dv); err != nil {
+				return err
+			}
+
+			dvs = append(dvs, dv)
+		}
+
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	return dvs, nil
+}
+
+// ScanBlock scans a coin block for deposits and adds them
+// If the deposit already exists, the result is omitted from the returned list
+func (s *SQLStore) ScanBlock(block *CommonBlock, coinType string) ([]Deposit, error) {
+	var dvs []Deposit
+
+	if err := s.db.Update(func(tx *sqlutil.Tx) error {
+		addrs, err := getScanAddressesSQLTx(tx, coinType)
+		if err != nil {
+			s.log.WithError(err).Error("getScanAddressesSQLTx failed")
+			return err
+		}
+
+		deposits, err := scanSpecifiedBlock(block, coinType, addrs)
+		if err != nil {
+			s.log.WithError(err).Error("ScanBlock failed")
+			return err
+		}
+
+		for _, dv := range deposits {
+			log := s.log.WithField("deposit", dv)
+
+			var n int
+			if err := tx.QueryRow("SELECT COUNT(*) FROM deposit_value WHERE deposit_id = ?", dv.ID()).Scan(&n); err != nil {
+				log.WithError(err).Error("Check deposit exists failed")
+				return err
+			}
+
+			if n != 0 {
+				log.Warning("Deposit already exists in db")
+				continue
+			}
+
+			if err := putDepositSQLTx(tx, dv); err != nil {
+				log.WithError(err).Error("putDepositSQLTx failed")
+				return err
+			}
+
+			dvs = append(dvs, dv)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return dvs, nil
+}
+
+// ImportBolt copies the scan addresses and deposits of a bolt database
+func (s *SQLStore) ImportBolt(db *bolt.DB) error {
+	return db.View(func(boltTx *bolt.Tx) error {
+		return s.db.Update(func(tx *sqlutil.Tx) error {
+			seq, err := sqlutil.Sequence(tx, scanAddressesTable)
+			if err != nil {
+				return err
+			}
+
+			for _, ct := range config.CoinTypes {
+				addrs, err := getBoltScanAddresses(boltTx, ct)
+				if err != nil {
+					return err
+				}
+
+				for _, addr := range addrs {
+					seq++
+					if err := putScanAddressSQLTx(tx, ct, addr, seq); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := sqlutil.SetSequence(tx, scanAddressesTable, seq); err != nil {
+				return err
+			}
+
+			return dbutil.ForEachIfExists(boltTx, DepositBkt, func(k, v []byte) error {
+				var dv Deposit
+				if err := json.Unmarshal(v, &dv); err != nil {
+					return err
+				}
+				return putDepositSQLTx(tx, dv)
+			})
+		})
+	})
+}
+
+// getBoltScanAddresses returns the scan addresses of a coin type in a bolt database,
+// if its scanner was ever enabled
+func getBoltScanAddresses(tx *bolt.Tx, coinType string) ([]string, error) {
+	bktName := MustGetScanMetaBkt(coinType)
+	if tx.Bucket(bktName) == nil {
+		return nil, nil
+	}
+
+	var addrs []string
+	if err := dbutil.GetBucketObject(tx, bktName, depositAddressesKey, &addrs); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+		default:
+			return nil, err
+		}
+	}
+
+	return addrs, nil
+}
+
+// RowCounts returns the number of rows of the scanner tables
+func RowCounts(db *sqlutil.DB) (sqlutil.RowCounts, error) {
+	counts := make(sqlutil.RowCounts)
+	if err := db.View(func(tx *sqlutil.Tx) error {
+		for _, table := range []string{scanAddressesTable, depositTable} {
+			n, err := sqlutil.CountRows(tx, table)
+			if err != nil {
+				return err
+			}
+			counts[table] = n
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// BoltRowCounts returns the number of rows that SQLStore.ImportBolt copies from a bolt database to each scanner table
+func BoltRowCounts(db *bolt.DB) (sqlutil.RowCounts, error) {
+	counts := make(sqlutil.RowCounts)
+	if err := db.View(func(tx *bolt.Tx) error {
+		counts[depositTable] = dbutil.BucketKeyCount(tx, DepositBkt)
+
+		counts[scanAddressesTable] = 0
+		for _, ct := range config.CoinTypes {
+			addrs, err := getBoltScanAddresses(tx, ct)
+			if err != nil {
+				return err
+			}
+			counts[scanAddressesTable] += len(addrs)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
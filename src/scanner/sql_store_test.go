@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func newTestSQLStore(t *testing.T) (*SQLStore, func()) {
+	db, shutdown := testutil.PrepareSQLDB(t)
+
+	log, _ := testutil.NewLogger(t)
+	s, err := NewSQLStore(log, db)
+	require.NoError(t, err)
+
+	return s, shutdown
+}
+
+var testSQLStoreBlock = &CommonBlock{
+	Height: 10,
+	Hash:   "b1",
+	RawTx: []CommonTx{
+		{
+			Txid: "t1",
+			Vin: []CommonVin{
+				{Address: "src1"},
+			},
+			Vout: []CommonVout{
+				{Value: 100, N: 0, Address: "a1"},
+				{Value: 200, N: 1, Address: "other"},
+				{Value: 300, N: 2, Address: "a2"},
+			},
+		},
+	},
+}
+
+// runScanStoreScenario scans a block and processes one of its deposits
+func runScanStoreScenario(t *testing.T, s Storer) {
+	require.NoError(t, s.AddScanAddress("a1", config.CoinTypeBTC))
+	require.NoError(t, s.AddScanAddress("a2", config.CoinTypeBTC))
+	require.NoError(t, s.AddScanAddress("s1", config.CoinTypeSKY))
+
+	err := s.AddScanAddress("a1", config.CoinTypeBTC)
+	require.Equal(t, NewDuplicateDepositAddressErr("a1"), err)
+
+	dvs, err := s.ScanBlock(testSQLStoreBlock, config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Len(t, dvs, 2)
+	require.Equal(t, []string{"src1"}, dvs[0].SourceAddresses)
+
+	// Deposits already saved are not returned again
+	dvs, err = s.ScanBlock(testSQLStoreBlock, config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Empty(t, dvs)
+
+	require.NoError(t, s.SetDepositProcessed("t1:0"))
+
+	err = s.SetDepositProcessed("t1:1")
+	require.IsType(t, dbutil.ObjectNotExistErr{}, err)
+}
+
+func TestSQLStoreMatchesStore(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	s, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	sqlStore, sqlShutdown := newTestSQLStore(t)
+	defer sqlShutdown()
+
+	for _, ct := range []string{config.CoinTypeBTC, config.CoinTypeSKY} {
+		require.NoError(t, s.AddSupportedCoin(ct))
+		require.NoError(t, sqlStore.AddSupportedCoin(ct))
+	}
+
+	require.Equal(t, config.ErrUnsupportedCoinType, sqlStore.AddSupportedCoin("foo"))
+
+	runScanStoreScenario(t, s)
+	runScanStoreScenario(t, sqlStore)
+
+	for _, ct := range []string{config.CoinTypeBTC, config.CoinTypeSKY} {
+		addrs, err := s.GetScanAddresses(ct)
+		require.NoError(t, err)
+		sqlAddrs, err := sqlStore.GetScanAddresses(ct)
+		require.NoError(t, err)
+		require.Equal(t, addrs, sqlAddrs)
+
+		dvs, err := s.GetUnprocessedDeposits(ct)
+		require.NoError(t, err)
+		sqlDvs, err := sqlStore.GetUnprocessedDeposits(ct)
+		require.NoError(t, err)
+		require.Equal(t, dvs, sqlDvs)
+	}
+
+	dvs, err := sqlStore.GetUnprocessedDeposits(config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Len(t, dvs, 1)
+	require.Equal(t, "t1:2", dvs[0].ID())
+}
+
+func TestSQLStoreImportBolt(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	s, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	for _, ct := range []string{config.CoinTypeBTC, config.CoinTypeSKY} {
+		require.NoError(t, s.AddSupportedCoin(ct))
+	}
+
+	runScanStoreScenario(t, s)
+
+	sqlStore, sqlShutdown := newTestSQLStore(t)
+	defer sqlShutdown()
+
+	require.NoError(t, sqlStore.ImportBolt(db))
+
+	addrs, err := sqlStore.GetScanAddresses(config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a1", "a2"}, addrs)
+
+	addrs, err = sqlStore.GetScanAddresses(config.CoinTypeSKY)
+	require.NoError(t, err)
+	require.Equal(t, []string{"s1"}, addrs)
+
+	dvs, err := sqlStore.GetUnprocessedDeposits(config.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Len(t, dvs, 1)
+	require.Equal(t, "t1:2", dvs[0].ID())
+
+	boltCounts, err := BoltRowCounts(db)
+	require.NoError(t, err)
+	sqlCounts, err := RowCounts(sqlStore.db)
+	require.NoError(t, err)
+	require.Empty(t, boltCounts.Diff(sqlCounts))
+	require.Equal(t, 3, sqlCounts[scanAddressesTable])
+	require.Equal(t, 2, sqlCounts[depositTable])
+
+	// Addresses added later are scanned after the imported ones
+	require.NoError(t, sqlStore.AddScanAddress("s0", config.CoinTypeSKY))
+	addrs, err = sqlStore.GetScanAddresses(config.CoinTypeSKY)
+	require.NoError(t, err)
+	require.Equal(t, []string{"s1", "s0"}, addrs)
+}
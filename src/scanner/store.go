@@ -325,12 +325,13 @@ func scanSpecifiedBlock(block *CommonBlock, coinType string, depositAddrs []stri
 
 			if _, ok := addrMap[v.Address]; ok {
 				dv = append(dv, Deposit{
-					CoinType: coinType,
-					Address:  v.Address,
-					Value:    amt,
-					Height:   block.Height,
-					Tx:       tx.Txid,
-					N:        v.N,
+					CoinType:        coinType,
+					Address:         v.Address,
+					Value:           amt,
+					Height:          block.Height,
+					Tx:              tx.Txid,
+					N:               v.N,
+					SourceAddresses: tx.SourceAddresses(),
 				})
 			}
 		}
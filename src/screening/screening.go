@@ -0,0 +1,253 @@
+// Package screening checks addresses against deny lists of sanctioned or known-fraud addresses
+package screening
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+var (
+	// ErrAddressDenied is returned when an address is on a deny list
+	ErrAddressDenied = errors.New("Address is not allowed")
+)
+
+// denyList is the loaded deny list file of a coin type
+type denyList struct {
+	path    string
+	modTime time.Time
+	addrs   map[string]struct{}
+}
+
+// DenyLists screens addresses against the configured deny list files.
+// The files are reloaded when they change. Hits are recorded in the Store.
+type DenyLists struct {
+	log   logrus.FieldLogger
+	cfg   config.Screening
+	store *Store
+	lists map[string]*denyList
+	quit  chan struct{}
+	done  chan struct{}
+	sync.RWMutex
+}
+
+// New creates DenyLists and loads the configured deny list files
+func New(log logrus.FieldLogger, db *bolt.DB, cfg config.Screening) (*DenyLists, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	store, err := NewStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DenyLists{
+		log:   log.WithField("prefix", "teller.screening"),
+		cfg:   cfg,
+		store: store,
+		lists: make(map[string]*denyList),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}, 1),
+	}
+
+	for _, ct := range config.CoinTypes {
+		path, err := cfg.DenyList(ct)
+		if err != nil {
+			return nil, err
+		}
+
+		if path == "" {
+			continue
+		}
+
+		l, err := loadDenyList(ct, path)
+		if err != nil {
+			return nil, err
+		}
+
+		d.log.WithFields(logrus.Fields{
+			"coinType": ct,
+			"path":     path,
+			"count":    len(l.addrs),
+		}).Info("Loaded deny list")
+
+		d.lists[ct] = l
+	}
+
+	return d, nil
+}
+
+// Run reloads the deny list files when they change
+func (d *DenyLists) Run() error {
+	log := d.log
+	log.Info("Start screening service...")
+	defer func() {
+		log.Info("Closed screening service")
+		d.done <- struct{}{}
+	}()
+
+	ticker := time.NewTicker(d.cfg.ReloadWait)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.quit:
+			log.Info("quit")
+			return nil
+		case <-ticker.C:
+			d.reload()
+		}
+	}
+}
+
+// Shutdown stops a previous call to Run
+func (d *DenyLists) Shutdown() {
+	d.log.Info("Shutting down DenyLists")
+	close(d.quit)
+	d.log.Info("Waiting for run to finish")
+	<-d.done
+	d.log.Info("Shutdown complete")
+}
+
+// reload reloads the deny list files that were modified since they were loaded.
+// If a file cannot be loaded, the previous list is kept.
+func (d *DenyLists) reload() {
+	d.RLock()
+	lists := make(map[string]*denyList, len(d.lists))
+	for ct, l := range d.lists {
+		lists[ct] = l
+	}
+	d.RUnlock()
+
+	for ct, l := range lists {
+		log := d.log.WithFields(logrus.Fields{
+			"coinType": ct,
+			"path":     l.path,
+		})
+
+		fi, err := os.Stat(l.path)
+		if err != nil {
+			log.WithField("notice", logger.WatchNotice).WithError(err).Error("Deny list file unavailable, keeping the loaded list")
+			continue
+		}
+
+		if fi.ModTime().Equal(l.modTime) {
+			continue
+		}
+
+		newList, err := loadDenyList(ct, l.path)
+		if err != nil {
+			log.WithField("notice", logger.WatchNotice).WithError(err).Error("Reloading deny list failed, keeping the loaded list")
+			continue
+		}
+
+		d.Lock()
+		d.lists[ct] = newList
+		d.Unlock()
+
+		log.WithField("count", len(newList.addrs)).Info("Reloaded deny list")
+	}
+}
+
+// IsDenied returns true if an address is on the deny list of its coin type
+func (d *DenyLists) IsDenied(coinType, address string) bool {
+	d.RLock()
+	defer d.RUnlock()
+
+	l, ok := d.lists[coinType]
+	if !ok {
+		return false
+	}
+
+	_, ok = l.addrs[normalizeAddress(coinType, address)]
+	return ok
+}
+
+// Check returns ErrAddressDenied if an address is on the deny list of its coin type.
+// A hit is logged and recorded with source, a description of what was screened.
+func (d *DenyLists) Check(coinType, address, source string) error {
+	if !d.IsDenied(coinType, address) {
+		return nil
+	}
+
+	log := d.log.WithFields(logrus.Fields{
+		"coinType": coinType,
+		"address":  address,
+		"source":   source,
+	})
+
+	log.WithField("notice", logger.WatchNotice).Warn("Address is on a deny list")
+
+	if _, err := d.store.AddHit(Hit{
+		Timestamp: time.Now().UTC().Unix(),
+		CoinType:  coinType,
+		Address:   address,
+		Source:    source,
+	}); err != nil {
+		log.WithError(err).Error("Recording deny list hit failed")
+	}
+
+	return ErrAddressDenied
+}
+
+// GetHits returns the recorded deny list hits
+func (d *DenyLists) GetHits() ([]Hit, error) {
+	return d.store.GetHits()
+}
+
+// normalizeAddress returns the form of an address that deny lists are keyed by.
+// ETH addresses are lowercased, because the ETH scanner reports lowercased addresses
+// and deny lists often carry EIP-55 checksummed ones.
+func normalizeAddress(coinType, address string) string {
+	if coinType == config.CoinTypeETH {
+		return strings.ToLower(address)
+	}
+	return address
+}
+
+// loadDenyList reads the deny list file of a coin type, with one address per line.
+// Blank lines and lines starting with # are ignored.
+func loadDenyList(coinType, path string) (*denyList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		addrs[normalizeAddress(coinType, line)] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Read %s failed: %v", path, err)
+	}
+
+	return &denyList{
+		path:    path,
+		modTime: fi.ModTime(),
+		addrs:   addrs,
+	}, nil
+}
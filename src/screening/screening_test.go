@@ -0,0 +1,186 @@
+package screening
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+const (
+	testSkyAddr  = "2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm"
+	testSkyAddr2 = "cBnu9sUvv12dovBmjQKTtfE4rbjMmf3fzW"
+	testBtcAddr  = "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGLRRUz"
+	testEthAddr  = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+)
+
+func writeDenyList(t *testing.T, path, content string, modTime time.Time) {
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+	require.NoError(t, err)
+	err = os.Chtimes(path, modTime, modTime)
+	require.NoError(t, err)
+}
+
+func setupDenyLists(t *testing.T) (*DenyLists, string, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+
+	dir, err := ioutil.TempDir("", "screening")
+	require.NoError(t, err)
+
+	skyPath := filepath.Join(dir, "sky_deny_list.txt")
+	writeDenyList(t, skyPath, "# sanctioned\n\n"+testSkyAddr+"\n  "+testSkyAddr2+"  \n", time.Now().Add(-time.Hour))
+
+	d, err := New(log, db, config.Screening{
+		SkyDenyList: skyPath,
+		ReloadWait:  time.Millisecond * 10,
+	})
+	require.NoError(t, err)
+
+	return d, skyPath, func() {
+		shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDenyListsIsDenied(t *testing.T) {
+	d, _, shutdown := setupDenyLists(t)
+	defer shutdown()
+
+	require.True(t, d.IsDenied(config.CoinTypeSKY, testSkyAddr))
+	require.True(t, d.IsDenied(config.CoinTypeSKY, testSkyAddr2))
+	require.False(t, d.IsDenied(config.CoinTypeSKY, "# sanctioned"))
+	require.False(t, d.IsDenied(config.CoinTypeSKY, ""))
+
+	// No BTC deny list is configured
+	require.False(t, d.IsDenied(config.CoinTypeBTC, testBtcAddr))
+	require.False(t, d.IsDenied(config.CoinTypeBTC, testSkyAddr))
+}
+
+func TestDenyListsIsDeniedEthCase(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+	log, _ := testutil.NewLogger(t)
+
+	dir, err := ioutil.TempDir("", "screening")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The deny list has an EIP-55 checksummed address
+	ethPath := filepath.Join(dir, "eth_deny_list.txt")
+	writeDenyList(t, ethPath, testEthAddr+"\n", time.Now())
+
+	// The BTC deny list is matched exactly
+	btcPath := filepath.Join(dir, "btc_deny_list.txt")
+	writeDenyList(t, btcPath, testBtcAddr+"\n", time.Now())
+
+	d, err := New(log, db, config.Screening{
+		EthDenyList: ethPath,
+		BtcDenyList: btcPath,
+		ReloadWait:  time.Minute,
+	})
+	require.NoError(t, err)
+
+	// The ETH scanner reports lowercased addresses
+	require.True(t, d.IsDenied(config.CoinTypeETH, strings.ToLower(testEthAddr)))
+	require.True(t, d.IsDenied(config.CoinTypeETH, testEthAddr))
+	require.True(t, d.IsDenied(config.CoinTypeETH, "0x"+strings.ToUpper(testEthAddr[2:])))
+
+	err = d.Check(config.CoinTypeETH, strings.ToLower(testEthAddr), "deposit foo:0")
+	require.Equal(t, ErrAddressDenied, err)
+
+	require.True(t, d.IsDenied(config.CoinTypeBTC, testBtcAddr))
+	require.False(t, d.IsDenied(config.CoinTypeBTC, strings.ToLower(testBtcAddr)))
+}
+
+func TestDenyListsCheck(t *testing.T) {
+	d, _, shutdown := setupDenyLists(t)
+	defer shutdown()
+
+	err := d.Check(config.CoinTypeSKY, testBtcAddr, "bind")
+	require.NoError(t, err)
+
+	hits, err := d.GetHits()
+	require.NoError(t, err)
+	require.Empty(t, hits)
+
+	err = d.Check(config.CoinTypeSKY, testSkyAddr, "bind")
+	require.Equal(t, ErrAddressDenied, err)
+
+	err = d.Check(config.CoinTypeSKY, testSkyAddr2, "deposit foo:0")
+	require.Equal(t, ErrAddressDenied, err)
+
+	hits, err = d.GetHits()
+	require.NoError(t, err)
+	require.Len(t, hits, 2)
+
+	require.Equal(t, uint64(1), hits[0].Seq)
+	require.Equal(t, config.CoinTypeSKY, hits[0].CoinType)
+	require.Equal(t, testSkyAddr, hits[0].Address)
+	require.Equal(t, "bind", hits[0].Source)
+	require.NotEqual(t, int64(0), hits[0].Timestamp)
+
+	require.Equal(t, uint64(2), hits[1].Seq)
+	require.Equal(t, testSkyAddr2, hits[1].Address)
+	require.Equal(t, "deposit foo:0", hits[1].Source)
+}
+
+func TestDenyListsReload(t *testing.T) {
+	d, skyPath, shutdown := setupDenyLists(t)
+	defer shutdown()
+
+	// Unchanged files are not reloaded
+	d.reload()
+	require.True(t, d.IsDenied(config.CoinTypeSKY, testSkyAddr))
+
+	writeDenyList(t, skyPath, testSkyAddr2+"\n", time.Now())
+	d.reload()
+	require.False(t, d.IsDenied(config.CoinTypeSKY, testSkyAddr))
+	require.True(t, d.IsDenied(config.CoinTypeSKY, testSkyAddr2))
+
+	// If the file is removed, the loaded list is kept
+	err := os.Remove(skyPath)
+	require.NoError(t, err)
+	d.reload()
+	require.True(t, d.IsDenied(config.CoinTypeSKY, testSkyAddr2))
+}
+
+func TestDenyListsRun(t *testing.T) {
+	d, skyPath, shutdown := setupDenyLists(t)
+	defer shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := d.Run()
+		require.NoError(t, err)
+	}()
+
+	writeDenyList(t, skyPath, testBtcAddr+"\n", time.Now())
+	time.Sleep(d.cfg.ReloadWait * 10)
+
+	d.Shutdown()
+	<-done
+
+	require.False(t, d.IsDenied(config.CoinTypeSKY, testSkyAddr))
+	require.True(t, d.IsDenied(config.CoinTypeSKY, testBtcAddr))
+}
+
+func TestNewMissingDenyList(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+	log, _ := testutil.NewLogger(t)
+
+	_, err := New(log, db, config.Screening{
+		BtcDenyList: "does-not-exist.txt",
+		ReloadWait:  time.Minute,
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package screening
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// HitsBkt records the addresses that were denied
+	HitsBkt = []byte("screening_hits")
+)
+
+// Hit records an address that was found on a deny list
+type Hit struct {
+	Seq       uint64 `json:"seq"`
+	Timestamp int64  `json:"timestamp"`
+	CoinType  string `json:"coin_type"`
+	Address   string `json:"address"`
+	Source    string `json:"source"` // What was screened, e.g. "bind" or "deposit <deposit ID>"
+}
+
+// Store records deny list hits
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore creates a Store
+func NewStore(db *bolt.DB) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("new screening Store failed, db is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(HitsBkt)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db: db,
+	}, nil
+}
+
+// AddHit records a hit
+func (s *Store) AddHit(h Hit) (Hit, error) {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		seq, err := dbutil.NextSequence(tx, HitsBkt)
+		if err != nil {
+			return err
+		}
+
+		h.Seq = seq
+
+		return dbutil.PutBucketValue(tx, HitsBkt, strconv.FormatUint(seq, 10), h)
+	}); err != nil {
+		return Hit{}, err
+	}
+
+	return h, nil
+}
+
+// GetHits returns all hits, oldest first
+func (s *Store) GetHits() ([]Hit, error) {
+	var hits []Hit
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, HitsBkt, func(k, v []byte) error {
+			var h Hit
+			if err := json.Unmarshal(v, &h); err != nil {
+				return err
+			}
+
+			hits = append(hits, h)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	// Keys are sorted as strings, not numbers
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Seq < hits[j].Seq
+	})
+
+	return hits, nil
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/skycoin/skycoin/src/coin"
 	"github.com/skycoin/skycoin/src/util/droplet"
 
+	"github.com/skycoin/teller/src/fiber"
 	"github.com/skycoin/teller/src/util/httputil"
 )
 
@@ -41,6 +42,7 @@ type DummyTransaction struct {
 // SKY sendouts
 type DummySender struct {
 	broadcastTxns map[string]*DummyTransaction
+	fiberCoin     fiber.Coin
 	seq           int64
 	secKey        cipher.SecKey
 	log           logrus.FieldLogger
@@ -50,11 +52,12 @@ type DummySender struct {
 }
 
 // NewDummySender creates a DummySender
-func NewDummySender(log logrus.FieldLogger) *DummySender {
+func NewDummySender(log logrus.FieldLogger, fiberCoin fiber.Coin) *DummySender {
 	_, sec := cipher.GenerateDeterministicKeyPair([]byte(seed))
 
 	return &DummySender{
 		broadcastTxns: make(map[string]*DummyTransaction),
+		fiberCoin:     fiberCoin,
 		secKey:        sec,
 		log:           log.WithField("prefix", "sender.dummy"),
 		coins:         100000000,
@@ -80,7 +83,7 @@ func (s *DummySender) CreateTransaction(addr string, coins uint64) (*coin.Transa
 		"coins":    c,
 	}).Info("CreateTransaction")
 
-	a, err := cipher.DecodeBase58Address(addr)
+	a, err := s.fiberCoin.DecodeAddress(addr)
 	if err != nil {
 		s.log.WithError(err).Error("CreateTransaction called with invalid address")
 		return nil, err
@@ -136,6 +139,26 @@ func (s *DummySender) BroadcastTransaction(txn *coin.Transaction) *BroadcastTxRe
 	}
 }
 
+// RebroadcastTransaction broadcasts a fake skycoin transaction again, which is a no-op if it was broadcast before
+func (s *DummySender) RebroadcastTransaction(txn *coin.Transaction) error {
+	s.log.WithField("txid", txn.TxIDHex()).Info("RebroadcastTransaction")
+
+	s.RLock()
+	_, ok := s.broadcastTxns[txn.TxIDHex()]
+	s.RUnlock()
+
+	if ok {
+		return nil
+	}
+
+	return s.BroadcastTransaction(txn).Err
+}
+
+// InputSpends returns no spends, the inputs of fake transactions are never spent elsewhere
+func (s *DummySender) InputSpends(uxids []string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
 // IsTxConfirmed reports whether a fake skycoin transaction has been confirmed
 func (s *DummySender) IsTxConfirmed(txid string) *ConfirmResponse {
 	s.log.WithField("txid", txid).Info("IsTxConfirmed")
@@ -170,6 +193,40 @@ func (s *DummySender) Balance() (*cli.Balance, error) {
 	}, nil
 }
 
+// WalletHistory returns the fake skycoin transactions broadcast since the DummySender was created.
+// Pending txids broadcast before a restart are missing.
+func (s *DummySender) WalletHistory(pending []string) (*WalletHistory, error) {
+	txns := s.getBroadcastedTransactions()
+
+	s.RLock()
+	defer s.RUnlock()
+
+	history := &WalletHistory{}
+	for _, txn := range txns {
+		tx := OutgoingTx{
+			Txid:      txn.TxIDHex(),
+			Confirmed: txn.Confirmed,
+		}
+
+		for _, o := range txn.Out {
+			tx.Outputs = append(tx.Outputs, TxOutput{
+				Address: o.Address.String(),
+				Coins:   o.Coins,
+			})
+		}
+
+		history.Transactions = append(history.Transactions, tx)
+	}
+
+	for _, txid := range pending {
+		if _, ok := s.broadcastTxns[txid]; !ok {
+			history.Missing = append(history.Missing, txid)
+		}
+	}
+
+	return history, nil
+}
+
 // HTTP interface
 
 // BindHandlers binds admin API handlers to the mux
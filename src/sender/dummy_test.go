@@ -5,13 +5,14 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/skycoin/teller/src/fiber"
 	"github.com/skycoin/teller/src/util/testutil"
 )
 
 func TestDummySender(t *testing.T) {
 	log, _ := testutil.NewLogger(t)
 
-	s := NewDummySender(log)
+	s := NewDummySender(log, fiber.Skycoin)
 
 	addr := "2VZu3rZozQ6nN37YSdj3EZJV7wSFVuLSm2X"
 	var coins uint64 = 100
@@ -0,0 +1,241 @@
+package sender
+
+import (
+	"sort"
+
+	"github.com/skycoin/skycoin/src/api/webrpc"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/util/droplet"
+)
+
+// txNotFoundMsg is the webrpc error message for a transaction unknown to the node
+const txNotFoundMsg = "transaction doesn't exist"
+
+// TxOutput is an output of a transaction sent from the hot wallets
+type TxOutput struct {
+	Address string
+	Coins   uint64
+}
+
+// OutgoingTx is a transaction that spent outputs of the hot wallets
+type OutgoingTx struct {
+	Txid      string
+	Confirmed bool
+	// Outputs to addresses outside the hot wallets. Change is omitted.
+	Outputs []TxOutput
+}
+
+// WalletHistory is the blockchain's record of the transactions sent from the hot wallets
+type WalletHistory struct {
+	// Transactions that spent hot wallet outputs, confirmed or not
+	Transactions []OutgoingTx
+	// Pending txids that the node does not know, e.g. because it dropped them
+	Missing []string
+	// Hot wallet outputs being spent by unconfirmed transactions that are neither
+	// pending txids nor otherwise known, e.g. a transaction broadcast but not recorded
+	UnknownSpends []string
+}
+
+// isTxNotFound returns true if err is the webrpc error for an unknown transaction
+func isTxNotFound(err error) bool {
+	if e, ok := err.(RPCError); ok {
+		err = e.error
+	}
+
+	rpcErr, ok := err.(*webrpc.RPCError)
+	return ok && rpcErr.Message == txNotFoundMsg
+}
+
+// WalletHistory returns the transactions that spent outputs of the hot wallets.
+// Confirmed transactions are found in the address history of the hot wallets.
+// Unconfirmed transactions can't be listed by the node, so the txids in pending,
+// which the caller believes to be broadcast, are looked up one by one.
+// Unconfirmed spends of hot wallet outputs not accounted for by pending or by a sweep
+// made since teller started are reported as UnknownSpends.
+func (c *RPC) WalletHistory(pending []string) (*WalletHistory, error) {
+	var addrs []string
+	for _, w := range c.wallets {
+		addrs = append(addrs, w.addrs...)
+	}
+
+	hotAddrs := make(map[string]struct{}, len(addrs))
+	for _, a := range addrs {
+		hotAddrs[a] = struct{}{}
+	}
+
+	uxouts, err := c.client.GetAddressUxOuts(addrs)
+	if err != nil {
+		return nil, RPCError{err}
+	}
+
+	// Find the transactions that spent confirmed hot wallet outputs
+	unspent := cipher.SHA256{}.Hex()
+	spentTxids := make(map[string]struct{})
+	for _, r := range uxouts {
+		for _, ux := range r.UxOuts {
+			if ux.SpentTxID != "" && ux.SpentTxID != unspent {
+				spentTxids[ux.SpentTxID] = struct{}{}
+			}
+		}
+	}
+
+	txids := make([]string, 0, len(spentTxids))
+	for txid := range spentTxids {
+		txids = append(txids, txid)
+	}
+	sort.Strings(txids)
+
+	history := &WalletHistory{}
+	unconfirmedInputs := make(map[string]struct{})
+
+	addTx := func(txn *webrpc.TxnResult) error {
+		tx, err := newOutgoingTx(txn, hotAddrs)
+		if err != nil {
+			return err
+		}
+
+		if !tx.Confirmed {
+			for _, in := range txn.Transaction.Transaction.In {
+				unconfirmedInputs[in] = struct{}{}
+			}
+		}
+
+		history.Transactions = append(history.Transactions, *tx)
+		return nil
+	}
+
+	for _, txid := range txids {
+		txn, err := c.client.GetTransactionByID(txid)
+		if err != nil {
+			return nil, RPCError{err}
+		}
+
+		if err := addTx(txn); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, txid := range pending {
+		if _, ok := spentTxids[txid]; ok {
+			continue
+		}
+
+		txn, err := c.client.GetTransactionByID(txid)
+		if err != nil {
+			if isTxNotFound(err) {
+				history.Missing = append(history.Missing, txid)
+				continue
+			}
+			return nil, RPCError{err}
+		}
+
+		spentTxids[txid] = struct{}{}
+		if err := addTx(txn); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sweeps are not pending payouts, but their unconfirmed spends are known.
+	// Confirmed sweeps are in the address history and are forgotten.
+	c.Lock()
+	sweeps := make([]string, 0, len(c.swept))
+	for txid := range c.swept {
+		if _, ok := spentTxids[txid]; ok {
+			delete(c.swept, txid)
+			continue
+		}
+		sweeps = append(sweeps, txid)
+	}
+	c.Unlock()
+	sort.Strings(sweeps)
+
+	for _, txid := range sweeps {
+		txn, err := c.client.GetTransactionByID(txid)
+		if err != nil {
+			if isTxNotFound(err) {
+				continue
+			}
+			return nil, RPCError{err}
+		}
+
+		if err := addTx(txn); err != nil {
+			return nil, err
+		}
+	}
+
+	// Outputs being spent by unconfirmed transactions that were not looked up are unknown spends
+	outputs, err := c.client.GetUnspentOutputs(addrs)
+	if err != nil {
+		return nil, RPCError{err}
+	}
+
+	for _, o := range outputs.Outputs.OutgoingOutputs {
+		if _, ok := unconfirmedInputs[o.Hash]; !ok {
+			history.UnknownSpends = append(history.UnknownSpends, o.Hash)
+		}
+	}
+
+	return history, nil
+}
+
+// InputSpends returns the txids of the confirmed transactions that spent the given hot wallet outputs,
+// by uxid. Outputs that are unspent, or spent by a transaction that is not confirmed yet, are omitted.
+// Outputs of addresses that are no longer in the hot wallets are not known and are omitted too.
+func (c *RPC) InputSpends(uxids []string) (map[string]string, error) {
+	var addrs []string
+	for _, w := range c.wallets {
+		addrs = append(addrs, w.addrs...)
+	}
+
+	uxouts, err := c.client.GetAddressUxOuts(addrs)
+	if err != nil {
+		return nil, RPCError{err}
+	}
+
+	wanted := make(map[string]struct{}, len(uxids))
+	for _, uxid := range uxids {
+		wanted[uxid] = struct{}{}
+	}
+
+	unspent := cipher.SHA256{}.Hex()
+	spends := make(map[string]string)
+	for _, r := range uxouts {
+		for _, ux := range r.UxOuts {
+			if _, ok := wanted[ux.Uxid]; !ok {
+				continue
+			}
+
+			if ux.SpentTxID != "" && ux.SpentTxID != unspent {
+				spends[ux.Uxid] = ux.SpentTxID
+			}
+		}
+	}
+
+	return spends, nil
+}
+
+// newOutgoingTx creates an OutgoingTx from a transaction, omitting the outputs to hotAddrs
+func newOutgoingTx(txn *webrpc.TxnResult, hotAddrs map[string]struct{}) (*OutgoingTx, error) {
+	tx := &OutgoingTx{
+		Txid:      txn.Transaction.Transaction.Hash,
+		Confirmed: txn.Transaction.Status.Confirmed,
+	}
+
+	for _, o := range txn.Transaction.Transaction.Out {
+		if _, ok := hotAddrs[o.Address]; ok {
+			continue
+		}
+
+		coins, err := droplet.FromString(o.Coins)
+		if err != nil {
+			return nil, err
+		}
+
+		tx.Outputs = append(tx.Outputs, TxOutput{
+			Address: o.Address,
+			Coins:   coins,
+		})
+	}
+
+	return tx, nil
+}
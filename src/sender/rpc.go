@@ -2,12 +2,32 @@ package sender
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/skycoin/skycoin/src/api/cli"
 	"github.com/skycoin/skycoin/src/api/webrpc"
-	"github.com/skycoin/skycoin/src/cipher"
 	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/util/droplet"
 	"github.com/skycoin/skycoin/src/wallet"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/fiber"
+	"github.com/skycoin/teller/src/util/walletcrypt"
+)
+
+// dailyLimitPeriod is the rolling period that a hot wallet's daily limit applies to
+const dailyLimitPeriod = 24 * time.Hour
+
+// pendingTxTimeout is how long a created transaction is assumed to be waiting for broadcast.
+// Wallets with pending transactions are not swept, so that the sweep can't spend the same outputs.
+const pendingTxTimeout = 5 * time.Minute
+
+var (
+	// ErrNoWalletCanSend is returned when no hot wallet has the balance, max payout and daily limit to cover a payout
+	ErrNoWalletCanSend = errors.New("No hot wallet can cover the payout")
 )
 
 // RPCError wraps errors from the skycoin CLI/RPC library
@@ -20,33 +40,205 @@ func NewRPCError(err error) RPCError {
 	return RPCError{err}
 }
 
-// RPC provides methods for sending coins
-type RPC struct {
-	walletFile string
-	changeAddr string
-	rpcClient  *webrpc.Client
+// walletClient makes the skycoin node RPC calls needed to send from wallets
+type walletClient interface {
+	CreateRawTx(wlt *wallet.Wallet, inAddrs []string, changeAddr string, toAddrs []cli.SendAmount) (*coin.Transaction, error)
+	CreateUnsignedTx(inAddrs []string, changeAddr string, toAddrs []cli.SendAmount) (*coin.Transaction, []string, error)
+	GetBalanceOfAddresses(addrs []string) (*cli.Balance, error)
+	InjectTransaction(tx *coin.Transaction) (string, error)
+	GetTransactionByID(txid string) (*webrpc.TxnResult, error)
+	GetAddressUxOuts(addrs []string) ([]webrpc.AddrUxoutResult, error)
+	GetUnspentOutputs(addrs []string) (*webrpc.OutputsResult, error)
+}
+
+// webrpcClient implements walletClient with the skycoin webrpc client
+type webrpcClient struct {
+	*webrpc.Client
+}
+
+// CreateRawTx creates a transaction spending from inAddrs, signed with the keys of wlt
+func (c webrpcClient) CreateRawTx(wlt *wallet.Wallet, inAddrs []string, changeAddr string, toAddrs []cli.SendAmount) (*coin.Transaction, error) {
+	return cli.CreateRawTx(c.Client, wlt, inAddrs, changeAddr, toAddrs)
+}
+
+// CreateUnsignedTx creates an unsigned transaction spending from inAddrs, and returns the address owning each input
+func (c webrpcClient) CreateUnsignedTx(inAddrs []string, changeAddr string, toAddrs []cli.SendAmount) (*coin.Transaction, []string, error) {
+	unspents, err := c.GetUnspentOutputs(inAddrs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return createUnsignedTx(unspents.Outputs, changeAddr, toAddrs)
 }
 
-// NewRPC creates RPC instance
-func NewRPC(wltFile, rpcAddr string) (*RPC, error) {
-	wlt, err := wallet.Load(wltFile)
+// GetBalanceOfAddresses returns the spendable balance of addrs
+func (c webrpcClient) GetBalanceOfAddresses(addrs []string) (*cli.Balance, error) {
+	bal, err := cli.GetBalanceOfAddresses(c.Client, addrs)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(wlt.Entries) == 0 {
-		return nil, errors.New("Wallet is empty")
+	return &bal.Spendable, nil
+}
+
+// TxSigner signs transactions for wallets held outside teller
+type TxSigner interface {
+	Sign(wallet string, txn *coin.Transaction, inputAddrs []string) (*coin.Transaction, error)
+}
+
+// hotWallet is a wallet that payouts are sent from.
+// Its transactions are either signed with local keys, which are only decrypted while signing,
+// or by an external signer.
+type hotWallet struct {
+	file        string
+	maxPayout   uint64 // Largest single payout to send from the wallet, unlimited if 0
+	dailyLimit  uint64 // Largest total of payouts to send from the wallet in the last 24 hours, unlimited if 0
+	addrs       []string
+	changeAddrs []string
+	nextChange  int
+	keys        *walletcrypt.Keys
+	signer      TxSigner
+}
+
+// changeAddr returns the next change address of the wallet, rotating through its entries
+func (w *hotWallet) changeAddr() string {
+	addr := w.changeAddrs[w.nextChange]
+	w.nextChange = (w.nextChange + 1) % len(w.changeAddrs)
+	return addr
+}
+
+// createTransaction creates a signed transaction sending toAddrs from the wallet
+func (w *hotWallet) createTransaction(client walletClient, toAddrs []cli.SendAmount) (*coin.Transaction, error) {
+	if w.signer != nil {
+		txn, inputAddrs, err := client.CreateUnsignedTx(w.addrs, w.changeAddr(), toAddrs)
+		if err != nil {
+			return nil, err
+		}
+
+		return w.signer.Sign(w.file, txn, inputAddrs)
 	}
 
-	rpcClient := &webrpc.Client{
-		Addr: rpcAddr,
+	wlt, err := w.keys.Wallet()
+	if err != nil {
+		return nil, err
 	}
+	defer walletcrypt.Zero(wlt)
 
-	return &RPC{
-		walletFile: wltFile,
-		changeAddr: wlt.Entries[0].Address.String(),
-		rpcClient:  rpcClient,
-	}, nil
+	return client.CreateRawTx(wlt, w.addrs, w.changeAddr(), toAddrs)
+}
+
+// pendingTx is a transaction created from a hot wallet that has not been broadcast yet
+type pendingTx struct {
+	wallet  *hotWallet
+	created time.Time
+}
+
+// RPC provides methods for sending coins from a set of hot wallets.
+// Each payout is sent from the wallet with the largest spendable balance that can cover it,
+// and change is sent to the wallet's entries in turn.
+// Payouts are recorded in the Store, so that the wallets' daily limits hold across restarts.
+type RPC struct {
+	coin    fiber.Coin
+	wallets []*hotWallet
+	client  walletClient
+	store   *Store
+	pending map[string]pendingTx
+	swept   map[string]struct{} // Sweep txids that may not be confirmed yet
+	sync.Mutex
+}
+
+// NewRPC creates RPC instance.
+// Encrypted wallets are decrypted with password, which can be erased once NewRPC returns.
+// Unencrypted wallets are refused unless allowUnencrypted is set.
+func NewRPC(fiberCoin fiber.Coin, wallets []config.SkyWallet, store *Store, rpcAddr string, password []byte, allowUnencrypted bool) (*RPC, error) {
+	if len(wallets) == 0 {
+		return nil, errors.New("No wallets")
+	}
+
+	c := &RPC{
+		coin: fiberCoin,
+		client: webrpcClient{
+			Client: &webrpc.Client{
+				Addr: rpcAddr,
+			},
+		},
+		store:   store,
+		pending: make(map[string]pendingTx),
+		swept:   make(map[string]struct{}),
+	}
+
+	for _, w := range wallets {
+		keys, err := walletcrypt.OpenKeys(w.File, password, allowUnencrypted)
+		if err != nil {
+			return nil, err
+		}
+
+		hw := &hotWallet{
+			file:        w.File,
+			addrs:       keys.Addresses(),
+			changeAddrs: keys.Addresses(),
+			keys:        keys,
+		}
+
+		if w.MaxPayout != "" {
+			hw.maxPayout, err = droplet.FromString(w.MaxPayout)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if w.DailyLimit != "" {
+			hw.dailyLimit, err = droplet.FromString(w.DailyLimit)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		c.wallets = append(c.wallets, hw)
+	}
+
+	return c, nil
+}
+
+// SignerWallet is a wallet held by an external signer
+type SignerWallet struct {
+	Name      string
+	Addresses []string
+}
+
+// NewSignerRPC creates RPC instance that sends from wallets held by an external signer.
+// Transactions are created unsigned and passed to txSigner to be signed.
+func NewSignerRPC(fiberCoin fiber.Coin, wallets []SignerWallet, txSigner TxSigner, store *Store, rpcAddr string) (*RPC, error) {
+	if len(wallets) == 0 {
+		return nil, errors.New("No wallets")
+	}
+
+	c := &RPC{
+		coin: fiberCoin,
+		client: webrpcClient{
+			Client: &webrpc.Client{
+				Addr: rpcAddr,
+			},
+		},
+		store:   store,
+		pending: make(map[string]pendingTx),
+		swept:   make(map[string]struct{}),
+	}
+
+	for _, w := range wallets {
+		if len(w.Addresses) == 0 {
+			return nil, fmt.Errorf("Signer wallet %s is empty", w.Name)
+		}
+
+		c.wallets = append(c.wallets, &hotWallet{
+			file:        w.Name,
+			addrs:       w.Addresses,
+			changeAddrs: w.Addresses,
+			signer:      txSigner,
+		})
+	}
+
+	return c, nil
 }
 
 // CreateTransaction creates a raw Skycoin transaction offline, that can be broadcast later
@@ -58,21 +250,113 @@ func (c *RPC) CreateTransaction(recvAddr string, amount uint64) (*coin.Transacti
 		Coins: amount,
 	}
 
-	if err := validateSendAmount(sendAmount); err != nil {
+	if err := validateSendAmount(c.coin, sendAmount); err != nil {
 		return nil, err
 	}
 
-	txn, err := cli.CreateRawTxFromWallet(c.rpcClient, c.walletFile, c.changeAddr, []cli.SendAmount{sendAmount})
+	c.Lock()
+	defer c.Unlock()
+
+	w, err := c.chooseWallet(amount)
+	if err != nil {
+		return nil, RPCError{err}
+	}
+
+	txn, err := w.createTransaction(c.client, []cli.SendAmount{sendAmount})
 	if err != nil {
 		return nil, RPCError{err}
 	}
 
+	now := time.Now()
+
+	// The payout counts towards the wallet's daily limit from when it is created,
+	// so a transaction that is never broadcast still counts until it leaves the period
+	if err := c.store.AddPayout(Payout{
+		Txid:      txn.TxIDHex(),
+		Wallet:    w.file,
+		Coins:     amount,
+		CreatedAt: now,
+	}); err != nil {
+		return nil, err
+	}
+
+	c.pending[txn.TxIDHex()] = pendingTx{
+		wallet:  w,
+		created: now,
+	}
+
 	return txn, nil
 }
 
+// chooseWallet returns the wallet with the largest spendable balance
+// whose balance, max payout and daily limit cover amount
+func (c *RPC) chooseWallet(amount uint64) (*hotWallet, error) {
+	var chosen *hotWallet
+	var chosenBalance uint64
+
+	for _, w := range c.wallets {
+		if w.maxPayout != 0 && amount > w.maxPayout {
+			continue
+		}
+
+		if w.dailyLimit != 0 {
+			withinLimit, err := c.withinDailyLimit(w, amount)
+			if err != nil {
+				return nil, err
+			}
+
+			if !withinLimit {
+				continue
+			}
+		}
+
+		bal, err := c.client.GetBalanceOfAddresses(w.addrs)
+		if err != nil {
+			return nil, err
+		}
+
+		coins, err := droplet.FromString(bal.Coins)
+		if err != nil {
+			return nil, err
+		}
+
+		if coins >= amount && coins > chosenBalance {
+			chosen = w
+			chosenBalance = coins
+		}
+	}
+
+	if chosen == nil {
+		return nil, ErrNoWalletCanSend
+	}
+
+	return chosen, nil
+}
+
+// withinDailyLimit returns true if sending amount keeps the payouts from w
+// in the last 24 hours within its daily limit
+func (c *RPC) withinDailyLimit(w *hotWallet, amount uint64) (bool, error) {
+	sent, err := c.store.GetSentSince(w.file, time.Now().Add(-dailyLimitPeriod))
+	if err != nil {
+		return false, err
+	}
+
+	total, err := coin.AddUint64(sent, amount)
+	if err != nil {
+		return false, nil
+	}
+
+	return total <= w.dailyLimit, nil
+}
+
 // BroadcastTransaction broadcasts a transaction and returns its txid
 func (c *RPC) BroadcastTransaction(tx *coin.Transaction) (string, error) {
-	txid, err := c.rpcClient.InjectTransaction(tx)
+	txid, err := c.client.InjectTransaction(tx)
+
+	c.Lock()
+	delete(c.pending, tx.TxIDHex())
+	c.Unlock()
+
 	if err != nil {
 		return "", RPCError{err}
 	}
@@ -82,7 +366,7 @@ func (c *RPC) BroadcastTransaction(tx *coin.Transaction) (string, error) {
 
 // GetTransaction returns transaction by txid
 func (c *RPC) GetTransaction(txid string) (*webrpc.TxnResult, error) {
-	txn, err := c.rpcClient.GetTransactionByID(txid)
+	txn, err := c.client.GetTransactionByID(txid)
 	if err != nil {
 		return nil, RPCError{err}
 	}
@@ -90,19 +374,126 @@ func (c *RPC) GetTransaction(txid string) (*webrpc.TxnResult, error) {
 	return txn, nil
 }
 
-// Balance returns the balance of a wallet
+// Balance returns the total spendable balance of the hot wallets
 func (c *RPC) Balance() (*cli.Balance, error) {
-	bal, err := cli.CheckWalletBalance(c.rpcClient, c.walletFile)
+	var coins, hours uint64
+
+	for _, w := range c.wallets {
+		bal, err := c.client.GetBalanceOfAddresses(w.addrs)
+		if err != nil {
+			return nil, RPCError{err}
+		}
+
+		walletCoins, err := droplet.FromString(bal.Coins)
+		if err != nil {
+			return nil, err
+		}
+
+		walletHours, err := strconv.ParseUint(bal.Hours, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		coins += walletCoins
+		hours += walletHours
+	}
+
+	coinsStr, err := droplet.ToString(coins)
 	if err != nil {
-		return nil, RPCError{err}
+		return nil, err
 	}
 
-	return &bal.Spendable, nil
+	return &cli.Balance{
+		Coins: coinsStr,
+		Hours: strconv.FormatUint(hours, 10),
+	}, nil
+}
+
+// SweptTx is a sweep of a hot wallet to cold storage
+type SweptTx struct {
+	Wallet string
+	Txid   string
+	Coins  uint64
+}
+
+// Sweep sends the spendable balance above ceiling of each hot wallet to coldAddr.
+// Wallets with a created transaction waiting to be broadcast are skipped.
+func (c *RPC) Sweep(coldAddr string, ceiling uint64) ([]SweptTx, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	var swept []SweptTx
+	for _, w := range c.wallets {
+		if c.hasPendingTx(w) {
+			continue
+		}
+
+		bal, err := c.client.GetBalanceOfAddresses(w.addrs)
+		if err != nil {
+			return swept, RPCError{err}
+		}
+
+		coins, err := droplet.FromString(bal.Coins)
+		if err != nil {
+			return swept, err
+		}
+
+		if coins <= ceiling {
+			continue
+		}
+
+		// Transaction outputs can't be more precise than the coin's MaxDropletPrecision
+		amount := coins - ceiling
+		amount -= amount % c.coin.MaxDropletDivisor()
+		if amount == 0 {
+			continue
+		}
+
+		txn, err := w.createTransaction(c.client, []cli.SendAmount{{
+			Addr:  coldAddr,
+			Coins: amount,
+		}})
+		if err != nil {
+			return swept, RPCError{err}
+		}
+
+		txid, err := c.client.InjectTransaction(txn)
+		if err != nil {
+			return swept, RPCError{err}
+		}
+
+		c.swept[txid] = struct{}{}
+		swept = append(swept, SweptTx{
+			Wallet: w.file,
+			Txid:   txid,
+			Coins:  amount,
+		})
+	}
+
+	return swept, nil
+}
+
+// hasPendingTx returns true if a transaction created from w is waiting to be broadcast.
+// Pending transactions older than pendingTxTimeout are forgotten.
+func (c *RPC) hasPendingTx(w *hotWallet) bool {
+	found := false
+	for txid, p := range c.pending {
+		if time.Since(p.created) > pendingTxTimeout {
+			delete(c.pending, txid)
+			continue
+		}
+
+		if p.wallet == w {
+			found = true
+		}
+	}
+
+	return found
 }
 
-func validateSendAmount(amt cli.SendAmount) error {
+func validateSendAmount(fiberCoin fiber.Coin, amt cli.SendAmount) error {
 	// validate the recvAddr
-	if _, err := cipher.DecodeBase58Address(amt.Addr); err != nil {
+	if _, err := fiberCoin.DecodeAddress(amt.Addr); err != nil {
 		return err
 	}
 
@@ -0,0 +1,649 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/api/cli"
+	"github.com/skycoin/skycoin/src/api/webrpc"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/visor/historydb"
+	"github.com/skycoin/skycoin/src/wallet"
+
+	"github.com/skycoin/teller/src/fiber"
+	"github.com/skycoin/teller/src/util/testutil"
+	"github.com/skycoin/teller/src/util/walletcrypt"
+)
+
+type createdTx struct {
+	walletFile string
+	wallet     *wallet.Wallet
+	signed     bool // The wallet's secret keys were present when the transaction was created
+	inAddrs    []string
+	changeAddr string
+	toAddrs    []cli.SendAmount
+}
+
+type fakeWalletClient struct {
+	balances   map[string]cli.Balance // Keyed by the first address of each wallet
+	balanceErr error
+	created    []createdTx
+	injected   []*coin.Transaction
+	uxouts     []webrpc.AddrUxoutResult
+	txns       map[string]*webrpc.TxnResult
+	outgoing   visor.ReadableOutputs // Outputs being spent by unconfirmed transactions
+}
+
+func newFakeWalletClient() *fakeWalletClient {
+	return &fakeWalletClient{
+		balances: make(map[string]cli.Balance),
+		txns:     make(map[string]*webrpc.TxnResult),
+	}
+}
+
+func (c *fakeWalletClient) setBalance(w *hotWallet, bal cli.Balance) {
+	c.balances[w.addrs[0]] = bal
+}
+
+func (c *fakeWalletClient) CreateRawTx(wlt *wallet.Wallet, inAddrs []string, changeAddr string, toAddrs []cli.SendAmount) (*coin.Transaction, error) {
+	signed := true
+	for _, e := range wlt.Entries {
+		if e.Secret == (cipher.SecKey{}) {
+			signed = false
+		}
+	}
+
+	c.created = append(c.created, createdTx{
+		walletFile: wlt.Meta["filename"],
+		wallet:     wlt,
+		signed:     signed,
+		inAddrs:    inAddrs,
+		changeAddr: changeAddr,
+		toAddrs:    toAddrs,
+	})
+
+	txn := &coin.Transaction{}
+	for _, a := range toAddrs {
+		addr, err := cipher.DecodeBase58Address(a.Addr)
+		if err != nil {
+			return nil, err
+		}
+
+		txn.PushOutput(addr, a.Coins, 0)
+	}
+
+	// Make each transaction's txid unique
+	txn.PushInput(cipher.SumSHA256([]byte(fmt.Sprintf("%s%s%d", inAddrs[0], changeAddr, len(c.created)))))
+
+	return txn, nil
+}
+
+func (c *fakeWalletClient) CreateUnsignedTx(inAddrs []string, changeAddr string, toAddrs []cli.SendAmount) (*coin.Transaction, []string, error) {
+	c.created = append(c.created, createdTx{
+		inAddrs:    inAddrs,
+		changeAddr: changeAddr,
+		toAddrs:    toAddrs,
+	})
+
+	txn := &coin.Transaction{}
+	for _, a := range toAddrs {
+		addr, err := cipher.DecodeBase58Address(a.Addr)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		txn.PushOutput(addr, a.Coins, 0)
+	}
+
+	txn.PushInput(cipher.SumSHA256([]byte(fmt.Sprintf("%s%s%d", inAddrs[0], changeAddr, len(c.created)))))
+
+	return txn, []string{inAddrs[0]}, nil
+}
+
+func (c *fakeWalletClient) GetBalanceOfAddresses(addrs []string) (*cli.Balance, error) {
+	if c.balanceErr != nil {
+		return nil, c.balanceErr
+	}
+
+	bal := c.balances[addrs[0]]
+	return &bal, nil
+}
+
+func (c *fakeWalletClient) InjectTransaction(tx *coin.Transaction) (string, error) {
+	c.injected = append(c.injected, tx)
+	return tx.TxIDHex(), nil
+}
+
+func (c *fakeWalletClient) GetTransactionByID(txid string) (*webrpc.TxnResult, error) {
+	txn, ok := c.txns[txid]
+	if !ok {
+		return nil, &webrpc.RPCError{
+			Code:    -32600,
+			Message: txNotFoundMsg,
+		}
+	}
+
+	return txn, nil
+}
+
+func (c *fakeWalletClient) GetAddressUxOuts(addrs []string) ([]webrpc.AddrUxoutResult, error) {
+	return c.uxouts, nil
+}
+
+func (c *fakeWalletClient) GetUnspentOutputs(addrs []string) (*webrpc.OutputsResult, error) {
+	return &webrpc.OutputsResult{
+		Outputs: visor.ReadableOutputSet{
+			OutgoingOutputs: c.outgoing,
+		},
+	}, nil
+}
+
+// addTx adds a transaction spending inputs, with outputs of 1 SKY to each of toAddrs
+func (c *fakeWalletClient) addTx(txid string, confirmed bool, inputs []string, toAddrs ...string) {
+	txn := &visor.TransactionResult{
+		Status: visor.TransactionStatus{
+			Confirmed: confirmed,
+		},
+		Transaction: visor.ReadableTransaction{
+			Hash: txid,
+			In:   inputs,
+		},
+	}
+
+	for _, a := range toAddrs {
+		txn.Transaction.Out = append(txn.Transaction.Out, visor.ReadableTransactionOutput{
+			Address: a,
+			Coins:   "1.000000",
+		})
+	}
+
+	c.txns[txid] = &webrpc.TxnResult{
+		Transaction: txn,
+	}
+}
+
+type signRequest struct {
+	wallet     string
+	txn        *coin.Transaction
+	inputAddrs []string
+}
+
+type fakeTxSigner struct {
+	requests []signRequest
+	err      error
+}
+
+func (s *fakeTxSigner) Sign(wallet string, txn *coin.Transaction, inputAddrs []string) (*coin.Transaction, error) {
+	s.requests = append(s.requests, signRequest{
+		wallet:     wallet,
+		txn:        txn,
+		inputAddrs: inputAddrs,
+	})
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	signed := *txn
+	signed.Sigs = make([]cipher.Sig, len(txn.In))
+	return &signed, nil
+}
+
+func testAddress() string {
+	pk, _ := cipher.GenerateKeyPair()
+	return cipher.AddressFromPubKey(pk).String()
+}
+
+// newTestWallet creates a wallet file with n addresses in dir
+func newTestWallet(t *testing.T, dir, name string, n uint64) *wallet.Wallet {
+	wlt, err := wallet.NewWallet(name, wallet.Options{
+		Seed: name,
+	})
+	require.NoError(t, err)
+
+	_, err = wlt.GenerateAddresses(n)
+	require.NoError(t, err)
+
+	require.NoError(t, wlt.Save(dir))
+
+	return wlt
+}
+
+// newTestHotWallet creates an encrypted hot wallet file with n addresses.
+// The keys are held in memory, so the file is removed before returning.
+func newTestHotWallet(t *testing.T, file string, n uint64) *hotWallet {
+	dir, err := ioutil.TempDir("", "teller-sender")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	wlt := newTestWallet(t, dir, file, n)
+
+	ew, err := walletcrypt.Encrypt(wlt, []byte("password"), 1)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "encrypted-"+file)
+	require.NoError(t, ew.Save(path))
+
+	keys, err := walletcrypt.OpenKeys(path, []byte("password"), false)
+	require.NoError(t, err)
+
+	return &hotWallet{
+		file:        file,
+		addrs:       keys.Addresses(),
+		changeAddrs: keys.Addresses(),
+		keys:        keys,
+	}
+}
+
+func newTestRPC(t *testing.T, client *fakeWalletClient, wallets ...*hotWallet) (*RPC, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+
+	store, err := NewStore(db)
+	require.NoError(t, err)
+
+	return &RPC{
+		coin:    fiber.Skycoin,
+		wallets: wallets,
+		client:  client,
+		store:   store,
+		pending: make(map[string]pendingTx),
+		swept:   make(map[string]struct{}),
+	}, shutdown
+}
+
+func TestRPCCreateTransactionZeroesKeys(t *testing.T) {
+	client := newFakeWalletClient()
+	a := newTestHotWallet(t, "a.wlt", 2)
+	client.setBalance(a, cli.Balance{Coins: "100.000000", Hours: "10"})
+
+	c, shutdown := newTestRPC(t, client, a)
+	defer shutdown()
+
+	_, err := c.CreateTransaction(testAddress(), 1e6)
+	require.NoError(t, err)
+	require.Len(t, client.created, 1)
+
+	// The transaction is signed with the decrypted keys, which are erased afterwards
+	created := client.created[0]
+	require.True(t, created.signed)
+	require.Equal(t, a.addrs, created.inAddrs)
+	for _, e := range created.wallet.Entries {
+		require.Equal(t, cipher.SecKey{}, e.Secret)
+	}
+}
+
+func TestRPCCreateTransactionExternalSigner(t *testing.T) {
+	client := newFakeWalletClient()
+	txSigner := &fakeTxSigner{}
+
+	addrs := []string{testAddress(), testAddress()}
+	w := &hotWallet{
+		file:        "signer.wlt",
+		addrs:       addrs,
+		changeAddrs: addrs,
+		signer:      txSigner,
+	}
+	client.setBalance(w, cli.Balance{Coins: "100.000000", Hours: "10"})
+
+	c, shutdown := newTestRPC(t, client, w)
+	defer shutdown()
+	recvAddr := testAddress()
+
+	// The transaction is created unsigned and signed by the signer
+	txn, err := c.CreateTransaction(recvAddr, 1e6)
+	require.NoError(t, err)
+	require.Len(t, txn.Sigs, 1)
+
+	require.Len(t, client.created, 1)
+	require.Nil(t, client.created[0].wallet)
+	require.Equal(t, addrs, client.created[0].inAddrs)
+
+	require.Len(t, txSigner.requests, 1)
+	require.Equal(t, "signer.wlt", txSigner.requests[0].wallet)
+	require.Equal(t, []string{addrs[0]}, txSigner.requests[0].inputAddrs)
+	require.Equal(t, recvAddr, txSigner.requests[0].txn.Out[0].Address.String())
+
+	// A rejected transaction is not pending
+	txSigner.err = errors.New("Transaction rejected by policy")
+	_, err = c.CreateTransaction(recvAddr, 1e6)
+	require.Equal(t, RPCError{txSigner.err}, err)
+	require.Len(t, c.pending, 1)
+}
+
+func TestRPCCreateTransactionChoosesWallet(t *testing.T) {
+	client := newFakeWalletClient()
+
+	a := newTestHotWallet(t, "a.wlt", 1)
+	b := newTestHotWallet(t, "b.wlt", 1)
+	client.setBalance(a, cli.Balance{Coins: "100.000000", Hours: "10"})
+	client.setBalance(b, cli.Balance{Coins: "300.000000", Hours: "20"})
+
+	c, shutdown := newTestRPC(t, client, a, b)
+	defer shutdown()
+	recvAddr := testAddress()
+
+	// The wallet with the largest balance is used
+	_, err := c.CreateTransaction(recvAddr, 50e6)
+	require.NoError(t, err)
+	require.Equal(t, "b.wlt", client.created[0].walletFile)
+
+	// Payouts larger than a wallet's max_payout are sent from another wallet
+	_, err = c.CreateTransaction(recvAddr, 80e6)
+	require.NoError(t, err)
+	require.Equal(t, "b.wlt", client.created[1].walletFile)
+
+	_, err = c.CreateTransaction(recvAddr, 90e6)
+	require.NoError(t, err)
+	require.Equal(t, "b.wlt", client.created[2].walletFile)
+
+	b.maxPayout = 60e6
+	_, err = c.CreateTransaction(recvAddr, 90e6)
+	require.NoError(t, err)
+	require.Equal(t, "a.wlt", client.created[3].walletFile)
+
+	// No wallet can cover the payout
+	_, err = c.CreateTransaction(recvAddr, 200e6)
+	require.Equal(t, RPCError{ErrNoWalletCanSend}, err)
+	require.Len(t, client.created, 4)
+
+	client.balanceErr = errors.New("balance failed")
+	_, err = c.CreateTransaction(recvAddr, 10e6)
+	require.Equal(t, RPCError{client.balanceErr}, err)
+}
+
+func TestRPCCreateTransactionDailyLimit(t *testing.T) {
+	client := newFakeWalletClient()
+
+	a := newTestHotWallet(t, "a.wlt", 1)
+	b := newTestHotWallet(t, "b.wlt", 1)
+	a.dailyLimit = 100e6
+	b.dailyLimit = 100e6
+	client.setBalance(a, cli.Balance{Coins: "1000.000000", Hours: "10"})
+	client.setBalance(b, cli.Balance{Coins: "500.000000", Hours: "20"})
+
+	c, shutdown := newTestRPC(t, client, a, b)
+	defer shutdown()
+	recvAddr := testAddress()
+
+	// Payouts up to the daily limit are sent from the wallet with the largest balance
+	_, err := c.CreateTransaction(recvAddr, 60e6)
+	require.NoError(t, err)
+	require.Equal(t, "a.wlt", client.created[0].walletFile)
+
+	_, err = c.CreateTransaction(recvAddr, 40e6)
+	require.NoError(t, err)
+	require.Equal(t, "a.wlt", client.created[1].walletFile)
+
+	sent, err := c.store.GetSentSince(a.file, time.Now().Add(-dailyLimitPeriod))
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), sent)
+
+	// Once a wallet has reached its limit, payouts are sent from another wallet
+	_, err = c.CreateTransaction(recvAddr, 1e6)
+	require.NoError(t, err)
+	require.Equal(t, "b.wlt", client.created[2].walletFile)
+
+	_, err = c.CreateTransaction(recvAddr, 99e6)
+	require.NoError(t, err)
+	require.Equal(t, "b.wlt", client.created[3].walletFile)
+
+	// No wallet can send more today
+	_, err = c.CreateTransaction(recvAddr, 1e6)
+	require.Equal(t, RPCError{ErrNoWalletCanSend}, err)
+	require.Len(t, client.created, 4)
+
+	// The limits hold for a new RPC using the same store, e.g. after a restart
+	c2 := &RPC{
+		coin:    fiber.Skycoin,
+		wallets: []*hotWallet{a, b},
+		client:  client,
+		store:   c.store,
+		pending: make(map[string]pendingTx),
+		swept:   make(map[string]struct{}),
+	}
+
+	_, err = c2.CreateTransaction(recvAddr, 1e6)
+	require.Equal(t, RPCError{ErrNoWalletCanSend}, err)
+}
+
+func TestRPCCreateTransactionDailyLimitRollover(t *testing.T) {
+	client := newFakeWalletClient()
+
+	a := newTestHotWallet(t, "a.wlt", 1)
+	a.dailyLimit = 100e6
+	client.setBalance(a, cli.Balance{Coins: "1000.000000", Hours: "10"})
+
+	c, shutdown := newTestRPC(t, client, a)
+	defer shutdown()
+	recvAddr := testAddress()
+
+	// A payout made more than 24 hours ago does not count towards the limit
+	err := c.store.AddPayout(Payout{
+		Txid:      "old-txid",
+		Wallet:    a.file,
+		Coins:     100e6,
+		CreatedAt: time.Now().Add(-dailyLimitPeriod - time.Minute),
+	})
+	require.NoError(t, err)
+
+	// Payouts of other wallets do not count towards the limit
+	err = c.store.AddPayout(Payout{
+		Txid:      "other-wallet-txid",
+		Wallet:    "b.wlt",
+		Coins:     100e6,
+		CreatedAt: time.Now(),
+	})
+	require.NoError(t, err)
+
+	_, err = c.CreateTransaction(recvAddr, 70e6)
+	require.NoError(t, err)
+	require.Equal(t, "a.wlt", client.created[0].walletFile)
+
+	// A payout made within the last 24 hours counts
+	err = c.store.AddPayout(Payout{
+		Txid:      "recent-txid",
+		Wallet:    a.file,
+		Coins:     20e6,
+		CreatedAt: time.Now().Add(-dailyLimitPeriod + time.Minute),
+	})
+	require.NoError(t, err)
+
+	_, err = c.CreateTransaction(recvAddr, 20e6)
+	require.Equal(t, RPCError{ErrNoWalletCanSend}, err)
+
+	_, err = c.CreateTransaction(recvAddr, 10e6)
+	require.NoError(t, err)
+	require.Len(t, client.created, 2)
+}
+
+func TestRPCCreateTransactionRotatesChangeAddress(t *testing.T) {
+	client := newFakeWalletClient()
+	a := newTestHotWallet(t, "a.wlt", 3)
+	client.setBalance(a, cli.Balance{Coins: "100.000000", Hours: "10"})
+
+	c, shutdown := newTestRPC(t, client, a)
+	defer shutdown()
+	changeAddrs := a.addrs
+
+	recvAddr := testAddress()
+	for i := 0; i < 4; i++ {
+		_, err := c.CreateTransaction(recvAddr, 1e6)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, client.created, 4)
+	require.Equal(t, changeAddrs[0], client.created[0].changeAddr)
+	require.Equal(t, changeAddrs[1], client.created[1].changeAddr)
+	require.Equal(t, changeAddrs[2], client.created[2].changeAddr)
+	require.Equal(t, changeAddrs[0], client.created[3].changeAddr)
+}
+
+func TestRPCBalance(t *testing.T) {
+	client := newFakeWalletClient()
+	a := newTestHotWallet(t, "a.wlt", 1)
+	b := newTestHotWallet(t, "b.wlt", 1)
+	client.setBalance(a, cli.Balance{Coins: "100.500000", Hours: "10"})
+	client.setBalance(b, cli.Balance{Coins: "300.000000", Hours: "20"})
+
+	c, shutdown := newTestRPC(t, client, a, b)
+	defer shutdown()
+
+	bal, err := c.Balance()
+	require.NoError(t, err)
+	require.Equal(t, &cli.Balance{
+		Coins: "400.500000",
+		Hours: "30",
+	}, bal)
+
+	client.balanceErr = errors.New("balance failed")
+	_, err = c.Balance()
+	require.Equal(t, RPCError{client.balanceErr}, err)
+}
+
+func TestRPCSweep(t *testing.T) {
+	client := newFakeWalletClient()
+
+	a := newTestHotWallet(t, "a.wlt", 1)
+	b := newTestHotWallet(t, "b.wlt", 1)
+	client.setBalance(a, cli.Balance{Coins: "100.000000", Hours: "10"})
+	client.setBalance(b, cli.Balance{Coins: "300.123456", Hours: "20"})
+
+	c, shutdown := newTestRPC(t, client, a, b)
+	defer shutdown()
+	coldAddr := testAddress()
+
+	// Only the balance above the ceiling is swept, truncated to the allowed droplet precision
+	swept, err := c.Sweep(coldAddr, 200e6)
+	require.NoError(t, err)
+	require.Len(t, swept, 1)
+	require.Equal(t, "b.wlt", swept[0].Wallet)
+	require.Equal(t, uint64(100123000), swept[0].Coins)
+	require.Equal(t, client.injected[0].TxIDHex(), swept[0].Txid)
+	require.Equal(t, []cli.SendAmount{{
+		Addr:  coldAddr,
+		Coins: 100123000,
+	}}, client.created[0].toAddrs)
+
+	// A wallet with a payout waiting to be broadcast is not swept
+	txn, err := c.CreateTransaction(testAddress(), 1e6)
+	require.NoError(t, err)
+	require.Equal(t, "b.wlt", client.created[1].walletFile)
+
+	swept, err = c.Sweep(coldAddr, 50e6)
+	require.NoError(t, err)
+	require.Len(t, swept, 1)
+	require.Equal(t, "a.wlt", swept[0].Wallet)
+
+	_, err = c.BroadcastTransaction(txn)
+	require.NoError(t, err)
+
+	swept, err = c.Sweep(coldAddr, 50e6)
+	require.NoError(t, err)
+	require.Len(t, swept, 2)
+}
+
+func TestRPCWalletHistory(t *testing.T) {
+	client := newFakeWalletClient()
+	a := newTestHotWallet(t, "a.wlt", 2)
+	b := newTestHotWallet(t, "b.wlt", 1)
+
+	c, shutdown := newTestRPC(t, client, a, b)
+	defer shutdown()
+	recvAddr := testAddress()
+	unspent := cipher.SHA256{}.Hex()
+
+	// Two confirmed transactions spent hot wallet outputs, one of them twice
+	client.uxouts = []webrpc.AddrUxoutResult{
+		{
+			Address: a.addrs[0],
+			UxOuts: []*historydb.UxOutJSON{
+				{Uxid: "ux1", SpentTxID: "tx1"},
+				{Uxid: "ux2", SpentTxID: "tx1"},
+				{Uxid: "ux3", SpentTxID: unspent},
+			},
+		},
+		{
+			Address: b.addrs[0],
+			UxOuts: []*historydb.UxOutJSON{
+				{Uxid: "ux4", SpentTxID: "tx2"},
+			},
+		},
+	}
+	client.addTx("tx1", true, []string{"ux1", "ux2"}, recvAddr, a.addrs[1])
+	client.addTx("tx2", true, []string{"ux4"}, recvAddr)
+
+	// A pending transaction is unconfirmed, another was dropped by the node
+	client.addTx("tx3", false, []string{"ux3"}, recvAddr)
+	client.outgoing = visor.ReadableOutputs{{Hash: "ux3"}}
+
+	history, err := c.WalletHistory([]string{"tx1", "tx3", "tx4"})
+	require.NoError(t, err)
+
+	// Change to the hot wallets is omitted
+	require.Equal(t, []OutgoingTx{
+		{Txid: "tx1", Confirmed: true, Outputs: []TxOutput{{Address: recvAddr, Coins: 1e6}}},
+		{Txid: "tx2", Confirmed: true, Outputs: []TxOutput{{Address: recvAddr, Coins: 1e6}}},
+		{Txid: "tx3", Confirmed: false, Outputs: []TxOutput{{Address: recvAddr, Coins: 1e6}}},
+	}, history.Transactions)
+	require.Equal(t, []string{"tx4"}, history.Missing)
+	require.Empty(t, history.UnknownSpends)
+
+	// Unconfirmed spends by transactions that are not pending are unknown
+	history, err = c.WalletHistory(nil)
+	require.NoError(t, err)
+	require.Len(t, history.Transactions, 2)
+	require.Empty(t, history.Missing)
+	require.Equal(t, []string{"ux3"}, history.UnknownSpends)
+
+	// Unconfirmed sweeps are known, and forgotten once confirmed
+	client.addTx("tx5", false, []string{"ux5"}, testAddress())
+	client.outgoing = visor.ReadableOutputs{{Hash: "ux5"}}
+	c.swept["tx5"] = struct{}{}
+
+	history, err = c.WalletHistory(nil)
+	require.NoError(t, err)
+	require.Len(t, history.Transactions, 3)
+	require.Empty(t, history.UnknownSpends)
+
+	client.txns["tx5"].Transaction.Status.Confirmed = true
+	client.uxouts[0].UxOuts = append(client.uxouts[0].UxOuts, &historydb.UxOutJSON{Uxid: "ux5", SpentTxID: "tx5"})
+	client.outgoing = nil
+
+	history, err = c.WalletHistory(nil)
+	require.NoError(t, err)
+	require.Len(t, history.Transactions, 3)
+	require.Empty(t, c.swept)
+}
+
+func TestRPCInputSpends(t *testing.T) {
+	client := newFakeWalletClient()
+	a := newTestHotWallet(t, "a.wlt", 1)
+
+	c, shutdown := newTestRPC(t, client, a)
+	defer shutdown()
+
+	client.uxouts = []webrpc.AddrUxoutResult{
+		{
+			Address: a.addrs[0],
+			UxOuts: []*historydb.UxOutJSON{
+				{Uxid: "ux1", SpentTxID: "tx1"},
+				{Uxid: "ux2", SpentTxID: cipher.SHA256{}.Hex()},
+				{Uxid: "ux3", SpentTxID: "tx2"},
+			},
+		},
+	}
+
+	// Unspent and unknown outputs are omitted
+	spends, err := c.InputSpends([]string{"ux1", "ux2", "ux4"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"ux1": "tx1"}, spends)
+}
@@ -12,14 +12,19 @@ var (
 	ErrSendBufferFull = errors.New("Send service's request queue is full")
 	// ErrClosed the sender has closed
 	ErrClosed = errors.New("Send service closed")
+	// ErrTxNotFound the skycoin node does not know the transaction
+	ErrTxNotFound = errors.New("Transaction not found")
 )
 
 // Sender provids apis for sending skycoin
 type Sender interface {
 	CreateTransaction(string, uint64) (*coin.Transaction, error)
 	BroadcastTransaction(*coin.Transaction) *BroadcastTxResponse
+	RebroadcastTransaction(*coin.Transaction) error
 	IsTxConfirmed(string) *ConfirmResponse
+	InputSpends([]string) (map[string]string, error)
 	Balance() (*cli.Balance, error)
+	WalletHistory([]string) (*WalletHistory, error)
 }
 
 // RetrySender provids helper function to send coins with Send service
@@ -54,6 +59,13 @@ func (s *RetrySender) BroadcastTransaction(tx *coin.Transaction) *BroadcastTxRes
 	return <-rspC
 }
 
+// RebroadcastTransaction broadcasts a transaction that was broadcast before.
+// Unlike BroadcastTransaction, it is not retried, since the transaction may no longer be valid.
+func (s *RetrySender) RebroadcastTransaction(tx *coin.Transaction) error {
+	_, err := s.s.SkyClient.BroadcastTransaction(tx)
+	return err
+}
+
 // IsTxConfirmed checks if tx is confirmed
 func (s *RetrySender) IsTxConfirmed(txid string) *ConfirmResponse {
 	rspC := make(chan *ConfirmResponse, 1)
@@ -68,7 +80,17 @@ func (s *RetrySender) IsTxConfirmed(txid string) *ConfirmResponse {
 	return <-rspC
 }
 
+// InputSpends returns the txids of the confirmed transactions that spent the given hot wallet outputs
+func (s *RetrySender) InputSpends(uxids []string) (map[string]string, error) {
+	return s.s.SkyClient.InputSpends(uxids)
+}
+
 // Balance returns the remaining balance of the sender
 func (s *RetrySender) Balance() (*cli.Balance, error) {
 	return s.s.SkyClient.Balance()
 }
+
+// WalletHistory returns the transactions sent from the hot wallets
+func (s *RetrySender) WalletHistory(pending []string) (*WalletHistory, error) {
+	return s.s.SkyClient.WalletHistory(pending)
+}
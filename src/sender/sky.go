@@ -77,7 +77,9 @@ type SkyClient interface {
 	CreateTransaction(string, uint64) (*coin.Transaction, error)
 	BroadcastTransaction(*coin.Transaction) (string, error)
 	GetTransaction(string) (*webrpc.TxnResult, error)
+	InputSpends([]string) (map[string]string, error)
 	Balance() (*cli.Balance, error)
+	WalletHistory([]string) (*WalletHistory, error)
 }
 
 // NewService creates sender instance
@@ -177,6 +179,15 @@ func (s *SendService) ConfirmRetry(req ConfirmRequest) (*ConfirmResponse, error)
 	for {
 		tx, err := s.SkyClient.GetTransaction(req.Txid)
 		if err != nil {
+			// The node may have dropped the transaction, which is not going to change by retrying
+			if isTxNotFound(err) {
+				log.WithError(err).Warn("SkyClient.GetTransaction did not find the transaction")
+				return &ConfirmResponse{
+					Err: ErrTxNotFound,
+					Req: req,
+				}, nil
+			}
+
 			log.WithError(err).Error("SkyClient.GetTransaction failed, trying again...")
 
 			select {
@@ -14,6 +14,7 @@ import (
 	"github.com/skycoin/skycoin/src/coin"
 	"github.com/skycoin/skycoin/src/visor"
 
+	"github.com/skycoin/teller/src/fiber"
 	"github.com/skycoin/teller/src/util/testutil"
 )
 
@@ -73,6 +74,14 @@ func (ds *dummySkyClient) GetTransaction(txid string) (*webrpc.TxnResult, error)
 	return &txjson, ds.getTxErr
 }
 
+func (ds *dummySkyClient) InputSpends(uxids []string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (ds *dummySkyClient) WalletHistory(pending []string) (*WalletHistory, error) {
+	return &WalletHistory{}, nil
+}
+
 func (ds *dummySkyClient) Balance() (*cli.Balance, error) {
 	return &cli.Balance{
 		Coins: "100.000000",
@@ -221,7 +230,7 @@ func TestCreateTransactionVerify(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := validateSendAmount(tc.sendAmount)
+			err := validateSendAmount(fiber.Skycoin, tc.sendAmount)
 			require.Equal(t, tc.err, err != nil)
 		})
 	}
@@ -0,0 +1,77 @@
+package sender
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/skycoin/src/coin"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+// PayoutBkt maps a txid to the Payout record of a payout transaction created from a hot wallet
+var PayoutBkt = []byte("hot_wallet_payouts")
+
+// Payout records a payout transaction created from a hot wallet
+type Payout struct {
+	Txid      string    `json:"txid"`
+	Wallet    string    `json:"wallet"`
+	Coins     uint64    `json:"coins"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store records the payouts created from the hot wallets, for their daily limits
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore creates a Store
+func NewStore(db *bolt.DB) (*Store, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(PayoutBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(PayoutBkt, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db: db,
+	}, nil
+}
+
+// AddPayout records a payout
+func (s *Store) AddPayout(p Payout) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, PayoutBkt, p.Txid, p)
+	})
+}
+
+// GetSentSince returns the droplets paid out from a wallet by payouts created after t
+func (s *Store) GetSentSince(wallet string, t time.Time) (uint64, error) {
+	var sent uint64
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, PayoutBkt, func(k, v []byte) error {
+			var p Payout
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+
+			if p.Wallet != wallet || !p.CreatedAt.After(t) {
+				return nil
+			}
+
+			var err error
+			sent, err = coin.AddUint64(sent, p.Coins)
+			return err
+		})
+	}); err != nil {
+		return 0, err
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,96 @@
+package sender
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// WalletSweeper sweeps hot wallet balance above a ceiling to an address
+type WalletSweeper interface {
+	Sweep(coldAddr string, ceiling uint64) ([]SweptTx, error)
+}
+
+// Sweeper periodically sweeps the hot wallet balance above the configured ceiling to cold storage
+type Sweeper struct {
+	log     logrus.FieldLogger
+	cfg     config.Sweep
+	ceiling uint64
+	wallets WalletSweeper
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// NewSweeper creates a Sweeper
+func NewSweeper(log logrus.FieldLogger, cfg config.Sweep, wallets WalletSweeper) (*Sweeper, error) {
+	ceiling, err := droplet.FromString(cfg.Ceiling)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sweeper{
+		log:     log.WithField("prefix", "sender.sweep"),
+		cfg:     cfg,
+		ceiling: ceiling,
+		wallets: wallets,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}, 1),
+	}, nil
+}
+
+// Run sweeps the hot wallets every cfg.CheckWait
+func (s *Sweeper) Run() error {
+	log := s.log
+	log.Info("Start sweep service...")
+	defer func() {
+		log.Info("Closed sweep service")
+		s.done <- struct{}{}
+	}()
+
+	ticker := time.NewTicker(s.cfg.CheckWait)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			log.Info("quit")
+			return nil
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+// Shutdown stops the Sweeper
+func (s *Sweeper) Shutdown() {
+	close(s.quit)
+	s.log.Info("Waiting for run to finish")
+	<-s.done
+	s.log.Info("Shutdown complete")
+}
+
+func (s *Sweeper) sweep() {
+	log := s.log.WithFields(logrus.Fields{
+		"coldAddress": s.cfg.ColdAddress,
+		"ceiling":     s.cfg.Ceiling,
+	})
+
+	swept, err := s.wallets.Sweep(s.cfg.ColdAddress, s.ceiling)
+
+	for _, t := range swept {
+		log.WithFields(logrus.Fields{
+			"wallet": t.Wallet,
+			"txid":   t.Txid,
+			"coins":  t.Coins,
+		}).Info("Swept hot wallet to cold storage")
+	}
+
+	if err != nil {
+		log.WithField("notice", logger.WatchNotice).WithError(err).Error("Sweeping hot wallets failed")
+	}
+}
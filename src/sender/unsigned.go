@@ -0,0 +1,108 @@
+package sender
+
+import (
+	"github.com/skycoin/skycoin/src/api/cli"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/util/fee"
+	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/wallet"
+)
+
+// createUnsignedTx creates a transaction spending the outputs of inAddrs to toAddrs, without signing it.
+// It returns the address owning each input, which is needed to sign the transaction.
+// The outputs are chosen and coin hours distributed the same way as cli.CreateRawTx.
+func createUnsignedTx(uxouts visor.ReadableOutputSet, changeAddr string, toAddrs []cli.SendAmount) (*coin.Transaction, []string, error) {
+	var totalCoins uint64
+	for _, to := range toAddrs {
+		totalCoins += to.Coins
+	}
+
+	spendable, err := visor.ReadableOutputsToUxBalances(uxouts.SpendableOutputs())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	spends, err := wallet.ChooseSpendsMinimizeUxOuts(spendable, totalCoins)
+	if err != nil {
+		if err != wallet.ErrInsufficientBalance {
+			return nil, nil, err
+		}
+
+		// The balance may be sufficient once incoming outputs confirm
+		expected, otherErr := visor.ReadableOutputsToUxBalances(uxouts.ExpectedOutputs())
+		if otherErr != nil {
+			return nil, nil, otherErr
+		}
+
+		if _, otherErr := wallet.ChooseSpendsMinimizeUxOuts(expected, totalCoins); otherErr != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, cli.ErrTemporaryInsufficientBalance
+	}
+
+	var totalInCoins, totalInHours uint64
+	for _, s := range spends {
+		totalInCoins += s.Coins
+		totalInHours += s.Hours
+	}
+
+	if totalInHours == 0 {
+		return nil, nil, fee.ErrTxnNoFee
+	}
+
+	if totalInCoins < totalCoins {
+		return nil, nil, wallet.ErrInsufficientBalance
+	}
+
+	changeCoins := totalInCoins - totalCoins
+	haveChange := changeCoins > 0
+	changeHours, addrHours, totalOutHours := wallet.DistributeSpendHours(totalInHours, uint64(len(toAddrs)), haveChange)
+
+	if err := fee.VerifyTransactionFeeForHours(totalOutHours, totalInHours-totalOutHours); err != nil {
+		return nil, nil, err
+	}
+
+	txn := &coin.Transaction{}
+	inputAddrs := make([]string, len(spends))
+	for i, s := range spends {
+		txn.PushInput(s.Hash)
+		inputAddrs[i] = s.Address.String()
+	}
+
+	for i, to := range toAddrs {
+		// Cap the coin hours sent to each address to its coins, moving the difference to the change
+		if changeHours > 0 {
+			maxHours := to.Coins / 1e6
+			if maxHours == 0 {
+				maxHours = 1
+			}
+
+			if addrHours[i] > maxHours {
+				changeHours += addrHours[i] - maxHours
+				addrHours[i] = maxHours
+			}
+		}
+
+		addr, err := cipher.DecodeBase58Address(to.Addr)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		txn.PushOutput(addr, to.Coins, addrHours[i])
+	}
+
+	if haveChange {
+		addr, err := cipher.DecodeBase58Address(changeAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		txn.PushOutput(addr, changeCoins, changeHours)
+	}
+
+	txn.UpdateHeader()
+
+	return txn, inputAddrs, nil
+}
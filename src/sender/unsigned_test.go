@@ -0,0 +1,70 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/api/cli"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+func testOutput(addr, coins string, hours uint64) visor.ReadableOutput {
+	return visor.ReadableOutput{
+		Hash:            cipher.SumSHA256([]byte(addr + coins)).Hex(),
+		Address:         addr,
+		Coins:           coins,
+		Hours:           hours,
+		CalculatedHours: hours,
+	}
+}
+
+func TestCreateUnsignedTx(t *testing.T) {
+	addrA := testAddress()
+	addrB := testAddress()
+	changeAddr := testAddress()
+	recvAddr := testAddress()
+
+	outs := visor.ReadableOutputSet{
+		HeadOutputs: visor.ReadableOutputs{
+			testOutput(addrA, "5.000000", 100),
+			testOutput(addrB, "10.000000", 100),
+		},
+	}
+
+	// The largest outputs are spent first
+	txn, inputAddrs, err := createUnsignedTx(outs, changeAddr, []cli.SendAmount{{
+		Addr:  recvAddr,
+		Coins: 12e6,
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []string{addrB, addrA}, inputAddrs)
+	require.Len(t, txn.In, 2)
+	require.Empty(t, txn.Sigs)
+	require.Equal(t, txn.HashInner(), txn.InnerHash)
+
+	require.Len(t, txn.Out, 2)
+	require.Equal(t, recvAddr, txn.Out[0].Address.String())
+	require.Equal(t, uint64(12e6), txn.Out[0].Coins)
+	require.Equal(t, changeAddr, txn.Out[1].Address.String())
+	require.Equal(t, uint64(3e6), txn.Out[1].Coins)
+
+	// Half of the coin hours are burned as the fee
+	require.Equal(t, uint64(100), txn.Out[0].Hours+txn.Out[1].Hours)
+
+	_, _, err = createUnsignedTx(outs, changeAddr, []cli.SendAmount{{
+		Addr:  recvAddr,
+		Coins: 20e6,
+	}})
+	require.Error(t, err)
+
+	// Outputs being spent can't be spent again, but will be replaced by incoming outputs
+	outs.OutgoingOutputs = visor.ReadableOutputs{outs.HeadOutputs[1]}
+	outs.IncomingOutputs = visor.ReadableOutputs{testOutput(addrA, "9.000000", 10)}
+	_, _, err = createUnsignedTx(outs, changeAddr, []cli.SendAmount{{
+		Addr:  recvAddr,
+		Coins: 12e6,
+	}})
+	require.Equal(t, cli.ErrTemporaryInsufficientBalance, err)
+}
@@ -0,0 +1,142 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skycoin/skycoin/src/coin"
+)
+
+// ErrSignedTxMismatch is returned when the signer returns a transaction different from the one sent to be signed
+var ErrSignedTxMismatch = errors.New("Signed transaction does not match the unsigned transaction")
+
+// Client makes requests to a signer over its Unix socket
+type Client struct {
+	httpClient *http.Client
+	token      string
+}
+
+// NewClient creates a Client for the signer listening on socket, authenticating with the token in tokenFile
+func NewClient(socket, tokenFile string, timeout time.Duration) (*Client, error) {
+	token, err := ReadToken(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		token: string(token),
+	}, nil
+}
+
+// ReadToken reads an auth token file
+func ReadToken(tokenFile string) ([]byte, error) {
+	b, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("Read signer token file failed: %v", err)
+	}
+
+	token := bytes.TrimSpace(b)
+	if len(token) == 0 {
+		return nil, errors.New("Signer token file is empty")
+	}
+
+	return token, nil
+}
+
+// Wallets returns the wallets held by the signer
+func (c *Client) Wallets() ([]Wallet, error) {
+	var rsp WalletsResponse
+	if err := c.do(http.MethodGet, "/api/wallets", nil, &rsp); err != nil {
+		return nil, err
+	}
+
+	return rsp.Wallets, nil
+}
+
+// Sign has the signer sign txn with the keys of wallet. inputAddrs is the address owning each input of txn.
+func (c *Client) Sign(wallet string, txn *coin.Transaction, inputAddrs []string) (*coin.Transaction, error) {
+	req := SignRequest{
+		Wallet:         wallet,
+		Transaction:    hex.EncodeToString(txn.Serialize()),
+		InputAddresses: inputAddrs,
+	}
+
+	var rsp SignResponse
+	if err := c.do(http.MethodPost, "/api/sign", req, &rsp); err != nil {
+		return nil, err
+	}
+
+	b, err := hex.DecodeString(rsp.Transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := coin.TransactionDeserialize(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signatures cover the inner hash, so the inputs and outputs can't have changed
+	if signed.HashInner() != txn.HashInner() {
+		return nil, ErrSignedTxMismatch
+	}
+
+	if err := signed.Verify(); err != nil {
+		return nil, err
+	}
+
+	return &signed, nil
+}
+
+func (c *Client) do(method, path string, body, rsp interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	// The host is ignored, requests are sent to the Unix socket
+	req, err := http.NewRequest(method, "http://signer"+path, &reqBody)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	r, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		var errRsp errorResponse
+		if err := json.NewDecoder(r.Body).Decode(&errRsp); err != nil || errRsp.Error == "" {
+			return fmt.Errorf("Signer request failed: %s", r.Status)
+		}
+
+		return fmt.Errorf("Signer request failed: %s: %s", strings.TrimSpace(r.Status), errRsp.Error)
+	}
+
+	return json.NewDecoder(r.Body).Decode(rsp)
+}
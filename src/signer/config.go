@@ -0,0 +1,121 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/util/droplet"
+)
+
+// Config is the teller-signer configuration
+type Config struct {
+	// Enable debug logging
+	Debug bool `mapstructure:"debug"`
+	// Where log is saved
+	LogFilename string `mapstructure:"logfile"`
+	// Database of the transactions signed, for the daily limit
+	DBFilename string `mapstructure:"dbfile"`
+	// Unix socket to listen on
+	Socket string `mapstructure:"socket"`
+	// File holding the auth token shared with teller
+	TokenFile string `mapstructure:"token_file"`
+	// Wallet files to sign with
+	Wallets []string `mapstructure:"wallets"`
+	// Largest amount of SKY to send in one transaction
+	MaxSend string `mapstructure:"max_send"`
+	// Largest amount of SKY to send in the last 24 hours
+	DailyLimit string `mapstructure:"daily_limit"`
+	// Addresses that can always be sent to, e.g. the cold storage address
+	AllowedAddresses []string `mapstructure:"allowed_addresses"`
+	// Export of teller's database. The SKY addresses bound in it can be sent to.
+	TellerDB string `mapstructure:"teller_db"`
+}
+
+// LoadConfig loads the configuration from a toml file
+func LoadConfig(path string) (Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("toml")
+
+	v.SetDefault("debug", false)
+	v.SetDefault("logfile", "./teller-signer.log")
+	v.SetDefault("dbfile", "teller-signer.db")
+
+	cfg := Config{}
+
+	if err := v.ReadInConfig(); err != nil {
+		return cfg, err
+	}
+
+	if err := v.Unmarshal(&cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// Validate validates the configuration
+func (c Config) Validate() error {
+	var errs []string
+	oops := func(err string) {
+		errs = append(errs, err)
+	}
+
+	if c.Socket == "" {
+		oops("socket missing")
+	}
+
+	if c.TokenFile == "" {
+		oops("token_file missing")
+	} else if _, err := os.Stat(c.TokenFile); os.IsNotExist(err) {
+		oops("token_file does not exist")
+	}
+
+	if len(c.Wallets) == 0 {
+		oops("wallets missing")
+	}
+	for _, w := range c.Wallets {
+		if _, err := os.Stat(w); os.IsNotExist(err) {
+			oops(fmt.Sprintf("wallet file %s does not exist", w))
+		}
+	}
+
+	if c.MaxSend == "" {
+		oops("max_send missing")
+	} else if _, err := droplet.FromString(c.MaxSend); err != nil {
+		oops(fmt.Sprintf("max_send invalid: %v", err))
+	}
+
+	if c.DailyLimit == "" {
+		oops("daily_limit missing")
+	} else if _, err := droplet.FromString(c.DailyLimit); err != nil {
+		oops(fmt.Sprintf("daily_limit invalid: %v", err))
+	}
+
+	for _, a := range c.AllowedAddresses {
+		if _, err := cipher.DecodeBase58Address(a); err != nil {
+			oops(fmt.Sprintf("allowed_addresses %s invalid: %v", a, err))
+		}
+	}
+
+	if c.TellerDB != "" {
+		if _, err := os.Stat(c.TellerDB); os.IsNotExist(err) {
+			oops("teller_db file does not exist")
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(errs, "\n"))
+}
@@ -0,0 +1,123 @@
+package signer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/util/droplet"
+)
+
+// dailyLimitPeriod is the rolling period that Policy.DailyLimit applies to
+const dailyLimitPeriod = 24 * time.Hour
+
+// PolicyError is returned when a transaction is rejected by the policy
+type PolicyError struct {
+	error
+}
+
+// NewPolicyError wraps err with PolicyError
+func NewPolicyError(err error) PolicyError {
+	return PolicyError{err}
+}
+
+// Policy decides which transactions the signer signs.
+// Outputs to the signing wallet's own addresses are change and are not limited.
+// Other outputs must go to an allowed address, and their total is limited per transaction and per day.
+type Policy struct {
+	// Largest amount of droplets to send in one transaction
+	MaxSend uint64
+	// Largest amount of droplets to send in the last 24 hours
+	DailyLimit uint64
+	// Addresses that can always be sent to, e.g. the cold storage address
+	AllowedAddresses []string
+	// Returns more addresses that can be sent to, e.g. the SKY addresses bound in teller's database
+	BoundAddresses func() ([]string, error)
+}
+
+// Check returns the amount sent to other addresses by txn, or a PolicyError if the policy rejects it
+func (p *Policy) Check(store *Store, txn *coin.Transaction, walletAddrs map[string]struct{}) (uint64, error) {
+	var amount uint64
+	var destinations []string
+	for _, o := range txn.Out {
+		addr := o.Address.String()
+		if _, ok := walletAddrs[addr]; ok {
+			continue
+		}
+
+		var err error
+		amount, err = coin.AddUint64(amount, o.Coins)
+		if err != nil {
+			return 0, NewPolicyError(fmt.Errorf("Output coins overflow: %v", err))
+		}
+
+		destinations = append(destinations, addr)
+	}
+
+	if len(destinations) != 0 {
+		allowed, err := p.allowedAddresses()
+		if err != nil {
+			return 0, err
+		}
+
+		for _, addr := range destinations {
+			if _, ok := allowed[addr]; !ok {
+				return 0, NewPolicyError(fmt.Errorf("Destination %s is not allowed", addr))
+			}
+		}
+	}
+
+	if amount > p.MaxSend {
+		return 0, newLimitError("Sending %s SKY exceeds max_send of %s SKY", amount, p.MaxSend)
+	}
+
+	sent, err := store.GetSentSince(time.Now().Add(-dailyLimitPeriod))
+	if err != nil {
+		return 0, err
+	}
+
+	total, err := coin.AddUint64(sent, amount)
+	if err != nil || total > p.DailyLimit {
+		return 0, newLimitError("Sending %s SKY exceeds daily_limit of %s SKY, %s SKY sent in the last 24 hours", amount, p.DailyLimit, sent)
+	}
+
+	return amount, nil
+}
+
+// allowedAddresses returns the configured allowed addresses and the bound addresses
+func (p *Policy) allowedAddresses() (map[string]struct{}, error) {
+	allowed := make(map[string]struct{}, len(p.AllowedAddresses))
+	for _, a := range p.AllowedAddresses {
+		allowed[a] = struct{}{}
+	}
+
+	if p.BoundAddresses == nil {
+		return allowed, nil
+	}
+
+	boundAddrs, err := p.BoundAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range boundAddrs {
+		allowed[a] = struct{}{}
+	}
+
+	return allowed, nil
+}
+
+// newLimitError returns a PolicyError with amounts of droplets formatted as SKY.
+// If an amount can't be formatted, the PolicyError reports that instead.
+func newLimitError(format string, amounts ...uint64) error {
+	args := make([]interface{}, len(amounts))
+	for i, amt := range amounts {
+		s, err := droplet.ToString(amt)
+		if err != nil {
+			return NewPolicyError(fmt.Errorf("Invalid amount %d: %v", amt, err))
+		}
+		args[i] = s
+	}
+
+	return NewPolicyError(fmt.Errorf(format, args...))
+}
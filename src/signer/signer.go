@@ -0,0 +1,313 @@
+// Package signer signs SKY transactions created by teller, so that teller doesn't hold the hot wallet's keys.
+// The signer serves a small HTTP API on a Unix socket, authenticated with a shared token.
+// Each transaction is checked against a policy before it is signed.
+package signer
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/walletcrypt"
+)
+
+var (
+	// ErrUnknownWallet is returned when signing for a wallet the signer doesn't hold
+	ErrUnknownWallet = errors.New("Unknown wallet")
+	// ErrInputNotInWallet is returned when an input address is not in the signing wallet
+	ErrInputNotInWallet = errors.New("Input address is not in the wallet")
+	// ErrAlreadySigned is returned when the transaction already has signatures
+	ErrAlreadySigned = errors.New("Transaction is already signed")
+	// ErrInputAddressesMismatch is returned when the input addresses don't match the transaction's inputs
+	ErrInputAddressesMismatch = errors.New("Input addresses don't match the transaction inputs")
+)
+
+// Wallet is a wallet held by the signer
+type Wallet struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+}
+
+// WalletsResponse is the response of GET /api/wallets
+type WalletsResponse struct {
+	Wallets []Wallet `json:"wallets"`
+}
+
+// SignRequest is the request body of POST /api/sign
+type SignRequest struct {
+	Wallet string `json:"wallet"`
+	// Hex encoded unsigned transaction
+	Transaction string `json:"transaction"`
+	// Address owning each input of the transaction, in order
+	InputAddresses []string `json:"input_addresses"`
+}
+
+// SignResponse is the response of POST /api/sign
+type SignResponse struct {
+	// Hex encoded signed transaction
+	Transaction string `json:"transaction"`
+}
+
+// errorResponse is the response body of a failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Signer signs transactions with the keys of its wallets, if they pass the policy
+type Signer struct {
+	log     logrus.FieldLogger
+	token   []byte
+	policy  *Policy
+	store   *Store
+	wallets map[string]*walletcrypt.Keys
+	names   []string
+	// Signing is serialized so that the daily limit can't be exceeded by concurrent requests
+	sync.Mutex
+}
+
+// New creates a Signer. Wallets are named by their filename.
+func New(log logrus.FieldLogger, db *bolt.DB, policy *Policy, wallets []*walletcrypt.Keys, token []byte) (*Signer, error) {
+	if len(wallets) == 0 {
+		return nil, errors.New("No wallets")
+	}
+
+	if len(token) == 0 {
+		return nil, errors.New("Empty auth token")
+	}
+
+	store, err := NewStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Signer{
+		log:     log.WithField("prefix", "signer"),
+		token:   token,
+		policy:  policy,
+		store:   store,
+		wallets: make(map[string]*walletcrypt.Keys, len(wallets)),
+	}
+
+	for _, w := range wallets {
+		name := filepath.Base(w.File())
+		if _, ok := s.wallets[name]; ok {
+			return nil, fmt.Errorf("Duplicate wallet name %s", name)
+		}
+
+		s.wallets[name] = w
+		s.names = append(s.names, name)
+	}
+
+	return s, nil
+}
+
+// Wallets returns the signer's wallets
+func (s *Signer) Wallets() []Wallet {
+	wallets := make([]Wallet, len(s.names))
+	for i, name := range s.names {
+		wallets[i] = Wallet{
+			Name:      name,
+			Addresses: s.wallets[name].Addresses(),
+		}
+	}
+	return wallets
+}
+
+// Sign checks the transaction against the policy and signs it with the keys of walletName.
+// inputAddrs is the address owning each input of txn.
+func (s *Signer) Sign(walletName string, txn *coin.Transaction, inputAddrs []string) (*coin.Transaction, error) {
+	keys, ok := s.wallets[walletName]
+	if !ok {
+		return nil, ErrUnknownWallet
+	}
+
+	if len(txn.Sigs) != 0 {
+		return nil, ErrAlreadySigned
+	}
+
+	if len(txn.In) == 0 || len(inputAddrs) != len(txn.In) {
+		return nil, ErrInputAddressesMismatch
+	}
+
+	walletAddrs := make(map[string]struct{}, len(keys.Addresses()))
+	for _, a := range keys.Addresses() {
+		walletAddrs[a] = struct{}{}
+	}
+
+	for _, a := range inputAddrs {
+		if _, ok := walletAddrs[a]; !ok {
+			return nil, fmt.Errorf("%v: %s", ErrInputNotInWallet, a)
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	amount, err := s.policy.Check(s.store, txn, walletAddrs)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := signTransaction(keys, *txn, inputAddrs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.AddSigned(SignedTx{
+		Txid:     signed.TxIDHex(),
+		Wallet:   walletName,
+		Coins:    amount,
+		SignedAt: time.Now().UTC(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return signed, nil
+}
+
+// signTransaction signs each input of txn with the key of its address. The decrypted keys are erased afterwards.
+func signTransaction(keys *walletcrypt.Keys, txn coin.Transaction, inputAddrs []string) (*coin.Transaction, error) {
+	wlt, err := keys.Wallet()
+	if err != nil {
+		return nil, err
+	}
+	defer walletcrypt.Zero(wlt)
+
+	secKeys := make([]cipher.SecKey, len(inputAddrs))
+	defer func() {
+		for i := range secKeys {
+			secKeys[i] = cipher.SecKey{}
+		}
+	}()
+
+	for i, a := range inputAddrs {
+		addr, err := cipher.DecodeBase58Address(a)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, ok := wlt.GetEntry(addr)
+		if !ok || entry.Secret == (cipher.SecKey{}) {
+			return nil, fmt.Errorf("%v: %s", ErrInputNotInWallet, a)
+		}
+
+		secKeys[i] = entry.Secret
+	}
+
+	txn.SignInputs(secKeys)
+	txn.UpdateHeader()
+
+	if err := txn.Verify(); err != nil {
+		return nil, err
+	}
+
+	return &txn, nil
+}
+
+// Handler returns the signer's HTTP API
+func (s *Signer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/api/wallets", s.authorize(http.HandlerFunc(s.walletsHandler)))
+	mux.Handle("/api/sign", s.authorize(http.HandlerFunc(s.signHandler)))
+	return mux
+}
+
+// authorize requires requests to have the auth token as a bearer token
+func (s *Signer) authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), s.token) != 1 {
+			s.log.WithField("notice", logger.WatchNotice).WithField("path", r.URL.Path).Error("Unauthorized request")
+			writeError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Signer) walletsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, WalletsResponse{
+		Wallets: s.Wallets(),
+	})
+}
+
+func (s *Signer) signHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		return
+	}
+
+	var req SignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid request body: %v", err))
+		return
+	}
+
+	b, err := hex.DecodeString(req.Transaction)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid transaction: %v", err))
+		return
+	}
+
+	txn, err := coin.TransactionDeserialize(b)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	log := s.log.WithFields(logrus.Fields{
+		"wallet":    req.Wallet,
+		"innerHash": txn.HashInner().Hex(),
+	})
+
+	signed, err := s.Sign(req.Wallet, &txn, req.InputAddresses)
+	if err != nil {
+		switch err.(type) {
+		case PolicyError:
+			log.WithField("notice", logger.WatchNotice).WithError(err).Error("Transaction rejected by policy")
+			writeError(w, http.StatusForbidden, err)
+		default:
+			log.WithError(err).Error("Sign failed")
+			writeError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	log.WithField("txid", signed.TxIDHex()).Info("Signed transaction")
+
+	writeJSON(w, http.StatusOK, SignResponse{
+		Transaction: hex.EncodeToString(signed.Serialize()),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(obj) // nolint: errcheck
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{
+		Error: err.Error(),
+	})
+}
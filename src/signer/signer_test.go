@@ -0,0 +1,287 @@
+package signer
+
+import (
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/wallet"
+
+	"github.com/skycoin/teller/src/util/testutil"
+	"github.com/skycoin/teller/src/util/walletcrypt"
+)
+
+const testToken = "test-token"
+
+type testSigner struct {
+	signer    *Signer
+	dir       string
+	addrs     []string
+	coldAddr  string
+	boundAddr string
+}
+
+func testAddress() string {
+	pk, _ := cipher.GenerateKeyPair()
+	return cipher.AddressFromPubKey(pk).String()
+}
+
+func setupSigner(t *testing.T) (*testSigner, func()) {
+	db, shutdownDB := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+
+	dir, err := ioutil.TempDir("", "teller-signer")
+	require.NoError(t, err)
+
+	wlt, err := wallet.NewWallet("hot.wlt", wallet.Options{
+		Seed: "signer test seed",
+	})
+	require.NoError(t, err)
+
+	_, err = wlt.GenerateAddresses(3)
+	require.NoError(t, err)
+
+	ew, err := walletcrypt.Encrypt(wlt, []byte("password"), 1)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "hot.wlt")
+	require.NoError(t, ew.Save(path))
+
+	keys, err := walletcrypt.OpenKeys(path, []byte("password"), false)
+	require.NoError(t, err)
+
+	ts := &testSigner{
+		dir:       dir,
+		addrs:     keys.Addresses(),
+		coldAddr:  testAddress(),
+		boundAddr: testAddress(),
+	}
+
+	policy := &Policy{
+		MaxSend:          100e6,
+		DailyLimit:       150e6,
+		AllowedAddresses: []string{ts.coldAddr},
+		BoundAddresses: func() ([]string, error) {
+			return []string{ts.boundAddr}, nil
+		},
+	}
+
+	ts.signer, err = New(log, db, policy, []*walletcrypt.Keys{keys}, []byte(testToken))
+	require.NoError(t, err)
+
+	return ts, func() {
+		shutdownDB()
+		os.RemoveAll(dir)
+	}
+}
+
+// newUnsignedTx creates an unsigned transaction spending one input of each address in inputAddrs
+func newUnsignedTx(inputAddrs []string, outs ...coin.TransactionOutput) *coin.Transaction {
+	txn := &coin.Transaction{}
+	for i, a := range inputAddrs {
+		txn.PushInput(cipher.SumSHA256([]byte(a + string(rune(i)))))
+	}
+
+	for _, o := range outs {
+		txn.PushOutput(o.Address, o.Coins, o.Hours)
+	}
+
+	txn.UpdateHeader()
+	return txn
+}
+
+func output(addr string, coins uint64) coin.TransactionOutput {
+	return coin.TransactionOutput{
+		Address: cipher.MustDecodeBase58Address(addr),
+		Coins:   coins,
+		Hours:   1,
+	}
+}
+
+func TestSignerSign(t *testing.T) {
+	ts, shutdown := setupSigner(t)
+	defer shutdown()
+
+	require.Equal(t, []Wallet{{
+		Name:      "hot.wlt",
+		Addresses: ts.addrs,
+	}}, ts.signer.Wallets())
+
+	inputAddrs := []string{ts.addrs[0], ts.addrs[1]}
+	txn := newUnsignedTx(inputAddrs, output(ts.boundAddr, 50e6), output(ts.addrs[2], 500e6))
+
+	signed, err := ts.signer.Sign("hot.wlt", txn, inputAddrs)
+	require.NoError(t, err)
+	require.NoError(t, signed.Verify())
+	require.Equal(t, txn.HashInner(), signed.HashInner())
+	require.Empty(t, txn.Sigs)
+
+	// Each input is signed by the key of its address
+	require.Len(t, signed.Sigs, 2)
+	for i, in := range signed.In {
+		addr := cipher.MustDecodeBase58Address(inputAddrs[i])
+		require.NoError(t, cipher.ChkSig(addr, cipher.AddSHA256(signed.HashInner(), in), signed.Sigs[i]))
+	}
+
+	// Change is not counted against the limits
+	sent, err := ts.signer.store.GetSentSince(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, uint64(50e6), sent)
+
+	// Sweeps to the cold address are allowed
+	_, err = ts.signer.Sign("hot.wlt", newUnsignedTx(inputAddrs[:1], output(ts.coldAddr, 60e6)), inputAddrs[:1])
+	require.NoError(t, err)
+}
+
+func TestSignerSignRejected(t *testing.T) {
+	ts, shutdown := setupSigner(t)
+	defer shutdown()
+
+	inputAddrs := []string{ts.addrs[0]}
+
+	cases := []struct {
+		name       string
+		wallet     string
+		txn        *coin.Transaction
+		inputAddrs []string
+		err        string
+	}{
+		{
+			name:       "unknown wallet",
+			wallet:     "other.wlt",
+			txn:        newUnsignedTx(inputAddrs, output(ts.boundAddr, 1e6)),
+			inputAddrs: inputAddrs,
+			err:        ErrUnknownWallet.Error(),
+		},
+		{
+			name:       "destination not allowed",
+			wallet:     "hot.wlt",
+			txn:        newUnsignedTx(inputAddrs, output(ts.boundAddr, 1e6), output(testAddress(), 1e6)),
+			inputAddrs: inputAddrs,
+			err:        "is not allowed",
+		},
+		{
+			name:       "max send exceeded",
+			wallet:     "hot.wlt",
+			txn:        newUnsignedTx(inputAddrs, output(ts.boundAddr, 60e6), output(ts.coldAddr, 60e6)),
+			inputAddrs: inputAddrs,
+			err:        "exceeds max_send of 100.000000 SKY",
+		},
+		{
+			name:       "output coins overflow",
+			wallet:     "hot.wlt",
+			txn:        newUnsignedTx(inputAddrs, output(ts.boundAddr, math.MaxUint64), output(ts.coldAddr, 1)),
+			inputAddrs: inputAddrs,
+			err:        "Output coins overflow",
+		},
+		{
+			name:       "max send exceeded by an amount too large to format",
+			wallet:     "hot.wlt",
+			txn:        newUnsignedTx(inputAddrs, output(ts.boundAddr, math.MaxInt64+1)),
+			inputAddrs: inputAddrs,
+			err:        "Invalid amount 9223372036854775808",
+		},
+		{
+			name:       "input not in wallet",
+			wallet:     "hot.wlt",
+			txn:        newUnsignedTx([]string{testAddress()}, output(ts.boundAddr, 1e6)),
+			inputAddrs: []string{testAddress()},
+			err:        ErrInputNotInWallet.Error(),
+		},
+		{
+			name:       "input addresses mismatch",
+			wallet:     "hot.wlt",
+			txn:        newUnsignedTx([]string{ts.addrs[0], ts.addrs[1]}, output(ts.boundAddr, 1e6)),
+			inputAddrs: inputAddrs,
+			err:        ErrInputAddressesMismatch.Error(),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ts.signer.Sign(tc.wallet, tc.txn, tc.inputAddrs)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+
+	// Already signed transactions are rejected
+	signed, err := ts.signer.Sign("hot.wlt", newUnsignedTx(inputAddrs, output(ts.boundAddr, 100e6)), inputAddrs)
+	require.NoError(t, err)
+	_, err = ts.signer.Sign("hot.wlt", signed, inputAddrs)
+	require.Equal(t, ErrAlreadySigned, err)
+
+	// The daily limit includes transactions signed in the last 24 hours
+	_, err = ts.signer.Sign("hot.wlt", newUnsignedTx(inputAddrs, output(ts.boundAddr, 60e6)), inputAddrs)
+	require.Error(t, err)
+	require.IsType(t, PolicyError{}, err)
+	require.Contains(t, err.Error(), "exceeds daily_limit of 150.000000 SKY, 100.000000 SKY sent in the last 24 hours")
+
+	_, err = ts.signer.Sign("hot.wlt", newUnsignedTx(inputAddrs, output(ts.boundAddr, 50e6)), inputAddrs)
+	require.NoError(t, err)
+
+	require.NoError(t, ts.signer.store.AddSigned(SignedTx{
+		Txid:     "old",
+		Coins:    1000e6,
+		SignedAt: time.Now().Add(-25 * time.Hour),
+	}))
+	sent, err := ts.signer.store.GetSentSince(time.Now().Add(-dailyLimitPeriod))
+	require.NoError(t, err)
+	require.Equal(t, uint64(150e6), sent)
+}
+
+func TestSignerClient(t *testing.T) {
+	ts, shutdown := setupSigner(t)
+	defer shutdown()
+
+	socket := filepath.Join(ts.dir, "signer.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	srv := &http.Server{
+		Handler: ts.signer.Handler(),
+	}
+	go srv.Serve(ln) // nolint: errcheck
+	defer srv.Close()
+
+	tokenFile := filepath.Join(ts.dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte(testToken+"\n"), 0600))
+
+	c, err := NewClient(socket, tokenFile, time.Second*5)
+	require.NoError(t, err)
+
+	wallets, err := c.Wallets()
+	require.NoError(t, err)
+	require.Equal(t, ts.signer.Wallets(), wallets)
+
+	inputAddrs := []string{ts.addrs[0]}
+	txn := newUnsignedTx(inputAddrs, output(ts.boundAddr, 10e6))
+
+	signed, err := c.Sign("hot.wlt", txn, inputAddrs)
+	require.NoError(t, err)
+	require.Len(t, signed.Sigs, 1)
+	require.Equal(t, txn.HashInner(), signed.HashInner())
+
+	_, err = c.Sign("hot.wlt", newUnsignedTx(inputAddrs, output(testAddress(), 10e6)), inputAddrs)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "403 Forbidden")
+	require.Contains(t, err.Error(), "is not allowed")
+
+	// Requests with the wrong token are rejected
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("wrong-token"), 0600))
+	c, err = NewClient(socket, tokenFile, time.Second*5)
+	require.NoError(t, err)
+
+	_, err = c.Wallets()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401 Unauthorized")
+}
@@ -0,0 +1,77 @@
+package signer
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/skycoin/src/coin"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+// SignedTxBkt maps a txid to the SignedTx record of a transaction the signer signed
+var SignedTxBkt = []byte("signed_txs")
+
+// SignedTx records a signed transaction
+type SignedTx struct {
+	Txid     string    `json:"txid"`
+	Wallet   string    `json:"wallet"`
+	Coins    uint64    `json:"coins"` // Droplets sent to addresses outside the wallet
+	SignedAt time.Time `json:"signed_at"`
+}
+
+// Store records the transactions the signer signed
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore creates a Store
+func NewStore(db *bolt.DB) (*Store, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(SignedTxBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(SignedTxBkt, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db: db,
+	}, nil
+}
+
+// AddSigned records a signed transaction
+func (s *Store) AddSigned(stx SignedTx) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, SignedTxBkt, stx.Txid, stx)
+	})
+}
+
+// GetSentSince returns the droplets sent by transactions signed after t
+func (s *Store) GetSentSince(t time.Time) (uint64, error) {
+	var sent uint64
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, SignedTxBkt, func(k, v []byte) error {
+			var stx SignedTx
+			if err := json.Unmarshal(v, &stx); err != nil {
+				return err
+			}
+
+			if !stx.SignedAt.After(t) {
+				return nil
+			}
+
+			var err error
+			sent, err = coin.AddUint64(sent, stx.Coins)
+			return err
+		})
+	}); err != nil {
+		return 0, err
+	}
+
+	return sent, nil
+}
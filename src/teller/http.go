@@ -20,12 +20,13 @@ import (
 	"github.com/unrolled/secure"
 	"golang.org/x/crypto/acme/autocert"
 
-	"github.com/skycoin/skycoin/src/cipher"
 	"github.com/skycoin/skycoin/src/util/droplet"
 
 	"github.com/skycoin/teller/src/addrs"
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/fiber"
+	"github.com/skycoin/teller/src/screening"
 	"github.com/skycoin/teller/src/sender"
 	"github.com/skycoin/teller/src/util/httputil"
 	"github.com/skycoin/teller/src/util/logger"
@@ -52,6 +53,8 @@ var (
 // HTTPServer exposes the API endpoints and static website
 type HTTPServer struct {
 	cfg           config.Config
+	cfgLock       sync.RWMutex  // Guards the settings of cfg that can be changed by reloading the config
+	apiHandlers   []*apiHandler // Applies the throttling and CORS settings to the API endpoints
 	exchanger     exchange.Exchanger
 	log           logrus.FieldLogger
 	service       *Service
@@ -78,7 +81,7 @@ func NewHTTPServer(log logrus.FieldLogger, cfg config.Config, service *Service,
 // Run runs the HTTPServer
 func (s *HTTPServer) Run() error {
 	log := s.log
-	log.WithField("config", s.cfg).Info("HTTP service start")
+	log.WithField("config", s.config()).Info("HTTP service start")
 	defer log.Info("HTTP service closed")
 	defer close(s.done)
 
@@ -262,29 +265,20 @@ func setupHTTPListener(addr string, handler http.Handler) *http.Server {
 func (s *HTTPServer) setupMux() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	ratelimit := func(h http.Handler) http.Handler {
-		limiter := tollbooth.NewLimiter(s.cfg.Web.ThrottleMax, s.cfg.Web.ThrottleDuration, nil)
-		if s.cfg.Web.BehindProxy {
-			limiter.SetIPLookups([]string{"X-Forwarded-For", "RemoteAddr", "X-Real-IP"})
-		}
-		return tollbooth.LimitHandler(limiter, h)
-	}
-
-	handleAPI := func(path string, h http.Handler) {
-		h = cors.New(cors.Options{
-			AllowedOrigins: s.cfg.Web.CORSAllowed,
-		}).Handler(h)
-
-		h = gziphandler.GzipHandler(h)
+	handleAPI := func(path string, h http.Handler, throttled bool) {
+		s.cfgLock.Lock()
+		ah := newAPIHandler(h, throttled, s.cfg.Web)
+		s.apiHandlers = append(s.apiHandlers, ah)
+		s.cfgLock.Unlock()
 
-		mux.Handle(path, h)
+		mux.Handle(path, gziphandler.GzipHandler(ah))
 	}
 
 	// API Methods
-	handleAPI("/api/bind", ratelimit(httputil.LogHandler(s.log, BindHandler(s))))
-	handleAPI("/api/status", ratelimit(httputil.LogHandler(s.log, StatusHandler(s))))
-	handleAPI("/api/config", httputil.LogHandler(s.log, ConfigHandler(s)))
-	handleAPI("/api/health", httputil.LogHandler(s.log, HealthHandler(s)))
+	handleAPI("/api/bind", httputil.LogHandler(s.log, BindHandler(s)), true)
+	handleAPI("/api/status", httputil.LogHandler(s.log, StatusHandler(s)), true)
+	handleAPI("/api/config", httputil.LogHandler(s.log, ConfigHandler(s)), false)
+	handleAPI("/api/health", httputil.LogHandler(s.log, HealthHandler(s)), false)
 
 	// Static files
 	mux.Handle("/", gziphandler.GzipHandler(http.FileServer(http.Dir(s.cfg.Web.StaticDir))))
@@ -292,6 +286,79 @@ func (s *HTTPServer) setupMux() *http.ServeMux {
 	return mux
 }
 
+// config returns the config. Use it to read the settings that can be changed by reloading the config.
+func (s *HTTPServer) config() config.Config {
+	s.cfgLock.RLock()
+	defer s.cfgLock.RUnlock()
+	return s.cfg
+}
+
+// applyConfig applies the binding, exchange rate, throttling and CORS settings of a reloaded config.
+// The throttling of the API endpoints restarts.
+func (s *HTTPServer) applyConfig(cfg config.Config) {
+	s.cfgLock.Lock()
+	defer s.cfgLock.Unlock()
+
+	s.cfg.Teller.BindEnabled = cfg.Teller.BindEnabled
+	s.cfg.SkyExchanger.SkyBtcExchangeRate = cfg.SkyExchanger.SkyBtcExchangeRate
+	s.cfg.SkyExchanger.SkyEthExchangeRate = cfg.SkyExchanger.SkyEthExchangeRate
+	s.cfg.SkyExchanger.SkySkyExchangeRate = cfg.SkyExchanger.SkySkyExchangeRate
+	s.cfg.Web.ThrottleMax = cfg.Web.ThrottleMax
+	s.cfg.Web.ThrottleDuration = cfg.Web.ThrottleDuration
+	s.cfg.Web.CORSAllowed = cfg.Web.CORSAllowed
+
+	for _, ah := range s.apiHandlers {
+		ah.setWeb(s.cfg.Web)
+	}
+}
+
+// apiHandler wraps an API endpoint with the throttling and CORS middleware,
+// which is rebuilt when the config is reloaded
+type apiHandler struct {
+	sync.RWMutex
+	next      http.Handler
+	throttled bool
+	handler   http.Handler
+}
+
+func newAPIHandler(next http.Handler, throttled bool, web config.Web) *apiHandler {
+	ah := &apiHandler{
+		next:      next,
+		throttled: throttled,
+	}
+	ah.setWeb(web)
+	return ah
+}
+
+// setWeb rebuilds the middleware with the throttling and CORS settings of web
+func (ah *apiHandler) setWeb(web config.Web) {
+	h := ah.next
+
+	if ah.throttled {
+		limiter := tollbooth.NewLimiter(web.ThrottleMax, web.ThrottleDuration, nil)
+		if web.BehindProxy {
+			limiter.SetIPLookups([]string{"X-Forwarded-For", "RemoteAddr", "X-Real-IP"})
+		}
+		h = tollbooth.LimitHandler(limiter, h)
+	}
+
+	h = cors.New(cors.Options{
+		AllowedOrigins: web.CORSAllowed,
+	}).Handler(h)
+
+	ah.Lock()
+	defer ah.Unlock()
+	ah.handler = h
+}
+
+func (ah *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ah.RLock()
+	h := ah.handler
+	ah.RUnlock()
+
+	h.ServeHTTP(w, r)
+}
+
 // Shutdown stops the HTTPServer
 func (s *HTTPServer) Shutdown() {
 	s.log.Info("Shutting down HTTP server(s)")
@@ -339,6 +406,7 @@ type BindResponse struct {
 type bindRequest struct {
 	SkyAddr  string `json:"skyaddr"`
 	CoinType string `json:"coin_type"`
+	Amount   string `json:"amount"`
 }
 
 // BindHandler binds skycoin address with a bitcoin address
@@ -346,7 +414,8 @@ type bindRequest struct {
 // Accept: application/json
 // URI: /api/bind
 // Args:
-//    {"skyaddr": "...", "coin_type": "BTC"}
+//    {"skyaddr": "...", "coin_type": "BTC", "amount": "0.01"}
+//    amount is optional, the amount of coin_type the buyer expects to deposit
 func BindHandler(s *HTTPServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -411,19 +480,30 @@ func BindHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
+		var expectedValue int64
+		if bindReq.Amount != "" {
+			var err error
+			expectedValue, err = exchange.ParseDepositValue(bindReq.CoinType, bindReq.Amount)
+			if err != nil {
+				errorResponse(ctx, w, http.StatusBadRequest, fmt.Errorf("Invalid amount: %v", err))
+				return
+			}
+		}
+
 		log.Info()
 
-		if !verifySkycoinAddress(ctx, w, bindReq.SkyAddr) {
+		if !verifySkycoinAddress(ctx, w, s.cfg.Coin, bindReq.SkyAddr) {
 			return
 		}
 
 		log.Info("Calling service.BindAddress")
 
-		boundAddr, err := s.service.BindAddress(bindReq.SkyAddr, bindReq.CoinType)
+		boundAddr, err := s.service.BindAddress(bindReq.SkyAddr, bindReq.CoinType, expectedValue)
 		if err != nil {
 			log.WithError(err).Error("service.BindAddress failed")
 			switch err {
-			case ErrBindDisabled:
+			case ErrBindDisabled, screening.ErrAddressDenied, exchange.ErrSaleCapReached,
+				exchange.ErrSkyAddressLimitReached, exchange.ErrCoinDailyLimitReached, exchange.ErrBindingPaused, exchange.ErrBindPausedByOperator:
 				errorResponse(ctx, w, http.StatusForbidden, err)
 			default:
 				switch err {
@@ -483,7 +563,7 @@ func StatusHandler(s *HTTPServer) http.HandlerFunc {
 
 		log.Info()
 
-		if !verifySkycoinAddress(ctx, w, skyAddr) {
+		if !verifySkycoinAddress(ctx, w, s.cfg.Coin, skyAddr) {
 			return
 		}
 
@@ -513,17 +593,22 @@ func StatusHandler(s *HTTPServer) http.HandlerFunc {
 // ConfigResponse http response for /api/config
 type ConfigResponse struct {
 	Enabled           bool                     `json:"enabled"`
+	Coin              fiber.Coin               `json:"coin"`
 	BuyMethod         string                   `json:"buy_method"`
 	MaxBoundAddresses int                      `json:"max_bound_addrs"`
 	MaxDecimals       int                      `json:"max_decimals"`
 	Deposits          map[string]depositConfig `json:"deposits"`
+	SaleCap           exchange.SaleCap         `json:"sale_cap"`
+	HotWallet         exchange.HotWalletStatus `json:"hot_wallet"`
+	Paused            exchange.PauseStatus     `json:"paused"`
 }
 
 type depositConfig struct {
-	Enabled                  bool   `json:"enabled"`
-	ConfirmationsRequired    int64  `json:"confirmations_required"`
-	ExchangeRate             string `json:"fixed_exchange_rate"`
-	PassthroughMinimumVolume string `json:"passthrough_minimum_volume"`
+	Enabled                  bool       `json:"enabled"`
+	ConfirmationsRequired    int64      `json:"confirmations_required"`
+	ExchangeRate             string     `json:"fixed_exchange_rate"`
+	PassthroughMinimumVolume string     `json:"passthrough_minimum_volume"`
+	Fee                      config.Fee `json:"fee"`
 }
 
 // ConfigHandler returns the teller configuration
@@ -538,9 +623,11 @@ func ConfigHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
+		cfg := s.config()
+
 		// Convert the exchange rate to a skycoin balance string
-		rate := s.cfg.SkyExchanger.SkyBtcExchangeRate
-		maxDecimals := s.cfg.SkyExchanger.MaxDecimals
+		rate := cfg.SkyExchanger.SkyBtcExchangeRate
+		maxDecimals := cfg.SkyExchanger.MaxDecimals
 		dropletsPerBTC, err := exchange.CalculateBtcSkyValue(exchange.SatoshisPerBTC, rate, maxDecimals)
 		if err != nil {
 			log.WithError(err).Error("exchange.CalculateBtcSkyValue failed")
@@ -554,7 +641,7 @@ func ConfigHandler(s *HTTPServer) http.HandlerFunc {
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
-		rate = s.cfg.SkyExchanger.SkyEthExchangeRate
+		rate = cfg.SkyExchanger.SkyEthExchangeRate
 		dropletsPerETH, err := exchange.CalculateEthSkyValue(big.NewInt(exchange.WeiPerETH), rate, maxDecimals)
 		if err != nil {
 			log.WithError(err).Error("exchange.CalculateEthSkyValue failed")
@@ -568,31 +655,52 @@ func ConfigHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
+		// Binding is disabled once the sale cap is reached
+		saleCap, err := s.exchanger.SaleCap()
+		if err != nil {
+			log.WithError(err).Error("exchanger.SaleCap failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		// Binding is paused while the hot wallet can't cover its obligations
+		hotWallet := s.exchanger.HotWalletStatus()
+
+		// Binding may be paused by an operator
+		paused := s.exchanger.PauseStatus()
+
 		if err := httputil.JSONResponse(w, ConfigResponse{
-			Enabled:           s.cfg.Teller.BindEnabled,
-			BuyMethod:         s.cfg.SkyExchanger.BuyMethod,
+			Enabled:           cfg.Teller.BindEnabled && !saleCap.Reached && !hotWallet.Tripped && !paused.Bind,
+			Coin:              cfg.Coin,
+			BuyMethod:         cfg.SkyExchanger.BuyMethod,
 			MaxDecimals:       maxDecimals,
-			MaxBoundAddresses: s.cfg.Teller.MaxBoundAddresses,
+			MaxBoundAddresses: cfg.Teller.MaxBoundAddresses,
 			Deposits: map[string]depositConfig{
 				"btc": {
-					Enabled:                  s.cfg.BtcScanner.Enabled,
-					ConfirmationsRequired:    s.cfg.BtcScanner.ConfirmationsRequired,
+					Enabled:                  cfg.BtcScanner.Enabled,
+					ConfirmationsRequired:    cfg.BtcScanner.ConfirmationsRequired,
 					ExchangeRate:             skyPerBTC,
-					PassthroughMinimumVolume: s.cfg.SkyExchanger.C2CX.BtcMinimumVolume.String(),
+					PassthroughMinimumVolume: cfg.SkyExchanger.C2CX.BtcMinimumVolume.String(),
+					Fee:                      cfg.SkyExchanger.Fees.BTC,
 				},
 				"eth": {
-					Enabled:                  s.cfg.EthScanner.Enabled,
-					ConfirmationsRequired:    s.cfg.EthScanner.ConfirmationsRequired,
+					Enabled:                  cfg.EthScanner.Enabled,
+					ConfirmationsRequired:    cfg.EthScanner.ConfirmationsRequired,
 					ExchangeRate:             skyPerETH,
 					PassthroughMinimumVolume: "0",
+					Fee:                      cfg.SkyExchanger.Fees.ETH,
 				},
 				"sky": {
-					Enabled:                  s.cfg.SkyScanner.Enabled,
-					ConfirmationsRequired:    s.cfg.SkyScanner.ConfirmationsRequired,
-					ExchangeRate:             s.cfg.SkyExchanger.SkySkyExchangeRate,
+					Enabled:                  cfg.SkyScanner.Enabled,
+					ConfirmationsRequired:    cfg.SkyScanner.ConfirmationsRequired,
+					ExchangeRate:             cfg.SkyExchanger.SkySkyExchangeRate,
 					PassthroughMinimumVolume: "0",
+					Fee:                      cfg.SkyExchanger.Fees.SKY,
 				},
 			},
+			SaleCap:   *saleCap,
+			HotWallet: hotWallet,
+			Paused:    paused,
 		}); err != nil {
 			log.WithError(err).Error()
 		}
@@ -606,6 +714,8 @@ type ExchangeStatusResponse struct {
 	SenderError       string                        `json:"sender_error"`
 	Balance           ExchangeStatusResponseBalance `json:"balance"`
 	DepositErrorCount int                           `json:"deposit_error_count"`
+	HotWallet         exchange.HotWalletStatus      `json:"hot_wallet"`
+	Paused            exchange.PauseStatus          `json:"paused"`
 }
 
 // ExchangeStatusResponseBalance is the balance field of ExchangeStatusResponse
@@ -661,6 +771,8 @@ func (s *HTTPServer) newExchangeStatusResponse(log logrus.FieldLogger) ExchangeS
 			Coins: coins,
 			Hours: hours,
 		},
+		HotWallet: s.exchanger.HotWalletStatus(),
+		Paused:    s.exchanger.PauseStatus(),
 	}
 }
 
@@ -716,11 +828,11 @@ func validMethod(ctx context.Context, w http.ResponseWriter, r *http.Request, al
 	return false
 }
 
-func verifySkycoinAddress(ctx context.Context, w http.ResponseWriter, skyAddr string) bool {
+func verifySkycoinAddress(ctx context.Context, w http.ResponseWriter, fiberCoin fiber.Coin, skyAddr string) bool {
 	log := logger.FromContext(ctx)
 
-	if _, err := cipher.DecodeBase58Address(skyAddr); err != nil {
-		msg := fmt.Sprintf("Invalid skycoin address: %v", err)
+	if _, err := fiberCoin.DecodeAddress(skyAddr); err != nil {
+		msg := fmt.Sprintf("Invalid %s address: %v", fiberCoin.Name, err)
 		httputil.ErrResponse(w, http.StatusBadRequest, msg)
 		log.WithFields(logrus.Fields{
 			"status":  http.StatusBadRequest,
@@ -14,7 +14,9 @@ import (
 
 	"github.com/skycoin/skycoin/src/api/cli"
 
+	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/fiber"
 	"github.com/skycoin/teller/src/sender"
 	"github.com/skycoin/teller/src/util/testutil"
 )
@@ -23,8 +25,8 @@ type fakeExchanger struct {
 	mock.Mock
 }
 
-func (e *fakeExchanger) BindAddress(skyAddr, depositAddr, coinType string) (*exchange.BoundAddress, error) {
-	args := e.Called(skyAddr, depositAddr, coinType)
+func (e *fakeExchanger) BindAddress(skyAddr, depositAddr, coinType string, expectedValue int64) (*exchange.BoundAddress, error) {
+	args := e.Called(skyAddr, depositAddr, coinType, expectedValue)
 
 	ba := args.Get(0)
 	if ba == nil {
@@ -44,6 +46,11 @@ func (e *fakeExchanger) GetDeposits(flt exchange.DepositFilter) ([]exchange.Depo
 	return args.Get(0).([]exchange.DepositInfo), args.Error(1)
 }
 
+func (e *fakeExchanger) QueryDeposits(q exchange.DepositQuery) ([]exchange.DepositInfo, error) {
+	args := e.Called(q)
+	return args.Get(0).([]exchange.DepositInfo), args.Error(1)
+}
+
 func (e *fakeExchanger) GetBindNum(skyAddr string) (int, error) {
 	args := e.Called(skyAddr)
 	return args.Int(0), args.Error(1)
@@ -69,6 +76,37 @@ func (e *fakeExchanger) ErroredDeposits() ([]exchange.DepositInfo, error) {
 	return args.Get(0).([]exchange.DepositInfo), args.Error(1)
 }
 
+func (e *fakeExchanger) GetDepositHistory(depositID string) ([]exchange.DepositTransition, error) {
+	args := e.Called(depositID)
+	return args.Get(0).([]exchange.DepositTransition), args.Error(1)
+}
+
+func (e *fakeExchanger) CheckBindLimits(skyAddr, coinType string) error {
+	args := e.Called(skyAddr, coinType)
+	return args.Error(0)
+}
+
+func (e *fakeExchanger) SaleCap() (*exchange.SaleCap, error) {
+	args := e.Called()
+
+	sc := args.Get(0)
+	if sc == nil {
+		return nil, args.Error(1)
+	}
+
+	return sc.(*exchange.SaleCap), args.Error(1)
+}
+
+func (e *fakeExchanger) HotWalletStatus() exchange.HotWalletStatus {
+	args := e.Called()
+	return args.Get(0).(exchange.HotWalletStatus)
+}
+
+func (e *fakeExchanger) PauseStatus() exchange.PauseStatus {
+	args := e.Called()
+	return args.Get(0).(exchange.PauseStatus)
+}
+
 func (e *fakeExchanger) Balance() (*cli.Balance, error) {
 	args := e.Called()
 
@@ -177,6 +215,8 @@ func TestHealthHandler(t *testing.T) {
 			e.On("SenderStatus").Return(tc.senderStatus)
 			e.On("ProcessorStatus").Return(tc.processorStatus)
 			e.On("ErroredDeposits").Return(tc.erroredDeposits, tc.erroredDepositsErr)
+			e.On("HotWalletStatus").Return(exchange.HotWalletStatus{})
+			e.On("PauseStatus").Return(exchange.PauseStatus{})
 
 			if tc.balanceError == nil {
 				e.On("Balance").Return(&tc.balance, nil)
@@ -235,3 +275,197 @@ func TestHealthHandler(t *testing.T) {
 	}
 
 }
+
+func TestConfigHandlerBindPaused(t *testing.T) {
+	tt := []struct {
+		name      string
+		saleCap   exchange.SaleCap
+		hotWallet exchange.HotWalletStatus
+		paused    exchange.PauseStatus
+		enabled   bool
+	}{
+		{
+			name:    "no sale cap",
+			enabled: true,
+		},
+		{
+			name: "sale cap not reached",
+			saleCap: exchange.SaleCap{
+				Enabled: true,
+				Cap:     "1000",
+				Sold:    "999.000000",
+			},
+			enabled: true,
+		},
+		{
+			name: "sale cap reached",
+			saleCap: exchange.SaleCap{
+				Enabled: true,
+				Cap:     "1000",
+				Sold:    "1000.000000",
+				Reached: true,
+			},
+			enabled: false,
+		},
+		{
+			name: "hot wallet above reserve",
+			hotWallet: exchange.HotWalletStatus{
+				Enabled:     true,
+				Balance:     "1000.000000",
+				Obligations: "500.000000",
+				Reserve:     "200",
+				CheckedAt:   1501137828,
+			},
+			enabled: true,
+		},
+		{
+			name: "hot wallet circuit breaker tripped",
+			hotWallet: exchange.HotWalletStatus{
+				Enabled:     true,
+				Balance:     "600.000000",
+				Obligations: "500.000000",
+				Reserve:     "200",
+				Tripped:     true,
+				CheckedAt:   1501137828,
+			},
+			enabled: false,
+		},
+		{
+			name: "binding paused by an operator",
+			paused: exchange.PauseStatus{
+				Bind: true,
+				Process: map[string]bool{
+					config.CoinTypeBTC: false,
+					config.CoinTypeETH: true,
+					config.CoinTypeSKY: false,
+				},
+			},
+			enabled: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &fakeExchanger{}
+			e.On("SaleCap").Return(&tc.saleCap, nil)
+			e.On("HotWalletStatus").Return(tc.hotWallet)
+			e.On("PauseStatus").Return(tc.paused)
+
+			req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+			require.NoError(t, err)
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				log:       log,
+				exchanger: e,
+			}
+			httpServ.cfg.Teller.BindEnabled = true
+			httpServ.cfg.SkyExchanger.SkyBtcExchangeRate = "500"
+			httpServ.cfg.SkyExchanger.SkyEthExchangeRate = "2500"
+			httpServ.cfg.SkyExchanger.MaxDecimals = 3
+			httpServ.cfg.SkyExchanger.Fees.BTC = config.Fee{
+				Percent: "1.5",
+				Minimum: "1",
+			}
+			httpServ.cfg.Coin = fiber.Coin{
+				Name:                "MDL",
+				MaxDropletPrecision: 3,
+			}
+
+			httpServ.setupMux().ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var msg ConfigResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &msg)
+			require.NoError(t, err)
+			require.Equal(t, tc.enabled, msg.Enabled)
+			require.Equal(t, tc.saleCap, msg.SaleCap)
+			require.Equal(t, tc.hotWallet, msg.HotWallet)
+			require.Equal(t, tc.paused, msg.Paused)
+			require.Equal(t, httpServ.cfg.Coin, msg.Coin)
+			require.Equal(t, httpServ.cfg.SkyExchanger.Fees.BTC, msg.Deposits["btc"].Fee)
+		})
+	}
+}
+
+func TestHTTPServerApplyConfig(t *testing.T) {
+	e := &fakeExchanger{}
+	e.On("SaleCap").Return(&exchange.SaleCap{}, nil)
+	e.On("HotWalletStatus").Return(exchange.HotWalletStatus{})
+	e.On("PauseStatus").Return(exchange.PauseStatus{})
+
+	log, _ := testutil.NewLogger(t)
+
+	httpServ := &HTTPServer{
+		log:       log,
+		exchanger: e,
+		service:   &Service{},
+	}
+	httpServ.cfg.Teller.BindEnabled = true
+	httpServ.cfg.SkyExchanger.SkyBtcExchangeRate = "500"
+	httpServ.cfg.SkyExchanger.SkyEthExchangeRate = "2500"
+	httpServ.cfg.SkyExchanger.MaxDecimals = 3
+	httpServ.cfg.Web.ThrottleMax = 600
+	httpServ.cfg.Web.ThrottleDuration = time.Minute
+	httpServ.cfg.Web.CORSAllowed = []string{"https://example.org"}
+
+	mux := httpServ.setupMux()
+
+	getConfig := func() (ConfigResponse, http.Header) {
+		req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "https://example.com")
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var msg ConfigResponse
+		err = json.Unmarshal(rr.Body.Bytes(), &msg)
+		require.NoError(t, err)
+		return msg, rr.Header()
+	}
+
+	getStatus := func() int {
+		req, err := http.NewRequest(http.MethodGet, "/api/status", nil)
+		require.NoError(t, err)
+		req.RemoteAddr = "127.0.0.1:12345"
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	msg, header := getConfig()
+	require.True(t, msg.Enabled)
+	require.Equal(t, "500.000000", msg.Deposits["btc"].ExchangeRate)
+	require.Empty(t, header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, http.StatusBadRequest, getStatus())
+	require.Equal(t, http.StatusBadRequest, getStatus())
+
+	cfg := httpServ.cfg
+	cfg.Teller.BindEnabled = false
+	cfg.SkyExchanger.SkyBtcExchangeRate = "1000"
+	cfg.SkyExchanger.MaxDecimals = 2
+	cfg.Web.ThrottleMax = 1
+	cfg.Web.CORSAllowed = []string{"https://example.com"}
+	httpServ.service.applyConfig(cfg.Teller)
+	httpServ.applyConfig(cfg)
+
+	msg, header = getConfig()
+	require.False(t, msg.Enabled)
+	require.Equal(t, "1000.000000", msg.Deposits["btc"].ExchangeRate)
+	require.Equal(t, "https://example.com", header.Get("Access-Control-Allow-Origin"))
+
+	// Settings that need a restart are not applied
+	require.Equal(t, 3, msg.MaxDecimals)
+
+	// The new throttling applies
+	require.Equal(t, http.StatusBadRequest, getStatus())
+	require.Equal(t, http.StatusTooManyRequests, getStatus())
+
+	_, err := httpServ.service.BindAddress("2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm", config.CoinTypeBTC, 0)
+	require.Equal(t, ErrBindDisabled, err)
+}
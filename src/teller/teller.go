@@ -2,12 +2,14 @@ package teller
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/skycoin/teller/src/addrs"
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/util/logger"
 )
 
 var (
@@ -27,7 +29,7 @@ type Teller struct {
 }
 
 // New creates a Teller
-func New(log logrus.FieldLogger, exchanger exchange.Exchanger, addrManager *addrs.AddrManager, cfg config.Config) *Teller {
+func New(log logrus.FieldLogger, exchanger exchange.Exchanger, addrManager *addrs.AddrManager, screener exchange.AddressScreener, cfg config.Config) *Teller {
 	return &Teller{
 		cfg:  cfg.Teller,
 		log:  log.WithField("prefix", "teller"),
@@ -37,6 +39,7 @@ func New(log logrus.FieldLogger, exchanger exchange.Exchanger, addrManager *addr
 			cfg:         cfg.Teller,
 			exchanger:   exchanger,
 			addrManager: addrManager,
+			screener:    screener,
 		}, exchanger),
 	}
 }
@@ -71,20 +74,58 @@ func (s *Teller) Shutdown() {
 	<-s.done
 }
 
+// ApplyConfig applies the binding, exchange rate, throttling and CORS settings of a reloaded config
+func (s *Teller) ApplyConfig(cfg config.Config) {
+	s.httpServ.service.applyConfig(cfg.Teller)
+	s.httpServ.applyConfig(cfg)
+
+	s.log.WithField("notice", logger.WatchNotice).WithFields(logrus.Fields{
+		"bindEnabled":      cfg.Teller.BindEnabled,
+		"throttleMax":      cfg.Web.ThrottleMax,
+		"throttleDuration": cfg.Web.ThrottleDuration,
+		"corsAllowed":      cfg.Web.CORSAllowed,
+	}).Info("Applied reloaded config")
+}
+
 // Service combines Exchanger and AddrGenerator
 type Service struct {
 	cfg         config.Teller
+	cfgLock     sync.RWMutex       // Guards cfg.BindEnabled, which can be changed by reloading the config
 	exchanger   exchange.Exchanger // exchange Teller client
 	addrManager *addrs.AddrManager // address manager
+	screener    exchange.AddressScreener
 }
 
 // BindAddress binds skycoin address with a deposit address according to coinType
-// return deposit address
-func (s *Service) BindAddress(skyAddr, coinType string) (*exchange.BoundAddress, error) {
-	if !s.cfg.BindEnabled {
+// return deposit address. expectedValue is the amount the buyer expects to deposit,
+// in the units of exchange.DepositInfo.DepositValue, or 0 if not given
+func (s *Service) BindAddress(skyAddr, coinType string, expectedValue int64) (*exchange.BoundAddress, error) {
+	s.cfgLock.RLock()
+	bindEnabled := s.cfg.BindEnabled
+	s.cfgLock.RUnlock()
+
+	if !bindEnabled {
 		return nil, ErrBindDisabled
 	}
 
+	if s.screener != nil {
+		if err := s.screener.Check(config.CoinTypeSKY, skyAddr, "bind"); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.exchanger.PauseStatus().Bind {
+		return nil, exchange.ErrBindPausedByOperator
+	}
+
+	if s.exchanger.HotWalletStatus().Tripped {
+		return nil, exchange.ErrBindingPaused
+	}
+
+	if err := s.exchanger.CheckBindLimits(skyAddr, coinType); err != nil {
+		return nil, err
+	}
+
 	if s.cfg.MaxBoundAddresses > 0 {
 		num, err := s.exchanger.GetBindNum(skyAddr)
 		if err != nil {
@@ -101,7 +142,14 @@ func (s *Service) BindAddress(skyAddr, coinType string) (*exchange.BoundAddress,
 		return nil, err
 	}
 
-	return s.exchanger.BindAddress(skyAddr, depositAddr, coinType)
+	return s.exchanger.BindAddress(skyAddr, depositAddr, coinType, expectedValue)
+}
+
+// applyConfig applies the bind_enabled setting of a reloaded config
+func (s *Service) applyConfig(cfg config.Teller) {
+	s.cfgLock.Lock()
+	defer s.cfgLock.Unlock()
+	s.cfg.BindEnabled = cfg.BindEnabled
 }
 
 // GetDepositStatuses returns deposit status of given skycoin address
@@ -0,0 +1,110 @@
+package teller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/screening"
+)
+
+type denyAllScreener struct {
+	sources []string
+}
+
+func (s *denyAllScreener) Check(coinType, address, source string) error {
+	s.sources = append(s.sources, source)
+	return screening.ErrAddressDenied
+}
+
+func TestServiceBindAddressDenied(t *testing.T) {
+	e := &fakeExchanger{}
+	screener := &denyAllScreener{}
+
+	s := &Service{
+		cfg: config.Teller{
+			BindEnabled: true,
+		},
+		exchanger:   e,
+		addrManager: addrs.NewAddrManager(),
+		screener:    screener,
+	}
+
+	_, err := s.BindAddress("2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm", config.CoinTypeBTC, 0)
+	require.Equal(t, screening.ErrAddressDenied, err)
+	require.Equal(t, []string{"bind"}, screener.sources)
+
+	// The exchanger is not called for a denied address
+	e.AssertExpectations(t)
+}
+
+func TestServiceBindAddressLimitReached(t *testing.T) {
+	skyAddr := "2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm"
+
+	e := &fakeExchanger{}
+	e.On("PauseStatus").Return(exchange.PauseStatus{})
+	e.On("HotWalletStatus").Return(exchange.HotWalletStatus{})
+	e.On("CheckBindLimits", skyAddr, config.CoinTypeBTC).Return(exchange.ErrSaleCapReached)
+
+	s := &Service{
+		cfg: config.Teller{
+			BindEnabled: true,
+		},
+		exchanger:   e,
+		addrManager: addrs.NewAddrManager(),
+	}
+
+	_, err := s.BindAddress(skyAddr, config.CoinTypeBTC, 0)
+	require.Equal(t, exchange.ErrSaleCapReached, err)
+
+	e.AssertExpectations(t)
+}
+
+func TestServiceBindAddressPaused(t *testing.T) {
+	skyAddr := "2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm"
+
+	e := &fakeExchanger{}
+	e.On("PauseStatus").Return(exchange.PauseStatus{})
+	e.On("HotWalletStatus").Return(exchange.HotWalletStatus{
+		Enabled: true,
+		Tripped: true,
+	})
+
+	s := &Service{
+		cfg: config.Teller{
+			BindEnabled: true,
+		},
+		exchanger:   e,
+		addrManager: addrs.NewAddrManager(),
+	}
+
+	_, err := s.BindAddress(skyAddr, config.CoinTypeBTC, 0)
+	require.Equal(t, exchange.ErrBindingPaused, err)
+
+	e.AssertExpectations(t)
+}
+
+func TestServiceBindAddressPausedByOperator(t *testing.T) {
+	skyAddr := "2Wb1mFLkfaLvWPxhvzGZsLeqtpzj5LBddBm"
+
+	e := &fakeExchanger{}
+	e.On("PauseStatus").Return(exchange.PauseStatus{
+		Bind: true,
+	})
+
+	s := &Service{
+		cfg: config.Teller{
+			BindEnabled: true,
+		},
+		exchanger:   e,
+		addrManager: addrs.NewAddrManager(),
+	}
+
+	_, err := s.BindAddress(skyAddr, config.CoinTypeBTC, 0)
+	require.Equal(t, exchange.ErrBindPausedByOperator, err)
+
+	e.AssertExpectations(t)
+}
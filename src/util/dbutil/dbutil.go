@@ -145,6 +145,16 @@ func NextSequence(tx *bolt.Tx, bktName []byte) (uint64, error) {
 	return bkt.NextSequence()
 }
 
+// DeleteBucketValue deletes the value of key in a bucket. Deleting a missing key is not an error.
+func DeleteBucketValue(tx *bolt.Tx, bktName []byte, key string) error {
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return NewBucketNotExistErr(bktName)
+	}
+
+	return bkt.Delete([]byte(key))
+}
+
 // ForEach calls ForEach on the bucket
 func ForEach(tx *bolt.Tx, bktName []byte, f func(k, v []byte) error) error {
 	bkt := tx.Bucket(bktName)
@@ -154,3 +164,33 @@ func ForEach(tx *bolt.Tx, bktName []byte, f func(k, v []byte) error) error {
 
 	return bkt.ForEach(f)
 }
+
+// ForEachIfExists calls ForEach on the bucket, if it exists
+func ForEachIfExists(tx *bolt.Tx, bktName []byte, f func(k, v []byte) error) error {
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return nil
+	}
+
+	return bkt.ForEach(f)
+}
+
+// BucketKeyCount returns the number of keys of a bucket, 0 if it does not exist
+func BucketKeyCount(tx *bolt.Tx, bktName []byte) int {
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return 0
+	}
+
+	return bkt.Stats().KeyN
+}
+
+// BucketSequence returns the Sequence() of a bucket, 0 if it does not exist
+func BucketSequence(tx *bolt.Tx, bktName []byte) uint64 {
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return 0
+	}
+
+	return bkt.Sequence()
+}
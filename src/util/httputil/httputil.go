@@ -1,6 +1,8 @@
 package httputil
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -60,6 +62,43 @@ func LogHandler(log logrus.FieldLogger, hd http.Handler) http.Handler {
 	})
 }
 
+type ctxKey int
+
+const usernameCtxKey ctxKey = iota
+
+// UsernameFromContext returns the username authenticated by BasicAuthHandler
+func UsernameFromContext(ctx context.Context) string {
+	username, _ := ctx.Value(usernameCtxKey).(string)
+	return username
+}
+
+// BasicAuthHandler requires HTTP basic auth credentials matching one of credentials,
+// which maps usernames to passwords. The authenticated username is put into the
+// request context, see UsernameFromContext.
+func BasicAuthHandler(realm string, credentials map[string]string, hd http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || !checkPassword(credentials, username, password) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, realm))
+			ErrResponse(w, http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), usernameCtxKey, username)
+		hd.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func checkPassword(credentials map[string]string, username, password string) bool {
+	expected, ok := credentials[username]
+	if !ok {
+		// Compare anyway so that unknown usernames take as long as wrong passwords
+		expected = password + "x"
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1 && ok
+}
+
 // Captures the response status of a http handler
 type loggingResponseWriter struct {
 	http.ResponseWriter
@@ -0,0 +1,275 @@
+// Package sqlutil provides the database handle and transaction helpers shared by the SQL stores
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	// Register the supported drivers
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// DriverSQLite3 is the SQLite driver name
+	DriverSQLite3 = "sqlite3"
+	// DriverPostgres is the PostgreSQL driver name
+	DriverPostgres = "postgres"
+
+	// writeLockID is the PostgreSQL advisory lock taken by every write transaction
+	writeLockID = 73696
+)
+
+var (
+	// Drivers are the supported drivers
+	Drivers = []string{DriverSQLite3, DriverPostgres}
+
+	// ErrUnsupportedDriver is returned if a driver is not supported
+	ErrUnsupportedDriver = errors.New("Unsupported SQL driver")
+)
+
+// schema creates the tables shared by the stores
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS sequences (
+		name TEXT PRIMARY KEY,
+		value BIGINT NOT NULL
+	)`,
+}
+
+// DB is a SQL database of a supported driver
+type DB struct {
+	*sql.DB
+	Driver string
+	// Serializes the write transactions of this process
+	writeLock sync.Mutex
+}
+
+// Open opens a database.
+// A SQLite database is opened in WAL mode, so that reads are not blocked by a write transaction,
+// as they are not in bolt.
+func Open(driver, dsn string) (*DB, error) {
+	switch driver {
+	case DriverSQLite3:
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_journal_mode=WAL&_busy_timeout=5000"
+	case DriverPostgres:
+	default:
+		return nil, ErrUnsupportedDriver
+	}
+
+	sqlDB, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	db := &DB{
+		DB:     sqlDB,
+		Driver: driver,
+	}
+
+	if err := db.CreateTables(schema); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// CreateTables executes CREATE TABLE and CREATE INDEX statements in a transaction
+func (db *DB) CreateTables(stmts []string) error {
+	return db.Update(func(tx *Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("create table failed: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Update executes f in a write transaction, which is committed unless f returns an error.
+// Write transactions are serialized, as they are in bolt, so that f can read and then write
+// without conflicting with another. PostgreSQL write transactions also take an advisory lock,
+// which serializes them with the other processes using the database.
+func (db *DB) Update(f func(*Tx) error) error {
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+
+	return db.run(false, f)
+}
+
+// View executes f in a read-only transaction
+func (db *DB) View(f func(*Tx) error) error {
+	return db.run(true, f)
+}
+
+func (db *DB) run(readOnly bool, f func(*Tx) error) (err error) {
+	var opts *sql.TxOptions
+	if db.Driver == DriverPostgres && readOnly {
+		// See a consistent snapshot, as a bolt.Tx does
+		opts = &sql.TxOptions{
+			Isolation: sql.LevelRepeatableRead,
+			ReadOnly:  true,
+		}
+	}
+
+	sqlTx, err := db.BeginTx(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	tx := &Tx{
+		tx:     sqlTx,
+		driver: db.Driver,
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			sqlTx.Rollback()
+			panic(p)
+		}
+
+		if err != nil {
+			sqlTx.Rollback()
+			return
+		}
+
+		err = sqlTx.Commit()
+	}()
+
+	if db.Driver == DriverPostgres && !readOnly {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(?)", writeLockID); err != nil {
+			return err
+		}
+	}
+
+	return f(tx)
+}
+
+// Tx is a transaction. Its queries use ? placeholders, which are rebound for the driver.
+type Tx struct {
+	tx     *sql.Tx
+	driver string
+}
+
+// Exec executes a query without returning rows
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.tx.Exec(tx.rebind(query), args...)
+}
+
+// Query executes a query that returns rows
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.tx.Query(tx.rebind(query), args...)
+}
+
+// QueryRow executes a query that returns at most one row
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.tx.QueryRow(tx.rebind(query), args...)
+}
+
+// rebind replaces the ? placeholders with $1, $2, ... for PostgreSQL
+func (tx *Tx) rebind(query string) string {
+	if tx.driver != DriverPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// NextSequence increments and returns a named sequence, starting from 1 as a bolt.Bucket's does
+func NextSequence(tx *Tx, name string) (uint64, error) {
+	if _, err := tx.Exec(`INSERT INTO sequences (name, value) VALUES (?, 1)
+		ON CONFLICT (name) DO UPDATE SET value = sequences.value + 1`, name); err != nil {
+		return 0, err
+	}
+
+	return Sequence(tx, name)
+}
+
+// Sequence returns the current value of a named sequence, 0 if it was never incremented
+func Sequence(tx *Tx, name string) (uint64, error) {
+	var seq int64
+	err := tx.QueryRow("SELECT value FROM sequences WHERE name = ?", name).Scan(&seq)
+	switch err {
+	case nil:
+		return uint64(seq), nil
+	case sql.ErrNoRows:
+		return 0, nil
+	default:
+		return 0, err
+	}
+}
+
+// SetSequence sets the current value of a named sequence
+func SetSequence(tx *Tx, name string, seq uint64) error {
+	_, err := tx.Exec(`INSERT INTO sequences (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`, name, int64(seq))
+	return err
+}
+
+// CountRows returns the number of rows of a table
+func CountRows(tx *Tx, table string) (int, error) {
+	var n int
+	if err := tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// RowCounts maps a table to its number of rows.
+// The row counts of a bolt database are the number of rows its data is migrated to.
+type RowCounts map[string]int
+
+// Add adds the counts of other
+func (c RowCounts) Add(other RowCounts) {
+	for k, v := range other {
+		c[k] += v
+	}
+}
+
+// Diff returns a description of the tables whose counts differ from other, sorted by table
+func (c RowCounts) Diff(other RowCounts) []string {
+	tables := make(map[string]struct{})
+	for k := range c {
+		tables[k] = struct{}{}
+	}
+	for k := range other {
+		tables[k] = struct{}{}
+	}
+
+	var diffs []string
+	for k := range tables {
+		if c[k] != other[k] {
+			diffs = append(diffs, fmt.Sprintf("%s: %d != %d", k, c[k], other[k]))
+		}
+	}
+
+	sort.Strings(diffs)
+
+	return diffs
+}
@@ -0,0 +1,132 @@
+package sqlutil
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func prepareDB(t *testing.T) (*DB, func()) {
+	f, err := ioutil.TempFile("", "testsqldb")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	db, err := Open(DriverSQLite3, f.Name())
+	require.NoError(t, err)
+
+	return db, func() {
+		require.NoError(t, db.Close())
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(f.Name() + suffix)
+		}
+	}
+}
+
+func TestOpenUnsupportedDriver(t *testing.T) {
+	_, err := Open("mysql", "foo")
+	require.Equal(t, ErrUnsupportedDriver, err)
+}
+
+func TestRebind(t *testing.T) {
+	tx := &Tx{
+		driver: DriverPostgres,
+	}
+	require.Equal(t, "SELECT a FROM b WHERE c = $1 AND d = $2", tx.rebind("SELECT a FROM b WHERE c = ? AND d = ?"))
+
+	tx.driver = DriverSQLite3
+	require.Equal(t, "SELECT a FROM b WHERE c = ?", tx.rebind("SELECT a FROM b WHERE c = ?"))
+}
+
+func TestSequence(t *testing.T) {
+	db, shutdown := prepareDB(t)
+	defer shutdown()
+
+	err := db.Update(func(tx *Tx) error {
+		seq, err := Sequence(tx, "foo")
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), seq)
+
+		seq, err = NextSequence(tx, "foo")
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), seq)
+
+		seq, err = NextSequence(tx, "foo")
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), seq)
+
+		// Sequences are independent
+		seq, err = NextSequence(tx, "bar")
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), seq)
+
+		require.NoError(t, SetSequence(tx, "foo", 10))
+		seq, err = NextSequence(tx, "foo")
+		require.NoError(t, err)
+		require.Equal(t, uint64(11), seq)
+
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestUpdateRollback(t *testing.T) {
+	db, shutdown := prepareDB(t)
+	defer shutdown()
+
+	require.NoError(t, db.CreateTables([]string{"CREATE TABLE IF NOT EXISTS foo (a TEXT PRIMARY KEY)"}))
+
+	fooErr := errors.New("foo")
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.Exec("INSERT INTO foo (a) VALUES (?)", "a")
+		require.NoError(t, err)
+		_, err = NextSequence(tx, "foo")
+		require.NoError(t, err)
+		return fooErr
+	})
+	require.Equal(t, fooErr, err)
+
+	require.Panics(t, func() {
+		db.Update(func(tx *Tx) error { // nolint: errcheck
+			_, err := tx.Exec("INSERT INTO foo (a) VALUES (?)", "b")
+			require.NoError(t, err)
+			panic("foo")
+		})
+	})
+
+	err = db.View(func(tx *Tx) error {
+		n, err := CountRows(tx, "foo")
+		require.NoError(t, err)
+		require.Equal(t, 0, n)
+
+		seq, err := Sequence(tx, "foo")
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), seq)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	// The write lock was released
+	err = db.Update(func(tx *Tx) error {
+		_, err := tx.Exec("INSERT INTO foo (a) VALUES (?)", "c")
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func TestRowCountsDiff(t *testing.T) {
+	c := RowCounts{
+		"a": 1,
+	}
+	c.Add(RowCounts{
+		"a": 2,
+		"b": 3,
+	})
+	require.Equal(t, RowCounts{"a": 3, "b": 3}, c)
+
+	require.Empty(t, c.Diff(RowCounts{"a": 3, "b": 3}))
+	require.Equal(t, []string{"a: 3 != 1", "c: 0 != 2"}, c.Diff(RowCounts{"a": 1, "b": 3, "c": 2}))
+}
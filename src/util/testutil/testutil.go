@@ -2,9 +2,11 @@ package testutil
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/boltdb/bolt"
@@ -13,8 +15,12 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/sqlutil"
 )
 
+// PostgresDSNEnv is the environment variable of a PostgreSQL database to test the SQL stores with, instead of SQLite
+const PostgresDSNEnv = "TELLER_TEST_POSTGRES_DSN"
+
 // PrepareDB initializes a temporary bolt.DB
 func PrepareDB(t *testing.T) (*bolt.DB, func()) {
 	f, err := ioutil.TempFile("", "testdb")
@@ -31,6 +37,63 @@ func PrepareDB(t *testing.T) (*bolt.DB, func()) {
 	}
 }
 
+// PrepareSQLDB initializes a temporary SQLite database.
+// If PostgresDSNEnv is set, a temporary schema of that PostgreSQL database is used instead.
+func PrepareSQLDB(t *testing.T) (*sqlutil.DB, func()) {
+	if dsn := os.Getenv(PostgresDSNEnv); dsn != "" {
+		return preparePostgresDB(t, dsn)
+	}
+
+	f, err := ioutil.TempFile("", "testsqldb")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	db, err := sqlutil.Open(sqlutil.DriverSQLite3, f.Name())
+	require.NoError(t, err)
+
+	return db, func() {
+		err := db.Close()
+		require.NoError(t, err)
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err = os.Remove(f.Name() + suffix)
+			if !os.IsNotExist(err) {
+				require.NoError(t, err)
+			}
+		}
+	}
+}
+
+func preparePostgresDB(t *testing.T, dsn string) (*sqlutil.DB, func()) {
+	admin, err := sql.Open(sqlutil.DriverPostgres, dsn)
+	require.NoError(t, err)
+
+	schema := "test_" + RandString(t, 8)
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+
+	// The DSN is either a URL or key=value pairs
+	switch {
+	case !strings.Contains(dsn, "://"):
+		dsn += " search_path=" + schema
+	case strings.Contains(dsn, "?"):
+		dsn += "&search_path=" + schema
+	default:
+		dsn += "?search_path=" + schema
+	}
+
+	db, err := sqlutil.Open(sqlutil.DriverPostgres, dsn)
+	require.NoError(t, err)
+
+	return db, func() {
+		err := db.Close()
+		require.NoError(t, err)
+		_, err = admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		require.NoError(t, err)
+		err = admin.Close()
+		require.NoError(t, err)
+	}
+}
+
 // CheckError calls f and asserts it did not return an error
 func CheckError(t *testing.T, f func() error) {
 	t.Helper()
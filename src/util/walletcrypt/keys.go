@@ -0,0 +1,112 @@
+package walletcrypt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skycoin/skycoin/src/wallet"
+)
+
+// ErrUnencryptedWallet is returned when opening an unencrypted wallet file without allowing it
+var ErrUnencryptedWallet = errors.New("Wallet is not encrypted")
+
+// Keys gives access to the secret keys of a wallet file.
+// The secret keys of an encrypted wallet are only decrypted when requested.
+type Keys struct {
+	file      string
+	addrs     []string
+	encrypted *Wallet
+	key       []byte // Key derived from the password of an encrypted wallet
+}
+
+// OpenKeys opens a wallet file, checking that password decrypts it if it is encrypted.
+// Unencrypted wallets are refused unless allowUnencrypted is set.
+func OpenKeys(file string, password []byte, allowUnencrypted bool) (*Keys, error) {
+	encrypted, err := IsEncrypted(file)
+	if err != nil {
+		return nil, fmt.Errorf("Load wallet %s failed: %v", file, err)
+	}
+
+	k := &Keys{
+		file: file,
+	}
+
+	if encrypted {
+		k.encrypted, err = Load(file)
+		if err != nil {
+			return nil, err
+		}
+
+		k.key, err = k.encrypted.DeriveKey(password)
+		if err != nil {
+			return nil, fmt.Errorf("Decrypt wallet %s failed: %v", file, err)
+		}
+
+		if err := k.encrypted.CheckKey(k.key); err != nil {
+			return nil, fmt.Errorf("Decrypt wallet %s failed: %v", file, err)
+		}
+
+		k.addrs = k.encrypted.Addresses()
+	} else {
+		if !allowUnencrypted {
+			return nil, fmt.Errorf("%v: %s", ErrUnencryptedWallet, file)
+		}
+
+		wlt, err := wallet.Load(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range wlt.Entries {
+			k.addrs = append(k.addrs, e.Address.String())
+		}
+
+		Zero(wlt)
+	}
+
+	if len(k.addrs) == 0 {
+		return nil, fmt.Errorf("Wallet %s is empty", file)
+	}
+
+	return k, nil
+}
+
+// File returns the wallet's filename
+func (k *Keys) File() string {
+	return k.file
+}
+
+// Addresses returns the wallet's addresses
+func (k *Keys) Addresses() []string {
+	return k.addrs
+}
+
+// IsEncrypted returns true if the wallet file is encrypted
+func (k *Keys) IsEncrypted() bool {
+	return k.encrypted != nil
+}
+
+// Wallet returns the wallet with its secret keys, which must be erased with Zero after use
+func (k *Keys) Wallet() (*wallet.Wallet, error) {
+	if k.encrypted == nil {
+		return wallet.Load(k.file)
+	}
+
+	return k.encrypted.Decrypt(k.key)
+}
+
+// AnyEncrypted returns true if any of the wallet files is encrypted
+func AnyEncrypted(files []string) (bool, error) {
+	for _, f := range files {
+		encrypted, err := IsEncrypted(f)
+		if err != nil {
+			return false, fmt.Errorf("Load wallet %s failed: %v", f, err)
+		}
+
+		if encrypted {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
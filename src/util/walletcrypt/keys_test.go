@@ -0,0 +1,69 @@
+package walletcrypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	skycipher "github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestOpenKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "walletcrypt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	wlt := newTestWallet(t, 2)
+	require.NoError(t, wlt.Save(dir))
+	plainFile := filepath.Join(dir, "test.wlt")
+
+	// Unencrypted wallets are refused unless allowed
+	_, err = OpenKeys(plainFile, nil, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ErrUnencryptedWallet.Error())
+
+	keys, err := OpenKeys(plainFile, nil, true)
+	require.NoError(t, err)
+	require.False(t, keys.IsEncrypted())
+	require.Equal(t, []string{
+		wlt.Entries[0].Address.String(),
+		wlt.Entries[1].Address.String(),
+	}, keys.Addresses())
+
+	ew, err := Encrypt(wlt, []byte("password"), 10)
+	require.NoError(t, err)
+
+	encryptedFile := filepath.Join(dir, "encrypted.wlt")
+	require.NoError(t, ew.Save(encryptedFile))
+
+	_, err = OpenKeys(encryptedFile, []byte("wrong"), false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ErrWrongPassword.Error())
+
+	_, err = OpenKeys(encryptedFile, nil, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ErrEmptyPassword.Error())
+
+	keys, err = OpenKeys(encryptedFile, []byte("password"), false)
+	require.NoError(t, err)
+	require.True(t, keys.IsEncrypted())
+	require.Equal(t, encryptedFile, keys.File())
+	require.Equal(t, ew.Addresses(), keys.Addresses())
+
+	decrypted, err := keys.Wallet()
+	require.NoError(t, err)
+	require.Equal(t, wlt.Entries, decrypted.Entries)
+	Zero(decrypted)
+	require.Equal(t, skycipher.SecKey{}, decrypted.Entries[0].Secret)
+
+	encrypted, err := AnyEncrypted([]string{plainFile})
+	require.NoError(t, err)
+	require.False(t, encrypted)
+
+	encrypted, err = AnyEncrypted([]string{plainFile, encryptedFile})
+	require.NoError(t, err)
+	require.True(t, encrypted)
+}
@@ -0,0 +1,63 @@
+package walletcrypt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// PasswordEnv is the environment variable a wallet password can be read from
+const PasswordEnv = "TELLER_WALLET_PASSWORD"
+
+// ReadPassword reads a wallet password from the file descriptor fd if it is not negative,
+// otherwise from the TELLER_WALLET_PASSWORD environment variable,
+// otherwise by prompting for it if stdin is a terminal.
+// The environment variable is unset once read, so that child processes don't inherit it.
+func ReadPassword(fd int) ([]byte, error) {
+	if fd >= 0 {
+		f := os.NewFile(uintptr(fd), "wallet-password-fd")
+		if f == nil {
+			return nil, fmt.Errorf("Invalid wallet password file descriptor %d", fd)
+		}
+		defer f.Close()
+
+		password, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("Read wallet password from file descriptor %d failed: %v", fd, err)
+		}
+
+		// Strip a trailing newline, as written by echo or a password file
+		return bytes.TrimRight(password, "\r\n"), nil
+	}
+
+	if password, ok := os.LookupEnv(PasswordEnv); ok {
+		if err := os.Unsetenv(PasswordEnv); err != nil {
+			return nil, err
+		}
+
+		return []byte(password), nil
+	}
+
+	stdin := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(stdin) {
+		return nil, errors.New("Wallet is encrypted but no password was supplied. Use --wallet-password-fd, " + PasswordEnv + " or run in a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, "Wallet password: ")
+	password, err := terminal.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("Read wallet password failed: %v", err)
+	}
+
+	return password, nil
+}
+
+// ZeroPassword erases a password from memory
+func ZeroPassword(password []byte) {
+	zero(password)
+}
@@ -0,0 +1,371 @@
+// Package walletcrypt stores Skycoin wallets with encrypted secret keys.
+// The addresses and public keys of an encrypted wallet are readable without the password,
+// so that balances can be checked. The secret keys are only decrypted in memory for signing.
+package walletcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	skycipher "github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/wallet"
+)
+
+const (
+	// Version of the encrypted wallet format
+	Version = "1"
+	// DefaultIterations is the number of PBKDF2 iterations used to derive the key from the password
+	DefaultIterations = 200000
+
+	kdfPBKDF2SHA256 = "pbkdf2-sha256"
+	cipherAES256GCM = "aes-256-gcm"
+	keyLen          = 32
+	saltLen         = 32
+	secKeyLen       = len(skycipher.SecKey{})
+)
+
+var (
+	// ErrWrongPassword is returned when the secret keys can't be decrypted with a password
+	ErrWrongPassword = errors.New("Wallet password is incorrect")
+	// ErrEmptyPassword is returned when encrypting or decrypting with an empty password
+	ErrEmptyPassword = errors.New("Wallet password is empty")
+)
+
+// Entry is an address of an encrypted wallet. Its secret key is stored encrypted in Wallet.Ciphertext.
+type Entry struct {
+	Address string `json:"address"`
+	Public  string `json:"public_key"`
+}
+
+// KDF describes how the encryption key is derived from the password
+type KDF struct {
+	Name       string `json:"name"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+}
+
+// Wallet is a Skycoin wallet with encrypted secret keys.
+// The wallet seed is not stored, it must be backed up separately.
+type Wallet struct {
+	Encrypted bool              `json:"encrypted"`
+	Version   string            `json:"version"`
+	Meta      map[string]string `json:"meta"`
+	Entries   []Entry           `json:"entries"`
+	KDF       KDF               `json:"kdf"`
+	Cipher    string            `json:"cipher"`
+	Nonce     string            `json:"nonce"`
+	// The secret keys of Entries in the same order, encrypted.
+	// The addresses are authenticated as additional data.
+	Ciphertext string `json:"ciphertext"`
+}
+
+// Encrypt creates an encrypted wallet from w. The seed of w is not included.
+func Encrypt(w *wallet.Wallet, password []byte, iterations int) (*Wallet, error) {
+	if len(password) == 0 {
+		return nil, ErrEmptyPassword
+	}
+
+	if len(w.Entries) == 0 {
+		return nil, errors.New("Wallet is empty")
+	}
+
+	ew := &Wallet{
+		Encrypted: true,
+		Version:   Version,
+		Meta:      make(map[string]string, len(w.Meta)),
+		KDF: KDF{
+			Name:       kdfPBKDF2SHA256,
+			Iterations: iterations,
+		},
+		Cipher: cipherAES256GCM,
+	}
+
+	for k, v := range w.Meta {
+		if k == "seed" || k == "lastSeed" {
+			continue
+		}
+		ew.Meta[k] = v
+	}
+
+	secrets := make([]byte, 0, len(w.Entries)*secKeyLen)
+	defer zero(secrets[:cap(secrets)])
+
+	for _, e := range w.Entries {
+		ew.Entries = append(ew.Entries, Entry{
+			Address: e.Address.String(),
+			Public:  e.Public.Hex(),
+		})
+		secrets = append(secrets, e.Secret[:]...)
+	}
+
+	salt, err := randBytes(saltLen)
+	if err != nil {
+		return nil, err
+	}
+	ew.KDF.Salt = hex.EncodeToString(salt)
+
+	key, err := ew.DeriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	ew.Nonce = hex.EncodeToString(nonce)
+
+	ew.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, secrets, ew.additionalData()))
+
+	return ew, nil
+}
+
+// Load loads an encrypted wallet file
+func Load(path string) (*Wallet, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var w Wallet
+	if err := json.Unmarshal(b, &w); err != nil {
+		return nil, fmt.Errorf("Decode encrypted wallet %s failed: %v", path, err)
+	}
+
+	if err := w.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid encrypted wallet %s: %v", path, err)
+	}
+
+	return &w, nil
+}
+
+// IsEncrypted returns true if path is an encrypted wallet file
+func IsEncrypted(path string) (bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var w struct {
+		Encrypted bool `json:"encrypted"`
+	}
+	if err := json.Unmarshal(b, &w); err != nil {
+		return false, err
+	}
+
+	return w.Encrypted, nil
+}
+
+// Save writes the encrypted wallet to path. An existing file is not overwritten.
+func (w *Wallet) Save(path string) error {
+	b, err := json.MarshalIndent(w, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Validate checks the encryption parameters and that the entries' addresses match their public keys
+func (w *Wallet) Validate() error {
+	if !w.Encrypted {
+		return errors.New("encrypted not set")
+	}
+
+	if w.Version != Version {
+		return fmt.Errorf("unsupported version %q", w.Version)
+	}
+
+	if w.KDF.Name != kdfPBKDF2SHA256 {
+		return fmt.Errorf("unsupported kdf %q", w.KDF.Name)
+	}
+
+	if w.KDF.Iterations <= 0 {
+		return errors.New("kdf iterations must be positive")
+	}
+
+	if w.Cipher != cipherAES256GCM {
+		return fmt.Errorf("unsupported cipher %q", w.Cipher)
+	}
+
+	if len(w.Entries) == 0 {
+		return errors.New("no entries")
+	}
+
+	for _, e := range w.Entries {
+		pub, err := skycipher.PubKeyFromHex(e.Public)
+		if err != nil {
+			return fmt.Errorf("invalid public key of %s: %v", e.Address, err)
+		}
+
+		if skycipher.AddressFromPubKey(pub).String() != e.Address {
+			return fmt.Errorf("address %s does not match its public key", e.Address)
+		}
+	}
+
+	for k, v := range map[string]string{
+		"kdf salt":   w.KDF.Salt,
+		"nonce":      w.Nonce,
+		"ciphertext": w.Ciphertext,
+	} {
+		if _, err := hex.DecodeString(v); err != nil || v == "" {
+			return fmt.Errorf("invalid %s", k)
+		}
+	}
+
+	return nil
+}
+
+// Addresses returns the addresses of the wallet
+func (w *Wallet) Addresses() []string {
+	addrs := make([]string, len(w.Entries))
+	for i, e := range w.Entries {
+		addrs[i] = e.Address
+	}
+	return addrs
+}
+
+// DeriveKey derives the encryption key from the password.
+// The key can be kept in place of the password to decrypt the wallet later.
+func (w *Wallet) DeriveKey(password []byte) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, ErrEmptyPassword
+	}
+
+	salt, err := hex.DecodeString(w.KDF.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return pbkdf2.Key(password, salt, w.KDF.Iterations, keyLen, sha256.New), nil
+}
+
+// CheckKey returns ErrWrongPassword if key doesn't decrypt the wallet
+func (w *Wallet) CheckKey(key []byte) error {
+	wlt, err := w.Decrypt(key)
+	if err != nil {
+		return err
+	}
+
+	Zero(wlt)
+	return nil
+}
+
+// Decrypt returns the wallet with its decrypted secret keys.
+// The secret keys must be erased with Zero once they are no longer needed.
+func (w *Wallet) Decrypt(key []byte) (*wallet.Wallet, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hex.DecodeString(w.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := hex.DecodeString(w.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("Invalid nonce length")
+	}
+
+	secrets, err := aead.Open(nil, nonce, ciphertext, w.additionalData())
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	defer zero(secrets)
+
+	if len(secrets) != len(w.Entries)*secKeyLen {
+		return nil, errors.New("Decrypted secret keys don't match the wallet entries")
+	}
+
+	wlt := &wallet.Wallet{
+		Meta:    make(map[string]string, len(w.Meta)),
+		Entries: make([]wallet.Entry, len(w.Entries)),
+	}
+
+	for k, v := range w.Meta {
+		wlt.Meta[k] = v
+	}
+
+	for i, e := range w.Entries {
+		entry := &wlt.Entries[i]
+		copy(entry.Secret[:], secrets[i*secKeyLen:(i+1)*secKeyLen])
+
+		entry.Public = skycipher.PubKeyFromSecKey(entry.Secret)
+		entry.Address = skycipher.AddressFromPubKey(entry.Public)
+
+		if entry.Address.String() != e.Address {
+			Zero(wlt)
+			return nil, fmt.Errorf("Decrypted secret key does not match address %s", e.Address)
+		}
+	}
+
+	return wlt, nil
+}
+
+// Zero erases the secret keys of a wallet
+func Zero(w *wallet.Wallet) {
+	for i := range w.Entries {
+		w.Entries[i].Secret = skycipher.SecKey{}
+	}
+}
+
+// additionalData binds the ciphertext to the wallet's addresses
+func (w *Wallet) additionalData() []byte {
+	return []byte(strings.Join(w.Addresses(), ","))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func randBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
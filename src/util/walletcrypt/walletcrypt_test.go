@@ -0,0 +1,158 @@
+package walletcrypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	skycipher "github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/wallet"
+)
+
+func newTestWallet(t *testing.T, n uint64) *wallet.Wallet {
+	wlt, err := wallet.NewWallet("test.wlt", wallet.Options{
+		Seed: "walletcrypt test seed",
+	})
+	require.NoError(t, err)
+
+	_, err = wlt.GenerateAddresses(n)
+	require.NoError(t, err)
+
+	return wlt
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	wlt := newTestWallet(t, 3)
+	password := []byte("password")
+
+	ew, err := Encrypt(wlt, password, 10)
+	require.NoError(t, err)
+	require.NoError(t, ew.Validate())
+
+	// The seed is not stored
+	_, ok := ew.Meta["seed"]
+	require.False(t, ok)
+	_, ok = ew.Meta["lastSeed"]
+	require.False(t, ok)
+	require.Equal(t, wlt.Meta["filename"], ew.Meta["filename"])
+
+	require.Len(t, ew.Entries, 3)
+	for i, e := range wlt.Entries {
+		require.Equal(t, e.Address.String(), ew.Entries[i].Address)
+		require.Equal(t, e.Public.Hex(), ew.Entries[i].Public)
+	}
+
+	key, err := ew.DeriveKey(password)
+	require.NoError(t, err)
+	require.NoError(t, ew.CheckKey(key))
+
+	decrypted, err := ew.Decrypt(key)
+	require.NoError(t, err)
+	require.Equal(t, wlt.Entries, decrypted.Entries)
+
+	Zero(decrypted)
+	for _, e := range decrypted.Entries {
+		require.Equal(t, skycipher.SecKey{}, e.Secret)
+	}
+
+	// The original wallet is untouched
+	require.NotEqual(t, skycipher.SecKey{}, wlt.Entries[0].Secret)
+
+	key, err = ew.DeriveKey([]byte("wrong password"))
+	require.NoError(t, err)
+	require.Equal(t, ErrWrongPassword, ew.CheckKey(key))
+
+	_, err = ew.DeriveKey(nil)
+	require.Equal(t, ErrEmptyPassword, err)
+
+	_, err = Encrypt(wlt, nil, 10)
+	require.Equal(t, ErrEmptyPassword, err)
+}
+
+func TestDecryptTampered(t *testing.T) {
+	wlt := newTestWallet(t, 2)
+	password := []byte("password")
+
+	ew, err := Encrypt(wlt, password, 10)
+	require.NoError(t, err)
+
+	key, err := ew.DeriveKey(password)
+	require.NoError(t, err)
+
+	// The addresses are authenticated with the secret keys
+	ew.Entries[0], ew.Entries[1] = ew.Entries[1], ew.Entries[0]
+	_, err = ew.Decrypt(key)
+	require.Equal(t, ErrWrongPassword, err)
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "walletcrypt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	wlt := newTestWallet(t, 2)
+
+	plainFile := filepath.Join(dir, "plain.wlt")
+	require.NoError(t, wlt.Save(dir))
+	require.NoError(t, os.Rename(filepath.Join(dir, "test.wlt"), plainFile))
+
+	encrypted, err := IsEncrypted(plainFile)
+	require.NoError(t, err)
+	require.False(t, encrypted)
+
+	_, err = Load(plainFile)
+	require.Error(t, err)
+
+	ew, err := Encrypt(wlt, []byte("password"), 10)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "encrypted.wlt")
+	require.NoError(t, ew.Save(path))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// An existing file is not overwritten
+	require.Error(t, ew.Save(path))
+
+	encrypted, err = IsEncrypted(path)
+	require.NoError(t, err)
+	require.True(t, encrypted)
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, ew, loaded)
+
+	key, err := loaded.DeriveKey([]byte("password"))
+	require.NoError(t, err)
+
+	decrypted, err := loaded.Decrypt(key)
+	require.NoError(t, err)
+	require.Equal(t, wlt.Entries, decrypted.Entries)
+}
+
+func TestValidate(t *testing.T) {
+	wlt := newTestWallet(t, 2)
+
+	ew, err := Encrypt(wlt, []byte("password"), 10)
+	require.NoError(t, err)
+	require.NoError(t, ew.Validate())
+
+	// An address that doesn't match its public key
+	ew.Entries[0].Address = ew.Entries[1].Address
+	require.Error(t, ew.Validate())
+
+	ew, err = Encrypt(wlt, []byte("password"), 10)
+	require.NoError(t, err)
+	ew.Cipher = "rot13"
+	require.Error(t, ew.Validate())
+
+	ew, err = Encrypt(wlt, []byte("password"), 10)
+	require.NoError(t, err)
+	ew.Ciphertext = ""
+	require.Error(t, ew.Validate())
+}
@@ -0,0 +1,351 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/sqlutil"
+)
+
+// EventsTableSchema creates the outbox table. It is also created by the exchange's SQL store,
+// which adds the events in the same transaction as the changes they report.
+var EventsTableSchema = []string{
+	`CREATE TABLE IF NOT EXISTS webhook_events (
+		seq BIGINT PRIMARY KEY,
+		type TEXT NOT NULL,
+		timestamp BIGINT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+}
+
+var sqlSchema = []string{
+	EventsTableSchema[0],
+	`CREATE TABLE IF NOT EXISTS webhook_endpoints (
+		url TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_failures (
+		seq BIGINT PRIMARY KEY,
+		timestamp BIGINT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+}
+
+// The tables have the names of the buckets they replace, and their sequences are named after them
+var (
+	eventsTable    = string(EventsBkt)
+	endpointsTable = string(EndpointsBkt)
+	failuresTable  = string(FailuresBkt)
+)
+
+// SQLStore records the events and their delivery in a SQL database
+type SQLStore struct {
+	db *sqlutil.DB
+}
+
+// NewSQLStore creates a SQLStore
+func NewSQLStore(db *sqlutil.DB) (*SQLStore, error) {
+	if db == nil {
+		return nil, errors.New("new webhook SQLStore failed, db is nil")
+	}
+
+	if err := db.CreateTables(sqlSchema); err != nil {
+		return nil, err
+	}
+
+	return &SQLStore{
+		db: db,
+	}, nil
+}
+
+// AddEventSQLTx adds an event to the outbox, with data marshaled to JSON.
+// The webhook_events table must exist.
+func AddEventSQLTx(tx *sqlutil.Tx, eventType string, timestamp int64, data interface{}) (Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	seq, err := sqlutil.NextSequence(tx, eventsTable)
+	if err != nil {
+		return Event{}, err
+	}
+
+	e := Event{
+		Seq:       seq,
+		Type:      eventType,
+		Timestamp: timestamp,
+		Data:      b,
+	}
+
+	if err := putEventSQLTx(tx, e); err != nil {
+		return Event{}, err
+	}
+
+	return e, nil
+}
+
+func putEventSQLTx(tx *sqlutil.Tx, e Event) error {
+	_, err := tx.Exec("INSERT INTO webhook_events (seq, type, timestamp, data) VALUES (?, ?, ?, ?)",
+		int64(e.Seq), e.Type, e.Timestamp, string(e.Data))
+	return err
+}
+
+// LastEventSeq returns the sequence number of the last event added, 0 if there are none
+func (s *SQLStore) LastEventSeq() (uint64, error) {
+	var seq uint64
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var err error
+		seq, err = sqlutil.Sequence(tx, eventsTable)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// FirstEventSeq returns the sequence number of the oldest event kept, 0 if there are none
+func (s *SQLStore) FirstEventSeq() (uint64, error) {
+	var first sql.NullInt64
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		return tx.QueryRow("SELECT MIN(seq) FROM webhook_events").Scan(&first)
+	}); err != nil {
+		return 0, err
+	}
+
+	return uint64(first.Int64), nil
+}
+
+// DeleteEvents deletes the events up to and including maxSeq that were added before a Unix time.
+// Returns the number of events deleted.
+func (s *SQLStore) DeleteEvents(maxSeq uint64, before int64) (int, error) {
+	var n int64
+	if err := s.db.Update(func(tx *sqlutil.Tx) error {
+		res, err := tx.Exec("DELETE FROM webhook_events WHERE seq <= ? AND timestamp < ?", int64(maxSeq), before)
+		if err != nil {
+			return err
+		}
+
+		n, err = res.RowsAffected()
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// GetEvent returns an event. If the event does not exist, returns nil and nil error.
+func (s *SQLStore) GetEvent(seq uint64) (*Event, error) {
+	e := Event{
+		Seq: seq,
+	}
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var data string
+		if err := tx.QueryRow("SELECT type, timestamp, data FROM webhook_events WHERE seq = ?",
+			int64(seq)).Scan(&e.Type, &e.Timestamp, &data); err != nil {
+			return err
+		}
+
+		e.Data = json.RawMessage(data)
+		return nil
+	}); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &e, nil
+}
+
+// GetEndpointStatus returns the delivery progress of an endpoint.
+// If it has none, returns nil and nil error.
+func (s *SQLStore) GetEndpointStatus(url string) (*EndpointStatus, error) {
+	var es EndpointStatus
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		var data string
+		if err := tx.QueryRow("SELECT data FROM webhook_endpoints WHERE url = ?", url).Scan(&data); err != nil {
+			return err
+		}
+
+		return json.Unmarshal([]byte(data), &es)
+	}); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &es, nil
+}
+
+// PutEndpointStatus saves the delivery progress of an endpoint
+func (s *SQLStore) PutEndpointStatus(es EndpointStatus) error {
+	return s.db.Update(func(tx *sqlutil.Tx) error {
+		return putEndpointStatusSQLTx(tx, es)
+	})
+}
+
+func putEndpointStatusSQLTx(tx *sqlutil.Tx, es EndpointStatus) error {
+	b, err := json.Marshal(es)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO webhook_endpoints (url, data) VALUES (?, ?)
+		ON CONFLICT (url) DO UPDATE SET data = excluded.data`, es.URL, string(b))
+	return err
+}
+
+// AddFailure records a Failure
+func (s *SQLStore) AddFailure(f Failure) (Failure, error) {
+	if err := s.db.Update(func(tx *sqlutil.Tx) error {
+		seq, err := sqlutil.NextSequence(tx, failuresTable)
+		if err != nil {
+			return err
+		}
+
+		f.Seq = seq
+
+		return putFailureSQLTx(tx, f)
+	}); err != nil {
+		return Failure{}, err
+	}
+
+	return f, nil
+}
+
+func putFailureSQLTx(tx *sqlutil.Tx, f Failure) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO webhook_failures (seq, timestamp, data) VALUES (?, ?, ?)",
+		int64(f.Seq), f.Timestamp, string(b))
+	return err
+}
+
+// GetFailures returns all failures, oldest first
+func (s *SQLStore) GetFailures() ([]Failure, error) {
+	var failures []Failure
+
+	if err := s.db.View(func(tx *sqlutil.Tx) error {
+		rows, err := tx.Query("SELECT data FROM webhook_failures ORDER BY seq")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+
+			var f Failure
+			if err := json.Unmarshal([]byte(data), &f); err != nil {
+				return err
+			}
+
+			failures = append(failures, f)
+		}
+
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	return failures, nil
+}
+
+// ImportBolt copies the events and their delivery progress from a bolt database,
+// keeping their sequence numbers
+func (s *SQLStore) ImportBolt(db *bolt.DB) error {
+	return db.View(func(boltTx *bolt.Tx) error {
+		return s.db.Update(func(tx *sqlutil.Tx) error {
+			if err := dbutil.ForEachIfExists(boltTx, EventsBkt, func(k, v []byte) error {
+				var e Event
+				if err := json.Unmarshal(v, &e); err != nil {
+					return err
+				}
+				return putEventSQLTx(tx, e)
+			}); err != nil {
+				return err
+			}
+
+			if err := dbutil.ForEachIfExists(boltTx, EndpointsBkt, func(k, v []byte) error {
+				var es EndpointStatus
+				if err := json.Unmarshal(v, &es); err != nil {
+					return err
+				}
+				return putEndpointStatusSQLTx(tx, es)
+			}); err != nil {
+				return err
+			}
+
+			if err := dbutil.ForEachIfExists(boltTx, FailuresBkt, func(k, v []byte) error {
+				var f Failure
+				if err := json.Unmarshal(v, &f); err != nil {
+					return err
+				}
+				return putFailureSQLTx(tx, f)
+			}); err != nil {
+				return err
+			}
+
+			for _, bkt := range [][]byte{EventsBkt, FailuresBkt} {
+				if err := sqlutil.SetSequence(tx, string(bkt), dbutil.BucketSequence(boltTx, bkt)); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+}
+
+// RowCounts returns the number of rows of the tables
+func RowCounts(db *sqlutil.DB) (sqlutil.RowCounts, error) {
+	counts := make(sqlutil.RowCounts)
+	if err := db.View(func(tx *sqlutil.Tx) error {
+		for _, table := range []string{eventsTable, endpointsTable, failuresTable} {
+			n, err := sqlutil.CountRows(tx, table)
+			if err != nil {
+				return err
+			}
+			counts[table] = n
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// BoltRowCounts returns the number of rows that ImportBolt copies from a bolt database to each table
+func BoltRowCounts(db *bolt.DB) (sqlutil.RowCounts, error) {
+	counts := make(sqlutil.RowCounts)
+	if err := db.View(func(tx *bolt.Tx) error {
+		for _, bkt := range [][]byte{EventsBkt, EndpointsBkt, FailuresBkt} {
+			counts[string(bkt)] = dbutil.BucketKeyCount(tx, bkt)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
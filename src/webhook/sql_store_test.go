@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/sqlutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func addTestSQLEvent(t *testing.T, db *sqlutil.DB, eventType string) Event {
+	var e Event
+	require.NoError(t, db.Update(func(tx *sqlutil.Tx) error {
+		var err error
+		e, err = AddEventSQLTx(tx, eventType, time.Now().UTC().Unix(), map[string]string{
+			"deposit_id": "txid:0",
+		})
+		return err
+	}))
+	return e
+}
+
+func TestSQLStoreDispatcherDeliver(t *testing.T) {
+	db, shutdown := testutil.PrepareSQLDB(t)
+	defer shutdown()
+	log, _ := testutil.NewLogger(t)
+
+	te := &testEndpoint{t: t}
+	srv := httptest.NewServer(te)
+	defer srv.Close()
+
+	store, err := NewSQLStore(db)
+	require.NoError(t, err)
+
+	seq, err := store.LastEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), seq)
+
+	e, err := store.GetEvent(1)
+	require.NoError(t, err)
+	require.Nil(t, e)
+
+	// Events added before the endpoint was configured are not delivered
+	addTestSQLEvent(t, db, EventAddressBound)
+
+	d, err := NewWithStore(log, store, testCfg(srv.URL))
+	require.NoError(t, err)
+	require.NoError(t, d.initEndpoint(d.endpoints[0]))
+
+	addTestSQLEvent(t, db, EventDepositDetected)
+	addTestSQLEvent(t, db, EventStatusChanged)
+
+	d.deliverPending(d.endpoints[0])
+	require.Equal(t, []uint64{2, 3}, te.seqs())
+	require.Equal(t, EventStatusChanged, te.events[1].Type)
+	require.JSONEq(t, `{"deposit_id":"txid:0"}`, string(te.events[1].Data))
+
+	es, err := store.GetEndpointStatus(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), es.LastSeq)
+
+	es, err = store.GetEndpointStatus("https://example.org")
+	require.NoError(t, err)
+	require.Nil(t, es)
+
+	f, err := store.AddFailure(Failure{
+		URL:      srv.URL,
+		EventSeq: 3,
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), f.Seq)
+
+	failures, err := store.GetFailures()
+	require.NoError(t, err)
+	require.Equal(t, []Failure{f}, failures)
+
+	// Delivered events are deleted after the retention period
+	firstSeq, err := store.FirstEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), firstSeq)
+
+	n, err := store.DeleteEvents(2, time.Now().UTC().Unix())
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	n, err = store.DeleteEvents(2, time.Now().UTC().Add(time.Minute).Unix())
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	firstSeq, err = store.FirstEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), firstSeq)
+}
+
+func TestSQLStoreImportBolt(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	store, err := NewStore(db)
+	require.NoError(t, err)
+
+	addTestEvent(t, db, EventAddressBound)
+	e := addTestEvent(t, db, EventDepositDetected)
+
+	require.NoError(t, store.PutEndpointStatus(EndpointStatus{
+		URL:     "https://example.org",
+		LastSeq: 1,
+	}))
+
+	f, err := store.AddFailure(Failure{
+		URL:      "https://example.org",
+		EventSeq: 1,
+	})
+	require.NoError(t, err)
+
+	sqlDB, sqlShutdown := testutil.PrepareSQLDB(t)
+	defer sqlShutdown()
+
+	sqlStore, err := NewSQLStore(sqlDB)
+	require.NoError(t, err)
+	require.NoError(t, sqlStore.ImportBolt(db))
+
+	seq, err := sqlStore.LastEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), seq)
+
+	sqlE, err := sqlStore.GetEvent(2)
+	require.NoError(t, err)
+	require.Equal(t, e.Type, sqlE.Type)
+	require.Equal(t, e.Timestamp, sqlE.Timestamp)
+	require.JSONEq(t, string(e.Data), string(sqlE.Data))
+
+	es, err := sqlStore.GetEndpointStatus("https://example.org")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), es.LastSeq)
+
+	failures, err := sqlStore.GetFailures()
+	require.NoError(t, err)
+	require.Equal(t, []Failure{f}, failures)
+
+	boltCounts, err := BoltRowCounts(db)
+	require.NoError(t, err)
+	sqlCounts, err := RowCounts(sqlStore.db)
+	require.NoError(t, err)
+	require.Empty(t, boltCounts.Diff(sqlCounts))
+
+	// New events continue the sequence
+	require.Equal(t, uint64(3), addTestSQLEvent(t, sqlDB, EventStatusChanged).Seq)
+}
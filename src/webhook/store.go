@@ -0,0 +1,284 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// EventsBkt is the outbox of events, mapping a sequence number to an Event.
+	// It is written by the exchange, in the same transaction as the change the event reports.
+	EventsBkt = []byte("webhook_events")
+
+	// EndpointsBkt maps an endpoint URL to its EndpointStatus
+	EndpointsBkt = []byte("webhook_endpoints")
+
+	// FailuresBkt maps a sequence number to a Failure
+	FailuresBkt = []byte("webhook_failures")
+)
+
+// Event is a deposit lifecycle event, delivered as the JSON body of a webhook request
+type Event struct {
+	Seq       uint64          `json:"seq"`
+	Type      string          `json:"type"`
+	Timestamp int64           `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// EndpointStatus records the delivery progress of an endpoint
+type EndpointStatus struct {
+	URL         string `json:"url"`
+	LastSeq     uint64 `json:"last_seq"`     // The last event delivered or skipped. Later events are pending.
+	Attempts    int    `json:"attempts"`     // Failed attempts at delivering the event after LastSeq
+	NextAttempt int64  `json:"next_attempt"` // When the event after LastSeq is retried, after a failed attempt
+	LastError   string `json:"last_error"`   // The error of the last failed attempt
+	DeliveredAt int64  `json:"delivered_at"` // When an event was last delivered
+}
+
+// Failure records an event that was skipped after its delivery to an endpoint failed too many times
+type Failure struct {
+	Seq       uint64 `json:"seq"`
+	Timestamp int64  `json:"timestamp"`
+	URL       string `json:"url"`
+	EventSeq  uint64 `json:"event_seq"`
+	EventType string `json:"event_type"`
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error"`
+}
+
+// Storer records the events and their delivery
+type Storer interface {
+	LastEventSeq() (uint64, error)
+	FirstEventSeq() (uint64, error)
+	GetEvent(seq uint64) (*Event, error)
+	DeleteEvents(maxSeq uint64, before int64) (int, error)
+	GetEndpointStatus(url string) (*EndpointStatus, error)
+	PutEndpointStatus(EndpointStatus) error
+	AddFailure(Failure) (Failure, error)
+	GetFailures() ([]Failure, error)
+}
+
+// Store records the events and their delivery
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore creates a Store
+func NewStore(db *bolt.DB) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("new webhook Store failed, db is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, bkt := range [][]byte{EventsBkt, EndpointsBkt, FailuresBkt} {
+			if _, err := tx.CreateBucketIfNotExists(bkt); err != nil {
+				return dbutil.NewCreateBucketFailedErr(bkt, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db: db,
+	}, nil
+}
+
+// AddEventTx adds an event to the outbox, with data marshaled to JSON.
+// EventsBkt must exist.
+func AddEventTx(tx *bolt.Tx, eventType string, timestamp int64, data interface{}) (Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	seq, err := dbutil.NextSequence(tx, EventsBkt)
+	if err != nil {
+		return Event{}, err
+	}
+
+	e := Event{
+		Seq:       seq,
+		Type:      eventType,
+		Timestamp: timestamp,
+		Data:      b,
+	}
+
+	if err := dbutil.PutBucketValue(tx, EventsBkt, strconv.FormatUint(seq, 10), e); err != nil {
+		return Event{}, err
+	}
+
+	return e, nil
+}
+
+// LastEventSeq returns the sequence number of the last event added, 0 if there are none
+func (s *Store) LastEventSeq() (uint64, error) {
+	var seq uint64
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(EventsBkt)
+		if bkt == nil {
+			return dbutil.NewBucketNotExistErr(EventsBkt)
+		}
+
+		seq = bkt.Sequence()
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// FirstEventSeq returns the sequence number of the oldest event kept, 0 if there are none
+func (s *Store) FirstEventSeq() (uint64, error) {
+	var first uint64
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		// Keys are sorted as strings, not numbers
+		return dbutil.ForEach(tx, EventsBkt, func(k, v []byte) error {
+			seq, err := strconv.ParseUint(string(k), 10, 64)
+			if err != nil {
+				return err
+			}
+
+			if first == 0 || seq < first {
+				first = seq
+			}
+
+			return nil
+		})
+	}); err != nil {
+		return 0, err
+	}
+
+	return first, nil
+}
+
+// DeleteEvents deletes the events up to and including maxSeq that were added before a Unix time.
+// Returns the number of events deleted.
+func (s *Store) DeleteEvents(maxSeq uint64, before int64) (int, error) {
+	var n int
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		var keys [][]byte
+		if err := dbutil.ForEach(tx, EventsBkt, func(k, v []byte) error {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			if e.Seq <= maxSeq && e.Timestamp < before {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		bkt := tx.Bucket(EventsBkt)
+		for _, k := range keys {
+			if err := bkt.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		n = len(keys)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// GetEvent returns an event. If the event does not exist, returns nil and nil error.
+func (s *Store) GetEvent(seq uint64) (*Event, error) {
+	var e Event
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.GetBucketObject(tx, EventsBkt, strconv.FormatUint(seq, 10), &e)
+	}); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &e, nil
+}
+
+// GetEndpointStatus returns the delivery progress of an endpoint.
+// If it has none, returns nil and nil error.
+func (s *Store) GetEndpointStatus(url string) (*EndpointStatus, error) {
+	var es EndpointStatus
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.GetBucketObject(tx, EndpointsBkt, url, &es)
+	}); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &es, nil
+}
+
+// PutEndpointStatus saves the delivery progress of an endpoint
+func (s *Store) PutEndpointStatus(es EndpointStatus) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, EndpointsBkt, es.URL, es)
+	})
+}
+
+// AddFailure records a Failure
+func (s *Store) AddFailure(f Failure) (Failure, error) {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		seq, err := dbutil.NextSequence(tx, FailuresBkt)
+		if err != nil {
+			return err
+		}
+
+		f.Seq = seq
+
+		return dbutil.PutBucketValue(tx, FailuresBkt, strconv.FormatUint(seq, 10), f)
+	}); err != nil {
+		return Failure{}, err
+	}
+
+	return f, nil
+}
+
+// GetFailures returns all failures, oldest first
+func (s *Store) GetFailures() ([]Failure, error) {
+	var failures []Failure
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, FailuresBkt, func(k, v []byte) error {
+			var f Failure
+			if err := json.Unmarshal(v, &f); err != nil {
+				return err
+			}
+
+			failures = append(failures, f)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	// Keys are sorted as strings, not numbers
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].Seq < failures[j].Seq
+	})
+
+	return failures, nil
+}
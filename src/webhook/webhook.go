@@ -0,0 +1,598 @@
+// Package webhook notifies other systems of deposit lifecycle events, by posting them to configured URLs
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const (
+	// EventAddressBound is emitted when a deposit address is bound to a skycoin address
+	EventAddressBound = "address_bound"
+	// EventDepositDetected is emitted when a deposit is received
+	EventDepositDetected = "deposit_detected"
+	// EventStatusChanged is emitted when a deposit's status changes
+	EventStatusChanged = "status_changed"
+	// EventPayoutSent is emitted when the coins owed for a deposit are sent
+	EventPayoutSent = "payout_sent"
+	// EventPayoutConfirmed is emitted when the transaction sending the coins is confirmed
+	EventPayoutConfirmed = "payout_confirmed"
+	// EventDepositErrored is emitted when processing a deposit fails
+	EventDepositErrored = "deposit_errored"
+
+	// SignatureHeader is the request header holding the signature of the body
+	SignatureHeader = "X-Teller-Signature"
+	// EventHeader is the request header holding the event type
+	EventHeader = "X-Teller-Event"
+	// EventSeqHeader is the request header holding the event sequence number, which identifies an event
+	EventSeqHeader = "X-Teller-Event-Seq"
+
+	// Largest response body read from an endpoint
+	maxResponseSize = 64 * 1024
+
+	// How often to delete the events that every endpoint has received and that are older than cfg.Retention
+	pruneWait = time.Hour
+)
+
+var (
+	// EventTypes are the types of events emitted
+	EventTypes = []string{
+		EventAddressBound,
+		EventDepositDetected,
+		EventStatusChanged,
+		EventPayoutSent,
+		EventPayoutConfirmed,
+		EventDepositErrored,
+	}
+
+	// ErrUnknownEndpoint is returned by Replay for a URL that is not configured
+	ErrUnknownEndpoint = errors.New("Unknown webhook endpoint")
+	// ErrInvalidReplaySeq is returned by Replay for a sequence number that is not an event's
+	ErrInvalidReplaySeq = errors.New("Invalid event sequence number")
+	// ErrReplayEventsPruned is returned by Replay for a sequence number of an event that was deleted
+	ErrReplayEventsPruned = errors.New("Events from this sequence number were deleted after the retention period")
+)
+
+// ValidateEventType returns an error if an event type string is invalid
+func ValidateEventType(eventType string) error {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid webhook event type \"%s\"", eventType)
+}
+
+// Sign returns the signature of a request body, as sent in SignatureHeader:
+// "sha256=" followed by the hex-encoded HMAC-SHA256 of the body, keyed with the endpoint's secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body) // nolint: errcheck
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// endpoint is a configured endpoint with its event types
+type endpoint struct {
+	cfg    config.WebhookEndpoint
+	events map[string]struct{}
+}
+
+// subscribed returns true if the endpoint receives events of a type
+func (e endpoint) subscribed(eventType string) bool {
+	if len(e.events) == 0 {
+		return true
+	}
+
+	_, ok := e.events[eventType]
+	return ok
+}
+
+// Dispatcher delivers the events in the outbox to the configured endpoints.
+// Each endpoint receives the events in order, at least once, and is retried independently,
+// waiting exponentially longer after each failed attempt. After cfg.MaxAttempts failed attempts,
+// the event is skipped for that endpoint and recorded as a Failure.
+// Delivery progress is recorded in the Store, so it is resumed after a restart.
+// Events that every endpoint has received are deleted once they are older than cfg.Retention.
+type Dispatcher struct {
+	log       logrus.FieldLogger
+	cfg       config.Webhooks
+	store     Storer
+	client    *http.Client
+	endpoints []endpoint
+	quit      chan struct{}
+	done      chan struct{}
+	// Protects the EndpointStatus records from concurrent updates by the deliveries and Replay
+	sync.Mutex
+}
+
+// New creates a Dispatcher, recording the delivery progress in db
+func New(log logrus.FieldLogger, db *bolt.DB, cfg config.Webhooks) (*Dispatcher, error) {
+	store, err := NewStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithStore(log, store, cfg)
+}
+
+// NewWithStore creates a Dispatcher, recording the delivery progress in store
+func NewWithStore(log logrus.FieldLogger, store Storer, cfg config.Webhooks) (*Dispatcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var endpoints []endpoint
+	for _, e := range cfg.Endpoints {
+		events := make(map[string]struct{}, len(e.Events))
+		for _, t := range e.Events {
+			if err := ValidateEventType(t); err != nil {
+				return nil, fmt.Errorf("webhooks.endpoints events of \"%s\" invalid: %v", e.URL, err)
+			}
+			events[t] = struct{}{}
+		}
+
+		endpoints = append(endpoints, endpoint{
+			cfg:    e,
+			events: events,
+		})
+	}
+
+	return &Dispatcher{
+		log:   log.WithField("prefix", "teller.webhook"),
+		cfg:   cfg,
+		store: store,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		endpoints: endpoints,
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}, 1),
+	}, nil
+}
+
+// Run delivers the events to the endpoints until Shutdown is called
+func (d *Dispatcher) Run() error {
+	log := d.log
+	log.Info("Start webhook service...")
+	defer func() {
+		log.Info("Closed webhook service")
+		d.done <- struct{}{}
+	}()
+
+	if len(d.endpoints) == 0 {
+		log.Info("No webhook endpoints configured")
+		<-d.quit
+		return nil
+	}
+
+	// Endpoints that were not configured before receive the events added from now on.
+	// Earlier events can be delivered with Replay.
+	for _, e := range d.endpoints {
+		if err := d.initEndpoint(e); err != nil {
+			log.WithError(err).WithField("url", e.cfg.URL).Error("initEndpoint failed")
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, e := range d.endpoints {
+		wg.Add(1)
+		go func(e endpoint) {
+			defer wg.Done()
+			d.runEndpoint(e)
+		}(e)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.runPrune()
+	}()
+
+	wg.Wait()
+
+	return nil
+}
+
+// Shutdown stops a previous call to Run
+func (d *Dispatcher) Shutdown() {
+	d.log.Info("Shutting down Dispatcher")
+	close(d.quit)
+	d.log.Info("Waiting for run to finish")
+	<-d.done
+	d.log.Info("Shutdown complete")
+}
+
+// initEndpoint records the delivery progress of an endpoint that has none
+func (d *Dispatcher) initEndpoint(e endpoint) error {
+	d.Lock()
+	defer d.Unlock()
+
+	es, err := d.store.GetEndpointStatus(e.cfg.URL)
+	if err != nil {
+		return err
+	}
+
+	if es != nil {
+		return nil
+	}
+
+	lastSeq, err := d.store.LastEventSeq()
+	if err != nil {
+		return err
+	}
+
+	d.log.WithFields(logrus.Fields{
+		"url":     e.cfg.URL,
+		"lastSeq": lastSeq,
+	}).Info("Added webhook endpoint")
+
+	return d.store.PutEndpointStatus(EndpointStatus{
+		URL:     e.cfg.URL,
+		LastSeq: lastSeq,
+	})
+}
+
+// runEndpoint delivers the pending events of an endpoint every cfg.CheckWait
+func (d *Dispatcher) runEndpoint(e endpoint) {
+	ticker := time.NewTicker(d.cfg.CheckWait)
+	defer ticker.Stop()
+
+	for {
+		d.deliverPending(e)
+
+		select {
+		case <-d.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runPrune deletes the delivered events every pruneWait
+func (d *Dispatcher) runPrune() {
+	ticker := time.NewTicker(pruneWait)
+	defer ticker.Stop()
+
+	for {
+		if err := d.prune(); err != nil {
+			d.log.WithError(err).Error("prune failed")
+		}
+
+		select {
+		case <-d.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes the events that every configured endpoint has received or skipped
+// and that are older than cfg.Retention
+func (d *Dispatcher) prune() error {
+	d.Lock()
+	defer d.Unlock()
+
+	var maxSeq uint64
+	for i, e := range d.endpoints {
+		es, err := d.store.GetEndpointStatus(e.cfg.URL)
+		if err != nil {
+			return err
+		}
+
+		if es == nil {
+			return nil
+		}
+
+		if i == 0 || es.LastSeq < maxSeq {
+			maxSeq = es.LastSeq
+		}
+	}
+
+	if maxSeq == 0 {
+		return nil
+	}
+
+	before := time.Now().UTC().Add(-d.cfg.Retention).Unix()
+	n, err := d.store.DeleteEvents(maxSeq, before)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		d.log.WithFields(logrus.Fields{
+			"maxSeq": maxSeq,
+			"events": n,
+		}).Info("Deleted delivered webhook events")
+	}
+
+	return nil
+}
+
+// deliverPending delivers the pending events of an endpoint in order,
+// until none are left or a delivery fails
+func (d *Dispatcher) deliverPending(e endpoint) {
+	log := d.log.WithField("url", e.cfg.URL)
+
+	for {
+		select {
+		case <-d.quit:
+			return
+		default:
+		}
+
+		es, err := d.store.GetEndpointStatus(e.cfg.URL)
+		if err != nil {
+			log.WithError(err).Error("store.GetEndpointStatus failed")
+			return
+		}
+
+		if es == nil || es.NextAttempt > time.Now().UTC().Unix() {
+			return
+		}
+
+		lastSeq, err := d.store.LastEventSeq()
+		if err != nil {
+			log.WithError(err).Error("store.LastEventSeq failed")
+			return
+		}
+
+		if es.LastSeq >= lastSeq {
+			return
+		}
+
+		event, err := d.store.GetEvent(es.LastSeq + 1)
+		if err != nil {
+			log.WithError(err).Error("store.GetEvent failed")
+			return
+		}
+
+		var deliverErr error
+		delivered := false
+		switch {
+		case event == nil:
+			log.WithField("seq", es.LastSeq+1).Error("FIXME: Webhook event missing from the outbox, skipping it")
+		case e.subscribed(event.Type):
+			deliverErr = d.deliver(e, *event)
+			delivered = deliverErr == nil
+		}
+
+		if next, err := d.recordAttempt(e, *es, es.LastSeq+1, event, delivered, deliverErr); err != nil {
+			log.WithError(err).Error("recordAttempt failed")
+			return
+		} else if !next {
+			return
+		}
+	}
+}
+
+// recordAttempt records the outcome of an attempt at delivering the event with sequence number seq.
+// The endpoint moves on to the next event unless the attempt failed and will be retried.
+// Returns true if the next event can be delivered.
+// If the endpoint's progress was changed by Replay during the attempt, nothing is recorded.
+func (d *Dispatcher) recordAttempt(e endpoint, prev EndpointStatus, seq uint64, event *Event, delivered bool, deliverErr error) (bool, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	es, err := d.store.GetEndpointStatus(e.cfg.URL)
+	if err != nil {
+		return false, err
+	}
+
+	if es == nil || es.LastSeq != prev.LastSeq || es.Attempts != prev.Attempts {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	log := d.log.WithFields(logrus.Fields{
+		"url": e.cfg.URL,
+		"seq": seq,
+	})
+
+	if deliverErr != nil {
+		es.Attempts++
+		es.LastError = deliverErr.Error()
+		log = log.WithError(deliverErr).WithFields(logrus.Fields{
+			"eventType": event.Type,
+			"attempts":  es.Attempts,
+		})
+
+		if es.Attempts < d.cfg.MaxAttempts {
+			wait := d.backoff(es.Attempts)
+			es.NextAttempt = now.Add(wait).Unix()
+			log.WithField("wait", wait).Warn("Webhook delivery failed, scheduled retry")
+			return false, d.store.PutEndpointStatus(*es)
+		}
+
+		if _, err := d.store.AddFailure(Failure{
+			Timestamp: now.Unix(),
+			URL:       e.cfg.URL,
+			EventSeq:  seq,
+			EventType: event.Type,
+			Attempts:  es.Attempts,
+			Error:     es.LastError,
+		}); err != nil {
+			return false, err
+		}
+
+		log.WithField("notice", logger.WatchNotice).Error("Webhook delivery failed too many times, the event was skipped")
+	}
+
+	es.LastSeq = seq
+	es.Attempts = 0
+	es.NextAttempt = 0
+	if delivered {
+		es.LastError = ""
+		es.DeliveredAt = now.Unix()
+		log.Debug("Delivered webhook event")
+	}
+
+	return true, d.store.PutEndpointStatus(*es)
+}
+
+// deliver posts an event to an endpoint. The delivery succeeded if the endpoint responds with a 2xx status.
+func (d *Dispatcher) deliver(e endpoint, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(EventSeqHeader, strconv.FormatUint(event.Seq, 10))
+	req.Header.Set(SignatureHeader, Sign(e.cfg.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Read the body so that the connection can be reused
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseSize)); err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook endpoint responded with status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// backoff returns how long to wait after a number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.InitialWait
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= d.cfg.MaxWait {
+			return d.cfg.MaxWait
+		}
+	}
+
+	return wait
+}
+
+// Replay redelivers the events from sequence number fromSeq onwards to an endpoint,
+// or to every endpoint if url is empty. A pending retry is cancelled, and its event is delivered again.
+// Events that were deleted after cfg.Retention can't be replayed.
+// The endpoints' updated progress is returned.
+func (d *Dispatcher) Replay(url string, fromSeq uint64, actor string) ([]EndpointStatus, error) {
+	var endpoints []endpoint
+	for _, e := range d.endpoints {
+		if url == "" || e.cfg.URL == url {
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	if len(endpoints) == 0 {
+		return nil, ErrUnknownEndpoint
+	}
+
+	lastSeq, err := d.store.LastEventSeq()
+	if err != nil {
+		return nil, err
+	}
+
+	if fromSeq == 0 || fromSeq > lastSeq {
+		return nil, ErrInvalidReplaySeq
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	// Checked while locked, so that the events are not deleted before the endpoints are rewound
+	firstSeq, err := d.store.FirstEventSeq()
+	if err != nil {
+		return nil, err
+	}
+
+	if firstSeq == 0 || fromSeq < firstSeq {
+		return nil, ErrReplayEventsPruned
+	}
+
+	var statuses []EndpointStatus
+	for _, e := range endpoints {
+		es, err := d.store.GetEndpointStatus(e.cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		if es == nil {
+			es = &EndpointStatus{
+				URL: e.cfg.URL,
+			}
+		}
+
+		es.LastSeq = fromSeq - 1
+		es.Attempts = 0
+		es.NextAttempt = 0
+
+		if err := d.store.PutEndpointStatus(*es); err != nil {
+			return nil, err
+		}
+
+		d.log.WithField("notice", logger.WatchNotice).WithFields(logrus.Fields{
+			"url":     e.cfg.URL,
+			"fromSeq": fromSeq,
+			"actor":   actor,
+		}).Info("Replaying webhook events")
+
+		statuses = append(statuses, *es)
+	}
+
+	return statuses, nil
+}
+
+// EndpointStatuses returns the delivery progress of every configured endpoint
+func (d *Dispatcher) EndpointStatuses() ([]EndpointStatus, error) {
+	statuses := []EndpointStatus{}
+	for _, e := range d.endpoints {
+		es, err := d.store.GetEndpointStatus(e.cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		if es == nil {
+			es = &EndpointStatus{
+				URL: e.cfg.URL,
+			}
+		}
+
+		statuses = append(statuses, *es)
+	}
+
+	return statuses, nil
+}
+
+// LastEventSeq returns the sequence number of the last event added to the outbox
+func (d *Dispatcher) LastEventSeq() (uint64, error) {
+	return d.store.LastEventSeq()
+}
+
+// GetFailures returns the events that were skipped after failing to be delivered, oldest first
+func (d *Dispatcher) GetFailures() ([]Failure, error) {
+	return d.store.GetFailures()
+}
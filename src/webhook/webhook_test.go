@@ -0,0 +1,347 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+const testSecret = "s3cret"
+
+// testEndpoint records the events posted to it, and fails while fail is set
+type testEndpoint struct {
+	sync.Mutex
+	t      *testing.T
+	events []Event
+	fail   bool
+}
+
+func (e *testEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.Lock()
+	defer e.Unlock()
+
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(e.t, err)
+	require.Equal(e.t, Sign(testSecret, body), r.Header.Get(SignatureHeader))
+
+	var event Event
+	require.NoError(e.t, json.Unmarshal(body, &event))
+	require.Equal(e.t, event.Type, r.Header.Get(EventHeader))
+	require.Equal(e.t, strconv.FormatUint(event.Seq, 10), r.Header.Get(EventSeqHeader))
+
+	if e.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	e.events = append(e.events, event)
+}
+
+func (e *testEndpoint) seqs() []uint64 {
+	e.Lock()
+	defer e.Unlock()
+
+	var seqs []uint64
+	for _, ev := range e.events {
+		seqs = append(seqs, ev.Seq)
+	}
+	return seqs
+}
+
+func testCfg(urls ...string) config.Webhooks {
+	cfg := config.Webhooks{
+		Timeout:     time.Second,
+		MaxAttempts: 2,
+		InitialWait: time.Hour,
+		MaxWait:     time.Hour,
+		CheckWait:   time.Second,
+	}
+
+	for _, u := range urls {
+		cfg.Endpoints = append(cfg.Endpoints, config.WebhookEndpoint{
+			URL:    u,
+			Secret: testSecret,
+		})
+	}
+
+	return cfg
+}
+
+func addTestEvent(t *testing.T, db *bolt.DB, eventType string) Event {
+	return addTestEventAt(t, db, eventType, time.Now().UTC().Unix())
+}
+
+func addTestEventAt(t *testing.T, db *bolt.DB, eventType string, timestamp int64) Event {
+	var e Event
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		var err error
+		e, err = AddEventTx(tx, eventType, timestamp, map[string]string{
+			"deposit_id": "txid:0",
+		})
+		return err
+	}))
+	return e
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"seq":1}' | openssl dgst -sha256 -hmac s3cret
+	require.Equal(t, "sha256=63c42aa7cb12b8b8f8ddd18d325c916eaa51e352fac52fc5899c227a8db0cb11", Sign(testSecret, []byte(`{"seq":1}`)))
+	require.NotEqual(t, Sign(testSecret, []byte(`{"seq":1}`)), Sign("other", []byte(`{"seq":1}`)))
+	require.NotEqual(t, Sign(testSecret, []byte(`{"seq":1}`)), Sign(testSecret, []byte(`{"seq":2}`)))
+}
+
+func TestNewInvalidEvents(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+	log, _ := testutil.NewLogger(t)
+
+	cfg := testCfg("https://example.org/teller")
+	cfg.Endpoints[0].Events = []string{EventPayoutSent, "payout"}
+
+	_, err := New(log, db, cfg)
+	require.Error(t, err)
+}
+
+func TestDispatcherDeliver(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+	log, _ := testutil.NewLogger(t)
+
+	te := &testEndpoint{t: t}
+	srv := httptest.NewServer(te)
+	defer srv.Close()
+
+	// Events added before the endpoint was configured are not delivered
+	store, err := NewStore(db)
+	require.NoError(t, err)
+	require.NotNil(t, store)
+	addTestEvent(t, db, EventAddressBound)
+
+	d, err := New(log, db, testCfg(srv.URL))
+	require.NoError(t, err)
+	require.NoError(t, d.initEndpoint(d.endpoints[0]))
+
+	addTestEvent(t, db, EventDepositDetected)
+	addTestEvent(t, db, EventStatusChanged)
+
+	d.deliverPending(d.endpoints[0])
+	require.Equal(t, []uint64{2, 3}, te.seqs())
+
+	statuses, err := d.EndpointStatuses()
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	require.Equal(t, uint64(3), statuses[0].LastSeq)
+	require.NotZero(t, statuses[0].DeliveredAt)
+
+	// A failed delivery is retried after the backoff, and the later events wait for it
+	te.fail = true
+	addTestEvent(t, db, EventPayoutSent)
+	addTestEvent(t, db, EventPayoutConfirmed)
+
+	d.deliverPending(d.endpoints[0])
+	es, err := d.store.GetEndpointStatus(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), es.LastSeq)
+	require.Equal(t, 1, es.Attempts)
+	require.NotEmpty(t, es.LastError)
+	require.True(t, es.NextAttempt > time.Now().Unix())
+
+	// Not retried before the backoff elapsed
+	te.fail = false
+	d.deliverPending(d.endpoints[0])
+	require.Equal(t, []uint64{2, 3}, te.seqs())
+
+	es.NextAttempt = 0
+	require.NoError(t, d.store.PutEndpointStatus(*es))
+	d.deliverPending(d.endpoints[0])
+	require.Equal(t, []uint64{2, 3, 4, 5}, te.seqs())
+
+	es, err = d.store.GetEndpointStatus(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), es.LastSeq)
+	require.Equal(t, 0, es.Attempts)
+	require.Empty(t, es.LastError)
+
+	// After MaxAttempts failures the event is skipped and recorded
+	te.fail = true
+	addTestEvent(t, db, EventDepositErrored)
+	d.deliverPending(d.endpoints[0])
+
+	es, err = d.store.GetEndpointStatus(srv.URL)
+	require.NoError(t, err)
+	es.NextAttempt = 0
+	require.NoError(t, d.store.PutEndpointStatus(*es))
+	d.deliverPending(d.endpoints[0])
+
+	es, err = d.store.GetEndpointStatus(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), es.LastSeq)
+	require.Equal(t, 0, es.Attempts)
+
+	failures, err := d.GetFailures()
+	require.NoError(t, err)
+	require.Len(t, failures, 1)
+	require.Equal(t, uint64(6), failures[0].EventSeq)
+	require.Equal(t, EventDepositErrored, failures[0].EventType)
+	require.Equal(t, srv.URL, failures[0].URL)
+	require.Equal(t, 2, failures[0].Attempts)
+
+	// Replay redelivers the events from a sequence number
+	te.fail = false
+	_, err = d.Replay("", 0, "alice")
+	require.Equal(t, ErrInvalidReplaySeq, err)
+	_, err = d.Replay("", 7, "alice")
+	require.Equal(t, ErrInvalidReplaySeq, err)
+	_, err = d.Replay("https://example.org", 1, "alice")
+	require.Equal(t, ErrUnknownEndpoint, err)
+
+	statuses, err = d.Replay(srv.URL, 1, "alice")
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	require.Equal(t, uint64(0), statuses[0].LastSeq)
+
+	d.deliverPending(d.endpoints[0])
+	require.Equal(t, []uint64{2, 3, 4, 5, 1, 2, 3, 4, 5, 6}, te.seqs())
+}
+
+func TestDispatcherPrune(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+	log, _ := testutil.NewLogger(t)
+
+	te1 := &testEndpoint{t: t}
+	srv1 := httptest.NewServer(te1)
+	defer srv1.Close()
+
+	te2 := &testEndpoint{t: t}
+	srv2 := httptest.NewServer(te2)
+	defer srv2.Close()
+
+	cfg := testCfg(srv1.URL, srv2.URL)
+	cfg.Retention = time.Hour
+
+	d, err := New(log, db, cfg)
+	require.NoError(t, err)
+	require.NoError(t, d.initEndpoint(d.endpoints[0]))
+	require.NoError(t, d.initEndpoint(d.endpoints[1]))
+
+	old := time.Now().UTC().Add(-time.Hour * 2).Unix()
+	for i := 0; i < 11; i++ {
+		addTestEventAt(t, db, EventDepositDetected, old)
+	}
+	addTestEvent(t, db, EventStatusChanged)
+
+	firstSeq, err := d.store.FirstEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), firstSeq)
+
+	// Events are kept until every endpoint has received them
+	d.deliverPending(d.endpoints[0])
+	require.NoError(t, d.prune())
+
+	firstSeq, err = d.store.FirstEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), firstSeq)
+
+	// Events within the retention period are kept after they were received
+	d.deliverPending(d.endpoints[1])
+	require.NoError(t, d.prune())
+
+	firstSeq, err = d.store.FirstEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(12), firstSeq)
+
+	lastSeq, err := d.LastEventSeq()
+	require.NoError(t, err)
+	require.Equal(t, uint64(12), lastSeq)
+
+	// The deleted events can't be replayed
+	_, err = d.Replay(srv1.URL, 11, "alice")
+	require.Equal(t, ErrReplayEventsPruned, err)
+
+	statuses, err := d.Replay(srv1.URL, 12, "alice")
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), statuses[0].LastSeq)
+}
+
+func TestDispatcherSubscribedEvents(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+	log, _ := testutil.NewLogger(t)
+
+	te := &testEndpoint{t: t}
+	srv := httptest.NewServer(te)
+	defer srv.Close()
+
+	cfg := testCfg(srv.URL)
+	cfg.Endpoints[0].Events = []string{EventPayoutSent, EventPayoutConfirmed}
+
+	d, err := New(log, db, cfg)
+	require.NoError(t, err)
+	require.NoError(t, d.initEndpoint(d.endpoints[0]))
+
+	for _, eventType := range EventTypes {
+		addTestEvent(t, db, eventType)
+	}
+
+	d.deliverPending(d.endpoints[0])
+	require.Equal(t, []uint64{4, 5}, te.seqs())
+
+	// The skipped events are not pending
+	es, err := d.store.GetEndpointStatus(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(EventTypes)), es.LastSeq)
+}
+
+func TestDispatcherRun(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+	log, _ := testutil.NewLogger(t)
+
+	te := &testEndpoint{t: t}
+	srv := httptest.NewServer(te)
+	defer srv.Close()
+
+	cfg := testCfg(srv.URL)
+	cfg.CheckWait = time.Millisecond * 10
+
+	d, err := New(log, db, cfg)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, d.Run())
+	}()
+
+	// Wait for the endpoint to be initialized before adding the event
+	for i := 0; i < 100; i++ {
+		es, err := d.store.GetEndpointStatus(srv.URL)
+		require.NoError(t, err)
+		if es != nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	addTestEvent(t, db, EventDepositDetected)
+
+	for i := 0; i < 100 && len(te.seqs()) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.Equal(t, []uint64{1}, te.seqs())
+
+	d.Shutdown()
+	<-done
+}
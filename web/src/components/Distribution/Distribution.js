@@ -216,6 +216,7 @@ class Distribution extends React.Component {
                     id="distribution.rate"
                     values={{
                       rate: +this.state.deposits.btc.fixed_exchange_rate,
+                      coin: this.state.coin.name,
                     }}
                   />
                 </Text>
@@ -224,6 +225,7 @@ class Distribution extends React.Component {
                     id="distribution.inventory"
                     values={{
                       coins: this.state.balance && this.state.balance.coins,
+                      coin: this.state.coin.name,
                     }}
                   />
                 </Text>
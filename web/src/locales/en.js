@@ -34,8 +34,8 @@ export default {
     discord: 'Discord',
   },
   distribution: {
-    rate: 'Current OTC rate: {rate} SKY/BTC',
-    inventory: 'Current inventory: {coins} SKY available',
+    rate: 'Current OTC rate: {rate} {coin}/BTC',
+    inventory: 'Current inventory: {coins} {coin} available',
     title: 'Skycoin OTC',
     heading: 'Skycoin OTC',
     headingEnded: 'Skycoin OTC is currently closed',
@@ -34,8 +34,8 @@ export default {
     discord: 'Discord',
   },
   distribution: {
-    rate: 'Current OTC rate: {rate} SKY/BTC',
-    inventory: 'Current inventory: {coins} SKY available',
+    rate: 'Current OTC rate: {rate} {coin}/BTC',
+    inventory: 'Current inventory: {coins} {coin} available',
     title: '天空币OTC',
     heading: '天空币OTC',
     headingEnded: '天空币暂时关门',